@@ -64,7 +64,13 @@ func init() {
 var EncryptAESCMD = &cobra.Command{
 	Use:   "aes",
 	Short: "encrypt file by aes, key's length must be 16/24/32",
-	Long:  `encrypt file by aes`,
+	Long: gutils.Dedent(`
+		encrypt file by aes
+
+		file is encrypted in authenticated segments by gcrypto.AEADEncryptFile,
+		so the memory usage stays flat no matter how large the file is.
+		can be decrypted by gcrypto.AEADDecryptFile.
+	`),
 	PreRunE: func(cmd *cobra.Command, _ []string) error {
 		return setupEncryptAESArgs(cmd)
 	},
@@ -118,20 +124,10 @@ func encryptFileByAes() error {
 	)
 	logger.Info("encrypt file")
 
-	cnt, err := os.ReadFile(in)
-	if err != nil {
-		return errors.Wrapf(err, "read file `%s`", in)
-	}
-
-	cipher, err := gcrypto.AEADEncrypt(secret, cnt, nil)
-	if err != nil {
+	if err := gcrypto.AEADEncryptFile(secret, in, out); err != nil {
 		return errors.Wrap(err, "encrypt")
 	}
 
-	if err = os.WriteFile(out, cipher, 0600); err != nil {
-		return errors.Wrapf(err, "write file `%s`", out)
-	}
-
 	logger.Info("successed")
 	return nil
 }
@@ -0,0 +1,357 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/spf13/cobra"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+	"github.com/Laisky/go-utils/v4/log"
+)
+
+// AgeCMD encrypt and decrypt files in age v1 format
+var AgeCMD = &cobra.Command{
+	Use:   "age",
+	Short: "encrypt and decrypt files in age v1 format",
+	Long: gutils.Dedent(`
+		encrypt and decrypt files in age v1 format (https://age-encryption.org/v1),
+		files can be opened by age/rage and other standard tooling.
+
+		support X25519 recipients and passphrase (scrypt),
+		content is processed in stream, the memory usage is flat.
+	`),
+	Args: NoExtraArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+	},
+}
+
+var ageCMDArgs = struct {
+	input           string
+	output          string
+	recipients      []string
+	recipientsFiles []string
+	identityFiles   []string
+	passphrase      bool
+}{}
+
+func init() {
+	rootCmd.AddCommand(AgeCMD)
+	AgeCMD.AddCommand(AgeKeygenCMD)
+	AgeCMD.AddCommand(AgeEncryptCMD)
+	AgeCMD.AddCommand(AgeDecryptCMD)
+
+	AgeCMD.PersistentFlags().StringVarP(&ageCMDArgs.output, "output", "o", "",
+		"output file, default to stdout")
+	for _, c := range []*cobra.Command{AgeEncryptCMD, AgeDecryptCMD} {
+		c.Flags().StringVarP(&ageCMDArgs.input, "input", "i", "", "input file, default to stdin")
+		c.Flags().BoolVarP(&ageCMDArgs.passphrase, "passphrase", "p", false,
+			"use passphrase, will prompt for input")
+	}
+
+	AgeEncryptCMD.Flags().StringArrayVarP(&ageCMDArgs.recipients, "recipient", "r", nil,
+		"recipient like `age1...`, can be repeated")
+	AgeEncryptCMD.Flags().StringArrayVarP(&ageCMDArgs.recipientsFiles, "recipients-file", "R", nil,
+		"file contains one recipient per line, can be repeated")
+	AgeDecryptCMD.Flags().StringArrayVarP(&ageCMDArgs.identityFiles, "identity", "k", nil,
+		"identity file generated by keygen or age-keygen, can be repeated")
+}
+
+// AgeKeygenCMD generate X25519 identity
+var AgeKeygenCMD = &cobra.Command{
+	Use:   "keygen",
+	Short: "generate X25519 identity",
+	Long: gutils.Dedent(`
+		generate X25519 identity, same format as age-keygen.
+		public key will be printed to stderr if output to file.
+
+		Run
+
+			gutils age keygen -o key.txt
+	`),
+	Args: NoExtraArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		identity, err := AgeKeygen(ageCMDArgs.output)
+		if err != nil {
+			return err
+		}
+
+		if ageCMDArgs.output != "" {
+			fmt.Fprintf(os.Stderr, "Public key: %s\n", identity.Recipient())
+		}
+
+		return nil
+	},
+}
+
+// AgeEncryptCMD encrypt file in age v1 format
+var AgeEncryptCMD = &cobra.Command{
+	Use:   "encrypt",
+	Short: "encrypt file in age v1 format",
+	Long: gutils.Dedent(`
+		encrypt file to recipients or by passphrase,
+		passphrase can not be used with recipients.
+
+		Run
+
+			gutils age encrypt -r age1... -i data.tar -o data.tar.age
+			tar cz dir | gutils age encrypt -R recipients.txt > dir.tar.gz.age
+			gutils age encrypt -p -i data.tar -o data.tar.age
+	`),
+	Args: NoExtraArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		var passphrase string
+		if ageCMDArgs.passphrase {
+			var err error
+			if passphrase, err = agePassphrase(); err != nil {
+				return err
+			}
+		}
+
+		recipients, err := loadAgeRecipients(ageCMDArgs.recipients,
+			ageCMDArgs.recipientsFiles, passphrase)
+		if err != nil {
+			return err
+		}
+
+		return AgeEncrypt(ageCMDArgs.input, ageCMDArgs.output, recipients...)
+	},
+}
+
+// AgeDecryptCMD decrypt file in age v1 format
+var AgeDecryptCMD = &cobra.Command{
+	Use:   "decrypt",
+	Short: "decrypt file in age v1 format",
+	Long: gutils.Dedent(`
+		decrypt file by identities or passphrase.
+
+		Run
+
+			gutils age decrypt -k key.txt -i data.tar.age -o data.tar
+			gutils age decrypt -k key.txt < dir.tar.gz.age | tar xz
+			gutils age decrypt -p -i data.tar.age -o data.tar
+	`),
+	Args: NoExtraArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		var passphrase string
+		if ageCMDArgs.passphrase {
+			var err error
+			if passphrase, err = agePassphrase(); err != nil {
+				return err
+			}
+		}
+
+		identities, err := loadAgeIdentities(ageCMDArgs.identityFiles, passphrase)
+		if err != nil {
+			return err
+		}
+
+		return AgeDecrypt(ageCMDArgs.input, ageCMDArgs.output, identities...)
+	},
+}
+
+func agePassphrase() (string, error) {
+	passphrase, err := gutils.InputPassword("input passphrase", nil)
+	if err != nil {
+		return "", errors.Wrap(err, "input passphrase")
+	}
+
+	return passphrase, nil
+}
+
+// loadAgeRecipients load recipients from arguments and files,
+// or passphrase recipient if passphrase is not empty
+func loadAgeRecipients(recipients, files []string, passphrase string) (
+	results []gcrypto.AgeRecipient, err error) {
+	if passphrase != "" {
+		if len(recipients) != 0 || len(files) != 0 {
+			return nil, errors.Errorf("passphrase can not be used with recipients")
+		}
+
+		recipient, err := gcrypto.NewAgeScryptRecipient(passphrase)
+		if err != nil {
+			return nil, errors.Wrap(err, "new scrypt recipient")
+		}
+
+		return []gcrypto.AgeRecipient{recipient}, nil
+	}
+
+	for _, r := range recipients {
+		recipient, err := gcrypto.ParseAgeX25519Recipient(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse recipient %q", r)
+		}
+
+		results = append(results, recipient)
+	}
+
+	for _, fpath := range files {
+		fileRecipients, err := readAgeKeysFile(fpath, gcrypto.ParseAgeRecipients)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, fileRecipients...)
+	}
+
+	if len(results) == 0 {
+		return nil, errors.Errorf("recipients or passphrase should be provided")
+	}
+
+	return results, nil
+}
+
+// loadAgeIdentities load identities from files,
+// passphrase identity will be appended if passphrase is not empty
+func loadAgeIdentities(files []string, passphrase string) (
+	results []gcrypto.AgeIdentity, err error) {
+	for _, fpath := range files {
+		fileIdentities, err := readAgeKeysFile(fpath, gcrypto.ParseAgeIdentities)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, fileIdentities...)
+	}
+
+	if passphrase != "" {
+		identity, err := gcrypto.NewAgeScryptIdentity(passphrase)
+		if err != nil {
+			return nil, errors.Wrap(err, "new scrypt identity")
+		}
+
+		results = append(results, identity)
+	}
+
+	if len(results) == 0 {
+		return nil, errors.Errorf("identities or passphrase should be provided")
+	}
+
+	return results, nil
+}
+
+func readAgeKeysFile[T any](fpath string, parse func(io.Reader) ([]T, error)) ([]T, error) {
+	fp, err := os.Open(fpath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open file %q", fpath)
+	}
+	defer gutils.SilentClose(fp)
+
+	keys, err := parse(fp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read file %q", fpath)
+	}
+
+	return keys, nil
+}
+
+// AgeKeygen generate X25519 identity and write to outputPath,
+// write to stdout if outputPath is empty.
+//
+// existing file will not be overwritten.
+func AgeKeygen(outputPath string) (*gcrypto.AgeX25519Identity, error) {
+	identity, err := gcrypto.NewAgeX25519Identity()
+	if err != nil {
+		return nil, errors.Wrap(err, "generate identity")
+	}
+
+	content := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n",
+		time.Now().UTC().Format(time.RFC3339), identity.Recipient(), identity)
+	if outputPath == "" {
+		_, err = os.Stdout.WriteString(content)
+		return identity, errors.Wrap(err, "write stdout")
+	}
+
+	fp, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create file %q", outputPath)
+	}
+	defer gutils.CloseWithLog(fp, log.Shared)
+
+	if _, err = fp.WriteString(content); err != nil {
+		return nil, errors.Wrapf(err, "write file %q", outputPath)
+	}
+
+	return identity, nil
+}
+
+// AgeEncrypt encrypt inputPath to outputPath in age v1 format,
+// read from stdin if inputPath is empty, write to stdout if outputPath is empty.
+func AgeEncrypt(inputPath, outputPath string, recipients ...gcrypto.AgeRecipient) error {
+	return ageConvert(inputPath, outputPath, func(src io.Reader, dst io.Writer) error {
+		w, err := gcrypto.NewAgeEncryptWriter(dst, recipients...)
+		if err != nil {
+			return errors.Wrap(err, "new encrypt writer")
+		}
+
+		if _, err = io.Copy(w, src); err != nil {
+			return errors.Wrap(err, "encrypt")
+		}
+
+		return w.Close()
+	})
+}
+
+// AgeDecrypt decrypt inputPath in age v1 format to outputPath,
+// read from stdin if inputPath is empty, write to stdout if outputPath is empty.
+func AgeDecrypt(inputPath, outputPath string, identities ...gcrypto.AgeIdentity) error {
+	return ageConvert(inputPath, outputPath, func(src io.Reader, dst io.Writer) error {
+		r, err := gcrypto.NewAgeDecryptReader(src, identities...)
+		if err != nil {
+			return errors.Wrap(err, "new decrypt reader")
+		}
+
+		if _, err = io.Copy(dst, r); err != nil {
+			return errors.Wrap(err, "decrypt")
+		}
+
+		return nil
+	})
+}
+
+// ageConvert read from inputPath or stdin, convert by f,
+// then write to outputPath atomically or stdout
+func ageConvert(inputPath, outputPath string, f func(src io.Reader, dst io.Writer) error) error {
+	src := io.Reader(os.Stdin)
+	if inputPath != "" {
+		fp, err := os.Open(inputPath)
+		if err != nil {
+			return errors.Wrapf(err, "open file %q", inputPath)
+		}
+		defer gutils.CloseWithLog(fp, log.Shared)
+
+		src = fp
+	}
+
+	if outputPath == "" {
+		bw := bufio.NewWriter(os.Stdout)
+		if err := f(src, bw); err != nil {
+			return err
+		}
+
+		return errors.Wrap(bw.Flush(), "write stdout")
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		bw := bufio.NewWriter(pw)
+		err := f(src, bw)
+		if err == nil {
+			err = bw.Flush()
+		}
+
+		_ = pw.CloseWithError(err)
+	}()
+
+	if err := gutils.ReplaceFileAtomic(outputPath, pr, 0600); err != nil {
+		_ = pr.CloseWithError(err)
+		return errors.Wrapf(err, "write file %q", outputPath)
+	}
+
+	return nil
+}
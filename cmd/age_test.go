@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+)
+
+func TestAgeEncryptDecrypt(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	key1File := filepath.Join(dir, "key1.txt")
+	key2File := filepath.Join(dir, "key2.txt")
+	id1, err := AgeKeygen(key1File)
+	require.NoError(t, err)
+	id2, err := AgeKeygen(key2File)
+	require.NoError(t, err)
+
+	_, err = AgeKeygen(key1File)
+	require.Error(t, err, "should not overwrite existing file")
+
+	recipientsFile := filepath.Join(dir, "recipients.txt")
+	require.NoError(t, os.WriteFile(recipientsFile,
+		[]byte("# team\n"+id2.Recipient().String()+"\n"), 0600))
+
+	plain, err := gcrypto.Salt(200 * 1024)
+	require.NoError(t, err)
+	in := filepath.Join(dir, "data")
+	enc := filepath.Join(dir, "data.age")
+	require.NoError(t, os.WriteFile(in, plain, 0600))
+
+	recipients, err := loadAgeRecipients([]string{id1.Recipient().String()},
+		[]string{recipientsFile}, "")
+	require.NoError(t, err)
+	require.Len(t, recipients, 2)
+	require.NoError(t, AgeEncrypt(in, enc, recipients...))
+
+	for i, keyFile := range []string{key1File, key2File} {
+		identities, err := loadAgeIdentities([]string{keyFile}, "")
+		require.NoError(t, err)
+
+		dec := filepath.Join(dir, "data.dec")
+		require.NoError(t, AgeDecrypt(enc, dec, identities...), i)
+		got, err := os.ReadFile(dec)
+		require.NoError(t, err)
+		require.Equal(t, plain, got)
+	}
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := loadAgeRecipients(nil, nil, "")
+		require.Error(t, err)
+		_, err = loadAgeRecipients([]string{id1.Recipient().String()}, nil, "pass")
+		require.ErrorContains(t, err, "can not be used with recipients")
+		_, err = loadAgeRecipients([]string{id1.String()}, nil, "")
+		require.Error(t, err)
+		_, err = loadAgeRecipients(nil, []string{key1File}, "")
+		require.Error(t, err)
+		_, err = loadAgeRecipients(nil, []string{filepath.Join(dir, "notexists")}, "")
+		require.Error(t, err)
+
+		_, err = loadAgeIdentities(nil, "")
+		require.Error(t, err)
+		_, err = loadAgeIdentities([]string{recipientsFile}, "")
+		require.Error(t, err)
+
+		identities, err := loadAgeIdentities([]string{key1File}, "pass")
+		require.NoError(t, err)
+		require.Len(t, identities, 2)
+
+		other, err := gcrypto.NewAgeX25519Identity()
+		require.NoError(t, err)
+		bad := filepath.Join(dir, "bad.dec")
+		require.Error(t, AgeDecrypt(enc, bad, other))
+		_, err = os.Stat(bad)
+		require.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/spf13/cobra"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+)
+
+// Pkcs12CMD convert between PKCS#12 and PEM
+var Pkcs12CMD = &cobra.Command{
+	Use:   "p12",
+	Short: "convert between PKCS#12 (.p12/.pfx) and PEM",
+	Args:  NoExtraArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+	},
+}
+
+// JKSCMD convert between JKS and PEM
+var JKSCMD = &cobra.Command{
+	Use:   "jks",
+	Short: "convert between java keystore (.jks) and PEM",
+	Args:  NoExtraArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+	},
+}
+
+var keystoreCMDArgs = struct {
+	input    string
+	output   string
+	prikey   string
+	cert     string
+	password string
+	alias    string
+	legacy   bool
+}{}
+
+func init() {
+	rootCmd.AddCommand(Pkcs12CMD)
+	rootCmd.AddCommand(JKSCMD)
+
+	for _, c := range []*cobra.Command{Pkcs12CMD, JKSCMD} {
+		c.PersistentFlags().StringVarP(&keystoreCMDArgs.output, "out", "o", "", "output file")
+		c.PersistentFlags().StringVarP(&keystoreCMDArgs.password, "password", "p", "",
+			"password of keystore, will prompt for input if empty")
+	}
+
+	for _, c := range []*cobra.Command{Pkcs12ToPemCMD, JKSToPemCMD} {
+		c.Flags().StringVarP(&keystoreCMDArgs.input, "file", "f", "", "keystore file")
+	}
+	for _, c := range []*cobra.Command{PemToPkcs12CMD, PemToJKSCMD} {
+		c.Flags().StringVarP(&keystoreCMDArgs.prikey, "prikey", "k", "", "private key file in PEM")
+		c.Flags().StringVarP(&keystoreCMDArgs.cert, "cert", "c", "",
+			"certificate chain file in PEM, leaf first")
+	}
+	PemToPkcs12CMD.Flags().BoolVar(&keystoreCMDArgs.legacy, "legacy", false,
+		"encrypt by 3DES for old Windows and Java")
+	PemToJKSCMD.Flags().StringVarP(&keystoreCMDArgs.alias, "alias", "a", "1", "alias of entry")
+
+	Pkcs12CMD.AddCommand(Pkcs12ToPemCMD)
+	Pkcs12CMD.AddCommand(PemToPkcs12CMD)
+	JKSCMD.AddCommand(JKSToPemCMD)
+	JKSCMD.AddCommand(PemToJKSCMD)
+}
+
+// Pkcs12ToPemCMD convert PKCS#12 to PEM
+var Pkcs12ToPemCMD = &cobra.Command{
+	Use:   "topem",
+	Short: "convert PKCS#12 to PEM",
+	Long: gutils.Dedent(`
+		write private key and certificate chain in PKCS#12 to one PEM file.
+
+		Run
+
+			gutils p12 topem -f server.p12 -o server.pem
+	`),
+	Args: NoExtraArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		password, err := keystorePassword()
+		if err != nil {
+			return err
+		}
+
+		return Pkcs12ToPem(keystoreCMDArgs.input, keystoreCMDArgs.output, password)
+	},
+}
+
+// PemToPkcs12CMD convert PEM to PKCS#12
+var PemToPkcs12CMD = &cobra.Command{
+	Use:   "frompem",
+	Short: "convert PEM to PKCS#12",
+	Long: gutils.Dedent(`
+		bundle private key and certificate chain into password-protected PKCS#12.
+
+		Run
+
+			gutils p12 frompem -k server.key -c server.crt -o server.p12
+	`),
+	Args: NoExtraArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		password, err := keystorePassword()
+		if err != nil {
+			return err
+		}
+
+		return PemToPkcs12(keystoreCMDArgs.prikey, keystoreCMDArgs.cert,
+			keystoreCMDArgs.output, password, keystoreCMDArgs.legacy)
+	},
+}
+
+// JKSToPemCMD convert JKS to PEM
+var JKSToPemCMD = &cobra.Command{
+	Use:   "topem",
+	Short: "convert JKS to PEM",
+	Long: gutils.Dedent(`
+		write all entries in JKS to one PEM file,
+		each entry is prefixed by a comment line of its alias.
+
+		Run
+
+			gutils jks topem -f keystore.jks -o keystore.pem
+	`),
+	Args: NoExtraArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		password, err := keystorePassword()
+		if err != nil {
+			return err
+		}
+
+		return JKSToPem(keystoreCMDArgs.input, keystoreCMDArgs.output, password)
+	},
+}
+
+// PemToJKSCMD convert PEM to JKS
+var PemToJKSCMD = &cobra.Command{
+	Use:   "frompem",
+	Short: "convert PEM to JKS",
+	Long: gutils.Dedent(`
+		write private key and certificate chain as one private key entry,
+		or write certificates as trusted certificate entries if no private key.
+
+		Run
+
+			gutils jks frompem -k server.key -c server.crt -a server -o keystore.jks
+			gutils jks frompem -c ca.crt -a ca -o truststore.jks
+	`),
+	Args: NoExtraArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		password, err := keystorePassword()
+		if err != nil {
+			return err
+		}
+
+		return PemToJKS(keystoreCMDArgs.prikey, keystoreCMDArgs.cert,
+			keystoreCMDArgs.alias, keystoreCMDArgs.output, password)
+	},
+}
+
+func keystorePassword() (string, error) {
+	if keystoreCMDArgs.password != "" {
+		return keystoreCMDArgs.password, nil
+	}
+
+	password, err := gutils.InputPassword("input password of keystore", nil)
+	if err != nil {
+		return "", errors.Wrap(err, "input password")
+	}
+
+	return password, nil
+}
+
+// readPrikeyAndCerts read private key and certificates in PEM,
+// prikey is nil if prikeyPath is empty
+func readPrikeyAndCerts(prikeyPath, certPath string) (
+	prikey crypto.PrivateKey, certs []*x509.Certificate, err error) {
+	if prikeyPath != "" {
+		prikeyPem, err := os.ReadFile(prikeyPath)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "read prikey %q", prikeyPath)
+		}
+
+		if prikey, err = gcrypto.Pem2Prikey(prikeyPem); err != nil {
+			return nil, nil, errors.Wrap(err, "parse prikey")
+		}
+	}
+
+	certsPem, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "read certs %q", certPath)
+	}
+
+	if certs, err = gcrypto.Pem2Certs(certsPem); err != nil {
+		return nil, nil, errors.Wrap(err, "parse certs")
+	}
+
+	return prikey, certs, nil
+}
+
+// writePrikeyAndCerts append private key and certificates in PEM to buf
+func writePrikeyAndCerts(buf *bytes.Buffer, prikey crypto.PrivateKey, certs []*x509.Certificate) error {
+	if prikey != nil {
+		prikeyPem, err := gcrypto.Prikey2Pem(prikey)
+		if err != nil {
+			return errors.Wrap(err, "marshal prikey")
+		}
+
+		buf.Write(prikeyPem)
+	}
+
+	buf.Write(gcrypto.Cert2Pem(certs...))
+	return nil
+}
+
+// Pkcs12ToPem convert PKCS#12 file to PEM file
+func Pkcs12ToPem(inputPath, outputPath, password string) error {
+	pfxData, err := os.ReadFile(inputPath)
+	if err != nil {
+		return errors.Wrapf(err, "read file %q", inputPath)
+	}
+
+	prikey, certs, err := gcrypto.Pkcs12ToPrikeyAndCerts(pfxData, password)
+	if err != nil {
+		return errors.Wrap(err, "decode pkcs12")
+	}
+
+	var buf bytes.Buffer
+	if err = writePrikeyAndCerts(&buf, prikey, certs); err != nil {
+		return err
+	}
+
+	return errors.Wrapf(os.WriteFile(outputPath, buf.Bytes(), 0600), "write file %q", outputPath)
+}
+
+// PemToPkcs12 convert private key and certificate chain in PEM to PKCS#12 file
+func PemToPkcs12(prikeyPath, certPath, outputPath, password string, legacy bool) error {
+	prikey, certs, err := readPrikeyAndCerts(prikeyPath, certPath)
+	if err != nil {
+		return err
+	}
+	if prikey == nil {
+		return errors.Errorf("prikey should not be empty")
+	}
+
+	var opts []gcrypto.Pkcs12Option
+	if legacy {
+		opts = append(opts, gcrypto.WithPkcs12Legacy())
+	}
+
+	pfxData, err := gcrypto.PrikeyAndCertsToPkcs12(prikey, certs, password, opts...)
+	if err != nil {
+		return errors.Wrap(err, "encode pkcs12")
+	}
+
+	return errors.Wrapf(os.WriteFile(outputPath, pfxData, 0600), "write file %q", outputPath)
+}
+
+// JKSToPem convert all entries in JKS file to PEM file
+func JKSToPem(inputPath, outputPath, password string) error {
+	jksData, err := os.ReadFile(inputPath)
+	if err != nil {
+		return errors.Wrapf(err, "read file %q", inputPath)
+	}
+
+	entries, err := gcrypto.JKSToEntries(jksData, password)
+	if err != nil {
+		return errors.Wrap(err, "decode jks")
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		fmt.Fprintf(&buf, "# alias: %s\n", entry.Alias)
+		if err = writePrikeyAndCerts(&buf, entry.Prikey, entry.Certs); err != nil {
+			return errors.Wrapf(err, "write entry %q", entry.Alias)
+		}
+	}
+
+	return errors.Wrapf(os.WriteFile(outputPath, buf.Bytes(), 0600), "write file %q", outputPath)
+}
+
+// PemToJKS convert PEM to JKS file
+//
+// if prikeyPath is empty, every certificate will be written as trusted certificate,
+// aliased by `<alias>-<index>` if there are more than one certificates.
+func PemToJKS(prikeyPath, certPath, alias, outputPath, password string) error {
+	prikey, certs, err := readPrikeyAndCerts(prikeyPath, certPath)
+	if err != nil {
+		return err
+	}
+
+	var entries []*gcrypto.JKSEntry
+	switch {
+	case prikey != nil:
+		entries = append(entries, &gcrypto.JKSEntry{
+			Alias:  alias,
+			Prikey: prikey,
+			Certs:  certs,
+		})
+	case len(certs) == 1:
+		entries = append(entries, &gcrypto.JKSEntry{
+			Alias: alias,
+			Certs: certs,
+		})
+	default:
+		for i, cert := range certs {
+			entries = append(entries, &gcrypto.JKSEntry{
+				Alias: fmt.Sprintf("%s-%d", alias, i),
+				Certs: []*x509.Certificate{cert},
+			})
+		}
+	}
+
+	jksData, err := gcrypto.EntriesToJKS(entries, password)
+	if err != nil {
+		return errors.Wrap(err, "encode jks")
+	}
+
+	return errors.Wrapf(os.WriteFile(outputPath, jksData, 0600), "write file %q", outputPath)
+}
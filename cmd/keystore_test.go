@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+)
+
+func TestKeystoreConvert(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	rootPrikeyPem, rootDer, err := gcrypto.NewECDSAPrikeyAndCert(gcrypto.ECDSACurveP256,
+		gcrypto.WithX509CertCommonName("root"),
+		gcrypto.WithX509CertIsCA(),
+	)
+	require.NoError(t, err)
+	rootPrikey, err := gcrypto.Pem2Prikey(rootPrikeyPem)
+	require.NoError(t, err)
+	root, err := gcrypto.Der2Cert(rootDer)
+	require.NoError(t, err)
+
+	prikey, err := gcrypto.NewECDSAPrikey(gcrypto.ECDSACurveP256)
+	require.NoError(t, err)
+	csrDer, err := gcrypto.NewX509CSR(prikey, gcrypto.WithX509CSRCommonName("leaf"))
+	require.NoError(t, err)
+	leafDer, err := gcrypto.NewX509CertByCSR(root, rootPrikey, csrDer)
+	require.NoError(t, err)
+	leaf, err := gcrypto.Der2Cert(leafDer)
+	require.NoError(t, err)
+
+	prikeyPem, err := gcrypto.Prikey2Pem(prikey)
+	require.NoError(t, err)
+	prikeyFile := filepath.Join(dir, "leaf.key")
+	require.NoError(t, os.WriteFile(prikeyFile, prikeyPem, 0600))
+	certFile := filepath.Join(dir, "chain.crt")
+	require.NoError(t, os.WriteFile(certFile, gcrypto.Cert2Pem(leaf, root), 0600))
+
+	checkPem := func(t *testing.T, pemFile string, wantPrikey bool, wantCerts ...*x509.Certificate) {
+		t.Helper()
+
+		pemData, err := os.ReadFile(pemFile)
+		require.NoError(t, err)
+
+		var gotCerts []*x509.Certificate
+		for {
+			var block *pem.Block
+			if block, pemData = pem.Decode(pemData); block == nil {
+				break
+			}
+
+			switch block.Type {
+			case "PRIVATE KEY":
+				require.True(t, wantPrikey)
+				gotPrikey, err := gcrypto.Der2Prikey(block.Bytes)
+				require.NoError(t, err)
+				require.True(t, prikey.Equal(gotPrikey))
+				wantPrikey = false
+			case "CERTIFICATE":
+				cert, err := gcrypto.Der2Cert(block.Bytes)
+				require.NoError(t, err)
+				gotCerts = append(gotCerts, cert)
+			default:
+				t.Fatalf("unexpected pem block %q", block.Type)
+			}
+		}
+
+		require.False(t, wantPrikey, "prikey not found")
+		require.Len(t, gotCerts, len(wantCerts))
+		for i := range wantCerts {
+			require.True(t, wantCerts[i].Equal(gotCerts[i]))
+		}
+	}
+
+	t.Run("pkcs12", func(t *testing.T) {
+		t.Parallel()
+
+		for _, legacy := range []bool{false, true} {
+			p12File := filepath.Join(dir, "out.p12")
+			if legacy {
+				p12File = filepath.Join(dir, "out-legacy.p12")
+			}
+
+			err := PemToPkcs12(prikeyFile, certFile, p12File, "passwd", legacy)
+			require.NoError(t, err)
+
+			pemFile := p12File + ".pem"
+			err = Pkcs12ToPem(p12File, pemFile, "passwd")
+			require.NoError(t, err)
+			checkPem(t, pemFile, true, leaf, root)
+
+			err = Pkcs12ToPem(p12File, pemFile, "wrong")
+			require.Error(t, err)
+		}
+
+		err := PemToPkcs12("", certFile, filepath.Join(dir, "nokey.p12"), "passwd", false)
+		require.Error(t, err)
+	})
+
+	t.Run("jks", func(t *testing.T) {
+		t.Parallel()
+
+		jksFile := filepath.Join(dir, "keystore.jks")
+		err := PemToJKS(prikeyFile, certFile, "server", jksFile, "password")
+		require.NoError(t, err)
+
+		pemFile := jksFile + ".pem"
+		err = JKSToPem(jksFile, pemFile, "password")
+		require.NoError(t, err)
+		checkPem(t, pemFile, true, leaf, root)
+
+		pemData, err := os.ReadFile(pemFile)
+		require.NoError(t, err)
+		require.Contains(t, string(pemData), "# alias: server\n")
+	})
+
+	t.Run("jks truststore", func(t *testing.T) {
+		t.Parallel()
+
+		jksFile := filepath.Join(dir, "truststore.jks")
+		err := PemToJKS("", certFile, "ca", jksFile, "password")
+		require.NoError(t, err)
+
+		pemFile := jksFile + ".pem"
+		err = JKSToPem(jksFile, pemFile, "password")
+		require.NoError(t, err)
+		checkPem(t, pemFile, false, leaf, root)
+
+		pemData, err := os.ReadFile(pemFile)
+		require.NoError(t, err)
+		require.Contains(t, string(pemData), "# alias: ca-0\n")
+		require.Contains(t, string(pemData), "# alias: ca-1\n")
+	})
+}
@@ -0,0 +1,184 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"github.com/spf13/cobra"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	gkms "github.com/Laisky/go-utils/v4/crypto/kms"
+	kmsfile "github.com/Laisky/go-utils/v4/crypto/kms/file"
+	"github.com/Laisky/go-utils/v4/log"
+)
+
+// KMS some kms command tools
+var KMS = &cobra.Command{
+	Use:   "kms",
+	Short: "shamir sealed file kms",
+	Args:  NoExtraArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+	},
+}
+
+var (
+	kmsKeyringPath      string
+	kmsSharesTotal      int
+	kmsSharesThreshold  int
+	kmsUnsealShareInput []string
+)
+
+func init() {
+	rootCmd.AddCommand(KMS)
+	KMS.PersistentFlags().StringVarP(&kmsKeyringPath, "keyring", "k", "", "filepath of keyring")
+
+	KMS.AddCommand(KMSInit)
+	KMSInit.Flags().IntVarP(&kmsSharesTotal, "shares", "n", 5, "number of shares to split master key")
+	KMSInit.Flags().IntVarP(&kmsSharesThreshold, "threshold", "t", 3, "number of shares required to unseal")
+
+	KMS.AddCommand(KMSUnseal)
+	KMSUnseal.Flags().StringSliceVarP(&kmsUnsealShareInput, "share", "s", nil,
+		"share in hex, will prompt for input if not enough shares provided")
+}
+
+// KMSInit create new shamir sealed keyring
+var KMSInit = &cobra.Command{
+	Use:   "init",
+	Short: "create new keyring sealed by shamir shares",
+	Long: gutils.Dedent(`
+		create new keyring sealed by random master key,
+		master key is split into shares, print each share in hex.
+
+		Run
+
+			go run main.go kms init -k keyring.json -n 5 -t 3
+	`),
+	Args: NoExtraArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		shares, err := InitKMS(context.Background(), kmsKeyringPath, kmsSharesTotal, kmsSharesThreshold)
+		if err != nil {
+			log.Shared.Panic("init kms", zap.Error(err))
+		}
+
+		for i, share := range shares {
+			fmt.Printf("share %d: %s\n", i+1, share)
+		}
+	},
+}
+
+// KMSUnseal unseal keyring by shamir shares
+var KMSUnseal = &cobra.Command{
+	Use:   "unseal",
+	Short: "unseal keyring by shamir shares, print status of all keks",
+	Long: gutils.Dedent(`
+		unseal keyring by shamir shares,
+		shares can be provided by flags or interactive input.
+
+		Run
+
+			go run main.go kms unseal -k keyring.json
+	`),
+	Args: NoExtraArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		ctx := context.Background()
+		kms, err := kmsfile.NewSealed(ctx, kmsKeyringPath)
+		if err != nil {
+			log.Shared.Panic("open keyring", zap.Error(err))
+		}
+
+		shares := kmsUnsealShareInput
+		for {
+			if len(shares) == 0 {
+				submitted, threshold := kms.UnsealProgress()
+				share, err := gutils.InputPassword(
+					fmt.Sprintf("input share (%d/%d)", submitted+1, threshold), nil)
+				if err != nil {
+					log.Shared.Panic("read share", zap.Error(err))
+				}
+
+				shares = append(shares, share)
+			}
+
+			unsealed, err := UnsealKMS(ctx, kms, shares[0])
+			if err != nil {
+				log.Shared.Panic("unseal kms", zap.Error(err))
+			}
+
+			shares = shares[1:]
+			if unsealed {
+				break
+			}
+		}
+
+		statuses, err := KMSKekStatuses(ctx, kms)
+		if err != nil {
+			log.Shared.Panic("get kek status", zap.Error(err))
+		}
+
+		fmt.Println("kms unsealed")
+		for _, s := range statuses {
+			fmt.Println(s)
+		}
+	},
+}
+
+// InitKMS create new keyring sealed by shamir shares, return shares in hex
+func InitKMS(ctx context.Context, keyringPath string, total, threshold int) (shares []string, err error) {
+	if keyringPath == "" {
+		return nil, errors.Errorf("keyring path cannot be empty")
+	}
+
+	rawShares, err := kmsfile.Init(ctx, keyringPath, total, threshold)
+	if err != nil {
+		return nil, errors.Wrap(err, "init keyring")
+	}
+
+	for _, share := range rawShares {
+		shares = append(shares, hex.EncodeToString(share))
+	}
+
+	return shares, nil
+}
+
+// UnsealKMS submit share in hex to kms
+func UnsealKMS(ctx context.Context, kms *kmsfile.KMS, share string) (unsealed bool, err error) {
+	rawShare, err := hex.DecodeString(strings.TrimSpace(share))
+	if err != nil {
+		return false, errors.Wrap(err, "decode share")
+	}
+
+	return kms.SubmitUnsealShare(ctx, rawShare)
+}
+
+// KMSKekStatuses return readable status of all keks
+func KMSKekStatuses(ctx context.Context, kms gkms.Interface) (statuses []string, err error) {
+	keks, err := kms.Keks(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "export keks")
+	}
+
+	kekIDs := make([]uint16, 0, len(keks))
+	for kekID := range keks {
+		kekIDs = append(kekIDs, kekID)
+	}
+	slices.Sort(kekIDs)
+
+	for _, kekID := range kekIDs {
+		status, err := kms.KekStatus(ctx, kekID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get status of kek %d", kekID)
+		}
+
+		statuses = append(statuses, fmt.Sprintf("kek %d: %s", kekID, status.String()))
+	}
+
+	return statuses, nil
+}
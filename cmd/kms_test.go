@@ -0,0 +1,41 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	kmsfile "github.com/Laisky/go-utils/v4/crypto/kms/file"
+)
+
+func TestInitKMS(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	shares, err := InitKMS(ctx, path, 3, 2)
+	require.NoError(t, err)
+	require.Len(t, shares, 3)
+
+	kms, err := kmsfile.NewSealed(ctx, path)
+	require.NoError(t, err)
+
+	_, err = UnsealKMS(ctx, kms, "not hex")
+	require.ErrorContains(t, err, "decode share")
+
+	unsealed, err := UnsealKMS(ctx, kms, shares[0])
+	require.NoError(t, err)
+	require.False(t, unsealed)
+	unsealed, err = UnsealKMS(ctx, kms, shares[2]+"\n")
+	require.NoError(t, err)
+	require.True(t, unsealed)
+
+	statuses, err := KMSKekStatuses(ctx, kms)
+	require.NoError(t, err)
+	require.Equal(t, []string{"kek 1: active"}, statuses)
+}
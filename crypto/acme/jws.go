@@ -0,0 +1,145 @@
+package acme
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"math/big"
+
+	"github.com/Laisky/errors/v2"
+
+	gjson "github.com/Laisky/go-utils/v4/json"
+	gjwt "github.com/Laisky/go-utils/v4/jwt"
+)
+
+// jwsMessage flattened JWS JSON serialization, refer to RFC-8555 6.2
+type jwsMessage struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// jwsHeader protected header of JWS
+type jwsHeader struct {
+	Alg   string    `json:"alg"`
+	Nonce string    `json:"nonce"`
+	URL   string    `json:"url"`
+	Kid   string    `json:"kid,omitempty"`
+	JWK   *gjwt.JWK `json:"jwk,omitempty"`
+}
+
+// decodeJSON decode raw json into v
+func decodeJSON(raw []byte, v any) error {
+	return gjson.NewDecoder(bytes.NewReader(raw)).Decode(v)
+}
+
+func b64Decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func b64Encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// parseJWS parse flattened JWS, return header and decoded payload,
+// signature is not verified.
+func parseJWS(raw []byte) (msg *jwsMessage, header *jwsHeader, payload []byte, err error) {
+	msg = new(jwsMessage)
+	if err = decodeJSON(raw, msg); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "decode jws")
+	}
+
+	protected, err := b64Decode(msg.Protected)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "decode protected header")
+	}
+
+	header = new(jwsHeader)
+	if err = decodeJSON(protected, header); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "decode protected header")
+	}
+
+	if payload, err = b64Decode(msg.Payload); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "decode payload")
+	}
+
+	return msg, header, payload, nil
+}
+
+// verifyJWS verify signature of msg by pubkey
+func verifyJWS(msg *jwsMessage, alg string, pubkey crypto.PublicKey) error {
+	sig, err := b64Decode(msg.Signature)
+	if err != nil {
+		return errors.Wrap(err, "decode signature")
+	}
+	signingInput := []byte(msg.Protected + "." + msg.Payload)
+
+	switch alg {
+	case "RS256":
+		pub, ok := pubkey.(*rsa.PublicKey)
+		if !ok {
+			return errors.Errorf("alg %q mismatch key type %T", alg, pubkey)
+		}
+
+		digest := sha256.Sum256(signingInput)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+	case "ES256", "ES384", "ES512":
+		pub, ok := pubkey.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.Errorf("alg %q mismatch key type %T", alg, pubkey)
+		}
+
+		var hasher hash.Hash
+		switch {
+		case alg == "ES256" && pub.Curve == elliptic.P256():
+			hasher = sha256.New()
+		case alg == "ES384" && pub.Curve == elliptic.P384():
+			hasher = sha512.New384()
+		case alg == "ES512" && pub.Curve == elliptic.P521():
+			hasher = sha512.New()
+		default:
+			return errors.Errorf("alg %q mismatch curve %s", alg, pub.Curve.Params().Name)
+		}
+
+		// signature is r|s in fixed length, refer to RFC-7518 3.4
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.Errorf("invalid signature length %d", len(sig))
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+
+		hasher.Write(signingInput)
+		if !ecdsa.Verify(pub, hasher.Sum(nil), r, s) {
+			return errors.Errorf("invalid signature")
+		}
+
+		return nil
+	case "EdDSA":
+		pub, ok := pubkey.(ed25519.PublicKey)
+		if !ok {
+			return errors.Errorf("alg %q mismatch key type %T", alg, pubkey)
+		}
+
+		if !ed25519.Verify(pub, signingInput, sig) {
+			return errors.Errorf("invalid signature")
+		}
+
+		return nil
+	default:
+		return errors.Errorf("unsupported alg %q", alg)
+	}
+}
+
+// KeyAuthorization key authorization of challenge token,
+// refer to RFC-8555 8.1
+func KeyAuthorization(token, thumbprint string) string {
+	return token + "." + thumbprint
+}
@@ -0,0 +1,201 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	gjson "github.com/Laisky/go-utils/v4/json"
+	gjwt "github.com/Laisky/go-utils/v4/jwt"
+)
+
+func testKey2JWK(t *testing.T, pubkey crypto.PublicKey) *gjwt.JWK {
+	t.Helper()
+
+	switch pub := pubkey.(type) {
+	case *rsa.PublicKey:
+		return &gjwt.JWK{
+			Kty: "RSA",
+			N:   b64Encode(pub.N.Bytes()),
+			E:   b64Encode(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return &gjwt.JWK{
+			Kty: "EC",
+			Crv: pub.Curve.Params().Name,
+			X:   b64Encode(pub.X.FillBytes(make([]byte, size))),
+			Y:   b64Encode(pub.Y.FillBytes(make([]byte, size))),
+		}
+	case ed25519.PublicKey:
+		return &gjwt.JWK{Kty: "OKP", Crv: "Ed25519", X: b64Encode(pub)}
+	default:
+		t.Fatalf("unsupported key %T", pubkey)
+		return nil
+	}
+}
+
+// testSignJWS sign payload to flattened JWS with jwk in header
+func testSignJWS(t *testing.T, alg string, prikey crypto.Signer, payload []byte) []byte {
+	t.Helper()
+
+	protected, err := gjson.Marshal(&jwsHeader{
+		Alg:   alg,
+		Nonce: "nonce",
+		URL:   "https://acme.example.com/new-account",
+		JWK:   testKey2JWK(t, prikey.Public()),
+	})
+	require.NoError(t, err)
+
+	msg := &jwsMessage{
+		Protected: b64Encode(protected),
+		Payload:   b64Encode(payload),
+	}
+	signingInput := []byte(msg.Protected + "." + msg.Payload)
+
+	var sig []byte
+	switch key := prikey.(type) {
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256(signingInput)
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		var digest []byte
+		switch alg {
+		case "ES384":
+			sum := sha512.Sum384(signingInput)
+			digest = sum[:]
+		default:
+			sum := sha256.Sum256(signingInput)
+			digest = sum[:]
+		}
+
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		require.NoError(t, err)
+		size := (key.Curve.Params().BitSize + 7) / 8
+		sig = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(key, signingInput)
+	}
+
+	msg.Signature = b64Encode(sig)
+	raw, err := gjson.Marshal(msg)
+	require.NoError(t, err)
+	return raw
+}
+
+func TestVerifyJWS(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		alg string
+		key crypto.Signer
+	}{
+		{"RS256", rsaKey},
+		{"ES256", p256Key},
+		{"ES384", p384Key},
+		{"EdDSA", edKey},
+	} {
+		t.Run(tc.alg, func(t *testing.T) {
+			t.Parallel()
+			payload := []byte(`{"termsOfServiceAgreed":true}`)
+			raw := testSignJWS(t, tc.alg, tc.key, payload)
+
+			msg, header, gotPayload, err := parseJWS(raw)
+			require.NoError(t, err)
+			require.Equal(t, payload, gotPayload)
+			require.Equal(t, tc.alg, header.Alg)
+			require.Equal(t, "nonce", header.Nonce)
+
+			pubkey, err := header.JWK.PublicKey()
+			require.NoError(t, err)
+			require.NoError(t, verifyJWS(msg, header.Alg, pubkey))
+
+			// tampered payload
+			tampered := *msg
+			tampered.Payload = b64Encode([]byte(`{"termsOfServiceAgreed":false}`))
+			require.Error(t, verifyJWS(&tampered, header.Alg, pubkey))
+
+			// unsupported alg
+			require.ErrorContains(t, verifyJWS(msg, "HS256", pubkey), "unsupported alg")
+			require.ErrorContains(t, verifyJWS(msg, "none", pubkey), "unsupported alg")
+		})
+	}
+
+	t.Run("alg mismatch key", func(t *testing.T) {
+		t.Parallel()
+		raw := testSignJWS(t, "ES256", p256Key, []byte("{}"))
+		msg, _, _, err := parseJWS(raw)
+		require.NoError(t, err)
+
+		require.Error(t, verifyJWS(msg, "ES384", &p256Key.PublicKey))
+		require.Error(t, verifyJWS(msg, "RS256", &p256Key.PublicKey))
+		require.Error(t, verifyJWS(msg, "EdDSA", &p256Key.PublicKey))
+	})
+}
+
+func TestJWK(t *testing.T) {
+	t.Parallel()
+
+	t.Run("thumbprint", func(t *testing.T) {
+		t.Parallel()
+
+		// example of RFC-7638 3.1
+		key := &gjwt.JWK{
+			Kty: "RSA",
+			N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECP" +
+				"ebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2Q" +
+				"vzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6" +
+				"WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+			E: "AQAB",
+		}
+		_, err := key.PublicKey()
+		require.NoError(t, err)
+		thumbprint, err := key.Thumbprint()
+		require.NoError(t, err)
+		require.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		weakRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+		require.NoError(t, err)
+
+		for _, key := range []*gjwt.JWK{
+			{Kty: "oct"},
+			testKey2JWK(t, &weakRSA.PublicKey),
+			{Kty: "RSA", N: "", E: "AQAB"},
+			{Kty: "EC", Crv: "P-224", X: "AA", Y: "AA"},
+			{Kty: "EC", Crv: "P-256", X: b64Encode(make([]byte, 32)), Y: b64Encode(make([]byte, 32))},
+			{Kty: "OKP", Crv: "X25519", X: b64Encode(make([]byte, 32))},
+			{Kty: "OKP", Crv: "Ed25519", X: b64Encode(make([]byte, 31))},
+		} {
+			_, err := key.PublicKey()
+			require.Error(t, err, key)
+		}
+	})
+
+	t.Run("key authorization", func(t *testing.T) {
+		t.Parallel()
+		require.Equal(t, "token.thumbprint", KeyAuthorization("token", "thumbprint"))
+	})
+}
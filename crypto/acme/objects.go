@@ -0,0 +1,167 @@
+package acme
+
+import (
+	"net/http"
+	"time"
+
+	gjwt "github.com/Laisky/go-utils/v4/jwt"
+)
+
+// status of ACME objects, refer to RFC-8555 7.1.6
+const (
+	statusPending     = "pending"
+	statusReady       = "ready"
+	statusProcessing  = "processing"
+	statusValid       = "valid"
+	statusInvalid     = "invalid"
+	statusDeactivated = "deactivated"
+)
+
+const (
+	// IdentifierTypeDNS dns identifier
+	IdentifierTypeDNS = "dns"
+	// IdentifierTypeIP ip identifier, refer to RFC-8738
+	IdentifierTypeIP = "ip"
+)
+
+// Identifier identifier to be certified
+type Identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// problem error document, refer to RFC-8555 6.7
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// Error implement error
+func (p *problem) Error() string {
+	return p.Type + ": " + p.Detail
+}
+
+const problemPrefix = "urn:ietf:params:acme:error:"
+
+func newProblem(status int, typ, detail string) *problem {
+	return &problem{
+		Type:   problemPrefix + typ,
+		Detail: detail,
+		Status: status,
+	}
+}
+
+func errMalformed(detail string) *problem {
+	return newProblem(http.StatusBadRequest, "malformed", detail)
+}
+
+func errUnauthorized(detail string) *problem {
+	return newProblem(http.StatusForbidden, "unauthorized", detail)
+}
+
+func errNotFound(detail string) *problem {
+	return newProblem(http.StatusNotFound, "malformed", detail)
+}
+
+type account struct {
+	id         string
+	key        *gjwt.JWK
+	thumbprint string
+	status     string
+	contact    []string
+	orderIDs   []string
+}
+
+type order struct {
+	id          string
+	accountID   string
+	status      string
+	expires     time.Time
+	identifiers []Identifier
+	notAfter    time.Time
+	authzIDs    []string
+	certID      string
+	err         *problem
+}
+
+type authorization struct {
+	id           string
+	accountID    string
+	identifier   Identifier
+	wildcard     bool
+	status       string
+	expires      time.Time
+	challengeIDs []string
+}
+
+type challenge struct {
+	id        string
+	authzID   string
+	typ       string
+	token     string
+	status    string
+	validated time.Time
+	err       *problem
+}
+
+type issuedCert struct {
+	id        string
+	accountID string
+	serial    string
+	der       []byte
+	chainPem  []byte
+	notAfter  time.Time
+}
+
+// json representations of ACME objects, refer to RFC-8555 7.1
+
+type directoryJSON struct {
+	NewNonce   string             `json:"newNonce"`
+	NewAccount string             `json:"newAccount"`
+	NewOrder   string             `json:"newOrder"`
+	RevokeCert string             `json:"revokeCert"`
+	Meta       *directoryMetaJSON `json:"meta,omitempty"`
+}
+
+type directoryMetaJSON struct {
+	TermsOfService string `json:"termsOfService,omitempty"`
+}
+
+type accountJSON struct {
+	Status  string   `json:"status"`
+	Contact []string `json:"contact,omitempty"`
+	Orders  string   `json:"orders"`
+}
+
+type orderListJSON struct {
+	Orders []string `json:"orders"`
+}
+
+type orderJSON struct {
+	Status         string       `json:"status"`
+	Expires        string       `json:"expires"`
+	Identifiers    []Identifier `json:"identifiers"`
+	NotAfter       string       `json:"notAfter,omitempty"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate,omitempty"`
+	Error          *problem     `json:"error,omitempty"`
+}
+
+type authorizationJSON struct {
+	Identifier Identifier      `json:"identifier"`
+	Status     string          `json:"status"`
+	Expires    string          `json:"expires"`
+	Challenges []challengeJSON `json:"challenges"`
+	Wildcard   bool            `json:"wildcard,omitempty"`
+}
+
+type challengeJSON struct {
+	Type      string   `json:"type"`
+	URL       string   `json:"url"`
+	Token     string   `json:"token"`
+	Status    string   `json:"status"`
+	Validated string   `json:"validated,omitempty"`
+	Error     *problem `json:"error,omitempty"`
+}
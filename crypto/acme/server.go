@@ -0,0 +1,1308 @@
+// Package acme is an ACME (RFC-8555) server backed by crypto/ca
+//
+// let clients like certbot and lego request certificates from internal CA.
+// accounts, orders, authorizations and challenges are kept in memory,
+// expired or invalid ones are removed periodically.
+// issued certificates and revocations are kept in the store of CA.
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+	"github.com/Laisky/go-utils/v4/crypto/ca"
+	gjson "github.com/Laisky/go-utils/v4/json"
+	gjwt "github.com/Laisky/go-utils/v4/jwt"
+	glog "github.com/Laisky/go-utils/v4/log"
+)
+
+const (
+	defaultNonceTTL        = 10 * time.Minute
+	defaultOrderTTL        = 24 * time.Hour
+	defaultValidateTimeout = 30 * time.Second
+	defaultMaxPendingOrder = 100
+	cleanInterval          = time.Minute
+	maxRequestBodySize     = 1 << 20
+)
+
+// Server ACME server, implements http.Handler
+type Server struct {
+	opt     *serverOption
+	ca      *ca.CA
+	baseURL *url.URL
+	mux     *http.ServeMux
+	nonces  *gutils.ExpCache[struct{}]
+
+	mu            sync.Mutex
+	accounts      map[string]*account
+	accountsByKey map[string]*account
+	orders        map[string]*order
+	authzs        map[string]*authorization
+	challenges    map[string]*challenge
+	certs         map[string]*issuedCert
+	certsBySerial map[string]*issuedCert
+}
+
+type serverOption struct {
+	logger          glog.Logger
+	validator       ChallengeValidator
+	challengeTypes  []string
+	nonceTTL        time.Duration
+	orderTTL        time.Duration
+	validateTimeout time.Duration
+	certValidFor    time.Duration
+	termsOfService  string
+	maxPendingOrder int
+}
+
+func (o *serverOption) fillDefault() *serverOption {
+	o.logger = glog.Shared.Named("acme")
+	o.validator = new(HTTP01Validator)
+	o.challengeTypes = []string{ChallengeTypeHTTP01}
+	o.nonceTTL = defaultNonceTTL
+	o.orderTTL = defaultOrderTTL
+	o.validateTimeout = defaultValidateTimeout
+	o.maxPendingOrder = defaultMaxPendingOrder
+	return o
+}
+
+func (o *serverOption) applyOpts(opts ...ServerOption) (*serverOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// ServerOption optional arguments for Server
+type ServerOption func(*serverOption) error
+
+// WithLogger set logger
+func WithLogger(logger glog.Logger) ServerOption {
+	return func(o *serverOption) error {
+		if logger == nil {
+			return errors.Errorf("logger is nil")
+		}
+
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithChallengeValidator set validator and challenge types offered to clients
+//
+// default to HTTP01Validator with `http-01` challenge.
+func WithChallengeValidator(validator ChallengeValidator, challengeTypes ...string) ServerOption {
+	return func(o *serverOption) error {
+		if validator == nil {
+			return errors.Errorf("validator is nil")
+		}
+		if len(challengeTypes) == 0 {
+			return errors.Errorf("challenge types should not be empty")
+		}
+
+		o.validator = validator
+		o.challengeTypes = challengeTypes
+		return nil
+	}
+}
+
+// WithNonceTTL set how long an unused nonce is valid
+//
+// default to 10 minutes
+func WithNonceTTL(ttl time.Duration) ServerOption {
+	return func(o *serverOption) error {
+		if ttl <= 0 {
+			return errors.Errorf("ttl should be positive")
+		}
+
+		o.nonceTTL = ttl
+		return nil
+	}
+}
+
+// WithOrderTTL set how long orders and authorizations are valid
+//
+// default to 24 hours
+func WithOrderTTL(ttl time.Duration) ServerOption {
+	return func(o *serverOption) error {
+		if ttl <= 0 {
+			return errors.Errorf("ttl should be positive")
+		}
+
+		o.orderTTL = ttl
+		return nil
+	}
+}
+
+// WithValidateTimeout set timeout of each challenge validation
+//
+// default to 30 seconds
+func WithValidateTimeout(timeout time.Duration) ServerOption {
+	return func(o *serverOption) error {
+		if timeout <= 0 {
+			return errors.Errorf("timeout should be positive")
+		}
+
+		o.validateTimeout = timeout
+		return nil
+	}
+}
+
+// WithCertValidFor set validity of issued certificates
+//
+// default to the default of CA.Sign.
+// client can request shorter validity by notAfter of order.
+func WithCertValidFor(validFor time.Duration) ServerOption {
+	return func(o *serverOption) error {
+		if validFor <= 0 {
+			return errors.Errorf("validFor should be positive")
+		}
+
+		o.certValidFor = validFor
+		return nil
+	}
+}
+
+// WithTermsOfService set url of terms of service,
+// clients must agree to it when creating account.
+func WithTermsOfService(tosURL string) ServerOption {
+	return func(o *serverOption) error {
+		o.termsOfService = tosURL
+		return nil
+	}
+}
+
+// WithMaxPendingOrders set how many unfinished orders an account can have,
+// new order will be rejected with `rateLimited` if exceeded.
+//
+// default to 100
+func WithMaxPendingOrders(n int) ServerOption {
+	return func(o *serverOption) error {
+		if n <= 0 {
+			return errors.Errorf("n should be positive")
+		}
+
+		o.maxPendingOrder = n
+		return nil
+	}
+}
+
+// NewServer new ACME server
+//
+// # Args
+//   - ctx: nonce cache and orders will stop cleaning when ctx done
+//   - authority: CA to sign and revoke certificates
+//   - baseURL: external url that server mounted at, like `https://acme.example.com/acme`,
+//     directory will be `<baseURL>/directory`. do not strip the path prefix
+//     before passing requests to server.
+func NewServer(ctx context.Context,
+	authority *ca.CA,
+	baseURL string,
+	opts ...ServerOption) (*Server, error) {
+	opt, err := new(serverOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	if authority == nil {
+		return nil, errors.Errorf("authority should not be empty")
+	}
+
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse base url %q", baseURL)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf("base url %q should be absolute", baseURL)
+	}
+
+	s := &Server{
+		opt:           opt,
+		ca:            authority,
+		baseURL:       u,
+		nonces:        gutils.NewExpCache[struct{}](ctx, opt.nonceTTL),
+		accounts:      make(map[string]*account),
+		accountsByKey: make(map[string]*account),
+		orders:        make(map[string]*order),
+		authzs:        make(map[string]*authorization),
+		challenges:    make(map[string]*challenge),
+		certs:         make(map[string]*issuedCert),
+		certsBySerial: make(map[string]*issuedCert),
+	}
+
+	prefix := u.Path
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET "+prefix+"/directory", s.handle(s.handleDirectory))
+	s.mux.HandleFunc("GET "+prefix+"/new-nonce", s.handle(s.handleNewNonce))
+	s.mux.HandleFunc("POST "+prefix+"/new-account", s.handle(s.handleNewAccount))
+	s.mux.HandleFunc("POST "+prefix+"/new-order", s.handle(s.handleNewOrder))
+	s.mux.HandleFunc("POST "+prefix+"/revoke-cert", s.handle(s.handleRevokeCert))
+	s.mux.HandleFunc("POST "+prefix+"/account/{id}", s.handle(s.handleAccount))
+	s.mux.HandleFunc("POST "+prefix+"/account/{id}/orders", s.handle(s.handleAccountOrders))
+	s.mux.HandleFunc("POST "+prefix+"/order/{id}", s.handle(s.handleOrder))
+	s.mux.HandleFunc("POST "+prefix+"/order/{id}/finalize", s.handle(s.handleFinalize))
+	s.mux.HandleFunc("POST "+prefix+"/authz/{id}", s.handle(s.handleAuthorization))
+	s.mux.HandleFunc("POST "+prefix+"/chall/{id}", s.handle(s.handleChallenge))
+	s.mux.HandleFunc("POST "+prefix+"/cert/{id}", s.handle(s.handleCert))
+
+	go s.runClean(ctx)
+	return s, nil
+}
+
+// runClean remove expired or invalid objects periodically
+func (s *Server) runClean(ctx context.Context) {
+	ticker := time.NewTicker(cleanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.clean()
+	}
+}
+
+// clean remove invalid orders, orders whose certificate expired,
+// and authorizations that are expired or no longer usable,
+// with their challenges.
+func (s *Server) clean() {
+	now := gutils.Clock.GetUTCNow()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, o := range s.orders {
+		// expired pending or ready order will be marked as invalid
+		s.refreshOrderStatus(o)
+		switch o.status {
+		case statusInvalid:
+		case statusValid:
+			cert, ok := s.certs[o.certID]
+			if ok && !now.After(cert.notAfter) {
+				continue
+			}
+			if ok {
+				delete(s.certs, cert.id)
+				delete(s.certsBySerial, cert.serial)
+			}
+		default:
+			continue
+		}
+
+		delete(s.orders, id)
+	}
+
+	for id, authz := range s.authzs {
+		s.refreshAuthorizationStatus(authz)
+		switch authz.status {
+		case statusPending:
+			continue
+		case statusValid:
+			if !now.After(authz.expires) {
+				continue
+			}
+		}
+
+		for _, chID := range authz.challengeIDs {
+			delete(s.challenges, chID)
+		}
+		delete(s.authzs, id)
+	}
+
+	for _, acct := range s.accounts {
+		acct.orderIDs = slices.DeleteFunc(acct.orderIDs, func(id string) bool {
+			_, ok := s.orders[id]
+			return !ok
+		})
+	}
+}
+
+// DirectoryURL url of directory, clients should start from here
+func (s *Server) DirectoryURL() string {
+	return s.url("/directory")
+}
+
+// ServeHTTP implement http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) url(path string) string {
+	return s.baseURL.String() + path
+}
+
+// handle wrap handler, set common headers and write problem document on error
+func (s *Server) handle(handler func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nonce, err := s.newNonce()
+		if err != nil {
+			s.opt.logger.Error("new nonce", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Replay-Nonce", nonce)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Add("Link", `<`+s.DirectoryURL()+`>;rel="index"`)
+
+		err = handler(w, r)
+		if err == nil {
+			return
+		}
+
+		var prob *problem
+		if !errors.As(err, &prob) {
+			s.opt.logger.Error("handle acme request",
+				zap.String("path", r.URL.Path), zap.Error(err))
+			prob = newProblem(http.StatusInternalServerError, "serverInternal", "internal error")
+		}
+
+		s.opt.logger.Debug("acme request failed",
+			zap.String("path", r.URL.Path), zap.String("type", prob.Type), zap.String("detail", prob.Detail))
+		s.writeJSON(w, prob.Status, "application/problem+json", prob)
+	}
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, contentType string, v any) {
+	body, err := gjson.Marshal(v)
+	if err != nil {
+		s.opt.logger.Error("marshal response", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if _, err = w.Write(body); err != nil {
+		s.opt.logger.Debug("write response", zap.Error(err))
+	}
+}
+
+func (s *Server) newNonce() (string, error) {
+	nonce, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	s.nonces.Store(nonce, struct{}{})
+	return nonce, nil
+}
+
+func newID() (string, error) {
+	raw, err := gutils.SecRandomBytesWithLength(16)
+	if err != nil {
+		return "", errors.Wrap(err, "generate random id")
+	}
+
+	return b64Encode(raw), nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+// jwsRequest verified request
+type jwsRequest struct {
+	payload []byte
+	// account is set when request signed by kid
+	account *account
+	// key is set when request signed by jwk
+	key *gjwt.JWK
+}
+
+// isPostAsGet whether request is POST-as-GET, refer to RFC-8555 6.3
+func (r *jwsRequest) isPostAsGet() bool {
+	return len(r.payload) == 0
+}
+
+// verifyRequest verify JWS of request, refer to RFC-8555 6.2
+//
+// if allowJWK is false, request must be signed by account key with kid.
+func (s *Server) verifyRequest(r *http.Request, allowJWK bool) (*jwsRequest, error) {
+	if ct := r.Header.Get("Content-Type"); ct != "application/jose+json" {
+		return nil, errMalformed("content type should be application/jose+json")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize))
+	if err != nil {
+		return nil, errors.Wrap(err, "read body")
+	}
+
+	msg, header, payload, err := parseJWS(body)
+	if err != nil {
+		return nil, errMalformed(err.Error())
+	}
+
+	if header.URL != s.baseURL.Scheme+"://"+s.baseURL.Host+r.URL.Path {
+		return nil, newProblem(http.StatusUnauthorized, "unauthorized", "url mismatch")
+	}
+	if _, ok := s.nonces.LoadAndDelete(header.Nonce); !ok {
+		return nil, newProblem(http.StatusBadRequest, "badNonce", "invalid nonce")
+	}
+
+	req := &jwsRequest{payload: payload}
+	switch {
+	case header.JWK != nil && header.Kid == "":
+		if !allowJWK {
+			return nil, errMalformed("request should be signed by account key with kid")
+		}
+
+		if header.JWK.IsPrivate() {
+			return nil, newProblem(http.StatusBadRequest, "badPublicKey", "jwk should not contain private key")
+		}
+
+		req.key = header.JWK
+	case header.JWK == nil && header.Kid != "":
+		id, ok := strings.CutPrefix(header.Kid, s.url("/account/"))
+		if !ok {
+			return nil, newProblem(http.StatusBadRequest, "accountDoesNotExist", "unknown kid")
+		}
+
+		s.mu.Lock()
+		req.account = s.accounts[id]
+		var status string
+		if req.account != nil {
+			status = req.account.status
+		}
+		s.mu.Unlock()
+		if req.account == nil {
+			return nil, newProblem(http.StatusBadRequest, "accountDoesNotExist", "unknown kid")
+		}
+		if status != statusValid {
+			return nil, errUnauthorized("account is " + status)
+		}
+
+		req.key = req.account.key
+	default:
+		return nil, errMalformed("exactly one of jwk and kid should be set")
+	}
+
+	pubkey, err := req.key.PublicKey()
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, "badPublicKey", err.Error())
+	}
+	if err = verifyJWS(msg, header.Alg, pubkey); err != nil {
+		if strings.HasPrefix(err.Error(), "unsupported alg") {
+			return nil, newProblem(http.StatusBadRequest, "badSignatureAlgorithm", err.Error())
+		}
+
+		return nil, errMalformed("verify signature: " + err.Error())
+	}
+
+	return req, nil
+}
+
+func (s *Server) handleDirectory(w http.ResponseWriter, _ *http.Request) error {
+	dir := &directoryJSON{
+		NewNonce:   s.url("/new-nonce"),
+		NewAccount: s.url("/new-account"),
+		NewOrder:   s.url("/new-order"),
+		RevokeCert: s.url("/revoke-cert"),
+	}
+	if s.opt.termsOfService != "" {
+		dir.Meta = &directoryMetaJSON{TermsOfService: s.opt.termsOfService}
+	}
+
+	s.writeJSON(w, http.StatusOK, "application/json", dir)
+	return nil
+}
+
+func (s *Server) handleNewNonce(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	return nil
+}
+
+func (s *Server) handleNewAccount(w http.ResponseWriter, r *http.Request) error {
+	req, err := s.verifyRequest(r, true)
+	if err != nil {
+		return err
+	}
+	if req.account != nil {
+		return errMalformed("new account should be signed by jwk")
+	}
+
+	var payload struct {
+		Contact              []string `json:"contact"`
+		TermsOfServiceAgreed bool     `json:"termsOfServiceAgreed"`
+		OnlyReturnExisting   bool     `json:"onlyReturnExisting"`
+	}
+	if err = decodeJSON(req.payload, &payload); err != nil {
+		return errMalformed("decode payload: " + err.Error())
+	}
+
+	// account key is parsed by verifyRequest,
+	// so RSA key shorter than 2048 bits has already been rejected
+	thumbprint, err := req.key.Thumbprint()
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "badPublicKey", err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if acct, ok := s.accountsByKey[thumbprint]; ok {
+		w.Header().Set("Location", s.url("/account/"+acct.id))
+		s.writeJSON(w, http.StatusOK, "application/json", s.accountJSON(acct))
+		return nil
+	}
+
+	if payload.OnlyReturnExisting {
+		return newProblem(http.StatusBadRequest, "accountDoesNotExist", "account does not exist")
+	}
+	if s.opt.termsOfService != "" && !payload.TermsOfServiceAgreed {
+		return errMalformed("must agree to terms of service")
+	}
+	for _, contact := range payload.Contact {
+		if !strings.HasPrefix(contact, "mailto:") {
+			return newProblem(http.StatusBadRequest, "unsupportedContact",
+				"only mailto contact is supported")
+		}
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	acct := &account{
+		id:         id,
+		key:        req.key,
+		thumbprint: thumbprint,
+		status:     statusValid,
+		contact:    payload.Contact,
+	}
+	s.accounts[id] = acct
+	s.accountsByKey[thumbprint] = acct
+
+	s.opt.logger.Info("new account", zap.String("id", id), zap.Strings("contact", payload.Contact))
+	w.Header().Set("Location", s.url("/account/"+id))
+	s.writeJSON(w, http.StatusCreated, "application/json", s.accountJSON(acct))
+	return nil
+}
+
+func (s *Server) accountJSON(acct *account) *accountJSON {
+	return &accountJSON{
+		Status:  acct.status,
+		Contact: acct.contact,
+		Orders:  s.url("/account/" + acct.id + "/orders"),
+	}
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) error {
+	req, err := s.verifyRequest(r, false)
+	if err != nil {
+		return err
+	}
+	if req.account.id != r.PathValue("id") {
+		return errUnauthorized("account mismatch")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !req.isPostAsGet() {
+		var payload struct {
+			Contact []string `json:"contact"`
+			Status  string   `json:"status"`
+		}
+		if err = decodeJSON(req.payload, &payload); err != nil {
+			return errMalformed("decode payload: " + err.Error())
+		}
+
+		if payload.Contact != nil {
+			req.account.contact = payload.Contact
+		}
+		switch payload.Status {
+		case "":
+		case statusDeactivated:
+			req.account.status = statusDeactivated
+			s.opt.logger.Info("deactivate account", zap.String("id", req.account.id))
+		default:
+			return errMalformed("unsupported status " + payload.Status)
+		}
+	}
+
+	s.writeJSON(w, http.StatusOK, "application/json", s.accountJSON(req.account))
+	return nil
+}
+
+func (s *Server) handleAccountOrders(w http.ResponseWriter, r *http.Request) error {
+	req, err := s.verifyRequest(r, false)
+	if err != nil {
+		return err
+	}
+	if req.account.id != r.PathValue("id") {
+		return errUnauthorized("account mismatch")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := &orderListJSON{Orders: []string{}}
+	for _, id := range req.account.orderIDs {
+		list.Orders = append(list.Orders, s.url("/order/"+id))
+	}
+
+	s.writeJSON(w, http.StatusOK, "application/json", list)
+	return nil
+}
+
+// normalizeIdentifier check and normalize identifier of new order
+func (s *Server) normalizeIdentifier(ident Identifier) (Identifier, error) {
+	switch ident.Type {
+	case IdentifierTypeDNS:
+		ident.Value = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(ident.Value)), ".")
+		if ident.Value == "" || net.ParseIP(ident.Value) != nil {
+			return ident, newProblem(http.StatusBadRequest, "rejectedIdentifier",
+				"invalid dns identifier "+ident.Value)
+		}
+	case IdentifierTypeIP:
+		ip := net.ParseIP(ident.Value)
+		if ip == nil {
+			return ident, newProblem(http.StatusBadRequest, "rejectedIdentifier",
+				"invalid ip identifier "+ident.Value)
+		}
+
+		ident.Value = ip.String()
+	default:
+		return ident, newProblem(http.StatusBadRequest, "unsupportedIdentifier",
+			"unsupported identifier type "+ident.Type)
+	}
+
+	return ident, nil
+}
+
+func (s *Server) handleNewOrder(w http.ResponseWriter, r *http.Request) error {
+	req, err := s.verifyRequest(r, false)
+	if err != nil {
+		return err
+	}
+
+	var payload struct {
+		Identifiers []Identifier `json:"identifiers"`
+		NotBefore   string       `json:"notBefore"`
+		NotAfter    string       `json:"notAfter"`
+	}
+	if err = decodeJSON(req.payload, &payload); err != nil {
+		return errMalformed("decode payload: " + err.Error())
+	}
+	if len(payload.Identifiers) == 0 {
+		return errMalformed("identifiers should not be empty")
+	}
+	if payload.NotBefore != "" {
+		return errMalformed("notBefore is not supported")
+	}
+
+	now := gutils.Clock.GetUTCNow()
+	o := &order{
+		accountID: req.account.id,
+		status:    statusPending,
+		expires:   now.Add(s.opt.orderTTL),
+	}
+	if payload.NotAfter != "" {
+		if o.notAfter, err = time.Parse(time.RFC3339, payload.NotAfter); err != nil {
+			return errMalformed("invalid notAfter: " + err.Error())
+		}
+		if !o.notAfter.After(now) {
+			return errMalformed("notAfter should be in the future")
+		}
+	}
+
+	for _, ident := range payload.Identifiers {
+		if ident, err = s.normalizeIdentifier(ident); err != nil {
+			return err
+		}
+		if !slices.Contains(o.identifiers, ident) {
+			o.identifiers = append(o.identifiers, ident)
+		}
+	}
+
+	if o.id, err = newID(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pending int
+	for _, id := range req.account.orderIDs {
+		if o, ok := s.orders[id]; ok {
+			s.refreshOrderStatus(o)
+			if o.status == statusPending || o.status == statusReady {
+				pending++
+			}
+		}
+	}
+	if pending >= s.opt.maxPendingOrder {
+		return newProblem(http.StatusTooManyRequests, "rateLimited", "too many pending orders")
+	}
+
+	for _, ident := range o.identifiers {
+		authz, err := s.newAuthorization(req.account, ident, o.expires)
+		if err != nil {
+			return err
+		}
+
+		o.authzIDs = append(o.authzIDs, authz.id)
+	}
+
+	s.orders[o.id] = o
+	req.account.orderIDs = append(req.account.orderIDs, o.id)
+
+	w.Header().Set("Location", s.url("/order/"+o.id))
+	s.writeJSON(w, http.StatusCreated, "application/json", s.orderJSON(o))
+	return nil
+}
+
+// newAuthorization create authorization and its challenges,
+// should be called with lock held
+func (s *Server) newAuthorization(acct *account,
+	ident Identifier, expires time.Time) (*authorization, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	authz := &authorization{
+		id:         id,
+		accountID:  acct.id,
+		identifier: ident,
+		status:     statusPending,
+		expires:    expires,
+	}
+
+	// wildcard can only be validated by dns-01, refer to RFC-8555 7.1.3
+	challengeTypes := s.opt.challengeTypes
+	if base, ok := strings.CutPrefix(ident.Value, "*."); ok && ident.Type == IdentifierTypeDNS {
+		authz.identifier.Value = base
+		authz.wildcard = true
+		challengeTypes = nil
+		if slices.Contains(s.opt.challengeTypes, ChallengeTypeDNS01) {
+			challengeTypes = []string{ChallengeTypeDNS01}
+		}
+	}
+	if len(challengeTypes) == 0 {
+		return nil, newProblem(http.StatusBadRequest, "rejectedIdentifier",
+			"no challenge available for "+ident.Value)
+	}
+
+	for _, typ := range challengeTypes {
+		chID, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		token, err := newID()
+		if err != nil {
+			return nil, err
+		}
+
+		s.challenges[chID] = &challenge{
+			id:      chID,
+			authzID: id,
+			typ:     typ,
+			token:   token,
+			status:  statusPending,
+		}
+		authz.challengeIDs = append(authz.challengeIDs, chID)
+	}
+
+	s.authzs[id] = authz
+	return authz, nil
+}
+
+// refreshOrderStatus update order status by its authorizations,
+// should be called with lock held
+func (s *Server) refreshOrderStatus(o *order) {
+	now := gutils.Clock.GetUTCNow()
+	if o.status != statusPending {
+		if o.status == statusReady && now.After(o.expires) {
+			o.status = statusInvalid
+		}
+
+		return
+	}
+
+	allValid := true
+	for _, id := range o.authzIDs {
+		authz, ok := s.authzs[id]
+		if !ok {
+			// already cleaned
+			o.status = statusInvalid
+			return
+		}
+
+		s.refreshAuthorizationStatus(authz)
+		switch authz.status {
+		case statusValid:
+		case statusPending:
+			allValid = false
+		default:
+			o.status = statusInvalid
+			return
+		}
+	}
+
+	switch {
+	case now.After(o.expires):
+		o.status = statusInvalid
+	case allValid:
+		o.status = statusReady
+	}
+}
+
+// refreshAuthorizationStatus expire authorization,
+// should be called with lock held
+func (s *Server) refreshAuthorizationStatus(authz *authorization) {
+	if authz.status == statusPending &&
+		gutils.Clock.GetUTCNow().After(authz.expires) {
+		authz.status = "expired"
+	}
+}
+
+func (s *Server) orderJSON(o *order) *orderJSON {
+	resp := &orderJSON{
+		Status:         o.status,
+		Expires:        formatTime(o.expires),
+		Identifiers:    o.identifiers,
+		NotAfter:       formatTime(o.notAfter),
+		Authorizations: []string{},
+		Finalize:       s.url("/order/" + o.id + "/finalize"),
+		Error:          o.err,
+	}
+	for _, id := range o.authzIDs {
+		resp.Authorizations = append(resp.Authorizations, s.url("/authz/"+id))
+	}
+	if o.certID != "" {
+		resp.Certificate = s.url("/cert/" + o.certID)
+	}
+
+	return resp
+}
+
+// loadOrder load order owned by account, should be called with lock held
+func (s *Server) loadOrder(acct *account, id string) (*order, error) {
+	o, ok := s.orders[id]
+	if !ok {
+		return nil, errNotFound("order not found")
+	}
+	if o.accountID != acct.id {
+		return nil, errUnauthorized("order is not owned by account")
+	}
+
+	s.refreshOrderStatus(o)
+	return o, nil
+}
+
+func (s *Server) handleOrder(w http.ResponseWriter, r *http.Request) error {
+	req, err := s.verifyRequest(r, false)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, err := s.loadOrder(req.account, r.PathValue("id"))
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Location", s.url("/order/"+o.id))
+	s.writeJSON(w, http.StatusOK, "application/json", s.orderJSON(o))
+	return nil
+}
+
+func (s *Server) handleAuthorization(w http.ResponseWriter, r *http.Request) error {
+	req, err := s.verifyRequest(r, false)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	authz, ok := s.authzs[r.PathValue("id")]
+	if !ok {
+		return errNotFound("authorization not found")
+	}
+	if authz.accountID != req.account.id {
+		return errUnauthorized("authorization is not owned by account")
+	}
+	s.refreshAuthorizationStatus(authz)
+
+	if !req.isPostAsGet() {
+		var payload struct {
+			Status string `json:"status"`
+		}
+		if err = decodeJSON(req.payload, &payload); err != nil {
+			return errMalformed("decode payload: " + err.Error())
+		}
+		if payload.Status != statusDeactivated {
+			return errMalformed("unsupported status " + payload.Status)
+		}
+		if authz.status != statusPending && authz.status != statusValid {
+			return errMalformed("authorization is " + authz.status)
+		}
+
+		authz.status = statusDeactivated
+	}
+
+	s.writeJSON(w, http.StatusOK, "application/json", s.authorizationJSON(authz))
+	return nil
+}
+
+func (s *Server) authorizationJSON(authz *authorization) *authorizationJSON {
+	resp := &authorizationJSON{
+		Identifier: authz.identifier,
+		Status:     authz.status,
+		Expires:    formatTime(authz.expires),
+		Challenges: []challengeJSON{},
+		Wildcard:   authz.wildcard,
+	}
+	for _, id := range authz.challengeIDs {
+		resp.Challenges = append(resp.Challenges, *s.challengeJSON(s.challenges[id]))
+	}
+
+	return resp
+}
+
+func (s *Server) challengeJSON(ch *challenge) *challengeJSON {
+	return &challengeJSON{
+		Type:      ch.typ,
+		URL:       s.url("/chall/" + ch.id),
+		Token:     ch.token,
+		Status:    ch.status,
+		Validated: formatTime(ch.validated),
+		Error:     ch.err,
+	}
+}
+
+func (s *Server) handleChallenge(w http.ResponseWriter, r *http.Request) error {
+	req, err := s.verifyRequest(r, false)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	ch, ok := s.challenges[r.PathValue("id")]
+	if !ok {
+		s.mu.Unlock()
+		return errNotFound("challenge not found")
+	}
+	authz := s.authzs[ch.authzID]
+	if authz.accountID != req.account.id {
+		s.mu.Unlock()
+		return errUnauthorized("challenge is not owned by account")
+	}
+	s.refreshAuthorizationStatus(authz)
+
+	// client responds to challenge by posting `{}`, refer to RFC-8555 7.5.1
+	startValidate := !req.isPostAsGet() &&
+		ch.status == statusPending &&
+		authz.status == statusPending
+	if startValidate {
+		ch.status = statusProcessing
+	}
+	typ, ident, token := ch.typ, authz.identifier, ch.token
+	s.mu.Unlock()
+
+	if startValidate {
+		// validate without lock, validator may take a while
+		ctx, cancel := context.WithTimeout(r.Context(), s.opt.validateTimeout)
+		err = s.opt.validator.Validate(ctx, typ, ident, token,
+			KeyAuthorization(token, req.account.thumbprint))
+		cancel()
+
+		s.mu.Lock()
+		if err != nil {
+			s.opt.logger.Info("challenge failed",
+				zap.String("type", typ), zap.String("identifier", ident.Value), zap.Error(err))
+			ch.status = statusInvalid
+			ch.err = newProblem(http.StatusForbidden, "incorrectResponse", err.Error())
+			authz.status = statusInvalid
+		} else {
+			s.opt.logger.Info("challenge passed",
+				zap.String("type", typ), zap.String("identifier", ident.Value))
+			ch.status = statusValid
+			ch.validated = gutils.Clock.GetUTCNow()
+			authz.status = statusValid
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Add("Link", `<`+s.url("/authz/"+authz.id)+`>;rel="up"`)
+	s.writeJSON(w, http.StatusOK, "application/json", s.challengeJSON(ch))
+	return nil
+}
+
+// checkCSRIdentifiers check that CSR requests exactly the identifiers of order
+func checkCSRIdentifiers(csr *x509.CertificateRequest, identifiers []Identifier) error {
+	var requested []Identifier
+	for _, name := range csr.DNSNames {
+		requested = append(requested, Identifier{Type: IdentifierTypeDNS, Value: strings.ToLower(name)})
+	}
+	for _, ip := range csr.IPAddresses {
+		requested = append(requested, Identifier{Type: IdentifierTypeIP, Value: ip.String()})
+	}
+	if len(csr.EmailAddresses) != 0 || len(csr.URIs) != 0 {
+		return errors.Errorf("csr should not contain email or uri")
+	}
+
+	for _, ident := range requested {
+		if !slices.Contains(identifiers, ident) {
+			return errors.Errorf("identifier %q is not in order", ident.Value)
+		}
+	}
+	for _, ident := range identifiers {
+		if !slices.Contains(requested, ident) {
+			return errors.Errorf("identifier %q is missing in csr", ident.Value)
+		}
+	}
+
+	if cn := csr.Subject.CommonName; cn != "" &&
+		!slices.ContainsFunc(identifiers, func(ident Identifier) bool {
+			return strings.EqualFold(ident.Value, cn)
+		}) {
+		return errors.Errorf("common name %q is not in order", cn)
+	}
+
+	return nil
+}
+
+func (s *Server) handleFinalize(w http.ResponseWriter, r *http.Request) error {
+	req, err := s.verifyRequest(r, false)
+	if err != nil {
+		return err
+	}
+
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	if err = decodeJSON(req.payload, &payload); err != nil {
+		return errMalformed("decode payload: " + err.Error())
+	}
+	csrDer, err := b64Decode(payload.CSR)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "badCSR", "decode csr: "+err.Error())
+	}
+	csr, err := gcrypto.Der2CSR(csrDer)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "badCSR", "parse csr: "+err.Error())
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return newProblem(http.StatusBadRequest, "badCSR", "check csr signature: "+err.Error())
+	}
+
+	s.mu.Lock()
+	o, err := s.loadOrder(req.account, r.PathValue("id"))
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	if o.status != statusReady {
+		s.mu.Unlock()
+		return newProblem(http.StatusForbidden, "orderNotReady", "order is "+o.status)
+	}
+	if err = checkCSRIdentifiers(csr, o.identifiers); err != nil {
+		s.mu.Unlock()
+		return newProblem(http.StatusBadRequest, "badCSR", err.Error())
+	}
+	o.status = statusProcessing
+	notAfter := o.notAfter
+	s.mu.Unlock()
+
+	certDer, signErr := s.sign(r.Context(), csr, csrDer, notAfter)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if signErr != nil {
+		s.opt.logger.Info("sign certificate failed", zap.String("order", o.id), zap.Error(signErr))
+		o.status = statusInvalid
+		o.err = newProblem(http.StatusBadRequest, "badCSR", signErr.Error())
+		return o.err
+	}
+
+	certID, err := newID()
+	if err != nil {
+		return err
+	}
+	leaf, err := gcrypto.Der2Cert(certDer)
+	if err != nil {
+		return errors.Wrap(err, "parse issued certificate")
+	}
+	cert := &issuedCert{
+		id:        certID,
+		accountID: req.account.id,
+		serial:    leaf.SerialNumber.String(),
+		der:       certDer,
+		chainPem:  gcrypto.Cert2Pem(leaf, s.ca.Cert()),
+		notAfter:  leaf.NotAfter,
+	}
+
+	s.certs[certID] = cert
+	s.certsBySerial[cert.serial] = cert
+	o.certID = certID
+	o.status = statusValid
+
+	w.Header().Set("Location", s.url("/order/"+o.id))
+	s.writeJSON(w, http.StatusOK, "application/json", s.orderJSON(o))
+	return nil
+}
+
+// sign sign csr by CA
+func (s *Server) sign(ctx context.Context,
+	csr *x509.CertificateRequest, csrDer []byte, notAfter time.Time) ([]byte, error) {
+	keyUsage := x509.KeyUsageDigitalSignature
+	if _, ok := csr.PublicKey.(*rsa.PublicKey); ok {
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	opts := []ca.SignOption{
+		ca.WithSignKeyUsage(keyUsage),
+		ca.WithSignExtKeyUsage(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth),
+	}
+
+	validFor := s.opt.certValidFor
+	if !notAfter.IsZero() {
+		requested := notAfter.Sub(gutils.Clock.GetUTCNow())
+		if validFor == 0 || requested < validFor {
+			validFor = requested
+		}
+	}
+	if validFor > 0 {
+		opts = append(opts, ca.WithSignValidFor(validFor))
+	}
+
+	return s.ca.Sign(ctx, csrDer, opts...)
+}
+
+func (s *Server) handleCert(w http.ResponseWriter, r *http.Request) error {
+	req, err := s.verifyRequest(r, false)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cert, ok := s.certs[r.PathValue("id")]
+	if !ok {
+		return errNotFound("certificate not found")
+	}
+	if cert.accountID != req.account.id {
+		return errUnauthorized("certificate is not owned by account")
+	}
+
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(cert.chainPem); err != nil {
+		s.opt.logger.Debug("write response", zap.Error(err))
+	}
+
+	return nil
+}
+
+func (s *Server) handleRevokeCert(w http.ResponseWriter, r *http.Request) error {
+	req, err := s.verifyRequest(r, true)
+	if err != nil {
+		return err
+	}
+
+	var payload struct {
+		Certificate string `json:"certificate"`
+		Reason      int    `json:"reason"`
+	}
+	if err = decodeJSON(req.payload, &payload); err != nil {
+		return errMalformed("decode payload: " + err.Error())
+	}
+
+	// reason 7 is unused, refer to RFC-5280 5.3.1
+	reason := ca.RevocationReason(payload.Reason)
+	if reason < ca.RevocationReasonUnspecified ||
+		reason > ca.RevocationReasonAACompromise ||
+		reason == 7 ||
+		reason == ca.RevocationReasonRemoveFromCRL {
+		return newProblem(http.StatusBadRequest, "badRevocationReason", "unsupported reason")
+	}
+
+	certDer, err := b64Decode(payload.Certificate)
+	if err != nil {
+		return errMalformed("decode certificate: " + err.Error())
+	}
+	cert, err := gcrypto.Der2Cert(certDer)
+	if err != nil {
+		return errMalformed("parse certificate: " + err.Error())
+	}
+
+	s.mu.Lock()
+	issued, ok := s.certsBySerial[cert.SerialNumber.String()]
+	s.mu.Unlock()
+	if !ok || !bytes.Equal(issued.der, certDer) {
+		return errNotFound("certificate is not issued by this server")
+	}
+
+	// either the account that issued the certificate,
+	// or the key of the certificate, refer to RFC-8555 7.6
+	if req.account != nil {
+		if issued.accountID != req.account.id {
+			return errUnauthorized("certificate is not owned by account")
+		}
+	} else {
+		pubkey, err := req.key.PublicKey()
+		if err != nil {
+			return newProblem(http.StatusBadRequest, "badPublicKey", err.Error())
+		}
+		if eq, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !eq.Equal(pubkey) {
+			return errUnauthorized("jwk mismatch certificate key")
+		}
+	}
+
+	record, err := s.ca.Store().GetCert(r.Context(), cert.SerialNumber)
+	if err != nil {
+		return errors.Wrap(err, "get certificate")
+	}
+	if record.Revoked {
+		return newProblem(http.StatusBadRequest, "alreadyRevoked", "certificate is already revoked")
+	}
+
+	if err = s.ca.Revoke(r.Context(), cert.SerialNumber, reason); err != nil {
+		return errors.Wrap(err, "revoke certificate")
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
@@ -0,0 +1,525 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/require"
+	xacme "golang.org/x/crypto/acme"
+
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+	"github.com/Laisky/go-utils/v4/crypto/ca"
+)
+
+// testValidator accept all identifiers except `bad.example.com`,
+// record key authorizations it received
+type testValidator struct {
+	mu       sync.Mutex
+	keyAuths map[string]string
+}
+
+func (v *testValidator) Validate(_ context.Context,
+	challengeType string,
+	identifier Identifier,
+	token, keyAuthorization string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.keyAuths[token] = keyAuthorization
+	if identifier.Value == "bad.example.com" {
+		return errors.Errorf("challenge failed")
+	}
+
+	return nil
+}
+
+func testNewServer(t *testing.T, ctx context.Context,
+	opts ...ServerOption) (*Server, *ca.CA, *testValidator) {
+	t.Helper()
+
+	prikeyPem, certDer, err := gcrypto.NewECDSAPrikeyAndCert(gcrypto.ECDSACurveP256,
+		gcrypto.WithX509CertCommonName("test-ca"),
+		gcrypto.WithX509CertIsCA(),
+		gcrypto.WithX509CertValidFor(365*24*time.Hour),
+	)
+	require.NoError(t, err)
+	prikey, err := gcrypto.Pem2Prikey(prikeyPem)
+	require.NoError(t, err)
+	cert, err := gcrypto.Der2Cert(certDer)
+	require.NoError(t, err)
+
+	_, ipnet, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	authority, err := ca.New(ctx, cert, prikey, ca.NewMemoryStore(),
+		ca.WithPolicy(&ca.Policy{
+			AllowedDNSNames: []string{"*.example.com"},
+			AllowedIPNets:   []*net.IPNet{ipnet},
+		}),
+	)
+	require.NoError(t, err)
+
+	var srv *Server
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	validator := &testValidator{keyAuths: make(map[string]string)}
+	opts = append([]ServerOption{WithChallengeValidator(validator, ChallengeTypeHTTP01)}, opts...)
+	srv, err = NewServer(ctx, authority, ts.URL+"/acme", opts...)
+	require.NoError(t, err)
+
+	return srv, authority, validator
+}
+
+func testNewClient(t *testing.T, ctx context.Context, srv *Server) *xacme.Client {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	cli := &xacme.Client{
+		Key:          key,
+		DirectoryURL: srv.DirectoryURL(),
+	}
+
+	_, err = cli.Register(ctx, &xacme.Account{Contact: []string{"mailto:test@example.com"}},
+		xacme.AcceptTOS)
+	require.NoError(t, err)
+	return cli
+}
+
+// testAuthorize authorize order by http-01 challenges
+func testAuthorize(t *testing.T, ctx context.Context,
+	cli *xacme.Client, order *xacme.Order) error {
+	t.Helper()
+
+	for _, authzURL := range order.AuthzURLs {
+		authz, err := cli.GetAuthorization(ctx, authzURL)
+		require.NoError(t, err)
+		require.Equal(t, xacme.StatusPending, authz.Status)
+		require.Len(t, authz.Challenges, 1)
+
+		chal := authz.Challenges[0]
+		require.Equal(t, ChallengeTypeHTTP01, chal.Type)
+		if _, err = cli.Accept(ctx, chal); err != nil {
+			return err
+		}
+		if _, err = cli.WaitAuthorization(ctx, authzURL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func testNewCSR(t *testing.T, cn string, dnsNames []string, ips []net.IP) (crypto.Signer, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: cn},
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+	}, key)
+	require.NoError(t, err)
+	return key, csr
+}
+
+func TestServer_Issue(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv, authority, validator := testNewServer(t, ctx)
+	cli := testNewClient(t, ctx, srv)
+
+	// issue certificate by acme flow
+	issue := func(t *testing.T) (crypto.Signer, [][]byte) {
+		order, err := cli.AuthorizeOrder(ctx, []xacme.AuthzID{
+			{Type: "dns", Value: "www.example.com"},
+			{Type: "ip", Value: "10.0.0.1"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, xacme.StatusPending, order.Status)
+		require.Len(t, order.AuthzURLs, 2)
+
+		require.NoError(t, testAuthorize(t, ctx, cli, order))
+		order, err = cli.WaitOrder(ctx, order.URI)
+		require.NoError(t, err)
+		require.Equal(t, xacme.StatusReady, order.Status)
+
+		key, csr := testNewCSR(t, "www.example.com",
+			[]string{"www.example.com"}, []net.IP{net.ParseIP("10.0.0.1")})
+		ders, certURL, err := cli.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+		require.NoError(t, err)
+		require.NotEmpty(t, certURL)
+		require.Len(t, ders, 2)
+		return key, ders
+	}
+
+	t.Run("issue", func(t *testing.T) {
+		_, ders := issue(t)
+
+		leaf, err := x509.ParseCertificate(ders[0])
+		require.NoError(t, err)
+		require.Equal(t, authority.Cert().Raw, ders[1])
+		require.NoError(t, leaf.CheckSignatureFrom(authority.Cert()))
+		require.Equal(t, []string{"www.example.com"}, leaf.DNSNames)
+		require.Contains(t, leaf.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+
+		// validator received key authorization computed from account key
+		validator.mu.Lock()
+		defer validator.mu.Unlock()
+		require.Len(t, validator.keyAuths, 2)
+		for token, keyAuth := range validator.keyAuths {
+			expect, err := cli.HTTP01ChallengeResponse(token)
+			require.NoError(t, err)
+			require.Equal(t, expect, keyAuth)
+		}
+	})
+
+	t.Run("revoke by account", func(t *testing.T) {
+		_, ders := issue(t)
+		leaf, err := x509.ParseCertificate(ders[0])
+		require.NoError(t, err)
+
+		err = cli.RevokeCert(ctx, nil, ders[0], xacme.CRLReasonKeyCompromise)
+		require.NoError(t, err)
+
+		record, err := authority.Store().GetCert(ctx, leaf.SerialNumber)
+		require.NoError(t, err)
+		require.True(t, record.Revoked)
+		require.Equal(t, ca.RevocationReasonKeyCompromise, record.RevocationReason)
+
+		// client treats alreadyRevoked as success
+		err = cli.RevokeCert(ctx, nil, ders[0], xacme.CRLReasonKeyCompromise)
+		require.NoError(t, err)
+	})
+
+	t.Run("revoke by certificate key", func(t *testing.T) {
+		key, ders := issue(t)
+		leaf, err := x509.ParseCertificate(ders[0])
+		require.NoError(t, err)
+
+		// other key can not revoke
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		err = cli.RevokeCert(ctx, otherKey, ders[0], xacme.CRLReasonUnspecified)
+		require.ErrorContains(t, err, "unauthorized")
+
+		err = cli.RevokeCert(ctx, key, ders[0], xacme.CRLReasonSuperseded)
+		require.NoError(t, err)
+
+		record, err := authority.Store().GetCert(ctx, leaf.SerialNumber)
+		require.NoError(t, err)
+		require.True(t, record.Revoked)
+	})
+
+	t.Run("get account", func(t *testing.T) {
+		acct, err := cli.GetReg(ctx, "")
+		require.NoError(t, err)
+		require.Equal(t, xacme.StatusValid, acct.Status)
+		require.Equal(t, []string{"mailto:test@example.com"}, acct.Contact)
+		require.NotEmpty(t, acct.OrdersURL)
+	})
+}
+
+func TestServer_ChallengeFailed(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv, _, _ := testNewServer(t, ctx)
+	cli := testNewClient(t, ctx, srv)
+
+	order, err := cli.AuthorizeOrder(ctx, xacme.DomainIDs("bad.example.com"))
+	require.NoError(t, err)
+
+	err = testAuthorize(t, ctx, cli, order)
+	require.Error(t, err)
+
+	order, err = cli.GetOrder(ctx, order.URI)
+	require.NoError(t, err)
+	require.Equal(t, xacme.StatusInvalid, order.Status)
+
+	_, csr := testNewCSR(t, "", []string{"bad.example.com"}, nil)
+	_, _, err = cli.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	require.ErrorContains(t, err, "orderNotReady")
+}
+
+func TestServer_clean(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv, _, _ := testNewServer(t, ctx)
+	cli := testNewClient(t, ctx, srv)
+
+	failed, err := cli.AuthorizeOrder(ctx, xacme.DomainIDs("bad.example.com"))
+	require.NoError(t, err)
+	require.Error(t, testAuthorize(t, ctx, cli, failed))
+
+	pending, err := cli.AuthorizeOrder(ctx, xacme.DomainIDs("a.example.com"))
+	require.NoError(t, err)
+
+	issued, err := cli.AuthorizeOrder(ctx, xacme.DomainIDs("b.example.com"))
+	require.NoError(t, err)
+	require.NoError(t, testAuthorize(t, ctx, cli, issued))
+	_, csr := testNewCSR(t, "", []string{"b.example.com"}, nil)
+	ders, _, err := cli.CreateOrderCert(ctx, issued.FinalizeURL, csr, false)
+	require.NoError(t, err)
+
+	// invalid order and its authorization are removed
+	srv.clean()
+	_, err = cli.GetOrder(ctx, failed.URI)
+	require.ErrorContains(t, err, "not found")
+	_, err = cli.GetAuthorization(ctx, failed.AuthzURLs[0])
+	require.ErrorContains(t, err, "not found")
+
+	order, err := cli.GetOrder(ctx, pending.URI)
+	require.NoError(t, err)
+	require.Equal(t, xacme.StatusPending, order.Status)
+	order, err = cli.GetOrder(ctx, issued.URI)
+	require.NoError(t, err)
+	require.Equal(t, xacme.StatusValid, order.Status)
+
+	// expire everything
+	srv.mu.Lock()
+	past := time.Now().Add(-time.Hour)
+	for _, o := range srv.orders {
+		o.expires = past
+	}
+	for _, authz := range srv.authzs {
+		authz.expires = past
+	}
+	for _, cert := range srv.certs {
+		cert.notAfter = past
+	}
+	srv.mu.Unlock()
+
+	srv.clean()
+	_, err = cli.GetOrder(ctx, pending.URI)
+	require.ErrorContains(t, err, "not found")
+	_, err = cli.GetOrder(ctx, issued.URI)
+	require.ErrorContains(t, err, "not found")
+	err = cli.RevokeCert(ctx, nil, ders[0], xacme.CRLReasonUnspecified)
+	require.ErrorContains(t, err, "not issued by this server")
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	require.Empty(t, srv.orders)
+	require.Empty(t, srv.authzs)
+	require.Empty(t, srv.challenges)
+	require.Empty(t, srv.certs)
+	require.Empty(t, srv.certsBySerial)
+	for _, acct := range srv.accounts {
+		require.Empty(t, acct.orderIDs)
+	}
+}
+
+func TestServer_MaxPendingOrders(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv, _, _ := testNewServer(t, ctx, WithMaxPendingOrders(2))
+	cli := testNewClient(t, ctx, srv)
+
+	first, err := cli.AuthorizeOrder(ctx, xacme.DomainIDs("a.example.com"))
+	require.NoError(t, err)
+	_, err = cli.AuthorizeOrder(ctx, xacme.DomainIDs("b.example.com"))
+	require.NoError(t, err)
+	// client retries rateLimited until ctx done, then returns the last error
+	rejectCtx, rejectCancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer rejectCancel()
+	_, err = cli.AuthorizeOrder(rejectCtx, xacme.DomainIDs("c.example.com"))
+	require.ErrorContains(t, err, "rateLimited")
+
+	// finished order does not count
+	require.NoError(t, testAuthorize(t, ctx, cli, first))
+	_, csr := testNewCSR(t, "", []string{"a.example.com"}, nil)
+	_, _, err = cli.CreateOrderCert(ctx, first.FinalizeURL, csr, false)
+	require.NoError(t, err)
+	_, err = cli.AuthorizeOrder(ctx, xacme.DomainIDs("c.example.com"))
+	require.NoError(t, err)
+}
+
+func TestServer_Finalize(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv, _, _ := testNewServer(t, ctx)
+	cli := testNewClient(t, ctx, srv)
+
+	newReadyOrder := func(t *testing.T, domains ...string) *xacme.Order {
+		order, err := cli.AuthorizeOrder(ctx, xacme.DomainIDs(domains...))
+		require.NoError(t, err)
+		require.NoError(t, testAuthorize(t, ctx, cli, order))
+		order, err = cli.WaitOrder(ctx, order.URI)
+		require.NoError(t, err)
+		return order
+	}
+
+	t.Run("identifier not in order", func(t *testing.T) {
+		order := newReadyOrder(t, "a.example.com")
+		_, csr := testNewCSR(t, "", []string{"a.example.com", "b.example.com"}, nil)
+		_, _, err := cli.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+		require.ErrorContains(t, err, "badCSR")
+	})
+
+	t.Run("identifier missing in csr", func(t *testing.T) {
+		order := newReadyOrder(t, "a.example.com", "b.example.com")
+		_, csr := testNewCSR(t, "", []string{"a.example.com"}, nil)
+		_, _, err := cli.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+		require.ErrorContains(t, err, "badCSR")
+	})
+
+	t.Run("rejected by policy", func(t *testing.T) {
+		order := newReadyOrder(t, "www.other.com")
+		_, csr := testNewCSR(t, "", []string{"www.other.com"}, nil)
+		_, _, err := cli.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+		require.ErrorContains(t, err, "not allowed")
+
+		order, err = cli.GetOrder(ctx, order.URI)
+		require.NoError(t, err)
+		require.Equal(t, xacme.StatusInvalid, order.Status)
+	})
+
+	t.Run("not after", func(t *testing.T) {
+		notAfter := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+		order, err := cli.AuthorizeOrder(ctx, xacme.DomainIDs("c.example.com"),
+			xacme.WithOrderNotAfter(notAfter))
+		require.NoError(t, err)
+		require.NoError(t, testAuthorize(t, ctx, cli, order))
+
+		_, csr := testNewCSR(t, "", []string{"c.example.com"}, nil)
+		ders, _, err := cli.CreateOrderCert(ctx, order.FinalizeURL, csr, false)
+		require.NoError(t, err)
+		require.Len(t, ders, 1)
+
+		leaf, err := x509.ParseCertificate(ders[0])
+		require.NoError(t, err)
+		require.False(t, leaf.NotAfter.After(notAfter))
+	})
+}
+
+func TestServer_Unauthorized(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv, _, _ := testNewServer(t, ctx)
+	cli := testNewClient(t, ctx, srv)
+	other := testNewClient(t, ctx, srv)
+
+	order, err := cli.AuthorizeOrder(ctx, xacme.DomainIDs("www.example.com"))
+	require.NoError(t, err)
+
+	_, err = other.GetOrder(ctx, order.URI)
+	require.ErrorContains(t, err, "unauthorized")
+	_, err = other.GetAuthorization(ctx, order.AuthzURLs[0])
+	require.ErrorContains(t, err, "unauthorized")
+
+	t.Run("wildcard without dns-01", func(t *testing.T) {
+		_, err := cli.AuthorizeOrder(ctx, xacme.DomainIDs("*.example.com"))
+		require.ErrorContains(t, err, "rejectedIdentifier")
+	})
+
+	t.Run("unsupported identifier", func(t *testing.T) {
+		_, err := cli.AuthorizeOrder(ctx, []xacme.AuthzID{{Type: "email", Value: "a@example.com"}})
+		require.ErrorContains(t, err, "unsupportedIdentifier")
+	})
+
+	t.Run("only return existing", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		unknown := &xacme.Client{Key: key, DirectoryURL: srv.DirectoryURL()}
+		_, err = unknown.GetReg(ctx, "")
+		require.ErrorIs(t, err, xacme.ErrNoAccount)
+	})
+
+	t.Run("weak rsa account key", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		require.NoError(t, err)
+		weak := &xacme.Client{Key: key, DirectoryURL: srv.DirectoryURL()}
+		_, err = weak.Register(ctx, &xacme.Account{}, xacme.AcceptTOS)
+		require.ErrorContains(t, err, "badPublicKey")
+	})
+
+	t.Run("deactivated", func(t *testing.T) {
+		third := testNewClient(t, ctx, srv)
+		require.NoError(t, third.DeactivateReg(ctx))
+
+		_, err := third.AuthorizeOrder(ctx, xacme.DomainIDs("www.example.com"))
+		require.ErrorContains(t, err, "unauthorized")
+	})
+}
+
+func TestServer_BadRequest(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv, _, _ := testNewServer(t, ctx)
+
+	t.Run("directory", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, srv.DirectoryURL(), nil)
+		resp := httptest.NewRecorder()
+		srv.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.NotEmpty(t, resp.Header().Get("Replay-Nonce"))
+
+		dir := new(directoryJSON)
+		require.NoError(t, decodeJSON(resp.Body.Bytes(), dir))
+		require.Equal(t, srv.url("/new-order"), dir.NewOrder)
+	})
+
+	t.Run("content type", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, srv.url("/new-account"), nil)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		srv.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		require.Equal(t, "application/problem+json", resp.Header().Get("Content-Type"))
+
+		prob := new(problem)
+		require.NoError(t, decodeJSON(resp.Body.Bytes(), prob))
+		require.Equal(t, problemPrefix+"malformed", prob.Type)
+	})
+}
+
+func TestNewServer(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, authority, _ := testNewServer(t, ctx)
+
+	_, err := NewServer(ctx, nil, "https://acme.example.com")
+	require.Error(t, err)
+	_, err = NewServer(ctx, authority, "/acme")
+	require.Error(t, err)
+	_, err = NewServer(ctx, authority, "https://acme.example.com", WithChallengeValidator(nil))
+	require.Error(t, err)
+	_, err = NewServer(ctx, authority, "https://acme.example.com", WithMaxPendingOrders(0))
+	require.Error(t, err)
+
+	srv, err := NewServer(ctx, authority, "https://acme.example.com/acme/")
+	require.NoError(t, err)
+	require.Equal(t, "https://acme.example.com/acme/directory", srv.DirectoryURL())
+}
@@ -0,0 +1,110 @@
+package acme
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	glog "github.com/Laisky/go-utils/v4/log"
+)
+
+// ChallengeValidator validate challenge of authorization
+//
+// return nil if client has fulfilled the challenge.
+type ChallengeValidator interface {
+	// Validate check challenge of identifier
+	//
+	// # Args
+	//   - challengeType: like `http-01`
+	//   - identifier: identifier to be authorized
+	//   - token: token of challenge
+	//   - keyAuthorization: expected key authorization, `token.thumbprint`
+	Validate(ctx context.Context,
+		challengeType string,
+		identifier Identifier,
+		token, keyAuthorization string) error
+}
+
+// ChallengeValidatorFunc func adapter of ChallengeValidator
+type ChallengeValidatorFunc func(ctx context.Context,
+	challengeType string,
+	identifier Identifier,
+	token, keyAuthorization string) error
+
+// Validate call f
+func (f ChallengeValidatorFunc) Validate(ctx context.Context,
+	challengeType string,
+	identifier Identifier,
+	token, keyAuthorization string) error {
+	return f(ctx, challengeType, identifier, token, keyAuthorization)
+}
+
+const (
+	// ChallengeTypeHTTP01 http-01 challenge, refer to RFC-8555 8.3
+	ChallengeTypeHTTP01 = "http-01"
+	// ChallengeTypeDNS01 dns-01 challenge, refer to RFC-8555 8.4
+	ChallengeTypeDNS01 = "dns-01"
+)
+
+// HTTP01Validator validate http-01 challenge
+//
+// fetch `http://<identifier>:<port>/.well-known/acme-challenge/<token>`
+// and compare response body with key authorization.
+type HTTP01Validator struct {
+	// Port default to 80
+	Port int
+	// HTTPClient default to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// Validate validate http-01 challenge
+func (v *HTTP01Validator) Validate(ctx context.Context,
+	challengeType string,
+	identifier Identifier,
+	token, keyAuthorization string) error {
+	if challengeType != ChallengeTypeHTTP01 {
+		return errors.Errorf("unsupported challenge type %q", challengeType)
+	}
+
+	port := v.Port
+	if port == 0 {
+		port = 80
+	}
+	cli := v.HTTPClient
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+
+	url := "http://" + net.JoinHostPort(identifier.Value, strconv.Itoa(port)) +
+		"/.well-known/acme-challenge/" + token
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return errors.Wrap(err, "new request")
+	}
+
+	resp, err := cli.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "fetch %q", url)
+	}
+	defer gutils.LogErr(resp.Body.Close, glog.Shared)
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("fetch %q got status %d", url, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return errors.Wrap(err, "read body")
+	}
+	if strings.TrimSpace(string(body)) != keyAuthorization {
+		return errors.Errorf("key authorization mismatch")
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package acme
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTP01Validator(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/acme-challenge/token" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write([]byte("token.thumbprint\n"))
+	}))
+	t.Cleanup(ts.Close)
+
+	host, portStr, err := net.SplitHostPort(ts.Listener.Addr().String())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	validator := &HTTP01Validator{Port: port}
+	ident := Identifier{Type: IdentifierTypeIP, Value: host}
+
+	t.Run("valid", func(t *testing.T) {
+		t.Parallel()
+		err := validator.Validate(ctx, ChallengeTypeHTTP01, ident, "token", "token.thumbprint")
+		require.NoError(t, err)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		t.Parallel()
+		err := validator.Validate(ctx, ChallengeTypeHTTP01, ident, "token", "token.other")
+		require.ErrorContains(t, err, "mismatch")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		t.Parallel()
+		err := validator.Validate(ctx, ChallengeTypeHTTP01, ident, "other", "other.thumbprint")
+		require.ErrorContains(t, err, "404")
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		t.Parallel()
+		err := validator.Validate(ctx, ChallengeTypeDNS01, ident, "token", "token.thumbprint")
+		require.ErrorContains(t, err, "unsupported challenge type")
+	})
+
+	t.Run("func adapter", func(t *testing.T) {
+		t.Parallel()
+		var called bool
+		var v ChallengeValidator = ChallengeValidatorFunc(func(_ context.Context,
+			_ string, _ Identifier, _, _ string) error {
+			called = true
+			return nil
+		})
+		require.NoError(t, v.Validate(ctx, ChallengeTypeHTTP01, ident, "token", "token.thumbprint"))
+		require.True(t, called)
+	})
+}
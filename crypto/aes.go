@@ -1,8 +1,11 @@
 package crypto
 
 import (
+	"bufio"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
 	"io"
 	"os"
 	"strings"
@@ -192,6 +195,9 @@ func AEADDecryptBasic(key, ciphertext, iv, tag, additionalData []byte) (plaintex
 }
 
 // AesReaderWrapper used to decrypt encrypted reader
+//
+// will load the whole ciphertext into memory,
+// use AEADDecryptReader to decrypt large content.
 type AesReaderWrapper struct {
 	cnt []byte
 	idx int
@@ -228,6 +234,335 @@ func (w *AesReaderWrapper) Read(p []byte) (n int, err error) {
 	return n + 1, nil
 }
 
+const (
+	// AEADStreamVer1 version of the stream layout produced by AEADEncryptWriter
+	//
+	// layout:
+	//
+	//  - [0,1): version
+	//  - [1,5): segment size in big endian
+	//  - [5,21): salt used to derive the stream key from the user key by HKDF
+	//  - [21,...): segments, each segment is `{cipher}{tag}`
+	//
+	// every segment except the last one contains exactly segment size of plaintext,
+	// the last segment may contain [0, segment size] bytes of plaintext.
+	//
+	// nonce of each segment is `{3 bytes zero}{8 bytes big endian counter}{1 byte last flag}`,
+	// so any truncation, reordering or duplication of segments
+	// will fail the authentication.
+	AEADStreamVer1 uint8 = 1
+
+	aeadStreamSaltLen   = 16
+	aeadStreamHeaderLen = 1 + 4 + aeadStreamSaltLen
+
+	// DefaultAEADStreamSegmentSize default plaintext size of each segment
+	DefaultAEADStreamSegmentSize = 64 * 1024
+	// MaxAEADStreamSegmentSize max plaintext size of each segment
+	MaxAEADStreamSegmentSize = 16 * 1024 * 1024
+)
+
+type aeadStreamOption struct {
+	segmentSize    int
+	additionalData []byte
+}
+
+func (o *aeadStreamOption) fillDefault() *aeadStreamOption {
+	o.segmentSize = DefaultAEADStreamSegmentSize
+	return o
+}
+
+func (o *aeadStreamOption) applyOpts(opts ...AEADStreamOption) (*aeadStreamOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// AEADStreamOption optional arguments for AEADEncryptWriter and AEADDecryptReader
+type AEADStreamOption func(*aeadStreamOption) error
+
+// WithAEADStreamSegmentSize (optional) set plaintext size of each segment
+//
+// only works for AEADEncryptWriter, reader will read segment size from header.
+// default to DefaultAEADStreamSegmentSize
+func WithAEADStreamSegmentSize(size int) AEADStreamOption {
+	return func(o *aeadStreamOption) error {
+		if size <= 0 || size > MaxAEADStreamSegmentSize {
+			return errors.Errorf("segment size should in (0, %d]", MaxAEADStreamSegmentSize)
+		}
+
+		o.segmentSize = size
+		return nil
+	}
+}
+
+// WithAEADStreamAdditionalData (optional) set additional data
+//
+// additional data will be authenticated in every segment,
+// reader and writer should use the same additional data.
+func WithAEADStreamAdditionalData(additionalData []byte) AEADStreamOption {
+	return func(o *aeadStreamOption) error {
+		o.additionalData = append([]byte{}, additionalData...)
+		return nil
+	}
+}
+
+// newAEADStreamCipher derive stream key by HKDF and build AES GCM
+func newAEADStreamCipher(key, salt []byte) (cipher.AEAD, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, errors.Errorf("key length should be 16, 24 or 32, got %d", len(key))
+	}
+
+	streamKey, err := DeriveKeyByHKDF(key, salt, len(key))
+	if err != nil {
+		return nil, errors.Wrap(err, "derive stream key")
+	}
+
+	c, err := aes.NewCipher(streamKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "new aes cipher")
+	}
+
+	gcm, err := cipher.NewGCM(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "new gcm")
+	}
+
+	return gcm, nil
+}
+
+// aeadStreamNonce generate nonce for segment
+func aeadStreamNonce(nonce []byte, counter uint64, last bool) {
+	for i := range nonce {
+		nonce[i] = 0
+	}
+
+	binary.BigEndian.PutUint64(nonce[AesGcmIvLen-9:AesGcmIvLen-1], counter)
+	if last {
+		nonce[AesGcmIvLen-1] = 1
+	}
+}
+
+// AEADEncryptWriter encrypt stream by AES GCM in fixed-size segments
+//
+// the memory usage is O(segment size) no matter how large the content is.
+// you should call Close to write the last segment,
+// otherwise the ciphertext can not be decrypted.
+// can be decrypted by AEADDecryptReader.
+type AEADEncryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	ad      []byte
+	nonce   []byte
+	buf     []byte
+	out     []byte
+	counter uint64
+	closed  bool
+}
+
+// NewAEADEncryptWriter new writer that encrypt all content written to w
+//
+// # Args:
+//   - w: underlying writer to write ciphertext
+//   - key: AES key, either 16, 24, or 32 bytes to select AES-128, AES-192, or AES-256
+//
+// header will be written to w immediately.
+func NewAEADEncryptWriter(w io.Writer, key []byte, opts ...AEADStreamOption) (*AEADEncryptWriter, error) {
+	opt, err := new(aeadStreamOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	header := make([]byte, aeadStreamHeaderLen)
+	header[0] = AEADStreamVer1
+	binary.BigEndian.PutUint32(header[1:5], uint32(opt.segmentSize))
+	if _, err = rand.Read(header[5:]); err != nil {
+		return nil, errors.Wrap(err, "generate salt")
+	}
+
+	aead, err := newAEADStreamCipher(key, header[5:])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if _, err = w.Write(header); err != nil {
+		return nil, errors.Wrap(err, "write header")
+	}
+
+	return &AEADEncryptWriter{
+		w:     w,
+		aead:  aead,
+		ad:    append(header, opt.additionalData...),
+		nonce: make([]byte, AesGcmIvLen),
+		buf:   make([]byte, 0, opt.segmentSize),
+		out:   make([]byte, 0, opt.segmentSize+AesGcmTagLen),
+	}, nil
+}
+
+// Write encrypt p and write to underlying writer
+//
+// segment will be flushed only when it is full and there is more content,
+// the last segment will be flushed by Close.
+func (w *AEADEncryptWriter) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, errors.Errorf("writer already closed")
+	}
+
+	for len(p) > 0 {
+		if len(w.buf) == cap(w.buf) {
+			if err = w.flushSegment(false); err != nil {
+				return n, errors.WithStack(err)
+			}
+		}
+
+		l := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+l]
+		p = p[l:]
+		n += l
+	}
+
+	return n, nil
+}
+
+// Close flush the last segment, will not close the underlying writer
+func (w *AEADEncryptWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+
+	if err := w.flushSegment(true); err != nil {
+		return errors.WithStack(err)
+	}
+
+	w.closed = true
+	return nil
+}
+
+func (w *AEADEncryptWriter) flushSegment(last bool) error {
+	aeadStreamNonce(w.nonce, w.counter, last)
+	w.out = w.aead.Seal(w.out[:0], w.nonce, w.buf, w.ad)
+	if _, err := w.w.Write(w.out); err != nil {
+		return errors.Wrapf(err, "write segment %d", w.counter)
+	}
+
+	w.counter++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// AEADDecryptReader decrypt stream encrypted by AEADEncryptWriter
+//
+// every segment will be authenticated before returned,
+// will return error if the stream is truncated or segments are reordered.
+type AEADDecryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	ad      []byte
+	nonce   []byte
+	in      []byte
+	plain   []byte
+	counter uint64
+	eof     bool
+}
+
+// NewAEADDecryptReader new reader that decrypt content from r
+//
+// # Args:
+//   - r: underlying reader to read ciphertext
+//   - key: AES key, same as the key used by AEADEncryptWriter
+//
+// header will be read from r immediately.
+func NewAEADDecryptReader(r io.Reader, key []byte, opts ...AEADStreamOption) (*AEADDecryptReader, error) {
+	opt, err := new(aeadStreamOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	header := make([]byte, aeadStreamHeaderLen)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return nil, errors.Wrap(err, "read header")
+	}
+
+	if header[0] != AEADStreamVer1 {
+		return nil, errors.Errorf("unknown stream version %d", header[0])
+	}
+
+	segmentSize := int(binary.BigEndian.Uint32(header[1:5]))
+	if segmentSize <= 0 || segmentSize > MaxAEADStreamSegmentSize {
+		return nil, errors.Errorf("invalid segment size %d", segmentSize)
+	}
+
+	aead, err := newAEADStreamCipher(key, header[5:])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &AEADDecryptReader{
+		r:     bufio.NewReaderSize(r, segmentSize+AesGcmTagLen+1),
+		aead:  aead,
+		ad:    append(header, opt.additionalData...),
+		nonce: make([]byte, AesGcmIvLen),
+		in:    make([]byte, segmentSize+AesGcmTagLen),
+		plain: make([]byte, 0, segmentSize),
+	}, nil
+}
+
+// Read read decrypted content
+func (r *AEADDecryptReader) Read(p []byte) (n int, err error) {
+	for len(r.plain) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+
+		if err = r.readSegment(); err != nil {
+			return 0, errors.WithStack(err)
+		}
+	}
+
+	n = copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *AEADDecryptReader) readSegment() error {
+	n, err := io.ReadFull(r.r, r.in)
+	switch {
+	case err == nil:
+		// segment is full, it is the last one only if there is no more data
+		if _, err = r.r.Peek(1); err != nil {
+			if !errors.Is(err, io.EOF) {
+				return errors.Wrap(err, "peek next segment")
+			}
+
+			r.eof = true
+		}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		r.eof = true
+	case errors.Is(err, io.EOF):
+		return errors.Errorf("stream truncated, missing last segment")
+	default:
+		return errors.Wrapf(err, "read segment %d", r.counter)
+	}
+
+	if n < AesGcmTagLen {
+		return errors.Errorf("segment %d too short", r.counter)
+	}
+
+	aeadStreamNonce(r.nonce, r.counter, r.eof)
+	r.plain, err = r.aead.Open(r.plain[:0], r.nonce, r.in[:n], r.ad)
+	if err != nil {
+		return errors.Wrapf(err, "decrypt segment %d", r.counter)
+	}
+
+	r.counter++
+	return nil
+}
+
 const (
 	defaultEncryptSuffix = ".enc"
 )
@@ -274,7 +609,8 @@ func WithAESFilesInDirFileSuffix(suffix string) AESEncryptFilesInDirOption {
 
 // AESEncryptFilesInDir encrypt files in dir
 //
-// will generate new encrypted files with <suffix> after ext
+// will generate new encrypted files with <suffix> after ext,
+// files are encrypted by AEADEncryptFile, can be decrypted by AEADDecryptFile.
 //
 //	xxx.toml -> xxx.toml.enc
 func AESEncryptFilesInDir(dir string, secret []byte, opts ...AESEncryptFilesInDirOption) (err error) {
@@ -303,19 +639,9 @@ func AESEncryptFilesInDir(dir string, secret []byte, opts ...AESEncryptFilesInDi
 
 		fname := fname
 		pool.Go(func() (err error) {
-			raw, err := os.ReadFile(fname)
-			if err != nil {
-				return errors.Wrapf(err, "read file `%s`", fname)
-			}
-
-			cipher, err := AesEncrypt(secret, raw)
-			if err != nil {
-				return errors.Wrapf(err, "encrypt")
-			}
-
 			outfname := fname + opt.suffix
-			if err = os.WriteFile(outfname, cipher, 0600); err != nil {
-				return errors.Wrapf(err, "write file `%s`", outfname)
+			if err = AEADEncryptFile(secret, fname, outfname); err != nil {
+				return errors.Wrapf(err, "encrypt file `%s`", fname)
 			}
 
 			logger.Info("encrypt file", zap.String("src", fname), zap.String("out", outfname))
@@ -325,3 +651,68 @@ func AESEncryptFilesInDir(dir string, secret []byte, opts ...AESEncryptFilesInDi
 
 	return pool.Wait()
 }
+
+// AEADEncryptFile encrypt file by AEADEncryptWriter
+//
+// the memory usage is flat no matter how large the file is,
+// the output file will be replaced atomically.
+func AEADEncryptFile(key []byte, in, out string, opts ...AEADStreamOption) error {
+	return aeadFileConvert(in, out, func(src io.Reader, dst io.Writer) error {
+		w, err := NewAEADEncryptWriter(dst, key, opts...)
+		if err != nil {
+			return errors.Wrap(err, "new encrypt writer")
+		}
+
+		if _, err = io.Copy(w, src); err != nil {
+			return errors.Wrap(err, "encrypt")
+		}
+
+		return w.Close()
+	})
+}
+
+// AEADDecryptFile decrypt file encrypted by AEADEncryptFile
+//
+// the output file will be replaced atomically,
+// and will not be created if the ciphertext is corrupted.
+func AEADDecryptFile(key []byte, in, out string, opts ...AEADStreamOption) error {
+	return aeadFileConvert(in, out, func(src io.Reader, dst io.Writer) error {
+		r, err := NewAEADDecryptReader(src, key, opts...)
+		if err != nil {
+			return errors.Wrap(err, "new decrypt reader")
+		}
+
+		if _, err = io.Copy(dst, r); err != nil {
+			return errors.Wrap(err, "decrypt")
+		}
+
+		return nil
+	})
+}
+
+// aeadFileConvert read from in, convert by f, then write to out atomically
+func aeadFileConvert(in, out string, f func(src io.Reader, dst io.Writer) error) error {
+	src, err := os.Open(in)
+	if err != nil {
+		return errors.Wrapf(err, "open file `%s`", in)
+	}
+	defer gutils.LogErr(src.Close, log.Shared)
+
+	pr, pw := io.Pipe()
+	go func() {
+		bw := bufio.NewWriter(pw)
+		err := f(src, bw)
+		if err == nil {
+			err = bw.Flush()
+		}
+
+		_ = pw.CloseWithError(err)
+	}()
+
+	if err = gutils.ReplaceFileAtomic(out, pr, 0600); err != nil {
+		_ = pr.CloseWithError(err)
+		return errors.Wrapf(err, "write file `%s`", out)
+	}
+
+	return nil
+}
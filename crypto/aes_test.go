@@ -35,11 +35,14 @@ func TestAESEncryptFilesInDir(t *testing.T) {
 
 	for _, fname := range []string{"test1.toml.enc", "test2.toml.enc", "test3.toml.enc"} {
 		fname = filepath.Join(dirName, fname)
-		cipher, err := os.ReadFile(fname)
+		fp, err := os.Open(fname)
 		require.NoError(t, err)
 
-		got, err := AesDecrypt(secret, cipher)
+		reader, err := NewAEADDecryptReader(fp, secret)
 		require.NoError(t, err)
+		got, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, fp.Close())
 
 		require.Equal(t, cnt, got)
 	}
@@ -241,3 +244,144 @@ func TestGcmIvLength(t *testing.T) {
 		require.Equal(t, AesGcmTagLen, gcm.Overhead())
 	}
 }
+
+func TestAEADEncryptWriter(t *testing.T) {
+	t.Parallel()
+
+	key, err := Salt(32)
+	require.NoError(t, err)
+
+	encrypt := func(t *testing.T, plain []byte, opts ...AEADStreamOption) []byte {
+		var buf bytes.Buffer
+		w, err := NewAEADEncryptWriter(&buf, key, opts...)
+		require.NoError(t, err)
+
+		// write in small pieces to cover segment boundaries
+		for i := 0; i < len(plain); i += 7 {
+			end := i + 7
+			if end > len(plain) {
+				end = len(plain)
+			}
+
+			_, err = w.Write(plain[i:end])
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+
+	decrypt := func(cipher []byte, key []byte, opts ...AEADStreamOption) ([]byte, error) {
+		r, err := NewAEADDecryptReader(bytes.NewReader(cipher), key, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		return io.ReadAll(r)
+	}
+
+	for _, size := range []int{0, 1, 63, 64, 65, 128, 1000} {
+		plain, err := Salt(size)
+		require.NoError(t, err)
+
+		cipher := encrypt(t, plain, WithAEADStreamSegmentSize(64))
+		got, err := decrypt(cipher, key)
+		require.NoError(t, err, size)
+		require.Equal(t, plain, got, size)
+	}
+
+	plain, err := Salt(1000)
+	require.NoError(t, err)
+	segLen := 64 + AesGcmTagLen
+	cipher := encrypt(t, plain, WithAEADStreamSegmentSize(64))
+
+	t.Run("wrong key", func(t *testing.T) {
+		fakekey, err := Salt(32)
+		require.NoError(t, err)
+		_, err = decrypt(cipher, fakekey)
+		require.ErrorContains(t, err, "message authentication failed")
+	})
+
+	t.Run("additional data", func(t *testing.T) {
+		cipher := encrypt(t, plain, WithAEADStreamAdditionalData([]byte("laisky")))
+		got, err := decrypt(cipher, key, WithAEADStreamAdditionalData([]byte("laisky")))
+		require.NoError(t, err)
+		require.Equal(t, plain, got)
+
+		_, err = decrypt(cipher, key)
+		require.ErrorContains(t, err, "message authentication failed")
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		// drop the last segment
+		truncated := cipher[:aeadStreamHeaderLen+segLen*(1000/64)]
+		_, err := decrypt(truncated, key)
+		require.ErrorContains(t, err, "message authentication failed")
+
+		_, err = decrypt(cipher[:aeadStreamHeaderLen], key)
+		require.ErrorContains(t, err, "stream truncated")
+	})
+
+	t.Run("reordered", func(t *testing.T) {
+		reordered := append([]byte{}, cipher...)
+		seg0 := reordered[aeadStreamHeaderLen : aeadStreamHeaderLen+segLen]
+		seg1 := reordered[aeadStreamHeaderLen+segLen : aeadStreamHeaderLen+2*segLen]
+		tmp := append([]byte{}, seg0...)
+		copy(seg0, seg1)
+		copy(seg1, tmp)
+
+		_, err := decrypt(reordered, key)
+		require.ErrorContains(t, err, "decrypt segment 0")
+	})
+
+	t.Run("invalid args", func(t *testing.T) {
+		_, err := NewAEADEncryptWriter(io.Discard, key, WithAEADStreamSegmentSize(0))
+		require.ErrorContains(t, err, "segment size")
+		_, err = NewAEADEncryptWriter(io.Discard, []byte("123"))
+		require.ErrorContains(t, err, "key length")
+
+		w, err := NewAEADEncryptWriter(io.Discard, key)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		_, err = w.Write([]byte("123"))
+		require.ErrorContains(t, err, "already closed")
+	})
+}
+
+func TestAEADEncryptFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	key, err := Salt(16)
+	require.NoError(t, err)
+	plain, err := Salt(DefaultAEADStreamSegmentSize*3 + 17)
+	require.NoError(t, err)
+
+	src := filepath.Join(dir, "plain")
+	enc := filepath.Join(dir, "plain.enc")
+	dec := filepath.Join(dir, "plain.dec")
+	require.NoError(t, os.WriteFile(src, plain, 0600))
+
+	require.NoError(t, AEADEncryptFile(key, src, enc))
+	require.NoError(t, AEADDecryptFile(key, enc, dec))
+
+	got, err := os.ReadFile(dec)
+	require.NoError(t, err)
+	require.Equal(t, plain, got)
+
+	t.Run("corrupted", func(t *testing.T) {
+		cipher, err := os.ReadFile(enc)
+		require.NoError(t, err)
+		cipher[len(cipher)-1] ^= 0xff
+		corrupted := filepath.Join(dir, "corrupted.enc")
+		require.NoError(t, os.WriteFile(corrupted, cipher, 0600))
+
+		out := filepath.Join(dir, "corrupted.dec")
+		err = AEADDecryptFile(key, corrupted, out)
+		require.ErrorContains(t, err, "message authentication failed")
+
+		ok, err := gutils.FileExists(out)
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+}
@@ -0,0 +1,1112 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// age v1 file format, compatible with age/rage and other standard tooling.
+//
+// https://github.com/C2SP/C2SP/blob/main/age.md
+const (
+	ageVersionLine  = "age-encryption.org/v1"
+	ageX25519Label  = "age-encryption.org/v1/X25519"
+	ageScryptLabel  = "age-encryption.org/v1/scrypt"
+	ageStanzaPrefix = "-> "
+	ageFooterPrefix = "---"
+
+	ageStanzaTypeX25519 = "X25519"
+	ageStanzaTypeScrypt = "scrypt"
+
+	// ageX25519RecipientHRP human-readable part of X25519 recipient in bech32
+	ageX25519RecipientHRP = "age"
+	// ageX25519IdentityHRP human-readable part of X25519 identity in bech32
+	ageX25519IdentityHRP = "AGE-SECRET-KEY-"
+
+	ageFileKeySize     = 16
+	ageWrappedKeySize  = ageFileKeySize + chacha20poly1305.Overhead
+	ageMACSize         = sha256.Size
+	ageScryptSaltSize  = 16
+	ageStreamNonceSize = 16
+	// ageChunkSize plaintext size of each payload chunk
+	ageChunkSize = 64 * 1024
+	// ageColumnsPerLine max columns of each stanza body line
+	ageColumnsPerLine = 64
+
+	// DefaultAgeScryptWorkFactor default log2(N) of scrypt to encrypt,
+	// same as age
+	DefaultAgeScryptWorkFactor = 18
+	// DefaultAgeScryptMaxWorkFactor default max log2(N) of scrypt accepted to decrypt,
+	// same as age
+	DefaultAgeScryptMaxWorkFactor = 22
+	// maxAgeScryptWorkFactor upper bound of scrypt work factor
+	maxAgeScryptWorkFactor = 30
+)
+
+var (
+	ageBase64 = base64.RawStdEncoding.Strict()
+	// errAgeIncorrectIdentity identity does not match any stanza
+	errAgeIncorrectIdentity = errors.New("incorrect identity")
+)
+
+// ageStanza recipient stanza in age header
+type ageStanza struct {
+	typ  string
+	args []string
+	body []byte
+}
+
+// marshal write stanza, body is wrapped at 64 columns,
+// the last line is always shorter than 64 columns, maybe empty.
+func (s *ageStanza) marshal(w *bytes.Buffer) {
+	w.WriteString(ageStanzaPrefix)
+	w.WriteString(strings.Join(append([]string{s.typ}, s.args...), " "))
+	w.WriteByte('\n')
+
+	body := ageBase64.EncodeToString(s.body)
+	for {
+		l := min(len(body), ageColumnsPerLine)
+		w.WriteString(body[:l])
+		w.WriteByte('\n')
+		body = body[l:]
+		if l < ageColumnsPerLine {
+			return
+		}
+	}
+}
+
+// ageHeader age header
+type ageHeader struct {
+	stanzas []*ageStanza
+	mac     []byte
+}
+
+// marshalWithoutMAC return header bytes authenticated by MAC,
+// which end with "---"
+func (h *ageHeader) marshalWithoutMAC() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(ageVersionLine)
+	buf.WriteByte('\n')
+	for _, s := range h.stanzas {
+		s.marshal(&buf)
+	}
+
+	buf.WriteString(ageFooterPrefix)
+	return buf.Bytes()
+}
+
+// isAgeArgChar check whether c is VCHAR
+func isAgeArgChar(c byte) bool {
+	return c >= 0x21 && c <= 0x7e
+}
+
+// readAgeLine read one line without '\n',
+// line longer than reader's buffer will be rejected.
+func readAgeLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", errors.Wrap(io.ErrUnexpectedEOF, "read header line")
+		}
+
+		return "", errors.Wrap(err, "read header line")
+	}
+
+	return string(line[:len(line)-1]), nil
+}
+
+// parseAgeHeader parse header, return header and bytes authenticated by MAC
+func parseAgeHeader(r *bufio.Reader) (hdr *ageHeader, macMsg []byte, err error) {
+	var buf bytes.Buffer
+	line, err := readAgeLine(r)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	if line != ageVersionLine {
+		return nil, nil, errors.Errorf("unsupported age version line %q", line)
+	}
+	buf.WriteString(line + "\n")
+
+	hdr = new(ageHeader)
+	for {
+		if line, err = readAgeLine(r); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+
+		if macB64, ok := strings.CutPrefix(line, ageFooterPrefix+" "); ok {
+			buf.WriteString(ageFooterPrefix)
+			if hdr.mac, err = ageBase64.DecodeString(macB64); err != nil {
+				return nil, nil, errors.Wrap(err, "decode header mac")
+			}
+			if len(hdr.mac) != ageMACSize {
+				return nil, nil, errors.Errorf("invalid header mac size %d", len(hdr.mac))
+			}
+			if len(hdr.stanzas) == 0 {
+				return nil, nil, errors.Errorf("no recipient stanza in header")
+			}
+
+			return hdr, buf.Bytes(), nil
+		}
+
+		argsLine, ok := strings.CutPrefix(line, ageStanzaPrefix)
+		if !ok {
+			return nil, nil, errors.Errorf("invalid header line %q", line)
+		}
+		buf.WriteString(line + "\n")
+
+		args := strings.Split(argsLine, " ")
+		for _, arg := range args {
+			if arg == "" {
+				return nil, nil, errors.Errorf("empty argument in stanza %q", line)
+			}
+			for i := 0; i < len(arg); i++ {
+				if !isAgeArgChar(arg[i]) {
+					return nil, nil, errors.Errorf("invalid character in stanza %q", line)
+				}
+			}
+		}
+
+		stanza := &ageStanza{typ: args[0], args: args[1:]}
+		for {
+			if line, err = readAgeLine(r); err != nil {
+				return nil, nil, errors.WithStack(err)
+			}
+			if len(line) > ageColumnsPerLine {
+				return nil, nil, errors.Errorf("stanza body line too long")
+			}
+			buf.WriteString(line + "\n")
+
+			b, err := ageBase64.DecodeString(line)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "decode stanza body")
+			}
+
+			stanza.body = append(stanza.body, b...)
+			if len(line) < ageColumnsPerLine {
+				break
+			}
+		}
+
+		hdr.stanzas = append(hdr.stanzas, stanza)
+	}
+}
+
+// ageHeaderMAC calculate header's HMAC-SHA256 by file key
+func ageHeaderMAC(fileKey, macMsg []byte) ([]byte, error) {
+	key := make([]byte, sha256.Size)
+	if err := HKDFWithSHA256(fileKey, nil, []byte("header"), [][]byte{key}); err != nil {
+		return nil, errors.Wrap(err, "derive header key")
+	}
+
+	h := hmac.New(sha256.New, key)
+	h.Write(macMsg)
+	return h.Sum(nil), nil
+}
+
+// newAgePayloadCipher derive payload key from file key and nonce
+func newAgePayloadCipher(fileKey, nonce []byte) (cipher.AEAD, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if err := HKDFWithSHA256(fileKey, nonce, []byte("payload"), [][]byte{key}); err != nil {
+		return nil, errors.Wrap(err, "derive payload key")
+	}
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "new chacha20poly1305")
+	}
+
+	return aead, nil
+}
+
+// ageWrapKey encrypt file key by key with zero nonce
+func ageWrapKey(key, fileKey []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "new chacha20poly1305")
+	}
+
+	return aead.Seal(nil, make([]byte, chacha20poly1305.NonceSize), fileKey, nil), nil
+}
+
+// ageUnwrapKey decrypt file key by key with zero nonce,
+// return errAgeIncorrectIdentity if failed.
+func ageUnwrapKey(key, wrapped []byte) ([]byte, error) {
+	if len(wrapped) != ageWrappedKeySize {
+		return nil, errors.Errorf("invalid wrapped file key size %d", len(wrapped))
+	}
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "new chacha20poly1305")
+	}
+
+	fileKey, err := aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), wrapped, nil)
+	if err != nil {
+		return nil, errAgeIncorrectIdentity
+	}
+
+	return fileKey, nil
+}
+
+// AgeRecipient recipient to encrypt age file,
+// can be *AgeX25519Recipient or *AgeScryptRecipient
+type AgeRecipient interface {
+	ageWrap(fileKey []byte) ([]*ageStanza, error)
+}
+
+// AgeIdentity identity to decrypt age file,
+// can be *AgeX25519Identity or *AgeScryptIdentity
+type AgeIdentity interface {
+	// ageUnwrap return errAgeIncorrectIdentity if no stanza matched
+	ageUnwrap(stanzas []*ageStanza) ([]byte, error)
+}
+
+// AgeX25519Recipient X25519 public key of age, like `age1...`
+type AgeX25519Recipient struct {
+	pubkey *ecdh.PublicKey
+}
+
+// ParseAgeX25519Recipient parse recipient in bech32, like `age1...`
+func ParseAgeX25519Recipient(s string) (*AgeX25519Recipient, error) {
+	hrp, data, err := bech32Decode(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode bech32")
+	}
+	if hrp != ageX25519RecipientHRP {
+		return nil, errors.Errorf("unknown recipient type %q", hrp)
+	}
+
+	pubkey, err := ecdh.X25519().NewPublicKey(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse x25519 public key")
+	}
+
+	return &AgeX25519Recipient{pubkey: pubkey}, nil
+}
+
+// String return recipient in bech32, like `age1...`
+func (r *AgeX25519Recipient) String() string {
+	s, err := bech32Encode(ageX25519RecipientHRP, r.pubkey.Bytes())
+	if err != nil {
+		panic(err) // hrp is constant, should never happen
+	}
+
+	return s
+}
+
+func (r *AgeX25519Recipient) ageWrap(fileKey []byte) ([]*ageStanza, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate ephemeral key")
+	}
+
+	shared, err := ephemeral.ECDH(r.pubkey)
+	if err != nil {
+		return nil, errors.Wrap(err, "x25519")
+	}
+
+	share := ephemeral.PublicKey().Bytes()
+	key := make([]byte, chacha20poly1305.KeySize)
+	salt := append(append([]byte{}, share...), r.pubkey.Bytes()...)
+	if err = HKDFWithSHA256(shared, salt, []byte(ageX25519Label), [][]byte{key}); err != nil {
+		return nil, errors.Wrap(err, "derive wrap key")
+	}
+
+	body, err := ageWrapKey(key, fileKey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return []*ageStanza{{
+		typ:  ageStanzaTypeX25519,
+		args: []string{ageBase64.EncodeToString(share)},
+		body: body,
+	}}, nil
+}
+
+// AgeX25519Identity X25519 private key of age, like `AGE-SECRET-KEY-1...`
+type AgeX25519Identity struct {
+	prikey *ecdh.PrivateKey
+}
+
+// NewAgeX25519Identity generate new X25519 identity
+func NewAgeX25519Identity() (*AgeX25519Identity, error) {
+	prikey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate x25519 key")
+	}
+
+	return &AgeX25519Identity{prikey: prikey}, nil
+}
+
+// ParseAgeX25519Identity parse identity in bech32, like `AGE-SECRET-KEY-1...`
+func ParseAgeX25519Identity(s string) (*AgeX25519Identity, error) {
+	hrp, data, err := bech32Decode(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode bech32")
+	}
+	if hrp != ageX25519IdentityHRP {
+		return nil, errors.Errorf("unknown identity type %q", hrp)
+	}
+
+	prikey, err := ecdh.X25519().NewPrivateKey(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse x25519 private key")
+	}
+
+	return &AgeX25519Identity{prikey: prikey}, nil
+}
+
+// String return identity in bech32, like `AGE-SECRET-KEY-1...`
+func (i *AgeX25519Identity) String() string {
+	s, err := bech32Encode(ageX25519IdentityHRP, i.prikey.Bytes())
+	if err != nil {
+		panic(err) // hrp is constant, should never happen
+	}
+
+	return s
+}
+
+// Recipient return recipient of identity
+func (i *AgeX25519Identity) Recipient() *AgeX25519Recipient {
+	return &AgeX25519Recipient{pubkey: i.prikey.PublicKey()}
+}
+
+func (i *AgeX25519Identity) ageUnwrap(stanzas []*ageStanza) ([]byte, error) {
+	for _, s := range stanzas {
+		if s.typ != ageStanzaTypeX25519 {
+			continue
+		}
+		if len(s.args) != 1 {
+			return nil, errors.Errorf("invalid X25519 stanza")
+		}
+
+		share, err := ageBase64.DecodeString(s.args[0])
+		if err != nil {
+			return nil, errors.Wrap(err, "decode ephemeral share")
+		}
+
+		sharePubkey, err := ecdh.X25519().NewPublicKey(share)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse ephemeral share")
+		}
+
+		shared, err := i.prikey.ECDH(sharePubkey)
+		if err != nil {
+			return nil, errors.Wrap(err, "x25519")
+		}
+
+		key := make([]byte, chacha20poly1305.KeySize)
+		salt := append(append([]byte{}, share...), i.prikey.PublicKey().Bytes()...)
+		if err = HKDFWithSHA256(shared, salt, []byte(ageX25519Label), [][]byte{key}); err != nil {
+			return nil, errors.Wrap(err, "derive wrap key")
+		}
+
+		fileKey, err := ageUnwrapKey(key, s.body)
+		if errors.Is(err, errAgeIncorrectIdentity) {
+			continue
+		}
+
+		return fileKey, err
+	}
+
+	return nil, errAgeIncorrectIdentity
+}
+
+type ageScryptOption struct {
+	workFactor    int
+	maxWorkFactor int
+}
+
+func (o *ageScryptOption) fillDefault() *ageScryptOption {
+	o.workFactor = DefaultAgeScryptWorkFactor
+	o.maxWorkFactor = DefaultAgeScryptMaxWorkFactor
+	return o
+}
+
+func (o *ageScryptOption) applyOpts(opts ...AgeScryptOption) (*ageScryptOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// AgeScryptOption optional arguments for AgeScryptRecipient and AgeScryptIdentity
+type AgeScryptOption func(*ageScryptOption) error
+
+// WithAgeScryptWorkFactor (optional) set log2(N) of scrypt to encrypt,
+// only works for NewAgeScryptRecipient. default to DefaultAgeScryptWorkFactor
+func WithAgeScryptWorkFactor(logN int) AgeScryptOption {
+	return func(o *ageScryptOption) error {
+		if logN <= 0 || logN > maxAgeScryptWorkFactor {
+			return errors.Errorf("work factor should in (0, %d]", maxAgeScryptWorkFactor)
+		}
+
+		o.workFactor = logN
+		return nil
+	}
+}
+
+// WithAgeScryptMaxWorkFactor (optional) set max log2(N) of scrypt accepted to decrypt,
+// only works for NewAgeScryptIdentity. default to DefaultAgeScryptMaxWorkFactor
+func WithAgeScryptMaxWorkFactor(logN int) AgeScryptOption {
+	return func(o *ageScryptOption) error {
+		if logN <= 0 || logN > maxAgeScryptWorkFactor {
+			return errors.Errorf("max work factor should in (0, %d]", maxAgeScryptWorkFactor)
+		}
+
+		o.maxWorkFactor = logN
+		return nil
+	}
+}
+
+// ageScryptKey derive wrap key from passphrase
+func ageScryptKey(passphrase, salt []byte, logN int) ([]byte, error) {
+	key, err := scrypt.Key(passphrase, append([]byte(ageScryptLabel), salt...),
+		1<<logN, 8, 1, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "scrypt")
+	}
+
+	return key, nil
+}
+
+// AgeScryptRecipient passphrase recipient of age
+//
+// scrypt recipient can not be mixed with other recipients.
+type AgeScryptRecipient struct {
+	passphrase []byte
+	workFactor int
+}
+
+// NewAgeScryptRecipient new passphrase recipient
+func NewAgeScryptRecipient(passphrase string, opts ...AgeScryptOption) (*AgeScryptRecipient, error) {
+	if passphrase == "" {
+		return nil, errors.Errorf("passphrase should not be empty")
+	}
+
+	opt, err := new(ageScryptOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	return &AgeScryptRecipient{
+		passphrase: []byte(passphrase),
+		workFactor: opt.workFactor,
+	}, nil
+}
+
+func (r *AgeScryptRecipient) ageWrap(fileKey []byte) ([]*ageStanza, error) {
+	salt := make([]byte, ageScryptSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "generate salt")
+	}
+
+	key, err := ageScryptKey(r.passphrase, salt, r.workFactor)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	body, err := ageWrapKey(key, fileKey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return []*ageStanza{{
+		typ:  ageStanzaTypeScrypt,
+		args: []string{ageBase64.EncodeToString(salt), strconv.Itoa(r.workFactor)},
+		body: body,
+	}}, nil
+}
+
+// AgeScryptIdentity passphrase identity of age
+type AgeScryptIdentity struct {
+	passphrase    []byte
+	maxWorkFactor int
+}
+
+// NewAgeScryptIdentity new passphrase identity
+func NewAgeScryptIdentity(passphrase string, opts ...AgeScryptOption) (*AgeScryptIdentity, error) {
+	if passphrase == "" {
+		return nil, errors.Errorf("passphrase should not be empty")
+	}
+
+	opt, err := new(ageScryptOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	return &AgeScryptIdentity{
+		passphrase:    []byte(passphrase),
+		maxWorkFactor: opt.maxWorkFactor,
+	}, nil
+}
+
+func (i *AgeScryptIdentity) ageUnwrap(stanzas []*ageStanza) ([]byte, error) {
+	for _, s := range stanzas {
+		if s.typ != ageStanzaTypeScrypt {
+			continue
+		}
+		if len(stanzas) != 1 {
+			return nil, errors.Errorf("scrypt stanza should be the only stanza")
+		}
+		if len(s.args) != 2 {
+			return nil, errors.Errorf("invalid scrypt stanza")
+		}
+
+		salt, err := ageBase64.DecodeString(s.args[0])
+		if err != nil {
+			return nil, errors.Wrap(err, "decode salt")
+		}
+		if len(salt) != ageScryptSaltSize {
+			return nil, errors.Errorf("invalid salt size %d", len(salt))
+		}
+
+		// decimal without leading zero
+		logN, err := strconv.Atoi(s.args[1])
+		if err != nil || logN <= 0 || strconv.Itoa(logN) != s.args[1] {
+			return nil, errors.Errorf("invalid work factor %q", s.args[1])
+		}
+		if logN > i.maxWorkFactor {
+			return nil, errors.Errorf("work factor %d exceeds max %d", logN, i.maxWorkFactor)
+		}
+
+		key, err := ageScryptKey(i.passphrase, salt, logN)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return ageUnwrapKey(key, s.body)
+	}
+
+	return nil, errAgeIncorrectIdentity
+}
+
+// ParseAgeRecipients parse recipients file,
+// one X25519 recipient per line, empty lines and lines start with `#` are ignored.
+func ParseAgeRecipients(r io.Reader) ([]AgeRecipient, error) {
+	var recipients []AgeRecipient
+	err := parseAgeKeysFile(r, func(line string) error {
+		recipient, err := ParseAgeX25519Recipient(line)
+		if err != nil {
+			return err
+		}
+
+		recipients = append(recipients, recipient)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "parse recipients")
+	}
+
+	return recipients, nil
+}
+
+// ParseAgeIdentities parse identities file generated by age-keygen,
+// one X25519 identity per line, empty lines and lines start with `#` are ignored.
+func ParseAgeIdentities(r io.Reader) ([]AgeIdentity, error) {
+	var identities []AgeIdentity
+	err := parseAgeKeysFile(r, func(line string) error {
+		identity, err := ParseAgeX25519Identity(line)
+		if err != nil {
+			return err
+		}
+
+		identities = append(identities, identity)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "parse identities")
+	}
+
+	return identities, nil
+}
+
+// parseAgeKeysFile call parse for every non-empty and non-comment line
+func parseAgeKeysFile(r io.Reader, parse func(line string) error) error {
+	scanner := bufio.NewScanner(r)
+	var n, lineNo int
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// do not print line, it may contain secret
+		if err := parse(line); err != nil {
+			return errors.Wrapf(err, "line %d", lineNo)
+		}
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "read")
+	}
+	if n == 0 {
+		return errors.Errorf("no key found")
+	}
+
+	return nil
+}
+
+// AgeEncryptWriter encrypt stream to age v1 format
+//
+// the memory usage is O(chunk size) no matter how large the content is.
+// you should call Close to write the last chunk,
+// otherwise the ciphertext can not be decrypted.
+// can be decrypted by AgeDecryptReader or age/rage.
+type AgeEncryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	nonce   []byte
+	buf     []byte
+	out     []byte
+	counter uint64
+	closed  bool
+}
+
+// NewAgeEncryptWriter new writer that encrypt all content written to w
+//
+// header will be written to w immediately.
+func NewAgeEncryptWriter(w io.Writer, recipients ...AgeRecipient) (*AgeEncryptWriter, error) {
+	if len(recipients) == 0 {
+		return nil, errors.Errorf("recipients should not be empty")
+	}
+
+	fileKey := make([]byte, ageFileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, errors.Wrap(err, "generate file key")
+	}
+
+	hdr := new(ageHeader)
+	for _, r := range recipients {
+		stanzas, err := r.ageWrap(fileKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "wrap file key")
+		}
+
+		hdr.stanzas = append(hdr.stanzas, stanzas...)
+	}
+	for _, s := range hdr.stanzas {
+		if s.typ == ageStanzaTypeScrypt && len(hdr.stanzas) != 1 {
+			return nil, errors.Errorf("scrypt recipient can not be mixed with other recipients")
+		}
+	}
+
+	macMsg := hdr.marshalWithoutMAC()
+	mac, err := ageHeaderMAC(fileKey, macMsg)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	nonce := make([]byte, ageStreamNonceSize)
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "generate nonce")
+	}
+
+	aead, err := newAgePayloadCipher(fileKey, nonce)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	header := append(macMsg, ' ')
+	header = append(header, ageBase64.EncodeToString(mac)...)
+	header = append(header, '\n')
+	header = append(header, nonce...)
+	if _, err = w.Write(header); err != nil {
+		return nil, errors.Wrap(err, "write header")
+	}
+
+	return &AgeEncryptWriter{
+		w:     w,
+		aead:  aead,
+		nonce: make([]byte, chacha20poly1305.NonceSize),
+		buf:   make([]byte, 0, ageChunkSize),
+		out:   make([]byte, 0, ageChunkSize+chacha20poly1305.Overhead),
+	}, nil
+}
+
+// Write encrypt p and write to underlying writer
+//
+// chunk will be flushed only when it is full and there is more content,
+// the last chunk will be flushed by Close.
+func (w *AgeEncryptWriter) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, errors.Errorf("writer already closed")
+	}
+
+	for len(p) > 0 {
+		if len(w.buf) == cap(w.buf) {
+			if err = w.flushChunk(false); err != nil {
+				return n, errors.WithStack(err)
+			}
+		}
+
+		l := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+l]
+		p = p[l:]
+		n += l
+	}
+
+	return n, nil
+}
+
+// Close flush the last chunk, will not close the underlying writer
+func (w *AgeEncryptWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+
+	if err := w.flushChunk(true); err != nil {
+		return errors.WithStack(err)
+	}
+
+	w.closed = true
+	return nil
+}
+
+func (w *AgeEncryptWriter) flushChunk(last bool) error {
+	// age STREAM nonce has the same layout,
+	// 11 bytes big-endian counter and 1 byte last flag
+	aeadStreamNonce(w.nonce, w.counter, last)
+	w.out = w.aead.Seal(w.out[:0], w.nonce, w.buf, nil)
+	if _, err := w.w.Write(w.out); err != nil {
+		return errors.Wrapf(err, "write chunk %d", w.counter)
+	}
+
+	w.counter++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// AgeDecryptReader decrypt stream in age v1 format
+//
+// every chunk will be authenticated before returned,
+// will return error if the stream is truncated or chunks are reordered.
+type AgeDecryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	nonce   []byte
+	in      []byte
+	plain   []byte
+	counter uint64
+	eof     bool
+}
+
+// NewAgeDecryptReader new reader that decrypt content from r
+//
+// header will be read from r immediately,
+// identities are tried in order until one matches.
+func NewAgeDecryptReader(r io.Reader, identities ...AgeIdentity) (*AgeDecryptReader, error) {
+	if len(identities) == 0 {
+		return nil, errors.Errorf("identities should not be empty")
+	}
+
+	br := bufio.NewReaderSize(r, ageChunkSize+chacha20poly1305.Overhead+1)
+	hdr, macMsg, err := parseAgeHeader(br)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse header")
+	}
+
+	var fileKey []byte
+	for _, identity := range identities {
+		fileKey, err = identity.ageUnwrap(hdr.stanzas)
+		if errors.Is(err, errAgeIncorrectIdentity) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "unwrap file key")
+		}
+
+		break
+	}
+	if fileKey == nil {
+		return nil, errors.Errorf("no identity matched any recipient")
+	}
+
+	mac, err := ageHeaderMAC(fileKey, macMsg)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !hmac.Equal(mac, hdr.mac) {
+		return nil, errors.Errorf("header mac mismatch")
+	}
+
+	nonce := make([]byte, ageStreamNonceSize)
+	if _, err = io.ReadFull(br, nonce); err != nil {
+		return nil, errors.Wrap(err, "read nonce")
+	}
+
+	aead, err := newAgePayloadCipher(fileKey, nonce)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &AgeDecryptReader{
+		r:     br,
+		aead:  aead,
+		nonce: make([]byte, chacha20poly1305.NonceSize),
+		in:    make([]byte, ageChunkSize+chacha20poly1305.Overhead),
+		plain: make([]byte, 0, ageChunkSize),
+	}, nil
+}
+
+// Read read decrypted content
+func (r *AgeDecryptReader) Read(p []byte) (n int, err error) {
+	for len(r.plain) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+
+		if err = r.readChunk(); err != nil {
+			return 0, errors.WithStack(err)
+		}
+	}
+
+	n = copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *AgeDecryptReader) readChunk() error {
+	n, err := io.ReadFull(r.r, r.in)
+	switch {
+	case err == nil:
+		// chunk is full, it is the last one only if there is no more data
+		if _, err = r.r.Peek(1); err != nil {
+			if !errors.Is(err, io.EOF) {
+				return errors.Wrap(err, "peek next chunk")
+			}
+
+			r.eof = true
+		}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		r.eof = true
+	case errors.Is(err, io.EOF):
+		return errors.Errorf("stream truncated, missing last chunk")
+	default:
+		return errors.Wrapf(err, "read chunk %d", r.counter)
+	}
+
+	if n < chacha20poly1305.Overhead {
+		return errors.Errorf("chunk %d too short", r.counter)
+	}
+	if r.eof && r.counter > 0 && n == chacha20poly1305.Overhead {
+		return errors.Errorf("last chunk should not be empty")
+	}
+
+	aeadStreamNonce(r.nonce, r.counter, r.eof)
+	r.plain, err = r.aead.Open(r.plain[:0], r.nonce, r.in[:n], nil)
+	if err != nil {
+		return errors.Wrapf(err, "decrypt chunk %d", r.counter)
+	}
+
+	r.counter++
+	return nil
+}
+
+// AgeEncryptFile encrypt file to age v1 format by AgeEncryptWriter
+//
+// the memory usage is flat no matter how large the file is,
+// the output file will be replaced atomically.
+func AgeEncryptFile(in, out string, recipients ...AgeRecipient) error {
+	return aeadFileConvert(in, out, func(src io.Reader, dst io.Writer) error {
+		w, err := NewAgeEncryptWriter(dst, recipients...)
+		if err != nil {
+			return errors.Wrap(err, "new encrypt writer")
+		}
+
+		if _, err = io.Copy(w, src); err != nil {
+			return errors.Wrap(err, "encrypt")
+		}
+
+		return w.Close()
+	})
+}
+
+// AgeDecryptFile decrypt file in age v1 format
+//
+// the output file will be replaced atomically,
+// and will not be created if the ciphertext is corrupted.
+func AgeDecryptFile(in, out string, identities ...AgeIdentity) error {
+	return aeadFileConvert(in, out, func(src io.Reader, dst io.Writer) error {
+		r, err := NewAgeDecryptReader(src, identities...)
+		if err != nil {
+			return errors.Wrap(err, "new decrypt reader")
+		}
+
+		if _, err = io.Copy(dst, r); err != nil {
+			return errors.Wrap(err, "decrypt")
+		}
+
+		return nil
+	})
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+
+	return chk
+}
+
+// bech32HRPExpand expand lower-case hrp for checksum
+func bech32HRPExpand(hrp string) []byte {
+	ret := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		ret = append(ret, hrp[i]>>5)
+	}
+	ret = append(ret, 0)
+	for i := 0; i < len(hrp); i++ {
+		ret = append(ret, hrp[i]&31)
+	}
+
+	return ret
+}
+
+// bech32ConvertBits regroup bits of data from `from` bits to `to` bits
+func bech32ConvertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var (
+		acc  uint32
+		bits uint
+		ret  []byte
+		maxv = uint32(1)<<to - 1
+	)
+	for _, v := range data {
+		if uint32(v)>>from != 0 {
+			return nil, errors.Errorf("invalid data range %d", v)
+		}
+
+		acc = acc<<from | uint32(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			ret = append(ret, byte(acc>>bits&maxv))
+		}
+	}
+
+	switch {
+	case pad:
+		if bits > 0 {
+			ret = append(ret, byte(acc<<(to-bits)&maxv))
+		}
+	case bits >= from:
+		return nil, errors.Errorf("illegal zero padding")
+	case acc<<(to-bits)&maxv != 0:
+		return nil, errors.Errorf("non-zero padding")
+	}
+
+	return ret, nil
+}
+
+// bech32Encode encode data by bech32 (BIP 173) without length limit,
+// result is upper-case if hrp is upper-case.
+func bech32Encode(hrp string, data []byte) (string, error) {
+	if hrp == "" {
+		return "", errors.Errorf("hrp should not be empty")
+	}
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", errors.Errorf("invalid hrp character %q", hrp[i])
+		}
+	}
+
+	lower := strings.ToLower(hrp)
+	upper := strings.ToUpper(hrp)
+	if hrp != lower && hrp != upper {
+		return "", errors.Errorf("mixed case hrp")
+	}
+
+	values, err := bech32ConvertBits(data, 8, 5, true)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	chk := bech32Polymod(append(append(bech32HRPExpand(lower), values...),
+		0, 0, 0, 0, 0, 0)) ^ 1
+
+	var sb strings.Builder
+	sb.WriteString(lower)
+	sb.WriteByte('1')
+	for _, v := range values {
+		sb.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(chk>>(5*(5-i)))&31])
+	}
+
+	if hrp == lower {
+		return sb.String(), nil
+	}
+
+	return strings.ToUpper(sb.String()), nil
+}
+
+// bech32Decode decode bech32 (BIP 173) string without length limit,
+// hrp is returned in its original case.
+func bech32Decode(s string) (hrp string, data []byte, err error) {
+	lower := strings.ToLower(s)
+	if s != lower && s != strings.ToUpper(s) {
+		return "", nil, errors.Errorf("mixed case")
+	}
+
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, errors.Errorf("invalid separator position")
+	}
+
+	hrp = s[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, errors.Errorf("invalid hrp character %q", hrp[i])
+		}
+	}
+
+	values := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(lower); i++ {
+		d := strings.IndexByte(bech32Charset, lower[i])
+		if d == -1 {
+			return "", nil, errors.Errorf("invalid data character %q", lower[i])
+		}
+
+		values = append(values, byte(d))
+	}
+
+	if bech32Polymod(append(bech32HRPExpand(lower[:pos]), values...)) != 1 {
+		return "", nil, errors.Errorf("invalid checksum")
+	}
+
+	if data, err = bech32ConvertBits(values[:len(values)-6], 5, 8, false); err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+
+	return hrp, data, nil
+}
@@ -0,0 +1,429 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// files encrypted by age v1.2.0, with plaintext "hello, age"
+const (
+	ageTestIdentity = "AGE-SECRET-KEY-1Z3CEMEGXRA3WPLZS4UHTUXM33AN6QT9JDULQUN34S4HQ4SWYLQMSS26Y2N"
+	ageTestX25519   = "YWdlLWVuY3J5cHRpb24ub3JnL3YxCi0+IFgyNTUxOSBFdEpPc2g4MGN3V29yYjY2a25IUi9kazJDMmFMVU12ZFozTjFGTWtMNEdrCmVTUmRxL25TRUhYNVJUeWpjeHU1MURJMWhXd3BhbGtobW9VdStTTUhYWkUKLS0tIGlCMEh3U0oyT1hENGtnNHNqNms0K0ZRYmcySXl0UmwyYzl6NU15eGJjc1kKZfHryy8Wx3YwomfxPh2iY5UFc7cF7OL1RL7Tp84+8hX/E2ryNXXWv1rL"
+	// passphrase "gutils", work factor 10
+	ageTestScrypt = "YWdlLWVuY3J5cHRpb24ub3JnL3YxCi0+IHNjcnlwdCBIcnk2emEvSi9FbWZxSE5WdnZZV0lRIDEwCjI1anZuVEJiaERvZFRFQTU4UjJ4eHhPNXZlUHNLa3ZYaFVNU0xIMHVVODQKLS0tIEY4ZVgyNzRrTitydmNFbWZFU2VyV3ZxbGZnZXN5YnVYa1hYRm1nQldlVzgKFHw5WBKeD6EYhkGhwgpe98bkVWBr7PHKFayNQIfgBrn4JwC94kr55tCk"
+)
+
+func ageTestEncrypt(t *testing.T, plain []byte, recipients ...AgeRecipient) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := NewAgeEncryptWriter(&buf, recipients...)
+	require.NoError(t, err)
+	_, err = w.Write(plain)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, w.Close())
+	_, err = w.Write([]byte("a"))
+	require.Error(t, err)
+
+	return buf.Bytes()
+}
+
+func ageTestDecrypt(cipher []byte, identities ...AgeIdentity) ([]byte, error) {
+	r, err := NewAgeDecryptReader(bytes.NewReader(cipher), identities...)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+func TestBech32(t *testing.T) {
+	t.Parallel()
+
+	// BIP 173 test vectors
+	for _, s := range []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+	} {
+		hrp, data, err := bech32Decode(s)
+		require.NoError(t, err, s)
+
+		got, err := bech32Encode(hrp, data)
+		require.NoError(t, err)
+		require.Equal(t, s, got)
+	}
+
+	for _, s := range []string{
+		"A1G7SGD8",     // invalid checksum
+		"10a06t8",      // empty hrp
+		"1qzzfhee",     // empty hrp
+		"x1b4n0q5v",    // invalid data character
+		"li1dgmt3",     // too short checksum
+		"A12uEL5L",     // mixed case
+		"a12uel5m",     // invalid checksum
+		"\x201nwldj5",  // invalid hrp character
+		"abcdef1qpzrz", // too short
+	} {
+		_, _, err := bech32Decode(s)
+		require.Error(t, err, s)
+	}
+
+	_, err := bech32Encode("", nil)
+	require.Error(t, err)
+	_, err = bech32Encode("Age", nil)
+	require.Error(t, err)
+}
+
+func TestAgeX25519Identity(t *testing.T) {
+	t.Parallel()
+
+	identity, err := NewAgeX25519Identity()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(identity.String(), "AGE-SECRET-KEY-1"))
+	require.True(t, strings.HasPrefix(identity.Recipient().String(), "age1"))
+
+	parsed, err := ParseAgeX25519Identity(identity.String())
+	require.NoError(t, err)
+	require.Equal(t, identity.String(), parsed.String())
+	require.Equal(t, identity.Recipient().String(), parsed.Recipient().String())
+
+	recipient, err := ParseAgeX25519Recipient(identity.Recipient().String())
+	require.NoError(t, err)
+	require.Equal(t, identity.Recipient().String(), recipient.String())
+
+	_, err = ParseAgeX25519Identity(strings.ToLower(identity.String()))
+	require.ErrorContains(t, err, "unknown identity type")
+	_, err = ParseAgeX25519Identity(identity.Recipient().String())
+	require.Error(t, err)
+	_, err = ParseAgeX25519Recipient(identity.String())
+	require.ErrorContains(t, err, "unknown recipient type")
+
+	// wrong key size
+	s, err := bech32Encode(ageX25519RecipientHRP, make([]byte, 31))
+	require.NoError(t, err)
+	_, err = ParseAgeX25519Recipient(s)
+	require.Error(t, err)
+}
+
+func TestAgeStanza(t *testing.T) {
+	t.Parallel()
+
+	for _, size := range []int{0, 1, 47, 48, 49, 96, 100} {
+		body := make([]byte, size)
+		for i := range body {
+			body[i] = byte(i)
+		}
+
+		hdr := &ageHeader{stanzas: []*ageStanza{
+			{typ: "test", args: []string{"a", "b"}, body: body},
+			{typ: "other", body: []byte("x")},
+		}}
+		raw := hdr.marshalWithoutMAC()
+		for _, line := range strings.Split(string(raw), "\n") {
+			require.LessOrEqual(t, len(line), ageColumnsPerLine)
+		}
+
+		mac := bytes.Repeat([]byte{1}, ageMACSize)
+		raw = append(raw, " "+ageBase64.EncodeToString(mac)+"\n"...)
+		got, macMsg, err := parseAgeHeader(bufio.NewReader(bytes.NewReader(raw)))
+		require.NoError(t, err, size)
+		require.Equal(t, hdr.marshalWithoutMAC(), macMsg)
+		require.Equal(t, mac, got.mac)
+		require.Len(t, got.stanzas, 2)
+		require.Equal(t, "test", got.stanzas[0].typ)
+		require.Equal(t, []string{"a", "b"}, got.stanzas[0].args)
+		require.True(t, bytes.Equal(body, got.stanzas[0].body), size)
+	}
+
+	mac := ageBase64.EncodeToString(make([]byte, ageMACSize))
+	for name, raw := range map[string]string{
+		"version":        "age-encryption.org/v2\n-> X 1\n\n--- " + mac + "\n",
+		"no stanza":      "age-encryption.org/v1\n--- " + mac + "\n",
+		"empty arg":      "age-encryption.org/v1\n-> X  1\n\n--- " + mac + "\n",
+		"bad line":       "age-encryption.org/v1\n>> X 1\n\n--- " + mac + "\n",
+		"long body":      "age-encryption.org/v1\n-> X\n" + strings.Repeat("A", 65) + "\n\n--- " + mac + "\n",
+		"padding":        "age-encryption.org/v1\n-> X\nAB\n--- " + mac + "\n",
+		"missing last":   "age-encryption.org/v1\n-> X\n" + strings.Repeat("A", 64) + "\n--- " + mac + "\n",
+		"short mac":      "age-encryption.org/v1\n-> X\n\n--- AAAA\n",
+		"truncated":      "age-encryption.org/v1\n-> X\n",
+		"crlf":           "age-encryption.org/v1\r\n-> X\n\n--- " + mac + "\n",
+		"non-visible":    "age-encryption.org/v1\n-> X\x7f\n\n--- " + mac + "\n",
+		"footer no mac":  "age-encryption.org/v1\n-> X\n\n---\n",
+		"no line ending": "age-encryption.org/v1\n-> X\n\n--- " + mac,
+	} {
+		_, _, err := parseAgeHeader(bufio.NewReader(strings.NewReader(raw)))
+		require.Error(t, err, name)
+	}
+}
+
+func TestAgeX25519(t *testing.T) {
+	t.Parallel()
+
+	id1, err := NewAgeX25519Identity()
+	require.NoError(t, err)
+	id2, err := NewAgeX25519Identity()
+	require.NoError(t, err)
+	other, err := NewAgeX25519Identity()
+	require.NoError(t, err)
+
+	for _, size := range []int{0, 1, ageChunkSize - 1, ageChunkSize,
+		ageChunkSize + 1, 2 * ageChunkSize, 3*ageChunkSize + 100} {
+		plain, err := Salt(size)
+		require.NoError(t, err)
+
+		cipher := ageTestEncrypt(t, plain, id1.Recipient(), id2.Recipient())
+		for _, id := range []AgeIdentity{id1, id2} {
+			got, err := ageTestDecrypt(cipher, id)
+			require.NoError(t, err, size)
+			require.Equal(t, plain, got)
+		}
+
+		got, err := ageTestDecrypt(cipher, other, id2)
+		require.NoError(t, err, size)
+		require.Equal(t, plain, got)
+
+		_, err = ageTestDecrypt(cipher, other)
+		require.ErrorContains(t, err, "no identity matched")
+	}
+
+	_, err = NewAgeEncryptWriter(io.Discard)
+	require.Error(t, err)
+	_, err = NewAgeDecryptReader(bytes.NewReader(nil))
+	require.Error(t, err)
+}
+
+func TestAgeScrypt(t *testing.T) {
+	t.Parallel()
+
+	recipient, err := NewAgeScryptRecipient("gutils", WithAgeScryptWorkFactor(10))
+	require.NoError(t, err)
+	identity, err := NewAgeScryptIdentity("gutils")
+	require.NoError(t, err)
+
+	plain := []byte("hello, age")
+	cipher := ageTestEncrypt(t, plain, recipient)
+	require.Contains(t, string(cipher), "-> scrypt ")
+	got, err := ageTestDecrypt(cipher, identity)
+	require.NoError(t, err)
+	require.Equal(t, plain, got)
+
+	wrong, err := NewAgeScryptIdentity("wrong")
+	require.NoError(t, err)
+	_, err = ageTestDecrypt(cipher, wrong)
+	require.Error(t, err)
+
+	t.Run("max work factor", func(t *testing.T) {
+		t.Parallel()
+
+		identity, err := NewAgeScryptIdentity("gutils", WithAgeScryptMaxWorkFactor(9))
+		require.NoError(t, err)
+		_, err = ageTestDecrypt(cipher, identity)
+		require.ErrorContains(t, err, "exceeds max")
+	})
+
+	t.Run("mixed with other recipients", func(t *testing.T) {
+		t.Parallel()
+
+		x25519, err := NewAgeX25519Identity()
+		require.NoError(t, err)
+		_, err = NewAgeEncryptWriter(io.Discard, recipient, x25519.Recipient())
+		require.ErrorContains(t, err, "can not be mixed")
+
+		// handcraft header with scrypt and X25519 stanzas
+		fileKey := make([]byte, ageFileKeySize)
+		s1, err := recipient.ageWrap(fileKey)
+		require.NoError(t, err)
+		s2, err := x25519.Recipient().ageWrap(fileKey)
+		require.NoError(t, err)
+		_, err = identity.ageUnwrap(append(s2, s1...))
+		require.ErrorContains(t, err, "only stanza")
+	})
+
+	t.Run("invalid work factor", func(t *testing.T) {
+		t.Parallel()
+
+		for _, logN := range []string{"010", "0", "-1", "a", "+10"} {
+			stanzas, err := recipient.ageWrap(make([]byte, ageFileKeySize))
+			require.NoError(t, err)
+			stanzas[0].args[1] = logN
+			_, err = identity.ageUnwrap(stanzas)
+			require.ErrorContains(t, err, "invalid work factor", logN)
+		}
+	})
+
+	_, err = NewAgeScryptRecipient("")
+	require.Error(t, err)
+	_, err = NewAgeScryptIdentity("")
+	require.Error(t, err)
+	_, err = NewAgeScryptRecipient("a", WithAgeScryptWorkFactor(0))
+	require.Error(t, err)
+	_, err = NewAgeScryptIdentity("a", WithAgeScryptMaxWorkFactor(31))
+	require.Error(t, err)
+}
+
+func TestAgeDecrypt_vectors(t *testing.T) {
+	t.Parallel()
+
+	identity, err := ParseAgeX25519Identity(ageTestIdentity)
+	require.NoError(t, err)
+	cipher, err := base64.StdEncoding.DecodeString(ageTestX25519)
+	require.NoError(t, err)
+	got, err := ageTestDecrypt(cipher, identity)
+	require.NoError(t, err)
+	require.Equal(t, "hello, age", string(got))
+
+	scryptIdentity, err := NewAgeScryptIdentity("gutils")
+	require.NoError(t, err)
+	cipher, err = base64.StdEncoding.DecodeString(ageTestScrypt)
+	require.NoError(t, err)
+	got, err = ageTestDecrypt(cipher, scryptIdentity)
+	require.NoError(t, err)
+	require.Equal(t, "hello, age", string(got))
+}
+
+func TestAgeDecrypt_tamper(t *testing.T) {
+	t.Parallel()
+
+	identity, err := NewAgeX25519Identity()
+	require.NoError(t, err)
+	plain, err := Salt(2*ageChunkSize + 10)
+	require.NoError(t, err)
+	cipher := ageTestEncrypt(t, plain, identity.Recipient())
+	headerLen := bytes.Index(cipher, []byte("\n--- ")) + 5 + 43 + 1
+	payloadStart := headerLen + ageStreamNonceSize
+	fullChunk := ageChunkSize + 16
+
+	for name, f := range map[string]func([]byte) []byte{
+		"header mac": func(b []byte) []byte {
+			b[headerLen-2] ^= 1
+			return b
+		},
+		"header stanza": func(b []byte) []byte {
+			// rename stanza type
+			i := bytes.Index(b, []byte("-> X25519 ")) + 3
+			b[i] = 'Y'
+			return b
+		},
+		"nonce": func(b []byte) []byte {
+			b[headerLen] ^= 1
+			return b
+		},
+		"payload": func(b []byte) []byte {
+			b[payloadStart+fullChunk+1] ^= 1
+			return b
+		},
+		"truncate at chunk boundary": func(b []byte) []byte {
+			return b[:payloadStart+2*fullChunk]
+		},
+		"truncate last chunk": func(b []byte) []byte {
+			return b[:len(b)-1]
+		},
+		"drop last chunk and tag": func(b []byte) []byte {
+			return b[:payloadStart+fullChunk]
+		},
+		"append data": func(b []byte) []byte {
+			return append(b, 0)
+		},
+		"reorder chunks": func(b []byte) []byte {
+			out := append([]byte{}, b[:payloadStart]...)
+			out = append(out, b[payloadStart+fullChunk:payloadStart+2*fullChunk]...)
+			out = append(out, b[payloadStart:payloadStart+fullChunk]...)
+			return append(out, b[payloadStart+2*fullChunk:]...)
+		},
+		"no payload": func(b []byte) []byte {
+			return b[:payloadStart]
+		},
+	} {
+		_, err := ageTestDecrypt(f(append([]byte{}, cipher...)), identity)
+		require.Error(t, err, name)
+	}
+
+	// full chunk followed by an empty last chunk is invalid
+	id2, err := NewAgeX25519Identity()
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w, err := NewAgeEncryptWriter(&buf, id2.Recipient())
+	require.NoError(t, err)
+	_, err = w.Write(make([]byte, ageChunkSize))
+	require.NoError(t, err)
+	require.NoError(t, w.flushChunk(false))
+	require.NoError(t, w.Close())
+	_, err = ageTestDecrypt(buf.Bytes(), id2)
+	require.ErrorContains(t, err, "last chunk should not be empty")
+}
+
+func TestParseAgeKeysFile(t *testing.T) {
+	t.Parallel()
+
+	id1, err := NewAgeX25519Identity()
+	require.NoError(t, err)
+	id2, err := NewAgeX25519Identity()
+	require.NoError(t, err)
+
+	identities, err := ParseAgeIdentities(strings.NewReader(
+		"# created: 2024-01-01T00:00:00Z\n# public key: " + id1.Recipient().String() +
+			"\n" + id1.String() + "\n\n  " + id2.String() + "  \n"))
+	require.NoError(t, err)
+	require.Len(t, identities, 2)
+
+	recipients, err := ParseAgeRecipients(strings.NewReader(
+		"# team\n" + id1.Recipient().String() + "\n" + id2.Recipient().String() + "\n"))
+	require.NoError(t, err)
+	require.Len(t, recipients, 2)
+
+	plain := []byte("hello")
+	cipher := ageTestEncrypt(t, plain, recipients...)
+	got, err := ageTestDecrypt(cipher, identities[1])
+	require.NoError(t, err)
+	require.Equal(t, plain, got)
+
+	_, err = ParseAgeIdentities(strings.NewReader("# nothing\n\n"))
+	require.ErrorContains(t, err, "no key found")
+	_, err = ParseAgeIdentities(strings.NewReader(id1.Recipient().String()))
+	require.ErrorContains(t, err, "line 1")
+	_, err = ParseAgeRecipients(strings.NewReader("\n" + id1.String()))
+	require.ErrorContains(t, err, "line 2")
+}
+
+func TestAgeEncryptFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	identity, err := NewAgeX25519Identity()
+	require.NoError(t, err)
+	plain, err := Salt(ageChunkSize*3 + 7)
+	require.NoError(t, err)
+
+	in := filepath.Join(dir, "plain")
+	enc := filepath.Join(dir, "plain.age")
+	dec := filepath.Join(dir, "plain.dec")
+	require.NoError(t, os.WriteFile(in, plain, 0600))
+
+	require.NoError(t, AgeEncryptFile(in, enc, identity.Recipient()))
+	require.NoError(t, AgeDecryptFile(enc, dec, identity))
+	got, err := os.ReadFile(dec)
+	require.NoError(t, err)
+	require.Equal(t, plain, got)
+
+	// corrupted file should not create output
+	cipher, err := os.ReadFile(enc)
+	require.NoError(t, err)
+	cipher[len(cipher)-1] ^= 1
+	require.NoError(t, os.WriteFile(enc, cipher, 0600))
+	bad := filepath.Join(dir, "bad")
+	require.Error(t, AgeDecryptFile(enc, bad, identity))
+	_, err = os.Stat(bad)
+	require.True(t, os.IsNotExist(err))
+}
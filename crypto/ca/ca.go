@@ -0,0 +1,487 @@
+// Package ca is a certificate authority service
+//
+// sign CSR by policy, revoke certificates and regenerate CRL periodically,
+// all issued certificates, serial numbers and revocations are kept in Store.
+package ca
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+	glog "github.com/Laisky/go-utils/v4/log"
+)
+
+// oidExtensionReasonCode CRL entry reason code, refer to RFC-5280 5.3.1
+var oidExtensionReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+var (
+	_ gcrypto.OCSPRevocationSource = new(CA)
+)
+
+const (
+	defaultCRLRefreshInterval = time.Hour
+	defaultCRLValidFor        = 24 * time.Hour
+	defaultSignValidFor       = 7 * 24 * time.Hour
+)
+
+// CA certificate authority
+type CA struct {
+	opt    *caOption
+	cert   *x509.Certificate
+	prikey crypto.PrivateKey
+	store  Store
+
+	mu     sync.RWMutex
+	crlDer []byte
+}
+
+type caOption struct {
+	logger             glog.Logger
+	policy             *Policy
+	crlRefreshInterval time.Duration
+	crlValidFor        time.Duration
+	crlEndpoints       []string
+	ocspServers        []string
+	issuanceHooks      []IssuanceHook
+}
+
+func (o *caOption) fillDefault() *caOption {
+	o.logger = glog.Shared.Named("ca")
+	o.policy = new(Policy)
+	o.crlRefreshInterval = defaultCRLRefreshInterval
+	o.crlValidFor = defaultCRLValidFor
+	return o
+}
+
+func (o *caOption) applyOpts(opts ...Option) (*caOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.crlValidFor <= o.crlRefreshInterval {
+		return nil, errors.Errorf("crl valid for %s should be longer than refresh interval %s",
+			o.crlValidFor, o.crlRefreshInterval)
+	}
+
+	return o, nil
+}
+
+// Option optional arguments for CA
+type Option func(*caOption) error
+
+// WithLogger set logger
+func WithLogger(logger glog.Logger) Option {
+	return func(o *caOption) error {
+		if logger == nil {
+			return errors.Errorf("logger is nil")
+		}
+
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithPolicy set policy to check CSR
+//
+// default to zero value of Policy, which reject any SANs.
+func WithPolicy(policy *Policy) Option {
+	return func(o *caOption) error {
+		if policy == nil {
+			return errors.Errorf("policy is nil")
+		}
+
+		o.policy = policy
+		return nil
+	}
+}
+
+// WithCRLRefreshInterval set interval to regenerate CRL
+//
+// default to 1 hour
+func WithCRLRefreshInterval(interval time.Duration) Option {
+	return func(o *caOption) error {
+		if interval <= 0 {
+			return errors.Errorf("interval should be positive")
+		}
+
+		o.crlRefreshInterval = interval
+		return nil
+	}
+}
+
+// WithCRLValidFor set duration between thisUpdate and nextUpdate of CRL,
+// should be longer than refresh interval.
+//
+// default to 24 hours
+func WithCRLValidFor(validFor time.Duration) Option {
+	return func(o *caOption) error {
+		if validFor <= 0 {
+			return errors.Errorf("validFor should be positive")
+		}
+
+		o.crlValidFor = validFor
+		return nil
+	}
+}
+
+// WithCRLEndpoints set CRL distribution points of issued certificates
+func WithCRLEndpoints(endpoints ...string) Option {
+	return func(o *caOption) error {
+		o.crlEndpoints = append(o.crlEndpoints, endpoints...)
+		return nil
+	}
+}
+
+// WithOCSPServers set OCSP servers of issued certificates
+func WithOCSPServers(servers ...string) Option {
+	return func(o *caOption) error {
+		o.ocspServers = append(o.ocspServers, servers...)
+		return nil
+	}
+}
+
+// IssuanceHook called with every certificate signed by CA
+// after it is saved to store.
+//
+// certificate will not be returned if hook failed,
+// but it is still in store, so caller may retry the hook or revoke it.
+type IssuanceHook func(ctx context.Context, certDer []byte) error
+
+// WithIssuanceHook add hooks called after certificate signed,
+// e.g. append certificate to merkle.Log for auditability.
+func WithIssuanceHook(hooks ...IssuanceHook) Option {
+	return func(o *caOption) error {
+		for _, hook := range hooks {
+			if hook == nil {
+				return errors.Errorf("hook should not be nil")
+			}
+		}
+
+		o.issuanceHooks = append(o.issuanceHooks, hooks...)
+		return nil
+	}
+}
+
+// New new CA
+//
+// will generate CRL immediately, and regenerate it periodically until ctx done.
+//
+// # Args
+//   - cert: CA certificate, should have CertSign and CRLSign key usages
+//   - prikey: private key of CA certificate
+//   - store: persistence of issued certificates
+func New(ctx context.Context,
+	cert *x509.Certificate,
+	prikey crypto.PrivateKey,
+	store Store,
+	opts ...Option) (*CA, error) {
+	opt, err := new(caOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	if cert == nil || prikey == nil || store == nil {
+		return nil, errors.Errorf("cert, prikey and store should not be empty")
+	}
+	if !cert.IsCA ||
+		cert.KeyUsage&x509.KeyUsageCertSign == 0 ||
+		cert.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return nil, errors.Errorf("certificate should be CA with CertSign and CRLSign key usages")
+	}
+
+	c := &CA{
+		opt:    opt,
+		cert:   cert,
+		prikey: prikey,
+		store:  store,
+	}
+
+	if _, err = c.RefreshCRL(ctx); err != nil {
+		return nil, errors.Wrap(err, "generate crl")
+	}
+
+	go c.runCRLRefresher(ctx)
+	return c, nil
+}
+
+// Cert CA certificate
+func (c *CA) Cert() *x509.Certificate {
+	return c.cert
+}
+
+// Store store of CA
+func (c *CA) Store() Store {
+	return c.store
+}
+
+type signOption struct {
+	validFor    time.Duration
+	isCA        bool
+	keyUsage    x509.KeyUsage
+	extKeyUsage []x509.ExtKeyUsage
+}
+
+func (o *signOption) fillDefault(policy *Policy) *signOption {
+	o.validFor = defaultSignValidFor
+	if o.validFor > policy.maxValidity() {
+		o.validFor = policy.maxValidity()
+	}
+
+	return o
+}
+
+func (o *signOption) applyOpts(opts ...SignOption) (*signOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// SignOption optional arguments for Sign
+type SignOption func(*signOption) error
+
+// WithSignValidFor set validity of certificate
+//
+// default to 7 days, or policy's max validity if it's shorter
+func WithSignValidFor(validFor time.Duration) SignOption {
+	return func(o *signOption) error {
+		if validFor <= 0 {
+			return errors.Errorf("validFor should be positive")
+		}
+
+		o.validFor = validFor
+		return nil
+	}
+}
+
+// WithSignIsCA sign certificate as intermediate CA,
+// should be allowed by policy
+func WithSignIsCA() SignOption {
+	return func(o *signOption) error {
+		o.isCA = true
+		return nil
+	}
+}
+
+// WithSignKeyUsage add key usage
+func WithSignKeyUsage(usage ...x509.KeyUsage) SignOption {
+	return func(o *signOption) error {
+		for i := range usage {
+			o.keyUsage |= usage[i]
+		}
+
+		return nil
+	}
+}
+
+// WithSignExtKeyUsage add ext key usage
+func WithSignExtKeyUsage(usage ...x509.ExtKeyUsage) SignOption {
+	return func(o *signOption) error {
+		o.extKeyUsage = append(o.extKeyUsage, usage...)
+		return nil
+	}
+}
+
+// Sign check CSR by policy, then sign it to certificate
+func (c *CA) Sign(ctx context.Context, csrDer []byte, opts ...SignOption) (certDer []byte, err error) {
+	opt, err := new(signOption).fillDefault(c.opt.policy).applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	csr, err := gcrypto.Der2CSR(csrDer)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse csr")
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, errors.Wrap(err, "check csr signature")
+	}
+	if err = c.opt.policy.CheckCSR(csr); err != nil {
+		return nil, errors.Wrap(err, "csr is not allowed by policy")
+	}
+
+	notBefore := gutils.Clock.GetUTCNow()
+	notAfter := notBefore.Add(opt.validFor)
+	if notAfter.After(c.cert.NotAfter) {
+		return nil, errors.Errorf("certificate should not expire after CA")
+	}
+	if err = c.opt.policy.CheckValidity(notBefore, notAfter, opt.isCA); err != nil {
+		return nil, errors.Wrap(err, "validity is not allowed by policy")
+	}
+
+	serialNumber, err := c.store.NextSerialNumber(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "allocate serial number")
+	}
+
+	signOpts := []gcrypto.SignCSROption{
+		gcrypto.WithX509SignCSRSeriaNumber(serialNumber),
+		gcrypto.WithX509SignCSRNotBefore(notBefore),
+		gcrypto.WithX509SignCSRNotAfter(notAfter),
+		gcrypto.WithX509SignCSRKeyUsage(opt.keyUsage),
+		gcrypto.WithX509SignCSRExtKeyUsage(opt.extKeyUsage...),
+		gcrypto.WithX509SignCSRCRLs(c.opt.crlEndpoints...),
+		gcrypto.WithX509SignCSROCSPServers(c.opt.ocspServers...),
+	}
+	if opt.isCA {
+		signOpts = append(signOpts, gcrypto.WithX509SignCSRIsCA())
+	}
+
+	certDer, err = gcrypto.NewX509CertByCSR(c.cert, c.prikey, csrDer, signOpts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "sign csr")
+	}
+
+	if err = c.store.SaveCert(ctx, &CertRecord{
+		SerialNumber: serialNumber,
+		Der:          certDer,
+		NotAfter:     notAfter,
+	}); err != nil {
+		return nil, errors.Wrap(err, "save certificate")
+	}
+
+	// only saved certificate should be logged
+	for _, hook := range c.opt.issuanceHooks {
+		if err = hook(ctx, certDer); err != nil {
+			return nil, errors.Wrapf(err, "run issuance hook for certificate %s", serialNumber)
+		}
+	}
+
+	c.opt.logger.Info("sign certificate",
+		zap.String("serial", serialNumber.String()),
+		zap.String("subject", csr.Subject.String()),
+		zap.Time("not_after", notAfter))
+	return certDer, nil
+}
+
+// Revoke revoke certificate, then regenerate CRL
+func (c *CA) Revoke(ctx context.Context, serialNumber *big.Int, reason RevocationReason) error {
+	if err := c.store.Revoke(ctx, serialNumber, reason, gutils.Clock.GetUTCNow()); err != nil {
+		return errors.Wrapf(err, "revoke certificate %s", serialNumber)
+	}
+
+	c.opt.logger.Info("revoke certificate",
+		zap.String("serial", serialNumber.String()),
+		zap.String("reason", reason.String()))
+	if _, err := c.RefreshCRL(ctx); err != nil {
+		return errors.Wrap(err, "regenerate crl")
+	}
+
+	return nil
+}
+
+// CRL get latest CRL in DER
+func (c *CA) CRL() (crlDer []byte) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.crlDer
+}
+
+// RefreshCRL regenerate CRL by all revoked and unexpired certificates
+func (c *CA) RefreshCRL(ctx context.Context) (crlDer []byte, err error) {
+	records, err := c.store.ListRevoked(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "list revoked certificates")
+	}
+
+	now := gutils.Clock.GetUTCNow()
+	var revoked []pkix.RevokedCertificate
+	for _, record := range records {
+		if record.NotAfter.Before(now) {
+			continue
+		}
+
+		reasonExt, err := asn1.Marshal(asn1.Enumerated(record.RevocationReason))
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal reason code")
+		}
+
+		revoked = append(revoked, pkix.RevokedCertificate{
+			SerialNumber:   record.SerialNumber,
+			RevocationTime: record.RevokedAt,
+			Extensions: []pkix.Extension{{
+				Id:    oidExtensionReasonCode,
+				Value: reasonExt,
+			}},
+		})
+	}
+
+	crlNumber, err := c.store.NextCRLNumber(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "allocate crl number")
+	}
+
+	crlDer, err = gcrypto.NewX509CRL(c.cert, c.prikey, crlNumber, revoked,
+		gcrypto.WithX509CRLThisUpdate(now),
+		gcrypto.WithX509CRLNextUpdate(now.Add(c.opt.crlValidFor)),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "sign crl")
+	}
+
+	c.mu.Lock()
+	c.crlDer = crlDer
+	c.mu.Unlock()
+
+	c.opt.logger.Debug("regenerate crl",
+		zap.String("number", crlNumber.String()),
+		zap.Int("revoked", len(revoked)))
+	return crlDer, nil
+}
+
+// OCSPStatus get revocation status of certificate,
+// so CA can be used as the source of gcrypto.OCSPResponder
+func (c *CA) OCSPStatus(ctx context.Context, serialNumber *big.Int) (*gcrypto.OCSPCertStatus, error) {
+	record, err := c.store.GetCert(ctx, serialNumber)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return &gcrypto.OCSPCertStatus{Status: gcrypto.OCSPStatusUnknown}, nil
+		}
+
+		return nil, errors.Wrapf(err, "get certificate %s", serialNumber)
+	}
+
+	if !record.Revoked {
+		return &gcrypto.OCSPCertStatus{Status: gcrypto.OCSPStatusGood}, nil
+	}
+
+	return &gcrypto.OCSPCertStatus{
+		Status:           gcrypto.OCSPStatusRevoked,
+		RevokedAt:        record.RevokedAt,
+		RevocationReason: int(record.RevocationReason),
+	}, nil
+}
+
+func (c *CA) runCRLRefresher(ctx context.Context) {
+	ticker := time.NewTicker(c.opt.crlRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := c.RefreshCRL(ctx); err != nil {
+			c.opt.logger.Error("regenerate crl", zap.Error(err))
+		}
+	}
+}
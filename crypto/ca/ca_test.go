@@ -0,0 +1,263 @@
+package ca
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/require"
+
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+	"github.com/Laisky/go-utils/v4/crypto/merkle"
+)
+
+func testNewCA(t *testing.T, ctx context.Context, opts ...Option) *CA {
+	t.Helper()
+
+	prikeyPem, certDer, err := gcrypto.NewECDSAPrikeyAndCert(gcrypto.ECDSACurveP256,
+		gcrypto.WithX509CertCommonName("test-ca"),
+		gcrypto.WithX509CertIsCA(),
+		gcrypto.WithX509CertValidFor(365*24*time.Hour),
+	)
+	require.NoError(t, err)
+	prikey, err := gcrypto.Pem2Prikey(prikeyPem)
+	require.NoError(t, err)
+	cert, err := gcrypto.Der2Cert(certDer)
+	require.NoError(t, err)
+
+	ca, err := New(ctx, cert, prikey, NewMemoryStore(), opts...)
+	require.NoError(t, err)
+	return ca
+}
+
+func testNewCSR(t *testing.T, opts ...gcrypto.X509CSROption) []byte {
+	t.Helper()
+
+	prikey, err := gcrypto.NewECDSAPrikey(gcrypto.ECDSACurveP256)
+	require.NoError(t, err)
+	opts = append([]gcrypto.X509CSROption{gcrypto.WithX509CSRCommonName("laisky")}, opts...)
+	csrDer, err := gcrypto.NewX509CSR(prikey, opts...)
+	require.NoError(t, err)
+	return csrDer
+}
+
+func TestCA_Sign(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, ipnet, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	ca := testNewCA(t, ctx,
+		WithPolicy(&Policy{
+			AllowedDNSNames: []string{"*.example.com"},
+			AllowedIPNets:   []*net.IPNet{ipnet},
+			MaxValidity:     30 * 24 * time.Hour,
+		}),
+		WithCRLEndpoints("https://ca.example.com/crl"),
+	)
+
+	t.Run("allowed", func(t *testing.T) {
+		csrDer := testNewCSR(t,
+			gcrypto.WithX509CSRCommonName("www.example.com"),
+			gcrypto.WithX509CSRSANS("www.example.com", "10.1.2.3"),
+		)
+		certDer, err := ca.Sign(ctx, csrDer,
+			WithSignValidFor(24*time.Hour),
+			WithSignExtKeyUsage(x509.ExtKeyUsageServerAuth),
+		)
+		require.NoError(t, err)
+
+		cert, err := gcrypto.Der2Cert(certDer)
+		require.NoError(t, err)
+		require.NoError(t, cert.CheckSignatureFrom(ca.Cert()))
+		require.Equal(t, []string{"www.example.com"}, cert.DNSNames)
+		require.Equal(t, []string{"https://ca.example.com/crl"}, cert.CRLDistributionPoints)
+		require.False(t, cert.IsCA)
+
+		record, err := ca.Store().GetCert(ctx, cert.SerialNumber)
+		require.NoError(t, err)
+		require.Equal(t, certDer, record.Der)
+		require.False(t, record.Revoked)
+	})
+
+	t.Run("not allowed", func(t *testing.T) {
+		for _, csrDer := range [][]byte{
+			testNewCSR(t, gcrypto.WithX509CSRSANS("example.com")),
+			testNewCSR(t, gcrypto.WithX509CSRSANS("www.example.org")),
+			testNewCSR(t, gcrypto.WithX509CSRSANS("192.168.1.1")),
+			testNewCSR(t, gcrypto.WithX509CSRSANS("laisky@example.com")),
+		} {
+			_, err := ca.Sign(ctx, csrDer)
+			require.ErrorContains(t, err, "not allowed by policy")
+		}
+
+		csrDer := testNewCSR(t, gcrypto.WithX509CSRSANS("www.example.com"))
+		_, err := ca.Sign(ctx, csrDer, WithSignValidFor(31*24*time.Hour))
+		require.ErrorContains(t, err, "exceeds max validity")
+
+		_, err = ca.Sign(ctx, csrDer, WithSignIsCA())
+		require.ErrorContains(t, err, "CA certificate is not allowed")
+	})
+}
+
+func TestCA_Revoke(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ca := testNewCA(t, ctx,
+		WithCRLRefreshInterval(100*time.Millisecond),
+		WithCRLValidFor(time.Hour),
+	)
+
+	crl, err := gcrypto.Der2CRL(ca.CRL())
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(ca.Cert()))
+	require.Empty(t, crl.RevokedCertificateEntries)
+	firstNumber := crl.Number
+
+	certDer, err := ca.Sign(ctx, testNewCSR(t, gcrypto.WithX509CSRCommonName("laisky")))
+	require.NoError(t, err)
+	cert, err := gcrypto.Der2Cert(certDer)
+	require.NoError(t, err)
+
+	err = ca.Revoke(ctx, cert.SerialNumber, RevocationReasonKeyCompromise)
+	require.NoError(t, err)
+
+	record, err := ca.Store().GetCert(ctx, cert.SerialNumber)
+	require.NoError(t, err)
+	require.True(t, record.Revoked)
+	require.Equal(t, RevocationReasonKeyCompromise, record.RevocationReason)
+
+	crl, err = gcrypto.Der2CRL(ca.CRL())
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(ca.Cert()))
+	require.Len(t, crl.RevokedCertificateEntries, 1)
+	require.Equal(t, 0, crl.RevokedCertificateEntries[0].SerialNumber.Cmp(cert.SerialNumber))
+	require.Equal(t, int(RevocationReasonKeyCompromise), crl.RevokedCertificateEntries[0].ReasonCode)
+	require.Positive(t, crl.Number.Cmp(firstNumber))
+
+	// crl will be regenerated periodically
+	lastNumber := crl.Number
+	require.Eventually(t, func() bool {
+		crl, err := gcrypto.Der2CRL(ca.CRL())
+		require.NoError(t, err)
+		return crl.Number.Cmp(lastNumber) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	t.Run("ocsp status", func(t *testing.T) {
+		status, err := ca.OCSPStatus(ctx, cert.SerialNumber)
+		require.NoError(t, err)
+		require.Equal(t, gcrypto.OCSPStatusRevoked, status.Status)
+		require.Equal(t, int(RevocationReasonKeyCompromise), status.RevocationReason)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		serial, err := ca.Store().NextSerialNumber(ctx)
+		require.NoError(t, err)
+		err = ca.Revoke(ctx, serial, RevocationReasonUnspecified)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		status, err := ca.OCSPStatus(ctx, serial)
+		require.NoError(t, err)
+		require.Equal(t, gcrypto.OCSPStatusUnknown, status.Status)
+	})
+}
+
+func TestCA_IssuanceHook(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logPrikey, err := gcrypto.NewEd25519Prikey()
+	require.NoError(t, err)
+	auditLog, err := merkle.New(merkle.NewMemoryStore(), logPrikey)
+	require.NoError(t, err)
+
+	var (
+		failed    bool
+		failedDer []byte
+	)
+	ca := testNewCA(t, ctx,
+		WithIssuanceHook(auditLog.LogCert),
+		WithIssuanceHook(func(_ context.Context, certDer []byte) error {
+			if failed {
+				failedDer = certDer
+				return errors.New("hook failed")
+			}
+
+			return nil
+		}),
+	)
+
+	certDer, err := ca.Sign(ctx, testNewCSR(t))
+	require.NoError(t, err)
+
+	sth, err := auditLog.SignTreeHead(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, sth.TreeSize)
+	idx, proof, err := auditLog.ProveEntry(ctx, certDer, sth.TreeSize)
+	require.NoError(t, err)
+	require.NoError(t, sth.VerifyInclusion(certDer, idx, proof))
+
+	// certificate is saved before hooks
+	failed = true
+	_, err = ca.Sign(ctx, testNewCSR(t))
+	require.ErrorContains(t, err, "hook failed")
+	failedCert, err := gcrypto.Der2Cert(failedDer)
+	require.NoError(t, err)
+	_, err = ca.store.GetCert(ctx, failedCert.SerialNumber)
+	require.NoError(t, err)
+
+	t.Run("save failed", func(t *testing.T) {
+		var called bool
+		ca, err := New(ctx, ca.Cert(), ca.prikey, &testSaveFailedStore{Store: NewMemoryStore()},
+			WithIssuanceHook(func(_ context.Context, _ []byte) error {
+				called = true
+				return nil
+			}))
+		require.NoError(t, err)
+
+		_, err = ca.Sign(ctx, testNewCSR(t))
+		require.ErrorContains(t, err, "save certificate")
+		require.False(t, called)
+	})
+
+	_, err = New(ctx, ca.Cert(), ca.prikey, NewMemoryStore(), WithIssuanceHook(nil))
+	require.Error(t, err)
+}
+
+// testSaveFailedStore store that always fails to save certificate
+type testSaveFailedStore struct {
+	Store
+}
+
+func (s *testSaveFailedStore) SaveCert(_ context.Context, _ *CertRecord) error {
+	return errors.New("disk full")
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	prikeyPem, certDer, err := gcrypto.NewECDSAPrikeyAndCert(gcrypto.ECDSACurveP256,
+		gcrypto.WithX509CertCommonName("not-ca"),
+	)
+	require.NoError(t, err)
+	prikey, err := gcrypto.Pem2Prikey(prikeyPem)
+	require.NoError(t, err)
+	cert, err := gcrypto.Der2Cert(certDer)
+	require.NoError(t, err)
+
+	_, err = New(ctx, cert, prikey, NewMemoryStore())
+	require.ErrorContains(t, err, "should be CA")
+
+	_, err = New(ctx, cert, prikey, NewMemoryStore(),
+		WithCRLRefreshInterval(time.Hour), WithCRLValidFor(time.Minute))
+	require.ErrorContains(t, err, "should be longer than refresh interval")
+}
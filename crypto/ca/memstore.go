@@ -0,0 +1,140 @@
+package ca
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+)
+
+var (
+	_ Store = new(MemoryStore)
+)
+
+// MemoryStore insecure memory based store,
+// all data will be lost after process exit.
+type MemoryStore struct {
+	mu sync.RWMutex
+	// certs map[serialNumber]record
+	certs     map[string]*CertRecord
+	reserved  map[string]struct{}
+	crlNumber *big.Int
+}
+
+// NewMemoryStore new memory based store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		certs:     map[string]*CertRecord{},
+		reserved:  map[string]struct{}{},
+		crlNumber: big.NewInt(0),
+	}
+}
+
+// maxSerialNumber serial number is positive and no longer than 20 octets,
+// refer to RFC-5280 4.1.2.2
+var maxSerialNumber = new(big.Int).Lsh(big.NewInt(1), 159)
+
+// NextSerialNumber allocate random 159 bits serial number
+func (s *MemoryStore) NextSerialNumber(_ context.Context) (*big.Int, error) {
+	for {
+		sn, err := rand.Int(rand.Reader, maxSerialNumber)
+		if err != nil {
+			return nil, errors.Wrap(err, "generate serial number")
+		}
+		if sn.Sign() == 0 {
+			continue
+		}
+
+		s.mu.Lock()
+		if _, ok := s.reserved[sn.String()]; ok {
+			s.mu.Unlock()
+			continue
+		}
+
+		s.reserved[sn.String()] = struct{}{}
+		s.mu.Unlock()
+		return sn, nil
+	}
+}
+
+// SaveCert save issued certificate
+func (s *MemoryStore) SaveCert(_ context.Context, record *CertRecord) error {
+	if record == nil || record.SerialNumber == nil {
+		return errors.Errorf("serial number is empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.certs[record.SerialNumber.String()]; ok {
+		return errors.Errorf("certificate %s already exists", record.SerialNumber)
+	}
+
+	cp := *record
+	s.certs[record.SerialNumber.String()] = &cp
+	return nil
+}
+
+// GetCert get certificate by serial number
+func (s *MemoryStore) GetCert(_ context.Context, serialNumber *big.Int) (*CertRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.certs[serialNumber.String()]
+	if !ok {
+		return nil, errors.Wrapf(ErrNotFound, "certificate %s", serialNumber)
+	}
+
+	cp := *record
+	return &cp, nil
+}
+
+// Revoke mark certificate as revoked
+//
+// revoke a revoked certificate will update its reason, but not the revoked time.
+func (s *MemoryStore) Revoke(_ context.Context,
+	serialNumber *big.Int, reason RevocationReason, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.certs[serialNumber.String()]
+	if !ok {
+		return errors.Wrapf(ErrNotFound, "certificate %s", serialNumber)
+	}
+
+	if !record.Revoked {
+		record.Revoked = true
+		record.RevokedAt = revokedAt
+	}
+	record.RevocationReason = reason
+
+	return nil
+}
+
+// ListRevoked list all revoked certificates
+func (s *MemoryStore) ListRevoked(_ context.Context) ([]*CertRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []*CertRecord
+	for _, record := range s.certs {
+		if record.Revoked {
+			cp := *record
+			records = append(records, &cp)
+		}
+	}
+
+	return records, nil
+}
+
+// NextCRLNumber allocate monotonically increasing CRL number
+func (s *MemoryStore) NextCRLNumber(_ context.Context) (*big.Int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.crlNumber = new(big.Int).Add(s.crlNumber, big.NewInt(1))
+	return new(big.Int).Set(s.crlNumber), nil
+}
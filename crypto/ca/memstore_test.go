@@ -0,0 +1,49 @@
+package ca
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	sn1, err := store.NextSerialNumber(ctx)
+	require.NoError(t, err)
+	sn2, err := store.NextSerialNumber(ctx)
+	require.NoError(t, err)
+	require.NotEqual(t, 0, sn1.Cmp(sn2))
+	require.Positive(t, sn1.Sign())
+	require.LessOrEqual(t, len(sn1.Bytes()), 20)
+
+	_, err = store.GetCert(ctx, sn1)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	notAfter := time.Now().Add(time.Hour)
+	require.NoError(t, store.SaveCert(ctx, &CertRecord{SerialNumber: sn1, Der: []byte("cert"), NotAfter: notAfter}))
+	require.Error(t, store.SaveCert(ctx, &CertRecord{SerialNumber: sn1}))
+
+	record, err := store.GetCert(ctx, sn1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("cert"), record.Der)
+
+	revokedAt := time.Now()
+	require.NoError(t, store.Revoke(ctx, sn1, RevocationReasonSuperseded, revokedAt))
+	require.NoError(t, store.Revoke(ctx, sn1, RevocationReasonKeyCompromise, revokedAt.Add(time.Hour)))
+	revoked, err := store.ListRevoked(ctx)
+	require.NoError(t, err)
+	require.Len(t, revoked, 1)
+	require.Equal(t, RevocationReasonKeyCompromise, revoked[0].RevocationReason)
+	require.True(t, revokedAt.Equal(revoked[0].RevokedAt))
+
+	n1, err := store.NextCRLNumber(ctx)
+	require.NoError(t, err)
+	n2, err := store.NextCRLNumber(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n2.Cmp(n1))
+}
@@ -0,0 +1,219 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// oidEmailAddress oid of emailAddress attribute in subject, refer to RFC 5280 4.1.2.6
+var oidEmailAddress = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+
+const (
+	defaultPolicyMaxValidity = 90 * 24 * time.Hour
+	defaultPolicyMinRSABits  = 2048
+)
+
+// Policy restrictions on certificates signed by CA
+//
+// zero value is the most restrictive policy,
+// which reject any CSR that contains SANs.
+type Policy struct {
+	// AllowedDNSNames allowed DNS SANs,
+	// `example.com` match itself only,
+	// `*.example.com` match any subdomain of example.com.
+	AllowedDNSNames []string
+	// AllowedEmailDomains allowed domains of email SANs,
+	// support wildcard like AllowedDNSNames.
+	AllowedEmailDomains []string
+	// AllowedIPNets allowed IP SANs
+	AllowedIPNets []*net.IPNet
+	// AllowedURIPrefixes allowed prefixes of URI SANs, like `spiffe://example.com/`
+	AllowedURIPrefixes []string
+	// MaxValidity max validity of certificate, default to 90 days
+	MaxValidity time.Duration
+	// AllowedKeyAlgorithms allowed public key algorithms of CSR,
+	// default to RSA, ECDSA and Ed25519
+	AllowedKeyAlgorithms []x509.PublicKeyAlgorithm
+	// MinRSABits minimal bits of RSA key, default to 2048
+	MinRSABits int
+	// AllowCA whether allow to sign intermediate CA
+	AllowCA bool
+}
+
+func (p *Policy) maxValidity() time.Duration {
+	if p.MaxValidity <= 0 {
+		return defaultPolicyMaxValidity
+	}
+
+	return p.MaxValidity
+}
+
+// CheckCSR check whether csr is allowed by policy
+//
+// subject's common name is checked as well if it looks like a domain,
+// an email or an IP, since some clients still match hostname against it.
+func (p *Policy) CheckCSR(csr *x509.CertificateRequest) error {
+	if err := p.checkPubkey(csr.PublicKeyAlgorithm, csr.PublicKey); err != nil {
+		return errors.Wrap(err, "check public key")
+	}
+
+	if err := p.checkCommonName(csr.Subject.CommonName); err != nil {
+		return errors.Wrap(err, "check common name")
+	}
+
+	// legacy emailAddress attribute in subject
+	for _, attr := range csr.Subject.Names {
+		if !attr.Type.Equal(oidEmailAddress) {
+			continue
+		}
+
+		addr, ok := attr.Value.(string)
+		if !ok {
+			return errors.Errorf("invalid email address in subject")
+		}
+		if err := p.checkEmail(addr); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, name := range csr.DNSNames {
+		if err := p.checkDNSName(name); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, addr := range csr.EmailAddresses {
+		if err := p.checkEmail(addr); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, ip := range csr.IPAddresses {
+		if err := p.checkIP(ip); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, uri := range csr.URIs {
+		if !slices.ContainsFunc(p.AllowedURIPrefixes, func(prefix string) bool {
+			return strings.HasPrefix(uri.String(), prefix)
+		}) {
+			return errors.Errorf("uri %q is not allowed", uri)
+		}
+	}
+
+	return nil
+}
+
+// checkCommonName check common name by the policy of SAN it looks like,
+// plain names like `laisky` are allowed.
+func (p *Policy) checkCommonName(cn string) error {
+	switch {
+	case cn == "":
+		return nil
+	case strings.Contains(cn, "@"):
+		return p.checkEmail(cn)
+	case net.ParseIP(cn) != nil:
+		return p.checkIP(net.ParseIP(cn))
+	case strings.Contains(cn, "."):
+		return p.checkDNSName(cn)
+	default:
+		return nil
+	}
+}
+
+func (p *Policy) checkDNSName(name string) error {
+	if !slices.ContainsFunc(p.AllowedDNSNames, func(pattern string) bool {
+		return matchDomain(pattern, name)
+	}) {
+		return errors.Errorf("dns name %q is not allowed", name)
+	}
+
+	return nil
+}
+
+func (p *Policy) checkEmail(addr string) error {
+	_, domain, ok := strings.Cut(addr, "@")
+	if !ok || !slices.ContainsFunc(p.AllowedEmailDomains, func(pattern string) bool {
+		return matchDomain(pattern, domain)
+	}) {
+		return errors.Errorf("email %q is not allowed", addr)
+	}
+
+	return nil
+}
+
+func (p *Policy) checkIP(ip net.IP) error {
+	if !slices.ContainsFunc(p.AllowedIPNets, func(ipnet *net.IPNet) bool {
+		return ipnet.Contains(ip)
+	}) {
+		return errors.Errorf("ip %q is not allowed", ip)
+	}
+
+	return nil
+}
+
+// CheckValidity check whether certificate's validity and CA flag are allowed by policy
+func (p *Policy) CheckValidity(notBefore, notAfter time.Time, isCA bool) error {
+	if !notAfter.After(notBefore) {
+		return errors.Errorf("notAfter should be after notBefore")
+	}
+	if notAfter.Sub(notBefore) > p.maxValidity() {
+		return errors.Errorf("validity %s exceeds max validity %s",
+			notAfter.Sub(notBefore), p.maxValidity())
+	}
+	if isCA && !p.AllowCA {
+		return errors.Errorf("CA certificate is not allowed")
+	}
+
+	return nil
+}
+
+func (p *Policy) checkPubkey(algo x509.PublicKeyAlgorithm, pubkey any) error {
+	allowed := p.AllowedKeyAlgorithms
+	if len(allowed) == 0 {
+		allowed = []x509.PublicKeyAlgorithm{x509.RSA, x509.ECDSA, x509.Ed25519}
+	}
+	if !slices.Contains(allowed, algo) {
+		return errors.Errorf("public key algorithm %q is not allowed", algo)
+	}
+
+	minRSABits := p.MinRSABits
+	if minRSABits <= 0 {
+		minRSABits = defaultPolicyMinRSABits
+	}
+
+	switch pubkey := pubkey.(type) {
+	case *rsa.PublicKey:
+		if pubkey.N.BitLen() < minRSABits {
+			return errors.Errorf("rsa key should be at least %d bits", minRSABits)
+		}
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return errors.Errorf("unsupported public key type %T", pubkey)
+	}
+
+	return nil
+}
+
+// matchDomain check whether domain match pattern,
+// `*.example.com` match any subdomain of example.com, but not example.com itself.
+func matchDomain(pattern, domain string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(domain, "."+suffix) &&
+			len(domain) > len(suffix)+1
+	}
+
+	return pattern == domain
+}
@@ -0,0 +1,147 @@
+package ca
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+)
+
+func Test_matchDomain(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		pattern, domain string
+		match           bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "EXAMPLE.com.", true},
+		{"example.com", "www.example.com", false},
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "wwwexample.com", false},
+		{"*.example.com", ".example.com", false},
+	} {
+		require.Equal(t, tc.match, matchDomain(tc.pattern, tc.domain), "%s ~ %s", tc.pattern, tc.domain)
+	}
+}
+
+func TestPolicy_CheckCSR(t *testing.T) {
+	t.Parallel()
+
+	t.Run("key type", func(t *testing.T) {
+		t.Parallel()
+
+		prikey, err := gcrypto.NewRSAPrikey(gcrypto.RSAPrikeyBits2048)
+		require.NoError(t, err)
+		csrDer, err := gcrypto.NewX509CSR(prikey, gcrypto.WithX509CSRCommonName("laisky"))
+		require.NoError(t, err)
+		csr, err := gcrypto.Der2CSR(csrDer)
+		require.NoError(t, err)
+
+		require.NoError(t, new(Policy).CheckCSR(csr))
+		require.ErrorContains(t, (&Policy{MinRSABits: 3072}).CheckCSR(csr), "at least 3072 bits")
+		require.ErrorContains(t,
+			(&Policy{AllowedKeyAlgorithms: []x509.PublicKeyAlgorithm{x509.Ed25519}}).CheckCSR(csr),
+			"is not allowed")
+	})
+
+	t.Run("uri", func(t *testing.T) {
+		t.Parallel()
+
+		prikey, err := gcrypto.NewEd25519Prikey()
+		require.NoError(t, err)
+		csrDer, err := gcrypto.NewX509CSR(prikey,
+			gcrypto.WithX509CSRCommonName("laisky"),
+			gcrypto.WithX509CSRSANS("spiffe://example.com/ns/default"))
+		require.NoError(t, err)
+		csr, err := gcrypto.Der2CSR(csrDer)
+		require.NoError(t, err)
+
+		require.ErrorContains(t, new(Policy).CheckCSR(csr), "is not allowed")
+		require.NoError(t, (&Policy{
+			AllowedURIPrefixes: []string{"spiffe://example.com/"},
+		}).CheckCSR(csr))
+	})
+
+	t.Run("subject", func(t *testing.T) {
+		t.Parallel()
+
+		prikey, err := gcrypto.NewEd25519Prikey()
+		require.NoError(t, err)
+		newCSR := func(subject pkix.Name) *x509.CertificateRequest {
+			der, err := x509.CreateCertificateRequest(rand.Reader,
+				&x509.CertificateRequest{Subject: subject}, prikey)
+			require.NoError(t, err)
+			csr, err := gcrypto.Der2CSR(der)
+			require.NoError(t, err)
+			return csr
+		}
+
+		_, ipnet, err := net.ParseCIDR("10.0.0.0/8")
+		require.NoError(t, err)
+		policy := &Policy{
+			AllowedDNSNames:     []string{"*.example.com"},
+			AllowedEmailDomains: []string{"example.com"},
+			AllowedIPNets:       []*net.IPNet{ipnet},
+		}
+
+		for cn, allowed := range map[string]bool{
+			"laisky":              true,
+			"www.example.com":     true,
+			"www.evil.com":        false,
+			"laisky@example.com":  true,
+			"laisky@evil.com":     false,
+			"10.1.2.3":            true,
+			"192.168.1.1":         false,
+			"www.example.com.cn":  false,
+			"example.com@evil.cn": false,
+		} {
+			err := policy.CheckCSR(newCSR(pkix.Name{CommonName: cn}))
+			if allowed {
+				require.NoError(t, err, cn)
+			} else {
+				require.ErrorContains(t, err, "is not allowed", cn)
+			}
+		}
+
+		// zero value policy reject any domain in common name
+		require.ErrorContains(t, new(Policy).CheckCSR(newCSR(pkix.Name{CommonName: "www.example.com"})),
+			"is not allowed")
+
+		// legacy emailAddress attribute
+		for addr, allowed := range map[string]bool{
+			"laisky@example.com": true,
+			"laisky@evil.com":    false,
+		} {
+			err := policy.CheckCSR(newCSR(pkix.Name{
+				CommonName: "laisky",
+				ExtraNames: []pkix.AttributeTypeAndValue{{Type: oidEmailAddress, Value: addr}},
+			}))
+			if allowed {
+				require.NoError(t, err, addr)
+			} else {
+				require.ErrorContains(t, err, "is not allowed", addr)
+			}
+		}
+	})
+}
+
+func TestPolicy_CheckValidity(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	p := new(Policy)
+	require.NoError(t, p.CheckValidity(now, now.Add(90*24*time.Hour), false))
+	require.Error(t, p.CheckValidity(now, now.Add(91*24*time.Hour), false))
+	require.Error(t, p.CheckValidity(now, now, false))
+	require.Error(t, p.CheckValidity(now, now.Add(time.Hour), true))
+	require.NoError(t, (&Policy{AllowCA: true}).CheckValidity(now, now.Add(time.Hour), true))
+}
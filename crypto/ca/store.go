@@ -0,0 +1,113 @@
+package ca
+
+import (
+	"context"
+	"crypto/x509"
+	"math/big"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// ErrNotFound certificate not found in store
+var ErrNotFound = errors.New("not found")
+
+// RevocationReason reason code of revocation, refer to RFC-5280 5.3.1
+type RevocationReason int
+
+const (
+	// RevocationReasonUnspecified unspecified
+	RevocationReasonUnspecified RevocationReason = 0
+	// RevocationReasonKeyCompromise key compromise
+	RevocationReasonKeyCompromise RevocationReason = 1
+	// RevocationReasonCACompromise CA compromise
+	RevocationReasonCACompromise RevocationReason = 2
+	// RevocationReasonAffiliationChanged affiliation changed
+	RevocationReasonAffiliationChanged RevocationReason = 3
+	// RevocationReasonSuperseded superseded
+	RevocationReasonSuperseded RevocationReason = 4
+	// RevocationReasonCessationOfOperation cessation of operation
+	RevocationReasonCessationOfOperation RevocationReason = 5
+	// RevocationReasonCertificateHold certificate hold
+	RevocationReasonCertificateHold RevocationReason = 6
+	// RevocationReasonRemoveFromCRL remove from CRL, only used in delta CRL
+	RevocationReasonRemoveFromCRL RevocationReason = 8
+	// RevocationReasonPrivilegeWithdrawn privilege withdrawn
+	RevocationReasonPrivilegeWithdrawn RevocationReason = 9
+	// RevocationReasonAACompromise AA compromise
+	RevocationReasonAACompromise RevocationReason = 10
+)
+
+// String name of reason
+func (r RevocationReason) String() string {
+	switch r {
+	case RevocationReasonUnspecified:
+		return "unspecified"
+	case RevocationReasonKeyCompromise:
+		return "keyCompromise"
+	case RevocationReasonCACompromise:
+		return "cACompromise"
+	case RevocationReasonAffiliationChanged:
+		return "affiliationChanged"
+	case RevocationReasonSuperseded:
+		return "superseded"
+	case RevocationReasonCessationOfOperation:
+		return "cessationOfOperation"
+	case RevocationReasonCertificateHold:
+		return "certificateHold"
+	case RevocationReasonRemoveFromCRL:
+		return "removeFromCRL"
+	case RevocationReasonPrivilegeWithdrawn:
+		return "privilegeWithdrawn"
+	case RevocationReasonAACompromise:
+		return "aACompromise"
+	default:
+		return "unknown"
+	}
+}
+
+// CertRecord issued certificate in store
+type CertRecord struct {
+	// SerialNumber serial number of certificate
+	SerialNumber *big.Int
+	// Der certificate in DER
+	Der []byte
+	// NotAfter expiration of certificate
+	NotAfter time.Time
+	// Revoked whether certificate is revoked
+	Revoked bool
+	// RevokedAt time of revocation
+	RevokedAt time.Time
+	// RevocationReason reason of revocation
+	RevocationReason RevocationReason
+}
+
+// Cert parse certificate
+func (r *CertRecord) Cert() (*x509.Certificate, error) {
+	cert, err := x509.ParseCertificate(r.Der)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse certificate")
+	}
+
+	return cert, nil
+}
+
+// Store persistence of CA
+//
+// all methods should be safe for concurrent use.
+type Store interface {
+	// NextSerialNumber allocate an unique serial number for new certificate
+	NextSerialNumber(ctx context.Context) (*big.Int, error)
+	// SaveCert save issued certificate
+	SaveCert(ctx context.Context, record *CertRecord) error
+	// GetCert get certificate by serial number,
+	// return ErrNotFound if not exists
+	GetCert(ctx context.Context, serialNumber *big.Int) (*CertRecord, error)
+	// Revoke mark certificate as revoked,
+	// return ErrNotFound if not exists
+	Revoke(ctx context.Context, serialNumber *big.Int, reason RevocationReason, revokedAt time.Time) error
+	// ListRevoked list all revoked certificates
+	ListRevoked(ctx context.Context) ([]*CertRecord, error)
+	// NextCRLNumber allocate monotonically increasing CRL number
+	NextCRLNumber(ctx context.Context) (*big.Int, error)
+}
@@ -0,0 +1,645 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+// Pure go certificate chain builder and verifier.
+//
+// unlike x509.Certificate.Verify, every failure of every candidate path
+// will be reported as ChainFailure, so caller can tell why chain is rejected.
+
+const (
+	defaultVerifyChainMaxDepth = 10
+	// maxChainSignatureChecks max number of candidate issuers considered
+	// in one VerifyChain, same as x509.Certificate.Verify
+	maxChainSignatureChecks = 100
+)
+
+// ChainFailureReason reason of chain verification failure
+type ChainFailureReason int
+
+const (
+	// ChainFailureUnknownAuthority no issuer found in intermediates or roots
+	ChainFailureUnknownAuthority ChainFailureReason = iota + 1
+	// ChainFailureSignature signature does not match issuer's public key
+	ChainFailureSignature
+	// ChainFailureExpired certificate is expired
+	ChainFailureExpired
+	// ChainFailureNotYetValid certificate is not yet valid
+	ChainFailureNotYetValid
+	// ChainFailureNotCA issuer is not a CA, or lacks CertSign key usage
+	ChainFailureNotCA
+	// ChainFailurePathLen path length constraint of issuer exceeded
+	ChainFailurePathLen
+	// ChainFailureNameConstraint name constraints of issuer are violated
+	ChainFailureNameConstraint
+	// ChainFailureExtKeyUsage required ext key usage is not allowed
+	ChainFailureExtKeyUsage
+	// ChainFailureHostname leaf certificate does not match hostname
+	ChainFailureHostname
+	// ChainFailureRevoked certificate is revoked by CRL
+	ChainFailureRevoked
+	// ChainFailureCRL CRL is invalid, expired or missing
+	ChainFailureCRL
+	// ChainFailureTooDeep path is longer than max depth
+	ChainFailureTooDeep
+	// ChainFailureCriticalExtension certificate has unhandled critical extensions
+	ChainFailureCriticalExtension
+	// ChainFailureTooManySignatures too many candidate issuers to check
+	ChainFailureTooManySignatures
+)
+
+// String name of reason
+func (r ChainFailureReason) String() string {
+	switch r {
+	case ChainFailureUnknownAuthority:
+		return "unknown authority"
+	case ChainFailureSignature:
+		return "invalid signature"
+	case ChainFailureExpired:
+		return "expired"
+	case ChainFailureNotYetValid:
+		return "not yet valid"
+	case ChainFailureNotCA:
+		return "issuer is not ca"
+	case ChainFailurePathLen:
+		return "path length exceeded"
+	case ChainFailureNameConstraint:
+		return "name constraint violated"
+	case ChainFailureExtKeyUsage:
+		return "ext key usage not allowed"
+	case ChainFailureHostname:
+		return "hostname mismatch"
+	case ChainFailureRevoked:
+		return "revoked"
+	case ChainFailureCRL:
+		return "crl unavailable"
+	case ChainFailureTooDeep:
+		return "path too deep"
+	case ChainFailureCriticalExtension:
+		return "unhandled critical extension"
+	case ChainFailureTooManySignatures:
+		return "too many signature checks"
+	default:
+		return "unknown"
+	}
+}
+
+// ChainFailure one failure found when verifying candidate path
+type ChainFailure struct {
+	// Cert certificate that failed
+	Cert *x509.Certificate
+	// Depth position of Cert in candidate path, leaf is 0
+	Depth  int
+	Reason ChainFailureReason
+	Detail string
+}
+
+// String readable failure
+func (f ChainFailure) String() string {
+	return fmt.Sprintf("depth %d %q: %s: %s", f.Depth, f.Cert.Subject.String(), f.Reason, f.Detail)
+}
+
+// ChainVerifyError all failures of all candidate paths,
+// returned by VerifyChain when no valid path found.
+type ChainVerifyError struct {
+	Failures []ChainFailure
+}
+
+// Error implement error
+func (e *ChainVerifyError) Error() string {
+	msgs := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		msgs = append(msgs, f.String())
+	}
+
+	return "no valid certificate chain: " + strings.Join(msgs, "; ")
+}
+
+// Has whether any failure is of reason
+func (e *ChainVerifyError) Has(reason ChainFailureReason) bool {
+	return slices.ContainsFunc(e.Failures, func(f ChainFailure) bool {
+		return f.Reason == reason
+	})
+}
+
+func (e *ChainVerifyError) add(f ChainFailure) {
+	if !slices.ContainsFunc(e.Failures, func(got ChainFailure) bool {
+		return got.Cert.Equal(f.Cert) &&
+			got.Depth == f.Depth &&
+			got.Reason == f.Reason &&
+			got.Detail == f.Detail
+	}) {
+		e.Failures = append(e.Failures, f)
+	}
+}
+
+type verifyChainOption struct {
+	now        time.Time
+	dnsName    string
+	keyUsages  []x509.ExtKeyUsage
+	crls       []*x509.RevocationList
+	requireCRL bool
+	maxDepth   int
+}
+
+func (o *verifyChainOption) fillDefault() *verifyChainOption {
+	o.now = gutils.Clock.GetUTCNow()
+	o.keyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	o.maxDepth = defaultVerifyChainMaxDepth
+	return o
+}
+
+func (o *verifyChainOption) applyOpts(opts ...VerifyChainOption) (*verifyChainOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// VerifyChainOption optional arguments for VerifyChain
+type VerifyChainOption func(*verifyChainOption) error
+
+// WithVerifyChainTime verify validity windows at t
+//
+// default to now
+func WithVerifyChainTime(t time.Time) VerifyChainOption {
+	return func(o *verifyChainOption) error {
+		if t.IsZero() {
+			return errors.Errorf("time should not be zero")
+		}
+
+		o.now = t
+		return nil
+	}
+}
+
+// WithVerifyChainDNSName check leaf certificate matches hostname or ip
+func WithVerifyChainDNSName(name string) VerifyChainOption {
+	return func(o *verifyChainOption) error {
+		o.dnsName = name
+		return nil
+	}
+}
+
+// WithVerifyChainKeyUsages set acceptable ext key usages,
+// chain is valid if any of them is allowed by every certificate.
+//
+// default to ServerAuth, use x509.ExtKeyUsageAny to skip checking.
+func WithVerifyChainKeyUsages(usages ...x509.ExtKeyUsage) VerifyChainOption {
+	return func(o *verifyChainOption) error {
+		if len(usages) == 0 {
+			return errors.Errorf("usages should not be empty")
+		}
+
+		o.keyUsages = usages
+		return nil
+	}
+}
+
+// WithVerifyChainCRLs check revocation by CRLs
+//
+// CRL is matched by issuer, and verified by VerifyCRL.
+// expired CRL or CRL with invalid signature will be reported as ChainFailureCRL.
+func WithVerifyChainCRLs(crls ...*x509.RevocationList) VerifyChainOption {
+	return func(o *verifyChainOption) error {
+		o.crls = append(o.crls, crls...)
+		return nil
+	}
+}
+
+// WithVerifyChainRequireCRL every certificate except root must be covered by CRL
+func WithVerifyChainRequireCRL() VerifyChainOption {
+	return func(o *verifyChainOption) error {
+		o.requireCRL = true
+		return nil
+	}
+}
+
+// WithVerifyChainMaxDepth set max number of certificates in path
+//
+// default to 10
+func WithVerifyChainMaxDepth(depth int) VerifyChainOption {
+	return func(o *verifyChainOption) error {
+		if depth < 1 {
+			return errors.Errorf("depth should be positive")
+		}
+
+		o.maxDepth = depth
+		return nil
+	}
+}
+
+// VerifyChain build and verify certificate paths from leaf to roots
+//
+// pure go alternative of Tongsuo.VerifyCertsChain.
+// paths are built across cross-signed intermediates,
+// every candidate path is checked for signature, validity window,
+// basic constraints, path length, name constraints, ext key usage and CRLs.
+//
+// # Returns
+//   - chains: all valid paths, each is ordered from leaf to root
+//   - err: *ChainVerifyError that contains every failure if no valid path found
+func VerifyChain(leaf *x509.Certificate,
+	intermediates, roots []*x509.Certificate,
+	opts ...VerifyChainOption) (chains [][]*x509.Certificate, err error) {
+	opt, err := new(verifyChainOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	if leaf == nil {
+		return nil, errors.Errorf("leaf should not be empty")
+	}
+	if len(roots) == 0 {
+		return nil, errors.Errorf("roots should not be empty")
+	}
+
+	v := &chainVerifier{
+		opt:           opt,
+		intermediates: intermediates,
+		roots:         roots,
+		verr:          new(ChainVerifyError),
+		sigResults:    make(map[[2]*x509.Certificate]error),
+	}
+
+	for _, path := range v.buildPaths([]*x509.Certificate{leaf}) {
+		if v.checkPath(path) {
+			chains = append(chains, path)
+		}
+	}
+
+	if len(chains) == 0 {
+		return nil, v.verr
+	}
+
+	return chains, nil
+}
+
+type chainVerifier struct {
+	opt           *verifyChainOption
+	intermediates []*x509.Certificate
+	roots         []*x509.Certificate
+	verr          *ChainVerifyError
+
+	// sigChecks number of candidate issuers considered
+	sigChecks    int
+	sigExhausted bool
+	// sigResults result of checked signatures, key is (cert, issuer)
+	sigResults map[[2]*x509.Certificate]error
+}
+
+func (v *chainVerifier) isRoot(cert *x509.Certificate) bool {
+	return slices.ContainsFunc(v.roots, cert.Equal)
+}
+
+// buildPaths find all paths from path[len(path)-1] to any root by DFS
+func (v *chainVerifier) buildPaths(path []*x509.Certificate) (paths [][]*x509.Certificate) {
+	cert := path[len(path)-1]
+	depth := len(path) - 1
+	if v.isRoot(cert) {
+		return [][]*x509.Certificate{slices.Clone(path)}
+	}
+	if len(path) >= v.opt.maxDepth {
+		v.verr.add(ChainFailure{
+			Cert:   cert,
+			Depth:  depth,
+			Reason: ChainFailureTooDeep,
+			Detail: fmt.Sprintf("exceeds max depth %d", v.opt.maxDepth),
+		})
+		return nil
+	}
+
+	var found bool
+	for _, candidates := range [][]*x509.Certificate{v.roots, v.intermediates} {
+		for _, issuer := range candidates {
+			if !bytes.Equal(issuer.RawSubject, cert.RawIssuer) {
+				continue
+			}
+			if len(cert.AuthorityKeyId) != 0 && len(issuer.SubjectKeyId) != 0 &&
+				!bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId) {
+				continue
+			}
+
+			// avoid loop, cross-signed certificates share subject and key
+			if slices.ContainsFunc(path, func(c *x509.Certificate) bool {
+				return c.Equal(issuer) ||
+					(bytes.Equal(c.RawSubject, issuer.RawSubject) &&
+						bytes.Equal(c.RawSubjectPublicKeyInfo, issuer.RawSubjectPublicKeyInfo))
+			}) {
+				continue
+			}
+
+			found = true
+			if v.sigChecks >= maxChainSignatureChecks {
+				// only report once
+				if !v.sigExhausted {
+					v.sigExhausted = true
+					v.verr.add(ChainFailure{
+						Cert:   cert,
+						Depth:  depth,
+						Reason: ChainFailureTooManySignatures,
+						Detail: fmt.Sprintf("exceeds %d signature checks", maxChainSignatureChecks),
+					})
+				}
+
+				return paths
+			}
+
+			if err := v.checkSignature(cert, issuer); err != nil {
+				v.verr.add(ChainFailure{
+					Cert:   cert,
+					Depth:  depth,
+					Reason: ChainFailureSignature,
+					Detail: fmt.Sprintf("issuer %q: %s", issuer.Subject.String(), err.Error()),
+				})
+				continue
+			}
+
+			paths = append(paths, v.buildPaths(append(path, issuer))...)
+		}
+	}
+
+	if !found {
+		v.verr.add(ChainFailure{
+			Cert:   cert,
+			Depth:  depth,
+			Reason: ChainFailureUnknownAuthority,
+			Detail: fmt.Sprintf("issuer %q not found", cert.Issuer.String()),
+		})
+	}
+
+	return paths
+}
+
+// checkSignature check cert is signed by issuer, result is cached,
+// every call counts toward maxChainSignatureChecks
+func (v *chainVerifier) checkSignature(cert, issuer *x509.Certificate) error {
+	v.sigChecks++
+	key := [2]*x509.Certificate{cert, issuer}
+	if err, ok := v.sigResults[key]; ok {
+		return err
+	}
+
+	err := issuer.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature)
+	v.sigResults[key] = err
+	return err
+}
+
+// checkPath check every certificate in path, record failures
+func (v *chainVerifier) checkPath(path []*x509.Certificate) (ok bool) {
+	ok = true
+	fail := func(depth int, reason ChainFailureReason, detail string) {
+		ok = false
+		v.verr.add(ChainFailure{
+			Cert:   path[depth],
+			Depth:  depth,
+			Reason: reason,
+			Detail: detail,
+		})
+	}
+
+	for depth, cert := range path {
+		if v.opt.now.Before(cert.NotBefore) {
+			fail(depth, ChainFailureNotYetValid,
+				"not before "+cert.NotBefore.Format(time.RFC3339))
+		}
+		if v.opt.now.After(cert.NotAfter) {
+			fail(depth, ChainFailureExpired,
+				"not after "+cert.NotAfter.Format(time.RFC3339))
+		}
+		// RFC 5280 4.2, must reject certificate with unrecognized critical extension
+		for _, oid := range cert.UnhandledCriticalExtensions {
+			fail(depth, ChainFailureCriticalExtension, "extension "+oid.String())
+		}
+
+		if depth == 0 {
+			continue
+		}
+
+		// issuer checks
+		if !cert.BasicConstraintsValid || !cert.IsCA {
+			fail(depth, ChainFailureNotCA, "basic constraints is not ca")
+		}
+		if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+			fail(depth, ChainFailureNotCA, "key usage lacks cert sign")
+		}
+
+		// number of intermediate CAs below this issuer
+		if below := depth - 1; cert.BasicConstraintsValid &&
+			(cert.MaxPathLen > 0 || cert.MaxPathLenZero) &&
+			below > cert.MaxPathLen {
+			fail(depth, ChainFailurePathLen,
+				fmt.Sprintf("max path len %d, got %d", cert.MaxPathLen, below))
+		}
+
+		for i := 0; i < depth; i++ {
+			if err := checkNameConstraints(cert, path[i]); err != nil {
+				fail(i, ChainFailureNameConstraint,
+					fmt.Sprintf("issuer %q: %s", cert.Subject.String(), err.Error()))
+			}
+		}
+	}
+
+	if err := checkChainExtKeyUsage(path, v.opt.keyUsages); err != nil {
+		fail(0, ChainFailureExtKeyUsage, err.Error())
+	}
+
+	if v.opt.dnsName != "" {
+		if err := path[0].VerifyHostname(v.opt.dnsName); err != nil {
+			fail(0, ChainFailureHostname, err.Error())
+		}
+	}
+
+	// revocation, root is trusted directly
+	for depth := 0; depth < len(path)-1; depth++ {
+		reason, detail := v.checkRevocation(path[depth], path[depth+1])
+		if reason != 0 {
+			fail(depth, reason, detail)
+		}
+	}
+
+	return ok
+}
+
+// checkRevocation check cert by CRLs issued by issuer
+func (v *chainVerifier) checkRevocation(cert, issuer *x509.Certificate) (ChainFailureReason, string) {
+	var (
+		covered bool
+		lastErr string
+	)
+	for _, crl := range v.opt.crls {
+		if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) {
+			continue
+		}
+		if err := VerifyCRL(issuer, crl); err != nil {
+			lastErr = "verify crl: " + err.Error()
+			continue
+		}
+		if !crl.NextUpdate.IsZero() && v.opt.now.After(crl.NextUpdate) {
+			lastErr = "crl expired at " + crl.NextUpdate.Format(time.RFC3339)
+			continue
+		}
+
+		covered = true
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 &&
+				!entry.RevocationTime.After(v.opt.now) {
+				return ChainFailureRevoked, fmt.Sprintf("revoked at %s, reason %d",
+					entry.RevocationTime.Format(time.RFC3339), entry.ReasonCode)
+			}
+		}
+	}
+
+	switch {
+	case covered:
+		return 0, ""
+	case lastErr != "":
+		return ChainFailureCRL, lastErr
+	case v.opt.requireCRL:
+		return ChainFailureCRL, "no crl of issuer " + issuer.Subject.String()
+	default:
+		return 0, ""
+	}
+}
+
+// checkChainExtKeyUsage every certificate in path should allow
+// at least one of usages, certificates without EKU allow any.
+func checkChainExtKeyUsage(path []*x509.Certificate, usages []x509.ExtKeyUsage) error {
+	if slices.Contains(usages, x509.ExtKeyUsageAny) {
+		return nil
+	}
+
+	remain := slices.Clone(usages)
+	for _, cert := range path {
+		if len(cert.ExtKeyUsage) == 0 && len(cert.UnknownExtKeyUsage) == 0 {
+			continue
+		}
+		if slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageAny) {
+			continue
+		}
+
+		remain = slices.DeleteFunc(remain, func(usage x509.ExtKeyUsage) bool {
+			return !slices.Contains(cert.ExtKeyUsage, usage)
+		})
+		if len(remain) == 0 {
+			return errors.Errorf("certificate %q does not allow any of %v",
+				cert.Subject.String(), ReadableX509ExtKeyUsage(usages))
+		}
+	}
+
+	return nil
+}
+
+// checkNameConstraints check SANs of cert against name constraints of issuer,
+// refer to RFC-5280 4.2.1.10
+func checkNameConstraints(issuer, cert *x509.Certificate) error {
+	for _, name := range cert.DNSNames {
+		if err := checkNameConstraint(name, "dns name",
+			issuer.PermittedDNSDomains, issuer.ExcludedDNSDomains, matchDomainConstraint); err != nil {
+			return err
+		}
+	}
+
+	for _, email := range cert.EmailAddresses {
+		if err := checkNameConstraint(email, "email",
+			issuer.PermittedEmailAddresses, issuer.ExcludedEmailAddresses, matchEmailConstraint); err != nil {
+			return err
+		}
+	}
+
+	for _, uri := range cert.URIs {
+		if err := checkNameConstraint(uri.String(), "uri",
+			issuer.PermittedURIDomains, issuer.ExcludedURIDomains, matchURIConstraint); err != nil {
+			return err
+		}
+	}
+
+	for _, ip := range cert.IPAddresses {
+		if err := checkNameConstraint(ip.String(), "ip",
+			issuer.PermittedIPRanges, issuer.ExcludedIPRanges,
+			func(ip string, ipnet *net.IPNet) bool {
+				return ipnet.Contains(net.ParseIP(ip))
+			}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkNameConstraint[T any](name, kind string,
+	permitted, excluded []T, match func(string, T) bool) error {
+	for _, c := range excluded {
+		if match(name, c) {
+			return errors.Errorf("%s %q is excluded by %v", kind, name, c)
+		}
+	}
+
+	if len(permitted) != 0 && !slices.ContainsFunc(permitted, func(c T) bool {
+		return match(name, c)
+	}) {
+		return errors.Errorf("%s %q is not permitted", kind, name)
+	}
+
+	return nil
+}
+
+// matchDomainConstraint `example.com` matches itself and subdomains,
+// `.example.com` matches subdomains only
+func matchDomainConstraint(domain, constraint string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	constraint = strings.ToLower(constraint)
+	if constraint == "" {
+		return true
+	}
+
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(domain, constraint)
+	}
+
+	return domain == constraint || strings.HasSuffix(domain, "."+constraint)
+}
+
+// matchEmailConstraint `a@example.com` matches mailbox,
+// `example.com` matches host, `.example.com` matches subdomains
+func matchEmailConstraint(email, constraint string) bool {
+	if strings.Contains(constraint, "@") {
+		return strings.EqualFold(email, constraint)
+	}
+
+	_, host, ok := strings.Cut(email, "@")
+	if !ok {
+		return false
+	}
+	if strings.HasPrefix(constraint, ".") {
+		return matchDomainConstraint(host, constraint)
+	}
+
+	return strings.EqualFold(host, constraint)
+}
+
+// matchURIConstraint match host of uri by domain constraint
+func matchURIConstraint(uri, constraint string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Hostname() == "" || net.ParseIP(u.Hostname()) != nil {
+		return false
+	}
+
+	return matchDomainConstraint(u.Hostname(), constraint)
+}
@@ -0,0 +1,408 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/require"
+)
+
+type testChainNode struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// testChainCert sign certificate by parent, self-signed if parent is nil.
+// key will be generated if key is nil.
+func testChainCert(t *testing.T, tmpl *x509.Certificate,
+	parent *testChainNode, key *ecdsa.PrivateKey) *testChainNode {
+	t.Helper()
+
+	var err error
+	if key == nil {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl.SerialNumber = serial
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = time.Now().Add(24 * time.Hour)
+	}
+	if tmpl.IsCA {
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+
+	parentCert, parentKey := tmpl, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testChainNode{cert: cert, key: key}
+}
+
+func testLeafTmpl(names ...string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: names[0]},
+		DNSNames:    names,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}
+}
+
+func requireChainFailure(t *testing.T, err error, reason ChainFailureReason, depth int) {
+	t.Helper()
+
+	var verr *ChainVerifyError
+	require.True(t, errors.As(err, &verr), err)
+	require.True(t, verr.Has(reason), verr.Error())
+	for _, f := range verr.Failures {
+		if f.Reason == reason {
+			require.Equal(t, depth, f.Depth, f.String())
+			return
+		}
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	t.Parallel()
+
+	root := testChainCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "root"}, IsCA: true}, nil, nil)
+	inter := testChainCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "inter"}, IsCA: true}, root, nil)
+	leaf := testChainCert(t, testLeafTmpl("www.example.com"), inter, nil)
+	roots := []*x509.Certificate{root.cert}
+	inters := []*x509.Certificate{inter.cert}
+
+	t.Run("valid", func(t *testing.T) {
+		t.Parallel()
+		chains, err := VerifyChain(leaf.cert, inters, roots, WithVerifyChainDNSName("www.example.com"))
+		require.NoError(t, err)
+		require.Len(t, chains, 1)
+		require.Equal(t, []*x509.Certificate{leaf.cert, inter.cert, root.cert}, chains[0])
+	})
+
+	t.Run("invalid args", func(t *testing.T) {
+		t.Parallel()
+		_, err := VerifyChain(nil, inters, roots)
+		require.Error(t, err)
+		_, err = VerifyChain(leaf.cert, inters, nil)
+		require.Error(t, err)
+		_, err = VerifyChain(leaf.cert, inters, roots, WithVerifyChainMaxDepth(0))
+		require.Error(t, err)
+	})
+
+	t.Run("unknown authority", func(t *testing.T) {
+		t.Parallel()
+		_, err := VerifyChain(leaf.cert, nil, roots)
+		requireChainFailure(t, err, ChainFailureUnknownAuthority, 0)
+
+		other := testChainCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "root"}, IsCA: true}, nil, nil)
+		_, err = VerifyChain(leaf.cert, inters, []*x509.Certificate{other.cert})
+		requireChainFailure(t, err, ChainFailureUnknownAuthority, 1)
+
+		// same subject and key id, but different key
+		forged := testChainCert(t, &x509.Certificate{
+			Subject:      pkix.Name{CommonName: "root"},
+			SubjectKeyId: root.cert.SubjectKeyId,
+			IsCA:         true,
+		}, nil, nil)
+		_, err = VerifyChain(leaf.cert, inters, []*x509.Certificate{forged.cert})
+		requireChainFailure(t, err, ChainFailureSignature, 1)
+	})
+
+	t.Run("validity", func(t *testing.T) {
+		t.Parallel()
+		_, err := VerifyChain(leaf.cert, inters, roots,
+			WithVerifyChainTime(time.Now().Add(48*time.Hour)))
+		requireChainFailure(t, err, ChainFailureExpired, 0)
+
+		_, err = VerifyChain(leaf.cert, inters, roots,
+			WithVerifyChainTime(time.Now().Add(-48*time.Hour)))
+		requireChainFailure(t, err, ChainFailureNotYetValid, 0)
+	})
+
+	t.Run("hostname", func(t *testing.T) {
+		t.Parallel()
+		_, err := VerifyChain(leaf.cert, inters, roots, WithVerifyChainDNSName("www.other.com"))
+		requireChainFailure(t, err, ChainFailureHostname, 0)
+	})
+
+	t.Run("not ca", func(t *testing.T) {
+		t.Parallel()
+		sub := testChainCert(t, testLeafTmpl("sub.example.com"), leaf, nil)
+		_, err := VerifyChain(sub.cert, []*x509.Certificate{leaf.cert, inter.cert}, roots)
+		requireChainFailure(t, err, ChainFailureNotCA, 1)
+	})
+
+	t.Run("path len", func(t *testing.T) {
+		t.Parallel()
+		root := testChainCert(t, &x509.Certificate{
+			Subject:        pkix.Name{CommonName: "root"},
+			IsCA:           true,
+			MaxPathLenZero: true,
+		}, nil, nil)
+		inter := testChainCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "inter"}, IsCA: true}, root, nil)
+		leaf := testChainCert(t, testLeafTmpl("www.example.com"), inter, nil)
+
+		_, err := VerifyChain(leaf.cert, []*x509.Certificate{inter.cert}, []*x509.Certificate{root.cert})
+		requireChainFailure(t, err, ChainFailurePathLen, 2)
+	})
+
+	t.Run("name constraints", func(t *testing.T) {
+		t.Parallel()
+		_, ipnet, err := net.ParseCIDR("10.0.0.0/8")
+		require.NoError(t, err)
+		inter := testChainCert(t, &x509.Certificate{
+			Subject:             pkix.Name{CommonName: "constrained"},
+			IsCA:                true,
+			PermittedDNSDomains: []string{"example.com"},
+			ExcludedDNSDomains:  []string{"secret.example.com"},
+			PermittedIPRanges:   []*net.IPNet{ipnet},
+		}, root, nil)
+		inters := []*x509.Certificate{inter.cert}
+
+		ok := testChainCert(t, testLeafTmpl("www.example.com", "example.com"), inter, nil)
+		_, err = VerifyChain(ok.cert, inters, roots)
+		require.NoError(t, err)
+
+		for _, name := range []string{"www.other.com", "a.secret.example.com", "badexample.com"} {
+			bad := testChainCert(t, testLeafTmpl(name), inter, nil)
+			_, err = VerifyChain(bad.cert, inters, roots)
+			requireChainFailure(t, err, ChainFailureNameConstraint, 0)
+		}
+
+		tmpl := testLeafTmpl("www.example.com")
+		tmpl.IPAddresses = []net.IP{net.ParseIP("192.168.1.1")}
+		bad := testChainCert(t, tmpl, inter, nil)
+		_, err = VerifyChain(bad.cert, inters, roots)
+		requireChainFailure(t, err, ChainFailureNameConstraint, 0)
+	})
+
+	t.Run("ext key usage", func(t *testing.T) {
+		t.Parallel()
+		inter := testChainCert(t, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "client-only"},
+			IsCA:        true,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, root, nil)
+		leaf := testChainCert(t, testLeafTmpl("www.example.com"), inter, nil)
+		inters := []*x509.Certificate{inter.cert}
+
+		_, err := VerifyChain(leaf.cert, inters, roots)
+		requireChainFailure(t, err, ChainFailureExtKeyUsage, 0)
+
+		_, err = VerifyChain(leaf.cert, inters, roots,
+			WithVerifyChainKeyUsages(x509.ExtKeyUsageAny))
+		require.NoError(t, err)
+	})
+
+	t.Run("cross signed", func(t *testing.T) {
+		t.Parallel()
+		rootA := testChainCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "root-a"}, IsCA: true}, nil, nil)
+		rootB := testChainCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "root-b"}, IsCA: true}, nil, nil)
+
+		// same subject and key, signed by both roots
+		interKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		interByA := testChainCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "cross"}, IsCA: true}, rootA, interKey)
+		interByB := testChainCert(t, &x509.Certificate{
+			Subject:  pkix.Name{CommonName: "cross"},
+			IsCA:     true,
+			NotAfter: time.Now().Add(time.Hour),
+		}, rootB, interKey)
+		leaf := testChainCert(t, testLeafTmpl("www.example.com"), interByA, nil)
+		inters := []*x509.Certificate{interByA.cert, interByB.cert}
+
+		chains, err := VerifyChain(leaf.cert, inters, []*x509.Certificate{rootB.cert})
+		require.NoError(t, err)
+		require.Len(t, chains, 1)
+		require.Equal(t, rootB.cert, chains[0][2])
+
+		chains, err = VerifyChain(leaf.cert, inters, []*x509.Certificate{rootA.cert, rootB.cert})
+		require.NoError(t, err)
+		require.Len(t, chains, 2)
+
+		// path via rootB expires first, path via rootA is still valid
+		chains, err = VerifyChain(leaf.cert, inters, []*x509.Certificate{rootA.cert, rootB.cert},
+			WithVerifyChainTime(time.Now().Add(2*time.Hour)))
+		require.NoError(t, err)
+		require.Len(t, chains, 1)
+		require.Equal(t, rootA.cert, chains[0][2])
+
+		// every failed path is reported
+		_, err = VerifyChain(leaf.cert, inters, []*x509.Certificate{rootB.cert},
+			WithVerifyChainTime(time.Now().Add(2*time.Hour)))
+		requireChainFailure(t, err, ChainFailureExpired, 1)
+		requireChainFailure(t, err, ChainFailureUnknownAuthority, 1)
+	})
+
+	t.Run("critical extension", func(t *testing.T) {
+		t.Parallel()
+		ext := pkix.Extension{Id: asn1.ObjectIdentifier{1, 2, 3, 4, 5}, Critical: true, Value: []byte{0x05, 0x00}}
+
+		tmpl := testLeafTmpl("critical.example.com")
+		tmpl.ExtraExtensions = []pkix.Extension{ext}
+		critLeaf := testChainCert(t, tmpl, inter, nil)
+		_, err := VerifyChain(critLeaf.cert, inters, roots)
+		requireChainFailure(t, err, ChainFailureCriticalExtension, 0)
+
+		critInter := testChainCert(t, &x509.Certificate{
+			Subject:         pkix.Name{CommonName: "inter"},
+			IsCA:            true,
+			ExtraExtensions: []pkix.Extension{ext},
+		}, root, nil)
+		leaf2 := testChainCert(t, testLeafTmpl("www.example.com"), critInter, nil)
+		_, err = VerifyChain(leaf2.cert, []*x509.Certificate{critInter.cert}, roots)
+		requireChainFailure(t, err, ChainFailureCriticalExtension, 1)
+
+		// non-critical unknown extension is fine
+		ext.Critical = false
+		tmpl = testLeafTmpl("noncritical.example.com")
+		tmpl.ExtraExtensions = []pkix.Extension{ext}
+		leaf3 := testChainCert(t, tmpl, inter, nil)
+		_, err = VerifyChain(leaf3.cert, inters, roots)
+		require.NoError(t, err)
+	})
+
+	t.Run("too many signatures", func(t *testing.T) {
+		t.Parallel()
+
+		// same subject and key id as inter, but different key
+		var fakes []*x509.Certificate
+		for i := 0; i < maxChainSignatureChecks+10; i++ {
+			fake := testChainCert(t, &x509.Certificate{
+				Subject:      pkix.Name{CommonName: "inter"},
+				SubjectKeyId: inter.cert.SubjectKeyId,
+				IsCA:         true,
+			}, root, nil)
+			fakes = append(fakes, fake.cert)
+		}
+
+		_, err := VerifyChain(leaf.cert, append(fakes, inter.cert), roots)
+		requireChainFailure(t, err, ChainFailureTooManySignatures, 0)
+
+		// valid path found before budget exhausted
+		chains, err := VerifyChain(leaf.cert, append([]*x509.Certificate{inter.cert}, fakes...), roots)
+		require.NoError(t, err)
+		require.Len(t, chains, 1)
+	})
+
+	t.Run("signature cache", func(t *testing.T) {
+		t.Parallel()
+
+		// inter2 is reissued inter1, both paths check signature of mid by root
+		mid := testChainCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "mid"}, IsCA: true}, root, nil)
+		inter1 := testChainCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "inter"}, IsCA: true}, mid, nil)
+		inter2 := testChainCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "inter"}, IsCA: true}, mid, inter1.key)
+		leaf := testChainCert(t, testLeafTmpl("www.example.com"), inter1, nil)
+
+		opt, err := new(verifyChainOption).fillDefault().applyOpts()
+		require.NoError(t, err)
+		v := &chainVerifier{
+			opt:           opt,
+			intermediates: []*x509.Certificate{inter1.cert, inter2.cert, mid.cert},
+			roots:         roots,
+			verr:          new(ChainVerifyError),
+			sigResults:    make(map[[2]*x509.Certificate]error),
+		}
+
+		paths := v.buildPaths([]*x509.Certificate{leaf.cert})
+		require.Len(t, paths, 2)
+		require.Equal(t, 6, v.sigChecks)
+		require.Len(t, v.sigResults, 5)
+	})
+
+	t.Run("crl", func(t *testing.T) {
+		t.Parallel()
+		revoked := testChainCert(t, testLeafTmpl("revoked.example.com"), inter, nil)
+
+		newCRL := func(t *testing.T, signer *testChainNode, nextUpdate time.Time) *x509.RevocationList {
+			der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+				Number:     big.NewInt(1),
+				ThisUpdate: time.Now().Add(-time.Hour),
+				NextUpdate: nextUpdate,
+				RevokedCertificateEntries: []x509.RevocationListEntry{{
+					SerialNumber:   revoked.cert.SerialNumber,
+					RevocationTime: time.Now().Add(-time.Minute),
+					ReasonCode:     1,
+				}},
+			}, signer.cert, signer.key)
+			require.NoError(t, err)
+			crl, err := x509.ParseRevocationList(der)
+			require.NoError(t, err)
+			return crl
+		}
+
+		crl := newCRL(t, inter, time.Now().Add(time.Hour))
+		_, err := VerifyChain(leaf.cert, inters, roots, WithVerifyChainCRLs(crl))
+		require.NoError(t, err)
+		_, err = VerifyChain(revoked.cert, inters, roots, WithVerifyChainCRLs(crl))
+		requireChainFailure(t, err, ChainFailureRevoked, 0)
+
+		// crl of root is required for inter
+		_, err = VerifyChain(leaf.cert, inters, roots,
+			WithVerifyChainCRLs(crl), WithVerifyChainRequireCRL())
+		requireChainFailure(t, err, ChainFailureCRL, 1)
+		rootCRL := newCRL(t, root, time.Now().Add(time.Hour))
+		_, err = VerifyChain(leaf.cert, inters, roots,
+			WithVerifyChainCRLs(crl, rootCRL), WithVerifyChainRequireCRL())
+		require.NoError(t, err)
+
+		// expired crl
+		expired := newCRL(t, inter, time.Now().Add(-time.Minute))
+		_, err = VerifyChain(revoked.cert, inters, roots, WithVerifyChainCRLs(expired))
+		requireChainFailure(t, err, ChainFailureCRL, 0)
+
+		// crl signed by other key with same subject
+		fake := testChainCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "inter"}, IsCA: true}, root, nil)
+		forged := newCRL(t, fake, time.Now().Add(time.Hour))
+		_, err = VerifyChain(leaf.cert, inters, roots, WithVerifyChainCRLs(forged))
+		requireChainFailure(t, err, ChainFailureCRL, 0)
+	})
+}
+
+func TestMatchDomainConstraint(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		domain, constraint string
+		match              bool
+	}{
+		{"example.com", "example.com", true},
+		{"www.example.com", "example.com", true},
+		{"WWW.Example.com", "example.com", true},
+		{"badexample.com", "example.com", false},
+		{"example.com", ".example.com", false},
+		{"www.example.com", ".example.com", true},
+		{"anything.com", "", true},
+	} {
+		require.Equal(t, tc.match, matchDomainConstraint(tc.domain, tc.constraint), tc)
+	}
+
+	require.True(t, matchEmailConstraint("a@example.com", "a@example.com"))
+	require.False(t, matchEmailConstraint("b@example.com", "a@example.com"))
+	require.True(t, matchEmailConstraint("b@example.com", "example.com"))
+	require.False(t, matchEmailConstraint("b@mail.example.com", "example.com"))
+	require.True(t, matchEmailConstraint("b@mail.example.com", ".example.com"))
+
+	require.True(t, matchURIConstraint("https://www.example.com/path", "example.com"))
+	require.False(t, matchURIConstraint("https://10.0.0.1/path", "example.com"))
+}
@@ -259,7 +259,23 @@ func RSADer2Prikey(x509v1Der []byte) (*rsa.PrivateKey, error) {
 }
 
 // Pem2Prikey parse private key from x509 v8(general) pem
-func Pem2Prikey(x509v8Pem []byte) (crypto.PrivateKey, error) {
+//
+// password is required if pem is `ENCRYPTED PRIVATE KEY`,
+// and will be ignored if pem is not encrypted.
+func Pem2Prikey(x509v8Pem []byte, password ...string) (crypto.PrivateKey, error) {
+	if len(password) > 1 {
+		return nil, errors.Errorf("only one password is allowed")
+	}
+
+	if blk, _ := pem.Decode(bytes.TrimSpace(x509v8Pem)); blk != nil &&
+		blk.Type == pemTypeEncryptedPrikey {
+		if len(password) == 0 || password[0] == "" {
+			return nil, errors.Errorf("password is required for encrypted private key")
+		}
+
+		return EncryptedDer2Prikey(blk.Bytes, password[0])
+	}
+
 	der, err := Pem2Der(x509v8Pem)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -98,13 +98,28 @@ func parseHashedPassword(hashedString string) (h HashedPassword, err error) {
 
 const defaultPasswordDelay = 2 * time.Second
 
-// VerifyHashedPassword verify HashedPassword
+// VerifyHashedPassword verify hashed password
+//
+// algorithm is detected automatically, support hashedPassword generated by
+// PasswordHashPHC (argon2id, scrypt), PasswordHash and GeneratePasswordHash (bcrypt).
+// use NeedsRehash to check whether hashedPassword should be upgraded.
 func VerifyHashedPassword(rawpassword []byte, hashedPassword string) (err error) {
 	if len(rawpassword) == 0 || len(hashedPassword) == 0 {
 		return errors.Errorf("rawpassword or hashedPassword is empty")
 	}
 
 	defer gutils.NewDelay(defaultPasswordDelay).Wait()
+	switch {
+	case isPHCPassword(hashedPassword):
+		return verifyPHCPassword(rawpassword, hashedPassword)
+	case strings.HasPrefix(hashedPassword, "$2"):
+		if err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), rawpassword); err != nil {
+			return errors.Wrap(err, "password not match")
+		}
+
+		return nil
+	}
+
 	hp, err := parseHashedPassword(hashedPassword)
 	if err != nil {
 		return errors.Wrap(err, "parse hashed password")
@@ -123,25 +138,28 @@ func VerifyHashedPassword(rawpassword []byte, hashedPassword string) (err error)
 }
 
 // PasswordHash generate salted hash of password, can verify by VerifyHashedPassword
-func PasswordHash(password []byte, hasher gutils.HashType) (hashedPassword string, err error) {
+//
+// hasher can be any registered gutils.HashType with digest at least 256 bits,
+// like sha256, sha512, sha3-256, blake3, sm3.
+func PasswordHash(password []byte, hasher gutils.HashTypeInterface) (hashedPassword string, err error) {
 	if len(password) == 0 {
 		return "", errors.Errorf("password is empty")
 	}
 
 	defer gutils.NewDelay(defaultPasswordDelay).Wait()
 
-	var salt []byte
-	switch hasher {
-	case gutils.HashTypeSha256:
-		if salt, err = Salt(256); err != nil {
-			return "", errors.Wrap(err, "generate salt")
-		}
-	case gutils.HashTypeSha512:
-		if salt, err = Salt(512); err != nil {
-			return "", errors.Wrap(err, "generate salt")
-		}
-	default:
-		return "", errors.Errorf("only supprt sha256,sha512")
+	h, err := hasher.Hasher()
+	if err != nil {
+		return "", errors.Wrap(err, "get hasher")
+	}
+	if h.Size() < 32 {
+		return "", errors.Errorf("hasher %q is too weak, digest should be at least 256 bits", hasher.String())
+	}
+
+	// salt's length is 8 times of digest size, sha256 got 256 bytes salt
+	salt, err := Salt(h.Size() * 8)
+	if err != nil {
+		return "", errors.Wrap(err, "generate salt")
 	}
 
 	n, err := rand.Int(rand.Reader, big.NewInt(10))
@@ -150,17 +168,17 @@ func PasswordHash(password []byte, hasher gutils.HashType) (hashedPassword strin
 	}
 	hashNum := int(n.Int64()) + 1
 
-	h, err := newHashedPassword(salt, password, hasher, hashNum)
+	hp, err := newHashedPassword(salt, password, hasher, hashNum)
 	if err != nil {
 		return "", errors.Wrap(err, "hashing password")
 	}
 
-	return h.String(), nil
+	return hp.String(), nil
 }
 
 // GeneratePasswordHash generate hashed password by origin password
 //
-// Deprecated: use PasswordHash instead
+// Deprecated: use PasswordHashPHC instead
 func GeneratePasswordHash(password []byte) ([]byte, error) {
 	return bcrypt.GenerateFromPassword(password, bcrypt.DefaultCost)
 }
@@ -42,6 +42,8 @@ func TestVerifyHashedPassword(t *testing.T) {
 		{"0", args{[]byte("fewfewfewfh"), gutils.HashTypeSha256}},
 		{"1", args{[]byte("43243242"), gutils.HashTypeSha256}},
 		{"2", args{[]byte("32ifh23fu21f2h3"), gutils.HashTypeSha512}},
+		{"3", args{[]byte("32ifh23fu21f2h3"), gutils.HashTypeSha3_256}},
+		{"4", args{[]byte("32ifh23fu21f2h3"), gutils.HashTypeSM3}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -54,6 +56,11 @@ func TestVerifyHashedPassword(t *testing.T) {
 			t.Logf("hashed password: %q", h)
 		})
 	}
+
+	t.Run("weak hasher", func(t *testing.T) {
+		_, err := PasswordHash([]byte("32ifh23fu21f2h3"), gutils.HashTypeMD5)
+		require.ErrorContains(t, err, "too weak")
+	})
 }
 
 func TestRsaEncryptByOAEP(t *testing.T) {
@@ -0,0 +1,238 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+// Keystores used by other platforms,
+// PKCS#12 (.p12/.pfx) from Windows, and JKS from Java.
+
+// Pkcs12ToPrikeyAndCerts decode password-protected PKCS#12 bundle
+//
+// # Returns
+//   - prikey: private key
+//   - certs: certificate chain, certs[0] is the certificate of prikey
+func Pkcs12ToPrikeyAndCerts(pfxData []byte, password string) (
+	prikey crypto.PrivateKey, certs []*x509.Certificate, err error) {
+	prikey, leaf, caCerts, err := pkcs12.DecodeChain(pfxData, password)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "decode pkcs12")
+	}
+
+	return prikey, append([]*x509.Certificate{leaf}, caCerts...), nil
+}
+
+type pkcs12Option struct {
+	legacy bool
+}
+
+func (o *pkcs12Option) applyOpts(opts ...Pkcs12Option) (*pkcs12Option, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// Pkcs12Option optional arguments for PrikeyAndCertsToPkcs12
+type Pkcs12Option func(*pkcs12Option) error
+
+// WithPkcs12Legacy encrypt by 3DES and SHA-1 MAC,
+// for Windows before Server 2019 and Java before 8u301.
+//
+// default to AES-256 and SHA-256 MAC.
+func WithPkcs12Legacy() Pkcs12Option {
+	return func(o *pkcs12Option) error {
+		o.legacy = true
+		return nil
+	}
+}
+
+// PrikeyAndCertsToPkcs12 encode private key and certificate chain
+// to password-protected PKCS#12 bundle
+//
+// # Args
+//   - prikey: private key
+//   - certs: certificate chain, certs[0] should be the certificate of prikey
+//   - password: password to encrypt bundle
+func PrikeyAndCertsToPkcs12(prikey crypto.PrivateKey,
+	certs []*x509.Certificate,
+	password string,
+	opts ...Pkcs12Option) (pfxData []byte, err error) {
+	opt, err := new(pkcs12Option).applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	if err = validPrikey(prikey); err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.Errorf("certs should not be empty")
+	}
+	if password == "" {
+		return nil, errors.Errorf("password should not be empty")
+	}
+	if !pubkeyEqual(Prikey2Pubkey(prikey), certs[0].PublicKey) {
+		return nil, errors.Errorf("prikey does not match certs[0]")
+	}
+
+	encoder := pkcs12.Modern
+	if opt.legacy {
+		encoder = pkcs12.Legacy
+	}
+
+	pfxData, err = encoder.Encode(prikey, certs[0], certs[1:], password)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode pkcs12")
+	}
+
+	return pfxData, nil
+}
+
+func pubkeyEqual(a, b crypto.PublicKey) bool {
+	eq, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && eq.Equal(b)
+}
+
+// JKSEntry entry in JKS keystore
+//
+// PrivateKey entry if Prikey is not nil, otherwise trusted certificate entry
+// that contains only Certs[0].
+type JKSEntry struct {
+	Alias     string
+	CreatedAt time.Time
+	Prikey    crypto.PrivateKey
+	// Certs certificate chain of Prikey, or trusted certificate
+	Certs []*x509.Certificate
+}
+
+// JKSToEntries decode JKS keystore, private keys are decrypted by the same password
+func JKSToEntries(jksData []byte, password string) (entries []*JKSEntry, err error) {
+	ks := keystore.New(keystore.WithOrderedAliases())
+	if err = ks.Load(bytes.NewReader(jksData), []byte(password)); err != nil {
+		return nil, errors.Wrap(err, "load jks")
+	}
+
+	for _, alias := range ks.Aliases() {
+		entry := &JKSEntry{Alias: alias}
+		switch {
+		case ks.IsPrivateKeyEntry(alias):
+			ksEntry, err := ks.GetPrivateKeyEntry(alias, []byte(password))
+			if err != nil {
+				return nil, errors.Wrapf(err, "get private key %q", alias)
+			}
+
+			if entry.Prikey, err = Der2Prikey(ksEntry.PrivateKey); err != nil {
+				return nil, errors.Wrapf(err, "parse private key %q", alias)
+			}
+			for _, c := range ksEntry.CertificateChain {
+				cert, err := Der2Cert(c.Content)
+				if err != nil {
+					return nil, errors.Wrapf(err, "parse certificate of %q", alias)
+				}
+
+				entry.Certs = append(entry.Certs, cert)
+			}
+
+			entry.CreatedAt = ksEntry.CreationTime
+		case ks.IsTrustedCertificateEntry(alias):
+			ksEntry, err := ks.GetTrustedCertificateEntry(alias)
+			if err != nil {
+				return nil, errors.Wrapf(err, "get trusted certificate %q", alias)
+			}
+
+			cert, err := Der2Cert(ksEntry.Certificate.Content)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parse certificate %q", alias)
+			}
+
+			entry.Certs = []*x509.Certificate{cert}
+			entry.CreatedAt = ksEntry.CreationTime
+		default:
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// EntriesToJKS encode entries to JKS keystore,
+// keystore and private keys are encrypted by the same password
+func EntriesToJKS(entries []*JKSEntry, password string) (jksData []byte, err error) {
+	if len(password) < 6 {
+		return nil, errors.Errorf("password should be at least 6 characters for java keytool")
+	}
+
+	ks := keystore.New(keystore.WithOrderedAliases())
+	for _, entry := range entries {
+		if entry.Alias == "" {
+			return nil, errors.Errorf("alias should not be empty")
+		}
+		if len(entry.Certs) == 0 {
+			return nil, errors.Errorf("certs of %q should not be empty", entry.Alias)
+		}
+
+		createdAt := entry.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = gutils.Clock.GetUTCNow()
+		}
+
+		if entry.Prikey == nil {
+			if err = ks.SetTrustedCertificateEntry(entry.Alias, keystore.TrustedCertificateEntry{
+				CreationTime: createdAt,
+				Certificate: keystore.Certificate{
+					Type:    "X509",
+					Content: entry.Certs[0].Raw,
+				},
+			}); err != nil {
+				return nil, errors.Wrapf(err, "set trusted certificate %q", entry.Alias)
+			}
+
+			continue
+		}
+
+		prikeyDer, err := Prikey2Der(entry.Prikey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "marshal private key %q", entry.Alias)
+		}
+		if !pubkeyEqual(Prikey2Pubkey(entry.Prikey), entry.Certs[0].PublicKey) {
+			return nil, errors.Errorf("prikey of %q does not match certs[0]", entry.Alias)
+		}
+
+		ksEntry := keystore.PrivateKeyEntry{
+			CreationTime: createdAt,
+			PrivateKey:   prikeyDer,
+		}
+		for _, cert := range entry.Certs {
+			ksEntry.CertificateChain = append(ksEntry.CertificateChain, keystore.Certificate{
+				Type:    "X509",
+				Content: cert.Raw,
+			})
+		}
+
+		if err = ks.SetPrivateKeyEntry(entry.Alias, ksEntry, []byte(password)); err != nil {
+			return nil, errors.Wrapf(err, "set private key %q", entry.Alias)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = ks.Store(&buf, []byte(password)); err != nil {
+		return nil, errors.Wrap(err, "store jks")
+	}
+
+	return buf.Bytes(), nil
+}
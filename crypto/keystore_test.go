@@ -0,0 +1,126 @@
+package crypto
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testNewCertChain new root ca and leaf certificate signed by it
+func testNewCertChain(t *testing.T) (leafPrikey any, leaf, root *x509.Certificate) {
+	t.Helper()
+
+	rootPrikeyPem, rootDer, err := NewECDSAPrikeyAndCert(ECDSACurveP256,
+		WithX509CertCommonName("root"),
+		WithX509CertIsCA(),
+	)
+	require.NoError(t, err)
+	rootPrikey, err := Pem2Prikey(rootPrikeyPem)
+	require.NoError(t, err)
+	root, err = Der2Cert(rootDer)
+	require.NoError(t, err)
+
+	prikey, err := NewRSAPrikey(RSAPrikeyBits2048)
+	require.NoError(t, err)
+	csrDer, err := NewX509CSR(prikey, WithX509CSRCommonName("leaf"))
+	require.NoError(t, err)
+	leafDer, err := NewX509CertByCSR(root, rootPrikey, csrDer)
+	require.NoError(t, err)
+	leaf, err = Der2Cert(leafDer)
+	require.NoError(t, err)
+
+	return prikey, leaf, root
+}
+
+func TestPkcs12(t *testing.T) {
+	t.Parallel()
+
+	prikey, leaf, root := testNewCertChain(t)
+
+	for _, opts := range [][]Pkcs12Option{
+		nil,
+		{WithPkcs12Legacy()},
+	} {
+		pfx, err := PrikeyAndCertsToPkcs12(prikey, []*x509.Certificate{leaf, root}, "passwd", opts...)
+		require.NoError(t, err)
+
+		gotPrikey, gotCerts, err := Pkcs12ToPrikeyAndCerts(pfx, "passwd")
+		require.NoError(t, err)
+		require.True(t, pubkeyEqual(Prikey2Pubkey(prikey), Prikey2Pubkey(gotPrikey)))
+		require.Len(t, gotCerts, 2)
+		require.True(t, leaf.Equal(gotCerts[0]))
+		require.True(t, root.Equal(gotCerts[1]))
+
+		_, _, err = Pkcs12ToPrikeyAndCerts(pfx, "wrong")
+		require.Error(t, err)
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := PrikeyAndCertsToPkcs12(prikey, nil, "passwd")
+		require.Error(t, err)
+		_, err = PrikeyAndCertsToPkcs12(prikey, []*x509.Certificate{leaf}, "")
+		require.Error(t, err)
+		_, err = PrikeyAndCertsToPkcs12(prikey, []*x509.Certificate{root}, "passwd")
+		require.ErrorContains(t, err, "does not match")
+	})
+}
+
+func TestJKS(t *testing.T) {
+	t.Parallel()
+
+	prikey, leaf, root := testNewCertChain(t)
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	jksData, err := EntriesToJKS([]*JKSEntry{
+		{
+			Alias:     "server",
+			CreatedAt: createdAt,
+			Prikey:    prikey,
+			Certs:     []*x509.Certificate{leaf, root},
+		},
+		{
+			Alias: "root",
+			Certs: []*x509.Certificate{root},
+		},
+	}, "password")
+	require.NoError(t, err)
+
+	entries, err := JKSToEntries(jksData, "password")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	require.Equal(t, "root", entries[0].Alias)
+	require.Nil(t, entries[0].Prikey)
+	require.Len(t, entries[0].Certs, 1)
+	require.True(t, root.Equal(entries[0].Certs[0]))
+
+	require.Equal(t, "server", entries[1].Alias)
+	require.True(t, createdAt.Equal(entries[1].CreatedAt))
+	require.True(t, pubkeyEqual(Prikey2Pubkey(prikey), Prikey2Pubkey(entries[1].Prikey)))
+	require.Len(t, entries[1].Certs, 2)
+	require.True(t, leaf.Equal(entries[1].Certs[0]))
+
+	_, err = JKSToEntries(jksData, "wrong password")
+	require.Error(t, err)
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := EntriesToJKS([]*JKSEntry{{Alias: "a", Certs: []*x509.Certificate{root}}}, "short")
+		require.Error(t, err)
+		_, err = EntriesToJKS([]*JKSEntry{{Certs: []*x509.Certificate{root}}}, "password")
+		require.Error(t, err)
+		_, err = EntriesToJKS([]*JKSEntry{{Alias: "a"}}, "password")
+		require.Error(t, err)
+		_, err = EntriesToJKS([]*JKSEntry{{
+			Alias:  "a",
+			Prikey: prikey,
+			Certs:  []*x509.Certificate{root},
+		}}, "password")
+		require.ErrorContains(t, err, "does not match")
+	})
+}
@@ -0,0 +1,604 @@
+//go:build !windows
+// +build !windows
+
+// Package file is a multi-key KMS persisted in a sealed keyring file
+package file
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+	gkms "github.com/Laisky/go-utils/v4/crypto/kms"
+	"github.com/Laisky/go-utils/v4/crypto/kms/mem"
+	gjson "github.com/Laisky/go-utils/v4/json"
+	glog "github.com/Laisky/go-utils/v4/log"
+)
+
+var (
+	_ gkms.Interface = new(KMS)
+)
+
+const (
+	// keyringVer1 keyring sealed by key derived from passphrase by scrypt
+	keyringVer1 = 1
+	// keyringVer2 keyring sealed by key derived from master key by HKDF,
+	// master key is split into shamir shares
+	keyringVer2 = 2
+
+	keyringSaltLen = 32
+	// defaultKekLen length of kek generated by Rotate
+	defaultKekLen = 32
+)
+
+// sealedKeyring is the content of keyring file
+type sealedKeyring struct {
+	Version int `json:"version"`
+	// Threshold number of shares required to unseal, only for keyringVer2
+	Threshold int `json:"threshold,omitempty"`
+	// Salt salt to derive seal key from passphrase or master key
+	Salt []byte `json:"salt"`
+	// Ciphertext keyring encrypted by master key
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// keyring is the plaintext of sealedKeyring
+type keyring struct {
+	Keks []keyringKek `json:"keks"`
+}
+
+type keyringKek struct {
+	ID      uint16 `json:"id"`
+	Kek     []byte `json:"kek"`
+	Retired bool   `json:"retired,omitempty"`
+}
+
+// KMS multi-key KMS persisted in file
+//
+// all keks are kept in a keyring file sealed by master passphrase (New)
+// or by master key split into shamir shares (Init & NewSealed),
+// keyring file is replaced atomically and protected by file lock,
+// so several processes can share the same keyring file.
+//
+// Notice: file lock is process-wide,
+// do not open the same keyring file by multiple KMS in one process.
+type KMS struct {
+	*mem.KMS
+
+	opt        *kmsOption
+	path       string
+	lockPath   string
+	version    int
+	passphrase []byte
+	// mu protect keyring file in current process
+	mu sync.Mutex
+
+	// sealMu protect unseal progress of shamir sealed keyring
+	sealMu       sync.RWMutex
+	threshold    int
+	masterKey    []byte
+	unsealShares map[byte][]byte
+}
+
+type kmsOption struct {
+	logger            glog.Logger
+	memOpts           []mem.KMSOption
+	lockTimeout       time.Duration
+	lockRetryInterval time.Duration
+}
+
+// KMSOption optional arguments for kms
+type KMSOption func(*kmsOption) error
+
+func (o *kmsOption) fillDefault() *kmsOption {
+	o.logger = glog.Shared.Named("kms_file")
+	o.lockTimeout = 10 * time.Second
+	o.lockRetryInterval = 50 * time.Millisecond
+
+	return o
+}
+
+func (o *kmsOption) applyOpts(opts ...KMSOption) (*kmsOption, error) {
+	for i := range opts {
+		if err := opts[i](o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// WithLogger (optional) set internal logger
+//
+// default to gutils logger
+func WithLogger(logger glog.Logger) KMSOption {
+	return func(o *kmsOption) error {
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithMemOptions (optional) set options for internal memory kms
+func WithMemOptions(opts ...mem.KMSOption) KMSOption {
+	return func(o *kmsOption) error {
+		o.memOpts = append(o.memOpts, opts...)
+		return nil
+	}
+}
+
+// WithLockTimeout (optional) set max duration to wait for file lock
+//
+// default to 10s
+func WithLockTimeout(timeout time.Duration) KMSOption {
+	return func(o *kmsOption) error {
+		if timeout <= 0 {
+			return errors.Errorf("lock timeout should be positive")
+		}
+
+		o.lockTimeout = timeout
+		return nil
+	}
+}
+
+// New new kms by keyring file
+//
+// # Args:
+//   - path: keyring file path, will be created if not exists
+//   - passphrase: master passphrase to seal keyring
+func New(ctx context.Context, path string, passphrase []byte,
+	opts ...KMSOption) (*KMS, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.Errorf("empty passphrase")
+	}
+
+	opt, err := new(kmsOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+	opt.memOpts = append(opt.memOpts, mem.WithLogger(opt.logger))
+
+	kms := &KMS{
+		opt:        opt,
+		path:       path,
+		lockPath:   path + ".lock",
+		version:    keyringVer1,
+		passphrase: append([]byte{}, passphrase...),
+	}
+
+	var ring *keyring
+	if err = kms.withLock(ctx, func() error {
+		if ring, err = kms.load(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if ring == nil {
+			ring = new(keyring)
+			if err = kms.save(ring); err != nil {
+				return errors.WithStack(err)
+			}
+
+			opt.logger.Info("create new keyring file", zap.String("path", path))
+		}
+
+		return nil
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if kms.KMS, err = mem.New(ring.keks(), opt.memOpts...); err != nil {
+		return nil, errors.Wrap(err, "new mem kms")
+	}
+	if err = kms.merge(ctx, ring); err != nil {
+		return nil, errors.Wrap(err, "load kek status")
+	}
+
+	return kms, nil
+}
+
+// AddKek add new kek and persist it to keyring file
+func (m *KMS) AddKek(ctx context.Context,
+	kekID uint16,
+	kek []byte) error {
+	if len(kek) == 0 {
+		return errors.Errorf("empty kek")
+	}
+
+	if err := m.withLock(ctx, func() error {
+		ring, err := m.load()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if ring == nil {
+			return errors.Errorf("keyring file `%s` not found", m.path)
+		}
+
+		for _, k := range ring.Keks {
+			if k.ID == kekID {
+				return errors.Errorf("kek id already existed")
+			}
+		}
+
+		ring.Keks = append(ring.Keks, keyringKek{
+			ID:  kekID,
+			Kek: append([]byte{}, kek...),
+		})
+		if err = m.save(ring); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return m.merge(ctx, ring)
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Rotate generate new random kek, persist it to keyring file and use it as current kek
+//
+// new kek id is max kek id in keyring file plus one.
+func (m *KMS) Rotate(ctx context.Context) (kekID uint16, err error) {
+	if err = m.withLock(ctx, func() error {
+		ring, err := m.load()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if ring == nil {
+			return errors.Errorf("keyring file `%s` not found", m.path)
+		}
+
+		for _, k := range ring.Keks {
+			if k.ID == math.MaxUint16 {
+				return errors.Errorf("kek id exhausted")
+			}
+			if k.ID >= kekID {
+				kekID = k.ID + 1
+			}
+		}
+		if kekID == 0 {
+			kekID = 1
+		}
+
+		kek, err := gcrypto.Salt(defaultKekLen)
+		if err != nil {
+			return errors.Wrap(err, "generate kek")
+		}
+
+		ring.Keks = append(ring.Keks, keyringKek{ID: kekID, Kek: kek})
+		if err = m.save(ring); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return m.merge(ctx, ring)
+	}); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	m.opt.logger.Info("rotate kek", zap.Uint16("kek_id", kekID))
+	return kekID, nil
+}
+
+// RetireKek retire kek and persist it to keyring file
+//
+// current active kek can not be retired.
+func (m *KMS) RetireKek(ctx context.Context, kekID uint16) error {
+	return m.withLock(ctx, func() error {
+		ring, err := m.load()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if ring == nil {
+			return errors.Errorf("keyring file `%s` not found", m.path)
+		}
+
+		// make sure the max kek id in memory is the same as in file
+		if err = m.merge(ctx, ring); err != nil {
+			return errors.WithStack(err)
+		}
+
+		found := false
+		for i := range ring.Keks {
+			if ring.Keks[i].ID == kekID {
+				ring.Keks[i].Retired = true
+				found = true
+			}
+		}
+		if !found {
+			return errors.Errorf("kek %d not found", kekID)
+		}
+
+		if err = m.KMS.RetireKek(ctx, kekID); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return m.save(ring)
+	})
+}
+
+// Rewrap re-encrypt data by current kek
+//
+// will reload keyring file if kek not found in memory.
+func (m *KMS) Rewrap(ctx context.Context,
+	ed *gkms.EncryptedData,
+	additionalData []byte) (newEd *gkms.EncryptedData, err error) {
+	if err = m.ensureKek(ctx, ed.KekID); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return m.KMS.Rewrap(ctx, ed, additionalData)
+}
+
+// KekStatus return status of kek
+//
+// will reload keyring file if kek not found in memory.
+func (m *KMS) KekStatus(ctx context.Context, kekID uint16) (gkms.KekStatus, error) {
+	if err := m.ensureKek(ctx, kekID); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return m.KMS.KekStatus(ctx, kekID)
+}
+
+// Reload load keks added by other processes from keyring file
+func (m *KMS) Reload(ctx context.Context) error {
+	return m.withLock(ctx, func() error {
+		ring, err := m.load()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if ring == nil {
+			return errors.Errorf("keyring file `%s` not found", m.path)
+		}
+
+		return m.merge(ctx, ring)
+	})
+}
+
+// DeriveKeyByID derive key by specific arguments
+//
+// will reload keyring file if kek not found in memory.
+func (m *KMS) DeriveKeyByID(ctx context.Context,
+	kekID uint16,
+	dekID []byte,
+	length int) (dek []byte, err error) {
+	if err = m.ensureKek(ctx, kekID); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return m.KMS.DeriveKeyByID(ctx, kekID, dekID, length)
+}
+
+// Decrypt decrypt ciphertext
+//
+// will reload keyring file if kek not found in memory.
+func (m *KMS) Decrypt(ctx context.Context,
+	ei *gkms.EncryptedData,
+	additionalData []byte) (plaintext []byte, err error) {
+	if err = m.ensureKek(ctx, ei.KekID); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return m.KMS.Decrypt(ctx, ei, additionalData)
+}
+
+// ensureKek reload keyring file if kek not found in memory
+func (m *KMS) ensureKek(ctx context.Context, kekID uint16) error {
+	if m.hasKek(ctx, kekID) {
+		return nil
+	}
+
+	if err := m.Reload(ctx); err != nil {
+		return errors.Wrap(err, "reload keyring")
+	}
+
+	return nil
+}
+
+func (m *KMS) hasKek(ctx context.Context, kekID uint16) bool {
+	keks, err := m.KMS.Keks(ctx)
+	if err != nil {
+		return false
+	}
+
+	_, ok := keks[kekID]
+	return ok
+}
+
+// merge add keks in keyring that not loaded into memory,
+// and retire keks that retired in keyring
+func (m *KMS) merge(ctx context.Context, ring *keyring) error {
+	for _, k := range ring.Keks {
+		if m.hasKek(ctx, k.ID) {
+			continue
+		}
+
+		if err := m.KMS.AddKek(ctx, k.ID, k.Kek); err != nil {
+			return errors.Wrapf(err, "add kek %d", k.ID)
+		}
+	}
+
+	for _, k := range ring.Keks {
+		if !k.Retired {
+			continue
+		}
+
+		status, err := m.KMS.KekStatus(ctx, k.ID)
+		if err != nil {
+			return errors.Wrapf(err, "get status of kek %d", k.ID)
+		}
+		if status == gkms.KekStatusRetired {
+			continue
+		}
+
+		if err = m.KMS.RetireKek(ctx, k.ID); err != nil {
+			return errors.Wrapf(err, "retire kek %d", k.ID)
+		}
+	}
+
+	return nil
+}
+
+// withLock run f with both process lock and file lock
+func (m *KMS) withLock(ctx context.Context, f func() error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, m.opt.lockTimeout)
+	defer cancel()
+
+	flock := gutils.NewFlock(m.lockPath)
+	for {
+		err := flock.Lock()
+		if err == nil {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(err, "acquire file lock `%s`", m.lockPath)
+		case <-time.After(m.opt.lockRetryInterval):
+		}
+	}
+	defer gutils.LogErr(flock.Unlock, m.opt.logger)
+
+	return f()
+}
+
+// load read and unseal keyring file, return nil if file not exists
+func (m *KMS) load() (*keyring, error) {
+	sealed, err := m.readSealed()
+	if err != nil || sealed == nil {
+		return nil, err
+	}
+
+	key, err := m.sealKey(sealed.Salt)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return unsealKeyring(sealed, key)
+}
+
+// readSealed read keyring file, return nil if file not exists
+func (m *KMS) readSealed() (*sealedKeyring, error) {
+	raw, err := os.ReadFile(m.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil //nolint:nilnil
+		}
+
+		return nil, errors.Wrapf(err, "read keyring file `%s`", m.path)
+	}
+
+	sealed := new(sealedKeyring)
+	if err = gjson.NewDecoder(bytes.NewReader(raw)).Decode(sealed); err != nil {
+		return nil, errors.Wrapf(err, "parse keyring file `%s`", m.path)
+	}
+
+	if sealed.Version != m.version {
+		switch sealed.Version {
+		case keyringVer1:
+			return nil, errors.Errorf("keyring file `%s` is sealed by passphrase, use New", m.path)
+		case keyringVer2:
+			return nil, errors.Errorf("keyring file `%s` is sealed by shamir shares, use NewSealed", m.path)
+		}
+
+		return nil, errors.Errorf("unknown keyring version %d", sealed.Version)
+	}
+
+	return sealed, nil
+}
+
+// sealKey derive key to seal keyring
+func (m *KMS) sealKey(salt []byte) ([]byte, error) {
+	switch m.version {
+	case keyringVer1:
+		key, err := gcrypto.DeriveKeyBySMHF(m.passphrase, salt)
+		return key, errors.Wrap(err, "derive key from passphrase")
+	case keyringVer2:
+		m.sealMu.RLock()
+		masterKey := m.masterKey
+		m.sealMu.RUnlock()
+		if masterKey == nil {
+			return nil, errors.Errorf("kms is sealed")
+		}
+
+		key, err := gcrypto.DeriveKeyByHKDF(masterKey, salt, masterKeyLen)
+		return key, errors.Wrap(err, "derive key from master key")
+	}
+
+	return nil, errors.Errorf("unknown keyring version %d", m.version)
+}
+
+// unsealKeyring decrypt keyring by key
+func unsealKeyring(sealed *sealedKeyring, key []byte) (*keyring, error) {
+	plaintext, err := gcrypto.AEADDecrypt(key, sealed.Ciphertext, keyringAD(sealed.Version))
+	if err != nil {
+		return nil, errors.Wrap(err, "unseal keyring, maybe wrong passphrase")
+	}
+
+	ring := new(keyring)
+	if err = gjson.NewDecoder(bytes.NewReader(plaintext)).Decode(ring); err != nil {
+		return nil, errors.Wrap(err, "parse keyring")
+	}
+
+	return ring, nil
+}
+
+// save seal keyring and replace keyring file atomically
+func (m *KMS) save(ring *keyring) error {
+	plaintext, err := gjson.Marshal(ring)
+	if err != nil {
+		return errors.Wrap(err, "marshal keyring")
+	}
+
+	sealed := &sealedKeyring{
+		Version:   m.version,
+		Threshold: m.threshold,
+	}
+	if sealed.Salt, err = gcrypto.Salt(keyringSaltLen); err != nil {
+		return errors.Wrap(err, "generate salt")
+	}
+
+	key, err := m.sealKey(sealed.Salt)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if sealed.Ciphertext, err = gcrypto.AEADEncrypt(key, plaintext, keyringAD(sealed.Version)); err != nil {
+		return errors.Wrap(err, "seal keyring")
+	}
+
+	data, err := gjson.Marshal(sealed)
+	if err != nil {
+		return errors.Wrap(err, "marshal sealed keyring")
+	}
+
+	if err = gutils.ReplaceFileAtomic(m.path, io.NopCloser(bytes.NewReader(data)), 0600); err != nil {
+		return errors.Wrapf(err, "write keyring file `%s`", m.path)
+	}
+
+	return nil
+}
+
+func (r *keyring) keks() map[uint16][]byte {
+	keks := make(map[uint16][]byte, len(r.Keks))
+	for _, k := range r.Keks {
+		keks[k.ID] = k.Kek
+	}
+
+	return keks
+}
+
+func keyringAD(version int) []byte {
+	return []byte{'k', 'e', 'y', 'r', 'i', 'n', 'g', byte(version)}
+}
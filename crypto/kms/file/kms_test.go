@@ -0,0 +1,161 @@
+//go:build !windows
+// +build !windows
+
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+	gkms "github.com/Laisky/go-utils/v4/crypto/kms"
+)
+
+func TestKMS(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	passphrase := []byte("laisky")
+
+	kms, err := New(ctx, path, passphrase)
+	require.NoError(t, err)
+	require.Equal(t, gkms.StatusNoKeK, kms.Status())
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), "keks")
+
+	kek, err := gcrypto.Salt(32)
+	require.NoError(t, err)
+	require.NoError(t, kms.AddKek(ctx, 1, kek))
+	require.ErrorContains(t, kms.AddKek(ctx, 1, kek), "kek id already existed")
+	require.Equal(t, gkms.StatusReady, kms.Status())
+
+	ed, err := kms.Encrypt(ctx, []byte("hello"), []byte("ad"))
+	require.NoError(t, err)
+
+	t.Run("reopen", func(t *testing.T) {
+		kms2, err := New(ctx, path, passphrase)
+		require.NoError(t, err)
+		require.Equal(t, gkms.StatusReady, kms2.Status())
+
+		plaintext, err := kms2.Decrypt(ctx, ed, []byte("ad"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("hello"), plaintext)
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		_, err := New(ctx, path, []byte("wrong"))
+		require.ErrorContains(t, err, "maybe wrong passphrase")
+	})
+
+	t.Run("reload kek added by others", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "keyring.json")
+		kms1, err := New(ctx, path, passphrase)
+		require.NoError(t, err)
+		kms2, err := New(ctx, path, passphrase)
+		require.NoError(t, err)
+
+		require.NoError(t, kms1.AddKek(ctx, 1, kek))
+		ed, err := kms1.Encrypt(ctx, []byte("hello"), nil)
+		require.NoError(t, err)
+
+		// kms2 will reload keyring since kek 1 not found in memory
+		plaintext, err := kms2.Decrypt(ctx, ed, nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte("hello"), plaintext)
+
+		// kms2 will merge keks from file before add new kek
+		kek2, err := gcrypto.Salt(32)
+		require.NoError(t, err)
+		require.NoError(t, kms2.AddKek(ctx, 2, kek2))
+		require.NoError(t, kms1.Reload(ctx))
+
+		keks, err := kms1.Keks(ctx)
+		require.NoError(t, err)
+		require.Len(t, keks, 2)
+		require.Equal(t, kek2, keks[2])
+	})
+
+	t.Run("concurrent add", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "keyring.json")
+		kms, err := New(ctx, path, passphrase)
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for i := 1; i <= 5; i++ {
+			wg.Add(1)
+			go func(id uint16) {
+				defer wg.Done()
+				kek, err := gcrypto.Salt(32)
+				require.NoError(t, err)
+				require.NoError(t, kms.AddKek(ctx, id, kek))
+			}(uint16(i))
+		}
+		wg.Wait()
+
+		kms2, err := New(ctx, path, passphrase)
+		require.NoError(t, err)
+		keks, err := kms2.Keks(ctx)
+		require.NoError(t, err)
+		require.Len(t, keks, 5)
+	})
+}
+
+func TestKMS_Rotate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	passphrase := []byte("laisky")
+
+	kms, err := New(ctx, path, passphrase)
+	require.NoError(t, err)
+
+	kekID1, err := kms.Rotate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint16(1), kekID1)
+
+	ed, err := kms.Encrypt(ctx, []byte("hello"), nil)
+	require.NoError(t, err)
+
+	// rotate by another kms that share the same keyring file
+	kms2, err := New(ctx, path, passphrase)
+	require.NoError(t, err)
+	kekID2, err := kms2.Rotate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint16(2), kekID2)
+
+	newEd, err := kms2.Rewrap(ctx, ed, nil)
+	require.NoError(t, err)
+	require.Equal(t, kekID2, newEd.KekID)
+
+	// kms will reload kek 2 from file
+	plaintext, err := kms.Decrypt(ctx, newEd, nil)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), plaintext)
+
+	require.ErrorContains(t, kms.RetireKek(ctx, kekID2), "can not retire active kek")
+	require.NoError(t, kms.RetireKek(ctx, kekID1))
+
+	t.Run("retired status persisted", func(t *testing.T) {
+		kms3, err := New(ctx, path, passphrase)
+		require.NoError(t, err)
+
+		status, err := kms3.KekStatus(ctx, kekID1)
+		require.NoError(t, err)
+		require.Equal(t, gkms.KekStatusRetired, status)
+		status, err = kms3.KekStatus(ctx, kekID2)
+		require.NoError(t, err)
+		require.Equal(t, gkms.KekStatusActive, status)
+
+		_, err = kms3.Decrypt(ctx, ed, nil)
+		require.ErrorContains(t, err, "kek 1 is retired")
+	})
+}
@@ -0,0 +1,216 @@
+//go:build !windows
+// +build !windows
+
+package file
+
+import (
+	"context"
+	"os"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+	gkms "github.com/Laisky/go-utils/v4/crypto/kms"
+	"github.com/Laisky/go-utils/v4/crypto/kms/mem"
+	"github.com/Laisky/go-utils/v4/crypto/threshold/shamir"
+)
+
+// masterKeyLen length of master key split into shamir shares
+const masterKeyLen = 32
+
+// Init create new keyring file sealed by random master key,
+// master key is split into total shares, threshold of them are required to unseal.
+//
+// keyring will contain one random kek with id 1.
+// each share is `{share index}{share}`, should be distributed to different holders,
+// and can be submitted by KMS.SubmitUnsealShare after NewSealed.
+func Init(ctx context.Context, path string, total, threshold int,
+	opts ...KMSOption) (shares [][]byte, err error) {
+	opt, err := new(kmsOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	masterKey, err := gcrypto.Salt(masterKeyLen)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate master key")
+	}
+
+	members, err := shamir.Split(masterKey, total, threshold)
+	if err != nil {
+		return nil, errors.Wrap(err, "split master key")
+	}
+
+	kek, err := gcrypto.Salt(defaultKekLen)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate kek")
+	}
+
+	kms := &KMS{
+		opt:       opt,
+		path:      path,
+		lockPath:  path + ".lock",
+		version:   keyringVer2,
+		threshold: threshold,
+		masterKey: masterKey,
+	}
+	if err = kms.withLock(ctx, func() error {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			return errors.Errorf("keyring file `%s` already exists", path)
+		}
+
+		return kms.save(&keyring{
+			Keks: []keyringKek{{ID: 1, Kek: kek}},
+		})
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for idx, share := range members {
+		shares = append(shares, append([]byte{idx}, share...))
+	}
+
+	opt.logger.Info("init shamir sealed keyring",
+		zap.String("path", path),
+		zap.Int("total", total),
+		zap.Int("threshold", threshold))
+	return shares, nil
+}
+
+// NewSealed new kms by keyring file created by Init
+//
+// kms is in StatusSealed until threshold shares
+// have been submitted by SubmitUnsealShare.
+func NewSealed(ctx context.Context, path string,
+	opts ...KMSOption) (*KMS, error) {
+	opt, err := new(kmsOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+	opt.memOpts = append(opt.memOpts, mem.WithLogger(opt.logger))
+
+	kms := &KMS{
+		opt:          opt,
+		path:         path,
+		lockPath:     path + ".lock",
+		version:      keyringVer2,
+		unsealShares: make(map[byte][]byte),
+	}
+
+	if err = kms.withLock(ctx, func() error {
+		sealed, err := kms.readSealed()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if sealed == nil {
+			return errors.Errorf("keyring file `%s` not found", path)
+		}
+
+		kms.threshold = sealed.Threshold
+		return nil
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if kms.KMS, err = mem.New(nil, opt.memOpts...); err != nil {
+		return nil, errors.Wrap(err, "new mem kms")
+	}
+
+	return kms, nil
+}
+
+// Status return current status
+//
+// return StatusSealed if kms is not unsealed yet.
+func (m *KMS) Status() gkms.Status {
+	if m.IsSealed() {
+		return gkms.StatusSealed
+	}
+
+	return m.KMS.Status()
+}
+
+// IsSealed return true if shamir sealed kms is not unsealed yet
+func (m *KMS) IsSealed() bool {
+	if m.version != keyringVer2 {
+		return false
+	}
+
+	m.sealMu.RLock()
+	defer m.sealMu.RUnlock()
+	return m.masterKey == nil
+}
+
+// UnsealProgress return number of submitted shares and threshold
+func (m *KMS) UnsealProgress() (submitted, threshold int) {
+	m.sealMu.RLock()
+	defer m.sealMu.RUnlock()
+	return len(m.unsealShares), m.threshold
+}
+
+// SubmitUnsealShare submit one share generated by Init
+//
+// kms will be unsealed once threshold shares have been submitted.
+// if the combined master key can not unseal keyring,
+// all submitted shares will be discarded and the ceremony should restart.
+func (m *KMS) SubmitUnsealShare(ctx context.Context, share []byte) (unsealed bool, err error) {
+	if m.version != keyringVer2 {
+		return false, errors.Errorf("kms is not sealed by shamir shares")
+	}
+	if len(share) < 2 {
+		return false, errors.Errorf("invalid share")
+	}
+
+	m.sealMu.Lock()
+	if m.masterKey != nil {
+		m.sealMu.Unlock()
+		return true, nil
+	}
+
+	m.unsealShares[share[0]] = append([]byte{}, share[1:]...)
+	if len(m.unsealShares) < m.threshold {
+		m.sealMu.Unlock()
+		return false, nil
+	}
+
+	parts := m.unsealShares
+	m.unsealShares = make(map[byte][]byte)
+	m.sealMu.Unlock()
+
+	masterKey, err := shamir.Combine(parts)
+	if err != nil {
+		return false, errors.Wrap(err, "combine shares")
+	}
+
+	if err = m.withLock(ctx, func() error {
+		sealed, err := m.readSealed()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if sealed == nil {
+			return errors.Errorf("keyring file `%s` not found", m.path)
+		}
+
+		key, err := gcrypto.DeriveKeyByHKDF(masterKey, sealed.Salt, masterKeyLen)
+		if err != nil {
+			return errors.Wrap(err, "derive key from master key")
+		}
+
+		ring, err := unsealKeyring(sealed, key)
+		if err != nil {
+			return errors.Wrap(err, "invalid shares")
+		}
+
+		m.sealMu.Lock()
+		m.masterKey = masterKey
+		m.sealMu.Unlock()
+
+		return m.merge(ctx, ring)
+	}); err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	m.opt.logger.Info("kms unsealed", zap.String("path", m.path))
+	return true, nil
+}
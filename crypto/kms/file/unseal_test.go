@@ -0,0 +1,92 @@
+//go:build !windows
+// +build !windows
+
+package file
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	gkms "github.com/Laisky/go-utils/v4/crypto/kms"
+)
+
+func TestNewSealed(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	shares, err := Init(ctx, path, 5, 3)
+	require.NoError(t, err)
+	require.Len(t, shares, 5)
+
+	_, err = Init(ctx, path, 5, 3)
+	require.ErrorContains(t, err, "already exists")
+	_, err = New(ctx, path, []byte("laisky"))
+	require.ErrorContains(t, err, "use NewSealed")
+
+	kms, err := NewSealed(ctx, path)
+	require.NoError(t, err)
+	require.Equal(t, gkms.StatusSealed, kms.Status())
+
+	_, err = kms.Encrypt(ctx, []byte("hello"), nil)
+	require.Error(t, err)
+	_, err = kms.Rotate(ctx)
+	require.ErrorContains(t, err, "kms is sealed")
+
+	for i, share := range shares[:3] {
+		unsealed, err := kms.SubmitUnsealShare(ctx, share)
+		require.NoError(t, err)
+		require.Equal(t, i == 2, unsealed)
+	}
+	require.Equal(t, gkms.StatusReady, kms.Status())
+
+	ed, err := kms.Encrypt(ctx, []byte("hello"), nil)
+	require.NoError(t, err)
+	require.Equal(t, uint16(1), ed.KekID)
+
+	kekID, err := kms.Rotate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint16(2), kekID)
+
+	t.Run("unseal by other shares", func(t *testing.T) {
+		kms2, err := NewSealed(ctx, path)
+		require.NoError(t, err)
+
+		for _, share := range shares[2:] {
+			_, err = kms2.SubmitUnsealShare(ctx, share)
+			require.NoError(t, err)
+		}
+		require.Equal(t, gkms.StatusReady, kms2.Status())
+
+		plaintext, err := kms2.Decrypt(ctx, ed, nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte("hello"), plaintext)
+
+		status, err := kms2.KekStatus(ctx, 2)
+		require.NoError(t, err)
+		require.Equal(t, gkms.KekStatusActive, status)
+	})
+
+	t.Run("invalid shares", func(t *testing.T) {
+		kms2, err := NewSealed(ctx, path)
+		require.NoError(t, err)
+
+		corrupted := append([]byte{}, shares[0]...)
+		corrupted[1] ^= 0xff
+		_, err = kms2.SubmitUnsealShare(ctx, corrupted)
+		require.NoError(t, err)
+		_, err = kms2.SubmitUnsealShare(ctx, shares[1])
+		require.NoError(t, err)
+		_, err = kms2.SubmitUnsealShare(ctx, shares[2])
+		require.ErrorContains(t, err, "invalid shares")
+		require.Equal(t, gkms.StatusSealed, kms2.Status())
+
+		// progress is reset after failure
+		submitted, threshold := kms2.UnsealProgress()
+		require.Equal(t, 0, submitted)
+		require.Equal(t, 3, threshold)
+	})
+}
@@ -29,6 +29,16 @@ type Interface interface {
 	// Decrypt decrypt data
 	Decrypt(ctx context.Context,
 		ed *EncryptedData, additionalData []byte) (plaintext []byte, err error)
+	// Rotate generate new random kek and use it as current kek,
+	// previous kek will become decrypt-only
+	Rotate(ctx context.Context) (kekID uint16, err error)
+	// Rewrap re-encrypt data by current kek
+	Rewrap(ctx context.Context,
+		ed *EncryptedData, additionalData []byte) (newEd *EncryptedData, err error)
+	// RetireKek retire kek, retired kek can not be used anymore
+	RetireKek(ctx context.Context, kekID uint16) error
+	// KekStatus get status of kek
+	KekStatus(ctx context.Context, kekID uint16) (KekStatus, error)
 }
 
 // Status status of kms
@@ -43,6 +53,8 @@ func (s Status) String() string {
 		return "no_kek"
 	case StatusReady:
 		return "ready"
+	case StatusSealed:
+		return "sealed"
 	}
 
 	return fmt.Sprintf("unknown status %d", s)
@@ -55,4 +67,32 @@ const (
 	StatusNoKeK
 	// StatusReady status ok
 	StatusReady
+	// StatusSealed kms is sealed, need to be unsealed before use
+	StatusSealed
+)
+
+// KekStatus status of kek
+type KekStatus uint8
+
+// String return string of kek status
+func (s KekStatus) String() string {
+	switch s {
+	case KekStatusActive:
+		return "active"
+	case KekStatusDecryptOnly:
+		return "decrypt_only"
+	case KekStatusRetired:
+		return "retired"
+	}
+
+	return fmt.Sprintf("unknown kek status %d", s)
+}
+
+const (
+	// KekStatusActive current kek, used to derive new dek
+	KekStatusActive KekStatus = iota
+	// KekStatusDecryptOnly old kek, can only be used to decrypt existing data
+	KekStatusDecryptOnly
+	// KekStatusRetired retired kek, can not be used anymore
+	KekStatusRetired
 )
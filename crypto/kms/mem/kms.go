@@ -3,6 +3,7 @@ package mem
 
 import (
 	"context"
+	"math"
 	"sync"
 
 	"github.com/Laisky/errors/v2"
@@ -30,6 +31,8 @@ type KMS struct {
 	//  map[uint16][]byte
 	keks   sync.Map
 	status gkms.Status
+	// retired contains all retired kek ids
+	retired map[uint16]struct{}
 
 	maxKeyID uint16
 }
@@ -38,6 +41,7 @@ type kmsOption struct {
 	logger    glog.Logger
 	aesKeyLen int
 	dekIDLen  int
+	kekLen    int
 }
 
 // KMSOption optional arguments for kms
@@ -46,6 +50,7 @@ type KMSOption func(*kmsOption) error
 func (o *kmsOption) fillDefault() *kmsOption {
 	o.aesKeyLen = 32
 	o.dekIDLen = 128 // 2^1024
+	o.kekLen = 32
 	o.logger = glog.Shared.Named("kms")
 
 	return o
@@ -81,6 +86,20 @@ func WithDekKeyLen(keyLen int) KMSOption {
 	}
 }
 
+// WithKekLen (optional) set length of kek generated by Rotate
+//
+// default to 32
+func WithKekLen(keyLen int) KMSOption {
+	return func(o *kmsOption) error {
+		if keyLen <= 0 {
+			return errors.Errorf("kek length should be positive")
+		}
+
+		o.kekLen = keyLen
+		return nil
+	}
+}
+
 // WithLogger (optional) set internal logger
 //
 // default to gutils logger
@@ -100,7 +119,8 @@ func New(keks map[uint16][]byte,
 	}
 
 	kms := &KMS{
-		opt: opt,
+		opt:     opt,
+		retired: make(map[uint16]struct{}),
 	}
 
 	if len(keks) > 0 {
@@ -224,6 +244,10 @@ func (m *KMS) DeriveKeyByID(_ context.Context,
 		return nil, errors.Errorf("kek %d not found", kekID)
 	}
 
+	if m.isRetired(kekID) {
+		return nil, errors.Errorf("kek %d is retired", kekID)
+	}
+
 	kek, ok := keki.([]byte)
 	if !ok {
 		return nil, errors.Errorf("kek %d in wrong type %T", kekID, keki)
@@ -322,3 +346,109 @@ func (m *KMS) Decrypt(ctx context.Context,
 
 	return plaintext, nil
 }
+
+// Rotate generate new random kek and use it as current kek
+//
+// new kek id is current max kek id plus one,
+// previous kek will become decrypt-only.
+func (m *KMS) Rotate(_ context.Context) (kekID uint16, err error) {
+	kek, err := gcrypto.Salt(m.opt.kekLen)
+	if err != nil {
+		return 0, errors.Wrap(err, "generate kek")
+	}
+
+	m.mu.Lock()
+	if m.maxKeyID == math.MaxUint16 {
+		m.mu.Unlock()
+		return 0, errors.Errorf("kek id exhausted")
+	}
+
+	kekID = m.maxKeyID + 1
+	m.keks.Store(kekID, kek)
+	m.maxKeyID = kekID
+	m.mu.Unlock()
+
+	m.setStatus(gkms.StatusReady)
+	m.opt.logger.Info("rotate kek", zap.Uint16("kek_id", kekID))
+	return kekID, nil
+}
+
+// Rewrap re-encrypt data by current kek
+//
+// return ed itself if it is already encrypted by current kek.
+func (m *KMS) Rewrap(ctx context.Context,
+	ed *gkms.EncryptedData,
+	additionalData []byte) (newEd *gkms.EncryptedData, err error) {
+	if err = m.statusShouldBe(gkms.StatusReady); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	m.mu.RLock()
+	currentKekID := m.maxKeyID
+	m.mu.RUnlock()
+	if ed.KekID == currentKekID {
+		return ed, nil
+	}
+
+	plaintext, err := m.Decrypt(ctx, ed, additionalData)
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypt by old kek")
+	}
+
+	newEd, err = m.Encrypt(ctx, plaintext, additionalData)
+	if err != nil {
+		return nil, errors.Wrap(err, "encrypt by current kek")
+	}
+
+	return newEd, nil
+}
+
+// RetireKek retire kek
+//
+// retired kek can not be used to derive dek or decrypt data anymore,
+// you should rewrap all data encrypted by this kek before retire it.
+// current active kek can not be retired.
+func (m *KMS) RetireKek(_ context.Context, kekID uint16) error {
+	if err := m.statusShouldBe(gkms.StatusReady); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, ok := m.keks.Load(kekID); !ok {
+		return errors.Errorf("kek %d not found", kekID)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if kekID == m.maxKeyID {
+		return errors.Errorf("can not retire active kek %d", kekID)
+	}
+
+	m.retired[kekID] = struct{}{}
+	m.opt.logger.Info("retire kek", zap.Uint16("kek_id", kekID))
+	return nil
+}
+
+// KekStatus return status of kek
+func (m *KMS) KekStatus(_ context.Context, kekID uint16) (gkms.KekStatus, error) {
+	if _, ok := m.keks.Load(kekID); !ok {
+		return 0, errors.Errorf("kek %d not found", kekID)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.retired[kekID]; ok {
+		return gkms.KekStatusRetired, nil
+	}
+	if kekID == m.maxKeyID {
+		return gkms.KekStatusActive, nil
+	}
+
+	return gkms.KekStatusDecryptOnly, nil
+}
+
+func (m *KMS) isRetired(kekID uint16) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.retired[kekID]
+	return ok
+}
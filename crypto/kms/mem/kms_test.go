@@ -2,7 +2,9 @@
 package mem
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"math/rand"
 	"sync"
 	"testing"
@@ -134,3 +136,115 @@ func TestKMS_Decrypt(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestKMS_EncryptStream(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	mk, err := gcrypto.Salt(128)
+	require.NoError(t, err)
+	kms, err := New(map[uint16][]byte{1: mk})
+	require.NoError(t, err)
+
+	plaintext, err := gcrypto.Salt(gcrypto.DefaultAEADStreamSegmentSize*2 + 100)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w, err := gkms.EncryptStream(ctx, kms, &buf, []byte("laisky"))
+	require.NoError(t, err)
+	_, err = io.Copy(w, bytes.NewReader(plaintext))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	ciphertext := buf.Bytes()
+
+	// rotate kek, old stream should still be decryptable
+	mk2, err := gcrypto.Salt(128)
+	require.NoError(t, err)
+	require.NoError(t, kms.AddKek(ctx, 2, mk2))
+
+	r, err := gkms.DecryptStream(ctx, kms, bytes.NewReader(ciphertext), []byte("laisky"))
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, got)
+
+	t.Run("wrong additional data", func(t *testing.T) {
+		r, err := gkms.DecryptStream(ctx, kms, bytes.NewReader(ciphertext), []byte("laisky2"))
+		require.NoError(t, err)
+		_, err = io.ReadAll(r)
+		require.ErrorContains(t, err, "message authentication failed")
+	})
+
+	t.Run("tampered header", func(t *testing.T) {
+		tampered := append([]byte{}, ciphertext...)
+		tampered[3] = 2 // kek id
+		r, err := gkms.DecryptStream(ctx, kms, bytes.NewReader(tampered), []byte("laisky"))
+		require.NoError(t, err)
+		_, err = io.ReadAll(r)
+		require.ErrorContains(t, err, "message authentication failed")
+	})
+
+	t.Run("unknown kek", func(t *testing.T) {
+		tampered := append([]byte{}, ciphertext...)
+		tampered[3] = 100
+		_, err := gkms.DecryptStream(ctx, kms, bytes.NewReader(tampered), []byte("laisky"))
+		require.ErrorContains(t, err, "kek 100 not found")
+	})
+}
+
+func TestKMS_Rotate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	kms, err := New(nil)
+	require.NoError(t, err)
+	require.Equal(t, gkms.StatusNoKeK, kms.Status())
+
+	kekID1, err := kms.Rotate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint16(1), kekID1)
+	require.Equal(t, gkms.StatusReady, kms.Status())
+
+	ed, err := kms.Encrypt(ctx, []byte("hello"), []byte("laisky"))
+	require.NoError(t, err)
+	require.Equal(t, kekID1, ed.KekID)
+
+	kekID2, err := kms.Rotate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint16(2), kekID2)
+
+	status, err := kms.KekStatus(ctx, kekID1)
+	require.NoError(t, err)
+	require.Equal(t, gkms.KekStatusDecryptOnly, status)
+	status, err = kms.KekStatus(ctx, kekID2)
+	require.NoError(t, err)
+	require.Equal(t, gkms.KekStatusActive, status)
+	_, err = kms.KekStatus(ctx, 100)
+	require.ErrorContains(t, err, "kek 100 not found")
+
+	newEd, err := kms.Rewrap(ctx, ed, []byte("laisky"))
+	require.NoError(t, err)
+	require.Equal(t, kekID2, newEd.KekID)
+
+	sameEd, err := kms.Rewrap(ctx, newEd, []byte("laisky"))
+	require.NoError(t, err)
+	require.Equal(t, newEd, sameEd)
+
+	_, err = kms.Rewrap(ctx, ed, []byte("wrong"))
+	require.ErrorContains(t, err, "message authentication failed")
+
+	require.ErrorContains(t, kms.RetireKek(ctx, kekID2), "can not retire active kek")
+	require.ErrorContains(t, kms.RetireKek(ctx, 100), "kek 100 not found")
+	require.NoError(t, kms.RetireKek(ctx, kekID1))
+
+	status, err = kms.KekStatus(ctx, kekID1)
+	require.NoError(t, err)
+	require.Equal(t, gkms.KekStatusRetired, status)
+
+	_, err = kms.Decrypt(ctx, ed, []byte("laisky"))
+	require.ErrorContains(t, err, "kek 1 is retired")
+
+	plaintext, err := kms.Decrypt(ctx, newEd, []byte("laisky"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), plaintext)
+}
@@ -0,0 +1,160 @@
+package kms
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+
+	"github.com/Laisky/errors/v2"
+
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+)
+
+// EncryptedStreamVer version of encrypted stream header
+type EncryptedStreamVer uint8
+
+const (
+	// EncryptedStreamVer1 encrypted stream in ver1 layout
+	//
+	// layout:
+	//
+	//  - [0,1): version
+	//  - [1,3): dek id length
+	//  - [3,5): kek id
+	//  - [5,5+len(dek id)): dek id
+	//  - [5+len(dek id),...): ciphertext stream generated by gcrypto.AEADEncryptWriter
+	//
+	// header is authenticated as additional data of every segment.
+	EncryptedStreamVer1 EncryptedStreamVer = iota + 1
+)
+
+// streamDekLen length of dek used to encrypt stream
+const streamDekLen = 32
+
+// String name
+func (e EncryptedStreamVer) String() string {
+	switch e {
+	case EncryptedStreamVer1:
+		return "encrypted_stream_ver_1"
+	}
+
+	return "encrypted_stream_unimplemented"
+}
+
+// StreamHeader self-describing header of encrypted stream
+type StreamHeader struct {
+	Version EncryptedStreamVer
+	KekID   uint16
+	DekID   []byte
+}
+
+// Marshal marshal to bytes
+func (h StreamHeader) Marshal() (data []byte, err error) {
+	switch h.Version {
+	case EncryptedStreamVer1:
+		if len(h.DekID) > 0xffff {
+			return nil, errors.Errorf("dek id too long")
+		}
+
+		data = make([]byte, 5+len(h.DekID))
+		data[0] = byte(h.Version)
+		binary.LittleEndian.PutUint16(data[1:3], uint16(len(h.DekID)))
+		binary.LittleEndian.PutUint16(data[3:5], h.KekID)
+		copy(data[5:], h.DekID)
+	default:
+		return nil, errors.Errorf("unknown version %q", h.Version.String())
+	}
+
+	return data, nil
+}
+
+// ReadStreamHeader read header from the beginning of encrypted stream
+func ReadStreamHeader(r io.Reader) (h *StreamHeader, err error) {
+	prefix := make([]byte, 5)
+	if _, err = io.ReadFull(r, prefix); err != nil {
+		return nil, errors.Wrap(err, "read header")
+	}
+
+	h = &StreamHeader{
+		Version: EncryptedStreamVer(prefix[0]),
+	}
+	switch h.Version {
+	case EncryptedStreamVer1:
+		h.KekID = binary.LittleEndian.Uint16(prefix[3:5])
+		h.DekID = make([]byte, binary.LittleEndian.Uint16(prefix[1:3]))
+		if _, err = io.ReadFull(r, h.DekID); err != nil {
+			return nil, errors.Wrap(err, "read dek id")
+		}
+	default:
+		return nil, errors.Errorf("unknown version %q", h.Version.String())
+	}
+
+	return h, nil
+}
+
+// EncryptStream encrypt stream by envelope encryption
+//
+// derive a new dek by kms.DeriveKey, write header to w,
+// then return a writer that encrypt all content written to it.
+// the memory usage is flat no matter how large the content is.
+//
+// you should call Close to finish the stream,
+// Close will not close w.
+func EncryptStream(ctx context.Context, kms Interface,
+	w io.Writer, additionalData []byte) (io.WriteCloser, error) {
+	kekID, dekID, dek, err := kms.DeriveKey(ctx, streamDekLen)
+	if err != nil {
+		return nil, errors.Wrap(err, "derive dek")
+	}
+
+	header, err := StreamHeader{
+		Version: EncryptedStreamVer1,
+		KekID:   kekID,
+		DekID:   dekID,
+	}.Marshal()
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal header")
+	}
+
+	if _, err = w.Write(header); err != nil {
+		return nil, errors.Wrap(err, "write header")
+	}
+
+	writer, err := gcrypto.NewAEADEncryptWriter(w, dek,
+		gcrypto.WithAEADStreamAdditionalData(append(header, additionalData...)))
+	if err != nil {
+		return nil, errors.Wrap(err, "new encrypt writer")
+	}
+
+	return writer, nil
+}
+
+// DecryptStream decrypt stream encrypted by EncryptStream
+//
+// read header from r, derive dek by kms.DeriveKeyByID,
+// then return a reader that decrypt all content from r.
+func DecryptStream(ctx context.Context, kms Interface,
+	r io.Reader, additionalData []byte) (io.Reader, error) {
+	h, err := ReadStreamHeader(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	header, err := h.Marshal()
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal header")
+	}
+
+	dek, err := kms.DeriveKeyByID(ctx, h.KekID, h.DekID, streamDekLen)
+	if err != nil {
+		return nil, errors.Wrap(err, "derive dek")
+	}
+
+	reader, err := gcrypto.NewAEADDecryptReader(r, dek,
+		gcrypto.WithAEADStreamAdditionalData(append(header, additionalData...)))
+	if err != nil {
+		return nil, errors.Wrap(err, "new decrypt reader")
+	}
+
+	return reader, nil
+}
@@ -0,0 +1,41 @@
+package kms
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+func TestStreamHeader_Marshal(t *testing.T) {
+	t.Parallel()
+
+	h := StreamHeader{
+		Version: EncryptedStreamVer1,
+		KekID:   3,
+		DekID:   []byte(gutils.RandomStringWithLength(128)),
+	}
+
+	data, err := h.Marshal()
+	require.NoError(t, err)
+
+	got, err := ReadStreamHeader(bytes.NewReader(append(data, "tail"...)))
+	require.NoError(t, err)
+	require.Equal(t, h, *got)
+
+	t.Run("error", func(t *testing.T) {
+		_, err := ReadStreamHeader(bytes.NewReader([]byte{1, 2}))
+		require.ErrorContains(t, err, "read header")
+
+		_, err = ReadStreamHeader(bytes.NewReader([]byte{100, 0, 0, 0, 0}))
+		require.ErrorContains(t, err, "encrypted_stream_unimplemented")
+
+		_, err = ReadStreamHeader(bytes.NewReader(data[:len(data)-1]))
+		require.ErrorContains(t, err, "read dek id")
+
+		_, err = StreamHeader{}.Marshal()
+		require.ErrorContains(t, err, "unknown version")
+	})
+}
@@ -0,0 +1,235 @@
+package merkle
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	glog "github.com/Laisky/go-utils/v4/log"
+)
+
+const (
+	fileStoreEntriesName = "entries"
+	fileStoreHashesName  = "hashes"
+	// fileStoreMaxEntrySize avoid allocating huge memory by corrupted file
+	fileStoreMaxEntrySize = 1 << 24
+)
+
+var (
+	_ Store = new(FileStore)
+)
+
+// FileStore file based store
+//
+// entries are appended to file `entries` as 4 bytes big-endian length with data,
+// leaf hashes are appended to file `hashes`.
+// all leaf hashes are loaded into memory when open.
+//
+// entry is committed after its leaf hash is synced to disk,
+// uncommitted data left by crash will be truncated when open.
+type FileStore struct {
+	mu      sync.RWMutex
+	entries *os.File
+	hashes  *os.File
+
+	leafHashes [][]byte
+	// offsets offset of each entry in entries file
+	offsets []int64
+	// index map[leafHash]index
+	index map[string]uint64
+	// entriesSize size of committed entries
+	entriesSize int64
+}
+
+// NewFileStore open or create file based store in dir
+func NewFileStore(dir string) (s *FileStore, err error) {
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "create dir %q", dir)
+	}
+
+	s = &FileStore{
+		index: map[string]uint64{},
+	}
+	if s.entries, err = os.OpenFile(filepath.Join(dir, fileStoreEntriesName),
+		os.O_RDWR|os.O_CREATE, 0600); err != nil {
+		return nil, errors.Wrap(err, "open entries file")
+	}
+	if s.hashes, err = os.OpenFile(filepath.Join(dir, fileStoreHashesName),
+		os.O_RDWR|os.O_CREATE, 0600); err != nil {
+		_ = s.entries.Close()
+		return nil, errors.Wrap(err, "open hashes file")
+	}
+
+	if err = s.load(); err != nil {
+		_ = s.Close()
+		return nil, errors.Wrap(err, "load store")
+	}
+
+	return s, nil
+}
+
+// load read leaf hashes and entry offsets, truncate uncommitted data
+func (s *FileStore) load() error {
+	hashes, err := io.ReadAll(s.hashes)
+	if err != nil {
+		return errors.Wrap(err, "read hashes")
+	}
+
+	stat, err := s.entries.Stat()
+	if err != nil {
+		return errors.Wrap(err, "stat entries")
+	}
+
+	var (
+		lenBuf [4]byte
+		offset int64
+	)
+	for i := 0; (i+1)*HashSize <= len(hashes) && offset+4 <= stat.Size(); i++ {
+		if _, err = s.entries.ReadAt(lenBuf[:], offset); err != nil {
+			return errors.Wrapf(err, "read length of entry %d", i)
+		}
+
+		entryLen := int64(binary.BigEndian.Uint32(lenBuf[:]))
+		if entryLen > fileStoreMaxEntrySize {
+			return errors.Errorf("entry %d is too large", i)
+		}
+		if offset+4+entryLen > stat.Size() {
+			// incomplete entry
+			break
+		}
+
+		leafHash := hashes[i*HashSize : (i+1)*HashSize]
+		s.offsets = append(s.offsets, offset)
+		s.leafHashes = append(s.leafHashes, leafHash)
+		if _, ok := s.index[string(leafHash)]; !ok {
+			s.index[string(leafHash)] = uint64(i)
+		}
+
+		offset += 4 + entryLen
+	}
+
+	if len(s.leafHashes)*HashSize != len(hashes) {
+		glog.Shared.Warn("truncate uncommitted leaf hashes",
+			zap.Int("committed", len(s.leafHashes)),
+			zap.Int("total", len(hashes)/HashSize))
+		if err = s.hashes.Truncate(int64(len(s.leafHashes) * HashSize)); err != nil {
+			return errors.Wrap(err, "truncate hashes")
+		}
+	}
+
+	if err = s.entries.Truncate(offset); err != nil {
+		return errors.Wrap(err, "truncate entries")
+	}
+
+	s.entriesSize = offset
+	return nil
+}
+
+// Close close files
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return errors.Join(s.entries.Close(), s.hashes.Close())
+}
+
+// Append append entry, block until synced to disk
+func (s *FileStore) Append(_ context.Context, entry, leafHash []byte) (uint64, error) {
+	if len(leafHash) != HashSize {
+		return 0, errors.Errorf("leaf hash should be %d bytes", HashSize)
+	}
+	if len(entry) > fileStoreMaxEntrySize {
+		return 0, errors.Errorf("entry should not be larger than %d bytes", fileStoreMaxEntrySize)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := make([]byte, 4+len(entry))
+	binary.BigEndian.PutUint32(buf, uint32(len(entry)))
+	copy(buf[4:], entry)
+	if _, err := s.entries.WriteAt(buf, s.entriesSize); err != nil {
+		return 0, errors.Wrap(err, "write entry")
+	}
+	if err := s.entries.Sync(); err != nil {
+		return 0, errors.Wrap(err, "sync entries")
+	}
+
+	idx := uint64(len(s.leafHashes))
+	if _, err := s.hashes.WriteAt(leafHash, int64(idx)*HashSize); err != nil {
+		return 0, errors.Wrap(err, "write leaf hash")
+	}
+	if err := s.hashes.Sync(); err != nil {
+		return 0, errors.Wrap(err, "sync hashes")
+	}
+
+	s.offsets = append(s.offsets, s.entriesSize)
+	s.entriesSize += int64(len(buf))
+	s.leafHashes = append(s.leafHashes, append([]byte{}, leafHash...))
+	if _, ok := s.index[string(leafHash)]; !ok {
+		s.index[string(leafHash)] = idx
+	}
+
+	return idx, nil
+}
+
+// Size number of entries
+func (s *FileStore) Size(_ context.Context) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return uint64(len(s.leafHashes)), nil
+}
+
+// LeafHashes leaf hashes in [start, end)
+func (s *FileStore) LeafHashes(_ context.Context, start, end uint64) ([][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if start > end || end > uint64(len(s.leafHashes)) {
+		return nil, errors.Errorf("range [%d, %d) out of size %d", start, end, len(s.leafHashes))
+	}
+
+	return append([][]byte{}, s.leafHashes[start:end]...), nil
+}
+
+// Entry read entry by index
+func (s *FileStore) Entry(_ context.Context, index uint64) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if index >= uint64(len(s.offsets)) {
+		return nil, errors.Wrapf(ErrNotFound, "entry %d", index)
+	}
+
+	var lenBuf [4]byte
+	if _, err := s.entries.ReadAt(lenBuf[:], s.offsets[index]); err != nil {
+		return nil, errors.Wrapf(err, "read length of entry %d", index)
+	}
+
+	entry := make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+	if _, err := s.entries.ReadAt(entry, s.offsets[index]+4); err != nil {
+		return nil, errors.Wrapf(err, "read entry %d", index)
+	}
+
+	return entry, nil
+}
+
+// LeafIndex get index by leaf hash
+func (s *FileStore) LeafIndex(_ context.Context, leafHash []byte) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx, ok := s.index[string(leafHash)]
+	if !ok {
+		return 0, errors.WithStack(ErrNotFound)
+	}
+
+	return idx, nil
+}
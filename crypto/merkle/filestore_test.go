@@ -0,0 +1,82 @@
+package merkle
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+	testStore(t, store)
+	require.NoError(t, store.Close())
+
+	t.Run("reopen", func(t *testing.T) {
+		store, err := NewFileStore(dir)
+		require.NoError(t, err)
+		defer store.Close()
+
+		size, err := store.Size(ctx)
+		require.NoError(t, err)
+		require.EqualValues(t, 4, size)
+
+		entry, err := store.Entry(ctx, 1)
+		require.NoError(t, err)
+		require.Equal(t, []byte("bb"), entry)
+
+		idx, err := store.Append(ctx, []byte("ccc"), HashLeaf([]byte("ccc")))
+		require.NoError(t, err)
+		require.EqualValues(t, 4, idx)
+
+		_, err = store.Append(ctx, []byte("ccc"), []byte("short"))
+		require.Error(t, err)
+	})
+
+	t.Run("truncate uncommitted", func(t *testing.T) {
+		// entry written without leaf hash
+		f, err := os.OpenFile(filepath.Join(dir, fileStoreEntriesName), os.O_APPEND|os.O_WRONLY, 0600)
+		require.NoError(t, err)
+		_, err = f.Write([]byte{0, 0, 0, 3, 'd', 'd'})
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		store, err := NewFileStore(dir)
+		require.NoError(t, err)
+
+		size, err := store.Size(ctx)
+		require.NoError(t, err)
+		require.EqualValues(t, 5, size)
+
+		idx, err := store.Append(ctx, []byte("eeeee"), HashLeaf([]byte("eeeee")))
+		require.NoError(t, err)
+		require.EqualValues(t, 5, idx)
+		require.NoError(t, store.Close())
+
+		// leaf hash written without complete entry
+		f, err = os.OpenFile(filepath.Join(dir, fileStoreHashesName), os.O_APPEND|os.O_WRONLY, 0600)
+		require.NoError(t, err)
+		_, err = f.Write(HashLeaf([]byte("f")))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		store, err = NewFileStore(dir)
+		require.NoError(t, err)
+		defer store.Close()
+
+		size, err = store.Size(ctx)
+		require.NoError(t, err)
+		require.EqualValues(t, 6, size)
+
+		entry, err := store.Entry(ctx, 5)
+		require.NoError(t, err)
+		require.Equal(t, []byte("eeeee"), entry)
+	})
+}
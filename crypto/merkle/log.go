@@ -0,0 +1,256 @@
+package merkle
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+)
+
+// Log append-only Merkle tree log
+//
+// hashes of subtrees are cached in memory, rebuilt from store's leaf hashes
+// on first use after opened.
+type Log struct {
+	store  Store
+	signer crypto.Signer
+
+	// mu serialize appending and protect cache
+	mu    sync.Mutex
+	cache *treeCache
+}
+
+// New new log
+//
+// # Args
+//   - store: persistence of entries
+//   - prikey: private key to sign tree heads, rsa/ecdsa/ed25519
+func New(store Store, prikey crypto.PrivateKey) (*Log, error) {
+	if store == nil {
+		return nil, errors.Errorf("store should not be empty")
+	}
+
+	signer := gcrypto.Privkey2Signer(prikey)
+	if signer == nil {
+		return nil, errors.Errorf("unsupported private key type %T", prikey)
+	}
+
+	return &Log{
+		store:  store,
+		signer: signer,
+		cache:  new(treeCache),
+	}, nil
+}
+
+// syncCache load leaf hashes not in cache from store,
+// return current tree size, l.mu should be held.
+func (l *Log) syncCache(ctx context.Context) (size uint64, err error) {
+	size, err = l.store.Size(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "get tree size")
+	}
+
+	if cached := l.cache.size(); cached < size {
+		leafHashes, err := l.store.LeafHashes(ctx, cached, size)
+		if err != nil {
+			return 0, errors.Wrap(err, "get leaf hashes")
+		}
+
+		l.cache.append(leafHashes...)
+	}
+
+	return l.cache.size(), nil
+}
+
+// Pubkey public key to verify signed tree heads
+func (l *Log) Pubkey() crypto.PublicKey {
+	return l.signer.Public()
+}
+
+// Append append entry to log, return its index
+func (l *Log) Append(ctx context.Context, entry []byte) (index uint64, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	index, err = l.store.Append(ctx, entry, HashLeaf(entry))
+	if err != nil {
+		return 0, errors.Wrap(err, "append entry")
+	}
+
+	return index, nil
+}
+
+// LogCert append certificate in DER to log,
+// can be used as issuance hook of certificate authority.
+//
+// if certificate is signed by crypto.NewX509CertByCSR directly,
+// call it after certificate is persisted.
+func (l *Log) LogCert(ctx context.Context, certDer []byte) error {
+	_, err := l.Append(ctx, certDer)
+	return err
+}
+
+// Entry get entry by index
+func (l *Log) Entry(ctx context.Context, index uint64) ([]byte, error) {
+	return l.store.Entry(ctx, index)
+}
+
+// SignTreeHead sign tree head of current tree
+func (l *Log) SignTreeHead(ctx context.Context) (*SignedTreeHead, error) {
+	l.mu.Lock()
+	size, err := l.syncCache(ctx)
+	if err != nil {
+		l.mu.Unlock()
+		return nil, err
+	}
+
+	sth := &SignedTreeHead{
+		TreeSize:  size,
+		Timestamp: gutils.Clock.GetUTCNow().Truncate(time.Millisecond),
+		RootHash:  l.cache.hash(0, size),
+	}
+	l.mu.Unlock()
+
+	data := sth.signedData()
+	if _, ok := l.signer.Public().(ed25519.PublicKey); ok {
+		sth.Signature, err = l.signer.Sign(rand.Reader, data, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(data)
+		sth.Signature, err = l.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "sign tree head")
+	}
+
+	return sth, nil
+}
+
+// InclusionProof proof of index-th entry in tree with treeSize
+func (l *Log) InclusionProof(ctx context.Context, index, treeSize uint64) ([][]byte, error) {
+	if index >= treeSize {
+		return nil, errors.Errorf("index %d out of tree size %d", index, treeSize)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	size, err := l.syncCache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if treeSize > size {
+		return nil, errors.Errorf("tree size %d out of log size %d", treeSize, size)
+	}
+
+	return l.cache.inclusionProof(index, 0, treeSize), nil
+}
+
+// ProveEntry find entry in tree with treeSize, return its index and inclusion proof,
+// return ErrNotFound if entry not in tree.
+func (l *Log) ProveEntry(ctx context.Context, entry []byte, treeSize uint64) (
+	index uint64, proof [][]byte, err error) {
+	index, err = l.store.LeafIndex(ctx, HashLeaf(entry))
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "find entry")
+	}
+	if index >= treeSize {
+		return 0, nil, errors.Wrapf(ErrNotFound, "entry is not in tree of size %d", treeSize)
+	}
+
+	proof, err = l.InclusionProof(ctx, index, treeSize)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return index, proof, nil
+}
+
+// ConsistencyProof proof that tree with size1 is prefix of tree with size2
+func (l *Log) ConsistencyProof(ctx context.Context, size1, size2 uint64) ([][]byte, error) {
+	if size1 > size2 {
+		return nil, errors.Errorf("size1 %d should not be greater than size2 %d", size1, size2)
+	}
+	if size1 == 0 || size1 == size2 {
+		return nil, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	size, err := l.syncCache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if size2 > size {
+		return nil, errors.Errorf("size2 %d out of log size %d", size2, size)
+	}
+
+	return l.cache.consistencyProof(size1, 0, size2, true), nil
+}
+
+// SignedTreeHead tree head signed by log
+type SignedTreeHead struct {
+	TreeSize uint64 `json:"tree_size"`
+	// Timestamp in milliseconds precision
+	Timestamp time.Time `json:"timestamp"`
+	RootHash  []byte    `json:"sha256_root_hash"`
+	Signature []byte    `json:"tree_head_signature"`
+}
+
+// signedData TreeHeadSignature defined in RFC 6962 3.5
+func (h *SignedTreeHead) signedData() []byte {
+	data := make([]byte, 0, 2+8+8+len(h.RootHash))
+	data = append(data,
+		0, // version v1
+		1, // signature type tree_hash
+	)
+	data = binary.BigEndian.AppendUint64(data, uint64(h.Timestamp.UnixMilli()))
+	data = binary.BigEndian.AppendUint64(data, h.TreeSize)
+	return append(data, h.RootHash...)
+}
+
+// Verify verify signature by log's public key
+func (h *SignedTreeHead) Verify(pubkey crypto.PublicKey) error {
+	data := h.signedData()
+	digest := sha256.Sum256(data)
+
+	switch pubkey := pubkey.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pubkey, crypto.SHA256, digest[:], h.Signature); err != nil {
+			return errors.Wrap(err, "invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pubkey, digest[:], h.Signature) {
+			return errors.Errorf("invalid signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pubkey, data, h.Signature) {
+			return errors.Errorf("invalid signature")
+		}
+	default:
+		return errors.Errorf("unsupported public key type %T", pubkey)
+	}
+
+	return nil
+}
+
+// VerifyInclusion verify entry is the index-th entry of this tree
+func (h *SignedTreeHead) VerifyInclusion(entry []byte, index uint64, proof [][]byte) error {
+	return VerifyInclusion(HashLeaf(entry), index, h.TreeSize, proof, h.RootHash)
+}
+
+// VerifyConsistency verify this tree is prefix of newer tree
+func (h *SignedTreeHead) VerifyConsistency(newer *SignedTreeHead, proof [][]byte) error {
+	return VerifyConsistency(h.TreeSize, newer.TreeSize, proof, h.RootHash, newer.RootHash)
+}
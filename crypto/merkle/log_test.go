@@ -0,0 +1,138 @@
+package merkle
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+)
+
+func TestLog(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	rsaPrikey, err := gcrypto.NewRSAPrikey(gcrypto.RSAPrikeyBits2048)
+	require.NoError(t, err)
+	ecdsaPrikey, err := gcrypto.NewECDSAPrikey(gcrypto.ECDSACurveP256)
+	require.NoError(t, err)
+	edPrikey, err := gcrypto.NewEd25519Prikey()
+	require.NoError(t, err)
+
+	for _, prikey := range []crypto.PrivateKey{rsaPrikey, ecdsaPrikey, edPrikey} {
+		t.Run(fmt.Sprintf("%T", prikey), func(t *testing.T) {
+			t.Parallel()
+
+			log, err := New(NewMemoryStore(), prikey)
+			require.NoError(t, err)
+
+			empty, err := log.SignTreeHead(ctx)
+			require.NoError(t, err)
+			require.Zero(t, empty.TreeSize)
+			require.NoError(t, empty.Verify(log.Pubkey()))
+
+			for i := 0; i < 5; i++ {
+				idx, err := log.Append(ctx, []byte(fmt.Sprintf("entry-%d", i)))
+				require.NoError(t, err)
+				require.EqualValues(t, i, idx)
+			}
+
+			sth1, err := log.SignTreeHead(ctx)
+			require.NoError(t, err)
+			require.EqualValues(t, 5, sth1.TreeSize)
+			require.NoError(t, sth1.Verify(log.Pubkey()))
+
+			for i := 5; i < 11; i++ {
+				require.NoError(t, log.LogCert(ctx, []byte(fmt.Sprintf("entry-%d", i))))
+			}
+
+			sth2, err := log.SignTreeHead(ctx)
+			require.NoError(t, err)
+			require.EqualValues(t, 11, sth2.TreeSize)
+			require.NoError(t, sth2.Verify(log.Pubkey()))
+
+			// inclusion
+			idx, proof, err := log.ProveEntry(ctx, []byte("entry-3"), sth1.TreeSize)
+			require.NoError(t, err)
+			require.EqualValues(t, 3, idx)
+			require.NoError(t, sth1.VerifyInclusion([]byte("entry-3"), idx, proof))
+			require.Error(t, sth1.VerifyInclusion([]byte("entry-4"), idx, proof))
+
+			_, _, err = log.ProveEntry(ctx, []byte("entry-7"), sth1.TreeSize)
+			require.ErrorIs(t, err, ErrNotFound)
+			_, _, err = log.ProveEntry(ctx, []byte("not exists"), sth2.TreeSize)
+			require.ErrorIs(t, err, ErrNotFound)
+
+			idx, proof, err = log.ProveEntry(ctx, []byte("entry-7"), sth2.TreeSize)
+			require.NoError(t, err)
+			require.NoError(t, sth2.VerifyInclusion([]byte("entry-7"), idx, proof))
+
+			entry, err := log.Entry(ctx, idx)
+			require.NoError(t, err)
+			require.Equal(t, []byte("entry-7"), entry)
+
+			// consistency
+			proof, err = log.ConsistencyProof(ctx, sth1.TreeSize, sth2.TreeSize)
+			require.NoError(t, err)
+			require.NoError(t, sth1.VerifyConsistency(sth2, proof))
+			require.Error(t, sth2.VerifyConsistency(sth1, proof))
+
+			proof, err = log.ConsistencyProof(ctx, empty.TreeSize, sth2.TreeSize)
+			require.NoError(t, err)
+			require.NoError(t, empty.VerifyConsistency(sth2, proof))
+
+			_, err = log.ConsistencyProof(ctx, sth2.TreeSize, sth1.TreeSize)
+			require.Error(t, err)
+			_, err = log.InclusionProof(ctx, sth2.TreeSize, sth2.TreeSize)
+			require.Error(t, err)
+
+			// tampered tree head
+			sth2.TreeSize++
+			require.Error(t, sth2.Verify(log.Pubkey()))
+		})
+	}
+
+	t.Run("reopen", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewMemoryStore()
+		log, err := New(store, edPrikey)
+		require.NoError(t, err)
+		for i := 0; i < 7; i++ {
+			_, err = log.Append(ctx, []byte(fmt.Sprintf("entry-%d", i)))
+			require.NoError(t, err)
+		}
+		sth1, err := log.SignTreeHead(ctx)
+		require.NoError(t, err)
+
+		// cache of new log is rebuilt from store
+		log, err = New(store, edPrikey)
+		require.NoError(t, err)
+		_, err = log.Append(ctx, []byte("entry-7"))
+		require.NoError(t, err)
+		sth2, err := log.SignTreeHead(ctx)
+		require.NoError(t, err)
+		require.EqualValues(t, 8, sth2.TreeSize)
+
+		proof, err := log.ConsistencyProof(ctx, sth1.TreeSize, sth2.TreeSize)
+		require.NoError(t, err)
+		require.NoError(t, sth1.VerifyConsistency(sth2, proof))
+
+		_, err = log.InclusionProof(ctx, 0, sth2.TreeSize+1)
+		require.Error(t, err)
+		_, err = log.ConsistencyProof(ctx, sth1.TreeSize, sth2.TreeSize+1)
+		require.Error(t, err)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := New(nil, edPrikey)
+		require.Error(t, err)
+		_, err = New(NewMemoryStore(), "not a key")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,110 @@
+package merkle
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// ErrNotFound entry not found in store
+var ErrNotFound = errors.New("not found")
+
+// Store persistence of log entries
+//
+// entries are append-only, all methods should be safe for concurrent use.
+type Store interface {
+	// Append append entry with its leaf hash, return index of entry
+	Append(ctx context.Context, entry, leafHash []byte) (index uint64, err error)
+	// Size number of entries
+	Size(ctx context.Context) (uint64, error)
+	// LeafHashes leaf hashes of entries in [start, end)
+	LeafHashes(ctx context.Context, start, end uint64) ([][]byte, error)
+	// Entry get entry by index,
+	// return ErrNotFound if not exists
+	Entry(ctx context.Context, index uint64) ([]byte, error)
+	// LeafIndex get index of first entry with leaf hash,
+	// return ErrNotFound if not exists
+	LeafIndex(ctx context.Context, leafHash []byte) (uint64, error)
+}
+
+var (
+	_ Store = new(MemoryStore)
+)
+
+// MemoryStore memory based store,
+// all entries will be lost after process exit.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	entries    [][]byte
+	leafHashes [][]byte
+	// index map[leafHash]index
+	index map[string]uint64
+}
+
+// NewMemoryStore new memory based store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		index: map[string]uint64{},
+	}
+}
+
+// Append append entry
+func (s *MemoryStore) Append(_ context.Context, entry, leafHash []byte) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := uint64(len(s.entries))
+	s.entries = append(s.entries, append([]byte{}, entry...))
+	s.leafHashes = append(s.leafHashes, append([]byte{}, leafHash...))
+	if _, ok := s.index[string(leafHash)]; !ok {
+		s.index[string(leafHash)] = idx
+	}
+
+	return idx, nil
+}
+
+// Size number of entries
+func (s *MemoryStore) Size(_ context.Context) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return uint64(len(s.entries)), nil
+}
+
+// LeafHashes leaf hashes in [start, end)
+func (s *MemoryStore) LeafHashes(_ context.Context, start, end uint64) ([][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if start > end || end > uint64(len(s.leafHashes)) {
+		return nil, errors.Errorf("range [%d, %d) out of size %d", start, end, len(s.leafHashes))
+	}
+
+	return append([][]byte{}, s.leafHashes[start:end]...), nil
+}
+
+// Entry get entry by index
+func (s *MemoryStore) Entry(_ context.Context, index uint64) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if index >= uint64(len(s.entries)) {
+		return nil, errors.Wrapf(ErrNotFound, "entry %d", index)
+	}
+
+	return append([]byte{}, s.entries[index]...), nil
+}
+
+// LeafIndex get index by leaf hash
+func (s *MemoryStore) LeafIndex(_ context.Context, leafHash []byte) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx, ok := s.index[string(leafHash)]
+	if !ok {
+		return 0, errors.WithStack(ErrNotFound)
+	}
+
+	return idx, nil
+}
@@ -0,0 +1,57 @@
+package merkle
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	size, err := store.Size(ctx)
+	require.NoError(t, err)
+	require.Zero(t, size)
+
+	_, err = store.Entry(ctx, 0)
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = store.LeafIndex(ctx, HashLeaf([]byte("a")))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	for i, entry := range []string{"a", "bb", "", "a"} {
+		idx, err := store.Append(ctx, []byte(entry), HashLeaf([]byte(entry)))
+		require.NoError(t, err)
+		require.EqualValues(t, i, idx)
+	}
+
+	size, err = store.Size(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, size)
+
+	entry, err := store.Entry(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("bb"), entry)
+	entry, err = store.Entry(ctx, 2)
+	require.NoError(t, err)
+	require.Empty(t, entry)
+
+	idx, err := store.LeafIndex(ctx, HashLeaf([]byte("a")))
+	require.NoError(t, err)
+	require.Zero(t, idx)
+
+	hashes, err := store.LeafHashes(ctx, 1, 3)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{HashLeaf([]byte("bb")), HashLeaf([]byte(""))}, hashes)
+	_, err = store.LeafHashes(ctx, 1, 5)
+	require.Error(t, err)
+	_, err = store.LeafHashes(ctx, 3, 2)
+	require.Error(t, err)
+}
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	testStore(t, NewMemoryStore())
+}
@@ -0,0 +1,276 @@
+// Package merkle is an append-only Merkle tree log, like Certificate Transparency
+//
+// tree hashing, inclusion proof and consistency proof are defined in RFC 9162 2.1,
+// tree heads are signed by log's private key, so any entry can be proven
+// present in the log, and any two tree heads can be proven consistent.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/bits"
+
+	"github.com/Laisky/errors/v2"
+)
+
+const (
+	leafHashPrefix = 0x00
+	nodeHashPrefix = 0x01
+)
+
+// HashSize size of hash in bytes
+const HashSize = sha256.Size
+
+// HashLeaf hash of leaf entry, SHA-256(0x00 || entry)
+func HashLeaf(entry []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafHashPrefix})
+	h.Write(entry)
+	return h.Sum(nil)
+}
+
+// HashChildren hash of internal node, SHA-256(0x01 || left || right)
+func HashChildren(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodeHashPrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// emptyRoot root hash of empty tree, SHA-256()
+var emptyRoot = sha256.New().Sum(nil)
+
+// RootHash calculate root hash of leaf hashes
+func RootHash(leafHashes [][]byte) []byte {
+	switch len(leafHashes) {
+	case 0:
+		return append([]byte{}, emptyRoot...)
+	case 1:
+		return leafHashes[0]
+	}
+
+	k := splitPoint(uint64(len(leafHashes)))
+	return HashChildren(RootHash(leafHashes[:k]), RootHash(leafHashes[k:]))
+}
+
+// splitPoint largest power of two smaller than n, n should be greater than 1
+func splitPoint(n uint64) uint64 {
+	return 1 << (bits.Len64(n-1) - 1)
+}
+
+// treeCache cache hashes of all perfect subtrees,
+// levels[l][i] is the hash of leaves [i*2^l, (i+1)*2^l).
+//
+// hash of any subtree in RFC 9162 can be composed by O(log n) cached hashes,
+// so there is no need to rehash all leaves for every tree head or proof.
+type treeCache struct {
+	levels [][][]byte
+}
+
+// newTreeCache new cache of leaf hashes
+func newTreeCache(leafHashes [][]byte) *treeCache {
+	c := new(treeCache)
+	c.append(leafHashes...)
+	return c
+}
+
+// size number of leaves
+func (c *treeCache) size() uint64 {
+	if len(c.levels) == 0 {
+		return 0
+	}
+
+	return uint64(len(c.levels[0]))
+}
+
+// append append leaves, hash parents of completed subtrees
+func (c *treeCache) append(leafHashes ...[]byte) {
+	for _, h := range leafHashes {
+		for l := 0; ; l++ {
+			if l == len(c.levels) {
+				c.levels = append(c.levels, nil)
+			}
+
+			c.levels[l] = append(c.levels[l], h)
+			n := len(c.levels[l])
+			if n%2 == 1 {
+				break
+			}
+
+			h = HashChildren(c.levels[l][n-2], c.levels[l][n-1])
+		}
+	}
+}
+
+// hash root hash of leaves [start, end),
+// start should be aligned to split points like in RFC 9162 2.1.1
+func (c *treeCache) hash(start, end uint64) []byte {
+	n := end - start
+	switch {
+	case n == 0:
+		return bytes.Clone(emptyRoot)
+	case n&(n-1) == 0 && start%n == 0:
+		l := bits.TrailingZeros64(n)
+		return bytes.Clone(c.levels[l][start>>l])
+	}
+
+	k := splitPoint(n)
+	return HashChildren(c.hash(start, start+k), c.hash(start+k, end))
+}
+
+// inclusionProof audit path of leaf m in tree of leaves [start, end),
+// RFC 9162 2.1.3.1
+func (c *treeCache) inclusionProof(m, start, end uint64) [][]byte {
+	n := end - start
+	if n <= 1 {
+		return nil
+	}
+
+	k := splitPoint(n)
+	if m < k {
+		return append(c.inclusionProof(m, start, start+k), c.hash(start+k, end))
+	}
+
+	return append(c.inclusionProof(m-k, start+k, end), c.hash(start, start+k))
+}
+
+// consistencyProof proof between tree of first m leaves and
+// tree of leaves [start, end), RFC 9162 2.1.4.1
+func (c *treeCache) consistencyProof(m, start, end uint64, complete bool) [][]byte {
+	n := end - start
+	if m == n {
+		if complete {
+			return nil
+		}
+
+		return [][]byte{c.hash(start, end)}
+	}
+
+	k := splitPoint(n)
+	if m <= k {
+		return append(c.consistencyProof(m, start, start+k, complete), c.hash(start+k, end))
+	}
+
+	return append(c.consistencyProof(m-k, start+k, end, false), c.hash(start, start+k))
+}
+
+// inclusionProof audit path of leaf m in tree, RFC 9162 2.1.3.1
+func inclusionProof(m uint64, leafHashes [][]byte) [][]byte {
+	return newTreeCache(leafHashes).inclusionProof(m, 0, uint64(len(leafHashes)))
+}
+
+// consistencyProof proof between tree of first m leaves and whole tree,
+// RFC 9162 2.1.4.1
+func consistencyProof(m uint64, leafHashes [][]byte, complete bool) [][]byte {
+	return newTreeCache(leafHashes).consistencyProof(m, 0, uint64(len(leafHashes)), complete)
+}
+
+// VerifyInclusion verify leaf is the index-th entry of tree with size and root,
+// RFC 9162 2.1.3.2
+func VerifyInclusion(leafHash []byte, index, size uint64, proof [][]byte, root []byte) error {
+	if index >= size {
+		return errors.Errorf("index %d out of tree size %d", index, size)
+	}
+
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return errors.Errorf("proof is too long")
+		}
+
+		if fn&1 == 1 || fn == sn {
+			r = HashChildren(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = HashChildren(r, p)
+		}
+
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 {
+		return errors.Errorf("proof is too short")
+	}
+	if !bytes.Equal(r, root) {
+		return errors.Errorf("root hash mismatch")
+	}
+
+	return nil
+}
+
+// VerifyConsistency verify tree with size1 and root1 is prefix of
+// tree with size2 and root2, RFC 9162 2.1.4.2
+func VerifyConsistency(size1, size2 uint64, proof [][]byte, root1, root2 []byte) error {
+	switch {
+	case size1 > size2:
+		return errors.Errorf("size1 %d should not be greater than size2 %d", size1, size2)
+	case size1 == size2:
+		if len(proof) != 0 {
+			return errors.Errorf("proof should be empty for same size")
+		}
+		if !bytes.Equal(root1, root2) {
+			return errors.Errorf("root hash mismatch")
+		}
+
+		return nil
+	case size1 == 0:
+		// empty tree is prefix of any tree
+		if len(proof) != 0 {
+			return errors.Errorf("proof should be empty for empty tree")
+		}
+
+		return nil
+	}
+
+	if size1&(size1-1) == 0 {
+		proof = append([][]byte{root1}, proof...)
+	}
+	if len(proof) == 0 {
+		return errors.Errorf("proof should not be empty")
+	}
+
+	fn, sn := size1-1, size2-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return errors.Errorf("proof is too long")
+		}
+
+		if fn&1 == 1 || fn == sn {
+			fr = HashChildren(c, fr)
+			sr = HashChildren(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = HashChildren(sr, c)
+		}
+
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 {
+		return errors.Errorf("proof is too short")
+	}
+	if !bytes.Equal(fr, root1) {
+		return errors.Errorf("root1 hash mismatch")
+	}
+	if !bytes.Equal(sr, root2) {
+		return errors.Errorf("root2 hash mismatch")
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package merkle
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testLeafHashes(n int) [][]byte {
+	var leafHashes [][]byte
+	for i := 0; i < n; i++ {
+		leafHashes = append(leafHashes, HashLeaf([]byte(fmt.Sprintf("entry-%d", i))))
+	}
+
+	return leafHashes
+}
+
+func TestRootHash(t *testing.T) {
+	t.Parallel()
+
+	// test vectors from certificate-transparency
+	var leafHashes [][]byte
+	for _, leaf := range []string{
+		"", "00", "10", "2021", "3031", "40414243",
+		"5051525354555657", "606162636465666768696a6b6c6d6e6f",
+	} {
+		data, err := hex.DecodeString(leaf)
+		require.NoError(t, err)
+		leafHashes = append(leafHashes, HashLeaf(data))
+	}
+
+	require.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		hex.EncodeToString(RootHash(nil)))
+	require.Equal(t, "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		hex.EncodeToString(RootHash(leafHashes[:1])))
+	require.Equal(t, "5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+		hex.EncodeToString(RootHash(leafHashes)))
+}
+
+func TestTreeCache(t *testing.T) {
+	t.Parallel()
+
+	leafHashes := testLeafHashes(33)
+	c := new(treeCache)
+	require.Equal(t, RootHash(nil), c.hash(0, 0))
+	for size := 1; size <= len(leafHashes); size++ {
+		c.append(leafHashes[size-1])
+		require.EqualValues(t, size, c.size())
+
+		// root of every prefix is still available after appending
+		for prefix := 1; prefix <= size; prefix++ {
+			require.Equal(t, RootHash(leafHashes[:prefix]), c.hash(0, uint64(prefix)),
+				"size %d, prefix %d", size, prefix)
+		}
+	}
+
+	// returned hash should not share memory with cache
+	root := c.hash(0, 32)
+	root[0] ^= 0xff
+	require.Equal(t, RootHash(leafHashes[:32]), c.hash(0, 32))
+}
+
+func TestInclusionProof(t *testing.T) {
+	t.Parallel()
+
+	leafHashes := testLeafHashes(33)
+	for size := 1; size <= len(leafHashes); size++ {
+		root := RootHash(leafHashes[:size])
+		for idx := 0; idx < size; idx++ {
+			proof := inclusionProof(uint64(idx), leafHashes[:size])
+			require.NoError(t, VerifyInclusion(leafHashes[idx], uint64(idx), uint64(size), proof, root),
+				"size %d, index %d", size, idx)
+
+			require.Error(t, VerifyInclusion(leafHashes[(idx+1)%len(leafHashes)],
+				uint64(idx), uint64(size), proof, root))
+			if len(proof) > 0 {
+				require.Error(t, VerifyInclusion(leafHashes[idx], uint64(idx), uint64(size), proof[1:], root))
+			}
+			require.Error(t, VerifyInclusion(leafHashes[idx], uint64(idx), uint64(size),
+				append(proof, root), root))
+		}
+
+		require.Error(t, VerifyInclusion(leafHashes[0], uint64(size), uint64(size), nil, root))
+	}
+}
+
+func TestConsistencyProof(t *testing.T) {
+	t.Parallel()
+
+	leafHashes := testLeafHashes(33)
+	for size2 := 1; size2 <= len(leafHashes); size2++ {
+		root2 := RootHash(leafHashes[:size2])
+		for size1 := 1; size1 <= size2; size1++ {
+			root1 := RootHash(leafHashes[:size1])
+			var proof [][]byte
+			if size1 != size2 {
+				proof = consistencyProof(uint64(size1), leafHashes[:size2], true)
+			}
+
+			require.NoError(t, VerifyConsistency(uint64(size1), uint64(size2), proof, root1, root2),
+				"size1 %d, size2 %d", size1, size2)
+			if size1 != size2 {
+				require.Error(t, VerifyConsistency(uint64(size1), uint64(size2), proof, root2, root2))
+				require.Error(t, VerifyConsistency(uint64(size1), uint64(size2), proof, root1, root1))
+				require.Error(t, VerifyConsistency(uint64(size1), uint64(size2), proof[1:], root1, root2))
+			}
+		}
+
+		require.NoError(t, VerifyConsistency(0, uint64(size2), nil, nil, root2))
+		require.Error(t, VerifyConsistency(uint64(size2), uint64(size2-1), nil, root2, root2))
+	}
+}
@@ -0,0 +1,786 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+// Noise-style authenticated key exchange.
+//
+// ephemeral keys are exchanged by ECDH, static identities are
+// Ed25519 keys that sign the handshake transcript (SIGMA-I),
+// session keys are derived by HKDFWithSHA256, records are
+// encrypted by AES-256-GCM.
+//
+// this is not wire compatible with the Noise Protocol Framework,
+// patterns are named after the Noise patterns with the same message flow,
+// but static keys are authenticated by signatures instead of DH.
+//
+// handshake (-> initiator to responder, <- responder to initiator):
+//
+//	-> e
+//	<- e, enc(s, sig)   // s is omitted in XK pattern
+//	-> enc(s, sig)
+//
+// every record carries a type byte, Close sends an encrypted close record,
+// so truncation by attacker can be detected by reader.
+
+var (
+	_ net.Conn     = new(NoiseConn)
+	_ net.Listener = new(NoiseListener)
+)
+
+// NoisePattern handshake pattern
+type NoisePattern byte
+
+const (
+	// NoisePatternXX static keys of both sides are sent during handshake,
+	// and verified by WithNoiseVerifyPeer or WithNoisePeerPublicKey.
+	NoisePatternXX NoisePattern = 1
+	// NoisePatternXK initiator knows responder's static key in advance,
+	// responder's static key will not be sent,
+	// initiator's static key is sent in the third message like XX.
+	//
+	// unlike Noise IK, it's still a three messages handshake,
+	// initiator can not send its identity or data in the first message.
+	NoisePatternXK NoisePattern = 2
+)
+
+const (
+	noiseProtocolName = "Noise-style_ECDH_Ed25519_AESGCM_SHA256"
+	noiseVersion      = 1
+	noiseKeySize      = 32
+	noiseTagSize      = 16
+	// noiseMaxRecordSize max size of record body
+	noiseMaxRecordSize = math.MaxUint16
+	// noiseMaxPlaintextSize max plaintext size of each record,
+	// exclude the type byte
+	noiseMaxPlaintextSize = noiseMaxRecordSize - noiseTagSize - 1
+	// noiseCloseTimeout timeout of sending close record
+	noiseCloseTimeout = 5 * time.Second
+
+	// noiseRecordData record contains application data
+	noiseRecordData byte = 0
+	// noiseRecordClose record notifies peer that no more data will be sent
+	noiseRecordClose byte = 1
+
+	noiseLabelResponder = "noise responder signature"
+	noiseLabelInitiator = "noise initiator signature"
+)
+
+type noiseOption struct {
+	curve      ECDSACurve
+	peerPubkey ed25519.PublicKey
+	verifyPeer func(peer ed25519.PublicKey) error
+	prologue   []byte
+}
+
+func (o *noiseOption) fillDefault() *noiseOption {
+	o.curve = ECDSACurveP256
+	return o
+}
+
+func (o *noiseOption) applyOpts(opts ...NoiseOption) (*noiseOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.peerPubkey == nil && o.verifyPeer == nil {
+		return nil, errors.Errorf("peer should be authenticated by " +
+			"WithNoisePeerPublicKey or WithNoiseVerifyPeer")
+	}
+
+	return o, nil
+}
+
+// NoiseOption optional arguments for noise handshake
+type NoiseOption func(*noiseOption) error
+
+// WithNoiseCurve (optional) set curve of ephemeral ECDH keys,
+// both sides should use the same curve. default to ECDSACurveP256
+func WithNoiseCurve(curve ECDSACurve) NoiseOption {
+	return func(o *noiseOption) error {
+		switch curve {
+		case ECDSACurveP256, ECDSACurveP384, ECDSACurveP521:
+		default:
+			return errors.Errorf("unsupport curve %s", curve)
+		}
+
+		o.curve = curve
+		return nil
+	}
+}
+
+// WithNoisePeerPublicKey pin peer's static public key
+//
+// initiator with pinned key will use NoisePatternXK.
+func WithNoisePeerPublicKey(pubkey ed25519.PublicKey) NoiseOption {
+	return func(o *noiseOption) error {
+		if len(pubkey) != ed25519.PublicKeySize {
+			return errors.Errorf("invalid ed25519 public key size %d", len(pubkey))
+		}
+
+		o.peerPubkey = append(ed25519.PublicKey{}, pubkey...)
+		return nil
+	}
+}
+
+// WithNoiseVerifyPeer verify peer's static public key,
+// return error to reject peer.
+func WithNoiseVerifyPeer(verify func(peer ed25519.PublicKey) error) NoiseOption {
+	return func(o *noiseOption) error {
+		if verify == nil {
+			return errors.Errorf("verify should not be nil")
+		}
+
+		o.verifyPeer = verify
+		return nil
+	}
+}
+
+// WithNoisePrologue (optional) set prologue,
+// which is authenticated by handshake, both sides should use the same prologue.
+func WithNoisePrologue(prologue []byte) NoiseOption {
+	return func(o *noiseOption) error {
+		o.prologue = append([]byte{}, prologue...)
+		return nil
+	}
+}
+
+// NoiseConn secure connection established by noise handshake
+//
+// handshake will be run on first Read or Write, or by calling Handshake.
+// Read returns io.EOF only if peer closed by Close,
+// returns io.ErrUnexpectedEOF if connection is closed without close record.
+type NoiseConn struct {
+	net.Conn
+	opt         *noiseOption
+	prikey      ed25519.PrivateKey
+	isInitiator bool
+
+	handshakeMu  sync.Mutex
+	handshakeErr error
+	handshaked   bool
+	peerPubkey   ed25519.PublicKey
+	// established set after handshake succeeded, can be read without handshakeMu
+	established atomic.Bool
+
+	readMu     sync.Mutex
+	recv       cipher.AEAD
+	recvNonce  uint64
+	readBuf    []byte
+	peerClosed bool
+
+	writeMu   sync.Mutex
+	send      cipher.AEAD
+	sendNonce uint64
+	closed    bool
+}
+
+// newNoiseOption check private key and build options
+func newNoiseOption(prikey ed25519.PrivateKey, opts ...NoiseOption) (*noiseOption, error) {
+	if len(prikey) != ed25519.PrivateKeySize {
+		return nil, errors.Errorf("invalid ed25519 private key size %d", len(prikey))
+	}
+
+	opt, err := new(noiseOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	return opt, nil
+}
+
+func newNoiseConn(conn net.Conn, prikey ed25519.PrivateKey,
+	isInitiator bool, opts ...NoiseOption) (*NoiseConn, error) {
+	if conn == nil {
+		return nil, errors.Errorf("conn should not be nil")
+	}
+
+	opt, err := newNoiseOption(prikey, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NoiseConn{
+		Conn:        conn,
+		opt:         opt,
+		prikey:      prikey,
+		isInitiator: isInitiator,
+	}, nil
+}
+
+// NoiseClient wrap conn as initiator of noise handshake
+//
+// # Args
+//   - conn: underlying connection
+//   - prikey: static ed25519 private key of this side
+func NoiseClient(conn net.Conn, prikey ed25519.PrivateKey, opts ...NoiseOption) (*NoiseConn, error) {
+	return newNoiseConn(conn, prikey, true, opts...)
+}
+
+// NoiseServer wrap conn as responder of noise handshake
+//
+// # Args
+//   - conn: underlying connection
+//   - prikey: static ed25519 private key of this side
+func NoiseServer(conn net.Conn, prikey ed25519.PrivateKey, opts ...NoiseOption) (*NoiseConn, error) {
+	return newNoiseConn(conn, prikey, false, opts...)
+}
+
+// PeerPublicKey static public key of peer, return nil before handshake
+func (c *NoiseConn) PeerPublicKey() ed25519.PublicKey {
+	c.handshakeMu.Lock()
+	defer c.handshakeMu.Unlock()
+
+	return c.peerPubkey
+}
+
+// Handshake run handshake if not yet,
+// use SetDeadline of underlying conn to set timeout.
+func (c *NoiseConn) Handshake() error {
+	c.handshakeMu.Lock()
+	defer c.handshakeMu.Unlock()
+
+	if c.handshaked || c.handshakeErr != nil {
+		return c.handshakeErr
+	}
+
+	var hs *noiseHandshakeState
+	if hs, c.handshakeErr = newNoiseHandshakeState(c); c.handshakeErr == nil {
+		if c.isInitiator {
+			c.handshakeErr = hs.runInitiator()
+		} else {
+			c.handshakeErr = hs.runResponder()
+		}
+	}
+	if c.handshakeErr != nil {
+		c.handshakeErr = errors.Wrap(c.handshakeErr, "noise handshake")
+		return c.handshakeErr
+	}
+
+	c.handshaked = true
+	c.established.Store(true)
+	return nil
+}
+
+// Read read decrypted data
+func (c *NoiseConn) Read(p []byte) (n int, err error) {
+	if err = c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for len(c.readBuf) == 0 {
+		if c.peerClosed {
+			return 0, io.EOF
+		}
+
+		body, err := noiseReadFrame(c.Conn)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, errors.Wrap(io.ErrUnexpectedEOF, "connection closed without close record")
+			}
+
+			return 0, err
+		}
+
+		record, err := noiseOpen(c.recv, &c.recvNonce, body, nil)
+		if err != nil {
+			return 0, errors.Wrap(err, "decrypt record")
+		}
+		if len(record) == 0 {
+			return 0, errors.Errorf("empty record")
+		}
+
+		switch record[0] {
+		case noiseRecordData:
+			c.readBuf = record[1:]
+		case noiseRecordClose:
+			c.peerClosed = true
+		default:
+			return 0, errors.Errorf("unknown record type %d", record[0])
+		}
+	}
+
+	n = copy(p, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+// Write encrypt and write data
+func (c *NoiseConn) Write(p []byte) (n int, err error) {
+	if err = c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+
+	for len(p) > 0 {
+		size := min(len(p), noiseMaxPlaintextSize)
+		if err = c.writeRecord(noiseRecordData, p[:size]); err != nil {
+			return n, err
+		}
+
+		n += size
+		p = p[size:]
+	}
+
+	return n, nil
+}
+
+// writeRecord encrypt and write one record, writeMu should be held
+func (c *NoiseConn) writeRecord(typ byte, data []byte) error {
+	body, err := noiseSeal(c.send, &c.sendNonce, append([]byte{typ}, data...), nil)
+	if err != nil {
+		return errors.Wrap(err, "encrypt record")
+	}
+
+	return noiseWriteFrame(c.Conn, body)
+}
+
+// Close send close record to peer if handshake has finished,
+// then close underlying connection.
+func (c *NoiseConn) Close() error {
+	if c.established.Load() {
+		c.writeMu.Lock()
+		if !c.closed {
+			c.closed = true
+			// best effort, peer may have gone
+			_ = c.Conn.SetWriteDeadline(time.Now().Add(noiseCloseTimeout))
+			_ = c.writeRecord(noiseRecordClose, nil)
+		}
+		c.writeMu.Unlock()
+	}
+
+	return c.Conn.Close()
+}
+
+// noiseHandshakeState state of running handshake
+type noiseHandshakeState struct {
+	conn *NoiseConn
+	// h transcript hash
+	h         []byte
+	curve     ecdh.Curve
+	ephemeral KeyExchange
+	shared    []byte
+}
+
+func newNoiseHandshakeState(conn *NoiseConn) (*noiseHandshakeState, error) {
+	ephemeral, err := NewEcdh(conn.opt.curve)
+	if err != nil {
+		return nil, errors.Wrap(err, "new ephemeral key")
+	}
+
+	var curve ecdh.Curve
+	switch conn.opt.curve {
+	case ECDSACurveP256:
+		curve = ecdh.P256()
+	case ECDSACurveP384:
+		curve = ecdh.P384()
+	case ECDSACurveP521:
+		curve = ecdh.P521()
+	default:
+		return nil, errors.Errorf("unsupport curve %s", conn.opt.curve)
+	}
+
+	hs := &noiseHandshakeState{
+		conn:      conn,
+		h:         make([]byte, sha256.Size),
+		curve:     curve,
+		ephemeral: ephemeral,
+	}
+	hs.mixHash([]byte(noiseProtocolName), conn.opt.prologue)
+	return hs, nil
+}
+
+// mixHash h = SHA256(h || data...)
+func (hs *noiseHandshakeState) mixHash(data ...[]byte) {
+	hasher := sha256.New()
+	hasher.Write(hs.h)
+	for _, d := range data {
+		hasher.Write(d)
+	}
+
+	hs.h = hasher.Sum(nil)
+}
+
+// checkPeerEphemeral check peer's ephemeral key is a valid point
+// of the same curve, the identity point is rejected as well.
+//
+// own is the ephemeral public key of this side,
+// both are encoded by ECDH.PublicKey with curve type prefix.
+func (hs *noiseHandshakeState) checkPeerEphemeral(own, peer []byte) error {
+	if len(peer) != len(own) || peer[0] != own[0] {
+		return errors.Errorf("peer uses another curve")
+	}
+	if _, err := hs.curve.NewPublicKey(peer[1:]); err != nil {
+		return errors.Wrap(err, "invalid peer ephemeral key")
+	}
+
+	return nil
+}
+
+// deriveCiphers derive ciphers of both directions from shared key and transcript
+func (hs *noiseHandshakeState) deriveCiphers(info string) (i2r, r2i cipher.AEAD, err error) {
+	keys := [][]byte{make([]byte, noiseKeySize), make([]byte, noiseKeySize)}
+	if err = HKDFWithSHA256(hs.shared, hs.h, []byte(info), keys); err != nil {
+		return nil, nil, errors.Wrap(err, "derive keys")
+	}
+
+	if i2r, err = newNoiseCipher(keys[0]); err != nil {
+		return nil, nil, err
+	}
+	if r2i, err = newNoiseCipher(keys[1]); err != nil {
+		return nil, nil, err
+	}
+
+	return i2r, r2i, nil
+}
+
+// sign sign transcript after mixing own static key
+func (hs *noiseHandshakeState) sign(label string) ([]byte, error) {
+	hs.mixHash(hs.conn.prikey.Public().(ed25519.PublicKey))
+	return SignByEd25519WithSHA512(hs.conn.prikey,
+		io.MultiReader(bytes.NewReader([]byte(label)), bytes.NewReader(hs.h)))
+}
+
+// verifyPeer authenticate peer's static key and verify its signature
+func (hs *noiseHandshakeState) verifyPeer(label string, peer ed25519.PublicKey, sig []byte) error {
+	opt := hs.conn.opt
+	if opt.peerPubkey != nil && subtle.ConstantTimeCompare(opt.peerPubkey, peer) != 1 {
+		return errors.Errorf("peer public key mismatch")
+	}
+	if opt.verifyPeer != nil {
+		if err := opt.verifyPeer(peer); err != nil {
+			return errors.Wrap(err, "peer is rejected")
+		}
+	}
+
+	hs.mixHash(peer)
+	if err := VerifyByEd25519WithSHA512(peer,
+		io.MultiReader(bytes.NewReader([]byte(label)), bytes.NewReader(hs.h)), sig); err != nil {
+		return errors.Wrap(err, "verify peer signature")
+	}
+
+	return nil
+}
+
+// finish derive transport ciphers
+func (hs *noiseHandshakeState) finish(peer ed25519.PublicKey) error {
+	i2r, r2i, err := hs.deriveCiphers("transport")
+	if err != nil {
+		return err
+	}
+
+	c := hs.conn
+	if c.isInitiator {
+		c.send, c.recv = i2r, r2i
+	} else {
+		c.send, c.recv = r2i, i2r
+	}
+	c.peerPubkey = append(ed25519.PublicKey{}, peer...)
+	return nil
+}
+
+func (hs *noiseHandshakeState) runInitiator() error {
+	conn := hs.conn
+	pattern := NoisePatternXX
+	if conn.opt.peerPubkey != nil {
+		pattern = NoisePatternXK
+	}
+
+	// -> e
+	epub, err := hs.ephemeral.PublicKey()
+	if err != nil {
+		return errors.Wrap(err, "get ephemeral public key")
+	}
+	msg1 := append([]byte{noiseVersion, byte(pattern)}, epub...)
+	if err = noiseWriteFrame(conn.Conn, msg1); err != nil {
+		return err
+	}
+	hs.mixHash(msg1)
+
+	// <- e, enc(s, sig)
+	msg2, err := noiseReadFrame(conn.Conn)
+	if err != nil {
+		return err
+	}
+	if len(msg2) < len(epub) {
+		return errors.Errorf("message is too short")
+	}
+	peerEpub, ct2 := msg2[:len(epub)], msg2[len(epub):]
+	if err = hs.checkPeerEphemeral(epub, peerEpub); err != nil {
+		return err
+	}
+	if hs.shared, err = hs.ephemeral.GenerateKey(peerEpub); err != nil {
+		return errors.Wrap(err, "ecdh")
+	}
+	hs.mixHash(peerEpub)
+
+	i2r, r2i, err := hs.deriveCiphers("handshake")
+	if err != nil {
+		return err
+	}
+	var nonce uint64
+	payload2, err := noiseOpen(r2i, &nonce, ct2, hs.h)
+	if err != nil {
+		return errors.Wrap(err, "decrypt responder message")
+	}
+
+	peer := conn.opt.peerPubkey
+	if pattern == NoisePatternXX {
+		if len(payload2) < ed25519.PublicKeySize {
+			return errors.Errorf("message is too short")
+		}
+		peer, payload2 = payload2[:ed25519.PublicKeySize], payload2[ed25519.PublicKeySize:]
+	}
+	if err = hs.verifyPeer(noiseLabelResponder, peer, payload2); err != nil {
+		return err
+	}
+	hs.mixHash(ct2)
+
+	// -> enc(s, sig)
+	ad := hs.h
+	sig, err := hs.sign(noiseLabelInitiator)
+	if err != nil {
+		return errors.Wrap(err, "sign transcript")
+	}
+	payload3 := append(append([]byte{}, conn.prikey.Public().(ed25519.PublicKey)...), sig...)
+	nonce = 0
+	ct3, err := noiseSeal(i2r, &nonce, payload3, ad)
+	if err != nil {
+		return errors.Wrap(err, "encrypt initiator message")
+	}
+	if err = noiseWriteFrame(conn.Conn, ct3); err != nil {
+		return err
+	}
+	hs.mixHash(ct3)
+
+	return hs.finish(peer)
+}
+
+func (hs *noiseHandshakeState) runResponder() error {
+	conn := hs.conn
+
+	// -> e
+	msg1, err := noiseReadFrame(conn.Conn)
+	if err != nil {
+		return err
+	}
+	epub, err := hs.ephemeral.PublicKey()
+	if err != nil {
+		return errors.Wrap(err, "get ephemeral public key")
+	}
+	if len(msg1) != 2+len(epub) {
+		return errors.Errorf("invalid initiator message length")
+	}
+	if msg1[0] != noiseVersion {
+		return errors.Errorf("unsupported version %d", msg1[0])
+	}
+	pattern := NoisePattern(msg1[1])
+	switch pattern {
+	case NoisePatternXX, NoisePatternXK:
+	default:
+		return errors.Errorf("unsupported pattern %d", pattern)
+	}
+	peerEpub := msg1[2:]
+	if err = hs.checkPeerEphemeral(epub, peerEpub); err != nil {
+		return err
+	}
+	hs.mixHash(msg1)
+
+	// <- e, enc(s, sig)
+	if hs.shared, err = hs.ephemeral.GenerateKey(peerEpub); err != nil {
+		return errors.Wrap(err, "ecdh")
+	}
+	hs.mixHash(epub)
+
+	i2r, r2i, err := hs.deriveCiphers("handshake")
+	if err != nil {
+		return err
+	}
+	ad := hs.h
+	sig, err := hs.sign(noiseLabelResponder)
+	if err != nil {
+		return errors.Wrap(err, "sign transcript")
+	}
+
+	var payload2 []byte
+	if pattern == NoisePatternXX {
+		payload2 = append(payload2, conn.prikey.Public().(ed25519.PublicKey)...)
+	}
+	payload2 = append(payload2, sig...)
+	var nonce uint64
+	ct2, err := noiseSeal(r2i, &nonce, payload2, ad)
+	if err != nil {
+		return errors.Wrap(err, "encrypt responder message")
+	}
+	if err = noiseWriteFrame(conn.Conn, append(append([]byte{}, epub...), ct2...)); err != nil {
+		return err
+	}
+	hs.mixHash(ct2)
+
+	// -> enc(s, sig)
+	ct3, err := noiseReadFrame(conn.Conn)
+	if err != nil {
+		return err
+	}
+	nonce = 0
+	payload3, err := noiseOpen(i2r, &nonce, ct3, hs.h)
+	if err != nil {
+		return errors.Wrap(err, "decrypt initiator message")
+	}
+	if len(payload3) < ed25519.PublicKeySize {
+		return errors.Errorf("message is too short")
+	}
+	peer, peerSig := payload3[:ed25519.PublicKeySize], payload3[ed25519.PublicKeySize:]
+	if err = hs.verifyPeer(noiseLabelInitiator, peer, peerSig); err != nil {
+		return err
+	}
+	hs.mixHash(ct3)
+
+	return hs.finish(peer)
+}
+
+func newNoiseCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "new aes cipher")
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "new gcm")
+	}
+
+	return aead, nil
+}
+
+// noiseNonce build 12 bytes nonce from counter
+func noiseNonce(counter *uint64) ([]byte, error) {
+	if *counter == math.MaxUint64 {
+		return nil, errors.Errorf("nonce exhausted")
+	}
+
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], *counter)
+	*counter++
+	return nonce, nil
+}
+
+func noiseSeal(aead cipher.AEAD, counter *uint64, plaintext, ad []byte) ([]byte, error) {
+	nonce, err := noiseNonce(counter)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nil, nonce, plaintext, ad), nil
+}
+
+func noiseOpen(aead cipher.AEAD, counter *uint64, ciphertext, ad []byte) ([]byte, error) {
+	nonce, err := noiseNonce(counter)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Open(nil, nonce, ciphertext, ad)
+}
+
+// noiseWriteFrame write 2 bytes length prefixed frame
+func noiseWriteFrame(w io.Writer, body []byte) error {
+	if len(body) > noiseMaxRecordSize {
+		return errors.Errorf("frame is too large")
+	}
+
+	frame := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(body)), uint16(len(body)))
+	if _, err := w.Write(append(frame, body...)); err != nil {
+		return errors.Wrap(err, "write frame")
+	}
+
+	return nil
+}
+
+// noiseReadFrame read 2 bytes length prefixed frame
+func noiseReadFrame(r io.Reader) ([]byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		// do not wrap, caller may check io.EOF
+		return nil, err
+	}
+
+	body := make([]byte, binary.BigEndian.Uint16(header[:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, errors.Wrap(err, "read frame body")
+	}
+
+	return body, nil
+}
+
+// NoiseListener listener that wraps accepted connections by NoiseServer
+type NoiseListener struct {
+	net.Listener
+	prikey ed25519.PrivateKey
+	opts   []NoiseOption
+}
+
+// NewNoiseListener wrap listener, handshake will be run on first Read or Write
+func NewNoiseListener(ln net.Listener, prikey ed25519.PrivateKey, opts ...NoiseOption) (*NoiseListener, error) {
+	if ln == nil {
+		return nil, errors.Errorf("listener should not be nil")
+	}
+	if _, err := newNoiseOption(prikey, opts...); err != nil {
+		return nil, err
+	}
+
+	return &NoiseListener{
+		Listener: ln,
+		prikey:   prikey,
+		opts:     opts,
+	}, nil
+}
+
+// Accept accept and wrap connection
+func (l *NoiseListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	nconn, err := NoiseServer(conn, l.prikey, l.opts...)
+	if err != nil {
+		gutils.SilentClose(conn)
+		return nil, err
+	}
+
+	return nconn, nil
+}
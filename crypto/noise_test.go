@@ -0,0 +1,423 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func newNoiseTestKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+
+	pub, pri, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return pub, pri
+}
+
+// noiseHandshakePair run handshake on both sides of pipe,
+// close conn if handshake failed to unblock peer.
+func noiseHandshakePair(t *testing.T, client, server *NoiseConn) (clientErr, serverErr error) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if clientErr = client.Handshake(); clientErr != nil {
+			_ = client.Close()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if serverErr = server.Handshake(); serverErr != nil {
+			_ = server.Close()
+		}
+	}()
+	wg.Wait()
+
+	return clientErr, serverErr
+}
+
+func TestNoiseConn(t *testing.T) {
+	t.Parallel()
+
+	clientPub, clientPri := newNoiseTestKey(t)
+	serverPub, serverPri := newNoiseTestKey(t)
+	allow := func(expect ed25519.PublicKey) NoiseOption {
+		return WithNoiseVerifyPeer(func(peer ed25519.PublicKey) error {
+			if !peer.Equal(expect) {
+				return errors.Errorf("unknown peer")
+			}
+
+			return nil
+		})
+	}
+
+	for name, c := range map[string]struct {
+		clientOpts, serverOpts []NoiseOption
+	}{
+		"XX": {
+			clientOpts: []NoiseOption{allow(serverPub)},
+			serverOpts: []NoiseOption{allow(clientPub)},
+		},
+		"XK": {
+			clientOpts: []NoiseOption{WithNoisePeerPublicKey(serverPub)},
+			serverOpts: []NoiseOption{WithNoisePeerPublicKey(clientPub)},
+		},
+		"P521 with prologue": {
+			clientOpts: []NoiseOption{allow(serverPub), WithNoiseCurve(ECDSACurveP521), WithNoisePrologue([]byte("svc"))},
+			serverOpts: []NoiseOption{allow(clientPub), WithNoiseCurve(ECDSACurveP521), WithNoisePrologue([]byte("svc"))},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c1, c2 := net.Pipe()
+			defer c1.Close()
+			defer c2.Close()
+
+			client, err := NoiseClient(c1, clientPri, c.clientOpts...)
+			require.NoError(t, err)
+			server, err := NoiseServer(c2, serverPri, c.serverOpts...)
+			require.NoError(t, err)
+			require.Nil(t, client.PeerPublicKey())
+
+			clientErr, serverErr := noiseHandshakePair(t, client, server)
+			require.NoError(t, clientErr)
+			require.NoError(t, serverErr)
+			require.Equal(t, serverPub, client.PeerPublicKey())
+			require.Equal(t, clientPub, server.PeerPublicKey())
+
+			// larger than one record
+			payload := make([]byte, 3*noiseMaxPlaintextSize+100)
+			_, err = rand.Read(payload)
+			require.NoError(t, err)
+
+			go func() {
+				_, _ = client.Write(payload)
+				_ = client.Close()
+			}()
+
+			got, err := io.ReadAll(server)
+			require.NoError(t, err)
+			require.Equal(t, payload, got)
+		})
+	}
+}
+
+func TestNoiseConn_reject(t *testing.T) {
+	t.Parallel()
+
+	clientPub, clientPri := newNoiseTestKey(t)
+	serverPub, serverPri := newNoiseTestKey(t)
+	otherPub, _ := newNoiseTestKey(t)
+	acceptAll := WithNoiseVerifyPeer(func(ed25519.PublicKey) error { return nil })
+	rejectAll := WithNoiseVerifyPeer(func(ed25519.PublicKey) error { return errors.New("rejected") })
+
+	for name, c := range map[string]struct {
+		clientOpts, serverOpts []NoiseOption
+		clientErr, serverErr   string
+	}{
+		"client pins wrong key in XK": {
+			clientOpts: []NoiseOption{WithNoisePeerPublicKey(otherPub)},
+			serverOpts: []NoiseOption{acceptAll},
+			clientErr:  "verify peer signature",
+		},
+		"server pins wrong key": {
+			clientOpts: []NoiseOption{WithNoisePeerPublicKey(serverPub)},
+			serverOpts: []NoiseOption{WithNoisePeerPublicKey(otherPub)},
+			serverErr:  "peer public key mismatch",
+		},
+		"client rejects server": {
+			clientOpts: []NoiseOption{rejectAll},
+			serverOpts: []NoiseOption{WithNoisePeerPublicKey(clientPub)},
+			clientErr:  "peer is rejected",
+		},
+		"server rejects client": {
+			clientOpts: []NoiseOption{acceptAll},
+			serverOpts: []NoiseOption{rejectAll},
+			serverErr:  "peer is rejected",
+		},
+		"prologue mismatch": {
+			clientOpts: []NoiseOption{acceptAll, WithNoisePrologue([]byte("a"))},
+			serverOpts: []NoiseOption{acceptAll, WithNoisePrologue([]byte("b"))},
+			clientErr:  "decrypt responder message",
+		},
+		"curve mismatch": {
+			clientOpts: []NoiseOption{acceptAll, WithNoiseCurve(ECDSACurveP384)},
+			serverOpts: []NoiseOption{acceptAll},
+			serverErr:  "invalid initiator message length",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c1, c2 := net.Pipe()
+			defer c1.Close()
+			defer c2.Close()
+
+			client, err := NoiseClient(c1, clientPri, c.clientOpts...)
+			require.NoError(t, err)
+			server, err := NoiseServer(c2, serverPri, c.serverOpts...)
+			require.NoError(t, err)
+
+			clientErr, serverErr := noiseHandshakePair(t, client, server)
+			require.Error(t, serverErr)
+			if c.clientErr != "" {
+				require.ErrorContains(t, clientErr, c.clientErr)
+			}
+			if c.serverErr != "" {
+				require.ErrorContains(t, serverErr, c.serverErr)
+			}
+
+			// initiator finishes before responder checks the last message,
+			// so it only notices the failure on the first read.
+			if clientErr == nil {
+				_, err = client.Read(make([]byte, 1))
+				require.Error(t, err)
+			} else {
+				_, err = client.Write([]byte("hello"))
+				require.ErrorIs(t, err, clientErr)
+			}
+
+			// handshake error is sticky
+			_, err = server.Read(make([]byte, 1))
+			require.ErrorIs(t, err, serverErr)
+		})
+	}
+}
+
+// noiseTamperConn flips one byte of the n-th frame written
+type noiseTamperConn struct {
+	net.Conn
+	frame, count int
+}
+
+func (c *noiseTamperConn) Write(p []byte) (int, error) {
+	c.count++
+	if c.count == c.frame {
+		p = bytes.Clone(p)
+		p[len(p)-1] ^= 0xff
+	}
+
+	return c.Conn.Write(p)
+}
+
+func TestNoiseConn_tamper(t *testing.T) {
+	t.Parallel()
+
+	_, clientPri := newNoiseTestKey(t)
+	serverPub, serverPri := newNoiseTestKey(t)
+	acceptAll := WithNoiseVerifyPeer(func(ed25519.PublicKey) error { return nil })
+
+	// frame 1: client ephemeral, 2: client static & sig, 3: first record
+	for frame, expectErr := range map[int]string{
+		1: "",
+		2: "decrypt initiator message",
+		3: "decrypt record",
+	} {
+		c1, c2 := net.Pipe()
+		client, err := NoiseClient(&noiseTamperConn{Conn: c1, frame: frame},
+			clientPri, WithNoisePeerPublicKey(serverPub))
+		require.NoError(t, err)
+		server, err := NoiseServer(c2, serverPri, acceptAll)
+		require.NoError(t, err)
+
+		clientErr, serverErr := noiseHandshakePair(t, client, server)
+		if frame <= 2 {
+			require.Error(t, serverErr, frame)
+			if expectErr != "" {
+				require.ErrorContains(t, serverErr, expectErr)
+			}
+			if frame == 1 {
+				require.Error(t, clientErr)
+			}
+		} else {
+			require.NoError(t, clientErr)
+			require.NoError(t, serverErr)
+
+			go func() { _, _ = client.Write([]byte("hello")) }()
+			_, err = server.Read(make([]byte, 10))
+			require.ErrorContains(t, err, expectErr)
+		}
+
+		_ = c1.Close()
+		_ = c2.Close()
+	}
+}
+
+func TestNoiseConn_close(t *testing.T) {
+	t.Parallel()
+
+	_, clientPri := newNoiseTestKey(t)
+	serverPub, serverPri := newNoiseTestKey(t)
+	acceptAll := WithNoiseVerifyPeer(func(ed25519.PublicKey) error { return nil })
+
+	for name, truncate := range map[string]bool{
+		"close":    false,
+		"truncate": true,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c1, c2 := net.Pipe()
+			defer c2.Close()
+
+			client, err := NoiseClient(c1, clientPri, WithNoisePeerPublicKey(serverPub))
+			require.NoError(t, err)
+			server, err := NoiseServer(c2, serverPri, acceptAll)
+			require.NoError(t, err)
+
+			clientErr, serverErr := noiseHandshakePair(t, client, server)
+			require.NoError(t, clientErr)
+			require.NoError(t, serverErr)
+
+			go func() {
+				_, _ = client.Write([]byte("hello"))
+				if truncate {
+					// close without close record
+					_ = c1.Close()
+				} else {
+					_ = client.Close()
+				}
+			}()
+
+			got, err := io.ReadAll(server)
+			require.Equal(t, []byte("hello"), got)
+			if truncate {
+				require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+				return
+			}
+
+			require.NoError(t, err)
+			_, err = client.Write([]byte("world"))
+			require.ErrorIs(t, err, net.ErrClosed)
+		})
+	}
+}
+
+func TestNoiseHandshakeState_checkPeerEphemeral(t *testing.T) {
+	t.Parallel()
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	pub, pri := newNoiseTestKey(t)
+	conn, err := NoiseClient(c1, pri, WithNoisePeerPublicKey(pub))
+	require.NoError(t, err)
+	hs, err := newNoiseHandshakeState(conn)
+	require.NoError(t, err)
+
+	own, err := hs.ephemeral.PublicKey()
+	require.NoError(t, err)
+	peer, err := NewEcdh(ECDSACurveP256)
+	require.NoError(t, err)
+	peerPub, err := peer.PublicKey()
+	require.NoError(t, err)
+	require.NoError(t, hs.checkPeerEphemeral(own, peerPub))
+
+	t.Run("other curve", func(t *testing.T) {
+		t.Parallel()
+
+		other, err := NewEcdh(ECDSACurveP384)
+		require.NoError(t, err)
+		otherPub, err := other.PublicKey()
+		require.NoError(t, err)
+		require.Error(t, hs.checkPeerEphemeral(own, otherPub))
+	})
+
+	t.Run("point not on curve", func(t *testing.T) {
+		t.Parallel()
+
+		invalid := bytes.Clone(peerPub)
+		invalid[len(invalid)-1] ^= 0xff
+		require.ErrorContains(t, hs.checkPeerEphemeral(own, invalid), "invalid peer ephemeral key")
+	})
+}
+
+func TestNoiseOptions(t *testing.T) {
+	t.Parallel()
+
+	pub, pri := newNoiseTestKey(t)
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	_, err := NoiseClient(c1, pri)
+	require.ErrorContains(t, err, "peer should be authenticated")
+	_, err = NoiseClient(nil, pri, WithNoisePeerPublicKey(pub))
+	require.Error(t, err)
+	_, err = NoiseClient(c1, pri[:10], WithNoisePeerPublicKey(pub))
+	require.Error(t, err)
+	_, err = NoiseClient(c1, pri, WithNoisePeerPublicKey(pub[:10]))
+	require.Error(t, err)
+	_, err = NoiseClient(c1, pri, WithNoiseVerifyPeer(nil))
+	require.Error(t, err)
+	_, err = NoiseClient(c1, pri, WithNoisePeerPublicKey(pub), WithNoiseCurve("P1024"))
+	require.Error(t, err)
+	_, err = NewNoiseListener(nil, pri, WithNoisePeerPublicKey(pub))
+	require.Error(t, err)
+}
+
+func TestNoiseListener(t *testing.T) {
+	t.Parallel()
+
+	clientPub, clientPri := newNoiseTestKey(t)
+	serverPub, serverPri := newNoiseTestKey(t)
+
+	tcpLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln, err := NewNoiseListener(tcpLn, serverPri, WithNoisePeerPublicKey(clientPub))
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		rawConn, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+
+		conn, err := NoiseClient(rawConn, clientPri, WithNoisePeerPublicKey(serverPub))
+		require.NoError(t, err)
+
+		msg := []byte("hello, noise")
+		_, err = conn.Write(msg)
+		require.NoError(t, err)
+		got := make([]byte, len(msg))
+		_, err = io.ReadFull(conn, got)
+		require.NoError(t, err)
+		require.Equal(t, msg, got)
+		require.NoError(t, conn.Close())
+	}
+
+	// unknown client is rejected
+	_, otherPri := newNoiseTestKey(t)
+	rawConn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	conn, err := NoiseClient(rawConn, otherPri, WithNoisePeerPublicKey(serverPub))
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.Handshake())
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+}
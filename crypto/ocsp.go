@@ -0,0 +1,606 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"golang.org/x/crypto/ocsp"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	glog "github.com/Laisky/go-utils/v4/log"
+)
+
+const (
+	// OCSPRequestContentType content type of OCSP request
+	OCSPRequestContentType = "application/ocsp-request"
+	// OCSPResponseContentType content type of OCSP response
+	OCSPResponseContentType = "application/ocsp-response"
+
+	defaultOCSPResponseValidFor = time.Hour
+	maxOCSPMessageSize          = 1024 * 1024
+)
+
+// OCSPStatus status of certificate in OCSP response
+type OCSPStatus int
+
+const (
+	// OCSPStatusGood certificate is not revoked
+	OCSPStatusGood OCSPStatus = ocsp.Good
+	// OCSPStatusRevoked certificate is revoked
+	OCSPStatusRevoked OCSPStatus = ocsp.Revoked
+	// OCSPStatusUnknown responder does not know the certificate
+	OCSPStatusUnknown OCSPStatus = ocsp.Unknown
+)
+
+// String name of status
+func (s OCSPStatus) String() string {
+	switch s {
+	case OCSPStatusGood:
+		return "good"
+	case OCSPStatusRevoked:
+		return "revoked"
+	case OCSPStatusUnknown:
+		return "unknown"
+	default:
+		return "invalid"
+	}
+}
+
+// OCSPCertStatus revocation status of certificate
+type OCSPCertStatus struct {
+	Status OCSPStatus
+	// RevokedAt time of revocation, only for revoked certificate
+	RevokedAt time.Time
+	// RevocationReason reason code refer to RFC-5280 5.3.1,
+	// only for revoked certificate
+	RevocationReason int
+}
+
+// OCSPRevocationSource source of certificates' revocation status
+type OCSPRevocationSource interface {
+	// OCSPStatus get status of certificate by serial number,
+	// should return OCSPStatusUnknown if certificate is not issued by this source
+	OCSPStatus(ctx context.Context, serialNumber *big.Int) (*OCSPCertStatus, error)
+}
+
+// NewOCSPRequest build OCSP request for cert that issued by issuer
+func NewOCSPRequest(cert, issuer *x509.Certificate) (reqDer []byte, err error) {
+	reqDer, err = ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "create ocsp request")
+	}
+
+	return reqDer, nil
+}
+
+// ParseOCSPRequest parse OCSP request
+func ParseOCSPRequest(reqDer []byte) (*ocsp.Request, error) {
+	req, err := ocsp.ParseRequest(reqDer)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse ocsp request")
+	}
+
+	return req, nil
+}
+
+type ocspResponseOption struct {
+	thisUpdate    time.Time
+	nextUpdate    time.Time
+	responderCert *x509.Certificate
+	issuerHash    crypto.Hash
+}
+
+func (o *ocspResponseOption) fillDefault() *ocspResponseOption {
+	o.thisUpdate = gutils.Clock.GetUTCNow()
+	o.nextUpdate = o.thisUpdate.Add(defaultOCSPResponseValidFor)
+	o.issuerHash = crypto.SHA1
+	return o
+}
+
+func (o *ocspResponseOption) applyOpts(opts ...OCSPResponseOption) (*ocspResponseOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	if !o.nextUpdate.After(o.thisUpdate) {
+		return nil, errors.Errorf("nextUpdate should be after thisUpdate")
+	}
+
+	return o, nil
+}
+
+// OCSPResponseOption optional arguments for NewOCSPResponse
+type OCSPResponseOption func(*ocspResponseOption) error
+
+// WithOCSPResponseThisUpdate set thisUpdate
+//
+// default to now
+func WithOCSPResponseThisUpdate(thisUpdate time.Time) OCSPResponseOption {
+	return func(o *ocspResponseOption) error {
+		o.thisUpdate = thisUpdate
+		return nil
+	}
+}
+
+// WithOCSPResponseNextUpdate set nextUpdate
+//
+// default to 1 hour after thisUpdate
+func WithOCSPResponseNextUpdate(nextUpdate time.Time) OCSPResponseOption {
+	return func(o *ocspResponseOption) error {
+		o.nextUpdate = nextUpdate
+		return nil
+	}
+}
+
+// WithOCSPResponseResponderCert set delegated responder certificate,
+// which should be issued by issuer with OCSPSigning ext key usage.
+//
+// default to sign response by issuer itself.
+func WithOCSPResponseResponderCert(responderCert *x509.Certificate) OCSPResponseOption {
+	return func(o *ocspResponseOption) error {
+		if responderCert == nil {
+			return errors.Errorf("responder cert is nil")
+		}
+
+		o.responderCert = responderCert
+		return nil
+	}
+}
+
+// WithOCSPResponseIssuerHash set hash algorithm to identify issuer,
+// should be the same as request's.
+//
+// default to sha1
+func WithOCSPResponseIssuerHash(hash crypto.Hash) OCSPResponseOption {
+	return func(o *ocspResponseOption) error {
+		o.issuerHash = hash
+		return nil
+	}
+}
+
+// NewOCSPResponse build and sign OCSP response
+//
+// only RSA and ECDSA keys are supported.
+//
+// # Args
+//   - issuer: issuer of the certificate
+//   - prikey: private key of issuer, or of delegated responder certificate
+//   - serialNumber: serial number of the certificate
+//   - status: revocation status of the certificate
+func NewOCSPResponse(issuer *x509.Certificate,
+	prikey crypto.PrivateKey,
+	serialNumber *big.Int,
+	status *OCSPCertStatus,
+	opts ...OCSPResponseOption) (respDer []byte, err error) {
+	if err = validPrikey(prikey); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	opt, err := new(ocspResponseOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	tpl := ocsp.Response{
+		Status:           int(status.Status),
+		SerialNumber:     serialNumber,
+		ThisUpdate:       opt.thisUpdate,
+		NextUpdate:       opt.nextUpdate,
+		RevokedAt:        status.RevokedAt,
+		RevocationReason: status.RevocationReason,
+		IssuerHash:       opt.issuerHash,
+	}
+
+	responderCert := issuer
+	if opt.responderCert != nil {
+		responderCert = opt.responderCert
+		tpl.Certificate = opt.responderCert
+	}
+
+	respDer, err = ocsp.CreateResponse(issuer, responderCert, tpl, Privkey2Signer(prikey))
+	if err != nil {
+		return nil, errors.Wrap(err, "create ocsp response")
+	}
+
+	return respDer, nil
+}
+
+// ParseOCSPResponse parse OCSP response and verify its signature
+//
+// # Args
+//   - respDer: OCSP response
+//   - cert: (optional) if not nil, will check whether response is for cert
+//   - issuer: issuer of the certificate
+//
+// delegated responder certificate should be signed by issuer
+// and have OCSPSigning ext key usage, refer to RFC-6960 4.2.2.2.
+func ParseOCSPResponse(respDer []byte, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	resp, err := ocsp.ParseResponseForCert(respDer, cert, issuer)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse ocsp response")
+	}
+
+	if resp.Certificate != nil &&
+		(issuer == nil || !bytes.Equal(resp.Certificate.Raw, issuer.Raw)) &&
+		!slices.Contains(resp.Certificate.ExtKeyUsage, x509.ExtKeyUsageOCSPSigning) {
+		return nil, errors.Errorf("delegated responder cert lacks OCSPSigning ext key usage")
+	}
+
+	return resp, nil
+}
+
+// ocspIssuerMatch check whether request is for certificate issued by issuer
+func ocspIssuerMatch(req *ocsp.Request, issuer *x509.Certificate) (bool, error) {
+	if !req.HashAlgorithm.Available() {
+		return false, errors.Errorf("unsupported hash algorithm %v", req.HashAlgorithm)
+	}
+
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return false, errors.Wrap(err, "parse issuer public key")
+	}
+
+	h := req.HashAlgorithm.New()
+	h.Write(publicKeyInfo.PublicKey.RightAlign())
+	if !bytes.Equal(h.Sum(nil), req.IssuerKeyHash) {
+		return false, nil
+	}
+
+	h.Reset()
+	h.Write(issuer.RawSubject)
+	return bytes.Equal(h.Sum(nil), req.IssuerNameHash), nil
+}
+
+// OCSPResponder http handler to answer OCSP requests, refer to RFC-6960 A.1
+//
+// support both GET and POST. for GET, the base64 encoded request should
+// be the whole path, mount it by http.StripPrefix if needed.
+type OCSPResponder struct {
+	opt    *ocspResponderOption
+	issuer *x509.Certificate
+	prikey crypto.PrivateKey
+	source OCSPRevocationSource
+}
+
+type ocspResponderOption struct {
+	logger        glog.Logger
+	validFor      time.Duration
+	responderCert *x509.Certificate
+}
+
+func (o *ocspResponderOption) fillDefault() *ocspResponderOption {
+	o.logger = glog.Shared.Named("ocsp_responder")
+	o.validFor = defaultOCSPResponseValidFor
+	return o
+}
+
+func (o *ocspResponderOption) applyOpts(opts ...OCSPResponderOption) (*ocspResponderOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// OCSPResponderOption optional arguments for OCSPResponder
+type OCSPResponderOption func(*ocspResponderOption) error
+
+// WithOCSPResponderLogger set logger
+func WithOCSPResponderLogger(logger glog.Logger) OCSPResponderOption {
+	return func(o *ocspResponderOption) error {
+		if logger == nil {
+			return errors.Errorf("logger is nil")
+		}
+
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithOCSPResponderValidFor set duration between thisUpdate and nextUpdate of responses
+//
+// default to 1 hour
+func WithOCSPResponderValidFor(validFor time.Duration) OCSPResponderOption {
+	return func(o *ocspResponderOption) error {
+		if validFor <= 0 {
+			return errors.Errorf("validFor should be positive")
+		}
+
+		o.validFor = validFor
+		return nil
+	}
+}
+
+// WithOCSPResponderCert set delegated responder certificate,
+// the prikey of responder should belong to this certificate.
+func WithOCSPResponderCert(responderCert *x509.Certificate) OCSPResponderOption {
+	return func(o *ocspResponderOption) error {
+		if responderCert == nil {
+			return errors.Errorf("responder cert is nil")
+		}
+		if !slices.Contains(responderCert.ExtKeyUsage, x509.ExtKeyUsageOCSPSigning) {
+			return errors.Errorf("responder cert should have OCSPSigning ext key usage")
+		}
+
+		o.responderCert = responderCert
+		return nil
+	}
+}
+
+// NewOCSPResponder new OCSP responder
+//
+// # Args
+//   - issuer: CA that issued certificates in source
+//   - prikey: private key of issuer, or of delegated responder certificate
+//   - source: revocation status source
+func NewOCSPResponder(issuer *x509.Certificate,
+	prikey crypto.PrivateKey,
+	source OCSPRevocationSource,
+	opts ...OCSPResponderOption) (*OCSPResponder, error) {
+	if issuer == nil || source == nil {
+		return nil, errors.Errorf("issuer and source should not be empty")
+	}
+	if err := validPrikey(prikey); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	opt, err := new(ocspResponderOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	return &OCSPResponder{
+		opt:    opt,
+		issuer: issuer,
+		prikey: prikey,
+		source: source,
+	}, nil
+}
+
+// ServeHTTP answer OCSP request
+func (r *OCSPResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var reqDer []byte
+	switch req.Method {
+	case http.MethodGet:
+		var err error
+		if reqDer, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(req.URL.Path, "/")); err != nil {
+			r.writeResponse(w, ocsp.MalformedRequestErrorResponse)
+			return
+		}
+	case http.MethodPost:
+		if ct := req.Header.Get("Content-Type"); ct != OCSPRequestContentType {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		var err error
+		if reqDer, err = io.ReadAll(io.LimitReader(req.Body, maxOCSPMessageSize)); err != nil {
+			r.writeResponse(w, ocsp.MalformedRequestErrorResponse)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	respDer, err := r.Respond(req.Context(), reqDer)
+	if err != nil {
+		r.opt.logger.Warn("respond ocsp request", zap.Error(err))
+	}
+
+	r.writeResponse(w, respDer)
+}
+
+func (r *OCSPResponder) writeResponse(w http.ResponseWriter, respDer []byte) {
+	w.Header().Set("Content-Type", OCSPResponseContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	if _, err := w.Write(respDer); err != nil {
+		r.opt.logger.Warn("write ocsp response", zap.Error(err))
+	}
+}
+
+// Respond build OCSP response for request
+//
+// will always return a valid OCSP response, even if err is not nil.
+func (r *OCSPResponder) Respond(ctx context.Context, reqDer []byte) (respDer []byte, err error) {
+	req, err := ParseOCSPRequest(reqDer)
+	if err != nil {
+		return ocsp.MalformedRequestErrorResponse, errors.Wrap(err, "parse request")
+	}
+
+	if ok, err := ocspIssuerMatch(req, r.issuer); err != nil {
+		return ocsp.MalformedRequestErrorResponse, errors.Wrap(err, "check issuer")
+	} else if !ok {
+		return ocsp.UnauthorizedErrorResponse, errors.Errorf("request is not for this issuer")
+	}
+
+	status, err := r.source.OCSPStatus(ctx, req.SerialNumber)
+	if err != nil {
+		return ocsp.InternalErrorErrorResponse,
+			errors.Wrapf(err, "get status of certificate %s", req.SerialNumber)
+	}
+
+	now := gutils.Clock.GetUTCNow()
+	opts := []OCSPResponseOption{
+		WithOCSPResponseThisUpdate(now),
+		WithOCSPResponseNextUpdate(now.Add(r.opt.validFor)),
+		WithOCSPResponseIssuerHash(req.HashAlgorithm),
+	}
+	if r.opt.responderCert != nil {
+		opts = append(opts, WithOCSPResponseResponderCert(r.opt.responderCert))
+	}
+
+	respDer, err = NewOCSPResponse(r.issuer, r.prikey, req.SerialNumber, status, opts...)
+	if err != nil {
+		return ocsp.InternalErrorErrorResponse, errors.Wrap(err, "build response")
+	}
+
+	return respDer, nil
+}
+
+// OCSPClient check certificates' revocation status by OCSP
+type OCSPClient struct {
+	opt *ocspClientOption
+}
+
+type ocspClientOption struct {
+	httpClient *http.Client
+}
+
+func (o *ocspClientOption) fillDefault() *ocspClientOption {
+	o.httpClient = &http.Client{Timeout: 10 * time.Second}
+	return o
+}
+
+func (o *ocspClientOption) applyOpts(opts ...OCSPClientOption) (*ocspClientOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// OCSPClientOption optional arguments for OCSPClient
+type OCSPClientOption func(*ocspClientOption) error
+
+// WithOCSPClientHTTPClient set http client
+//
+// default to http client with 10s timeout
+func WithOCSPClientHTTPClient(httpClient *http.Client) OCSPClientOption {
+	return func(o *ocspClientOption) error {
+		if httpClient == nil {
+			return errors.Errorf("http client is nil")
+		}
+
+		o.httpClient = httpClient
+		return nil
+	}
+}
+
+// NewOCSPClient new OCSP client
+func NewOCSPClient(opts ...OCSPClientOption) (*OCSPClient, error) {
+	opt, err := new(ocspClientOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	return &OCSPClient{opt: opt}, nil
+}
+
+// Query query revocation status of cert from its OCSP servers
+//
+// will try cert.OCSPServer in order, return the first valid response.
+func (c *OCSPClient) Query(ctx context.Context, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	if len(cert.OCSPServer) == 0 {
+		return nil, errors.Errorf("certificate %s has no ocsp server", cert.SerialNumber)
+	}
+
+	reqDer, err := NewOCSPRequest(cert, issuer)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var errs []error
+	for _, server := range cert.OCSPServer {
+		resp, err := c.query(ctx, server, reqDer, cert, issuer)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "query %q", server))
+			continue
+		}
+
+		return resp, nil
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+func (c *OCSPClient) query(ctx context.Context,
+	server string, reqDer []byte, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(reqDer))
+	if err != nil {
+		return nil, errors.Wrap(err, "new request")
+	}
+	httpReq.Header.Set("Content-Type", OCSPRequestContentType)
+
+	httpResp, err := c.opt.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "do request")
+	}
+	defer gutils.LogErr(httpResp.Body.Close, glog.Shared)
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status code %d", httpResp.StatusCode)
+	}
+
+	respDer, err := io.ReadAll(io.LimitReader(httpResp.Body, maxOCSPMessageSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "read response")
+	}
+
+	resp, err := ParseOCSPResponse(respDer, cert, issuer)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	now := gutils.Clock.GetUTCNow()
+	if resp.ThisUpdate.After(now.Add(time.Minute)) {
+		return nil, errors.Errorf("response is not yet valid")
+	}
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(now) {
+		return nil, errors.Errorf("response is expired")
+	}
+
+	return resp, nil
+}
+
+// VerifyChain check revocation status of every certificate in chain by OCSP
+//
+// chain should be ordered from leaf to root, chain[i] is issued by chain[i+1],
+// the root certificate (last one) will not be checked.
+// return error if any certificate is revoked or unknown.
+func (c *OCSPClient) VerifyChain(ctx context.Context, chain []*x509.Certificate) error {
+	if len(chain) < 2 {
+		return errors.Errorf("chain should contain at least 2 certificates")
+	}
+
+	for i := 0; i < len(chain)-1; i++ {
+		resp, err := c.Query(ctx, chain[i], chain[i+1])
+		if err != nil {
+			return errors.Wrapf(err, "query status of certificate %s", chain[i].SerialNumber)
+		}
+
+		switch OCSPStatus(resp.Status) {
+		case OCSPStatusGood:
+		case OCSPStatusRevoked:
+			return errors.Errorf("certificate %s is revoked at %s",
+				chain[i].SerialNumber, resp.RevokedAt.Format(time.RFC3339))
+		default:
+			return errors.Errorf("certificate %s status is %s",
+				chain[i].SerialNumber, OCSPStatus(resp.Status))
+		}
+	}
+
+	return nil
+}
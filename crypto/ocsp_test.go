@@ -0,0 +1,229 @@
+package crypto
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testOCSPSource struct {
+	mu       sync.RWMutex
+	statuses map[string]*OCSPCertStatus
+}
+
+func (s *testOCSPSource) OCSPStatus(_ context.Context, serialNumber *big.Int) (*OCSPCertStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if status, ok := s.statuses[serialNumber.String()]; ok {
+		return status, nil
+	}
+
+	return &OCSPCertStatus{Status: OCSPStatusUnknown}, nil
+}
+
+func (s *testOCSPSource) set(serialNumber *big.Int, status *OCSPCertStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statuses[serialNumber.String()] = status
+}
+
+type testOCSPPKI struct {
+	caPrikey any
+	ca       *x509.Certificate
+	issue    func(opts ...SignCSROption) *x509.Certificate
+}
+
+func newTestOCSPPKI(t *testing.T, ocspServer string) *testOCSPPKI {
+	t.Helper()
+
+	caPrikeyPem, caDer, err := NewECDSAPrikeyAndCert(ECDSACurveP256,
+		WithX509CertCommonName("test-ca"),
+		WithX509CertIsCA(),
+	)
+	require.NoError(t, err)
+	caPrikey, err := Pem2Prikey(caPrikeyPem)
+	require.NoError(t, err)
+	ca, err := Der2Cert(caDer)
+	require.NoError(t, err)
+
+	return &testOCSPPKI{
+		caPrikey: caPrikey,
+		ca:       ca,
+		issue: func(opts ...SignCSROption) *x509.Certificate {
+			prikey, err := NewECDSAPrikey(ECDSACurveP256)
+			require.NoError(t, err)
+			csrDer, err := NewX509CSR(prikey, WithX509CSRCommonName("leaf"))
+			require.NoError(t, err)
+
+			opts = append(opts, WithX509SignCSROCSPServers(ocspServer))
+			certDer, err := NewX509CertByCSR(ca, caPrikey, csrDer, opts...)
+			require.NoError(t, err)
+			cert, err := Der2Cert(certDer)
+			require.NoError(t, err)
+			return cert
+		},
+	}
+}
+
+func TestOCSPResponder(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var handler http.Handler
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	pki := newTestOCSPPKI(t, ts.URL)
+	source := &testOCSPSource{statuses: map[string]*OCSPCertStatus{}}
+	responder, err := NewOCSPResponder(pki.ca, pki.caPrikey, source)
+	require.NoError(t, err)
+	handler = responder
+
+	client, err := NewOCSPClient(WithOCSPClientHTTPClient(ts.Client()))
+	require.NoError(t, err)
+
+	goodCert := pki.issue()
+	source.set(goodCert.SerialNumber, &OCSPCertStatus{Status: OCSPStatusGood})
+	revokedCert := pki.issue()
+	revokedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	source.set(revokedCert.SerialNumber, &OCSPCertStatus{
+		Status:           OCSPStatusRevoked,
+		RevokedAt:        revokedAt,
+		RevocationReason: ocsp.KeyCompromise,
+	})
+	unknownCert := pki.issue()
+
+	t.Run("good", func(t *testing.T) {
+		resp, err := client.Query(ctx, goodCert, pki.ca)
+		require.NoError(t, err)
+		require.Equal(t, ocsp.Good, resp.Status)
+		require.NoError(t, client.VerifyChain(ctx, []*x509.Certificate{goodCert, pki.ca}))
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		resp, err := client.Query(ctx, revokedCert, pki.ca)
+		require.NoError(t, err)
+		require.Equal(t, ocsp.Revoked, resp.Status)
+		require.Equal(t, ocsp.KeyCompromise, resp.RevocationReason)
+		require.True(t, revokedAt.Equal(resp.RevokedAt))
+
+		err = client.VerifyChain(ctx, []*x509.Certificate{revokedCert, pki.ca})
+		require.ErrorContains(t, err, "is revoked")
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		err := client.VerifyChain(ctx, []*x509.Certificate{unknownCert, pki.ca})
+		require.ErrorContains(t, err, "status is unknown")
+	})
+
+	t.Run("get", func(t *testing.T) {
+		reqDer, err := NewOCSPRequest(goodCert, pki.ca)
+		require.NoError(t, err)
+
+		httpResp, err := ts.Client().Get(ts.URL + "/" + base64.StdEncoding.EncodeToString(reqDer))
+		require.NoError(t, err)
+		defer httpResp.Body.Close()
+		require.Equal(t, OCSPResponseContentType, httpResp.Header.Get("Content-Type"))
+
+		respDer, err := io.ReadAll(httpResp.Body)
+		require.NoError(t, err)
+		resp, err := ParseOCSPResponse(respDer, goodCert, pki.ca)
+		require.NoError(t, err)
+		require.Equal(t, ocsp.Good, resp.Status)
+	})
+
+	t.Run("other issuer", func(t *testing.T) {
+		other := newTestOCSPPKI(t, ts.URL)
+		cert := other.issue()
+
+		_, err := client.Query(ctx, cert, other.ca)
+		require.ErrorContains(t, err, "unauthorized")
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		respDer, err := responder.Respond(ctx, []byte("laisky"))
+		require.Error(t, err)
+		require.Equal(t, ocsp.MalformedRequestErrorResponse, respDer)
+	})
+}
+
+func TestOCSPResponder_delegated(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var handler http.Handler
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	pki := newTestOCSPPKI(t, ts.URL)
+	source := &testOCSPSource{statuses: map[string]*OCSPCertStatus{}}
+
+	responderPrikey, err := NewECDSAPrikey(ECDSACurveP256)
+	require.NoError(t, err)
+	responderCsr, err := NewX509CSR(responderPrikey, WithX509CSRCommonName("ocsp-responder"))
+	require.NoError(t, err)
+	responderDer, err := NewX509CertByCSR(pki.ca, pki.caPrikey, responderCsr,
+		WithX509SignCSRExtKeyUsage(x509.ExtKeyUsageOCSPSigning))
+	require.NoError(t, err)
+	responderCert, err := Der2Cert(responderDer)
+	require.NoError(t, err)
+
+	_, err = NewOCSPResponder(pki.ca, responderPrikey, source, WithOCSPResponderCert(pki.ca))
+	require.ErrorContains(t, err, "OCSPSigning")
+
+	responder, err := NewOCSPResponder(pki.ca, responderPrikey, source,
+		WithOCSPResponderCert(responderCert))
+	require.NoError(t, err)
+	handler = responder
+
+	cert := pki.issue()
+	source.set(cert.SerialNumber, &OCSPCertStatus{Status: OCSPStatusGood})
+
+	client, err := NewOCSPClient(WithOCSPClientHTTPClient(ts.Client()))
+	require.NoError(t, err)
+	resp, err := client.Query(ctx, cert, pki.ca)
+	require.NoError(t, err)
+	require.Equal(t, ocsp.Good, resp.Status)
+	require.Equal(t, responderCert.Raw, resp.Certificate.Raw)
+
+	t.Run("delegated responder without OCSPSigning", func(t *testing.T) {
+		t.Parallel()
+
+		csr, err := NewX509CSR(responderPrikey, WithX509CSRCommonName("not-ocsp-responder"))
+		require.NoError(t, err)
+		der, err := NewX509CertByCSR(pki.ca, pki.caPrikey, csr,
+			WithX509SignCSRExtKeyUsage(x509.ExtKeyUsageServerAuth))
+		require.NoError(t, err)
+		badResponder, err := Der2Cert(der)
+		require.NoError(t, err)
+
+		respDer, err := NewOCSPResponse(pki.ca, responderPrikey, cert.SerialNumber,
+			&OCSPCertStatus{Status: OCSPStatusGood}, WithOCSPResponseResponderCert(badResponder))
+		require.NoError(t, err)
+		_, err = ParseOCSPResponse(respDer, cert, pki.ca)
+		require.ErrorContains(t, err, "OCSPSigning")
+
+		// response signed by issuer itself is fine
+		respDer, err = NewOCSPResponse(pki.ca, pki.caPrikey, cert.SerialNumber,
+			&OCSPCertStatus{Status: OCSPStatusGood}, WithOCSPResponseResponderCert(pki.ca))
+		require.NoError(t, err)
+		_, err = ParseOCSPResponse(respDer, cert, pki.ca)
+		require.NoError(t, err)
+	})
+}
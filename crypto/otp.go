@@ -1,11 +1,16 @@
 package crypto
 
 import (
+	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base32"
+	"encoding/hex"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Laisky/errors/v2"
@@ -32,6 +37,22 @@ const (
 	OTPAlgorithmSHA1 OTPAlgorithm = "sha1"
 )
 
+const (
+	// otpHOTPResyncWindow how many counters to look ahead when resync hotp
+	otpHOTPResyncWindow = 100
+	// otpBackupCodeLen length of backup code without separator
+	otpBackupCodeLen = 10
+	// otpBackupCodeMinKeyLen minimal length of hmac key for backup codes
+	otpBackupCodeMinKeyLen = 16
+)
+
+var (
+	// ErrOTPInvalid otp code is invalid
+	ErrOTPInvalid = errors.New("invalid otp code")
+	// ErrOTPReused otp code has been used
+	ErrOTPReused = errors.New("otp code has been used")
+)
+
 // Base32Secret generate base32 encoded secret
 func Base32Secret(key []byte) string {
 	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(key)
@@ -67,6 +88,17 @@ type OTPArgs struct {
 	//
 	// default to 30
 	PeriodSecs uint
+	// Skew (optional) for totp, number of periods before and after
+	// the verifying time are accepted, 1 is recommended.
+	// for hotp, number of counters to look ahead.
+	//
+	// default to 0
+	Skew uint
+	// LastUsedStep (optional) time step of last accepted totp code,
+	// codes in this or earlier steps will be rejected.
+	//
+	// persist TOTP.LastUsedStep() after verifying, and restore it here.
+	LastUsedStep int64
 }
 
 // Hasher get hasher from argument
@@ -86,6 +118,9 @@ func (a OTPArgs) Hasher() (*gotp.Hasher, error) {
 type TOTP struct {
 	arg    OTPArgs
 	engine *gotp.TOTP
+
+	mu           sync.Mutex
+	lastUsedStep int64
 }
 
 // TOTPInterface interface for TOTP
@@ -121,7 +156,8 @@ func NewTOTP(arg OTPArgs) (*TOTP, error) {
 			int(arg.PeriodSecs),
 			hasher,
 		),
-		arg: arg,
+		arg:          arg,
+		lastUsedStep: arg.LastUsedStep,
 	}, nil
 }
 
@@ -149,6 +185,242 @@ func (t *TOTP) URI() string {
 	)
 }
 
+// Verify verify code at time
+//
+// codes in Skew periods around at are accepted,
+// return ErrOTPReused if code's time step is not later than last accepted one.
+func (t *TOTP) Verify(code string, at time.Time) error {
+	period := int64(t.arg.PeriodSecs)
+	step := at.Unix() / period
+	matched := int64(-1)
+	for i := -int64(t.arg.Skew); i <= int64(t.arg.Skew); i++ {
+		if step+i < 0 {
+			continue
+		}
+
+		if otpCodeEqual(t.engine.At((step+i)*period), code) {
+			matched = step + i
+			break
+		}
+	}
+	if matched < 0 {
+		return errors.WithStack(ErrOTPInvalid)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if matched <= t.lastUsedStep {
+		return errors.WithStack(ErrOTPReused)
+	}
+
+	t.lastUsedStep = matched
+	return nil
+}
+
+// LastUsedStep time step of last accepted code
+func (t *TOTP) LastUsedStep() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.lastUsedStep
+}
+
+// HOTP counter-based OTP
+type HOTP struct {
+	arg    OTPArgs
+	engine *gotp.HOTP
+
+	mu      sync.Mutex
+	counter int
+}
+
+// HOTPInterface interface for HOTP
+type HOTPInterface interface {
+	// KeyAt generate key at counter
+	KeyAt(counter int) string
+	// Counter next expected counter
+	Counter() int
+	// URI build uri for otp arguments
+	URI() string
+	// Verify verify code, and move counter forward
+	Verify(code string) error
+	// Resync resync counter by two consecutive codes
+	Resync(code1, code2 string) error
+}
+
+// NewHOTP new HOTP, counter starts from arg.InitialCount
+func NewHOTP(arg OTPArgs) (*HOTP, error) {
+	arg.OtpType = OTPTypeHOTP
+	if len(arg.Base32Secret) == 0 {
+		return nil, errors.Errorf("secret shoule not be empty")
+	}
+	if arg.InitialCount < 0 {
+		return nil, errors.Errorf("initial count should not be negative")
+	}
+
+	arg.Algorithm = gutils.OptionalVal(&arg.Algorithm, OTPAlgorithmSHA1)
+	arg.Digits = gutils.OptionalVal(&arg.Digits, 6)
+
+	hasher, err := arg.Hasher()
+	if err != nil {
+		return nil, err
+	}
+
+	return &HOTP{
+		engine:  gotp.NewHOTP(arg.Base32Secret, int(arg.Digits), hasher),
+		arg:     arg,
+		counter: arg.InitialCount,
+	}, nil
+}
+
+// KeyAt generate key at counter
+func (h *HOTP) KeyAt(counter int) string {
+	return h.engine.At(counter)
+}
+
+// Counter next expected counter, should be persisted after verifying
+func (h *HOTP) Counter() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.counter
+}
+
+// URI build uri for otp arguments, with current counter
+func (h *HOTP) URI() string {
+	return gotp.BuildUri(
+		string(h.arg.OtpType),
+		h.arg.Base32Secret,
+		h.arg.AccountName,
+		h.arg.IssuerName,
+		string(h.arg.Algorithm),
+		h.Counter(),
+		int(h.arg.Digits),
+		0,
+	)
+}
+
+// Verify verify code in [counter, counter+Skew],
+// counter will move to the next of matched one.
+func (h *HOTP) Verify(code string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	matched, ok := h.match(code, h.counter, int(h.arg.Skew))
+	if !ok {
+		return errors.WithStack(ErrOTPInvalid)
+	}
+
+	h.counter = matched + 1
+	return nil
+}
+
+// Resync resync counter by two consecutive codes,
+// when client's counter is far ahead of server's.
+func (h *HOTP) Resync(code1, code2 string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	start := h.counter
+	for {
+		matched, ok := h.match(code1, start, h.counter+otpHOTPResyncWindow-start)
+		if !ok {
+			return errors.WithStack(ErrOTPInvalid)
+		}
+
+		if otpCodeEqual(h.engine.At(matched+1), code2) {
+			h.counter = matched + 2
+			return nil
+		}
+
+		start = matched + 1
+	}
+}
+
+// match find counter in [start, start+window] whose code is code
+func (h *HOTP) match(code string, start, window int) (int, bool) {
+	for c := start; c <= start+window; c++ {
+		if otpCodeEqual(h.engine.At(c), code) {
+			return c, true
+		}
+	}
+
+	return 0, false
+}
+
+func otpCodeEqual(expect, code string) bool {
+	return subtle.ConstantTimeCompare([]byte(expect), []byte(code)) == 1
+}
+
+// GenerateOTPBackupCodes generate n one-time recovery codes, like `abcde-fghij`
+//
+// codes should be shown to user, and only hashes should be stored.
+// key is the server side secret used by HashOTPBackupCode.
+func GenerateOTPBackupCodes(key []byte, n int) (codes, hashes []string, err error) {
+	if n <= 0 {
+		return nil, nil, errors.Errorf("n should be positive")
+	}
+
+	for i := 0; i < n; i++ {
+		// each base32 char carries 5 bits, round up bytes and truncate,
+		// so that every char of the code is random.
+		raw, err := gutils.SecRandomBytesWithLength((otpBackupCodeLen*5 + 7) / 8)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "generate random bytes")
+		}
+
+		code := strings.ToLower(Base32Secret(raw))[:otpBackupCodeLen]
+		code = code[:otpBackupCodeLen/2] + "-" + code[otpBackupCodeLen/2:]
+		hashed, err := HashOTPBackupCode(key, code)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashed)
+	}
+
+	return codes, hashes, nil
+}
+
+// HashOTPBackupCode hash backup code by HMAC-SHA256 with server side key,
+// separators and cases are ignored.
+//
+// codes only have 50 bits of entropy, so the key should be kept
+// out of the storage of hashes, otherwise the codes can be brute forced.
+func HashOTPBackupCode(key []byte, code string) (string, error) {
+	if len(key) < otpBackupCodeMinKeyLen {
+		return "", errors.Errorf("key should be at least %d bytes", otpBackupCodeMinKeyLen)
+	}
+
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(code))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyOTPBackupCode find code in hashes, return its index,
+// the matched hash should be removed from storage.
+func VerifyOTPBackupCode(key []byte, code string, hashes []string) (int, error) {
+	hashed, err := HashOTPBackupCode(key, code)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	matched := -1
+	for i, h := range hashes {
+		if hmac.Equal([]byte(hashed), []byte(h)) && matched < 0 {
+			matched = i
+		}
+	}
+	if matched < 0 {
+		return 0, errors.WithStack(ErrOTPInvalid)
+	}
+
+	return matched, nil
+}
+
 // ParseOTPUri parse otp uri to otp arguments
 //
 // # Args
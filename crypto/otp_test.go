@@ -1,6 +1,10 @@
 package crypto
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -50,3 +54,178 @@ func TestTOTP_Key(t *testing.T) {
 	require.NoError(t, err)
 	testTOTP(t, tt)
 }
+
+func TestTOTP_Verify(t *testing.T) {
+	t.Parallel()
+
+	// RFC 6238 test vectors
+	tt, err := NewTOTP(OTPArgs{
+		Base32Secret: Base32Secret([]byte("12345678901234567890")),
+		Digits:       8,
+	})
+	require.NoError(t, err)
+	require.NoError(t, tt.Verify("94287082", time.Unix(59, 0)))
+	require.NoError(t, tt.Verify("07081804", time.Unix(1111111109, 0)))
+	require.ErrorIs(t, tt.Verify("07081804", time.Unix(1111111109, 0)), ErrOTPReused)
+	require.ErrorIs(t, tt.Verify("94287082", time.Unix(59, 0)), ErrOTPReused, "earlier step")
+	require.EqualValues(t, 1111111109/30, tt.LastUsedStep())
+
+	t.Run("skew", func(t *testing.T) {
+		now := time.Unix(1700000000, 0)
+		tt, err := NewTOTP(OTPArgs{
+			Base32Secret: Base32Secret([]byte("12345678901234567890")),
+			Skew:         1,
+		})
+		require.NoError(t, err)
+
+		prev := tt.KeyAt(now.Add(-30 * time.Second))
+		next := tt.KeyAt(now.Add(30 * time.Second))
+		tooLate := tt.KeyAt(now.Add(60 * time.Second))
+
+		require.ErrorIs(t, tt.Verify(tooLate, now), ErrOTPInvalid)
+		require.ErrorIs(t, tt.Verify("000000", now), ErrOTPInvalid)
+		require.NoError(t, tt.Verify(prev, now))
+		require.NoError(t, tt.Verify(next, now))
+		// current step is earlier than the accepted next step
+		require.ErrorIs(t, tt.Verify(tt.KeyAt(now), now), ErrOTPReused)
+
+		strict, err := NewTOTP(OTPArgs{
+			Base32Secret: Base32Secret([]byte("12345678901234567890")),
+		})
+		require.NoError(t, err)
+		require.ErrorIs(t, strict.Verify(prev, now), ErrOTPInvalid)
+	})
+
+	t.Run("restore last used step", func(t *testing.T) {
+		now := time.Unix(1700000000, 0)
+		tt, err := NewTOTP(OTPArgs{
+			Base32Secret: Base32Secret([]byte("12345678901234567890")),
+			LastUsedStep: now.Unix() / 30,
+		})
+		require.NoError(t, err)
+		require.ErrorIs(t, tt.Verify(tt.KeyAt(now), now), ErrOTPReused)
+	})
+}
+
+func TestHOTP(t *testing.T) {
+	t.Parallel()
+
+	// RFC 4226 test vectors
+	expects := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	arg := OTPArgs{
+		Base32Secret: Base32Secret([]byte("12345678901234567890")),
+		AccountName:  "laisky",
+		IssuerName:   "laisky-corp",
+	}
+
+	var ht HOTPInterface
+	ht, err := NewHOTP(arg)
+	require.NoError(t, err)
+	for i, expect := range expects {
+		require.Equal(t, expect, ht.KeyAt(i))
+	}
+
+	t.Run("verify", func(t *testing.T) {
+		arg := arg
+		arg.Skew = 2
+		ht, err := NewHOTP(arg)
+		require.NoError(t, err)
+
+		require.NoError(t, ht.Verify(expects[0]))
+		require.Equal(t, 1, ht.Counter())
+		require.ErrorIs(t, ht.Verify(expects[0]), ErrOTPInvalid, "replay")
+
+		require.NoError(t, ht.Verify(expects[3]), "in look-ahead window")
+		require.Equal(t, 4, ht.Counter())
+		require.ErrorIs(t, ht.Verify(expects[7]), ErrOTPInvalid, "out of look-ahead window")
+		require.Equal(t, 4, ht.Counter())
+
+		uri := ht.URI()
+		require.Contains(t, uri, "counter=4")
+		parsed, err := ParseOTPUri(uri)
+		require.NoError(t, err)
+		require.Equal(t, OTPTypeHOTP, parsed.OtpType)
+		require.Equal(t, 4, parsed.InitialCount)
+	})
+
+	t.Run("resync", func(t *testing.T) {
+		ht, err := NewHOTP(arg)
+		require.NoError(t, err)
+
+		require.ErrorIs(t, ht.Resync(expects[5], expects[7]), ErrOTPInvalid, "not consecutive")
+		require.NoError(t, ht.Resync(expects[6], expects[7]))
+		require.Equal(t, 8, ht.Counter())
+		require.NoError(t, ht.Verify(expects[8]))
+
+		farAway := ht.KeyAt(ht.Counter() + otpHOTPResyncWindow + 1)
+		farAwayNext := ht.KeyAt(ht.Counter() + otpHOTPResyncWindow + 2)
+		require.ErrorIs(t, ht.Resync(farAway, farAwayNext), ErrOTPInvalid)
+	})
+
+	t.Run("invalid args", func(t *testing.T) {
+		_, err := NewHOTP(OTPArgs{})
+		require.Error(t, err)
+		_, err = NewHOTP(OTPArgs{Base32Secret: arg.Base32Secret, InitialCount: -1})
+		require.Error(t, err)
+	})
+}
+
+func TestOTPBackupCodes(t *testing.T) {
+	t.Parallel()
+
+	key, err := Salt(32)
+	require.NoError(t, err)
+
+	_, _, err = GenerateOTPBackupCodes(key, 0)
+	require.Error(t, err)
+	_, _, err = GenerateOTPBackupCodes([]byte("short"), 10)
+	require.ErrorContains(t, err, "key should be at least")
+
+	codes, hashes, err := GenerateOTPBackupCodes(key, 10)
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+	require.Len(t, hashes, 10)
+	for i, code := range codes {
+		require.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, code)
+		require.NotContains(t, hashes[i], code[:5])
+
+		// hash is keyed, can not be brute forced without key
+		plain := sha256.Sum256([]byte(strings.ReplaceAll(code, "-", "")))
+		require.NotEqual(t, hex.EncodeToString(plain[:]), hashes[i])
+	}
+
+	// last char carries 5 random bits, not only 3 bits with zero padding
+	t.Run("entropy", func(t *testing.T) {
+		codes, _, err := GenerateOTPBackupCodes(key, 100)
+		require.NoError(t, err)
+		require.True(t, slices.ContainsFunc(codes, func(code string) bool {
+			return !strings.ContainsRune("aeimquy4", rune(code[len(code)-1]))
+		}))
+	})
+
+	idx, err := VerifyOTPBackupCode(key, codes[3], hashes)
+	require.NoError(t, err)
+	require.Equal(t, 3, idx)
+
+	// separator and case are ignored
+	idx, err = VerifyOTPBackupCode(key, strings.ToUpper(strings.ReplaceAll(codes[5], "-", " ")), hashes)
+	require.NoError(t, err)
+	require.Equal(t, 5, idx)
+
+	_, err = VerifyOTPBackupCode(key, "aaaaa-aaaaa", hashes)
+	require.ErrorIs(t, err, ErrOTPInvalid)
+
+	// wrong key
+	otherKey, err := Salt(32)
+	require.NoError(t, err)
+	_, err = VerifyOTPBackupCode(otherKey, codes[3], hashes)
+	require.ErrorIs(t, err, ErrOTPInvalid)
+
+	// used code is removed by caller
+	hashes = append(hashes[:3], hashes[4:]...)
+	_, err = VerifyOTPBackupCode(key, codes[3], hashes)
+	require.ErrorIs(t, err, ErrOTPInvalid)
+}
@@ -0,0 +1,435 @@
+package crypto
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PasswordHashAlgorithm memory-hard password hashing algorithm
+type PasswordHashAlgorithm string
+
+const (
+	// PasswordHashArgon2id argon2id, recommended by RFC 9106
+	PasswordHashArgon2id PasswordHashAlgorithm = "argon2id"
+	// PasswordHashScrypt scrypt
+	PasswordHashScrypt PasswordHashAlgorithm = "scrypt"
+)
+
+// String name of algorithm
+func (a PasswordHashAlgorithm) String() string {
+	return string(a)
+}
+
+const (
+	defaultArgon2idTime    uint32 = 3
+	defaultArgon2idMemory  uint32 = 64 * 1024 // KiB
+	defaultArgon2idThreads uint8  = 4
+	defaultScryptLogN      uint8  = 15
+	defaultScryptR                = 8
+	defaultScryptP                = 1
+	defaultPasswordSaltLen        = 16
+	defaultPasswordKeyLen         = 32
+
+	// limits of parameters, avoid DoS by malicious or corrupted stored hash
+
+	maxArgon2idTime   uint32 = 64
+	maxArgon2idMemory uint32 = 4 * 1024 * 1024 // KiB, 4GiB
+	maxScryptLogN     uint8  = 22
+	maxPasswordKeyLen        = 1024
+)
+
+func checkArgon2idParams(time, memory uint32, threads uint8) error {
+	if time == 0 || threads == 0 {
+		return errors.Errorf("time and threads should be greater than 0")
+	}
+	if time > maxArgon2idTime {
+		return errors.Errorf("time should not be greater than %d", maxArgon2idTime)
+	}
+	if memory < 8*uint32(threads) || memory > maxArgon2idMemory {
+		return errors.Errorf("memory should in [8*threads, %d] KiB", maxArgon2idMemory)
+	}
+
+	return nil
+}
+
+func checkPasswordScryptParams(logN uint8, r, p int) error {
+	if logN == 0 || logN > maxScryptLogN {
+		return errors.Errorf("logN should in (0, %d]", maxScryptLogN)
+	}
+
+	return checkScryptParams(1<<logN, r, p)
+}
+
+type passwordHashOption struct {
+	algorithm PasswordHashAlgorithm
+
+	argon2idTime    uint32
+	argon2idMemory  uint32
+	argon2idThreads uint8
+
+	scryptLogN uint8
+	scryptR    int
+	scryptP    int
+
+	saltLen int
+	keyLen  int
+}
+
+func (o *passwordHashOption) fillDefault() *passwordHashOption {
+	o.algorithm = PasswordHashArgon2id
+	o.argon2idTime = defaultArgon2idTime
+	o.argon2idMemory = defaultArgon2idMemory
+	o.argon2idThreads = defaultArgon2idThreads
+	o.scryptLogN = defaultScryptLogN
+	o.scryptR = defaultScryptR
+	o.scryptP = defaultScryptP
+	o.saltLen = defaultPasswordSaltLen
+	o.keyLen = defaultPasswordKeyLen
+	return o
+}
+
+func (o *passwordHashOption) applyOpts(opts ...PasswordHashOption) (*passwordHashOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// PasswordHashOption policy of password hashing
+//
+// the same options should be passed to PasswordHashPHC and NeedsRehash.
+type PasswordHashOption func(*passwordHashOption) error
+
+// WithPasswordHashAlgorithm set algorithm, default is argon2id
+func WithPasswordHashAlgorithm(algorithm PasswordHashAlgorithm) PasswordHashOption {
+	return func(o *passwordHashOption) error {
+		switch algorithm {
+		case PasswordHashArgon2id, PasswordHashScrypt:
+		default:
+			return errors.Errorf("unsupported password hash algorithm %q", algorithm)
+		}
+
+		o.algorithm = algorithm
+		return nil
+	}
+}
+
+// WithPasswordHashArgon2id set parameters of argon2id
+//
+// default is time=3, memory=64MiB, threads=4
+//
+// # Args
+//   - time: number of passes over the memory
+//   - memory: size of memory in KiB
+//   - threads: degree of parallelism
+func WithPasswordHashArgon2id(time, memory uint32, threads uint8) PasswordHashOption {
+	return func(o *passwordHashOption) error {
+		if err := checkArgon2idParams(time, memory, threads); err != nil {
+			return err
+		}
+
+		o.argon2idTime = time
+		o.argon2idMemory = memory
+		o.argon2idThreads = threads
+		return nil
+	}
+}
+
+// WithPasswordHashScrypt set parameters of scrypt
+//
+// default is logN=15, r=8, p=1
+//
+// # Args
+//   - logN: log2 of CPU/memory cost N
+//   - r: block size
+//   - p: parallelization
+func WithPasswordHashScrypt(logN uint8, r, p int) PasswordHashOption {
+	return func(o *passwordHashOption) error {
+		if err := checkPasswordScryptParams(logN, r, p); err != nil {
+			return err
+		}
+
+		o.scryptLogN = logN
+		o.scryptR = r
+		o.scryptP = p
+		return nil
+	}
+}
+
+// WithPasswordHashSaltLen set length of random salt in bytes, default is 16
+func WithPasswordHashSaltLen(saltLen int) PasswordHashOption {
+	return func(o *passwordHashOption) error {
+		if saltLen < 8 {
+			return errors.Errorf("salt should be at least 8 bytes")
+		}
+
+		o.saltLen = saltLen
+		return nil
+	}
+}
+
+// WithPasswordHashKeyLen set length of derived key in bytes, default is 32
+func WithPasswordHashKeyLen(keyLen int) PasswordHashOption {
+	return func(o *passwordHashOption) error {
+		if keyLen < 16 || keyLen > maxPasswordKeyLen {
+			return errors.Errorf("key length should in [16, %d] bytes", maxPasswordKeyLen)
+		}
+
+		o.keyLen = keyLen
+		return nil
+	}
+}
+
+// phcPassword password hash in PHC string format
+//
+//   - argon2id: `$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>`
+//   - scrypt: `$scrypt$ln=15,r=8,p=1$<salt>$<hash>`
+//
+// salt and hash are encoded by standard base64 without padding.
+type phcPassword struct {
+	opt  passwordHashOption
+	salt []byte
+	hash []byte
+}
+
+var phcBase64 = base64.RawStdEncoding
+
+// String convert to PHC string
+func (p *phcPassword) String() string {
+	var params string
+	switch p.opt.algorithm {
+	case PasswordHashArgon2id:
+		params = fmt.Sprintf("v=%d$m=%d,t=%d,p=%d", argon2.Version,
+			p.opt.argon2idMemory, p.opt.argon2idTime, p.opt.argon2idThreads)
+	case PasswordHashScrypt:
+		params = fmt.Sprintf("ln=%d,r=%d,p=%d",
+			p.opt.scryptLogN, p.opt.scryptR, p.opt.scryptP)
+	}
+
+	return fmt.Sprintf("$%s$%s$%s$%s", p.opt.algorithm, params,
+		phcBase64.EncodeToString(p.salt), phcBase64.EncodeToString(p.hash))
+}
+
+// derive calculate hash of password by p's parameters and salt
+func (p *phcPassword) derive(password []byte) (hash []byte, err error) {
+	switch p.opt.algorithm {
+	case PasswordHashArgon2id:
+		return argon2.IDKey(password, p.salt,
+			p.opt.argon2idTime, p.opt.argon2idMemory, p.opt.argon2idThreads,
+			uint32(p.opt.keyLen)), nil
+	case PasswordHashScrypt:
+		hash, err = scrypt.Key(password, p.salt,
+			1<<p.opt.scryptLogN, p.opt.scryptR, p.opt.scryptP, p.opt.keyLen)
+		if err != nil {
+			return nil, errors.Wrap(err, "derive key by scrypt")
+		}
+
+		return hash, nil
+	default:
+		return nil, errors.Errorf("unsupported password hash algorithm %q", p.opt.algorithm)
+	}
+}
+
+// weakerThan check whether p's parameters are weaker than policy
+func (p *phcPassword) weakerThan(policy *passwordHashOption) bool {
+	if p.opt.algorithm != policy.algorithm ||
+		len(p.salt) < policy.saltLen ||
+		len(p.hash) < policy.keyLen {
+		return true
+	}
+
+	switch p.opt.algorithm {
+	case PasswordHashArgon2id:
+		return p.opt.argon2idTime < policy.argon2idTime ||
+			p.opt.argon2idMemory < policy.argon2idMemory ||
+			p.opt.argon2idThreads < policy.argon2idThreads
+	case PasswordHashScrypt:
+		return p.opt.scryptLogN < policy.scryptLogN ||
+			p.opt.scryptR < policy.scryptR ||
+			p.opt.scryptP < policy.scryptP
+	}
+
+	return true
+}
+
+func isPHCPassword(hashedPassword string) bool {
+	return strings.HasPrefix(hashedPassword, "$"+PasswordHashArgon2id.String()+"$") ||
+		strings.HasPrefix(hashedPassword, "$"+PasswordHashScrypt.String()+"$")
+}
+
+func parsePHCPassword(hashedPassword string) (p *phcPassword, err error) {
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) < 5 || parts[0] != "" {
+		return nil, errors.Errorf("invalid PHC string format")
+	}
+
+	p = new(phcPassword)
+	p.opt.algorithm = PasswordHashAlgorithm(parts[1])
+	switch p.opt.algorithm {
+	case PasswordHashArgon2id:
+		if len(parts) != 6 {
+			return nil, errors.Errorf("argon2id hash must contains 5 parts")
+		}
+		if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+			return nil, errors.Errorf("unsupported argon2 version %q", parts[2])
+		}
+
+		params, err := parsePHCParams(parts[3], "m", "t", "p")
+		if err != nil {
+			return nil, errors.Wrap(err, "parse argon2id params")
+		}
+		if params["p"] > 255 {
+			return nil, errors.Errorf("invalid argon2id params %q", parts[3])
+		}
+		if err = checkArgon2idParams(uint32(params["t"]),
+			uint32(params["m"]), uint8(params["p"])); err != nil {
+			return nil, errors.Wrapf(err, "invalid argon2id params %q", parts[3])
+		}
+
+		p.opt.argon2idMemory = uint32(params["m"])
+		p.opt.argon2idTime = uint32(params["t"])
+		p.opt.argon2idThreads = uint8(params["p"])
+		parts = parts[4:]
+	case PasswordHashScrypt:
+		if len(parts) != 5 {
+			return nil, errors.Errorf("scrypt hash must contains 4 parts")
+		}
+
+		params, err := parsePHCParams(parts[2], "ln", "r", "p")
+		if err != nil {
+			return nil, errors.Wrap(err, "parse scrypt params")
+		}
+		if params["ln"] > uint64(maxScryptLogN) {
+			return nil, errors.Errorf("invalid scrypt params %q", parts[2])
+		}
+		if err = checkPasswordScryptParams(uint8(params["ln"]),
+			int(params["r"]), int(params["p"])); err != nil {
+			return nil, errors.Wrapf(err, "invalid scrypt params %q", parts[2])
+		}
+
+		p.opt.scryptLogN = uint8(params["ln"])
+		p.opt.scryptR = int(params["r"])
+		p.opt.scryptP = int(params["p"])
+		parts = parts[3:]
+	default:
+		return nil, errors.Errorf("unsupported password hash algorithm %q", p.opt.algorithm)
+	}
+
+	if p.salt, err = phcBase64.DecodeString(parts[0]); err != nil {
+		return nil, errors.Wrap(err, "decode salt")
+	}
+	if p.hash, err = phcBase64.DecodeString(parts[1]); err != nil {
+		return nil, errors.Wrap(err, "decode hash")
+	}
+	if len(p.hash) == 0 || len(p.hash) > maxPasswordKeyLen {
+		return nil, errors.Errorf("invalid hash length %d", len(p.hash))
+	}
+
+	p.opt.saltLen = len(p.salt)
+	p.opt.keyLen = len(p.hash)
+	return p, nil
+}
+
+// parsePHCParams parse `k1=v1,k2=v2`, all keys are required
+func parsePHCParams(raw string, keys ...string) (map[string]uint64, error) {
+	params := make(map[string]uint64, len(keys))
+	for _, kv := range strings.Split(raw, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, errors.Errorf("invalid param %q", kv)
+		}
+
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse param %q", k)
+		}
+
+		params[k] = n
+	}
+
+	for _, k := range keys {
+		if _, ok := params[k]; !ok {
+			return nil, errors.Errorf("param %q is required", k)
+		}
+	}
+
+	return params, nil
+}
+
+// PasswordHashPHC generate password hash in PHC string format by argon2id or scrypt,
+// can verify by VerifyHashedPassword
+//
+// default algorithm is argon2id with time=3, memory=64MiB, threads=4.
+func PasswordHashPHC(password []byte, opts ...PasswordHashOption) (hashedPassword string, err error) {
+	if len(password) == 0 {
+		return "", errors.Errorf("password is empty")
+	}
+
+	opt, err := new(passwordHashOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return "", errors.Wrap(err, "apply options")
+	}
+
+	p := &phcPassword{opt: *opt}
+	if p.salt, err = Salt(opt.saltLen); err != nil {
+		return "", errors.Wrap(err, "generate salt")
+	}
+
+	if p.hash, err = p.derive(password); err != nil {
+		return "", errors.Wrap(err, "hashing password")
+	}
+
+	return p.String(), nil
+}
+
+func verifyPHCPassword(rawpassword []byte, hashedPassword string) error {
+	p, err := parsePHCPassword(hashedPassword)
+	if err != nil {
+		return errors.Wrap(err, "parse hashed password")
+	}
+
+	hash, err := p.derive(rawpassword)
+	if err != nil {
+		return errors.Wrap(err, "build hashed password by raw password")
+	}
+
+	if subtle.ConstantTimeCompare(hash, p.hash) != 1 {
+		return errors.Errorf("password not match")
+	}
+
+	return nil
+}
+
+// NeedsRehash check whether hashedPassword should be rehashed by PasswordHashPHC
+//
+// return true if hashedPassword is generated by other algorithm
+// (like PasswordHash or bcrypt), or its parameters are weaker than
+// the policy defined by opts. call it after VerifyHashedPassword succeed,
+// then rehash the raw password to upgrade the stored hash transparently.
+func NeedsRehash(hashedPassword string, opts ...PasswordHashOption) (bool, error) {
+	policy, err := new(passwordHashOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return false, errors.Wrap(err, "apply options")
+	}
+
+	if !isPHCPassword(hashedPassword) {
+		return true, nil
+	}
+
+	p, err := parsePHCPassword(hashedPassword)
+	if err != nil {
+		return false, errors.Wrap(err, "parse hashed password")
+	}
+
+	return p.weakerThan(policy), nil
+}
@@ -0,0 +1,129 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+func TestPasswordHashPHC(t *testing.T) {
+	t.Parallel()
+
+	password := []byte("32ifh23fu21f2h3")
+
+	t.Run("argon2id", func(t *testing.T) {
+		t.Parallel()
+
+		hashed, err := PasswordHashPHC(password)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(hashed, "$argon2id$v=19$m=65536,t=3,p=4$"), hashed)
+
+		require.NoError(t, VerifyHashedPassword(password, hashed))
+		require.ErrorContains(t, VerifyHashedPassword([]byte("32ifh23fu21f2h4"), hashed), "password not match")
+
+		needsRehash, err := NeedsRehash(hashed)
+		require.NoError(t, err)
+		require.False(t, needsRehash)
+	})
+
+	t.Run("scrypt", func(t *testing.T) {
+		t.Parallel()
+
+		hashed, err := PasswordHashPHC(password,
+			WithPasswordHashAlgorithm(PasswordHashScrypt),
+			WithPasswordHashScrypt(10, 8, 1),
+		)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(hashed, "$scrypt$ln=10,r=8,p=1$"), hashed)
+
+		require.NoError(t, VerifyHashedPassword(password, hashed))
+		require.ErrorContains(t, VerifyHashedPassword([]byte("32ifh23fu21f2h4"), hashed), "password not match")
+
+		// older than default scrypt policy
+		needsRehash, err := NeedsRehash(hashed, WithPasswordHashAlgorithm(PasswordHashScrypt))
+		require.NoError(t, err)
+		require.True(t, needsRehash)
+
+		// different algorithm with policy
+		needsRehash, err = NeedsRehash(hashed)
+		require.NoError(t, err)
+		require.True(t, needsRehash)
+	})
+
+	t.Run("known vector", func(t *testing.T) {
+		t.Parallel()
+
+		// test vector from golang.org/x/crypto/argon2
+		hashed := "$argon2id$v=19$m=4096,t=4,p=4$c29tZXNhbHQ$FF25czqfTuQ+3zPFCb6WuTTVBaTvszxa"
+		require.NoError(t, VerifyHashedPassword([]byte("password"), hashed))
+
+		needsRehash, err := NeedsRehash(hashed)
+		require.NoError(t, err)
+		require.True(t, needsRehash)
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		t.Parallel()
+
+		hashed, err := PasswordHash(password, gutils.HashTypeSha256)
+		require.NoError(t, err)
+		needsRehash, err := NeedsRehash(hashed)
+		require.NoError(t, err)
+		require.True(t, needsRehash)
+
+		bcryptHashed, err := bcrypt.GenerateFromPassword(password, bcrypt.MinCost)
+		require.NoError(t, err)
+		require.NoError(t, VerifyHashedPassword(password, string(bcryptHashed)))
+		require.Error(t, VerifyHashedPassword([]byte("32ifh23fu21f2h4"), string(bcryptHashed)))
+		needsRehash, err = NeedsRehash(string(bcryptHashed))
+		require.NoError(t, err)
+		require.True(t, needsRehash)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := PasswordHashPHC(nil)
+		require.ErrorContains(t, err, "password is empty")
+
+		_, err = PasswordHashPHC(password, WithPasswordHashAlgorithm("md5"))
+		require.ErrorContains(t, err, "unsupported password hash algorithm")
+
+		for _, hashed := range []string{
+			"$argon2id$v=18$m=65536,t=3,p=4$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+			"$argon2id$v=19$m=65536,t=0,p=4$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+			"$argon2id$v=19$m=65536,p=4$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+			"$argon2id$v=19$m=65536,t=3,p=4$c29tZXNhbHQ",
+			"$scrypt$ln=15,r=8,p=1$c29tZXNhbHQ$!!!",
+			// parameters exceed limits, should be rejected before hashing
+			"$argon2id$v=19$m=4294967295,t=3,p=4$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+			"$argon2id$v=19$m=65536,t=4294967295,p=4$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+			"$argon2id$v=19$m=65536,t=3,p=256$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+			"$scrypt$ln=63,r=8,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+			"$scrypt$ln=264,r=8,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+			"$scrypt$ln=15,r=4294967295,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+			"$scrypt$ln=15,r=8,p=4294967295$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+			"$scrypt$ln=15,r=8,p=0$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+		} {
+			_, err = NeedsRehash(hashed)
+			require.Error(t, err, hashed)
+			require.Error(t, VerifyHashedPassword(password, hashed), hashed)
+		}
+
+		for _, opt := range []PasswordHashOption{
+			WithPasswordHashArgon2id(3, maxArgon2idMemory+1, 4),
+			WithPasswordHashArgon2id(maxArgon2idTime+1, 65536, 4),
+			WithPasswordHashScrypt(maxScryptLogN+1, 8, 1),
+			WithPasswordHashScrypt(15, 8, maxScryptParallel+1),
+			WithPasswordHashScrypt(20, 64, 1),
+			WithPasswordHashKeyLen(maxPasswordKeyLen + 1),
+		} {
+			_, err = PasswordHashPHC(password, opt)
+			require.Error(t, err)
+		}
+	})
+}
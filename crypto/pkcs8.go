@@ -0,0 +1,548 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"hash"
+
+	"github.com/Laisky/errors/v2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+// Encrypted PKCS#8 private key by PBES2 (RFC 8018),
+// compatible with `openssl pkcs8 -topk8 -v2 aes-256-cbc`.
+
+const (
+	// pemTypeEncryptedPrikey pem block type of encrypted PKCS#8 private key
+	pemTypeEncryptedPrikey = "ENCRYPTED PRIVATE KEY"
+
+	defaultPKCS8PBKDF2Iterations = 600000
+	// defaultPKCS8ScryptLogN same as openssl, larger N exceeds its default memory limit
+	defaultPKCS8ScryptLogN uint8 = 14
+	defaultPKCS8SaltLen          = 16
+
+	// maxPKCS8PBKDF2Iterations avoid DoS by malicious private key
+	maxPKCS8PBKDF2Iterations = 10000000
+	// maxPKCS8ScryptMemory avoid DoS by malicious private key, 1GiB
+	maxPKCS8ScryptMemory = 1 << 30
+	// maxScryptParallel avoid DoS by malicious private key
+	maxScryptParallel = 16
+	// maxScryptCost max N*r*p, avoid DoS by malicious private key,
+	// CPU cost is about 4 times of the max memory
+	maxScryptCost = 1 << 25
+)
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidAES128GCM = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 6}
+	oidAES192GCM = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 26}
+	oidAES256GCM = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 46}
+)
+
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// scryptParams defined in RFC 7914
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// gcmParams defined in RFC 5084
+type gcmParams struct {
+	Nonce  []byte
+	ICVLen int `asn1:"default:12"`
+}
+
+// PKCS8KDF key derivation function to encrypt PKCS#8 private key
+type PKCS8KDF string
+
+const (
+	// PKCS8KDFPBKDF2 PBKDF2 with HMAC-SHA256
+	PKCS8KDFPBKDF2 PKCS8KDF = "pbkdf2"
+	// PKCS8KDFScrypt scrypt
+	PKCS8KDFScrypt PKCS8KDF = "scrypt"
+)
+
+// PKCS8Cipher cipher to encrypt PKCS#8 private key
+type PKCS8Cipher string
+
+const (
+	// PKCS8CipherAES256CBC AES-256-CBC, supported by most tools
+	PKCS8CipherAES256CBC PKCS8Cipher = "aes-256-cbc"
+	// PKCS8CipherAES256GCM AES-256-GCM, not supported by openssl
+	PKCS8CipherAES256GCM PKCS8Cipher = "aes-256-gcm"
+)
+
+type pkcs8EncryptOption struct {
+	kdf              PKCS8KDF
+	cipher           PKCS8Cipher
+	pbkdf2Iterations int
+	scryptLogN       uint8
+	scryptR          int
+	scryptP          int
+}
+
+func (o *pkcs8EncryptOption) fillDefault() *pkcs8EncryptOption {
+	o.kdf = PKCS8KDFPBKDF2
+	o.cipher = PKCS8CipherAES256CBC
+	o.pbkdf2Iterations = defaultPKCS8PBKDF2Iterations
+	o.scryptLogN = defaultPKCS8ScryptLogN
+	o.scryptR = defaultScryptR
+	o.scryptP = defaultScryptP
+	return o
+}
+
+func (o *pkcs8EncryptOption) applyOpts(opts ...PKCS8EncryptOption) (*pkcs8EncryptOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// PKCS8EncryptOption optional arguments for Prikey2EncryptedDer
+type PKCS8EncryptOption func(*pkcs8EncryptOption) error
+
+// WithPKCS8KDF set key derivation function, default is PBKDF2
+func WithPKCS8KDF(kdf PKCS8KDF) PKCS8EncryptOption {
+	return func(o *pkcs8EncryptOption) error {
+		switch kdf {
+		case PKCS8KDFPBKDF2, PKCS8KDFScrypt:
+		default:
+			return errors.Errorf("unsupported kdf %q", kdf)
+		}
+
+		o.kdf = kdf
+		return nil
+	}
+}
+
+// WithPKCS8Cipher set cipher, default is AES-256-CBC
+func WithPKCS8Cipher(c PKCS8Cipher) PKCS8EncryptOption {
+	return func(o *pkcs8EncryptOption) error {
+		switch c {
+		case PKCS8CipherAES256CBC, PKCS8CipherAES256GCM:
+		default:
+			return errors.Errorf("unsupported cipher %q", c)
+		}
+
+		o.cipher = c
+		return nil
+	}
+}
+
+// WithPKCS8PBKDF2Iterations set iterations of PBKDF2, default is 600000
+func WithPKCS8PBKDF2Iterations(iterations int) PKCS8EncryptOption {
+	return func(o *pkcs8EncryptOption) error {
+		if iterations < 1000 || iterations > maxPKCS8PBKDF2Iterations {
+			return errors.Errorf("iterations should in [1000, %d]", maxPKCS8PBKDF2Iterations)
+		}
+
+		o.pbkdf2Iterations = iterations
+		return nil
+	}
+}
+
+// WithPKCS8Scrypt set parameters of scrypt, default is logN=14, r=8, p=1
+func WithPKCS8Scrypt(logN uint8, r, p int) PKCS8EncryptOption {
+	return func(o *pkcs8EncryptOption) error {
+		if logN == 0 || logN >= 64 {
+			return errors.Errorf("logN should in (0, 64)")
+		}
+		if r <= 0 || p <= 0 {
+			return errors.Errorf("r and p should be greater than 0")
+		}
+		if err := checkScryptParams(1<<logN, r, p); err != nil {
+			return err
+		}
+
+		o.scryptLogN = logN
+		o.scryptR = r
+		o.scryptP = p
+		return nil
+	}
+}
+
+// checkScryptParams bound memory and CPU cost of scrypt
+func checkScryptParams(n, r, p int) error {
+	if n <= 0 || r <= 0 || n > maxPKCS8ScryptMemory/128/r {
+		return errors.Errorf("scrypt should not use more than %d bytes of memory",
+			maxPKCS8ScryptMemory)
+	}
+	if p <= 0 || p > maxScryptParallel {
+		return errors.Errorf("scrypt parallelization should in (0, %d]", maxScryptParallel)
+	}
+	if n > maxScryptCost/r/p {
+		return errors.Errorf("scrypt N*r*p should not greater than %d", maxScryptCost)
+	}
+
+	return nil
+}
+
+// Prikey2EncryptedDer marshal private key to PKCS#8 encrypted by password
+func Prikey2EncryptedDer(key crypto.PrivateKey, password string,
+	opts ...PKCS8EncryptOption) ([]byte, error) {
+	opt, err := new(pkcs8EncryptOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+	if password == "" {
+		return nil, errors.Errorf("password should not be empty")
+	}
+
+	prikeyDer, err := Prikey2Der(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	salt, err := gutils.SecRandomBytesWithLength(defaultPKCS8SaltLen)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate salt")
+	}
+
+	var (
+		encKey    []byte
+		kdfParams pkix.AlgorithmIdentifier
+	)
+	switch opt.kdf {
+	case PKCS8KDFScrypt:
+		n := 1 << opt.scryptLogN
+		if encKey, err = scrypt.Key([]byte(password), salt,
+			n, opt.scryptR, opt.scryptP, 32); err != nil {
+			return nil, errors.Wrap(err, "derive key by scrypt")
+		}
+
+		kdfParams.Algorithm = oidScrypt
+		kdfParams.Parameters, err = marshalASN1RawValue(scryptParams{
+			Salt:                     salt,
+			CostParameter:            n,
+			BlockSize:                opt.scryptR,
+			ParallelizationParameter: opt.scryptP,
+		})
+	default:
+		encKey = pbkdf2.Key([]byte(password), salt, opt.pbkdf2Iterations, 32, sha256.New)
+		kdfParams.Algorithm = oidPBKDF2
+		kdfParams.Parameters, err = marshalASN1RawValue(pbkdf2Params{
+			Salt:           salt,
+			IterationCount: opt.pbkdf2Iterations,
+			PRF: pkix.AlgorithmIdentifier{
+				Algorithm:  oidHMACWithSHA256,
+				Parameters: asn1.NullRawValue,
+			},
+		})
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal kdf parameters")
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "new aes cipher")
+	}
+
+	var (
+		encrypted    []byte
+		cipherParams pkix.AlgorithmIdentifier
+	)
+	switch opt.cipher {
+	case PKCS8CipherAES256GCM:
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Wrap(err, "new gcm")
+		}
+
+		nonce, err := gutils.SecRandomBytesWithLength(aead.NonceSize())
+		if err != nil {
+			return nil, errors.Wrap(err, "generate nonce")
+		}
+
+		encrypted = aead.Seal(nil, nonce, prikeyDer, nil)
+		cipherParams.Algorithm = oidAES256GCM
+		cipherParams.Parameters, err = marshalASN1RawValue(gcmParams{
+			Nonce:  nonce,
+			ICVLen: aead.Overhead(),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal gcm parameters")
+		}
+	default:
+		iv, err := gutils.SecRandomBytesWithLength(aes.BlockSize)
+		if err != nil {
+			return nil, errors.Wrap(err, "generate iv")
+		}
+
+		encrypted = pkcs7Pad(prikeyDer, aes.BlockSize)
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+		cipherParams.Algorithm = oidAES256CBC
+		if cipherParams.Parameters, err = marshalASN1RawValue(iv); err != nil {
+			return nil, errors.Wrap(err, "marshal iv")
+		}
+	}
+
+	algParams, err := marshalASN1RawValue(pbes2Params{
+		KeyDerivationFunc: kdfParams,
+		EncryptionScheme:  cipherParams,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal pbes2 parameters")
+	}
+
+	der, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		EncryptionAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBES2,
+			Parameters: algParams,
+		},
+		EncryptedData: encrypted,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal encrypted private key")
+	}
+
+	return der, nil
+}
+
+// Prikey2EncryptedPem marshal private key to PKCS#8 pem encrypted by password,
+// tailing with line break
+func Prikey2EncryptedPem(key crypto.PrivateKey, password string,
+	opts ...PKCS8EncryptOption) ([]byte, error) {
+	der, err := Prikey2EncryptedDer(key, password, opts...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypeEncryptedPrikey, Bytes: der}), nil
+}
+
+// EncryptedDer2Prikey parse private key from PKCS#8 encrypted by PBES2
+//
+// support PBKDF2(HMAC-SHA1/SHA2) or scrypt, with AES-CBC or AES-GCM.
+func EncryptedDer2Prikey(encryptedDer []byte, password string) (crypto.PrivateKey, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(encryptedDer, &info); err != nil {
+		return nil, errors.Wrap(err, "unmarshal encrypted private key")
+	} else if len(rest) != 0 {
+		return nil, errors.Errorf("trailing data after encrypted private key")
+	}
+
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.Errorf("unsupported encryption algorithm %s, only support PBES2",
+			info.EncryptionAlgorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.Wrap(err, "unmarshal pbes2 parameters")
+	}
+
+	keyLen, err := pkcs8CipherKeyLen(params.EncryptionScheme.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	encKey, err := pkcs8DeriveKey(params.KeyDerivationFunc, []byte(password), keyLen)
+	if err != nil {
+		return nil, errors.Wrap(err, "derive key")
+	}
+
+	prikeyDer, err := pkcs8Decrypt(params.EncryptionScheme, encKey, info.EncryptedData)
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypt private key, maybe wrong password")
+	}
+
+	return Der2Prikey(prikeyDer)
+}
+
+func pkcs8CipherKeyLen(alg asn1.ObjectIdentifier) (int, error) {
+	switch {
+	case alg.Equal(oidAES128CBC), alg.Equal(oidAES128GCM):
+		return 16, nil
+	case alg.Equal(oidAES192CBC), alg.Equal(oidAES192GCM):
+		return 24, nil
+	case alg.Equal(oidAES256CBC), alg.Equal(oidAES256GCM):
+		return 32, nil
+	default:
+		return 0, errors.Errorf("unsupported cipher %s", alg)
+	}
+}
+
+func pkcs8DeriveKey(kdf pkix.AlgorithmIdentifier, password []byte, keyLen int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var params pbkdf2Params
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.Wrap(err, "unmarshal pbkdf2 parameters")
+		}
+		if params.IterationCount <= 0 || params.IterationCount > maxPKCS8PBKDF2Iterations {
+			return nil, errors.Errorf("invalid pbkdf2 iterations %d", params.IterationCount)
+		}
+		if params.KeyLength != 0 && params.KeyLength != keyLen {
+			return nil, errors.Errorf("pbkdf2 key length %d mismatch cipher", params.KeyLength)
+		}
+
+		var prf func() hash.Hash
+		switch alg := params.PRF.Algorithm; {
+		case len(alg) == 0, alg.Equal(oidHMACWithSHA1):
+			prf = sha1.New
+		case alg.Equal(oidHMACWithSHA224):
+			prf = sha256.New224
+		case alg.Equal(oidHMACWithSHA256):
+			prf = sha256.New
+		case alg.Equal(oidHMACWithSHA384):
+			prf = sha512.New384
+		case alg.Equal(oidHMACWithSHA512):
+			prf = sha512.New
+		default:
+			return nil, errors.Errorf("unsupported pbkdf2 prf %s", alg)
+		}
+
+		return pbkdf2.Key(password, params.Salt, params.IterationCount, keyLen, prf), nil
+	case kdf.Algorithm.Equal(oidScrypt):
+		var params scryptParams
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.Wrap(err, "unmarshal scrypt parameters")
+		}
+		if err := checkScryptParams(params.CostParameter,
+			params.BlockSize, params.ParallelizationParameter); err != nil {
+			return nil, err
+		}
+		if params.KeyLength != 0 && params.KeyLength != keyLen {
+			return nil, errors.Errorf("scrypt key length %d mismatch cipher", params.KeyLength)
+		}
+
+		key, err := scrypt.Key(password, params.Salt,
+			params.CostParameter, params.BlockSize, params.ParallelizationParameter, keyLen)
+		if err != nil {
+			return nil, errors.Wrap(err, "derive key by scrypt")
+		}
+
+		return key, nil
+	default:
+		return nil, errors.Errorf("unsupported kdf %s", kdf.Algorithm)
+	}
+}
+
+func pkcs8Decrypt(scheme pkix.AlgorithmIdentifier, key, encrypted []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "new aes cipher")
+	}
+
+	switch alg := scheme.Algorithm; {
+	case alg.Equal(oidAES128GCM), alg.Equal(oidAES192GCM), alg.Equal(oidAES256GCM):
+		var params gcmParams
+		if _, err := asn1.Unmarshal(scheme.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.Wrap(err, "unmarshal gcm parameters")
+		}
+		if len(params.Nonce) == 0 {
+			return nil, errors.Errorf("gcm nonce should not be empty")
+		}
+		if params.ICVLen < 12 || params.ICVLen > 16 {
+			return nil, errors.Errorf("invalid gcm icv length %d", params.ICVLen)
+		}
+
+		var aead cipher.AEAD
+		if len(params.Nonce) == 12 {
+			aead, err = cipher.NewGCMWithTagSize(block, params.ICVLen)
+		} else if params.ICVLen == 16 {
+			aead, err = cipher.NewGCMWithNonceSize(block, len(params.Nonce))
+		} else {
+			return nil, errors.Errorf("unsupported gcm nonce size %d with icv length %d",
+				len(params.Nonce), params.ICVLen)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "new gcm")
+		}
+
+		return aead.Open(nil, params.Nonce, encrypted, nil)
+	default:
+		var iv []byte
+		if _, err := asn1.Unmarshal(scheme.Parameters.FullBytes, &iv); err != nil {
+			return nil, errors.Wrap(err, "unmarshal iv")
+		}
+		if len(iv) != aes.BlockSize {
+			return nil, errors.Errorf("iv should be %d bytes", aes.BlockSize)
+		}
+		if len(encrypted) == 0 || len(encrypted)%aes.BlockSize != 0 {
+			return nil, errors.Errorf("encrypted data is not a multiple of block size")
+		}
+
+		decrypted := make([]byte, len(encrypted))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, encrypted)
+		return pkcs7Unpad(decrypted, aes.BlockSize)
+	}
+}
+
+func marshalASN1RawValue(val any) (asn1.RawValue, error) {
+	der, err := asn1.Marshal(val)
+	if err != nil {
+		return asn1.RawValue{}, errors.WithStack(err)
+	}
+
+	return asn1.RawValue{FullBytes: der}, nil
+}
+
+func pkcs7Pad(data []byte, blockSize int) []byte {
+	padLen := blockSize - len(data)%blockSize
+	return append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+}
+
+func pkcs7Unpad(data []byte, blockSize int) ([]byte, error) {
+	if len(data) == 0 || len(data)%blockSize != 0 {
+		return nil, errors.Errorf("invalid padded data length")
+	}
+
+	padLen := int(data[len(data)-1])
+	if padLen == 0 || padLen > blockSize {
+		return nil, errors.Errorf("invalid padding")
+	}
+	for _, b := range data[len(data)-padLen:] {
+		if int(b) != padLen {
+			return nil, errors.Errorf("invalid padding")
+		}
+	}
+
+	return data[:len(data)-padLen], nil
+}
@@ -0,0 +1,574 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// SM2 public key cryptographic algorithm defined in GB/T 32918-2016
+//
+// pure go implementation, no need for tongsuo.
+//
+// the point and scalar arithmetic involving private key or nonce
+// is constant-time, see sm2ec.go.
+
+var (
+	// OidSM2 oid of sm2 curve
+	OidSM2 = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301}
+	// oidECPublicKey oid of id-ecPublicKey
+	oidECPublicKey = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+
+	// SM2DefaultUID default user id used to calculate ZA
+	SM2DefaultUID = []byte("1234567812345678")
+
+	sm2InitOnce sync.Once
+	sm2Params   *elliptic.CurveParams
+)
+
+// SM2P256 return sm2 curve
+//
+// a = p - 3, so it can be described by elliptic.CurveParams.
+// the returned curve is the variable-time generic implementation,
+// do not use it with secret scalars.
+func SM2P256() elliptic.Curve {
+	sm2InitOnce.Do(func() {
+		sm2Params = &elliptic.CurveParams{Name: "SM2-P-256", BitSize: 256}
+		sm2Params.P, _ = new(big.Int).SetString("FFFFFFFEFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF00000000FFFFFFFFFFFFFFFF", 16)
+		sm2Params.N, _ = new(big.Int).SetString("FFFFFFFEFFFFFFFFFFFFFFFFFFFFFFFF7203DF6B21C6052B53BBF40939D54123", 16)
+		sm2Params.B, _ = new(big.Int).SetString("28E9FA9E9D9F5E344D5A9E4BCF6509A7F39789F515AB8F92DDBCBD414D940E93", 16)
+		sm2Params.Gx, _ = new(big.Int).SetString("32C4AE2C1F1981195F9904466A39C9948FE30BBFF2660BE1715A4589334C74C7", 16)
+		sm2Params.Gy, _ = new(big.Int).SetString("BC3736A2F4F6779C59BDCEE36B692153D0A9877CC62A474002DF32E52139F0A0", 16)
+	})
+
+	return sm2Params
+}
+
+// SM2PublicKey sm2 public key
+type SM2PublicKey struct {
+	X, Y *big.Int
+}
+
+// SM2PrivateKey sm2 private key
+type SM2PrivateKey struct {
+	SM2PublicKey
+	D *big.Int
+}
+
+// Public return public key
+func (k *SM2PrivateKey) Public() *SM2PublicKey {
+	return &k.SM2PublicKey
+}
+
+// Equal compare two public keys
+func (k *SM2PublicKey) Equal(x *SM2PublicKey) bool {
+	return x != nil && k.X.Cmp(x.X) == 0 && k.Y.Cmp(x.Y) == 0
+}
+
+// NewSM2Prikey generate new sm2 private key
+func NewSM2Prikey() (*SM2PrivateKey, error) {
+	curve := SM2P256()
+	// d in [1, n-2]
+	max := new(big.Int).Sub(curve.Params().N, big.NewInt(2))
+	d, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate random d")
+	}
+	d.Add(d, big.NewInt(1))
+
+	return newSM2PrikeyByD(d)
+}
+
+func newSM2PrikeyByD(d *big.Int) (*SM2PrivateKey, error) {
+	curve := SM2P256()
+	if d.Sign() <= 0 || d.Cmp(new(big.Int).Sub(curve.Params().N, big.NewInt(1))) >= 0 {
+		return nil, errors.Errorf("invalid sm2 private key")
+	}
+
+	prikey := &SM2PrivateKey{D: d}
+	prikey.X, prikey.Y = sm2ScalarBaseMult(d.FillBytes(make([]byte, 32)))
+	return prikey, nil
+}
+
+// sm2ZA calculate ZA = SM3(ENTL || ID || a || b || xG || yG || xA || yA)
+func sm2ZA(pubkey *SM2PublicKey, uid []byte) ([]byte, error) {
+	if len(uid) >= 8192 {
+		return nil, errors.Errorf("uid too long")
+	}
+
+	params := SM2P256().Params()
+	a := new(big.Int).Sub(params.P, big.NewInt(3))
+
+	h := NewSM3()
+	var entl [2]byte
+	binary.BigEndian.PutUint16(entl[:], uint16(len(uid)*8))
+	h.Write(entl[:])
+	h.Write(uid)
+	for _, v := range []*big.Int{a, params.B, params.Gx, params.Gy, pubkey.X, pubkey.Y} {
+		h.Write(v.FillBytes(make([]byte, 32)))
+	}
+
+	return h.Sum(nil), nil
+}
+
+// sm2Digest calculate e = SM3(ZA || M)
+func sm2Digest(pubkey *SM2PublicKey, uid []byte, content io.Reader) (*big.Int, error) {
+	za, err := sm2ZA(pubkey, uid)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	h := NewSM3()
+	h.Write(za)
+	if _, err = io.Copy(h, content); err != nil {
+		return nil, errors.Wrap(err, "read content")
+	}
+
+	return new(big.Int).SetBytes(h.Sum(nil)), nil
+}
+
+type sm2Signature struct {
+	R, S *big.Int
+}
+
+// SignBySM2SM3 sign content by sm2 with sm3 and default uid
+//
+// signature is ASN.1 DER encoded `SEQUENCE { r INTEGER, s INTEGER }`,
+// same as `tongsuo dgst -sm3 -sign`.
+func SignBySM2SM3(prikey *SM2PrivateKey, content []byte) (signature []byte, err error) {
+	return SignReaderBySM2SM3(prikey, bytes.NewReader(content), SM2DefaultUID)
+}
+
+// SignReaderBySM2SM3 sign content by sm2 with sm3 and specific uid
+func SignReaderBySM2SM3(prikey *SM2PrivateKey, content io.Reader, uid []byte) (signature []byte, err error) {
+	e, err := sm2Digest(&prikey.SM2PublicKey, uid, content)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	n := SM2P256().Params().N
+	for {
+		k, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return nil, errors.Wrap(err, "generate random k")
+		}
+
+		r, s, ok := sm2SignWithK(prikey.D, e, k)
+		if !ok {
+			continue
+		}
+
+		return asn1.Marshal(sm2Signature{R: r, S: s})
+	}
+}
+
+// sm2SignWithK calculate signature by random k,
+// return false if k should be regenerated.
+func sm2SignWithK(d, e, k *big.Int) (r, s *big.Int, ok bool) {
+	if k.Sign() == 0 {
+		return nil, nil, false
+	}
+
+	n := SM2P256().Params().N
+	kBytes := k.FillBytes(make([]byte, 32))
+	x1, _ := sm2ScalarBaseMult(kBytes)
+	r = new(big.Int).Add(e, x1)
+	r.Mod(r, n)
+	if r.Sign() == 0 || new(big.Int).Add(r, k).Cmp(n) == 0 {
+		return nil, nil, false
+	}
+
+	// s = (1+d)^-1 * (k - r*d) mod n
+	s = new(big.Int).SetBytes(sm2SignScalar(
+		d.FillBytes(make([]byte, 32)), kBytes, r.FillBytes(make([]byte, 32))))
+	if s.Sign() == 0 {
+		return nil, nil, false
+	}
+
+	return r, s, true
+}
+
+// VerifyBySM2SM3 verify signature generated by SignBySM2SM3
+func VerifyBySM2SM3(pubkey *SM2PublicKey, content, signature []byte) error {
+	return VerifyReaderBySM2SM3(pubkey, bytes.NewReader(content), signature, SM2DefaultUID)
+}
+
+// VerifyReaderBySM2SM3 verify signature generated by SignReaderBySM2SM3
+func VerifyReaderBySM2SM3(pubkey *SM2PublicKey, content io.Reader, signature, uid []byte) error {
+	sig := new(sm2Signature)
+	if rest, err := asn1.Unmarshal(signature, sig); err != nil {
+		return errors.Wrap(err, "parse signature")
+	} else if len(rest) != 0 {
+		return errors.Errorf("trailing data after signature")
+	}
+
+	curve := SM2P256()
+	if !curve.IsOnCurve(pubkey.X, pubkey.Y) {
+		return errors.Errorf("invalid sm2 public key")
+	}
+
+	n := curve.Params().N
+	one := big.NewInt(1)
+	if sig.R.Cmp(one) < 0 || sig.R.Cmp(n) >= 0 ||
+		sig.S.Cmp(one) < 0 || sig.S.Cmp(n) >= 0 {
+		return errors.Errorf("invalid signature")
+	}
+
+	e, err := sm2Digest(pubkey, uid, content)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	t := new(big.Int).Add(sig.R, sig.S)
+	t.Mod(t, n)
+	if t.Sign() == 0 {
+		return errors.Errorf("invalid signature")
+	}
+
+	// (x, y) = s*G + t*P
+	ec := sm2ConstantTimeCurve()
+	var p1, p2 sm2Point
+	ec.scalarMult(&p1, &ec.g, sig.S.FillBytes(make([]byte, 32)))
+	p2 = ec.pointFromAffine(pubkey.X, pubkey.Y)
+	ec.scalarMult(&p2, &p2, t.FillBytes(make([]byte, 32)))
+	ec.add(&p1, &p1, &p2)
+	x, _ := ec.affine(&p1)
+
+	x.Add(x, e)
+	x.Mod(x, n)
+	if x.Cmp(sig.R) != 0 {
+		return errors.Errorf("signature not match")
+	}
+
+	return nil
+}
+
+// sm2KDF key derivation function defined in GB/T 32918.4
+func sm2KDF(z []byte, length int) []byte {
+	out := make([]byte, 0, length+SM3Size)
+	var ct [4]byte
+	for i := uint32(1); len(out) < length; i++ {
+		binary.BigEndian.PutUint32(ct[:], i)
+		h := NewSM3()
+		h.Write(z)
+		h.Write(ct[:])
+		out = h.Sum(out)
+	}
+
+	return out[:length]
+}
+
+type sm2Cipher struct {
+	X, Y       *big.Int
+	Hash       []byte
+	Ciphertext []byte
+}
+
+// EncryptBySM2 encrypt by sm2 public key
+//
+// ciphertext is ASN.1 DER encoded `SEQUENCE { x INTEGER, y INTEGER, hash OCTET STRING, ciphertext OCTET STRING }`,
+// same as `tongsuo pkeyutl -encrypt`.
+func EncryptBySM2(pubkey *SM2PublicKey, plaintext []byte) (ciphertext []byte, err error) {
+	if len(plaintext) == 0 {
+		return nil, errors.Errorf("plaintext is empty")
+	}
+
+	curve := SM2P256()
+	if !curve.IsOnCurve(pubkey.X, pubkey.Y) {
+		return nil, errors.Errorf("invalid sm2 public key")
+	}
+
+	for {
+		k, err := rand.Int(rand.Reader, curve.Params().N)
+		if err != nil {
+			return nil, errors.Wrap(err, "generate random k")
+		}
+
+		c, ok := sm2EncryptWithK(pubkey, plaintext, k)
+		if !ok {
+			continue
+		}
+
+		return asn1.Marshal(*c)
+	}
+}
+
+// sm2EncryptWithK encrypt plaintext by random k,
+// return false if k should be regenerated.
+func sm2EncryptWithK(pubkey *SM2PublicKey, plaintext []byte, k *big.Int) (c *sm2Cipher, ok bool) {
+	if k.Sign() == 0 {
+		return nil, false
+	}
+
+	kBytes := k.FillBytes(make([]byte, 32))
+	x1, y1 := sm2ScalarBaseMult(kBytes)
+	x2, y2 := sm2ScalarMult(pubkey.X, pubkey.Y, kBytes)
+	x2Bytes := x2.FillBytes(make([]byte, 32))
+	y2Bytes := y2.FillBytes(make([]byte, 32))
+
+	t := sm2KDF(append(append([]byte{}, x2Bytes...), y2Bytes...), len(plaintext))
+	if subtle.ConstantTimeCompare(t, make([]byte, len(t))) == 1 {
+		return nil, false
+	}
+
+	c2 := make([]byte, len(plaintext))
+	subtle.XORBytes(c2, plaintext, t)
+
+	h := NewSM3()
+	h.Write(x2Bytes)
+	h.Write(plaintext)
+	h.Write(y2Bytes)
+
+	return &sm2Cipher{X: x1, Y: y1, Hash: h.Sum(nil), Ciphertext: c2}, true
+}
+
+// DecryptBySM2 decrypt by sm2 private key, ciphertext should be generated by EncryptBySM2
+func DecryptBySM2(prikey *SM2PrivateKey, ciphertext []byte) (plaintext []byte, err error) {
+	c := new(sm2Cipher)
+	if rest, err := asn1.Unmarshal(ciphertext, c); err != nil {
+		return nil, errors.Wrap(err, "parse ciphertext")
+	} else if len(rest) != 0 {
+		return nil, errors.Errorf("trailing data after ciphertext")
+	}
+
+	if !SM2P256().IsOnCurve(c.X, c.Y) {
+		return nil, errors.Errorf("invalid ciphertext")
+	}
+
+	x2, y2 := sm2ScalarMult(c.X, c.Y, prikey.D.FillBytes(make([]byte, 32)))
+	x2Bytes := x2.FillBytes(make([]byte, 32))
+	y2Bytes := y2.FillBytes(make([]byte, 32))
+
+	t := sm2KDF(append(append([]byte{}, x2Bytes...), y2Bytes...), len(c.Ciphertext))
+	plaintext = make([]byte, len(c.Ciphertext))
+	subtle.XORBytes(plaintext, c.Ciphertext, t)
+
+	h := NewSM3()
+	h.Write(x2Bytes)
+	h.Write(plaintext)
+	h.Write(y2Bytes)
+	if subtle.ConstantTimeCompare(h.Sum(nil), c.Hash) != 1 {
+		return nil, errors.Errorf("decrypt failed, hash not match")
+	}
+
+	return plaintext, nil
+}
+
+// SM2Prikey2Pem marshal sm2 private key to PKCS#8 PEM
+func SM2Prikey2Pem(prikey *SM2PrivateKey) ([]byte, error) {
+	der, err := SM2Prikey2Der(prikey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return PrikeyDer2Pem(der), nil
+}
+
+// SM2Prikey2Der marshal sm2 private key to PKCS#8 DER
+func SM2Prikey2Der(prikey *SM2PrivateKey) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Int64(0)
+		addSM2AlgorithmIdentifier(b)
+		b.AddASN1(cbasn1.OCTET_STRING, func(b *cryptobyte.Builder) {
+			b.AddBytes(sm2SEC1Der(prikey, false))
+		})
+	})
+
+	return b.Bytes()
+}
+
+// sm2SEC1Der marshal sm2 private key to SEC1 ECPrivateKey
+func sm2SEC1Der(prikey *SM2PrivateKey, withParams bool) []byte {
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Int64(1)
+		b.AddASN1OctetString(prikey.D.FillBytes(make([]byte, 32)))
+		if withParams {
+			b.AddASN1(cbasn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+				b.AddASN1ObjectIdentifier(OidSM2)
+			})
+		}
+		b.AddASN1(cbasn1.Tag(1).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+			b.AddASN1BitString(sm2PointBytes(&prikey.SM2PublicKey))
+		})
+	})
+
+	return b.BytesOrPanic()
+}
+
+// SM2Pubkey2Pem marshal sm2 public key to PKIX PEM
+func SM2Pubkey2Pem(pubkey *SM2PublicKey) ([]byte, error) {
+	der, err := SM2Pubkey2Der(pubkey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return PubkeyDer2Pem(der), nil
+}
+
+// SM2Pubkey2Der marshal sm2 public key to PKIX DER
+func SM2Pubkey2Der(pubkey *SM2PublicKey) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		addSM2AlgorithmIdentifier(b)
+		b.AddASN1BitString(sm2PointBytes(pubkey))
+	})
+
+	return b.Bytes()
+}
+
+func addSM2AlgorithmIdentifier(b *cryptobyte.Builder) {
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1ObjectIdentifier(oidECPublicKey)
+		b.AddASN1ObjectIdentifier(OidSM2)
+	})
+}
+
+func sm2PointBytes(pubkey *SM2PublicKey) []byte {
+	out := make([]byte, 65)
+	out[0] = 4
+	pubkey.X.FillBytes(out[1:33])
+	pubkey.Y.FillBytes(out[33:])
+	return out
+}
+
+// Pem2SM2Prikey parse sm2 private key from PEM
+//
+// support both PKCS#8 `PRIVATE KEY` and SEC1 `EC PRIVATE KEY`,
+// other blocks like `EC PARAMETERS` will be ignored.
+func Pem2SM2Prikey(prikeyPem []byte) (*SM2PrivateKey, error) {
+	for {
+		var block *pem.Block
+		block, prikeyPem = pem.Decode(prikeyPem)
+		if block == nil {
+			return nil, errors.Errorf("sm2 private key not found in pem")
+		}
+
+		switch block.Type {
+		case "PRIVATE KEY":
+			return Der2SM2Prikey(block.Bytes)
+		case "EC PRIVATE KEY":
+			return parseSM2SEC1Der(block.Bytes)
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, errors.Errorf("encrypted private key is not supported")
+		}
+	}
+}
+
+// Der2SM2Prikey parse sm2 private key from PKCS#8 DER
+func Der2SM2Prikey(prikeyDer []byte) (*SM2PrivateKey, error) {
+	var (
+		version    int64
+		algOid     asn1.ObjectIdentifier
+		curveOid   asn1.ObjectIdentifier
+		sec1Der    []byte
+		input      = cryptobyte.String(prikeyDer)
+		seq, algID cryptobyte.String
+	)
+	if !input.ReadASN1(&seq, cbasn1.SEQUENCE) ||
+		!seq.ReadASN1Integer(&version) ||
+		!seq.ReadASN1(&algID, cbasn1.SEQUENCE) ||
+		!algID.ReadASN1ObjectIdentifier(&algOid) ||
+		!algID.ReadASN1ObjectIdentifier(&curveOid) ||
+		!seq.ReadASN1Bytes(&sec1Der, cbasn1.OCTET_STRING) {
+		return nil, errors.Errorf("invalid pkcs8 private key")
+	}
+
+	if !algOid.Equal(oidECPublicKey) || !curveOid.Equal(OidSM2) {
+		return nil, errors.Errorf("not sm2 private key")
+	}
+
+	return parseSM2SEC1Der(sec1Der)
+}
+
+func parseSM2SEC1Der(der []byte) (*SM2PrivateKey, error) {
+	var (
+		version int64
+		d       []byte
+		params  cryptobyte.String
+		hasTag  bool
+		input   = cryptobyte.String(der)
+		seq     cryptobyte.String
+	)
+	if !input.ReadASN1(&seq, cbasn1.SEQUENCE) ||
+		!seq.ReadASN1Integer(&version) ||
+		!seq.ReadASN1Bytes(&d, cbasn1.OCTET_STRING) ||
+		!seq.ReadOptionalASN1(&params, &hasTag, cbasn1.Tag(0).Constructed().ContextSpecific()) {
+		return nil, errors.Errorf("invalid ec private key")
+	}
+
+	if version != 1 {
+		return nil, errors.Errorf("unknown ec private key version %d", version)
+	}
+
+	if hasTag {
+		var curveOid asn1.ObjectIdentifier
+		if !params.ReadASN1ObjectIdentifier(&curveOid) || !curveOid.Equal(OidSM2) {
+			return nil, errors.Errorf("not sm2 private key")
+		}
+	}
+
+	return newSM2PrikeyByD(new(big.Int).SetBytes(d))
+}
+
+// Pem2SM2Pubkey parse sm2 public key from PKIX PEM
+func Pem2SM2Pubkey(pubkeyPem []byte) (*SM2PublicKey, error) {
+	for {
+		var block *pem.Block
+		block, pubkeyPem = pem.Decode(pubkeyPem)
+		if block == nil {
+			return nil, errors.Errorf("sm2 public key not found in pem")
+		}
+
+		if block.Type == "PUBLIC KEY" {
+			return Der2SM2Pubkey(block.Bytes)
+		}
+	}
+}
+
+// Der2SM2Pubkey parse sm2 public key from PKIX DER
+func Der2SM2Pubkey(pubkeyDer []byte) (*SM2PublicKey, error) {
+	var (
+		algOid, curveOid asn1.ObjectIdentifier
+		point            asn1.BitString
+		input            = cryptobyte.String(pubkeyDer)
+		seq, algID       cryptobyte.String
+	)
+	if !input.ReadASN1(&seq, cbasn1.SEQUENCE) ||
+		!seq.ReadASN1(&algID, cbasn1.SEQUENCE) ||
+		!algID.ReadASN1ObjectIdentifier(&algOid) ||
+		!algID.ReadASN1ObjectIdentifier(&curveOid) ||
+		!seq.ReadASN1BitString(&point) {
+		return nil, errors.Errorf("invalid pkix public key")
+	}
+
+	if !algOid.Equal(oidECPublicKey) || !curveOid.Equal(OidSM2) {
+		return nil, errors.Errorf("not sm2 public key")
+	}
+
+	if len(point.Bytes) != 65 || point.Bytes[0] != 4 {
+		return nil, errors.Errorf("only support uncompressed sm2 public key")
+	}
+
+	pubkey := &SM2PublicKey{
+		X: new(big.Int).SetBytes(point.Bytes[1:33]),
+		Y: new(big.Int).SetBytes(point.Bytes[33:]),
+	}
+	if !SM2P256().IsOnCurve(pubkey.X, pubkey.Y) {
+		return nil, errors.Errorf("invalid sm2 public key")
+	}
+
+	return pubkey, nil
+}
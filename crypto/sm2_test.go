@@ -0,0 +1,254 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSM2P256(t *testing.T) {
+	t.Parallel()
+
+	params := SM2P256().Params()
+	require.True(t, SM2P256().IsOnCurve(params.Gx, params.Gy))
+}
+
+func TestSM2ConstantTimeCurve(t *testing.T) {
+	t.Parallel()
+
+	curve := SM2P256()
+	params := curve.Params()
+	nMinus1 := new(big.Int).Sub(params.N, big.NewInt(1))
+	scalars := []*big.Int{
+		big.NewInt(0), big.NewInt(1), big.NewInt(2), big.NewInt(15), big.NewInt(16),
+		nMinus1, params.N, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1)),
+	}
+	for i := 0; i < 20; i++ {
+		k, err := rand.Int(rand.Reader, params.N)
+		require.NoError(t, err)
+		scalars = append(scalars, k)
+	}
+
+	px, py := curve.ScalarBaseMult([]byte{0x12, 0x34})
+	for _, k := range scalars {
+		kBytes := k.FillBytes(make([]byte, 32))
+
+		wantX, wantY := curve.ScalarBaseMult(kBytes)
+		gotX, gotY := sm2ScalarBaseMult(kBytes)
+		require.Zero(t, wantX.Cmp(gotX), k.String())
+		require.Zero(t, wantY.Cmp(gotY), k.String())
+
+		wantX, wantY = curve.ScalarMult(px, py, kBytes)
+		gotX, gotY = sm2ScalarMult(px, py, kBytes)
+		require.Zero(t, wantX.Cmp(gotX), k.String())
+		require.Zero(t, wantY.Cmp(gotY), k.String())
+	}
+
+	t.Run("sign scalar", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			d, err := rand.Int(rand.Reader, nMinus1)
+			require.NoError(t, err)
+			k, err := rand.Int(rand.Reader, params.N)
+			require.NoError(t, err)
+			r, err := rand.Int(rand.Reader, params.N)
+			require.NoError(t, err)
+
+			want := new(big.Int).Add(d, big.NewInt(1))
+			want.ModInverse(want, params.N)
+			want.Mul(want, new(big.Int).Sub(k, new(big.Int).Mul(r, d)))
+			want.Mod(want, params.N)
+
+			got := sm2SignScalar(d.FillBytes(make([]byte, 32)),
+				k.FillBytes(make([]byte, 32)), r.FillBytes(make([]byte, 32)))
+			require.Equal(t, want.FillBytes(make([]byte, 32)), got)
+		}
+	})
+}
+
+func TestSignBySM2SM3(t *testing.T) {
+	t.Parallel()
+
+	prikey, err := NewSM2Prikey()
+	require.NoError(t, err)
+	content := []byte("hello, laisky")
+
+	sig, err := SignBySM2SM3(prikey, content)
+	require.NoError(t, err)
+	require.NoError(t, VerifyBySM2SM3(prikey.Public(), content, sig))
+
+	t.Run("wrong content", func(t *testing.T) {
+		err := VerifyBySM2SM3(prikey.Public(), []byte("hello"), sig)
+		require.ErrorContains(t, err, "signature not match")
+	})
+
+	t.Run("wrong uid", func(t *testing.T) {
+		err := VerifyReaderBySM2SM3(prikey.Public(), bytes.NewReader(content), sig, []byte("laisky"))
+		require.ErrorContains(t, err, "signature not match")
+	})
+
+	t.Run("wrong pubkey", func(t *testing.T) {
+		prikey2, err := NewSM2Prikey()
+		require.NoError(t, err)
+		err = VerifyBySM2SM3(prikey2.Public(), content, sig)
+		require.ErrorContains(t, err, "signature not match")
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		err := VerifyBySM2SM3(prikey.Public(), content, []byte("123"))
+		require.ErrorContains(t, err, "parse signature")
+	})
+
+	t.Run("pubkey not on curve", func(t *testing.T) {
+		pubkey := &SM2PublicKey{X: prikey.X, Y: new(big.Int).Add(prikey.Y, big.NewInt(1))}
+		err := VerifyBySM2SM3(pubkey, content, sig)
+		require.ErrorContains(t, err, "invalid sm2 public key")
+	})
+
+	t.Run("known key", func(t *testing.T) {
+		// private key from GB/T 32918.5 appendix
+		d, ok := ParseHex2Big("3945208F7B2144B13F36E38AC6D39F95889393692860B51A42FB81EF4DF7C5B8")
+		require.True(t, ok)
+		prikey, err := newSM2PrikeyByD(d)
+		require.NoError(t, err)
+		require.Equal(t, "09f9df311e5421a150dd7d161e4bc5c672179fad1833fc076bb08ff356f35020",
+			hex.EncodeToString(prikey.X.FillBytes(make([]byte, 32))))
+		require.Equal(t, "ccea490ce26775a52dc6ea718cc1aa600aed05fbf35e084a6632f6072da9ad13",
+			hex.EncodeToString(prikey.Y.FillBytes(make([]byte, 32))))
+	})
+}
+
+func TestEncryptBySM2(t *testing.T) {
+	t.Parallel()
+
+	prikey, err := NewSM2Prikey()
+	require.NoError(t, err)
+
+	for _, size := range []int{1, 31, 32, 33, 1024} {
+		plaintext, err := Salt(size)
+		require.NoError(t, err)
+
+		ciphertext, err := EncryptBySM2(prikey.Public(), plaintext)
+		require.NoError(t, err)
+
+		got, err := DecryptBySM2(prikey, ciphertext)
+		require.NoError(t, err)
+		require.Equal(t, plaintext, got)
+	}
+
+	ciphertext, err := EncryptBySM2(prikey.Public(), []byte("hello"))
+	require.NoError(t, err)
+
+	prikey2, err := NewSM2Prikey()
+	require.NoError(t, err)
+	_, err = DecryptBySM2(prikey2, ciphertext)
+	require.ErrorContains(t, err, "hash not match")
+
+	_, err = EncryptBySM2(prikey.Public(), nil)
+	require.ErrorContains(t, err, "plaintext is empty")
+}
+
+// TestSM2KnownAnswer vectors from GB/T 32918.5-2017 (GM/T 0003.5) appendix A
+func TestSM2KnownAnswer(t *testing.T) {
+	t.Parallel()
+
+	d, ok := ParseHex2Big("3945208F7B2144B13F36E38AC6D39F95889393692860B51A42FB81EF4DF7C5B8")
+	require.True(t, ok)
+	k, ok := ParseHex2Big("59276E27D506861A16680F3AD9C02DCCEF3CC1FA3CDBE4CE6D54B80DEAC1BC21")
+	require.True(t, ok)
+	prikey, err := newSM2PrikeyByD(d)
+	require.NoError(t, err)
+
+	t.Run("sign", func(t *testing.T) {
+		t.Parallel()
+
+		content := []byte("message digest")
+		e, err := sm2Digest(prikey.Public(), SM2DefaultUID, bytes.NewReader(content))
+		require.NoError(t, err)
+		require.Equal(t, "f0b43e94ba45accaace692ed534382eb17e6ab5a19ce7b31f4486fdfc0d28640",
+			hex.EncodeToString(e.FillBytes(make([]byte, 32))))
+
+		r, s, ok := sm2SignWithK(d, e, k)
+		require.True(t, ok)
+		require.Equal(t, "f5a03b0648d2c4630eeac513e1bb81a15944da3827d5b74143ac7eaceee720b3",
+			hex.EncodeToString(r.FillBytes(make([]byte, 32))))
+		require.Equal(t, "b1b6aa29df212fd8763182bc0d421ca1bb9038fd1f7f42d4840b69c485bbc1aa",
+			hex.EncodeToString(s.FillBytes(make([]byte, 32))))
+
+		sig, err := asn1.Marshal(sm2Signature{R: r, S: s})
+		require.NoError(t, err)
+		require.NoError(t, VerifyBySM2SM3(prikey.Public(), content, sig))
+	})
+
+	t.Run("encrypt", func(t *testing.T) {
+		t.Parallel()
+
+		plaintext := []byte("encryption standard")
+		c, ok := sm2EncryptWithK(prikey.Public(), plaintext, k)
+		require.True(t, ok)
+		require.Equal(t, "04ebfc718e8d1798620432268e77feb6415e2ede0e073c0f4f640ecd2e149a73",
+			hex.EncodeToString(c.X.FillBytes(make([]byte, 32))))
+		require.Equal(t, "e858f9d81e5430a57b36daab8f950a3c64e6ee6a63094d99283aff767e124df0",
+			hex.EncodeToString(c.Y.FillBytes(make([]byte, 32))))
+		require.Equal(t, "59983c18f809e262923c53aec295d30383b54e39d609d160afcb1908d0bd8766",
+			hex.EncodeToString(c.Hash))
+		require.Equal(t, "21886ca989ca9c7d58087307ca93092d651efa", hex.EncodeToString(c.Ciphertext))
+
+		ciphertext, err := asn1.Marshal(*c)
+		require.NoError(t, err)
+		got, err := DecryptBySM2(prikey, ciphertext)
+		require.NoError(t, err)
+		require.Equal(t, plaintext, got)
+	})
+}
+
+func TestSM2Prikey2Pem(t *testing.T) {
+	t.Parallel()
+
+	prikey, err := NewSM2Prikey()
+	require.NoError(t, err)
+
+	prikeyPem, err := SM2Prikey2Pem(prikey)
+	require.NoError(t, err)
+	got, err := Pem2SM2Prikey(prikeyPem)
+	require.NoError(t, err)
+	require.Equal(t, prikey.D, got.D)
+	require.True(t, prikey.Public().Equal(got.Public()))
+
+	pubkeyPem, err := SM2Pubkey2Pem(prikey.Public())
+	require.NoError(t, err)
+	gotPub, err := Pem2SM2Pubkey(pubkeyPem)
+	require.NoError(t, err)
+	require.True(t, prikey.Public().Equal(gotPub))
+
+	t.Run("sec1 with ec parameters", func(t *testing.T) {
+		// output of `tongsuo ecparam -genkey -name SM2`
+		sec1Pem := append([]byte("-----BEGIN EC PARAMETERS-----\nBggqgRzPVQGCLQ==\n-----END EC PARAMETERS-----\n"),
+			PrikeyDer2Pem(sm2SEC1Der(prikey, true))...)
+		sec1Pem = bytes.ReplaceAll(sec1Pem, []byte("BEGIN PRIVATE KEY"), []byte("BEGIN EC PRIVATE KEY"))
+		sec1Pem = bytes.ReplaceAll(sec1Pem, []byte("END PRIVATE KEY"), []byte("END EC PRIVATE KEY"))
+
+		got, err := Pem2SM2Prikey(sec1Pem)
+		require.NoError(t, err)
+		require.Equal(t, prikey.D, got.D)
+	})
+
+	t.Run("not sm2", func(t *testing.T) {
+		ecdsaPrikey, err := NewECDSAPrikey(ECDSACurveP256)
+		require.NoError(t, err)
+		ecdsaPem, err := Prikey2Pem(ecdsaPrikey)
+		require.NoError(t, err)
+
+		_, err = Pem2SM2Prikey(ecdsaPem)
+		require.ErrorContains(t, err, "not sm2 private key")
+
+		ecdsaPubPem, err := Pubkey2Pem(&ecdsaPrikey.PublicKey)
+		require.NoError(t, err)
+		_, err = Pem2SM2Pubkey(ecdsaPubPem)
+		require.ErrorContains(t, err, "not sm2 public key")
+	})
+}
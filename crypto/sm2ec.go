@@ -0,0 +1,428 @@
+package crypto
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"math/big"
+	"math/bits"
+	"sync"
+)
+
+// constant-time arithmetic of SM2 curve
+//
+// elements are 4 little-endian 64-bit limbs in Montgomery form,
+// operations never branch on or index memory by secret values.
+// points are in projective coordinates and added by complete formulas
+// for a = -3 from https://eprint.iacr.org/2015/1060 §A.2,
+// so identity and doubling need no special case.
+
+// sm2Elem element of field or scalar in Montgomery form
+type sm2Elem [4]uint64
+
+// sm2Modulus Montgomery arithmetic modulo an odd 256-bit number m
+type sm2Modulus struct {
+	m sm2Elem
+	// m0inv -m^-1 mod 2^64
+	m0inv uint64
+	// rr R^2 mod m, R = 2^256
+	rr sm2Elem
+	// one R mod m
+	one sm2Elem
+	// exp m-2 in big-endian, to invert by Fermat's little theorem
+	exp [32]byte
+}
+
+func newSM2Modulus(m *big.Int) *sm2Modulus {
+	mod := &sm2Modulus{m: sm2ElemFromBytes(m.FillBytes(make([]byte, 32)))}
+
+	// Newton iteration doubles the correct bits of m0^-1 every round
+	inv := uint64(1)
+	for i := 0; i < 6; i++ {
+		inv *= 2 - mod.m[0]*inv
+	}
+	mod.m0inv = -inv
+
+	rr := new(big.Int).Lsh(big.NewInt(1), 512)
+	mod.rr = sm2ElemFromBytes(rr.Mod(rr, m).FillBytes(make([]byte, 32)))
+	mod.toMont(&mod.one, &sm2Elem{1})
+	new(big.Int).Sub(m, big.NewInt(2)).FillBytes(mod.exp[:])
+	return mod
+}
+
+// sm2ElemFromBytes load 32 bytes big-endian number, not converted to Montgomery form
+func sm2ElemFromBytes(b []byte) (e sm2Elem) {
+	for i := range e {
+		e[i] = binary.BigEndian.Uint64(b[24-8*i:])
+	}
+
+	return e
+}
+
+// bytes 32 bytes big-endian number
+func (e *sm2Elem) bytes() []byte {
+	b := make([]byte, 32)
+	for i := range e {
+		binary.BigEndian.PutUint64(b[24-8*i:], e[i])
+	}
+
+	return b
+}
+
+// isZero return 1 if e is zero, otherwise 0
+func (e *sm2Elem) isZero() uint64 {
+	v := e[0] | e[1] | e[2] | e[3]
+	return 1 ^ ((v | -v) >> 63)
+}
+
+// sm2Select set z = a if cond is 1, z = b if cond is 0
+func sm2Select(z, a, b *sm2Elem, cond uint64) {
+	mask := -cond
+	for i := range z {
+		z[i] = (a[i] & mask) | (b[i] &^ mask)
+	}
+}
+
+// reduceOnce z = t + carry*2^256 mod m, t + carry*2^256 should be less than 2m
+func (mod *sm2Modulus) reduceOnce(z, t *sm2Elem, carry uint64) {
+	var (
+		r sm2Elem
+		b uint64
+	)
+	r[0], b = bits.Sub64(t[0], mod.m[0], 0)
+	r[1], b = bits.Sub64(t[1], mod.m[1], b)
+	r[2], b = bits.Sub64(t[2], mod.m[2], b)
+	r[3], b = bits.Sub64(t[3], mod.m[3], b)
+	_, b = bits.Sub64(carry, 0, b)
+
+	// borrow means t < m
+	sm2Select(z, t, &r, b)
+}
+
+// add z = x + y mod m
+func (mod *sm2Modulus) add(z, x, y *sm2Elem) {
+	var (
+		t sm2Elem
+		c uint64
+	)
+	t[0], c = bits.Add64(x[0], y[0], 0)
+	t[1], c = bits.Add64(x[1], y[1], c)
+	t[2], c = bits.Add64(x[2], y[2], c)
+	t[3], c = bits.Add64(x[3], y[3], c)
+	mod.reduceOnce(z, &t, c)
+}
+
+// sub z = x - y mod m
+func (mod *sm2Modulus) sub(z, x, y *sm2Elem) {
+	var (
+		t    sm2Elem
+		b, c uint64
+	)
+	t[0], b = bits.Sub64(x[0], y[0], 0)
+	t[1], b = bits.Sub64(x[1], y[1], b)
+	t[2], b = bits.Sub64(x[2], y[2], b)
+	t[3], b = bits.Sub64(x[3], y[3], b)
+
+	// add m back if borrowed
+	mask := -b
+	z[0], c = bits.Add64(t[0], mod.m[0]&mask, 0)
+	z[1], c = bits.Add64(t[1], mod.m[1]&mask, c)
+	z[2], c = bits.Add64(t[2], mod.m[2]&mask, c)
+	z[3], _ = bits.Add64(t[3], mod.m[3]&mask, c)
+}
+
+// mul z = x * y * R^-1 mod m, by CIOS Montgomery multiplication
+func (mod *sm2Modulus) mul(z, x, y *sm2Elem) {
+	var t [6]uint64
+	for i := 0; i < 4; i++ {
+		// t += x * y[i]
+		var c uint64
+		for j := 0; j < 4; j++ {
+			hi, lo := bits.Mul64(x[j], y[i])
+			var cc uint64
+			lo, cc = bits.Add64(lo, t[j], 0)
+			hi += cc
+			lo, cc = bits.Add64(lo, c, 0)
+			hi += cc
+			t[j], c = lo, hi
+		}
+		t[4], c = bits.Add64(t[4], c, 0)
+		t[5] = c
+
+		// t = (t + u*m) / 2^64
+		u := t[0] * mod.m0inv
+		hi, lo := bits.Mul64(u, mod.m[0])
+		_, c = bits.Add64(lo, t[0], 0)
+		c += hi
+		for j := 1; j < 4; j++ {
+			hi, lo = bits.Mul64(u, mod.m[j])
+			var cc uint64
+			lo, cc = bits.Add64(lo, t[j], 0)
+			hi += cc
+			lo, cc = bits.Add64(lo, c, 0)
+			hi += cc
+			t[j-1], c = lo, hi
+		}
+		t[3], c = bits.Add64(t[4], c, 0)
+		t[4] = t[5] + c
+	}
+
+	mod.reduceOnce(z, (*sm2Elem)(t[:4]), t[4])
+}
+
+// toMont convert x to Montgomery form, x can be any 256-bit number
+func (mod *sm2Modulus) toMont(z, x *sm2Elem) {
+	mod.mul(z, x, &mod.rr)
+}
+
+// fromMont convert x from Montgomery form
+func (mod *sm2Modulus) fromMont(z, x *sm2Elem) {
+	mod.mul(z, x, &sm2Elem{1})
+}
+
+// inv z = x^-1 mod m, z = 0 if x is 0
+//
+// exponent m-2 is public, so square-and-multiply is constant-time in x.
+func (mod *sm2Modulus) inv(z, x *sm2Elem) {
+	r := mod.one
+	for _, b := range mod.exp {
+		for i := 7; i >= 0; i-- {
+			mod.mul(&r, &r, &r)
+			if (b>>i)&1 == 1 {
+				mod.mul(&r, &r, x)
+			}
+		}
+	}
+
+	*z = r
+}
+
+// sm2Point point in projective coordinates (X:Y:Z), x = X/Z, y = Y/Z
+type sm2Point struct {
+	x, y, z sm2Elem
+}
+
+type sm2Curve struct {
+	// p field, n order of base point
+	p, n *sm2Modulus
+	// b in Montgomery form
+	b sm2Elem
+	g sm2Point
+}
+
+var (
+	sm2CurveOnce sync.Once
+	sm2C         *sm2Curve
+)
+
+// sm2ConstantTimeCurve constant-time implementation of SM2P256
+func sm2ConstantTimeCurve() *sm2Curve {
+	sm2CurveOnce.Do(func() {
+		params := SM2P256().Params()
+		sm2C = &sm2Curve{
+			p: newSM2Modulus(params.P),
+			n: newSM2Modulus(params.N),
+		}
+
+		b := sm2ElemFromBytes(params.B.FillBytes(make([]byte, 32)))
+		sm2C.p.toMont(&sm2C.b, &b)
+		sm2C.g = sm2C.pointFromAffine(params.Gx, params.Gy)
+	})
+
+	return sm2C
+}
+
+// identity point at infinity (0:1:0)
+func (c *sm2Curve) identity() sm2Point {
+	return sm2Point{y: c.p.one}
+}
+
+// pointFromAffine convert affine point, point should be on curve
+func (c *sm2Curve) pointFromAffine(x, y *big.Int) (p sm2Point) {
+	px := sm2ElemFromBytes(x.FillBytes(make([]byte, 32)))
+	py := sm2ElemFromBytes(y.FillBytes(make([]byte, 32)))
+	c.p.toMont(&p.x, &px)
+	c.p.toMont(&p.y, &py)
+	p.z = c.p.one
+	return p
+}
+
+// affine convert to affine coordinates, return (0, 0) for identity
+func (c *sm2Curve) affine(p *sm2Point) (x, y *big.Int) {
+	var zinv, ax, ay sm2Elem
+	c.p.inv(&zinv, &p.z)
+	c.p.mul(&ax, &p.x, &zinv)
+	c.p.mul(&ay, &p.y, &zinv)
+	c.p.fromMont(&ax, &ax)
+	c.p.fromMont(&ay, &ay)
+	return new(big.Int).SetBytes(ax.bytes()), new(big.Int).SetBytes(ay.bytes())
+}
+
+// add q = p1 + p2, points may overlap
+func (c *sm2Curve) add(q, p1, p2 *sm2Point) {
+	f := c.p
+	var t0, t1, t2, t3, t4, x3, y3, z3 sm2Elem
+	f.mul(&t0, &p1.x, &p2.x) // t0 := X1 * X2
+	f.mul(&t1, &p1.y, &p2.y) // t1 := Y1 * Y2
+	f.mul(&t2, &p1.z, &p2.z) // t2 := Z1 * Z2
+	f.add(&t3, &p1.x, &p1.y) // t3 := X1 + Y1
+	f.add(&t4, &p2.x, &p2.y) // t4 := X2 + Y2
+	f.mul(&t3, &t3, &t4)     // t3 := t3 * t4
+	f.add(&t4, &t0, &t1)     // t4 := t0 + t1
+	f.sub(&t3, &t3, &t4)     // t3 := t3 - t4
+	f.add(&t4, &p1.y, &p1.z) // t4 := Y1 + Z1
+	f.add(&x3, &p2.y, &p2.z) // X3 := Y2 + Z2
+	f.mul(&t4, &t4, &x3)     // t4 := t4 * X3
+	f.add(&x3, &t1, &t2)     // X3 := t1 + t2
+	f.sub(&t4, &t4, &x3)     // t4 := t4 - X3
+	f.add(&x3, &p1.x, &p1.z) // X3 := X1 + Z1
+	f.add(&y3, &p2.x, &p2.z) // Y3 := X2 + Z2
+	f.mul(&x3, &x3, &y3)     // X3 := X3 * Y3
+	f.add(&y3, &t0, &t2)     // Y3 := t0 + t2
+	f.sub(&y3, &x3, &y3)     // Y3 := X3 - Y3
+	f.mul(&z3, &c.b, &t2)    // Z3 := b * t2
+	f.sub(&x3, &y3, &z3)     // X3 := Y3 - Z3
+	f.add(&z3, &x3, &x3)     // Z3 := X3 + X3
+	f.add(&x3, &x3, &z3)     // X3 := X3 + Z3
+	f.sub(&z3, &t1, &x3)     // Z3 := t1 - X3
+	f.add(&x3, &t1, &x3)     // X3 := t1 + X3
+	f.mul(&y3, &c.b, &y3)    // Y3 := b * Y3
+	f.add(&t1, &t2, &t2)     // t1 := t2 + t2
+	f.add(&t2, &t1, &t2)     // t2 := t1 + t2
+	f.sub(&y3, &y3, &t2)     // Y3 := Y3 - t2
+	f.sub(&y3, &y3, &t0)     // Y3 := Y3 - t0
+	f.add(&t1, &y3, &y3)     // t1 := Y3 + Y3
+	f.add(&y3, &t1, &y3)     // Y3 := t1 + Y3
+	f.add(&t1, &t0, &t0)     // t1 := t0 + t0
+	f.add(&t0, &t1, &t0)     // t0 := t1 + t0
+	f.sub(&t0, &t0, &t2)     // t0 := t0 - t2
+	f.mul(&t1, &t4, &y3)     // t1 := t4 * Y3
+	f.mul(&t2, &t0, &y3)     // t2 := t0 * Y3
+	f.mul(&y3, &x3, &z3)     // Y3 := X3 * Z3
+	f.add(&y3, &y3, &t2)     // Y3 := Y3 + t2
+	f.mul(&x3, &t3, &x3)     // X3 := t3 * X3
+	f.sub(&x3, &x3, &t1)     // X3 := X3 - t1
+	f.mul(&z3, &t4, &z3)     // Z3 := t4 * Z3
+	f.mul(&t1, &t3, &t0)     // t1 := t3 * t0
+	f.add(&z3, &z3, &t1)     // Z3 := Z3 + t1
+
+	q.x, q.y, q.z = x3, y3, z3
+}
+
+// double q = 2p, points may overlap
+func (c *sm2Curve) double(q, p *sm2Point) {
+	f := c.p
+	var t0, t1, t2, t3, x3, y3, z3 sm2Elem
+	f.mul(&t0, &p.x, &p.x) // t0 := X ^ 2
+	f.mul(&t1, &p.y, &p.y) // t1 := Y ^ 2
+	f.mul(&t2, &p.z, &p.z) // t2 := Z ^ 2
+	f.mul(&t3, &p.x, &p.y) // t3 := X * Y
+	f.add(&t3, &t3, &t3)   // t3 := t3 + t3
+	f.mul(&z3, &p.x, &p.z) // Z3 := X * Z
+	f.add(&z3, &z3, &z3)   // Z3 := Z3 + Z3
+	f.mul(&y3, &c.b, &t2)  // Y3 := b * t2
+	f.sub(&y3, &y3, &z3)   // Y3 := Y3 - Z3
+	f.add(&x3, &y3, &y3)   // X3 := Y3 + Y3
+	f.add(&y3, &x3, &y3)   // Y3 := X3 + Y3
+	f.sub(&x3, &t1, &y3)   // X3 := t1 - Y3
+	f.add(&y3, &t1, &y3)   // Y3 := t1 + Y3
+	f.mul(&y3, &x3, &y3)   // Y3 := X3 * Y3
+	f.mul(&x3, &x3, &t3)   // X3 := X3 * t3
+	f.add(&t3, &t2, &t2)   // t3 := t2 + t2
+	f.add(&t2, &t2, &t3)   // t2 := t2 + t3
+	f.mul(&z3, &c.b, &z3)  // Z3 := b * Z3
+	f.sub(&z3, &z3, &t2)   // Z3 := Z3 - t2
+	f.sub(&z3, &z3, &t0)   // Z3 := Z3 - t0
+	f.add(&t3, &z3, &z3)   // t3 := Z3 + Z3
+	f.add(&z3, &z3, &t3)   // Z3 := Z3 + t3
+	f.add(&t3, &t0, &t0)   // t3 := t0 + t0
+	f.add(&t0, &t3, &t0)   // t0 := t3 + t0
+	f.sub(&t0, &t0, &t2)   // t0 := t0 - t2
+	f.mul(&t0, &t0, &z3)   // t0 := t0 * Z3
+	f.add(&y3, &y3, &t0)   // Y3 := Y3 + t0
+	f.mul(&t0, &p.y, &p.z) // t0 := Y * Z
+	f.add(&t0, &t0, &t0)   // t0 := t0 + t0
+	f.mul(&z3, &t0, &z3)   // Z3 := t0 * Z3
+	f.sub(&x3, &x3, &z3)   // X3 := X3 - Z3
+	f.mul(&z3, &t0, &t1)   // Z3 := t0 * t1
+	f.add(&z3, &z3, &z3)   // Z3 := Z3 + Z3
+	f.add(&z3, &z3, &z3)   // Z3 := Z3 + Z3
+
+	q.x, q.y, q.z = x3, y3, z3
+}
+
+// selectPoint set q = table[n-1], or identity if n is 0, in constant time
+func (c *sm2Curve) selectPoint(q *sm2Point, table *[15]sm2Point, n uint8) {
+	*q = c.identity()
+	for i := range table {
+		cond := uint64(subtle.ConstantTimeByteEq(uint8(i+1), n))
+		sm2Select(&q.x, &table[i].x, &q.x, cond)
+		sm2Select(&q.y, &table[i].y, &q.y, cond)
+		sm2Select(&q.z, &table[i].z, &q.z, cond)
+	}
+}
+
+// scalarMult q = k*p by fixed 4-bit window, k is 32 bytes big-endian
+func (c *sm2Curve) scalarMult(q, p *sm2Point, k []byte) {
+	// table[i] = (i+1)*p
+	var table [15]sm2Point
+	table[0] = *p
+	for i := 1; i < 15; i += 2 {
+		c.double(&table[i], &table[i/2])
+		c.add(&table[i+1], &table[i], p)
+	}
+
+	acc, t := c.identity(), sm2Point{}
+	for i, b := range k {
+		if i != 0 {
+			for j := 0; j < 4; j++ {
+				c.double(&acc, &acc)
+			}
+		}
+		c.selectPoint(&t, &table, b>>4)
+		c.add(&acc, &acc, &t)
+
+		for j := 0; j < 4; j++ {
+			c.double(&acc, &acc)
+		}
+		c.selectPoint(&t, &table, b&0x0f)
+		c.add(&acc, &acc, &t)
+	}
+
+	*q = acc
+}
+
+// sm2ScalarBaseMult k*G in constant time, k is 32 bytes big-endian
+func sm2ScalarBaseMult(k []byte) (x, y *big.Int) {
+	c := sm2ConstantTimeCurve()
+	var p sm2Point
+	c.scalarMult(&p, &c.g, k)
+	return c.affine(&p)
+}
+
+// sm2ScalarMult k*(x, y) in constant time, k is 32 bytes big-endian,
+// (x, y) should be on curve.
+func sm2ScalarMult(x, y *big.Int, k []byte) (*big.Int, *big.Int) {
+	c := sm2ConstantTimeCurve()
+	p := c.pointFromAffine(x, y)
+	c.scalarMult(&p, &p, k)
+	return c.affine(&p)
+}
+
+// sm2SignScalar s = (1+d)^-1 * (k - r*d) mod n in constant time,
+// all arguments are 32 bytes big-endian and less than n.
+func sm2SignScalar(d, k, r []byte) []byte {
+	fn := sm2ConstantTimeCurve().n
+	var dm, km, rm, t, s sm2Elem
+	dm, km, rm = sm2ElemFromBytes(d), sm2ElemFromBytes(k), sm2ElemFromBytes(r)
+	fn.toMont(&dm, &dm)
+	fn.toMont(&km, &km)
+	fn.toMont(&rm, &rm)
+
+	fn.add(&t, &dm, &fn.one) // 1 + d
+	fn.inv(&t, &t)
+	fn.mul(&s, &rm, &dm)
+	fn.sub(&s, &km, &s)
+	fn.mul(&s, &s, &t)
+	fn.fromMont(&s, &s)
+	return s.bytes()
+}
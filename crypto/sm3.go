@@ -0,0 +1,168 @@
+package crypto
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+// SM3 hash algorithm defined in GB/T 32905-2016
+//
+// pure go implementation, no need for tongsuo.
+
+const (
+	// SM3Size size of sm3 checksum in bytes
+	SM3Size = 32
+	// SM3BlockSize block size of sm3 in bytes
+	SM3BlockSize = 64
+)
+
+func init() {
+	if err := gutils.RegisterHashType(gutils.HashTypeSM3, NewSM3); err != nil {
+		panic(err)
+	}
+}
+
+var sm3IV = [8]uint32{
+	0x7380166f, 0x4914b2b9, 0x172442d7, 0xda8a0600,
+	0xa96f30bc, 0x163138aa, 0xe38dee4d, 0xb0fb0e4e,
+}
+
+type sm3Digest struct {
+	h   [8]uint32
+	x   [SM3BlockSize]byte
+	nx  int
+	len uint64
+}
+
+// NewSM3 new sm3 hash.Hash
+func NewSM3() hash.Hash {
+	d := new(sm3Digest)
+	d.Reset()
+	return d
+}
+
+// SM3Sum return sm3 checksum of data
+func SM3Sum(data []byte) (sum [SM3Size]byte) {
+	d := new(sm3Digest)
+	d.Reset()
+	_, _ = d.Write(data)
+	d.checkSum(sum[:0])
+	return sum
+}
+
+// Reset reset digest to initial state
+func (d *sm3Digest) Reset() {
+	d.h = sm3IV
+	d.nx = 0
+	d.len = 0
+}
+
+// Size return size of checksum
+func (d *sm3Digest) Size() int { return SM3Size }
+
+// BlockSize return block size
+func (d *sm3Digest) BlockSize() int { return SM3BlockSize }
+
+// Write write data to digest
+func (d *sm3Digest) Write(p []byte) (n int, err error) {
+	n = len(p)
+	d.len += uint64(n)
+	if d.nx > 0 {
+		l := copy(d.x[d.nx:], p)
+		d.nx += l
+		p = p[l:]
+		if d.nx == SM3BlockSize {
+			sm3Block(&d.h, d.x[:])
+			d.nx = 0
+		}
+	}
+
+	for len(p) >= SM3BlockSize {
+		sm3Block(&d.h, p[:SM3BlockSize])
+		p = p[SM3BlockSize:]
+	}
+
+	if len(p) > 0 {
+		d.nx = copy(d.x[:], p)
+	}
+
+	return n, nil
+}
+
+// Sum append checksum to b, will not change the state of digest
+func (d *sm3Digest) Sum(b []byte) []byte {
+	d0 := *d
+	return d0.checkSum(b)
+}
+
+func (d *sm3Digest) checkSum(b []byte) []byte {
+	bitLen := d.len << 3
+
+	var pad [SM3BlockSize + 8]byte
+	pad[0] = 0x80
+	padLen := 56 - int(d.len%SM3BlockSize)
+	if padLen <= 0 {
+		padLen += SM3BlockSize
+	}
+	binary.BigEndian.PutUint64(pad[padLen:], bitLen)
+	_, _ = d.Write(pad[:padLen+8])
+
+	for _, v := range d.h {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+
+	return b
+}
+
+func sm3Block(h *[8]uint32, p []byte) {
+	var w [68]uint32
+	for i := 0; i < 16; i++ {
+		w[i] = binary.BigEndian.Uint32(p[i*4:])
+	}
+	for j := 16; j < 68; j++ {
+		x := w[j-16] ^ w[j-9] ^ bits.RotateLeft32(w[j-3], 15)
+		w[j] = x ^ bits.RotateLeft32(x, 15) ^ bits.RotateLeft32(x, 23) ^
+			bits.RotateLeft32(w[j-13], 7) ^ w[j-6]
+	}
+
+	a, b, c, dd, e, f, g, hh := h[0], h[1], h[2], h[3], h[4], h[5], h[6], h[7]
+	for j := 0; j < 64; j++ {
+		var t, ff, gg uint32
+		if j < 16 {
+			t = 0x79cc4519
+			ff = a ^ b ^ c
+			gg = e ^ f ^ g
+		} else {
+			t = 0x7a879d8a
+			ff = (a & b) | (a & c) | (b & c)
+			gg = (e & f) | (^e & g)
+		}
+
+		a12 := bits.RotateLeft32(a, 12)
+		ss1 := bits.RotateLeft32(a12+e+bits.RotateLeft32(t, j%32), 7)
+		ss2 := ss1 ^ a12
+		tt1 := ff + dd + ss2 + (w[j] ^ w[j+4])
+		tt2 := gg + hh + ss1 + w[j]
+
+		dd = c
+		c = bits.RotateLeft32(b, 9)
+		b = a
+		a = tt1
+		hh = g
+		g = bits.RotateLeft32(f, 19)
+		f = e
+		e = tt2 ^ bits.RotateLeft32(tt2, 9) ^ bits.RotateLeft32(tt2, 17)
+	}
+
+	h[0] ^= a
+	h[1] ^= b
+	h[2] ^= c
+	h[3] ^= dd
+	h[4] ^= e
+	h[5] ^= f
+	h[6] ^= g
+	h[7] ^= hh
+}
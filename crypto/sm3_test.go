@@ -0,0 +1,60 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+func TestSM3Sum(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		// GB/T 32905-2016 appendix A
+		{"abc", "66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0"},
+		{strings.Repeat("abcd", 16), "debe9ff92275b8a138604889c18e5a4d6fdb70e5387e5765293dcba39c0c5732"},
+		{"", "1ab21d8355cfa17f8e61194831e81a8f22bec8c728fefb747ed035eb5082aa2b"},
+	}
+	for _, tt := range tests {
+		sum := SM3Sum([]byte(tt.input))
+		require.Equal(t, tt.want, hex.EncodeToString(sum[:]))
+
+		// write in pieces
+		h := NewSM3()
+		for i := 0; i < len(tt.input); i += 3 {
+			end := i + 3
+			if end > len(tt.input) {
+				end = len(tt.input)
+			}
+			_, err := h.Write([]byte(tt.input[i:end]))
+			require.NoError(t, err)
+		}
+		require.Equal(t, tt.want, hex.EncodeToString(h.Sum(nil)))
+		// Sum should not change state
+		require.Equal(t, tt.want, hex.EncodeToString(h.Sum(nil)))
+
+		h.Reset()
+		_, err := h.Write([]byte(tt.input))
+		require.NoError(t, err)
+		require.Equal(t, tt.want, hex.EncodeToString(h.Sum(nil)))
+	}
+}
+
+func TestSM3HashType(t *testing.T) {
+	t.Parallel()
+
+	hashType, err := gutils.ParseHashType("SM3")
+	require.NoError(t, err)
+
+	sig, err := gutils.Hash(hashType, strings.NewReader("abc"))
+	require.NoError(t, err)
+	require.Equal(t, "66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0",
+		hex.EncodeToString(sig))
+}
@@ -0,0 +1,88 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSM4Cipher(t *testing.T) {
+	t.Parallel()
+
+	// GB/T 32907-2016 appendix A
+	key, err := hex.DecodeString("0123456789abcdeffedcba9876543210")
+	require.NoError(t, err)
+
+	block, err := NewSM4Cipher(key)
+	require.NoError(t, err)
+
+	dst := make([]byte, SM4BlockSize)
+	block.Encrypt(dst, key)
+	require.Equal(t, "681edf34d206965e86b3e94f536e4246", hex.EncodeToString(dst))
+
+	block.Decrypt(dst, dst)
+	require.Equal(t, key, dst)
+
+	t.Run("encrypt 1000000 times", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("skip in short mode")
+		}
+
+		dst := append([]byte{}, key...)
+		for i := 0; i < 1000000; i++ {
+			block.Encrypt(dst, dst)
+		}
+		require.Equal(t, "595298c7c6fd271f0402f804c33d3f66", hex.EncodeToString(dst))
+	})
+
+	_, err = NewSM4Cipher([]byte("123"))
+	require.ErrorContains(t, err, "sm4 key should be 16 bytes")
+}
+
+func TestEncryptBySm4CbcBasic(t *testing.T) {
+	t.Parallel()
+
+	key, err := Salt(SM4KeySize)
+	require.NoError(t, err)
+	iv, err := Salt(SM4BlockSize)
+	require.NoError(t, err)
+
+	for _, size := range []int{0, 1, 15, 16, 17, 1024} {
+		plaintext, err := Salt(size)
+		require.NoError(t, err)
+
+		ciphertext, err := EncryptBySm4CbcBasic(key, plaintext, iv)
+		require.NoError(t, err)
+		require.Equal(t, (size/SM4BlockSize+1)*SM4BlockSize, len(ciphertext))
+
+		got, err := DecryptBySm4CbcBasic(key, ciphertext, iv)
+		require.NoError(t, err)
+		require.Equal(t, plaintext, got)
+	}
+
+	_, err = DecryptBySm4CbcBasic(key, []byte("123"), iv)
+	require.ErrorContains(t, err, "multiple of the block size")
+	_, err = EncryptBySm4CbcBasic(key, []byte("123"), []byte("123"))
+	require.ErrorContains(t, err, "iv should be 16 bytes")
+}
+
+func TestEncryptBySm4Gcm(t *testing.T) {
+	t.Parallel()
+
+	key, err := Salt(SM4KeySize)
+	require.NoError(t, err)
+	plaintext := []byte("hello, laisky")
+
+	ciphertext, err := EncryptBySm4Gcm(key, plaintext, []byte("ad"))
+	require.NoError(t, err)
+
+	got, err := DecryptBySm4Gcm(key, ciphertext, []byte("ad"))
+	require.NoError(t, err)
+	require.Equal(t, plaintext, got)
+
+	_, err = DecryptBySm4Gcm(key, ciphertext, []byte("wrong"))
+	require.ErrorContains(t, err, "message authentication failed")
+	_, err = DecryptBySm4Gcm(key, ciphertext[:10], nil)
+	require.ErrorContains(t, err, "ciphertext too short")
+}
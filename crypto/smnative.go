@@ -0,0 +1,214 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// SMInterface SM2/SM3/SM4 operations
+//
+// implemented by NativeSM in pure go, and by Tongsuo via external binary.
+type SMInterface interface {
+	// NewPrikey generate new sm2 private key in PEM
+	NewPrikey(ctx context.Context) (prikeyPem []byte, err error)
+	// Prikey2Pubkey convert sm2 private key to public key in PEM
+	Prikey2Pubkey(ctx context.Context, prikeyPem []byte) (pubkeyPem []byte, err error)
+	// SignBySm2Sm3 sign by sm2 sm3
+	SignBySm2Sm3(ctx context.Context, parentPrikeyPem []byte, content []byte) (signature []byte, err error)
+	// VerifyBySm2Sm3 verify by sm2 sm3
+	VerifyBySm2Sm3(ctx context.Context, pubkeyPem, signature, content []byte) error
+	// EncryptBySm2 encrypt by sm2 public key
+	EncryptBySm2(ctx context.Context, pubkeyPem []byte, data []byte) (cipher []byte, err error)
+	// DecryptBySm2 decrypt by sm2 private key
+	DecryptBySm2(ctx context.Context, prikeyPem []byte, cipher []byte) (data []byte, err error)
+	// HashBySm3 hash by sm3
+	HashBySm3(ctx context.Context, content []byte) (hash []byte, err error)
+	// EncryptBySm4CbcBaisc encrypt by sm4 cbc, return ciphertext and hmac
+	EncryptBySm4CbcBaisc(ctx context.Context, key, plaintext, iv []byte) (ciphertext, hmac []byte, err error)
+	// DecryptBySm4CbcBaisc decrypt by sm4 cbc, check hmac if not empty
+	DecryptBySm4CbcBaisc(ctx context.Context, key, ciphertext, iv, hmac []byte) (plaintext []byte, err error)
+	// EncryptBySm4Cbc encrypt by sm4 cbc, return `{iv}{cipher}{hmac}`
+	EncryptBySm4Cbc(ctx context.Context, key, plaintext []byte) (combinedCipher []byte, err error)
+	// DecryptBySm4Cbc decrypt `{iv}{cipher}{hmac}` by sm4 cbc
+	DecryptBySm4Cbc(ctx context.Context, key, combinedCipher []byte) (plaintext []byte, err error)
+}
+
+var (
+	_ SMInterface = new(NativeSM)
+	_ SMInterface = new(Tongsuo)
+)
+
+// NativeSM pure go implementation of SMInterface
+//
+// has the same method signatures and output formats as Tongsuo,
+// but do not need any external binary.
+type NativeSM struct{}
+
+// NewNativeSM new pure go SM2/SM3/SM4 implementation
+func NewNativeSM() *NativeSM {
+	return new(NativeSM)
+}
+
+// NewPrikey generate new sm2 private key in PKCS#8 PEM
+func (s *NativeSM) NewPrikey(_ context.Context) (prikeyPem []byte, err error) {
+	prikey, err := NewSM2Prikey()
+	if err != nil {
+		return nil, errors.Wrap(err, "generate new private key")
+	}
+
+	return SM2Prikey2Pem(prikey)
+}
+
+// Prikey2Pubkey convert private key to public key
+func (s *NativeSM) Prikey2Pubkey(_ context.Context, prikeyPem []byte) (
+	pubkeyPem []byte, err error) {
+	prikey, err := Pem2SM2Prikey(prikeyPem)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse private key")
+	}
+
+	return SM2Pubkey2Pem(prikey.Public())
+}
+
+// SignBySm2Sm3 sign by sm2 sm3
+func (s *NativeSM) SignBySm2Sm3(_ context.Context,
+	parentPrikeyPem []byte, content []byte) (signature []byte, err error) {
+	prikey, err := Pem2SM2Prikey(parentPrikeyPem)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse private key")
+	}
+
+	return SignBySM2SM3(prikey, content)
+}
+
+// VerifyBySm2Sm3 verify by sm2 sm3
+func (s *NativeSM) VerifyBySm2Sm3(_ context.Context,
+	pubkeyPem, signature, content []byte) error {
+	pubkey, err := Pem2SM2Pubkey(pubkeyPem)
+	if err != nil {
+		return errors.Wrap(err, "parse public key")
+	}
+
+	if err = VerifyBySM2SM3(pubkey, content, signature); err != nil {
+		return errors.Wrap(err, "verify by sm2 sm3")
+	}
+
+	return nil
+}
+
+// EncryptBySm2 encrypt by sm2 public key
+func (s *NativeSM) EncryptBySm2(_ context.Context,
+	pubkeyPem []byte, data []byte) (cipher []byte, err error) {
+	pubkey, err := Pem2SM2Pubkey(pubkeyPem)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse public key")
+	}
+
+	return EncryptBySM2(pubkey, data)
+}
+
+// DecryptBySm2 decrypt by sm2 private key
+func (s *NativeSM) DecryptBySm2(_ context.Context,
+	prikeyPem []byte, cipher []byte) (data []byte, err error) {
+	prikey, err := Pem2SM2Prikey(prikeyPem)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse private key")
+	}
+
+	return DecryptBySM2(prikey, cipher)
+}
+
+// HashBySm3 hash by sm3
+func (s *NativeSM) HashBySm3(_ context.Context, content []byte) (hash []byte, err error) {
+	sum := SM3Sum(content)
+	return sum[:], nil
+}
+
+// EncryptBySm4CbcBaisc encrypt by sm4
+//
+// # Args
+//   - key: sm4 key, should be 16 bytes
+//   - plaintext: data to be encrypted
+//   - iv: sm4 iv, should be 16 bytes
+//
+// # Returns
+//   - ciphertext: sm4 encrypted data
+//   - hmac: hmac of ciphertext, 32 bytes
+func (s *NativeSM) EncryptBySm4CbcBaisc(_ context.Context,
+	key, plaintext, iv []byte) (ciphertext, hmac []byte, err error) {
+	if ciphertext, err = EncryptBySm4CbcBasic(key, plaintext, iv); err != nil {
+		return nil, nil, errors.Wrap(err, "encrypt")
+	}
+
+	if hmac, err = HMACSha256(key, bytes.NewReader(ciphertext)); err != nil {
+		return nil, nil, errors.Wrap(err, "calculate hmac")
+	}
+
+	return ciphertext, hmac, nil
+}
+
+// DecryptBySm4CbcBaisc decrypt by sm4
+//
+// # Args
+//   - key: sm4 key
+//   - ciphertext: sm4 encrypted data
+//   - iv: sm4 iv
+//   - mac: if not nil, will check ciphertext's integrity by hmac
+func (s *NativeSM) DecryptBySm4CbcBaisc(_ context.Context,
+	key, ciphertext, iv, mac []byte) (plaintext []byte, err error) {
+	if len(mac) != 0 && len(mac) != 32 {
+		return nil, errors.Errorf("hmac should be 0 or 32 bytes")
+	}
+
+	if len(mac) != 0 { // check hmac
+		if expectedHmac, err := HMACSha256(key, bytes.NewReader(ciphertext)); err != nil {
+			return nil, errors.Wrap(err, "calculate hmac")
+		} else if !hmac.Equal(mac, expectedHmac) {
+			return nil, errors.Errorf("hmac not match")
+		}
+	}
+
+	if plaintext, err = DecryptBySm4CbcBasic(key, ciphertext, iv); err != nil {
+		return nil, errors.Wrap(err, "decrypt")
+	}
+
+	return plaintext, nil
+}
+
+// EncryptBySm4Cbc encrypt by sm4, should be decrypted by `DecryptBySm4Cbc` only
+func (s *NativeSM) EncryptBySm4Cbc(ctx context.Context, key, plaintext []byte) (
+	combinedCipher []byte, err error) {
+	iv, err := Salt(SM4BlockSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate iv")
+	}
+
+	cipher, hmac, err := s.EncryptBySm4CbcBaisc(ctx, key, plaintext, iv)
+	if err != nil {
+		return nil, errors.Wrap(err, "encrypt by sm4 basic")
+	}
+
+	combinedCipher = make([]byte, 0, len(iv)+len(cipher)+len(hmac))
+	combinedCipher = append(combinedCipher, iv...)
+	combinedCipher = append(combinedCipher, cipher...)
+	combinedCipher = append(combinedCipher, hmac...)
+
+	return combinedCipher, nil
+}
+
+// DecryptBySm4Cbc decrypt by sm4, should be encrypted by `EncryptBySm4Cbc` only
+func (s *NativeSM) DecryptBySm4Cbc(ctx context.Context, key, combinedCipher []byte) (
+	plaintext []byte, err error) {
+	if len(combinedCipher) <= 48 {
+		return nil, errors.Errorf("invalid combined cipher")
+	}
+
+	iv := combinedCipher[:16]
+	cipher := combinedCipher[16 : len(combinedCipher)-32]
+	hmac := combinedCipher[len(combinedCipher)-32:]
+
+	return s.DecryptBySm4CbcBaisc(ctx, key, cipher, iv, hmac)
+}
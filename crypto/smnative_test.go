@@ -0,0 +1,131 @@
+package crypto
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNativeSM(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sm := NewNativeSM()
+
+	prikeyPem, err := sm.NewPrikey(ctx)
+	require.NoError(t, err)
+	pubkeyPem, err := sm.Prikey2Pubkey(ctx, prikeyPem)
+	require.NoError(t, err)
+
+	t.Run("sign", func(t *testing.T) {
+		content := []byte("hello, laisky")
+		sig, err := sm.SignBySm2Sm3(ctx, prikeyPem, content)
+		require.NoError(t, err)
+		require.NoError(t, sm.VerifyBySm2Sm3(ctx, pubkeyPem, sig, content))
+		require.Error(t, sm.VerifyBySm2Sm3(ctx, pubkeyPem, sig, []byte("hello")))
+	})
+
+	t.Run("sm2 encrypt", func(t *testing.T) {
+		cipher, err := sm.EncryptBySm2(ctx, pubkeyPem, []byte("hello, laisky"))
+		require.NoError(t, err)
+		plaintext, err := sm.DecryptBySm2(ctx, prikeyPem, cipher)
+		require.NoError(t, err)
+		require.Equal(t, "hello, laisky", string(plaintext))
+	})
+
+	t.Run("sm3", func(t *testing.T) {
+		hash, err := sm.HashBySm3(ctx, []byte("abc"))
+		require.NoError(t, err)
+		require.Equal(t, "66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0",
+			hex.EncodeToString(hash))
+	})
+
+	t.Run("sm4", func(t *testing.T) {
+		key, err := Salt(SM4KeySize)
+		require.NoError(t, err)
+		iv, err := Salt(SM4BlockSize)
+		require.NoError(t, err)
+
+		cipher, hmac, err := sm.EncryptBySm4CbcBaisc(ctx, key, []byte("hello, laisky"), iv)
+		require.NoError(t, err)
+		plaintext, err := sm.DecryptBySm4CbcBaisc(ctx, key, cipher, iv, hmac)
+		require.NoError(t, err)
+		require.Equal(t, "hello, laisky", string(plaintext))
+
+		hmac[0] ^= 0xff
+		_, err = sm.DecryptBySm4CbcBaisc(ctx, key, cipher, iv, hmac)
+		require.ErrorContains(t, err, "hmac not match")
+
+		combined, err := sm.EncryptBySm4Cbc(ctx, key, []byte("hello, laisky"))
+		require.NoError(t, err)
+		plaintext, err = sm.DecryptBySm4Cbc(ctx, key, combined)
+		require.NoError(t, err)
+		require.Equal(t, "hello, laisky", string(plaintext))
+	})
+}
+
+func TestNativeSM_CrossTongsuo(t *testing.T) {
+	t.Parallel()
+	if testSkipSmTongsuo(t) {
+		return
+	}
+
+	ctx := context.Background()
+	native := NewNativeSM()
+	ins, err := NewTongsuo("/usr/local/bin/tongsuo")
+	require.NoError(t, err)
+
+	content := []byte("hello, laisky")
+
+	t.Run("native key, tongsuo verify", func(t *testing.T) {
+		prikeyPem, err := native.NewPrikey(ctx)
+		require.NoError(t, err)
+		pubkeyPem, err := native.Prikey2Pubkey(ctx, prikeyPem)
+		require.NoError(t, err)
+
+		sig, err := native.SignBySm2Sm3(ctx, prikeyPem, content)
+		require.NoError(t, err)
+		require.NoError(t, ins.VerifyBySm2Sm3(ctx, pubkeyPem, sig, content))
+
+		cipher, err := native.EncryptBySm2(ctx, pubkeyPem, content)
+		require.NoError(t, err)
+		plaintext, err := ins.DecryptBySm2(ctx, prikeyPem, cipher)
+		require.NoError(t, err)
+		require.Equal(t, content, plaintext)
+	})
+
+	t.Run("tongsuo key, native verify", func(t *testing.T) {
+		prikeyPem, err := ins.NewPrikey(ctx)
+		require.NoError(t, err)
+		pubkeyPem, err := ins.Prikey2Pubkey(ctx, prikeyPem)
+		require.NoError(t, err)
+
+		sig, err := ins.SignBySm2Sm3(ctx, prikeyPem, content)
+		require.NoError(t, err)
+		require.NoError(t, native.VerifyBySm2Sm3(ctx, pubkeyPem, sig, content))
+
+		cipher, err := ins.EncryptBySm2(ctx, pubkeyPem, content)
+		require.NoError(t, err)
+		plaintext, err := native.DecryptBySm2(ctx, prikeyPem, cipher)
+		require.NoError(t, err)
+		require.Equal(t, content, plaintext)
+	})
+
+	t.Run("sm3 and sm4", func(t *testing.T) {
+		nativeHash, err := native.HashBySm3(ctx, content)
+		require.NoError(t, err)
+		tongsuoHash, err := ins.HashBySm3(ctx, content)
+		require.NoError(t, err)
+		require.Equal(t, tongsuoHash, nativeHash)
+
+		key, err := Salt(SM4KeySize)
+		require.NoError(t, err)
+		combined, err := ins.EncryptBySm4Cbc(ctx, key, content)
+		require.NoError(t, err)
+		plaintext, err := native.DecryptBySm4Cbc(ctx, key, combined)
+		require.NoError(t, err)
+		require.Equal(t, content, plaintext)
+	})
+}
@@ -883,6 +883,9 @@ func (t *Tongsuo) SignBySm2Sm3(ctx context.Context,
 
 // VerifyCertsChain verify certs chain
 //
+// use VerifyChain if you do not need tongsuo, it's pure go
+// and reports structured failures.
+//
 // # Args
 //   - leafCert: leaf cert in PEM
 //   - intermediates: intermediate certs in PEM
@@ -13,6 +13,10 @@
 // least k-1 other parts. This method provides high security, as even if
 // some of the participants are compromised, they will
 // only have access to a partial key, and cannot reconstruct the original secret.
+//
+// SplitVerifiable and CombineVerifiable provide Pedersen verifiable secret sharing,
+// shares can be verified by public commitment, and refreshed by RefreshShares
+// without revealing the secret.
 package shamir
 
 import (
@@ -28,13 +32,8 @@ import (
 //
 // the key and values of members are both important to combine.
 func Split(secret []byte, total, threshold int) (members map[byte][]byte, err error) {
-	switch {
-	case threshold < 2 || threshold >= 256:
-		return nil, errors.Errorf("threshold shoule be in [2, 256) got %d", threshold)
-	case total < 2 || total >= 256:
-		return nil, errors.Errorf("total shoule be in [2, 256) got %d", total)
-	case total <= threshold:
-		return nil, errors.Errorf("total should greater than threshold")
+	if err = checkMembers(total, threshold); err != nil {
+		return nil, err
 	}
 
 	if members, err = shamir.Split(secret, total, threshold); err != nil {
@@ -44,6 +43,20 @@ func Split(secret []byte, total, threshold int) (members map[byte][]byte, err er
 	return members, nil
 }
 
+// checkMembers check total and threshold of members
+func checkMembers(total, threshold int) error {
+	switch {
+	case threshold < 2 || threshold >= 256:
+		return errors.Errorf("threshold shoule be in [2, 256) got %d", threshold)
+	case total < 2 || total >= 256:
+		return errors.Errorf("total shoule be in [2, 256) got %d", total)
+	case total <= threshold:
+		return errors.Errorf("total should greater than threshold")
+	}
+
+	return nil
+}
+
 // Combine is used to reverse a Split and reconstruct a secret
 // once a `threshold` number of parts are available.
 //
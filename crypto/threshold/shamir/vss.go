@@ -0,0 +1,574 @@
+package shamir
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/Laisky/errors/v2"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/group/edwards25519"
+	"go.dedis.ch/kyber/v3/share"
+)
+
+// Pedersen verifiable secret sharing on edwards25519.
+//
+// the dealer publishes commitments a_j*G + b_j*H of the secret polynomial a
+// and a random blinding polynomial b, so every member can verify its share
+// without knowing the secret. commitments are perfectly hiding,
+// so even low-entropy secret can not be brute-forced from them.
+//
+// secret is split into chunks of vssChunkSize bytes,
+// each chunk is shared by an independent polynomial.
+
+const (
+	vssChunkSize  = 31
+	vssScalarSize = 32
+	vssPointSize  = 32
+)
+
+var (
+	vssSuite = edwards25519.NewBlakeSHA256Ed25519()
+	// vssH second generator of Pedersen commitment,
+	// derived by hash so nobody knows its discrete logarithm to G
+	vssH = vssSuite.Point().Pick(vssSuite.XOF([]byte("go-utils shamir pedersen vss H")))
+)
+
+// VerifiableShare share of verifiable secret sharing
+type VerifiableShare struct {
+	index byte
+	// values one value for each chunk of secret
+	values []kyber.Scalar
+	// blinds one value of blinding polynomial for each chunk
+	blinds []kyber.Scalar
+}
+
+// Index index of share, starts from 1
+func (s *VerifiableShare) Index() byte {
+	return s.index
+}
+
+// MarshalBinary serialize share
+func (s *VerifiableShare) MarshalBinary() ([]byte, error) {
+	data := []byte{s.index}
+	data = binary.BigEndian.AppendUint16(data, uint16(len(s.values)))
+	for i := range s.values {
+		data = append(data, vssEncode(s.values[i])...)
+		data = append(data, vssEncode(s.blinds[i])...)
+	}
+
+	return data, nil
+}
+
+// UnmarshalBinary deserialize share
+func (s *VerifiableShare) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return errors.Errorf("data is too short")
+	}
+
+	index := data[0]
+	if index == 0 {
+		return errors.Errorf("index should not be 0")
+	}
+	n := int(binary.BigEndian.Uint16(data[1:]))
+	data = data[3:]
+	if n == 0 || len(data) != 2*n*vssScalarSize {
+		return errors.Errorf("invalid data length")
+	}
+
+	var values, blinds []kyber.Scalar
+	for i := 0; i < n; i++ {
+		offset := 2 * i * vssScalarSize
+		v, err := vssDecodeScalar(data[offset : offset+vssScalarSize])
+		if err != nil {
+			return errors.Wrapf(err, "decode values[%d]", i)
+		}
+		b, err := vssDecodeScalar(data[offset+vssScalarSize : offset+2*vssScalarSize])
+		if err != nil {
+			return errors.Wrapf(err, "decode blinds[%d]", i)
+		}
+
+		values = append(values, v)
+		blinds = append(blinds, b)
+	}
+
+	s.index, s.values, s.blinds = index, values, blinds
+	return nil
+}
+
+// Commitment public commitments of secret polynomials, used to verify shares
+type Commitment struct {
+	secretLen int
+	// commits commitments of coefficients of each chunk's polynomial
+	commits [][]kyber.Point
+}
+
+// Threshold minimum number of shares to combine,
+// return 0 if commitment is empty
+func (c *Commitment) Threshold() int {
+	if len(c.commits) == 0 {
+		return 0
+	}
+
+	return len(c.commits[0])
+}
+
+// check reject empty commitment, like zero value
+func (c *Commitment) check() error {
+	if c == nil || len(c.commits) == 0 || c.Threshold() < 2 {
+		return errors.Errorf("commitment is empty")
+	}
+
+	return nil
+}
+
+// Equal check whether two commitments are the same
+func (c *Commitment) Equal(other *Commitment) bool {
+	if other == nil || c.secretLen != other.secretLen ||
+		len(c.commits) != len(other.commits) || c.Threshold() != other.Threshold() {
+		return false
+	}
+
+	for i := range c.commits {
+		for j := range c.commits[i] {
+			if !c.commits[i][j].Equal(other.commits[i][j]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// sameShape check whether two commitments share the same secret length and threshold
+func (c *Commitment) sameShape(other *Commitment) bool {
+	return other != nil && c.secretLen == other.secretLen &&
+		len(c.commits) == len(other.commits) && c.Threshold() == other.Threshold()
+}
+
+// Verify verify share by commitment
+func (c *Commitment) Verify(s *VerifiableShare) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if s == nil || s.index == 0 {
+		return errors.Errorf("invalid share")
+	}
+	if len(s.values) != len(c.commits) || len(s.blinds) != len(c.commits) {
+		return errors.Errorf("share %d mismatch commitment", s.index)
+	}
+
+	for i := range s.values {
+		// value*G + blind*H should equal to commitment polynomial evaluated at index
+		expect := share.NewPubPoly(vssSuite, nil, c.commits[i]).Eval(int(s.index) - 1).V
+		if !vssPedersen(s.values[i], s.blinds[i]).Equal(expect) {
+			return errors.Errorf("invalid share %d", s.index)
+		}
+	}
+
+	return nil
+}
+
+// MarshalBinary serialize commitment
+func (c *Commitment) MarshalBinary() ([]byte, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+
+	data := binary.BigEndian.AppendUint32(nil, uint32(c.secretLen))
+	data = binary.BigEndian.AppendUint16(data, uint16(c.Threshold()))
+	for _, commits := range c.commits {
+		for _, p := range commits {
+			data = append(data, vssEncode(p)...)
+		}
+	}
+
+	return data, nil
+}
+
+// UnmarshalBinary deserialize commitment
+func (c *Commitment) UnmarshalBinary(data []byte) error {
+	if len(data) < 6 {
+		return errors.Errorf("data is too short")
+	}
+
+	secretLen := int(binary.BigEndian.Uint32(data))
+	threshold := int(binary.BigEndian.Uint16(data[4:]))
+	data = data[6:]
+	if threshold < 2 {
+		return errors.Errorf("threshold should greater than 1")
+	}
+
+	chunks := vssChunks(secretLen)
+	if len(data) != chunks*threshold*vssPointSize {
+		return errors.Errorf("invalid data length")
+	}
+
+	commits := make([][]kyber.Point, chunks)
+	for i := range commits {
+		for j := 0; j < threshold; j++ {
+			offset := (i*threshold + j) * vssPointSize
+			p, err := vssDecodePoint(data[offset : offset+vssPointSize])
+			if err != nil {
+				return errors.Wrapf(err, "decode commits[%d][%d]", i, j)
+			}
+
+			commits[i] = append(commits[i], p)
+		}
+	}
+
+	c.secretLen, c.commits = secretLen, commits
+	return nil
+}
+
+// vssPedersen calculate v*G + b*H
+func vssPedersen(v, b kyber.Scalar) kyber.Point {
+	p := vssSuite.Point().Mul(v, nil)
+	return p.Add(p, vssSuite.Point().Mul(b, vssH))
+}
+
+// newVSSPolys generate secret polynomial and blinding polynomial,
+// return them with their Pedersen commitments.
+//
+// zeroSharing is only used by refresh, both polynomials share zero,
+// otherwise blinding secret is random to keep commitments hiding.
+func newVSSPolys(secret kyber.Scalar, threshold int, zeroSharing bool) (
+	a, b *share.PriPoly, commits []kyber.Point) {
+	var blind kyber.Scalar // random if nil
+	if zeroSharing {
+		secret, blind = vssSuite.Scalar().Zero(), vssSuite.Scalar().Zero()
+	}
+
+	a = share.NewPriPoly(vssSuite, threshold, secret, vssSuite.RandomStream())
+	b = share.NewPriPoly(vssSuite, threshold, blind, vssSuite.RandomStream())
+	_, ac := a.Commit(nil).Info()
+	_, bc := b.Commit(vssH).Info()
+	for j := range ac {
+		commits = append(commits, vssSuite.Point().Add(ac[j], bc[j]))
+	}
+
+	return a, b, commits
+}
+
+func vssEncode(v interface{ MarshalBinary() ([]byte, error) }) []byte {
+	// never fails on edwards25519
+	b, _ := v.MarshalBinary()
+	return b
+}
+
+func vssDecodeScalar(b []byte) (kyber.Scalar, error) {
+	s := vssSuite.Scalar().SetBytes(b)
+	if string(vssEncode(s)) != string(b) {
+		return nil, errors.Errorf("scalar is not canonical")
+	}
+
+	return s, nil
+}
+
+// vssDecodePoint deserialize point, reject points not in prime order subgroup
+func vssDecodePoint(b []byte) (kyber.Point, error) {
+	p := vssSuite.Point()
+	if err := p.UnmarshalBinary(b); err != nil {
+		return nil, errors.Wrap(err, "unmarshal point")
+	}
+	if c, ok := p.(interface{ IsCanonical([]byte) bool }); ok && !c.IsCanonical(b) {
+		return nil, errors.Errorf("point is not canonical")
+	}
+
+	// (L-1)*P + P should be identity
+	lp := vssSuite.Point().Mul(vssSuite.Scalar().SetInt64(-1), p)
+	if !lp.Add(lp, p).Equal(vssSuite.Point().Null()) {
+		return nil, errors.Errorf("point is not in prime order subgroup")
+	}
+
+	return p, nil
+}
+
+// vssChunks number of chunks of secret
+func vssChunks(secretLen int) int {
+	if secretLen == 0 {
+		return 1
+	}
+
+	return (secretLen + vssChunkSize - 1) / vssChunkSize
+}
+
+// SplitVerifiable split secret by Pedersen verifiable secret sharing,
+// generates `total` shares, `threshold` of which are required to reconstruct
+// the secret.
+//
+// commitment should be published to all members to verify their shares.
+func SplitVerifiable(secret []byte, total, threshold int) (
+	shares []*VerifiableShare, commitment *Commitment, err error) {
+	if err = checkMembers(total, threshold); err != nil {
+		return nil, nil, err
+	}
+	if len(secret) > math.MaxUint32 {
+		return nil, nil, errors.Errorf("secret is too long")
+	}
+
+	commitment = &Commitment{secretLen: len(secret)}
+	shares = make([]*VerifiableShare, total)
+	for i := range shares {
+		shares[i] = &VerifiableShare{index: byte(i + 1)}
+	}
+
+	for i := 0; i < vssChunks(len(secret)); i++ {
+		chunk := secret[min(i*vssChunkSize, len(secret)):min((i+1)*vssChunkSize, len(secret))]
+		a, b, commits := newVSSPolys(vssSuite.Scalar().SetBytes(chunk), threshold, false)
+		commitment.commits = append(commitment.commits, commits)
+		blinds := b.Shares(total)
+		for j, s := range a.Shares(total) {
+			shares[j].values = append(shares[j].values, s.V)
+			shares[j].blinds = append(shares[j].blinds, blinds[j].V)
+		}
+	}
+
+	return shares, commitment, nil
+}
+
+// CombineVerifiable verify shares and reconstruct secret
+//
+// return error if any share is invalid, use Commitment.Verify
+// to exclude invalid shares.
+func CombineVerifiable(shares []*VerifiableShare, commitment *Commitment) ([]byte, error) {
+	if err := commitment.check(); err != nil {
+		return nil, err
+	}
+	if len(shares) < commitment.Threshold() {
+		return nil, errors.Errorf("at least %d shares are required, got %d",
+			commitment.Threshold(), len(shares))
+	}
+
+	seen := map[byte]bool{}
+	for _, s := range shares {
+		if err := commitment.Verify(s); err != nil {
+			return nil, err
+		}
+		if seen[s.index] {
+			return nil, errors.Errorf("duplicate share %d", s.index)
+		}
+		seen[s.index] = true
+	}
+
+	var secret []byte
+	for i := range commitment.commits {
+		priShares := make([]*share.PriShare, len(shares))
+		blindShares := make([]*share.PriShare, len(shares))
+		for j, s := range shares {
+			priShares[j] = &share.PriShare{I: int(s.index) - 1, V: s.values[i]}
+			blindShares[j] = &share.PriShare{I: int(s.index) - 1, V: s.blinds[i]}
+		}
+
+		v, err := share.RecoverSecret(vssSuite, priShares, commitment.Threshold(), 256)
+		if err != nil {
+			return nil, errors.Wrapf(err, "recover chunk %d", i)
+		}
+		blind, err := share.RecoverSecret(vssSuite, blindShares, commitment.Threshold(), 256)
+		if err != nil {
+			return nil, errors.Wrapf(err, "recover blind of chunk %d", i)
+		}
+		if !vssPedersen(v, blind).Equal(commitment.commits[i][0]) {
+			return nil, errors.Errorf("chunk %d mismatch commitment", i)
+		}
+
+		chunkLen := min(vssChunkSize, commitment.secretLen-i*vssChunkSize)
+		b := vssEncode(v)
+		for _, c := range b[chunkLen:] {
+			if c != 0 {
+				return nil, errors.Errorf("chunk %d is too long", i)
+			}
+		}
+
+		secret = append(secret, b[:chunkLen]...)
+	}
+
+	return secret, nil
+}
+
+// RefreshDelta contribution of one member to proactive share refresh
+//
+// refresh adds shares of zero to each share, new shares can reconstruct
+// the same secret, but can not be combined with old shares.
+//
+//  1. every member generates RefreshDelta by NewRefreshDelta
+//  2. broadcast delta's commitment, send each sub share to its owner
+//     by confidential channel
+//  3. every member refreshes its share by RefreshShare
+//  4. old shares should be destroyed
+type RefreshDelta struct {
+	commitment *Commitment
+	subShares  []*VerifiableShare
+}
+
+// NewRefreshDelta generate refresh delta for shares with index in [1, total]
+func NewRefreshDelta(commitment *Commitment, total int) (*RefreshDelta, error) {
+	if err := commitment.check(); err != nil {
+		return nil, err
+	}
+	if err := checkMembers(total, commitment.Threshold()); err != nil {
+		return nil, err
+	}
+
+	delta := &RefreshDelta{
+		commitment: &Commitment{secretLen: commitment.secretLen},
+		subShares:  make([]*VerifiableShare, total),
+	}
+	for i := range delta.subShares {
+		delta.subShares[i] = &VerifiableShare{index: byte(i + 1)}
+	}
+
+	for range commitment.commits {
+		a, b, commits := newVSSPolys(nil, commitment.Threshold(), true)
+		delta.commitment.commits = append(delta.commitment.commits, commits)
+		blinds := b.Shares(total)
+		for j, s := range a.Shares(total) {
+			delta.subShares[j].values = append(delta.subShares[j].values, s.V)
+			delta.subShares[j].blinds = append(delta.subShares[j].blinds, blinds[j].V)
+		}
+	}
+
+	return delta, nil
+}
+
+// Commitment public commitment of delta, should be broadcast to all members
+func (d *RefreshDelta) Commitment() *Commitment {
+	return d.commitment
+}
+
+// SubShare sub share for member with index, should be sent to the member secretly
+func (d *RefreshDelta) SubShare(index byte) (*VerifiableShare, error) {
+	if index == 0 || int(index) > len(d.subShares) {
+		return nil, errors.Errorf("index should be in [1, %d]", len(d.subShares))
+	}
+
+	return d.subShares[index-1], nil
+}
+
+// RefreshShare apply deltas of all members to share,
+// return refreshed share and commitment.
+//
+// deltaCommitments[i] is the commitment of the delta that generates subShares[i].
+func RefreshShare(s *VerifiableShare, commitment *Commitment,
+	deltaCommitments []*Commitment, subShares []*VerifiableShare) (
+	newShare *VerifiableShare, newCommitment *Commitment, err error) {
+	if len(deltaCommitments) != len(subShares) {
+		return nil, nil, errors.Errorf("deltaCommitments and subShares should have the same length")
+	}
+	if err = commitment.Verify(s); err != nil {
+		return nil, nil, err
+	}
+
+	newShare = &VerifiableShare{index: s.index}
+	for i := range s.values {
+		newShare.values = append(newShare.values, s.values[i].Clone())
+		newShare.blinds = append(newShare.blinds, s.blinds[i].Clone())
+	}
+	newCommitment = &Commitment{secretLen: commitment.secretLen}
+	for _, commits := range commitment.commits {
+		var cloned []kyber.Point
+		for _, p := range commits {
+			cloned = append(cloned, p.Clone())
+		}
+
+		newCommitment.commits = append(newCommitment.commits, cloned)
+	}
+
+	null := vssSuite.Point().Null()
+	for i, dc := range deltaCommitments {
+		if !commitment.sameShape(dc) {
+			return nil, nil, errors.Errorf("deltaCommitments[%d] mismatch commitment", i)
+		}
+		for _, commits := range dc.commits {
+			if !commits[0].Equal(null) {
+				return nil, nil, errors.Errorf("deltaCommitments[%d] does not share zero", i)
+			}
+		}
+
+		if subShares[i] == nil || subShares[i].index != s.index {
+			return nil, nil, errors.Errorf("subShares[%d] is not for share %d", i, s.index)
+		}
+		if err = dc.Verify(subShares[i]); err != nil {
+			return nil, nil, errors.Wrapf(err, "verify subShares[%d]", i)
+		}
+
+		for j := range newShare.values {
+			newShare.values[j].Add(newShare.values[j], subShares[i].values[j])
+			newShare.blinds[j].Add(newShare.blinds[j], subShares[i].blinds[j])
+			for k := range newCommitment.commits[j] {
+				newCommitment.commits[j][k].Add(newCommitment.commits[j][k], dc.commits[j][k])
+			}
+		}
+	}
+
+	return newShare, newCommitment, nil
+}
+
+// RefreshShares refresh all shares in one process,
+// every share's owner contributes a delta.
+//
+// all `total` shares with index in [1, total] should be provided,
+// otherwise the missing shares would be stale after refresh.
+func RefreshShares(shares []*VerifiableShare, commitment *Commitment, total int) (
+	newShares []*VerifiableShare, newCommitment *Commitment, err error) {
+	if err = commitment.check(); err != nil {
+		return nil, nil, err
+	}
+	if err = checkMembers(total, commitment.Threshold()); err != nil {
+		return nil, nil, err
+	}
+
+	seen := map[byte]bool{}
+	for _, s := range shares {
+		if err = commitment.Verify(s); err != nil {
+			return nil, nil, err
+		}
+		if int(s.index) > total {
+			return nil, nil, errors.Errorf("share %d out of total %d", s.index, total)
+		}
+		if seen[s.index] {
+			return nil, nil, errors.Errorf("duplicate share %d", s.index)
+		}
+		seen[s.index] = true
+	}
+	for i := 1; i <= total; i++ {
+		if !seen[byte(i)] {
+			return nil, nil, errors.Errorf("share %d is missing, all shares should be refreshed", i)
+		}
+	}
+
+	var deltas []*RefreshDelta
+	for i := range shares {
+		delta, err := NewRefreshDelta(commitment, total)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "new refresh delta for shares[%d]", i)
+		}
+
+		deltas = append(deltas, delta)
+	}
+
+	for _, s := range shares {
+		var (
+			deltaCommitments []*Commitment
+			subShares        []*VerifiableShare
+		)
+		for _, delta := range deltas {
+			sub, err := delta.SubShare(s.index)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			deltaCommitments = append(deltaCommitments, delta.Commitment())
+			subShares = append(subShares, sub)
+		}
+
+		newShare, c, err := RefreshShare(s, commitment, deltaCommitments, subShares)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "refresh share %d", s.index)
+		}
+
+		newShares = append(newShares, newShare)
+		newCommitment = c
+	}
+
+	return newShares, newCommitment, nil
+}
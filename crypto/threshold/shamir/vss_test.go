@@ -0,0 +1,291 @@
+package shamir
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+func TestSplitVerifiable(t *testing.T) {
+	t.Parallel()
+
+	for _, secretLen := range []int{0, 1, 31, 32, 62, 1024} {
+		secret := []byte(gutils.RandomStringWithLength(secretLen))
+		total, threshold := 7, 4
+
+		shares, commitment, err := SplitVerifiable(secret, total, threshold)
+		require.NoError(t, err)
+		require.Len(t, shares, total)
+		require.Equal(t, threshold, commitment.Threshold())
+		for i, s := range shares {
+			require.Equal(t, byte(i+1), s.Index())
+			require.NoError(t, commitment.Verify(s))
+		}
+
+		for k := threshold; k <= total; k++ {
+			got, err := CombineVerifiable(gutils.RandomChoice(shares, k), commitment)
+			require.NoError(t, err, secretLen)
+			require.Equal(t, string(secret), string(got))
+		}
+
+		_, err = CombineVerifiable(shares[:threshold-1], commitment)
+		require.ErrorContains(t, err, "at least")
+	}
+
+	_, _, err := SplitVerifiable([]byte("secret"), 3, 3)
+	require.Error(t, err)
+	_, _, err = SplitVerifiable([]byte("secret"), 256, 3)
+	require.Error(t, err)
+	_, _, err = SplitVerifiable([]byte("secret"), 3, 1)
+	require.Error(t, err)
+}
+
+func TestVerifiableShare_corrupted(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte(gutils.RandomStringWithLength(64))
+	shares, commitment, err := SplitVerifiable(secret, 5, 3)
+	require.NoError(t, err)
+
+	// corrupted share
+	corrupted := &VerifiableShare{index: shares[1].index}
+	for i := range shares[1].values {
+		corrupted.values = append(corrupted.values, shares[1].values[i].Clone())
+		corrupted.blinds = append(corrupted.blinds, shares[1].blinds[i].Clone())
+	}
+	corrupted.values[1].Add(corrupted.values[1], vssSuite.Scalar().One())
+	require.ErrorContains(t, commitment.Verify(corrupted), "invalid share 2")
+	_, err = CombineVerifiable([]*VerifiableShare{shares[0], corrupted, shares[2]}, commitment)
+	require.ErrorContains(t, err, "invalid share 2")
+
+	// corrupted blind
+	corrupted.values[1].Sub(corrupted.values[1], vssSuite.Scalar().One())
+	require.NoError(t, commitment.Verify(corrupted))
+	corrupted.blinds[0].Add(corrupted.blinds[0], vssSuite.Scalar().One())
+	require.ErrorContains(t, commitment.Verify(corrupted), "invalid share 2")
+
+	// share of another index
+	moved := &VerifiableShare{index: 4, values: shares[1].values, blinds: shares[1].blinds}
+	require.Error(t, commitment.Verify(moved))
+
+	// share of another secret
+	otherShares, otherCommitment, err := SplitVerifiable(secret, 5, 3)
+	require.NoError(t, err)
+	require.Error(t, commitment.Verify(otherShares[0]))
+	require.False(t, commitment.Equal(otherCommitment))
+
+	require.Error(t, commitment.Verify(&VerifiableShare{index: 1}))
+	require.Error(t, commitment.Verify(nil))
+
+	_, err = CombineVerifiable([]*VerifiableShare{shares[0], shares[0], shares[2]}, commitment)
+	require.ErrorContains(t, err, "duplicate")
+}
+
+func TestVerifiable_Marshal(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte(gutils.RandomStringWithLength(40))
+	shares, commitment, err := SplitVerifiable(secret, 4, 2)
+	require.NoError(t, err)
+
+	data, err := commitment.MarshalBinary()
+	require.NoError(t, err)
+	commitment2 := new(Commitment)
+	require.NoError(t, commitment2.UnmarshalBinary(data))
+	require.True(t, commitment.Equal(commitment2))
+	require.Error(t, new(Commitment).UnmarshalBinary(data[:len(data)-1]))
+	require.Error(t, new(Commitment).UnmarshalBinary(append(data, 0)))
+
+	var restored []*VerifiableShare
+	for _, s := range shares[2:] {
+		data, err := s.MarshalBinary()
+		require.NoError(t, err)
+
+		s2 := new(VerifiableShare)
+		require.NoError(t, s2.UnmarshalBinary(data))
+		require.Equal(t, s.Index(), s2.Index())
+		require.NoError(t, commitment2.Verify(s2))
+		restored = append(restored, s2)
+
+		require.Error(t, new(VerifiableShare).UnmarshalBinary(data[:len(data)-1]))
+		data[len(data)-1] = 0xff
+		require.ErrorContains(t, new(VerifiableShare).UnmarshalBinary(data), "not canonical")
+	}
+
+	got, err := CombineVerifiable(restored, commitment2)
+	require.NoError(t, err)
+	require.Equal(t, secret, got)
+}
+
+func TestRefreshShares(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte(gutils.RandomStringWithLength(100))
+	total, threshold := 5, 3
+	shares, commitment, err := SplitVerifiable(secret, total, threshold)
+	require.NoError(t, err)
+
+	newShares, newCommitment, err := RefreshShares(shares, commitment, total)
+	require.NoError(t, err)
+	require.Len(t, newShares, total)
+	require.False(t, commitment.Equal(newCommitment))
+
+	for i, s := range newShares {
+		require.Equal(t, shares[i].Index(), s.Index())
+		require.NoError(t, newCommitment.Verify(s))
+		require.Error(t, commitment.Verify(s))
+		require.Error(t, newCommitment.Verify(shares[i]))
+	}
+
+	got, err := CombineVerifiable(gutils.RandomChoice(newShares, threshold), newCommitment)
+	require.NoError(t, err)
+	require.Equal(t, secret, got)
+
+	// old shares can not be mixed with new shares
+	_, err = CombineVerifiable([]*VerifiableShare{shares[0], newShares[1], newShares[2]}, newCommitment)
+	require.Error(t, err)
+
+	// refresh again, order of shares does not matter
+	newShares, newCommitment, err = RefreshShares(gutils.RandomChoice(newShares, total), newCommitment, total)
+	require.NoError(t, err)
+	got, err = CombineVerifiable(newShares[:threshold], newCommitment)
+	require.NoError(t, err)
+	require.Equal(t, secret, got)
+
+	// every holder should take part in, otherwise its share would be stale
+	_, _, err = RefreshShares(shares[1:], commitment, total)
+	require.ErrorContains(t, err, "share 1 is missing")
+	_, _, err = RefreshShares(shares[:total-1], commitment, total)
+	require.ErrorContains(t, err, "share 5 is missing")
+	_, _, err = RefreshShares(shares, commitment, total-1)
+	require.ErrorContains(t, err, "out of total")
+	_, _, err = RefreshShares(shares, commitment, threshold-1)
+	require.Error(t, err)
+	_, _, err = RefreshShares(append(shares[:total-1:total-1], shares[0]), commitment, total)
+	require.ErrorContains(t, err, "duplicate")
+	_, _, err = RefreshShares(shares, new(Commitment), total)
+	require.ErrorContains(t, err, "commitment is empty")
+}
+
+func TestCommitment_hiding(t *testing.T) {
+	t.Parallel()
+
+	// the last chunk of 32 bytes secret contains only one byte,
+	// it should not be brute-forced from public commitment.
+	secret := []byte(gutils.RandomStringWithLength(32))
+	_, commitment, err := SplitVerifiable(secret, 5, 3)
+	require.NoError(t, err)
+	require.Len(t, commitment.commits, 2)
+
+	last := commitment.commits[1][0]
+	for v := 0; v < 256; v++ {
+		guess := vssSuite.Scalar().SetBytes([]byte{byte(v)})
+		require.False(t, vssSuite.Point().Mul(guess, nil).Equal(last), "commitment reveals secret")
+	}
+
+	// zero chunk should not be revealed by identity commitment
+	for _, zero := range [][]byte{nil, make([]byte, vssChunkSize)} {
+		shares, commitment, err := SplitVerifiable(zero, 5, 3)
+		require.NoError(t, err)
+		require.False(t, commitment.commits[0][0].Equal(vssSuite.Point().Null()))
+
+		got, err := CombineVerifiable(shares[:3], commitment)
+		require.NoError(t, err)
+		require.Equal(t, len(zero), len(got))
+	}
+
+	// same secret has different commitments
+	_, commitment2, err := SplitVerifiable(secret, 5, 3)
+	require.NoError(t, err)
+	for i := range commitment.commits {
+		require.False(t, commitment.commits[i][0].Equal(commitment2.commits[i][0]))
+	}
+}
+
+func TestCommitment_empty(t *testing.T) {
+	t.Parallel()
+
+	shares, _, err := SplitVerifiable([]byte("secret"), 3, 2)
+	require.NoError(t, err)
+
+	empty := new(Commitment)
+	require.Equal(t, 0, empty.Threshold())
+	require.ErrorContains(t, empty.Verify(shares[0]), "commitment is empty")
+	_, err = CombineVerifiable(shares, empty)
+	require.ErrorContains(t, err, "commitment is empty")
+	_, err = NewRefreshDelta(empty, 3)
+	require.ErrorContains(t, err, "commitment is empty")
+	_, err = empty.MarshalBinary()
+	require.Error(t, err)
+	require.True(t, empty.Equal(new(Commitment)))
+}
+
+func TestRefreshShare_invalid(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	shares, commitment, err := SplitVerifiable(secret, 3, 2)
+	require.NoError(t, err)
+
+	_, err = NewRefreshDelta(commitment, 1)
+	require.Error(t, err)
+	_, err = NewRefreshDelta(commitment, 2)
+	require.Error(t, err)
+	_, err = NewRefreshDelta(commitment, 256)
+	require.Error(t, err)
+	_, _, err = RefreshShares(shares[:2], commitment, 2)
+	require.Error(t, err)
+
+	delta, err := NewRefreshDelta(commitment, 3)
+	require.NoError(t, err)
+	_, err = delta.SubShare(0)
+	require.Error(t, err)
+	_, err = delta.SubShare(4)
+	require.Error(t, err)
+
+	sub1, err := delta.SubShare(1)
+	require.NoError(t, err)
+	sub2, err := delta.SubShare(2)
+	require.NoError(t, err)
+	dc := delta.Commitment()
+
+	_, _, err = RefreshShare(shares[0], commitment, []*Commitment{dc}, nil)
+	require.Error(t, err)
+
+	// sub share for another member
+	_, _, err = RefreshShare(shares[0], commitment, []*Commitment{dc}, []*VerifiableShare{sub2})
+	require.ErrorContains(t, err, "is not for share 1")
+
+	// delta does not share zero, which would change the secret
+	_, evilCommitment, err := SplitVerifiable(secret, 3, 2)
+	require.NoError(t, err)
+	_, _, err = RefreshShare(shares[0], commitment, []*Commitment{evilCommitment}, []*VerifiableShare{sub1})
+	require.ErrorContains(t, err, "does not share zero")
+
+	// delta of another shape
+	_, otherCommitment, err := SplitVerifiable(append(secret, secret...), 3, 2)
+	require.NoError(t, err)
+	_, _, err = RefreshShare(shares[0], commitment, []*Commitment{otherCommitment}, []*VerifiableShare{sub1})
+	require.ErrorContains(t, err, "mismatch commitment")
+
+	// corrupted sub share
+	corrupted := &VerifiableShare{index: 1, values: []kyber.Scalar{
+		vssSuite.Scalar().Add(sub1.values[0], vssSuite.Scalar().One()),
+	}, blinds: sub1.blinds}
+	_, _, err = RefreshShare(shares[0], commitment, []*Commitment{dc}, []*VerifiableShare{corrupted})
+	require.ErrorContains(t, err, "verify subShares[0]")
+
+	// succeed, original share and commitment are not modified
+	oldData, err := shares[0].MarshalBinary()
+	require.NoError(t, err)
+	newShare, newCommitment, err := RefreshShare(shares[0], commitment, []*Commitment{dc}, []*VerifiableShare{sub1})
+	require.NoError(t, err)
+	require.NoError(t, newCommitment.Verify(newShare))
+	require.NoError(t, commitment.Verify(shares[0]))
+	data, err := shares[0].MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, oldData, data)
+}
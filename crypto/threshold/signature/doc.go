@@ -6,6 +6,11 @@
 // This package defines functions and types for creating and verifying threshold signatures,
 // including a struct for specifying and enforcing a minimum threshold signature requirement.
 //
+// Supported schemes:
+//   - threshold RSA: NewKeyShares, SignBySHA256
+//   - FROST(Ed25519, SHA-512): NewFrostKeyShares or FrostDKG, SignByFrost,
+//     signatures are compatible with crypto/ed25519.
+//
 // To prevent private key exposure or signature malleability,
 // this package does not expose raw private keys or signatures.
 package signature
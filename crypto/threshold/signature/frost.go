@@ -0,0 +1,663 @@
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding"
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/Laisky/errors/v2"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/group/edwards25519"
+	"go.dedis.ch/kyber/v3/share"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+// FROST(Ed25519, SHA-512), refer to RFC 9591.
+//
+// signatures generated by FROST are standard Ed25519 signatures,
+// can be verified by crypto/ed25519 or VerifyByFrost.
+
+const (
+	frostContextString = "FROST-ED25519-SHA512-v1"
+	frostIDSize        = 2
+	frostScalarSize    = 32
+	frostPointSize     = 32
+	frostMaxMembers    = math.MaxUint16
+)
+
+var frostSuite = edwards25519.NewBlakeSHA256Ed25519()
+
+// frostDigest hash inputs by sha512,
+// use context string with tag as prefix if tag is not empty.
+func frostDigest(tag string, inputs ...[]byte) []byte {
+	hasher := sha512.New()
+	if tag != "" {
+		hasher.Write([]byte(frostContextString + tag))
+	}
+	for _, in := range inputs {
+		hasher.Write(in)
+	}
+
+	return hasher.Sum(nil)
+}
+
+// frostHash hash inputs to scalar, like frostDigest
+func frostHash(tag string, inputs ...[]byte) kyber.Scalar {
+	return frostSuite.Scalar().SetBytes(frostDigest(tag, inputs...))
+}
+
+// frostEncode serialize scalar or point
+func frostEncode(v encoding.BinaryMarshaler) []byte {
+	// never fails on edwards25519
+	b, _ := v.MarshalBinary()
+	return b
+}
+
+func frostEncodeID(id int) []byte {
+	return frostEncode(frostSuite.Scalar().SetInt64(int64(id)))
+}
+
+func frostDecodeScalar(b []byte) (kyber.Scalar, error) {
+	if len(b) != frostScalarSize {
+		return nil, errors.Errorf("scalar should be %d bytes", frostScalarSize)
+	}
+
+	s := frostSuite.Scalar().SetBytes(b)
+	if string(frostEncode(s)) != string(b) {
+		return nil, errors.Errorf("scalar is not canonical")
+	}
+
+	return s, nil
+}
+
+// frostDecodePoint deserialize point,
+// reject non-canonical, identity and points not in prime order subgroup.
+func frostDecodePoint(b []byte) (kyber.Point, error) {
+	if len(b) != frostPointSize {
+		return nil, errors.Errorf("point should be %d bytes", frostPointSize)
+	}
+
+	p := frostSuite.Point()
+	if err := p.UnmarshalBinary(b); err != nil {
+		return nil, errors.Wrap(err, "unmarshal point")
+	}
+	if c, ok := p.(interface{ IsCanonical([]byte) bool }); ok && !c.IsCanonical(b) {
+		return nil, errors.Errorf("point is not canonical")
+	}
+
+	null := frostSuite.Point().Null()
+	if p.Equal(null) {
+		return nil, errors.Errorf("point should not be identity")
+	}
+
+	// (L-1)*P + P should be identity
+	lp := frostSuite.Point().Mul(frostSuite.Scalar().SetInt64(-1), p)
+	if !lp.Add(lp, p).Equal(null) {
+		return nil, errors.Errorf("point is not in prime order subgroup")
+	}
+
+	return p, nil
+}
+
+func frostCheckMembers(total, threshold int) error {
+	switch {
+	case threshold < 2:
+		return errors.Errorf("threshold should greater than 1")
+	case threshold > total:
+		return errors.Errorf("threshold should not greater than total")
+	case total > frostMaxMembers:
+		return errors.Errorf("total should not greater than %d", frostMaxMembers)
+	}
+
+	return nil
+}
+
+// FrostGroup public information of FROST group,
+// used by coordinator to verify and aggregate signature shares.
+type FrostGroup struct {
+	// commits commitments of secret polynomial,
+	// commits[0] is the group public key
+	commits []kyber.Point
+}
+
+func newFrostGroup(pubPoly *share.PubPoly) *FrostGroup {
+	_, commits := pubPoly.Info()
+	return &FrostGroup{commits: commits}
+}
+
+// Threshold minimum number of signers
+func (g *FrostGroup) Threshold() int {
+	return len(g.commits)
+}
+
+// PublicKey group public key
+func (g *FrostGroup) PublicKey() ed25519.PublicKey {
+	return frostEncode(g.commits[0])
+}
+
+// verifyingShare public key of member
+func (g *FrostGroup) verifyingShare(id int) kyber.Point {
+	return share.NewPubPoly(frostSuite, nil, g.commits).Eval(id - 1).V
+}
+
+// Equal check whether two groups are the same
+func (g *FrostGroup) Equal(other *FrostGroup) bool {
+	if other == nil || len(g.commits) != len(other.commits) {
+		return false
+	}
+
+	for i := range g.commits {
+		if !g.commits[i].Equal(other.commits[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MarshalBinary serialize group
+func (g *FrostGroup) MarshalBinary() ([]byte, error) {
+	data := binary.BigEndian.AppendUint16(nil, uint16(len(g.commits)))
+	for _, c := range g.commits {
+		data = append(data, frostEncode(c)...)
+	}
+
+	return data, nil
+}
+
+// UnmarshalBinary deserialize group
+func (g *FrostGroup) UnmarshalBinary(data []byte) error {
+	commits, rest, err := frostDecodeCommits(data)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.Errorf("unexpected trailing data")
+	}
+
+	g.commits = commits
+	return nil
+}
+
+// frostDecodeCommits decode threshold and commitments of polynomial
+func frostDecodeCommits(data []byte) (commits []kyber.Point, rest []byte, err error) {
+	if len(data) < frostIDSize {
+		return nil, nil, errors.Errorf("data is too short")
+	}
+
+	threshold := int(binary.BigEndian.Uint16(data))
+	data = data[frostIDSize:]
+	if threshold < 2 {
+		return nil, nil, errors.Errorf("threshold should greater than 1")
+	}
+	if len(data) < threshold*frostPointSize {
+		return nil, nil, errors.Errorf("data is too short")
+	}
+
+	for i := 0; i < threshold; i++ {
+		c, err := frostDecodePoint(data[i*frostPointSize : (i+1)*frostPointSize])
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "decode commits[%d]", i)
+		}
+
+		commits = append(commits, c)
+	}
+
+	return commits, data[threshold*frostPointSize:], nil
+}
+
+// FrostKeyShare secret key share of FROST member
+type FrostKeyShare struct {
+	id     int
+	secret kyber.Scalar
+	group  *FrostGroup
+}
+
+// NewFrostKeyShares generate total keyshares by trusted dealer,
+// any members exceed threshold can generate legal signature.
+//
+// the dealer knows the whole private key, use FrostDKG
+// if no single machine should ever hold the key.
+//
+// threshold must in [2, total]
+func NewFrostKeyShares(total, threshold int) (keyShares []*FrostKeyShare, group *FrostGroup, err error) {
+	if err = frostCheckMembers(total, threshold); err != nil {
+		return nil, nil, err
+	}
+
+	priPoly := share.NewPriPoly(frostSuite, threshold, nil, frostSuite.RandomStream())
+	group = newFrostGroup(priPoly.Commit(nil))
+	for _, s := range priPoly.Shares(total) {
+		keyShares = append(keyShares, &FrostKeyShare{
+			id:     s.I + 1,
+			secret: s.V,
+			group:  group,
+		})
+	}
+
+	return keyShares, group, nil
+}
+
+// ID identifier of member, starts from 1
+func (ks *FrostKeyShare) ID() int {
+	return ks.id
+}
+
+// Group public information of group
+func (ks *FrostKeyShare) Group() *FrostGroup {
+	return ks.group
+}
+
+// MarshalBinary serialize key share, the result contains secret
+func (ks *FrostKeyShare) MarshalBinary() ([]byte, error) {
+	group, err := ks.group.MarshalBinary()
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal group")
+	}
+
+	data := binary.BigEndian.AppendUint16(nil, uint16(ks.id))
+	data = append(data, frostEncode(ks.secret)...)
+	return append(data, group...), nil
+}
+
+// UnmarshalBinary deserialize key share
+func (ks *FrostKeyShare) UnmarshalBinary(data []byte) error {
+	if len(data) < frostIDSize+frostScalarSize {
+		return errors.Errorf("data is too short")
+	}
+
+	id := int(binary.BigEndian.Uint16(data))
+	if id == 0 {
+		return errors.Errorf("id should not be 0")
+	}
+	secret, err := frostDecodeScalar(data[frostIDSize : frostIDSize+frostScalarSize])
+	if err != nil {
+		return errors.Wrap(err, "decode secret")
+	}
+
+	group := new(FrostGroup)
+	if err = group.UnmarshalBinary(data[frostIDSize+frostScalarSize:]); err != nil {
+		return errors.Wrap(err, "unmarshal group")
+	}
+	if !frostSuite.Point().Mul(secret, nil).Equal(group.verifyingShare(id)) {
+		return errors.Errorf("secret mismatch group")
+	}
+
+	ks.id, ks.secret, ks.group = id, secret, group
+	return nil
+}
+
+// FrostNonce secret nonce of signing round one,
+// should be kept by member and can only be used once.
+type FrostNonce struct {
+	id              int
+	hiding, binding kyber.Scalar
+	used            bool
+}
+
+// FrostCommitment commitment of nonce, should be sent to coordinator
+type FrostCommitment struct {
+	id              int
+	hiding, binding kyber.Point
+}
+
+// ID identifier of member
+func (c *FrostCommitment) ID() int {
+	return c.id
+}
+
+// MarshalBinary serialize commitment
+func (c *FrostCommitment) MarshalBinary() ([]byte, error) {
+	data := binary.BigEndian.AppendUint16(nil, uint16(c.id))
+	data = append(data, frostEncode(c.hiding)...)
+	return append(data, frostEncode(c.binding)...), nil
+}
+
+// UnmarshalBinary deserialize commitment
+func (c *FrostCommitment) UnmarshalBinary(data []byte) (err error) {
+	if len(data) != frostIDSize+2*frostPointSize {
+		return errors.Errorf("invalid data length")
+	}
+
+	id := int(binary.BigEndian.Uint16(data))
+	if id == 0 {
+		return errors.Errorf("id should not be 0")
+	}
+	hiding, err := frostDecodePoint(data[frostIDSize : frostIDSize+frostPointSize])
+	if err != nil {
+		return errors.Wrap(err, "decode hiding commitment")
+	}
+	binding, err := frostDecodePoint(data[frostIDSize+frostPointSize:])
+	if err != nil {
+		return errors.Wrap(err, "decode binding commitment")
+	}
+
+	c.id, c.hiding, c.binding = id, hiding, binding
+	return nil
+}
+
+// FrostSignatureShare signature share of member, should be sent to coordinator
+type FrostSignatureShare struct {
+	id int
+	z  kyber.Scalar
+}
+
+// ID identifier of member
+func (s *FrostSignatureShare) ID() int {
+	return s.id
+}
+
+// MarshalBinary serialize signature share
+func (s *FrostSignatureShare) MarshalBinary() ([]byte, error) {
+	data := binary.BigEndian.AppendUint16(nil, uint16(s.id))
+	return append(data, frostEncode(s.z)...), nil
+}
+
+// UnmarshalBinary deserialize signature share
+func (s *FrostSignatureShare) UnmarshalBinary(data []byte) error {
+	if len(data) != frostIDSize+frostScalarSize {
+		return errors.Errorf("invalid data length")
+	}
+
+	id := int(binary.BigEndian.Uint16(data))
+	if id == 0 {
+		return errors.Errorf("id should not be 0")
+	}
+	z, err := frostDecodeScalar(data[frostIDSize:])
+	if err != nil {
+		return errors.Wrap(err, "decode signature share")
+	}
+
+	s.id, s.z = id, z
+	return nil
+}
+
+// Commit signing round one, generate nonce and its commitment.
+//
+// nonce should be kept secret, commitment should be sent to coordinator.
+func (ks *FrostKeyShare) Commit() (*FrostNonce, *FrostCommitment, error) {
+	random, err := gutils.SecRandomBytesWithLength(64)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "generate random bytes")
+	}
+
+	nonce, commitment := ks.commitByRandom(random[:32], random[32:])
+	return nonce, commitment, nil
+}
+
+// commitByRandom generate nonce by nonce_generate in RFC 9591
+func (ks *FrostKeyShare) commitByRandom(hidingRandom, bindingRandom []byte) (*FrostNonce, *FrostCommitment) {
+	hiding := frostHash("nonce", hidingRandom, frostEncode(ks.secret))
+	binding := frostHash("nonce", bindingRandom, frostEncode(ks.secret))
+	return &FrostNonce{
+		id:      ks.id,
+		hiding:  hiding,
+		binding: binding,
+	}, &FrostCommitment{
+		id:      ks.id,
+		hiding:  frostSuite.Point().Mul(hiding, nil),
+		binding: frostSuite.Point().Mul(binding, nil),
+	}
+}
+
+// frostSigningPackage commitments and derived values of one signing session
+type frostSigningPackage struct {
+	commitments    []*FrostCommitment
+	bindingFactors map[int]kyber.Scalar
+	groupCommit    kyber.Point
+	challenge      kyber.Scalar
+}
+
+// newFrostSigningPackage validate commitments and compute binding factors,
+// group commitment and challenge.
+func (g *FrostGroup) newFrostSigningPackage(content []byte,
+	commitments []*FrostCommitment) (*frostSigningPackage, error) {
+	if len(commitments) < g.Threshold() {
+		return nil, errors.Errorf("at least %d commitments are required, got %d",
+			g.Threshold(), len(commitments))
+	}
+
+	for _, c := range commitments {
+		if c == nil || c.id < 1 {
+			return nil, errors.Errorf("invalid commitment")
+		}
+	}
+
+	commitments = append([]*FrostCommitment{}, commitments...)
+	sort.Slice(commitments, func(i, j int) bool {
+		return commitments[i].id < commitments[j].id
+	})
+
+	var encodedCommitments []byte
+	for i, c := range commitments {
+		if i > 0 && commitments[i-1].id == c.id {
+			return nil, errors.Errorf("duplicate commitment of member %d", c.id)
+		}
+
+		encodedCommitments = append(encodedCommitments, frostEncodeID(c.id)...)
+		encodedCommitments = append(encodedCommitments, frostEncode(c.hiding)...)
+		encodedCommitments = append(encodedCommitments, frostEncode(c.binding)...)
+	}
+
+	pubkey := g.PublicKey()
+	rhoPrefix := append([]byte{}, pubkey...)
+	rhoPrefix = append(rhoPrefix, frostDigest("msg", content)...)
+	rhoPrefix = append(rhoPrefix, frostDigest("com", encodedCommitments)...)
+
+	pkg := &frostSigningPackage{
+		commitments:    commitments,
+		bindingFactors: make(map[int]kyber.Scalar, len(commitments)),
+		groupCommit:    frostSuite.Point().Null(),
+	}
+	for _, c := range commitments {
+		rho := frostHash("rho", rhoPrefix, frostEncodeID(c.id))
+		pkg.bindingFactors[c.id] = rho
+		pkg.groupCommit.Add(pkg.groupCommit, c.hiding)
+		pkg.groupCommit.Add(pkg.groupCommit, frostSuite.Point().Mul(rho, c.binding))
+	}
+
+	pkg.challenge = frostHash("", frostEncode(pkg.groupCommit), pubkey, content)
+	return pkg, nil
+}
+
+// lagrange interpolating value of member id
+func (pkg *frostSigningPackage) lagrange(id int) kyber.Scalar {
+	num, den := frostSuite.Scalar().One(), frostSuite.Scalar().One()
+	xi := frostSuite.Scalar().SetInt64(int64(id))
+	for _, c := range pkg.commitments {
+		if c.id == id {
+			continue
+		}
+
+		xj := frostSuite.Scalar().SetInt64(int64(c.id))
+		num.Mul(num, xj)
+		den.Mul(den, frostSuite.Scalar().Sub(xj, xi))
+	}
+
+	return num.Div(num, den)
+}
+
+// commitment find commitment of member id
+func (pkg *frostSigningPackage) commitment(id int) *FrostCommitment {
+	i := sort.Search(len(pkg.commitments), func(i int) bool {
+		return pkg.commitments[i].id >= id
+	})
+	if i < len(pkg.commitments) && pkg.commitments[i].id == id {
+		return pkg.commitments[i]
+	}
+
+	return nil
+}
+
+// Sign signing round two, generate signature share.
+//
+// commitments are collected by coordinator from all signers in this session,
+// nonce will be erased after signing.
+func (ks *FrostKeyShare) Sign(content []byte,
+	nonce *FrostNonce, commitments []*FrostCommitment) (*FrostSignatureShare, error) {
+	switch {
+	case nonce == nil || nonce.used:
+		return nil, errors.Errorf("nonce should not be reused")
+	case nonce.id != ks.id:
+		return nil, errors.Errorf("nonce does not belong to member %d", ks.id)
+	}
+
+	pkg, err := ks.group.newFrostSigningPackage(content, commitments)
+	if err != nil {
+		return nil, err
+	}
+
+	c := pkg.commitment(ks.id)
+	if c == nil {
+		return nil, errors.Errorf("missing commitment of member %d", ks.id)
+	}
+	if !c.hiding.Equal(frostSuite.Point().Mul(nonce.hiding, nil)) ||
+		!c.binding.Equal(frostSuite.Point().Mul(nonce.binding, nil)) {
+		return nil, errors.Errorf("commitment mismatch nonce")
+	}
+
+	// z = hiding + binding * rho + lambda * secret * challenge
+	z := frostSuite.Scalar().Mul(nonce.binding, pkg.bindingFactors[ks.id])
+	z.Add(z, nonce.hiding)
+	lsc := frostSuite.Scalar().Mul(pkg.lagrange(ks.id), ks.secret)
+	z.Add(z, lsc.Mul(lsc, pkg.challenge))
+
+	nonce.hiding.Zero()
+	nonce.binding.Zero()
+	nonce.used = true
+
+	return &FrostSignatureShare{id: ks.id, z: z}, nil
+}
+
+// verifySignatureShare verify signature share of member
+func (g *FrostGroup) verifySignatureShare(pkg *frostSigningPackage, sigShare *FrostSignatureShare) error {
+	c := pkg.commitment(sigShare.id)
+	if c == nil {
+		return errors.Errorf("missing commitment of member %d", sigShare.id)
+	}
+
+	// G * z == hiding + binding * rho + verifyingShare * (challenge * lambda)
+	commitShare := frostSuite.Point().Mul(pkg.bindingFactors[sigShare.id], c.binding)
+	commitShare.Add(commitShare, c.hiding)
+	cl := frostSuite.Scalar().Mul(pkg.challenge, pkg.lagrange(sigShare.id))
+	expected := frostSuite.Point().Mul(cl, g.verifyingShare(sigShare.id))
+	expected.Add(expected, commitShare)
+
+	if !frostSuite.Point().Mul(sigShare.z, nil).Equal(expected) {
+		return errors.Errorf("invalid signature share of member %d", sigShare.id)
+	}
+
+	return nil
+}
+
+// VerifySignatureShare verify signature share of member,
+// could be used to identify misbehaving member.
+func (g *FrostGroup) VerifySignatureShare(content []byte,
+	commitments []*FrostCommitment, sigShare *FrostSignatureShare) error {
+	pkg, err := g.newFrostSigningPackage(content, commitments)
+	if err != nil {
+		return err
+	}
+
+	return g.verifySignatureShare(pkg, sigShare)
+}
+
+// Aggregate aggregate signature shares to Ed25519 signature
+//
+// every member in commitments should provide its signature share.
+func (g *FrostGroup) Aggregate(content []byte,
+	commitments []*FrostCommitment, sigShares []*FrostSignatureShare) (signature []byte, err error) {
+	pkg, err := g.newFrostSigningPackage(content, commitments)
+	if err != nil {
+		return nil, err
+	}
+	if len(sigShares) != len(pkg.commitments) {
+		return nil, errors.Errorf("got %d signature shares, but %d commitments",
+			len(sigShares), len(pkg.commitments))
+	}
+
+	z := frostSuite.Scalar().Zero()
+	seen := map[int]bool{}
+	for _, s := range sigShares {
+		if s == nil {
+			return nil, errors.Errorf("invalid signature share")
+		}
+		if seen[s.id] {
+			return nil, errors.Errorf("duplicate signature share of member %d", s.id)
+		}
+		seen[s.id] = true
+
+		if err = g.verifySignatureShare(pkg, s); err != nil {
+			return nil, err
+		}
+
+		z.Add(z, s.z)
+	}
+
+	signature = append(frostEncode(pkg.groupCommit), frostEncode(z)...)
+	if err = VerifyByFrost(g.PublicKey(), content, signature); err != nil {
+		return nil, errors.Wrap(err, "verify aggregated signature")
+	}
+
+	return signature, nil
+}
+
+// SignByFrost generate signature by threshold members in one process,
+// run both signing rounds and aggregate signature shares.
+func SignByFrost(content []byte, keyShares []*FrostKeyShare) (signature []byte, err error) {
+	if len(keyShares) == 0 {
+		return nil, errors.Errorf("key shares should not be empty")
+	}
+
+	var (
+		nonces      []*FrostNonce
+		commitments []*FrostCommitment
+	)
+	for i, ks := range keyShares {
+		if !ks.group.Equal(keyShares[0].group) {
+			return nil, errors.Errorf("keyShares[%d] belongs to another group", i)
+		}
+
+		nonce, commitment, err := ks.Commit()
+		if err != nil {
+			return nil, errors.Wrapf(err, "commit by keyShares[%d]", i)
+		}
+
+		nonces = append(nonces, nonce)
+		commitments = append(commitments, commitment)
+	}
+
+	var sigShares []*FrostSignatureShare
+	for i, ks := range keyShares {
+		sigShare, err := ks.Sign(content, nonces[i], commitments)
+		if err != nil {
+			return nil, errors.Wrapf(err, "sign by keyShares[%d]", i)
+		}
+
+		sigShares = append(sigShares, sigShare)
+	}
+
+	signature, err = keyShares[0].group.Aggregate(content, commitments, sigShares)
+	if err != nil {
+		return nil, errors.Wrap(err, "aggregate signature")
+	}
+
+	return signature, nil
+}
+
+// VerifyByFrost verify signature by group public key,
+// equivalent to ed25519.Verify.
+func VerifyByFrost(pubkey ed25519.PublicKey, content []byte, signature []byte) error {
+	if len(pubkey) != ed25519.PublicKeySize {
+		return errors.Errorf("invalid public key size")
+	}
+	if !ed25519.Verify(pubkey, content, signature) {
+		return errors.Errorf("invalid signature")
+	}
+
+	return nil
+}
@@ -0,0 +1,280 @@
+package signature
+
+import (
+	"encoding/binary"
+
+	"github.com/Laisky/errors/v2"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/share"
+)
+
+// FrostDKG distributed key generation of FROST,
+// refer to Figure 1 of https://eprint.iacr.org/2020/852.pdf.
+//
+// every member runs its own FrostDKG, no one knows the whole private key:
+//
+//  1. NewFrostDKG generates round one package, broadcast it to all other members
+//  2. Round2 verifies round one packages of others, generates round two packages,
+//     send each package to its receiver by confidential channel
+//  3. Finish verifies round two packages received, generates key share
+type FrostDKG struct {
+	id, total int
+	session   []byte
+	priPoly   *share.PriPoly
+	// peers verified commitments of other members
+	peers map[int]*share.PubPoly
+	done  bool
+}
+
+// FrostDKGRound1 round one package, should be broadcast to all members
+type FrostDKGRound1 struct {
+	id      int
+	commits []kyber.Point
+	// proof of knowledge of secret
+	r  kyber.Point
+	mu kyber.Scalar
+}
+
+// FrostDKGRound2 round two package, contains secret share,
+// should be sent to receiver by confidential channel.
+type FrostDKGRound2 struct {
+	from, to int
+	share    kyber.Scalar
+}
+
+// frostDKGChallenge challenge of proof of knowledge,
+// bound to session to prevent replay in other sessions.
+func frostDKGChallenge(session []byte, id int, secretCommit, r kyber.Point) kyber.Scalar {
+	return frostHash("dkg", frostEncodeID(id), frostEncode(secretCommit), frostEncode(r), session)
+}
+
+// NewFrostDKG start distributed key generation
+//
+// # Args
+//   - session: context of this run, all members should use the same one,
+//     should be unique for each run, like a random session id agreed by members
+//   - id: identifier of this member, in [1, total]
+//   - total: number of members
+//   - threshold: minimum number of signers, in [2, total]
+func NewFrostDKG(session []byte, id, total, threshold int) (*FrostDKG, *FrostDKGRound1, error) {
+	if len(session) == 0 {
+		return nil, nil, errors.Errorf("session should not be empty")
+	}
+	if err := frostCheckMembers(total, threshold); err != nil {
+		return nil, nil, err
+	}
+	if id < 1 || id > total {
+		return nil, nil, errors.Errorf("id should be in [1, %d]", total)
+	}
+	session = append([]byte{}, session...)
+
+	priPoly := share.NewPriPoly(frostSuite, threshold, nil, frostSuite.RandomStream())
+	_, commits := priPoly.Commit(nil).Info()
+
+	// mu = k + secret * challenge
+	k := frostSuite.Scalar().Pick(frostSuite.RandomStream())
+	r := frostSuite.Point().Mul(k, nil)
+	mu := frostSuite.Scalar().Mul(priPoly.Secret(), frostDKGChallenge(session, id, commits[0], r))
+	mu.Add(mu, k)
+
+	return &FrostDKG{
+		id:      id,
+		total:   total,
+		session: session,
+		priPoly: priPoly,
+	}, &FrostDKGRound1{
+		id:      id,
+		commits: commits,
+		r:       r,
+		mu:      mu,
+	}, nil
+}
+
+// Round2 verify round one packages of all other members,
+// return round two packages for each other member.
+func (d *FrostDKG) Round2(round1 []*FrostDKGRound1) ([]*FrostDKGRound2, error) {
+	if d.peers != nil {
+		return nil, errors.Errorf("round two has already been run")
+	}
+
+	peers := map[int]*share.PubPoly{}
+	for _, pkg := range round1 {
+		switch {
+		case pkg == nil:
+			return nil, errors.Errorf("invalid round one package")
+		case pkg.id == d.id:
+			continue
+		case pkg.id < 1 || pkg.id > d.total:
+			return nil, errors.Errorf("unknown member %d", pkg.id)
+		case peers[pkg.id] != nil:
+			return nil, errors.Errorf("duplicate round one package of member %d", pkg.id)
+		case len(pkg.commits) != d.priPoly.Threshold():
+			return nil, errors.Errorf("threshold of member %d mismatch", pkg.id)
+		}
+
+		// G * mu == R + commits[0] * challenge
+		expected := frostSuite.Point().Mul(frostDKGChallenge(d.session, pkg.id, pkg.commits[0], pkg.r), pkg.commits[0])
+		expected.Add(expected, pkg.r)
+		if !frostSuite.Point().Mul(pkg.mu, nil).Equal(expected) {
+			return nil, errors.Errorf("invalid proof of knowledge of member %d", pkg.id)
+		}
+
+		peers[pkg.id] = share.NewPubPoly(frostSuite, nil, pkg.commits)
+	}
+	if len(peers) != d.total-1 {
+		return nil, errors.Errorf("need round one packages of %d members, got %d",
+			d.total-1, len(peers))
+	}
+
+	d.peers = peers
+	var pkgs []*FrostDKGRound2
+	for id := 1; id <= d.total; id++ {
+		if id == d.id {
+			continue
+		}
+
+		pkgs = append(pkgs, &FrostDKGRound2{
+			from:  d.id,
+			to:    id,
+			share: d.priPoly.Eval(id - 1).V,
+		})
+	}
+
+	return pkgs, nil
+}
+
+// Finish verify round two packages sent to this member, return key share.
+func (d *FrostDKG) Finish(round2 []*FrostDKGRound2) (*FrostKeyShare, error) {
+	switch {
+	case d.peers == nil:
+		return nil, errors.Errorf("round two should be run before finish")
+	case d.done:
+		return nil, errors.Errorf("dkg has already finished")
+	}
+
+	secret := d.priPoly.Eval(d.id - 1).V
+	pubPoly := d.priPoly.Commit(nil)
+	seen := map[int]bool{}
+	for _, pkg := range round2 {
+		if pkg == nil {
+			return nil, errors.Errorf("invalid round two package")
+		}
+		if pkg.to != d.id {
+			return nil, errors.Errorf("round two package from member %d is not sent to %d", pkg.from, d.id)
+		}
+
+		peer, ok := d.peers[pkg.from]
+		if !ok {
+			return nil, errors.Errorf("unknown member %d", pkg.from)
+		}
+		if seen[pkg.from] {
+			return nil, errors.Errorf("duplicate round two package of member %d", pkg.from)
+		}
+		seen[pkg.from] = true
+
+		if !peer.Check(&share.PriShare{I: d.id - 1, V: pkg.share}) {
+			return nil, errors.Errorf("invalid secret share from member %d", pkg.from)
+		}
+
+		secret.Add(secret, pkg.share)
+		var err error
+		if pubPoly, err = pubPoly.Add(peer); err != nil {
+			return nil, errors.Wrapf(err, "add commitments of member %d", pkg.from)
+		}
+	}
+	if len(seen) != len(d.peers) {
+		return nil, errors.Errorf("need round two packages of %d members, got %d",
+			len(d.peers), len(seen))
+	}
+
+	d.done = true
+	return &FrostKeyShare{
+		id:     d.id,
+		secret: secret,
+		group:  newFrostGroup(pubPoly),
+	}, nil
+}
+
+// ID identifier of sender
+func (p *FrostDKGRound1) ID() int {
+	return p.id
+}
+
+// MarshalBinary serialize round one package
+func (p *FrostDKGRound1) MarshalBinary() ([]byte, error) {
+	data := binary.BigEndian.AppendUint16(nil, uint16(p.id))
+	data = binary.BigEndian.AppendUint16(data, uint16(len(p.commits)))
+	for _, c := range p.commits {
+		data = append(data, frostEncode(c)...)
+	}
+	data = append(data, frostEncode(p.r)...)
+	return append(data, frostEncode(p.mu)...), nil
+}
+
+// UnmarshalBinary deserialize round one package
+func (p *FrostDKGRound1) UnmarshalBinary(data []byte) error {
+	if len(data) < frostIDSize {
+		return errors.Errorf("data is too short")
+	}
+
+	id := int(binary.BigEndian.Uint16(data))
+	if id == 0 {
+		return errors.Errorf("id should not be 0")
+	}
+	commits, rest, err := frostDecodeCommits(data[frostIDSize:])
+	if err != nil {
+		return errors.Wrap(err, "decode commits")
+	}
+	if len(rest) != frostPointSize+frostScalarSize {
+		return errors.Errorf("invalid data length")
+	}
+
+	r, err := frostDecodePoint(rest[:frostPointSize])
+	if err != nil {
+		return errors.Wrap(err, "decode r")
+	}
+	mu, err := frostDecodeScalar(rest[frostPointSize:])
+	if err != nil {
+		return errors.Wrap(err, "decode mu")
+	}
+
+	p.id, p.commits, p.r, p.mu = id, commits, r, mu
+	return nil
+}
+
+// From identifier of sender
+func (p *FrostDKGRound2) From() int {
+	return p.from
+}
+
+// To identifier of receiver
+func (p *FrostDKGRound2) To() int {
+	return p.to
+}
+
+// MarshalBinary serialize round two package, the result contains secret
+func (p *FrostDKGRound2) MarshalBinary() ([]byte, error) {
+	data := binary.BigEndian.AppendUint16(nil, uint16(p.from))
+	data = binary.BigEndian.AppendUint16(data, uint16(p.to))
+	return append(data, frostEncode(p.share)...), nil
+}
+
+// UnmarshalBinary deserialize round two package
+func (p *FrostDKGRound2) UnmarshalBinary(data []byte) error {
+	if len(data) != 2*frostIDSize+frostScalarSize {
+		return errors.Errorf("invalid data length")
+	}
+
+	from := int(binary.BigEndian.Uint16(data))
+	to := int(binary.BigEndian.Uint16(data[frostIDSize:]))
+	if from == 0 || to == 0 {
+		return errors.Errorf("id should not be 0")
+	}
+	s, err := frostDecodeScalar(data[2*frostIDSize:])
+	if err != nil {
+		return errors.Wrap(err, "decode share")
+	}
+
+	p.from, p.to, p.share = from, to, s
+	return nil
+}
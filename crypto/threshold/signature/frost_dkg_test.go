@@ -0,0 +1,213 @@
+package signature
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+var testFrostSession = []byte("frost dkg test session")
+
+// runFrostDKG run dkg among total members, return key shares
+func runFrostDKG(t *testing.T, total, threshold int) []*FrostKeyShare {
+	t.Helper()
+
+	var (
+		dkgs   []*FrostDKG
+		round1 []*FrostDKGRound1
+	)
+	for id := 1; id <= total; id++ {
+		dkg, pkg, err := NewFrostDKG(testFrostSession, id, total, threshold)
+		require.NoError(t, err)
+		require.Equal(t, id, pkg.ID())
+		dkgs = append(dkgs, dkg)
+		round1 = append(round1, pkg)
+	}
+
+	received := map[int][]*FrostDKGRound2{}
+	for _, dkg := range dkgs {
+		pkgs, err := dkg.Round2(round1)
+		require.NoError(t, err)
+		require.Len(t, pkgs, total-1)
+
+		for _, pkg := range pkgs {
+			received[pkg.To()] = append(received[pkg.To()], pkg)
+		}
+	}
+
+	var keyShares []*FrostKeyShare
+	for i, dkg := range dkgs {
+		ks, err := dkg.Finish(received[i+1])
+		require.NoError(t, err)
+		require.Equal(t, i+1, ks.ID())
+		keyShares = append(keyShares, ks)
+	}
+
+	return keyShares
+}
+
+func TestFrostDKG(t *testing.T) {
+	t.Parallel()
+
+	total, threshold := 5, 3
+	keyShares := runFrostDKG(t, total, threshold)
+
+	group := keyShares[0].Group()
+	require.Equal(t, threshold, group.Threshold())
+	for _, ks := range keyShares {
+		require.True(t, group.Equal(ks.Group()))
+		require.True(t, frostSuite.Point().Mul(ks.secret, nil).Equal(group.verifyingShare(ks.ID())))
+	}
+
+	content := []byte(gutils.RandomStringWithLength(1024))
+	for n := threshold; n <= total; n++ {
+		sig, err := SignByFrost(content, gutils.RandomChoice(keyShares, n))
+		require.NoError(t, err)
+		require.NoError(t, VerifyByFrost(group.PublicKey(), content, sig))
+	}
+
+	_, err := SignByFrost(content, keyShares[:threshold-1])
+	require.Error(t, err)
+}
+
+func TestFrostDKG_invalid(t *testing.T) {
+	t.Parallel()
+
+	_, _, err := NewFrostDKG(testFrostSession, 0, 3, 2)
+	require.Error(t, err)
+	_, _, err = NewFrostDKG(testFrostSession, 4, 3, 2)
+	require.Error(t, err)
+	_, _, err = NewFrostDKG(testFrostSession, 1, 3, 4)
+	require.Error(t, err)
+	_, _, err = NewFrostDKG(nil, 1, 3, 2)
+	require.ErrorContains(t, err, "session should not be empty")
+
+	newRound1 := func() ([]*FrostDKG, []*FrostDKGRound1) {
+		var (
+			dkgs   []*FrostDKG
+			round1 []*FrostDKGRound1
+		)
+		for id := 1; id <= 3; id++ {
+			dkg, pkg, err := NewFrostDKG(testFrostSession, id, 3, 2)
+			require.NoError(t, err)
+			dkgs = append(dkgs, dkg)
+			round1 = append(round1, pkg)
+		}
+
+		return dkgs, round1
+	}
+
+	t.Run("round1", func(t *testing.T) {
+		dkgs, round1 := newRound1()
+
+		_, err := dkgs[0].Round2(round1[:2])
+		require.ErrorContains(t, err, "need round one packages")
+		_, err = dkgs[0].Round2(append(round1, round1[1]))
+		require.ErrorContains(t, err, "duplicate")
+		_, err = dkgs[0].Round2([]*FrostDKGRound1{round1[1], nil})
+		require.Error(t, err)
+
+		// invalid proof of knowledge
+		forged := *round1[1]
+		forged.mu = frostSuite.Scalar().Add(forged.mu, frostSuite.Scalar().One())
+		_, err = dkgs[0].Round2([]*FrostDKGRound1{&forged, round1[2]})
+		require.ErrorContains(t, err, "invalid proof of knowledge of member 2")
+
+		// proof of knowledge is bound to sender
+		forged = *round1[1]
+		forged.id = 3
+		_, err = dkgs[0].Round2([]*FrostDKGRound1{&forged, round1[1]})
+		require.ErrorContains(t, err, "invalid proof of knowledge")
+
+		// proof of knowledge is bound to session
+		_, replayed, err := NewFrostDKG([]byte("other session"), 2, 3, 2)
+		require.NoError(t, err)
+		_, err = dkgs[0].Round2([]*FrostDKGRound1{replayed, round1[2]})
+		require.ErrorContains(t, err, "invalid proof of knowledge of member 2")
+
+		// threshold mismatch
+		_, other, err := NewFrostDKG(testFrostSession, 2, 3, 3)
+		require.NoError(t, err)
+		_, err = dkgs[0].Round2([]*FrostDKGRound1{other, round1[2]})
+		require.ErrorContains(t, err, "threshold of member 2 mismatch")
+
+		_, err = dkgs[0].Finish(nil)
+		require.ErrorContains(t, err, "round two should be run")
+
+		_, err = dkgs[0].Round2(round1)
+		require.NoError(t, err)
+		_, err = dkgs[0].Round2(round1)
+		require.ErrorContains(t, err, "already")
+	})
+
+	t.Run("round2", func(t *testing.T) {
+		dkgs, round1 := newRound1()
+		var pkgs [][]*FrostDKGRound2
+		for _, dkg := range dkgs {
+			p, err := dkg.Round2(round1)
+			require.NoError(t, err)
+			pkgs = append(pkgs, p)
+		}
+
+		// pkgs[1][0] from 2 to 1, pkgs[2][0] from 3 to 1
+		_, err := dkgs[0].Finish(pkgs[1][:1])
+		require.ErrorContains(t, err, "need round two packages")
+		_, err = dkgs[0].Finish([]*FrostDKGRound2{pkgs[1][0], pkgs[1][0]})
+		require.ErrorContains(t, err, "duplicate")
+		_, err = dkgs[0].Finish([]*FrostDKGRound2{pkgs[1][0], pkgs[2][1]})
+		require.ErrorContains(t, err, "is not sent to 1")
+
+		forged := *pkgs[1][0]
+		forged.share = frostSuite.Scalar().Add(forged.share, frostSuite.Scalar().One())
+		_, err = dkgs[0].Finish([]*FrostDKGRound2{&forged, pkgs[2][0]})
+		require.ErrorContains(t, err, "invalid secret share from member 2")
+
+		ks, err := dkgs[0].Finish([]*FrostDKGRound2{pkgs[1][0], pkgs[2][0]})
+		require.NoError(t, err)
+		require.Equal(t, 1, ks.ID())
+		_, err = dkgs[0].Finish([]*FrostDKGRound2{pkgs[1][0], pkgs[2][0]})
+		require.ErrorContains(t, err, "already finished")
+	})
+}
+
+func TestFrostDKG_Marshal(t *testing.T) {
+	t.Parallel()
+
+	dkg1, pkg1, err := NewFrostDKG(testFrostSession, 1, 2, 2)
+	require.NoError(t, err)
+	dkg2, pkg2, err := NewFrostDKG(testFrostSession, 2, 2, 2)
+	require.NoError(t, err)
+
+	// round one
+	data, err := pkg2.MarshalBinary()
+	require.NoError(t, err)
+	restored1 := new(FrostDKGRound1)
+	require.NoError(t, restored1.UnmarshalBinary(data))
+	require.Error(t, new(FrostDKGRound1).UnmarshalBinary(data[:len(data)-1]))
+
+	toDKG2, err := dkg1.Round2([]*FrostDKGRound1{pkg1, restored1})
+	require.NoError(t, err)
+	toDKG1, err := dkg2.Round2([]*FrostDKGRound1{pkg1, pkg2})
+	require.NoError(t, err)
+
+	// round two
+	data, err = toDKG1[0].MarshalBinary()
+	require.NoError(t, err)
+	restored2 := new(FrostDKGRound2)
+	require.NoError(t, restored2.UnmarshalBinary(data))
+	require.Equal(t, 2, restored2.From())
+	require.Equal(t, 1, restored2.To())
+	require.Error(t, new(FrostDKGRound2).UnmarshalBinary(data[1:]))
+
+	ks1, err := dkg1.Finish([]*FrostDKGRound2{restored2})
+	require.NoError(t, err)
+	ks2, err := dkg2.Finish(toDKG2)
+	require.NoError(t, err)
+	require.True(t, ks1.Group().Equal(ks2.Group()))
+
+	sig, err := SignByFrost([]byte("hello"), []*FrostKeyShare{ks1, ks2})
+	require.NoError(t, err)
+	require.NoError(t, VerifyByFrost(ks1.Group().PublicKey(), []byte("hello"), sig))
+}
@@ -0,0 +1,379 @@
+package signature
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+func TestNewFrostKeyShares(t *testing.T) {
+	t.Parallel()
+
+	for _, c := range []struct{ total, threshold int }{
+		{1, 1}, {3, 1}, {2, 3}, {frostMaxMembers + 1, 2},
+	} {
+		_, _, err := NewFrostKeyShares(c.total, c.threshold)
+		require.Error(t, err, c)
+	}
+
+	keyShares, group, err := NewFrostKeyShares(5, 3)
+	require.NoError(t, err)
+	require.Len(t, keyShares, 5)
+	require.Equal(t, 3, group.Threshold())
+	require.Len(t, group.PublicKey(), ed25519.PublicKeySize)
+	for i, ks := range keyShares {
+		require.Equal(t, i+1, ks.ID())
+		require.True(t, group.Equal(ks.Group()))
+	}
+}
+
+func TestSignByFrost(t *testing.T) {
+	t.Parallel()
+
+	total, threshold := 5, 3
+	keyShares, group, err := NewFrostKeyShares(total, threshold)
+	require.NoError(t, err)
+	content := []byte(gutils.RandomStringWithLength(1024))
+
+	for n := threshold; n <= total; n++ {
+		parts := gutils.RandomChoice(keyShares, n)
+		sig, err := SignByFrost(content, parts)
+		require.NoError(t, err)
+		require.Len(t, sig, ed25519.SignatureSize)
+
+		require.NoError(t, VerifyByFrost(group.PublicKey(), content, sig))
+		require.True(t, ed25519.Verify(group.PublicKey(), content, sig))
+		require.Error(t, VerifyByFrost(group.PublicKey(), []byte("other"), sig))
+	}
+
+	// less than threshold
+	_, err = SignByFrost(content, keyShares[:threshold-1])
+	require.ErrorContains(t, err, "at least")
+
+	// another group
+	otherShares, _, err := NewFrostKeyShares(total, threshold)
+	require.NoError(t, err)
+	_, err = SignByFrost(content, append(keyShares[:threshold-1:threshold-1], otherShares[threshold]))
+	require.ErrorContains(t, err, "another group")
+
+	_, err = SignByFrost(content, nil)
+	require.Error(t, err)
+	require.Error(t, VerifyByFrost(group.PublicKey()[1:], content, nil))
+}
+
+func TestFrostRounds(t *testing.T) {
+	t.Parallel()
+
+	keyShares, group, err := NewFrostKeyShares(4, 2)
+	require.NoError(t, err)
+	content := []byte("release v1.0.0")
+	signers := []*FrostKeyShare{keyShares[3], keyShares[1]}
+
+	commit := func() ([]*FrostNonce, []*FrostCommitment) {
+		var (
+			nonces      []*FrostNonce
+			commitments []*FrostCommitment
+		)
+		for _, ks := range signers {
+			nonce, commitment, err := ks.Commit()
+			require.NoError(t, err)
+			require.Equal(t, ks.ID(), commitment.ID())
+			nonces = append(nonces, nonce)
+			commitments = append(commitments, commitment)
+		}
+
+		return nonces, commitments
+	}
+
+	t.Run("succeed", func(t *testing.T) {
+		nonces, commitments := commit()
+
+		var sigShares []*FrostSignatureShare
+		for i, ks := range signers {
+			sigShare, err := ks.Sign(content, nonces[i], commitments)
+			require.NoError(t, err)
+			require.Equal(t, ks.ID(), sigShare.ID())
+			require.NoError(t, group.VerifySignatureShare(content, commitments, sigShare))
+			sigShares = append(sigShares, sigShare)
+		}
+
+		sig, err := group.Aggregate(content, commitments, sigShares)
+		require.NoError(t, err)
+		require.NoError(t, VerifyByFrost(group.PublicKey(), content, sig))
+
+		// nonce can only be used once
+		_, err = signers[0].Sign(content, nonces[0], commitments)
+		require.ErrorContains(t, err, "reused")
+	})
+
+	t.Run("invalid nonce", func(t *testing.T) {
+		nonces, commitments := commit()
+		_, err := signers[0].Sign(content, nonces[1], commitments)
+		require.ErrorContains(t, err, "does not belong")
+		_, err = signers[0].Sign(content, nil, commitments)
+		require.Error(t, err)
+
+		// commitment replaced by coordinator
+		_, otherCommitment, err := signers[0].Commit()
+		require.NoError(t, err)
+		_, err = signers[0].Sign(content, nonces[0],
+			[]*FrostCommitment{otherCommitment, commitments[1]})
+		require.ErrorContains(t, err, "commitment mismatch nonce")
+	})
+
+	t.Run("invalid commitments", func(t *testing.T) {
+		nonces, commitments := commit()
+		_, err := signers[0].Sign(content, nonces[0], commitments[:1])
+		require.ErrorContains(t, err, "at least")
+		_, err = signers[0].Sign(content, nonces[0], []*FrostCommitment{commitments[0], commitments[0]})
+		require.ErrorContains(t, err, "duplicate")
+		_, err = signers[0].Sign(content, nonces[0], []*FrostCommitment{commitments[1], nil})
+		require.ErrorContains(t, err, "invalid commitment")
+
+		_, otherCommitment, err := keyShares[0].Commit()
+		require.NoError(t, err)
+		_, err = signers[0].Sign(content, nonces[0],
+			[]*FrostCommitment{otherCommitment, commitments[1]})
+		require.ErrorContains(t, err, "missing commitment")
+	})
+
+	t.Run("misbehaving member", func(t *testing.T) {
+		nonces, commitments := commit()
+
+		good, err := signers[0].Sign(content, nonces[0], commitments)
+		require.NoError(t, err)
+		// sign another content
+		bad, err := signers[1].Sign([]byte("malicious"), nonces[1], commitments)
+		require.NoError(t, err)
+
+		require.NoError(t, group.VerifySignatureShare(content, commitments, good))
+		require.ErrorContains(t, group.VerifySignatureShare(content, commitments, bad),
+			"invalid signature share of member 2")
+
+		_, err = group.Aggregate(content, commitments, []*FrostSignatureShare{good, bad})
+		require.ErrorContains(t, err, "invalid signature share of member 2")
+		_, err = group.Aggregate(content, commitments, []*FrostSignatureShare{good})
+		require.ErrorContains(t, err, "signature shares")
+		_, err = group.Aggregate(content, commitments, []*FrostSignatureShare{good, good})
+		require.ErrorContains(t, err, "duplicate")
+	})
+}
+
+func frostTestScalar(t *testing.T, h string) kyber.Scalar {
+	t.Helper()
+
+	b, err := hex.DecodeString(h)
+	require.NoError(t, err)
+	s, err := frostDecodeScalar(b)
+	require.NoError(t, err)
+	return s
+}
+
+func frostTestHex(t *testing.T, h string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(h)
+	require.NoError(t, err)
+	return b
+}
+
+// TestFrost_RFC9591 test vectors of FROST(Ed25519, SHA-512) in RFC 9591 appendix E.1
+func TestFrost_RFC9591(t *testing.T) {
+	t.Parallel()
+
+	secret := frostTestScalar(t, "7b1c33d3f5291d85de664833beb1ad469f7fb6025a0ec78b3a790c6e13a98304")
+	coef := frostTestScalar(t, "178199860edd8c62f5212ee91eff1295d0d670ab4ed4506866bae57e7030b204")
+	group := &FrostGroup{commits: []kyber.Point{
+		frostSuite.Point().Mul(secret, nil),
+		frostSuite.Point().Mul(coef, nil),
+	}}
+	require.Equal(t, "15d21ccd7ee42959562fc8aa63224c8851fb3ec85a3faf66040d380fb9738673",
+		hex.EncodeToString(group.PublicKey()))
+	content := frostTestHex(t, "74657374")
+
+	shares := map[int]string{
+		1: "929dcc590407aae7d388761cddb0c0db6f5627aea8e217f4a033f2ec83d93509",
+		2: "a91e66e012e4364ac9aaa405fcafd370402d9859f7b6685c07eed76bf409e80d",
+		3: "d3cb090a075eb154e82fdb4b3cb507f110040905468bb9c46da8bdea643a9a02",
+	}
+	for id, v := range shares {
+		require.True(t, frostSuite.Point().Mul(frostTestScalar(t, v), nil).Equal(group.verifyingShare(id)), id)
+	}
+
+	signers := []struct {
+		id                                  int
+		hidingRandom, bindingRandom         string
+		hidingNonce, bindingNonce           string
+		hidingCommitment, bindingCommitment string
+		bindingFactor, sigShare             string
+	}{
+		{
+			id:                1,
+			hidingRandom:      "0fd2e39e111cdc266f6c0f4d0fd45c947761f1f5d3cb583dfcb9bbaf8d4c9fec",
+			bindingRandom:     "69cd85f631d5f7f2721ed5e40519b1366f340a87c2f6856363dbdcda348a7501",
+			hidingNonce:       "812d6104142944d5a55924de6d49940956206909f2acaeedecda2b726e630407",
+			bindingNonce:      "b1110165fc2334149750b28dd813a39244f315cff14d4e89e6142f262ed83301",
+			hidingCommitment:  "b5aa8ab305882a6fc69cbee9327e5a45e54c08af61ae77cb8207be3d2ce13de3",
+			bindingCommitment: "67e98ab55aa310c3120418e5050c9cf76cf387cb20ac9e4b6fdb6f82a469f932",
+			bindingFactor:     "f2cb9d7dd9beff688da6fcc83fa89046b3479417f47f55600b106760eb3b5603",
+			sigShare:          "001719ab5a53ee1a12095cd088fd149702c0720ce5fd2f29dbecf24b7281b603",
+		},
+		{
+			id:                3,
+			hidingRandom:      "86d64a260059e495d0fb4fcc17ea3da7452391baa494d4b00321098ed2a0062f",
+			bindingRandom:     "13e6b25afb2eba51716a9a7d44130c0dbae0004a9ef8d7b5550c8a0e07c61775",
+			hidingNonce:       "c256de65476204095ebdc01bd11dc10e57b36bc96284595b8215222374f99c0e",
+			bindingNonce:      "243d71944d929063bc51205714ae3c2218bd3451d0214dfb5aeec2a90c35180d",
+			hidingCommitment:  "cfbdb165bd8aad6eb79deb8d287bcc0ab6658ae57fdcc98ed12c0669e90aec91",
+			bindingCommitment: "7487bc41a6e712eea2f2af24681b58b1cf1da278ea11fe4e8b78398965f13552",
+			bindingFactor:     "b087686bf35a13f3dc78e780a34b0fe8a77fef1b9938c563f5573d71d8d7890f",
+			sigShare:          "bd86125de990acc5e1f13781d8e32c03a9bbd4c53539bbc106058bfd14326007",
+		},
+	}
+
+	var (
+		keyShares   []*FrostKeyShare
+		nonces      []*FrostNonce
+		commitments []*FrostCommitment
+	)
+	for _, c := range signers {
+		ks := &FrostKeyShare{id: c.id, secret: frostTestScalar(t, shares[c.id]), group: group}
+		nonce, commitment := ks.commitByRandom(frostTestHex(t, c.hidingRandom), frostTestHex(t, c.bindingRandom))
+		require.Equal(t, c.hidingNonce, hex.EncodeToString(frostEncode(nonce.hiding)))
+		require.Equal(t, c.bindingNonce, hex.EncodeToString(frostEncode(nonce.binding)))
+		require.Equal(t, c.hidingCommitment, hex.EncodeToString(frostEncode(commitment.hiding)))
+		require.Equal(t, c.bindingCommitment, hex.EncodeToString(frostEncode(commitment.binding)))
+
+		keyShares = append(keyShares, ks)
+		nonces = append(nonces, nonce)
+		commitments = append(commitments, commitment)
+	}
+
+	pkg, err := group.newFrostSigningPackage(content, commitments)
+	require.NoError(t, err)
+	var sigShares []*FrostSignatureShare
+	for i, c := range signers {
+		require.Equal(t, c.bindingFactor, hex.EncodeToString(frostEncode(pkg.bindingFactors[c.id])))
+
+		sigShare, err := keyShares[i].Sign(content, nonces[i], commitments)
+		require.NoError(t, err)
+		require.Equal(t, c.sigShare, hex.EncodeToString(frostEncode(sigShare.z)))
+		sigShares = append(sigShares, sigShare)
+	}
+
+	sig, err := group.Aggregate(content, commitments, sigShares)
+	require.NoError(t, err)
+	require.Equal(t, "36282629c383bb820a88b71cae937d41f2f2adfcc3d02e55507e2fb9e2dd3cbe"+
+		"bd9d2b0844e49ae0f3fa935161e1419aab7b47d21a37ebeae1f17d4987b3160b", hex.EncodeToString(sig))
+	require.True(t, ed25519.Verify(group.PublicKey(), content, sig))
+}
+
+func TestFrost_Marshal(t *testing.T) {
+	t.Parallel()
+
+	keyShares, group, err := NewFrostKeyShares(3, 2)
+	require.NoError(t, err)
+	content := []byte("hello")
+
+	// group
+	data, err := group.MarshalBinary()
+	require.NoError(t, err)
+	group2 := new(FrostGroup)
+	require.NoError(t, group2.UnmarshalBinary(data))
+	require.True(t, group.Equal(group2))
+	require.Error(t, new(FrostGroup).UnmarshalBinary(data[:len(data)-1]))
+	require.Error(t, new(FrostGroup).UnmarshalBinary(append(data, 0)))
+
+	// key shares
+	var restored []*FrostKeyShare
+	for _, ks := range keyShares[1:] {
+		data, err := ks.MarshalBinary()
+		require.NoError(t, err)
+
+		ks2 := new(FrostKeyShare)
+		require.NoError(t, ks2.UnmarshalBinary(data))
+		require.Equal(t, ks.ID(), ks2.ID())
+		require.True(t, ks.secret.Equal(ks2.secret))
+		require.True(t, group.Equal(ks2.Group()))
+		restored = append(restored, ks2)
+
+		// tampered secret
+		data[frostIDSize] ^= 1
+		require.ErrorContains(t, new(FrostKeyShare).UnmarshalBinary(data), "secret mismatch group")
+	}
+
+	sig, err := SignByFrost(content, restored)
+	require.NoError(t, err)
+	require.NoError(t, VerifyByFrost(group.PublicKey(), content, sig))
+
+	// commitment & signature share
+	nonces := make([]*FrostNonce, 2)
+	commitments := make([]*FrostCommitment, 2)
+	for i, ks := range restored {
+		var commitment *FrostCommitment
+		nonces[i], commitment, err = ks.Commit()
+		require.NoError(t, err)
+
+		data, err := commitment.MarshalBinary()
+		require.NoError(t, err)
+		commitments[i] = new(FrostCommitment)
+		require.NoError(t, commitments[i].UnmarshalBinary(data))
+		require.Error(t, new(FrostCommitment).UnmarshalBinary(data[1:]))
+	}
+
+	var sigShares []*FrostSignatureShare
+	for i, ks := range restored {
+		sigShare, err := ks.Sign(content, nonces[i], commitments)
+		require.NoError(t, err)
+
+		data, err := sigShare.MarshalBinary()
+		require.NoError(t, err)
+		sigShare2 := new(FrostSignatureShare)
+		require.NoError(t, sigShare2.UnmarshalBinary(data))
+		sigShares = append(sigShares, sigShare2)
+
+		data[len(data)-1] = 0xff
+		require.ErrorContains(t, new(FrostSignatureShare).UnmarshalBinary(data), "not canonical")
+	}
+
+	sig, err = group.Aggregate(content, commitments, sigShares)
+	require.NoError(t, err)
+	require.NoError(t, VerifyByFrost(group.PublicKey(), content, sig))
+}
+
+func TestFrostDecodePoint(t *testing.T) {
+	t.Parallel()
+
+	base := frostEncode(frostSuite.Point().Base())
+	_, err := frostDecodePoint(base)
+	require.NoError(t, err)
+
+	_, err = frostDecodePoint(base[1:])
+	require.Error(t, err)
+
+	// identity
+	identity := make([]byte, 32)
+	identity[0] = 1
+	_, err = frostDecodePoint(identity)
+	require.ErrorContains(t, err, "identity")
+
+	// point of order 2
+	order2 := make([]byte, 32)
+	for i := range order2 {
+		order2[i] = 0xff
+	}
+	order2[0], order2[31] = 0xec, 0x7f
+	_, err = frostDecodePoint(order2)
+	require.ErrorContains(t, err, "prime order subgroup")
+
+	// non-canonical encoding of identity, y = p + 1
+	nonCanonical := append([]byte{}, order2...)
+	nonCanonical[0] = 0xee
+	_, err = frostDecodePoint(nonCanonical)
+	require.Error(t, err)
+}
@@ -0,0 +1,177 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// Attestation statement formats
+const (
+	// AttestationFormatNone no attestation
+	AttestationFormatNone = "none"
+	// AttestationFormatPacked packed attestation, refer to WebAuthn 8.2
+	AttestationFormatPacked = "packed"
+)
+
+// oidFIDOGenCeAAGUID extension of attestation certificate contains aaguid
+var oidFIDOGenCeAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// packedAttestationOU OU of packed attestation certificate's subject
+const packedAttestationOU = "Authenticator Attestation"
+
+type attestationObject struct {
+	format      string
+	attStmt     map[any]any
+	rawAuthData []byte
+	authData    *AuthenticatorData
+}
+
+func parseAttestationObject(data []byte) (*attestationObject, error) {
+	v, rest, err := cborDecode(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.Errorf("unexpected trailing data")
+	}
+
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.Errorf("attestation object should be map")
+	}
+
+	obj := new(attestationObject)
+	if obj.format, ok = cborMapGet[string](m, "fmt"); !ok {
+		return nil, errors.Errorf("missing fmt")
+	}
+	if obj.attStmt, ok = cborMapGet[map[any]any](m, "attStmt"); !ok {
+		return nil, errors.Errorf("missing attStmt")
+	}
+	if obj.rawAuthData, ok = cborMapGet[[]byte](m, "authData"); !ok {
+		return nil, errors.Errorf("missing authData")
+	}
+
+	if obj.authData, err = ParseAuthenticatorData(obj.rawAuthData); err != nil {
+		return nil, errors.Wrap(err, "parse authData")
+	}
+
+	return obj, nil
+}
+
+// verify verify attestation statement,
+// return attestation certificates, which is empty for none and self attestation.
+func (obj *attestationObject) verify(clientDataHash []byte) ([]*x509.Certificate, error) {
+	switch obj.format {
+	case AttestationFormatNone:
+		if len(obj.attStmt) != 0 {
+			return nil, errors.Errorf("attStmt of none attestation should be empty")
+		}
+
+		return nil, nil
+	case AttestationFormatPacked:
+		return obj.verifyPacked(clientDataHash)
+	default:
+		return nil, errors.Errorf("unsupported attestation format %q", obj.format)
+	}
+}
+
+func (obj *attestationObject) verifyPacked(clientDataHash []byte) ([]*x509.Certificate, error) {
+	rawAlg, ok := cborMapGet[int64](obj.attStmt, "alg")
+	if !ok {
+		return nil, errors.Errorf("missing alg in attStmt")
+	}
+	alg := COSEAlgorithm(rawAlg)
+
+	sig, ok := cborMapGet[[]byte](obj.attStmt, "sig")
+	if !ok {
+		return nil, errors.Errorf("missing sig in attStmt")
+	}
+
+	signed := make([]byte, 0, len(obj.rawAuthData)+len(clientDataHash))
+	signed = append(signed, obj.rawAuthData...)
+	signed = append(signed, clientDataHash...)
+
+	rawX5c, ok := obj.attStmt["x5c"]
+	if !ok {
+		// self attestation
+		credPubkey, credAlg, err := ParseCOSEKey(obj.authData.CredentialPublicKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse credential public key")
+		}
+		if alg != credAlg {
+			return nil, errors.Errorf("alg %d mismatch credential's alg %d", alg, credAlg)
+		}
+		if err = verifySignature(alg, credPubkey, signed, sig); err != nil {
+			return nil, errors.Wrap(err, "verify self attestation")
+		}
+
+		return nil, nil
+	}
+
+	x5c, ok := rawX5c.([]any)
+	if !ok || len(x5c) == 0 {
+		return nil, errors.Errorf("x5c should be non-empty array")
+	}
+
+	var certs []*x509.Certificate
+	for i, raw := range x5c {
+		der, ok := raw.([]byte)
+		if !ok {
+			return nil, errors.Errorf("x5c[%d] should be bytes", i)
+		}
+
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse x5c[%d]", i)
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if err := verifySignature(alg, certs[0].PublicKey, signed, sig); err != nil {
+		return nil, errors.Wrap(err, "verify attestation signature")
+	}
+	if err := checkPackedAttestationCert(certs[0], obj.authData.AAGUID); err != nil {
+		return nil, errors.Wrap(err, "check attestation certificate")
+	}
+
+	return certs, nil
+}
+
+// checkPackedAttestationCert check requirements of attestation certificate,
+// refer to WebAuthn 8.2.1
+func checkPackedAttestationCert(cert *x509.Certificate, aaguid []byte) error {
+	subject := cert.Subject
+	switch {
+	case cert.Version != 3:
+		return errors.Errorf("certificate should be version 3")
+	case len(subject.Country) == 0 || len(subject.Organization) == 0 || subject.CommonName == "":
+		return errors.Errorf("subject should contain C, O and CN")
+	case len(subject.OrganizationalUnit) != 1 || subject.OrganizationalUnit[0] != packedAttestationOU:
+		return errors.Errorf("subject OU should be %q", packedAttestationOU)
+	case !cert.BasicConstraintsValid || cert.IsCA:
+		return errors.Errorf("certificate should not be CA")
+	}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidFIDOGenCeAAGUID) {
+			continue
+		}
+		if ext.Critical {
+			return errors.Errorf("aaguid extension should not be critical")
+		}
+
+		var certAAGUID []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &certAAGUID); err != nil || len(rest) != 0 {
+			return errors.Errorf("invalid aaguid extension")
+		}
+		if !bytes.Equal(certAAGUID, aaguid) {
+			return errors.Errorf("aaguid mismatch")
+		}
+	}
+
+	return nil
+}
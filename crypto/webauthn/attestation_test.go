@@ -0,0 +1,122 @@
+package webauthn
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttestationObject_verify(t *testing.T) {
+	t.Parallel()
+
+	authn := newTestAuthenticator(t, COSEAlgES256)
+	ca := newTestAttestationCA(t)
+	challenge := []byte("challenge")
+
+	verify := func(resp *AttestationResponse) error {
+		obj, err := parseAttestationObject(resp.AttestationObject)
+		if err != nil {
+			return err
+		}
+
+		clientDataHash := sha256.Sum256(resp.ClientDataJSON)
+		_, err = obj.verify(clientDataHash[:])
+		return err
+	}
+
+	t.Run("none", func(t *testing.T) {
+		require.NoError(t, verify(authn.attestNone(challenge)))
+
+		resp := authn.attestNone(challenge)
+		resp.AttestationObject = cborEncode(cborMap{
+			{"fmt", AttestationFormatNone},
+			{"attStmt", cborMap{{"alg", COSEAlgES256}}},
+			{"authData", authn.authData(testRPID, true)},
+		})
+		require.ErrorContains(t, verify(resp), "should be empty")
+	})
+
+	t.Run("packed x5c", func(t *testing.T) {
+		attKey, attCert := ca.issue(t, testAAGUID, packedAttestationOU)
+		resp := authn.attestPacked(challenge, attKey, COSEAlgES256, attCert, ca.cert)
+		obj, err := parseAttestationObject(resp.AttestationObject)
+		require.NoError(t, err)
+		clientDataHash := sha256.Sum256(resp.ClientDataJSON)
+		certs, err := obj.verify(clientDataHash[:])
+		require.NoError(t, err)
+		require.Len(t, certs, 2)
+		require.Equal(t, attCert.Raw, certs[0].Raw)
+
+		// aaguid extension is optional
+		attKey, attCert = ca.issue(t, nil, packedAttestationOU)
+		require.NoError(t, verify(authn.attestPacked(challenge, attKey, COSEAlgES256, attCert)))
+
+		// tampered client data
+		resp.ClientDataJSON = append(resp.ClientDataJSON, ' ')
+		require.ErrorContains(t, verify(resp), "verify attestation signature")
+	})
+
+	t.Run("packed invalid certificate", func(t *testing.T) {
+		attKey, attCert := ca.issue(t, []byte("fedcba9876543210"), packedAttestationOU)
+		require.ErrorContains(t,
+			verify(authn.attestPacked(challenge, attKey, COSEAlgES256, attCert)), "aaguid mismatch")
+
+		attKey, attCert = ca.issue(t, testAAGUID, "Other")
+		require.ErrorContains(t,
+			verify(authn.attestPacked(challenge, attKey, COSEAlgES256, attCert)), "subject OU")
+
+		// CA certificate
+		require.ErrorContains(t,
+			verify(authn.attestPacked(challenge, ca.key, COSEAlgES256, ca.cert)), "subject should contain")
+	})
+
+	t.Run("packed self attestation alg mismatch", func(t *testing.T) {
+		resp := authn.attestPacked(challenge, nil, 0)
+		obj, err := parseAttestationObject(resp.AttestationObject)
+		require.NoError(t, err)
+		obj.attStmt["alg"] = int64(COSEAlgEdDSA)
+		clientDataHash := sha256.Sum256(resp.ClientDataJSON)
+		_, err = obj.verify(clientDataHash[:])
+		require.ErrorContains(t, err, "mismatch credential's alg")
+	})
+
+	t.Run("packed invalid statement", func(t *testing.T) {
+		authData := authn.authData(testRPID, true)
+		for name, attStmt := range map[string]cborMap{
+			"missing alg": {{"sig", []byte("sig")}},
+			"missing sig": {{"alg", COSEAlgES256}},
+			"empty x5c":   {{"alg", COSEAlgES256}, {"sig", []byte("sig")}, {"x5c", []any{}}},
+			"x5c type":    {{"alg", COSEAlgES256}, {"sig", []byte("sig")}, {"x5c", []any{"cert"}}},
+			"x5c der":     {{"alg", COSEAlgES256}, {"sig", []byte("sig")}, {"x5c", []any{[]byte("cert")}}},
+		} {
+			resp := &AttestationResponse{
+				ClientDataJSON: testClientData(t, clientDataTypeCreate, challenge, testOrigin),
+				AttestationObject: cborEncode(cborMap{
+					{"fmt", AttestationFormatPacked},
+					{"attStmt", attStmt},
+					{"authData", authData},
+				}),
+			}
+			require.Error(t, verify(resp), name)
+		}
+	})
+
+	t.Run("invalid object", func(t *testing.T) {
+		authData := authn.authData(testRPID, true)
+		for name, obj := range map[string][]byte{
+			"not map":          cborEncode([]any{}),
+			"trailing":         append(authn.attestNone(challenge).AttestationObject, 0x00),
+			"missing fmt":      cborEncode(cborMap{{"attStmt", cborMap{}}, {"authData", authData}}),
+			"missing attStmt":  cborEncode(cborMap{{"fmt", "none"}, {"authData", authData}}),
+			"missing authData": cborEncode(cborMap{{"fmt", "none"}, {"attStmt", cborMap{}}}),
+			"bad authData":     cborEncode(cborMap{{"fmt", "none"}, {"attStmt", cborMap{}}, {"authData", []byte{1}}}),
+			"unknown fmt": cborEncode(cborMap{
+				{"fmt", "tpm"}, {"attStmt", cborMap{}}, {"authData", authData},
+			}),
+		} {
+			err := verify(&AttestationResponse{ClientDataJSON: []byte("{}"), AttestationObject: obj})
+			require.Error(t, err, name)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package webauthn
+
+import (
+	"encoding/binary"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// AuthenticatorFlags flags in authenticator data
+type AuthenticatorFlags byte
+
+const (
+	// FlagUserPresent user is present
+	FlagUserPresent AuthenticatorFlags = 1 << 0
+	// FlagUserVerified user is verified, like by PIN or biometric
+	FlagUserVerified AuthenticatorFlags = 1 << 2
+	// FlagBackupEligible credential can be backed up
+	FlagBackupEligible AuthenticatorFlags = 1 << 3
+	// FlagBackupState credential is backed up
+	FlagBackupState AuthenticatorFlags = 1 << 4
+	// FlagAttestedCredentialData attested credential data is included
+	FlagAttestedCredentialData AuthenticatorFlags = 1 << 6
+	// FlagExtensionData extension data is included
+	FlagExtensionData AuthenticatorFlags = 1 << 7
+)
+
+// Has check whether flag is set
+func (f AuthenticatorFlags) Has(flag AuthenticatorFlags) bool {
+	return f&flag == flag
+}
+
+const (
+	rpIDHashSize       = 32
+	aaguidSize         = 16
+	minAuthDataSize    = rpIDHashSize + 1 + 4
+	maxCredentialIDLen = 1023
+)
+
+// AuthenticatorData authenticator data, refer to WebAuthn 6.1
+type AuthenticatorData struct {
+	RPIDHash  []byte
+	Flags     AuthenticatorFlags
+	SignCount uint32
+
+	// attested credential data, only exists in registration
+	AAGUID       []byte
+	CredentialID []byte
+	// CredentialPublicKey COSE encoded public key
+	CredentialPublicKey []byte
+
+	// Extensions CBOR encoded extensions
+	Extensions []byte
+}
+
+// ParseAuthenticatorData parse authenticator data
+func ParseAuthenticatorData(data []byte) (*AuthenticatorData, error) {
+	if len(data) < minAuthDataSize {
+		return nil, errors.Errorf("authenticator data is too short")
+	}
+
+	ad := &AuthenticatorData{
+		RPIDHash:  data[:rpIDHashSize],
+		Flags:     AuthenticatorFlags(data[rpIDHashSize]),
+		SignCount: binary.BigEndian.Uint32(data[rpIDHashSize+1:]),
+	}
+	rest := data[minAuthDataSize:]
+
+	if ad.Flags.Has(FlagAttestedCredentialData) {
+		if len(rest) < aaguidSize+2 {
+			return nil, errors.Errorf("attested credential data is too short")
+		}
+
+		ad.AAGUID = rest[:aaguidSize]
+		idLen := int(binary.BigEndian.Uint16(rest[aaguidSize:]))
+		rest = rest[aaguidSize+2:]
+		if idLen > maxCredentialIDLen || idLen > len(rest) {
+			return nil, errors.Errorf("invalid credential id length %d", idLen)
+		}
+
+		ad.CredentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		_, remain, err := cborDecode(rest)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse credential public key")
+		}
+
+		ad.CredentialPublicKey = rest[:len(rest)-len(remain)]
+		rest = remain
+	}
+
+	if ad.Flags.Has(FlagExtensionData) {
+		v, remain, err := cborDecode(rest)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse extensions")
+		}
+		if _, ok := v.(map[any]any); !ok {
+			return nil, errors.Errorf("extensions should be map")
+		}
+
+		ad.Extensions = rest[:len(rest)-len(remain)]
+		rest = remain
+	}
+
+	if len(rest) != 0 {
+		return nil, errors.Errorf("unexpected trailing data in authenticator data")
+	}
+
+	return ad, nil
+}
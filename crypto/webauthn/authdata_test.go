@@ -0,0 +1,84 @@
+package webauthn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAuthenticatorData(t *testing.T) {
+	t.Parallel()
+
+	authn := newTestAuthenticator(t, COSEAlgES256)
+	authn.flags |= FlagUserVerified
+	authn.signCount = 42
+
+	t.Run("attested", func(t *testing.T) {
+		ad, err := ParseAuthenticatorData(authn.authData(testRPID, true))
+		require.NoError(t, err)
+		require.Equal(t, newTestRP(t).idHash, ad.RPIDHash)
+		require.True(t, ad.Flags.Has(FlagUserPresent|FlagUserVerified|FlagAttestedCredentialData))
+		require.False(t, ad.Flags.Has(FlagExtensionData))
+		require.Equal(t, uint32(42), ad.SignCount)
+		require.Equal(t, testAAGUID, ad.AAGUID)
+		require.Equal(t, authn.credID, ad.CredentialID)
+		require.Equal(t, authn.coseKey(), ad.CredentialPublicKey)
+		require.Empty(t, ad.Extensions)
+	})
+
+	t.Run("assertion", func(t *testing.T) {
+		ad, err := ParseAuthenticatorData(authn.authData(testRPID, false))
+		require.NoError(t, err)
+		require.Equal(t, uint32(42), ad.SignCount)
+		require.Empty(t, ad.CredentialID)
+		require.Empty(t, ad.CredentialPublicKey)
+	})
+
+	t.Run("extensions", func(t *testing.T) {
+		ext := cborEncode(cborMap{{"credProtect", 2}})
+		data := authn.authData(testRPID, true)
+		data[rpIDHashSize] |= byte(FlagExtensionData)
+		data = append(data, ext...)
+
+		ad, err := ParseAuthenticatorData(data)
+		require.NoError(t, err)
+		require.Equal(t, ext, ad.Extensions)
+		require.Equal(t, authn.coseKey(), ad.CredentialPublicKey)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		data := authn.authData(testRPID, false)
+		_, err := ParseAuthenticatorData(data[:minAuthDataSize-1])
+		require.ErrorContains(t, err, "too short")
+
+		_, err = ParseAuthenticatorData(append(data, 0x00))
+		require.ErrorContains(t, err, "trailing data")
+
+		// extension flag without extensions
+		noExt := append([]byte{}, data...)
+		noExt[rpIDHashSize] |= byte(FlagExtensionData)
+		_, err = ParseAuthenticatorData(noExt)
+		require.ErrorContains(t, err, "parse extensions")
+
+		// extensions is not map
+		_, err = ParseAuthenticatorData(append(noExt, cborEncode(int64(1))...))
+		require.ErrorContains(t, err, "should be map")
+
+		// attested flag without attested data
+		noAttested := append([]byte{}, data...)
+		noAttested[rpIDHashSize] |= byte(FlagAttestedCredentialData)
+		_, err = ParseAuthenticatorData(noAttested)
+		require.ErrorContains(t, err, "attested credential data is too short")
+
+		// credential id length overflow
+		attested := authn.authData(testRPID, true)
+		attested[minAuthDataSize+aaguidSize] = 0xff
+		_, err = ParseAuthenticatorData(attested)
+		require.ErrorContains(t, err, "invalid credential id length")
+
+		// truncated public key
+		attested = authn.authData(testRPID, true)
+		_, err = ParseAuthenticatorData(attested[:len(attested)-1])
+		require.ErrorContains(t, err, "parse credential public key")
+	})
+}
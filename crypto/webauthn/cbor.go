@@ -0,0 +1,218 @@
+package webauthn
+
+import (
+	"math"
+	"unicode/utf8"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// cborMaxDepth avoid stack overflow by deeply nested data
+const cborMaxDepth = 16
+
+const (
+	cborMajorUint = iota
+	cborMajorNegInt
+	cborMajorBytes
+	cborMajorText
+	cborMajorArray
+	cborMajorMap
+	cborMajorTag
+	cborMajorSimple
+)
+
+// cborDecode decode one CBOR data item, return it with the remaining bytes
+//
+// only definite-length items used by WebAuthn (RFC 8949) are supported,
+// integers are decoded as int64, maps as map[any]any with int64/string keys,
+// tags are dropped.
+func cborDecode(data []byte) (v any, rest []byte, err error) {
+	d := &cborDecoder{data: data}
+	if v, err = d.decode(0); err != nil {
+		return nil, nil, errors.Wrap(err, "decode cbor")
+	}
+
+	return v, d.data[d.pos:], nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errors.Errorf("unexpected end of data")
+	}
+
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// head read major type and argument
+func (d *cborDecoder) head() (major byte, info byte, arg uint64, err error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	major, info = b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		if b, err = d.read(1 << (info - 24)); err != nil {
+			return 0, 0, 0, err
+		}
+
+		for _, c := range b {
+			arg = arg<<8 | uint64(c)
+		}
+		return major, info, arg, nil
+	case info == 31:
+		return 0, 0, 0, errors.Errorf("indefinite length is not supported")
+	default:
+		return 0, 0, 0, errors.Errorf("invalid additional information %d", info)
+	}
+}
+
+func (d *cborDecoder) decode(depth int) (any, error) {
+	if depth > cborMaxDepth {
+		return nil, errors.Errorf("too deeply nested")
+	}
+
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborMajorUint:
+		if arg > math.MaxInt64 {
+			return nil, errors.Errorf("integer overflow")
+		}
+
+		return int64(arg), nil
+	case cborMajorNegInt:
+		if arg > math.MaxInt64 {
+			return nil, errors.Errorf("integer overflow")
+		}
+
+		return -1 - int64(arg), nil
+	case cborMajorBytes:
+		b, err := d.read(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		return append([]byte{}, b...), nil
+	case cborMajorText:
+		b, err := d.read(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(b) {
+			return nil, errors.Errorf("invalid utf-8 text")
+		}
+
+		return string(b), nil
+	case cborMajorArray:
+		// each item takes at least one byte
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errors.Errorf("unexpected end of data")
+		}
+
+		arr := make([]any, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			arr = append(arr, v)
+		}
+
+		return arr, nil
+	case cborMajorMap:
+		if arg > uint64(len(d.data)-d.pos)/2 {
+			return nil, errors.Errorf("unexpected end of data")
+		}
+
+		m := make(map[any]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, errors.Errorf("unsupported map key type %T", k)
+			}
+			if _, ok := m[k]; ok {
+				return nil, errors.Errorf("duplicate map key %v", k)
+			}
+
+			if m[k], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+
+		return m, nil
+	case cborMajorTag:
+		return d.decode(depth + 1)
+	default: // cborMajorSimple
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		case 25:
+			return float16ToFloat64(uint16(arg)), nil
+		case 26:
+			return float64(math.Float32frombits(uint32(arg))), nil
+		case 27:
+			return math.Float64frombits(arg), nil
+		default:
+			return nil, errors.Errorf("unsupported simple value %d", arg)
+		}
+	}
+}
+
+func float16ToFloat64(h uint16) float64 {
+	sign, exp, frac := h>>15, int(h>>10&0x1f), float64(h&0x3ff)
+
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(frac+1024, exp-25)
+	}
+
+	if sign == 1 {
+		return -v
+	}
+
+	return v
+}
+
+// cborMapGet get value of key from decoded map in type T
+func cborMapGet[T any](m map[any]any, key any) (v T, ok bool) {
+	raw, ok := m[key]
+	if !ok {
+		return v, false
+	}
+
+	v, ok = raw.(T)
+	return v, ok
+}
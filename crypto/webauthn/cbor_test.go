@@ -0,0 +1,172 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// cborPair key-value pair of cborMap
+type cborPair struct {
+	k, v any
+}
+
+// cborMap map encoded in order
+type cborMap []cborPair
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= math.MaxUint8:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+	}
+}
+
+// cborEncode test only encoder
+func cborEncode(v any) []byte {
+	switch v := v.(type) {
+	case int:
+		return cborEncode(int64(v))
+	case COSEAlgorithm:
+		return cborEncode(int64(v))
+	case int64:
+		if v >= 0 {
+			return cborHead(cborMajorUint, uint64(v))
+		}
+		return cborHead(cborMajorNegInt, uint64(-1-v))
+	case []byte:
+		return append(cborHead(cborMajorBytes, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(cborMajorText, uint64(len(v))), v...)
+	case []any:
+		out := cborHead(cborMajorArray, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, cborEncode(item)...)
+		}
+		return out
+	case cborMap:
+		out := cborHead(cborMajorMap, uint64(len(v)))
+		for _, p := range v {
+			out = append(out, cborEncode(p.k)...)
+			out = append(out, cborEncode(p.v)...)
+		}
+		return out
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	default:
+		panic("unsupported type")
+	}
+}
+
+func TestCBORDecode(t *testing.T) {
+	t.Parallel()
+
+	// RFC 8949 Appendix A
+	for _, tc := range []struct {
+		hex    string
+		expect any
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1903e8", int64(1000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"20", int64(-1)},
+		{"3863", int64(-100)},
+		{"40", []byte{}},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"60", ""},
+		{"6449455446", "IETF"},
+		{"62c3bc", "ü"},
+		{"80", []any{}},
+		{"83010203", []any{int64(1), int64(2), int64(3)}},
+		{"8301820203820405", []any{int64(1), []any{int64(2), int64(3)}, []any{int64(4), int64(5)}}},
+		{"a0", map[any]any{}},
+		{"a201020304", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"f93c00", 1.0},
+		{"f9c400", -4.0},
+		{"fa47c35000", 100000.0},
+		{"fb3ff199999999999a", 1.1},
+		{"c074323031332d30332d32315432303a30343a30305a", "2013-03-21T20:04:00Z"},
+	} {
+		data, err := hex.DecodeString(tc.hex)
+		require.NoError(t, err)
+
+		got, rest, err := cborDecode(data)
+		require.NoError(t, err, tc.hex)
+		require.Empty(t, rest, tc.hex)
+		require.Equal(t, tc.expect, got, tc.hex)
+	}
+
+	t.Run("rest", func(t *testing.T) {
+		got, rest, err := cborDecode([]byte{0x01, 0x02})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), got)
+		require.Equal(t, []byte{0x02}, rest)
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		data := cborEncode(cborMap{
+			{"fmt", "none"},
+			{int64(-7), []byte("abc")},
+			{"arr", []any{int64(-300), int64(70000), true, nil}},
+		})
+		got, rest, err := cborDecode(data)
+		require.NoError(t, err)
+		require.Empty(t, rest)
+		require.Equal(t, map[any]any{
+			"fmt":     "none",
+			int64(-7): []byte("abc"),
+			"arr":     []any{int64(-300), int64(70000), true, nil},
+		}, got)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, h := range []string{
+			"",                   // empty
+			"18",                 // truncated argument
+			"4401",               // truncated bytes
+			"62c3",               // truncated text
+			"62c328",             // invalid utf-8
+			"5f42010243030405ff", // indefinite length
+			"1c",                 // reserved additional information
+			"1bffffffffffffffff", // overflow
+			"a201020103",         // duplicate key
+			"a1f402",             // unsupported key type
+			"9bffffffffffffffff", // huge array
+			"f0",                 // unsupported simple value
+		} {
+			data, err := hex.DecodeString(h)
+			require.NoError(t, err)
+			_, _, err = cborDecode(data)
+			require.Error(t, err, h)
+		}
+
+		// deeply nested
+		data := make([]byte, 100)
+		for i := range data {
+			data[i] = 0x81
+		}
+		_, _, err := cborDecode(append(data, 0x01))
+		require.ErrorContains(t, err, "too deeply nested")
+	})
+}
@@ -0,0 +1,254 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha512"
+	"encoding/asn1"
+	"math/big"
+
+	"github.com/Laisky/errors/v2"
+
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+)
+
+// COSEAlgorithm COSE algorithm identifier, refer to RFC 9053
+type COSEAlgorithm int64
+
+const (
+	// COSEAlgES256 ECDSA with SHA-256 on P-256
+	COSEAlgES256 COSEAlgorithm = -7
+	// COSEAlgEdDSA EdDSA on Ed25519
+	COSEAlgEdDSA COSEAlgorithm = -8
+	// COSEAlgES384 ECDSA with SHA-384 on P-384
+	COSEAlgES384 COSEAlgorithm = -35
+	// COSEAlgES512 ECDSA with SHA-512 on P-521
+	COSEAlgES512 COSEAlgorithm = -36
+	// COSEAlgPS256 RSASSA-PSS with SHA-256
+	COSEAlgPS256 COSEAlgorithm = -37
+	// COSEAlgRS256 RSASSA-PKCS1-v1_5 with SHA-256
+	COSEAlgRS256 COSEAlgorithm = -257
+)
+
+// COSE key parameters, refer to RFC 9052 7.1 and RFC 9053 7
+const (
+	coseKeyKty = 1
+	coseKeyAlg = 3
+	// crv of EC2/OKP, n of RSA
+	coseKeyCrvOrN = -1
+	// x of EC2/OKP, e of RSA
+	coseKeyXOrE = -2
+	coseKeyY    = -3
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvP384    = 2
+	coseCrvP521    = 3
+	coseCrvEd25519 = 6
+
+	coseMinRSABits = 2048
+)
+
+// ParseCOSEKey parse COSE encoded public key
+func ParseCOSEKey(coseKey []byte) (pubkey crypto.PublicKey, alg COSEAlgorithm, err error) {
+	v, rest, err := cborDecode(coseKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(rest) != 0 {
+		return nil, 0, errors.Errorf("unexpected trailing data")
+	}
+
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, 0, errors.Errorf("cose key should be map")
+	}
+
+	kty, ok := cborMapGet[int64](m, int64(coseKeyKty))
+	if !ok {
+		return nil, 0, errors.Errorf("missing kty")
+	}
+	rawAlg, ok := cborMapGet[int64](m, int64(coseKeyAlg))
+	if !ok {
+		return nil, 0, errors.Errorf("missing alg")
+	}
+	alg = COSEAlgorithm(rawAlg)
+
+	switch kty {
+	case coseKtyEC2:
+		pubkey, err = parseCOSEEC2Key(m, alg)
+	case coseKtyOKP:
+		pubkey, err = parseCOSEOKPKey(m, alg)
+	case coseKtyRSA:
+		pubkey, err = parseCOSERSAKey(m, alg)
+	default:
+		return nil, 0, errors.Errorf("unsupported kty %d", kty)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return pubkey, alg, nil
+}
+
+func parseCOSEEC2Key(m map[any]any, alg COSEAlgorithm) (*ecdsa.PublicKey, error) {
+	crv, _ := cborMapGet[int64](m, int64(coseKeyCrvOrN))
+	var (
+		curve    elliptic.Curve
+		ecdhCrv  ecdh.Curve
+		expected COSEAlgorithm
+	)
+	switch crv {
+	case coseCrvP256:
+		curve, ecdhCrv, expected = elliptic.P256(), ecdh.P256(), COSEAlgES256
+	case coseCrvP384:
+		curve, ecdhCrv, expected = elliptic.P384(), ecdh.P384(), COSEAlgES384
+	case coseCrvP521:
+		curve, ecdhCrv, expected = elliptic.P521(), ecdh.P521(), COSEAlgES512
+	default:
+		return nil, errors.Errorf("unsupported curve %d", crv)
+	}
+	if alg != expected {
+		return nil, errors.Errorf("alg %d mismatch curve %d", alg, crv)
+	}
+
+	x, _ := cborMapGet[[]byte](m, int64(coseKeyXOrE))
+	y, _ := cborMapGet[[]byte](m, int64(coseKeyY))
+	size := (curve.Params().BitSize + 7) / 8
+	if len(x) != size || len(y) != size {
+		return nil, errors.Errorf("invalid coordinates size")
+	}
+
+	// check point is on curve
+	point := append(append([]byte{4}, x...), y...)
+	if _, err := ecdhCrv.NewPublicKey(point); err != nil {
+		return nil, errors.Wrap(err, "invalid ec point")
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+func parseCOSEOKPKey(m map[any]any, alg COSEAlgorithm) (ed25519.PublicKey, error) {
+	crv, _ := cborMapGet[int64](m, int64(coseKeyCrvOrN))
+	if crv != coseCrvEd25519 || alg != COSEAlgEdDSA {
+		return nil, errors.Errorf("unsupported okp curve %d with alg %d", crv, alg)
+	}
+
+	x, _ := cborMapGet[[]byte](m, int64(coseKeyXOrE))
+	if len(x) != ed25519.PublicKeySize {
+		return nil, errors.Errorf("invalid ed25519 public key size")
+	}
+
+	return ed25519.PublicKey(x), nil
+}
+
+func parseCOSERSAKey(m map[any]any, alg COSEAlgorithm) (*rsa.PublicKey, error) {
+	if alg != COSEAlgRS256 && alg != COSEAlgPS256 {
+		return nil, errors.Errorf("unsupported rsa alg %d", alg)
+	}
+
+	n, _ := cborMapGet[[]byte](m, int64(coseKeyCrvOrN))
+	e, _ := cborMapGet[[]byte](m, int64(coseKeyXOrE))
+	if len(e) == 0 || len(e) > 4 {
+		return nil, errors.Errorf("invalid rsa exponent")
+	}
+
+	pubkey := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}
+	if pubkey.N.BitLen() < coseMinRSABits {
+		return nil, errors.Errorf("rsa key should be at least %d bits", coseMinRSABits)
+	}
+	if pubkey.E < 3 || pubkey.E%2 == 0 {
+		return nil, errors.Errorf("invalid rsa exponent")
+	}
+
+	return pubkey, nil
+}
+
+// coseAlgCurve curve required by ecdsa alg
+func coseAlgCurve(alg COSEAlgorithm) elliptic.Curve {
+	switch alg {
+	case COSEAlgES256:
+		return elliptic.P256()
+	case COSEAlgES384:
+		return elliptic.P384()
+	case COSEAlgES512:
+		return elliptic.P521()
+	default:
+		return nil
+	}
+}
+
+// verifySignature verify signature of data by alg
+func verifySignature(alg COSEAlgorithm, pubkey crypto.PublicKey, data, sig []byte) error {
+	switch alg {
+	case COSEAlgES256, COSEAlgES384, COSEAlgES512:
+		ecPubkey, ok := pubkey.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.Errorf("alg %d requires ecdsa key, got %T", alg, pubkey)
+		}
+		if ecPubkey.Curve != coseAlgCurve(alg) {
+			return errors.Errorf("alg %d mismatch curve %s", alg, ecPubkey.Curve.Params().Name)
+		}
+
+		var esig struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(sig, &esig); err != nil || len(rest) != 0 {
+			return errors.Errorf("invalid ecdsa signature")
+		}
+
+		var valid bool
+		switch alg {
+		case COSEAlgES256:
+			valid = gcrypto.VerifyByECDSAWithSHA256(ecPubkey, data, esig.R, esig.S)
+		case COSEAlgES384:
+			hashed := sha512.Sum384(data)
+			valid = ecdsa.Verify(ecPubkey, hashed[:], esig.R, esig.S)
+		default:
+			hashed := sha512.Sum512(data)
+			valid = ecdsa.Verify(ecPubkey, hashed[:], esig.R, esig.S)
+		}
+		if !valid {
+			return errors.Errorf("invalid signature")
+		}
+	case COSEAlgRS256, COSEAlgPS256:
+		rsaPubkey, ok := pubkey.(*rsa.PublicKey)
+		if !ok {
+			return errors.Errorf("alg %d requires rsa key, got %T", alg, pubkey)
+		}
+
+		verify := gcrypto.VerifyByRSAPKCS1v15WithSHA256
+		if alg == COSEAlgPS256 {
+			verify = gcrypto.VerifyByRSAPSSWithSHA256
+		}
+		if err := verify(rsaPubkey, data, sig); err != nil {
+			return errors.Wrap(err, "invalid signature")
+		}
+	case COSEAlgEdDSA:
+		edPubkey, ok := pubkey.(ed25519.PublicKey)
+		if !ok {
+			return errors.Errorf("alg %d requires ed25519 key, got %T", alg, pubkey)
+		}
+
+		// gcrypto's ed25519 helpers sign digest, but WebAuthn signs raw data
+		if !ed25519.Verify(edPubkey, data, sig) {
+			return errors.Errorf("invalid signature")
+		}
+	default:
+		return errors.Errorf("unsupported alg %d", alg)
+	}
+
+	return nil
+}
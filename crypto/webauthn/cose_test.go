@@ -0,0 +1,101 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCOSEKey(t *testing.T) {
+	t.Parallel()
+
+	for _, alg := range []COSEAlgorithm{
+		COSEAlgES256, COSEAlgES384, COSEAlgES512,
+		COSEAlgRS256, COSEAlgPS256, COSEAlgEdDSA,
+	} {
+		authn := newTestAuthenticator(t, alg)
+		pubkey, gotAlg, err := ParseCOSEKey(authn.coseKey())
+		require.NoError(t, err, alg)
+		require.Equal(t, alg, gotAlg)
+		require.True(t, authn.signer.Public().(interface {
+			Equal(x crypto.PublicKey) bool
+		}).Equal(pubkey), alg)
+
+		data := []byte("hello")
+		sig := testSign(t, alg, authn.signer, data)
+		require.NoError(t, verifySignature(alg, pubkey, data, sig), alg)
+		require.Error(t, verifySignature(alg, pubkey, []byte("world"), sig), alg)
+	}
+}
+
+func TestParseCOSEKey_invalid(t *testing.T) {
+	t.Parallel()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	x := ecKey.X.FillBytes(make([]byte, 32))
+	y := ecKey.Y.FillBytes(make([]byte, 32))
+	smallRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	for name, coseKey := range map[string][]byte{
+		"not map":      cborEncode([]any{int64(1)}),
+		"trailing":     append(testCOSEKey(t, COSEAlgES256, ecKey.Public()), 0x00),
+		"missing kty":  cborEncode(cborMap{{coseKeyAlg, COSEAlgES256}}),
+		"missing alg":  cborEncode(cborMap{{coseKeyKty, coseKtyEC2}}),
+		"unknown kty":  cborEncode(cborMap{{coseKeyKty, 4}, {coseKeyAlg, COSEAlgES256}}),
+		"alg mismatch": testCOSEKey(t, COSEAlgES384, ecKey.Public()),
+		"bad curve": cborEncode(cborMap{
+			{coseKeyKty, coseKtyEC2}, {coseKeyAlg, COSEAlgES256},
+			{coseKeyCrvOrN, 8}, {coseKeyXOrE, x}, {coseKeyY, y},
+		}),
+		"short x": cborEncode(cborMap{
+			{coseKeyKty, coseKtyEC2}, {coseKeyAlg, COSEAlgES256},
+			{coseKeyCrvOrN, coseCrvP256}, {coseKeyXOrE, x[1:]}, {coseKeyY, y},
+		}),
+		"not on curve": cborEncode(cborMap{
+			{coseKeyKty, coseKtyEC2}, {coseKeyAlg, COSEAlgES256},
+			{coseKeyCrvOrN, coseCrvP256}, {coseKeyXOrE, x}, {coseKeyY, x},
+		}),
+		"okp alg": cborEncode(cborMap{
+			{coseKeyKty, coseKtyOKP}, {coseKeyAlg, COSEAlgES256},
+			{coseKeyCrvOrN, coseCrvEd25519}, {coseKeyXOrE, make([]byte, ed25519.PublicKeySize)},
+		}),
+		"okp size": cborEncode(cborMap{
+			{coseKeyKty, coseKtyOKP}, {coseKeyAlg, COSEAlgEdDSA},
+			{coseKeyCrvOrN, coseCrvEd25519}, {coseKeyXOrE, make([]byte, 31)},
+		}),
+		"rsa alg":   testCOSEKey(t, COSEAlgES256, &smallRSAKey.PublicKey),
+		"rsa small": testCOSEKey(t, COSEAlgRS256, &smallRSAKey.PublicKey),
+		"rsa e": cborEncode(cborMap{
+			{coseKeyKty, coseKtyRSA}, {coseKeyAlg, COSEAlgRS256},
+			{coseKeyCrvOrN, make([]byte, 256)}, {coseKeyXOrE, []byte{2}},
+		}),
+	} {
+		_, _, err := ParseCOSEKey(coseKey)
+		require.Error(t, err, name)
+	}
+}
+
+func TestVerifySignature_keyMismatch(t *testing.T) {
+	t.Parallel()
+
+	p256 := newTestAuthenticator(t, COSEAlgES256)
+	p384 := newTestAuthenticator(t, COSEAlgES384)
+	ed := newTestAuthenticator(t, COSEAlgEdDSA)
+	data := []byte("hello")
+
+	sig := testSign(t, COSEAlgES256, p256.signer, data)
+	require.ErrorContains(t, verifySignature(COSEAlgES256, p384.signer.Public(), data, sig), "mismatch curve")
+	require.ErrorContains(t, verifySignature(COSEAlgES256, ed.signer.Public(), data, sig), "requires ecdsa key")
+	require.ErrorContains(t, verifySignature(COSEAlgRS256, ed.signer.Public(), data, sig), "requires rsa key")
+	require.ErrorContains(t, verifySignature(COSEAlgEdDSA, p256.signer.Public(), data, sig), "requires ed25519 key")
+	require.ErrorContains(t, verifySignature(COSEAlgorithm(-65535), p256.signer.Public(), data, sig), "unsupported alg")
+	require.ErrorContains(t, verifySignature(COSEAlgES256, p256.signer.Public(), data, []byte("bad")), "invalid ecdsa signature")
+}
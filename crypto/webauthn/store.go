@@ -0,0 +1,108 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+)
+
+var (
+	// ErrCredentialNotFound credential not found in store
+	ErrCredentialNotFound = errors.New("credential not found")
+
+	_ CredentialStore = new(MemoryCredentialStore)
+)
+
+// Credential registered public key credential
+type Credential struct {
+	ID []byte `json:"id"`
+	// PublicKey COSE encoded public key
+	PublicKey  []byte `json:"public_key"`
+	UserHandle []byte `json:"user_handle"`
+	SignCount  uint32 `json:"sign_count"`
+	AAGUID     []byte `json:"aaguid"`
+	// AttestationFormat none or packed
+	AttestationFormat string `json:"attestation_format"`
+	BackupEligible    bool   `json:"backup_eligible"`
+	BackupState       bool   `json:"backup_state"`
+}
+
+// clone deep copy credential
+func (c *Credential) clone() *Credential {
+	cp := *c
+	cp.ID = bytes.Clone(c.ID)
+	cp.PublicKey = bytes.Clone(c.PublicKey)
+	cp.UserHandle = bytes.Clone(c.UserHandle)
+	cp.AAGUID = bytes.Clone(c.AAGUID)
+	return &cp
+}
+
+// CredentialStore pluggable storage of credentials
+type CredentialStore interface {
+	// Get get credential by id, return ErrCredentialNotFound if not exists
+	Get(ctx context.Context, id []byte) (*Credential, error)
+	// Save create or update credential
+	Save(ctx context.Context, cred *Credential) error
+	// ListByUser list credentials of user
+	ListByUser(ctx context.Context, userHandle []byte) ([]*Credential, error)
+}
+
+// MemoryCredentialStore in-memory credential store
+type MemoryCredentialStore struct {
+	mu    sync.RWMutex
+	creds map[string]*Credential
+}
+
+// NewMemoryCredentialStore new in-memory credential store
+func NewMemoryCredentialStore() *MemoryCredentialStore {
+	return &MemoryCredentialStore{
+		creds: map[string]*Credential{},
+	}
+}
+
+// Get get credential by id
+func (s *MemoryCredentialStore) Get(_ context.Context, id []byte) (*Credential, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cred, ok := s.creds[string(id)]
+	if !ok {
+		return nil, errors.WithStack(ErrCredentialNotFound)
+	}
+
+	return cred.clone(), nil
+}
+
+// Save create or update credential
+func (s *MemoryCredentialStore) Save(_ context.Context, cred *Credential) error {
+	if len(cred.ID) == 0 {
+		return errors.Errorf("credential id should not be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.creds[string(cred.ID)] = cred.clone()
+	return nil
+}
+
+// ListByUser list credentials of user
+func (s *MemoryCredentialStore) ListByUser(_ context.Context, userHandle []byte) ([]*Credential, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var creds []*Credential
+	for _, cred := range s.creds {
+		if bytes.Equal(cred.UserHandle, userHandle) {
+			creds = append(creds, cred.clone())
+		}
+	}
+
+	sort.Slice(creds, func(i, j int) bool {
+		return bytes.Compare(creds[i].ID, creds[j].ID) < 0
+	})
+	return creds, nil
+}
@@ -0,0 +1,52 @@
+package webauthn
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryCredentialStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := NewMemoryCredentialStore()
+
+	_, err := store.Get(ctx, []byte("cred-1"))
+	require.True(t, errors.Is(err, ErrCredentialNotFound))
+	require.Error(t, store.Save(ctx, &Credential{}))
+
+	cred := &Credential{
+		ID:         []byte("cred-2"),
+		PublicKey:  []byte("pubkey"),
+		UserHandle: []byte("user-1"),
+		SignCount:  1,
+	}
+	require.NoError(t, store.Save(ctx, cred))
+	require.NoError(t, store.Save(ctx, &Credential{ID: []byte("cred-1"), UserHandle: []byte("user-1")}))
+	require.NoError(t, store.Save(ctx, &Credential{ID: []byte("cred-3"), UserHandle: []byte("user-2")}))
+
+	// stored credential should not be affected by caller
+	cred.SignCount = 100
+	cred.PublicKey[0] = 'x'
+	got, err := store.Get(ctx, []byte("cred-2"))
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), got.SignCount)
+	require.Equal(t, []byte("pubkey"), got.PublicKey)
+
+	got.UserHandle[0] = 'x'
+	got, err = store.Get(ctx, []byte("cred-2"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("user-1"), got.UserHandle)
+
+	creds, err := store.ListByUser(ctx, []byte("user-1"))
+	require.NoError(t, err)
+	require.Len(t, creds, 2)
+	require.Equal(t, []byte("cred-1"), creds[0].ID)
+	require.Equal(t, []byte("cred-2"), creds[1].ID)
+
+	creds, err = store.ListByUser(ctx, []byte("user-3"))
+	require.NoError(t, err)
+	require.Empty(t, creds)
+}
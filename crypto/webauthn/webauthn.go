@@ -0,0 +1,346 @@
+// Package webauthn is a WebAuthn/FIDO2 relying party
+//
+// verify registration (attestation `none` and `packed`) and
+// authentication (assertion) ceremonies, refer to https://www.w3.org/TR/webauthn-2/.
+//
+// challenges are generated by NewChallenge, and should be kept by caller
+// (like in session) until the ceremony is finished.
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+
+	"github.com/Laisky/errors/v2"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	gjson "github.com/Laisky/go-utils/v4/json"
+)
+
+const (
+	challengeSize    = 32
+	maxUserHandleLen = 64
+
+	clientDataTypeCreate = "webauthn.create"
+	clientDataTypeGet    = "webauthn.get"
+)
+
+var (
+	// ErrSignCountInvalid sign count does not increase,
+	// the authenticator may be cloned.
+	ErrSignCountInvalid = errors.New("sign count does not increase")
+)
+
+type rpOption struct {
+	origins                  []string
+	userVerificationRequired bool
+	attestationRoots         *x509.CertPool
+}
+
+func (o *rpOption) applyOpts(opts ...Option) (*rpOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// Option optional arguments for New
+type Option func(*rpOption) error
+
+// WithOrigins set allowed origins, default to `https://<rpID>`
+func WithOrigins(origins ...string) Option {
+	return func(o *rpOption) error {
+		if len(origins) == 0 {
+			return errors.Errorf("origins should not be empty")
+		}
+
+		o.origins = origins
+		return nil
+	}
+}
+
+// WithUserVerificationRequired require user verification, like PIN or biometric
+func WithUserVerificationRequired() Option {
+	return func(o *rpOption) error {
+		o.userVerificationRequired = true
+		return nil
+	}
+}
+
+// WithAttestationRoots only accept packed attestation
+// whose certificate chains to roots, none and self attestation will be rejected.
+func WithAttestationRoots(roots *x509.CertPool) Option {
+	return func(o *rpOption) error {
+		if roots == nil {
+			return errors.Errorf("roots should not be nil")
+		}
+
+		o.attestationRoots = roots
+		return nil
+	}
+}
+
+// RelyingParty WebAuthn relying party
+type RelyingParty struct {
+	opt    *rpOption
+	id     string
+	idHash []byte
+	store  CredentialStore
+}
+
+// New new relying party
+//
+// # Args
+//   - rpID: relying party id, usually the domain, like `example.com`
+//   - store: storage of registered credentials
+func New(rpID string, store CredentialStore, opts ...Option) (*RelyingParty, error) {
+	if rpID == "" {
+		return nil, errors.Errorf("rpID should not be empty")
+	}
+	if store == nil {
+		return nil, errors.Errorf("store should not be nil")
+	}
+
+	opt, err := new(rpOption).applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+	if len(opt.origins) == 0 {
+		opt.origins = []string{"https://" + rpID}
+	}
+
+	idHash := sha256.Sum256([]byte(rpID))
+	return &RelyingParty{
+		opt:    opt,
+		id:     rpID,
+		idHash: idHash[:],
+		store:  store,
+	}, nil
+}
+
+// ID relying party id
+func (rp *RelyingParty) ID() string {
+	return rp.id
+}
+
+// NewChallenge generate random challenge for ceremony
+func NewChallenge() ([]byte, error) {
+	return gutils.SecRandomBytesWithLength(challengeSize)
+}
+
+// AttestationResponse response of navigator.credentials.create(),
+// fields are decoded from base64url.
+type AttestationResponse struct {
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// AssertionResponse response of navigator.credentials.get(),
+// fields are decoded from base64url.
+type AssertionResponse struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	// UserHandle (optional) will be checked if not empty
+	UserHandle []byte
+}
+
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// verifyClientData verify client data, return its hash
+func (rp *RelyingParty) verifyClientData(raw []byte, typ string, challenge []byte) ([]byte, error) {
+	cd := new(collectedClientData)
+	if err := gjson.Unmarshal(raw, cd); err != nil {
+		return nil, errors.Wrap(err, "parse client data")
+	}
+
+	if cd.Type != typ {
+		return nil, errors.Errorf("client data type should be %q, got %q", typ, cd.Type)
+	}
+
+	gotChallenge, err := base64.RawURLEncoding.DecodeString(cd.Challenge)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode challenge")
+	}
+	if len(challenge) == 0 || subtle.ConstantTimeCompare(gotChallenge, challenge) != 1 {
+		return nil, errors.Errorf("challenge mismatch")
+	}
+
+	if !gutils.Contains(rp.opt.origins, cd.Origin) {
+		return nil, errors.Errorf("origin %q is not allowed", cd.Origin)
+	}
+	if cd.CrossOrigin {
+		return nil, errors.Errorf("cross origin is not allowed")
+	}
+
+	hashed := sha256.Sum256(raw)
+	return hashed[:], nil
+}
+
+// verifyAuthData verify rp id hash and user flags
+func (rp *RelyingParty) verifyAuthData(ad *AuthenticatorData) error {
+	if subtle.ConstantTimeCompare(ad.RPIDHash, rp.idHash) != 1 {
+		return errors.Errorf("rp id hash mismatch")
+	}
+	if !ad.Flags.Has(FlagUserPresent) {
+		return errors.Errorf("user is not present")
+	}
+	if rp.opt.userVerificationRequired && !ad.Flags.Has(FlagUserVerified) {
+		return errors.Errorf("user is not verified")
+	}
+
+	return nil
+}
+
+// Register verify registration ceremony, save and return new credential
+//
+// # Args
+//   - userHandle: user id, at most 64 bytes, should not contain personal information
+//   - challenge: challenge sent to client
+func (rp *RelyingParty) Register(ctx context.Context,
+	userHandle, challenge []byte, resp *AttestationResponse) (*Credential, error) {
+	if len(userHandle) == 0 || len(userHandle) > maxUserHandleLen {
+		return nil, errors.Errorf("user handle should be 1~%d bytes", maxUserHandleLen)
+	}
+
+	clientDataHash, err := rp.verifyClientData(resp.ClientDataJSON, clientDataTypeCreate, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := parseAttestationObject(resp.AttestationObject)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse attestation object")
+	}
+
+	ad := obj.authData
+	if err = rp.verifyAuthData(ad); err != nil {
+		return nil, err
+	}
+	if !ad.Flags.Has(FlagAttestedCredentialData) || len(ad.CredentialID) == 0 {
+		return nil, errors.Errorf("missing attested credential data")
+	}
+	if _, _, err = ParseCOSEKey(ad.CredentialPublicKey); err != nil {
+		return nil, errors.Wrap(err, "parse credential public key")
+	}
+
+	certs, err := obj.verify(clientDataHash)
+	if err != nil {
+		return nil, errors.Wrapf(err, "verify %s attestation", obj.format)
+	}
+	if err = rp.verifyAttestationTrust(certs); err != nil {
+		return nil, err
+	}
+
+	if _, err = rp.store.Get(ctx, ad.CredentialID); err == nil {
+		return nil, errors.Errorf("credential already registered")
+	} else if !errors.Is(err, ErrCredentialNotFound) {
+		return nil, errors.Wrap(err, "get credential")
+	}
+
+	cred := &Credential{
+		ID:                bytes.Clone(ad.CredentialID),
+		PublicKey:         bytes.Clone(ad.CredentialPublicKey),
+		UserHandle:        bytes.Clone(userHandle),
+		SignCount:         ad.SignCount,
+		AAGUID:            bytes.Clone(ad.AAGUID),
+		AttestationFormat: obj.format,
+		BackupEligible:    ad.Flags.Has(FlagBackupEligible),
+		BackupState:       ad.Flags.Has(FlagBackupState),
+	}
+	if err = rp.store.Save(ctx, cred); err != nil {
+		return nil, errors.Wrap(err, "save credential")
+	}
+
+	return cred, nil
+}
+
+// verifyAttestationTrust verify attestation certificates chain to roots
+func (rp *RelyingParty) verifyAttestationTrust(certs []*x509.Certificate) error {
+	if rp.opt.attestationRoots == nil {
+		return nil
+	}
+	if len(certs) == 0 {
+		return errors.Errorf("attestation certificate is required")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         rp.opt.attestationRoots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return errors.Wrap(err, "verify attestation certificate chain")
+	}
+
+	return nil
+}
+
+// VerifyAssertion verify authentication ceremony, return the updated credential
+//
+// return ErrSignCountInvalid if sign count does not increase.
+func (rp *RelyingParty) VerifyAssertion(ctx context.Context,
+	challenge []byte, resp *AssertionResponse) (*Credential, error) {
+	cred, err := rp.store.Get(ctx, resp.CredentialID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get credential")
+	}
+	if len(resp.UserHandle) != 0 &&
+		subtle.ConstantTimeCompare(resp.UserHandle, cred.UserHandle) != 1 {
+		return nil, errors.Errorf("user handle mismatch")
+	}
+
+	clientDataHash, err := rp.verifyClientData(resp.ClientDataJSON, clientDataTypeGet, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	ad, err := ParseAuthenticatorData(resp.AuthenticatorData)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse authenticator data")
+	}
+	if err = rp.verifyAuthData(ad); err != nil {
+		return nil, err
+	}
+
+	pubkey, alg, err := ParseCOSEKey(cred.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse credential public key")
+	}
+
+	signed := make([]byte, 0, len(resp.AuthenticatorData)+len(clientDataHash))
+	signed = append(signed, resp.AuthenticatorData...)
+	signed = append(signed, clientDataHash...)
+	if err = verifySignature(alg, pubkey, signed, resp.Signature); err != nil {
+		return nil, errors.Wrap(err, "verify assertion signature")
+	}
+
+	if (ad.SignCount != 0 || cred.SignCount != 0) && ad.SignCount <= cred.SignCount {
+		return nil, errors.WithStack(ErrSignCountInvalid)
+	}
+
+	cred.SignCount = ad.SignCount
+	cred.BackupState = ad.Flags.Has(FlagBackupState)
+	if err = rp.store.Save(ctx, cred); err != nil {
+		return nil, errors.Wrap(err, "save credential")
+	}
+
+	return cred, nil
+}
@@ -0,0 +1,895 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/require"
+
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+	gjson "github.com/Laisky/go-utils/v4/json"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+var testAAGUID = []byte("0123456789abcdef")
+
+// testAuthenticator software authenticator for test
+type testAuthenticator struct {
+	t         *testing.T
+	alg       COSEAlgorithm
+	signer    crypto.Signer
+	credID    []byte
+	signCount uint32
+	flags     AuthenticatorFlags
+}
+
+func newTestAuthenticator(t *testing.T, alg COSEAlgorithm) *testAuthenticator {
+	t.Helper()
+
+	var (
+		signer crypto.Signer
+		err    error
+	)
+	switch alg {
+	case COSEAlgES256, COSEAlgES384, COSEAlgES512:
+		signer, err = ecdsa.GenerateKey(coseAlgCurve(alg), rand.Reader)
+	case COSEAlgRS256, COSEAlgPS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case COSEAlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("unsupported alg %d", alg)
+	}
+	require.NoError(t, err)
+
+	credID := make([]byte, 16)
+	_, err = rand.Read(credID)
+	require.NoError(t, err)
+
+	return &testAuthenticator{
+		t:      t,
+		alg:    alg,
+		signer: signer,
+		credID: credID,
+		flags:  FlagUserPresent,
+	}
+}
+
+// coseKey encode public key of authenticator to COSE
+func (a *testAuthenticator) coseKey() []byte {
+	return testCOSEKey(a.t, a.alg, a.signer.Public())
+}
+
+func testCOSEKey(t *testing.T, alg COSEAlgorithm, pubkey crypto.PublicKey) []byte {
+	t.Helper()
+
+	switch pubkey := pubkey.(type) {
+	case *ecdsa.PublicKey:
+		crv := map[string]int{"P-256": coseCrvP256, "P-384": coseCrvP384, "P-521": coseCrvP521}
+		size := (pubkey.Curve.Params().BitSize + 7) / 8
+		return cborEncode(cborMap{
+			{coseKeyKty, coseKtyEC2},
+			{coseKeyAlg, alg},
+			{coseKeyCrvOrN, crv[pubkey.Curve.Params().Name]},
+			{coseKeyXOrE, pubkey.X.FillBytes(make([]byte, size))},
+			{coseKeyY, pubkey.Y.FillBytes(make([]byte, size))},
+		})
+	case *rsa.PublicKey:
+		return cborEncode(cborMap{
+			{coseKeyKty, coseKtyRSA},
+			{coseKeyAlg, alg},
+			{coseKeyCrvOrN, pubkey.N.Bytes()},
+			{coseKeyXOrE, []byte{1, 0, 1}},
+		})
+	case ed25519.PublicKey:
+		return cborEncode(cborMap{
+			{coseKeyKty, coseKtyOKP},
+			{coseKeyAlg, alg},
+			{coseKeyCrvOrN, coseCrvEd25519},
+			{coseKeyXOrE, []byte(pubkey)},
+		})
+	default:
+		t.Fatalf("unsupported public key %T", pubkey)
+		return nil
+	}
+}
+
+// testSign sign data by alg
+func testSign(t *testing.T, alg COSEAlgorithm, signer crypto.Signer, data []byte) []byte {
+	t.Helper()
+
+	var (
+		sig []byte
+		err error
+	)
+	switch alg {
+	case COSEAlgES256, COSEAlgRS256:
+		hashed := sha256.Sum256(data)
+		sig, err = signer.Sign(rand.Reader, hashed[:], crypto.SHA256)
+	case COSEAlgES384:
+		hashed := sha512.Sum384(data)
+		sig, err = signer.Sign(rand.Reader, hashed[:], crypto.SHA384)
+	case COSEAlgES512:
+		hashed := sha512.Sum512(data)
+		sig, err = signer.Sign(rand.Reader, hashed[:], crypto.SHA512)
+	case COSEAlgPS256:
+		sig, err = gcrypto.SignByRSAPSSWithSHA256(signer.(*rsa.PrivateKey), data)
+	case COSEAlgEdDSA:
+		sig, err = signer.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	require.NoError(t, err)
+
+	return sig
+}
+
+// authData build authenticator data
+func (a *testAuthenticator) authData(rpID string, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags := a.flags
+	if attested {
+		flags |= FlagAttestedCredentialData
+	}
+
+	data := append(rpIDHash[:], byte(flags))
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, testAAGUID...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credID)))
+		data = append(data, a.credID...)
+		data = append(data, a.coseKey()...)
+	}
+
+	return data
+}
+
+func testClientData(t *testing.T, typ string, challenge []byte, origin string) []byte {
+	t.Helper()
+
+	data, err := gjson.Marshal(collectedClientData{
+		Type:      typ,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    origin,
+	})
+	require.NoError(t, err)
+
+	return data
+}
+
+// attestNone create registration response with none attestation
+func (a *testAuthenticator) attestNone(challenge []byte) *AttestationResponse {
+	return &AttestationResponse{
+		ClientDataJSON: testClientData(a.t, clientDataTypeCreate, challenge, testOrigin),
+		AttestationObject: cborEncode(cborMap{
+			{"fmt", AttestationFormatNone},
+			{"attStmt", cborMap{}},
+			{"authData", a.authData(testRPID, true)},
+		}),
+	}
+}
+
+// attestPacked create registration response with packed attestation,
+// use self attestation if attKey is nil
+func (a *testAuthenticator) attestPacked(challenge []byte,
+	attKey crypto.Signer, attAlg COSEAlgorithm, x5c ...*x509.Certificate) *AttestationResponse {
+	clientData := testClientData(a.t, clientDataTypeCreate, challenge, testOrigin)
+	clientDataHash := sha256.Sum256(clientData)
+	authData := a.authData(testRPID, true)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+
+	attStmt := cborMap{}
+	if attKey == nil {
+		attStmt = append(attStmt,
+			cborPair{"alg", a.alg},
+			cborPair{"sig", testSign(a.t, a.alg, a.signer, signed)},
+		)
+	} else {
+		var certs []any
+		for _, cert := range x5c {
+			certs = append(certs, cert.Raw)
+		}
+
+		attStmt = append(attStmt,
+			cborPair{"alg", attAlg},
+			cborPair{"sig", testSign(a.t, attAlg, attKey, signed)},
+			cborPair{"x5c", certs},
+		)
+	}
+
+	return &AttestationResponse{
+		ClientDataJSON: clientData,
+		AttestationObject: cborEncode(cborMap{
+			{"fmt", AttestationFormatPacked},
+			{"attStmt", attStmt},
+			{"authData", authData},
+		}),
+	}
+}
+
+// assert create authentication response
+func (a *testAuthenticator) assert(challenge []byte) *AssertionResponse {
+	a.signCount++
+	clientData := testClientData(a.t, clientDataTypeGet, challenge, testOrigin)
+	clientDataHash := sha256.Sum256(clientData)
+	authData := a.authData(testRPID, false)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+
+	return &AssertionResponse{
+		CredentialID:      a.credID,
+		ClientDataJSON:    clientData,
+		AuthenticatorData: authData,
+		Signature:         testSign(a.t, a.alg, a.signer, signed),
+	}
+}
+
+func newTestRP(t *testing.T, opts ...Option) *RelyingParty {
+	t.Helper()
+
+	rp, err := New(testRPID, NewMemoryCredentialStore(), opts...)
+	require.NoError(t, err)
+	return rp
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	_, err := New("", NewMemoryCredentialStore())
+	require.Error(t, err)
+	_, err = New(testRPID, nil)
+	require.Error(t, err)
+	_, err = New(testRPID, NewMemoryCredentialStore(), WithOrigins())
+	require.Error(t, err)
+	_, err = New(testRPID, NewMemoryCredentialStore(), WithAttestationRoots(nil))
+	require.Error(t, err)
+
+	rp := newTestRP(t)
+	require.Equal(t, testRPID, rp.ID())
+	require.Equal(t, []string{testOrigin}, rp.opt.origins)
+
+	challenge, err := NewChallenge()
+	require.NoError(t, err)
+	require.Len(t, challenge, challengeSize)
+}
+
+func TestRelyingParty_Ceremony(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	for _, alg := range []COSEAlgorithm{
+		COSEAlgES256, COSEAlgES384, COSEAlgES512,
+		COSEAlgRS256, COSEAlgPS256, COSEAlgEdDSA,
+	} {
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+			rp := newTestRP(t)
+			authn := newTestAuthenticator(t, alg)
+			userHandle := []byte("user-1")
+
+			// registration
+			challenge, err := NewChallenge()
+			require.NoError(t, err)
+			cred, err := rp.Register(ctx, userHandle, challenge, authn.attestNone(challenge))
+			require.NoError(t, err, alg)
+			require.Equal(t, authn.credID, cred.ID)
+			require.Equal(t, userHandle, cred.UserHandle)
+			require.Equal(t, testAAGUID, cred.AAGUID)
+			require.Equal(t, AttestationFormatNone, cred.AttestationFormat)
+
+			creds, err := rp.store.ListByUser(ctx, userHandle)
+			require.NoError(t, err)
+			require.Len(t, creds, 1)
+
+			// authentication
+			for i := 1; i <= 3; i++ {
+				challenge, err = NewChallenge()
+				require.NoError(t, err)
+				resp := authn.assert(challenge)
+				resp.UserHandle = userHandle
+				cred, err = rp.VerifyAssertion(ctx, challenge, resp)
+				require.NoError(t, err, alg)
+				require.Equal(t, uint32(i), cred.SignCount)
+			}
+		})
+	}
+}
+
+func TestRelyingParty_Register(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	userHandle := []byte("user-1")
+
+	t.Run("packed self attestation", func(t *testing.T) {
+		t.Parallel()
+		rp := newTestRP(t)
+		authn := newTestAuthenticator(t, COSEAlgES256)
+		challenge := []byte("challenge")
+
+		cred, err := rp.Register(ctx, userHandle, challenge, authn.attestPacked(challenge, nil, 0))
+		require.NoError(t, err)
+		require.Equal(t, AttestationFormatPacked, cred.AttestationFormat)
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		t.Parallel()
+		rp := newTestRP(t)
+		authn := newTestAuthenticator(t, COSEAlgEdDSA)
+		challenge := []byte("challenge")
+
+		_, err := rp.Register(ctx, userHandle, challenge, authn.attestNone(challenge))
+		require.NoError(t, err)
+		_, err = rp.Register(ctx, []byte("user-2"), challenge, authn.attestNone(challenge))
+		require.ErrorContains(t, err, "already registered")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		rp := newTestRP(t)
+		authn := newTestAuthenticator(t, COSEAlgES256)
+		challenge := []byte("challenge")
+
+		_, err := rp.Register(ctx, nil, challenge, authn.attestNone(challenge))
+		require.ErrorContains(t, err, "user handle")
+		_, err = rp.Register(ctx, make([]byte, 65), challenge, authn.attestNone(challenge))
+		require.ErrorContains(t, err, "user handle")
+
+		// wrong challenge
+		_, err = rp.Register(ctx, userHandle, []byte("other"), authn.attestNone(challenge))
+		require.ErrorContains(t, err, "challenge mismatch")
+		_, err = rp.Register(ctx, userHandle, nil, authn.attestNone(nil))
+		require.ErrorContains(t, err, "challenge mismatch")
+
+		// wrong type
+		resp := authn.attestNone(challenge)
+		resp.ClientDataJSON = testClientData(t, clientDataTypeGet, challenge, testOrigin)
+		_, err = rp.Register(ctx, userHandle, challenge, resp)
+		require.ErrorContains(t, err, "client data type")
+
+		// wrong origin
+		resp = authn.attestNone(challenge)
+		resp.ClientDataJSON = testClientData(t, clientDataTypeCreate, challenge, "https://evil.com")
+		_, err = rp.Register(ctx, userHandle, challenge, resp)
+		require.ErrorContains(t, err, "origin")
+
+		// cross origin
+		resp = authn.attestNone(challenge)
+		resp.ClientDataJSON, err = gjson.Marshal(collectedClientData{
+			Type:        clientDataTypeCreate,
+			Challenge:   base64.RawURLEncoding.EncodeToString(challenge),
+			Origin:      testOrigin,
+			CrossOrigin: true,
+		})
+		require.NoError(t, err)
+		_, err = rp.Register(ctx, userHandle, challenge, resp)
+		require.ErrorContains(t, err, "cross origin")
+
+		// wrong rp id
+		resp = authn.attestNone(challenge)
+		resp.AttestationObject = cborEncode(cborMap{
+			{"fmt", AttestationFormatNone},
+			{"attStmt", cborMap{}},
+			{"authData", authn.authData("evil.com", true)},
+		})
+		_, err = rp.Register(ctx, userHandle, challenge, resp)
+		require.ErrorContains(t, err, "rp id hash")
+
+		// user not present
+		authn.flags = 0
+		_, err = rp.Register(ctx, userHandle, challenge, authn.attestNone(challenge))
+		require.ErrorContains(t, err, "not present")
+		authn.flags = FlagUserPresent
+
+		// missing attested credential data
+		resp = authn.attestNone(challenge)
+		resp.AttestationObject = cborEncode(cborMap{
+			{"fmt", AttestationFormatNone},
+			{"attStmt", cborMap{}},
+			{"authData", authn.authData(testRPID, false)},
+		})
+		_, err = rp.Register(ctx, userHandle, challenge, resp)
+		require.ErrorContains(t, err, "attested credential data")
+
+		// tampered signature
+		resp = authn.attestPacked(challenge, nil, 0)
+		resp.ClientDataJSON = testClientData(t, clientDataTypeCreate, challenge, testOrigin+"/")
+		rp2, err := New(testRPID, NewMemoryCredentialStore(), WithOrigins(testOrigin, testOrigin+"/"))
+		require.NoError(t, err)
+		_, err = rp2.Register(ctx, userHandle, challenge, resp)
+		require.ErrorContains(t, err, "verify self attestation")
+
+		creds, err := rp.store.ListByUser(ctx, userHandle)
+		require.NoError(t, err)
+		require.Empty(t, creds)
+	})
+
+	t.Run("user verification required", func(t *testing.T) {
+		t.Parallel()
+		rp := newTestRP(t, WithUserVerificationRequired())
+		authn := newTestAuthenticator(t, COSEAlgES256)
+		challenge := []byte("challenge")
+
+		_, err := rp.Register(ctx, userHandle, challenge, authn.attestNone(challenge))
+		require.ErrorContains(t, err, "not verified")
+
+		authn.flags |= FlagUserVerified
+		_, err = rp.Register(ctx, userHandle, challenge, authn.attestNone(challenge))
+		require.NoError(t, err)
+
+		authn.flags = FlagUserPresent
+		_, err = rp.VerifyAssertion(ctx, challenge, authn.assert(challenge))
+		require.ErrorContains(t, err, "not verified")
+	})
+
+	t.Run("attestation roots", func(t *testing.T) {
+		t.Parallel()
+		ca := newTestAttestationCA(t)
+		attKey, attCert := ca.issue(t, testAAGUID, packedAttestationOU)
+
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.cert)
+		rp := newTestRP(t, WithAttestationRoots(roots))
+		authn := newTestAuthenticator(t, COSEAlgES256)
+		challenge := []byte("challenge")
+
+		_, err := rp.Register(ctx, userHandle, challenge, authn.attestNone(challenge))
+		require.ErrorContains(t, err, "attestation certificate is required")
+		_, err = rp.Register(ctx, userHandle, challenge, authn.attestPacked(challenge, nil, 0))
+		require.ErrorContains(t, err, "attestation certificate is required")
+
+		// untrusted ca
+		otherCA := newTestAttestationCA(t)
+		otherKey, otherCert := otherCA.issue(t, testAAGUID, packedAttestationOU)
+		_, err = rp.Register(ctx, userHandle, challenge,
+			authn.attestPacked(challenge, otherKey, COSEAlgES256, otherCert))
+		require.ErrorContains(t, err, "certificate chain")
+
+		cred, err := rp.Register(ctx, userHandle, challenge,
+			authn.attestPacked(challenge, attKey, COSEAlgES256, attCert))
+		require.NoError(t, err)
+		require.Equal(t, AttestationFormatPacked, cred.AttestationFormat)
+	})
+}
+
+func TestRelyingParty_VerifyAssertion(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	userHandle := []byte("user-1")
+
+	rp := newTestRP(t)
+	authn := newTestAuthenticator(t, COSEAlgES256)
+	challenge := []byte("challenge")
+	_, err := rp.Register(ctx, userHandle, challenge, authn.attestNone(challenge))
+	require.NoError(t, err)
+
+	t.Run("not found", func(t *testing.T) {
+		resp := authn.assert(challenge)
+		resp.CredentialID = []byte("not-exists")
+		_, err := rp.VerifyAssertion(ctx, challenge, resp)
+		require.True(t, errors.Is(err, ErrCredentialNotFound))
+	})
+
+	t.Run("user handle mismatch", func(t *testing.T) {
+		resp := authn.assert(challenge)
+		resp.UserHandle = []byte("user-2")
+		_, err := rp.VerifyAssertion(ctx, challenge, resp)
+		require.ErrorContains(t, err, "user handle mismatch")
+	})
+
+	t.Run("wrong challenge", func(t *testing.T) {
+		_, err := rp.VerifyAssertion(ctx, []byte("other"), authn.assert(challenge))
+		require.ErrorContains(t, err, "challenge mismatch")
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		resp := authn.assert(challenge)
+		resp.ClientDataJSON = testClientData(t, clientDataTypeCreate, challenge, testOrigin)
+		_, err := rp.VerifyAssertion(ctx, challenge, resp)
+		require.ErrorContains(t, err, "client data type")
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		resp := authn.assert(challenge)
+		resp.Signature[len(resp.Signature)/2] ^= 0xff
+		_, err := rp.VerifyAssertion(ctx, challenge, resp)
+		require.ErrorContains(t, err, "signature")
+
+		resp = authn.assert(challenge)
+		resp.AuthenticatorData[rpIDHashSize] |= byte(FlagBackupState)
+		_, err = rp.VerifyAssertion(ctx, challenge, resp)
+		require.ErrorContains(t, err, "signature")
+	})
+
+	t.Run("sign count", func(t *testing.T) {
+		resp := authn.assert(challenge)
+		cred, err := rp.VerifyAssertion(ctx, challenge, resp)
+		require.NoError(t, err)
+		require.Equal(t, authn.signCount, cred.SignCount)
+
+		// replay
+		_, err = rp.VerifyAssertion(ctx, challenge, resp)
+		require.True(t, errors.Is(err, ErrSignCountInvalid))
+
+		// cloned authenticator
+		authn.signCount -= 2
+		_, err = rp.VerifyAssertion(ctx, challenge, authn.assert(challenge))
+		require.True(t, errors.Is(err, ErrSignCountInvalid))
+
+		authn.signCount += 10
+		cred, err = rp.VerifyAssertion(ctx, challenge, authn.assert(challenge))
+		require.NoError(t, err)
+		require.Equal(t, authn.signCount, cred.SignCount)
+	})
+}
+
+func TestRelyingParty_VerifyAssertion_zeroSignCount(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	// authenticator that does not support sign count always returns 0
+	rp := newTestRP(t)
+	authn := newTestAuthenticator(t, COSEAlgEdDSA)
+	authn.flags |= FlagBackupEligible | FlagBackupState
+	challenge := []byte("challenge")
+	cred, err := rp.Register(ctx, []byte("user-1"), challenge, authn.attestNone(challenge))
+	require.NoError(t, err)
+	require.True(t, cred.BackupEligible)
+	require.True(t, cred.BackupState)
+
+	authn.flags = FlagUserPresent | FlagBackupEligible
+	for i := 0; i < 3; i++ {
+		authn.signCount = 0
+		resp := authn.assert(challenge)
+		authn.signCount = 0
+		resp.AuthenticatorData = authn.authData(testRPID, false)
+		clientDataHash := sha256.Sum256(resp.ClientDataJSON)
+		resp.Signature = testSign(t, authn.alg, authn.signer,
+			append(append([]byte{}, resp.AuthenticatorData...), clientDataHash[:]...))
+
+		cred, err = rp.VerifyAssertion(ctx, challenge, resp)
+		require.NoError(t, err)
+		require.Zero(t, cred.SignCount)
+		require.False(t, cred.BackupState)
+	}
+}
+
+// testAttestationCA ca that issues attestation certificates
+type testAttestationCA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestAttestationCA(t *testing.T) *testAttestationCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test attestation ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testAttestationCA{key: key, cert: cert}
+}
+
+// issue issue attestation certificate,
+// aaguid extension will be omitted if aaguid is nil.
+func (ca *testAttestationCA) issue(t *testing.T,
+	aaguid []byte, ou string) (*ecdsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject: pkix.Name{
+			Country:            []string{"US"},
+			Organization:       []string{"Laisky"},
+			OrganizationalUnit: []string{ou},
+			CommonName:         "test authenticator",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	if aaguid != nil {
+		val, err := asn1.Marshal(aaguid)
+		require.NoError(t, err)
+		tpl.ExtraExtensions = []pkix.Extension{{Id: oidFIDOGenCeAAGUID, Value: val}}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return key, cert
+}
+
+func testDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func testDecodeB64(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// testClientDataChallenge extract challenge from recorded client data
+func testClientDataChallenge(t *testing.T, clientDataJSON []byte) []byte {
+	t.Helper()
+
+	cd := new(collectedClientData)
+	require.NoError(t, gjson.Unmarshal(clientDataJSON, cd))
+	return testDecodeB64(t, cd.Challenge)
+}
+
+// attestation of none ES256 in WebAuthn Level 3 section 16.2
+const (
+	testSpecNoneAttestationObject = "a363666d74646e6f6e656761747453746d74a068617574684461746158a4bfabc37432958b063360d3ad6461c9c4735a" +
+		"e7f8edd46592a5e0f01452b2e4b559000000008446ccb9ab1db374750b2367ff6f3a1f0020f91f391db4c9b2fde0ea70" +
+		"189cba3fb63f579ba6122b33ad94ff3ec330084be4a5010203262001215820afefa16f97ca9b2d23eb86ccb64098d20d" +
+		"b90856062eb249c33a9b672f26df61225820930a56b87a2fca66334b03458abf879717c12cc68ed73290af2e2664796b" +
+		"9220"
+	testSpecNoneClientDataJSON = "7b2274797065223a22776562617574686e2e637265617465222c226368616c6c656e6765223a22414d4d507434557878" +
+		"475453746e63647134313759447742466938767049612d7077386f4f755657345441222c226f726967696e223a226874" +
+		"7470733a2f2f6578616d706c652e6f7267222c2263726f73734f726967696e223a66616c73652c226578747261446174" +
+		"61223a22636c69656e74446174614a534f4e206d617920626520657874656e6465642077697468206164646974696f6e" +
+		"616c206669656c647320696e20746865206675747572652c207375636820617320746869733a20426b5165446a646354" +
+		"427258426941774a544c453551227d"
+)
+
+// TestRelyingParty_specVectors test vectors from WebAuthn Level 3 section 16,
+// https://www.w3.org/TR/webauthn-3/#sctn-test-vectors
+func TestRelyingParty_specVectors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	userHandle := []byte("user-1")
+
+	for name, c := range map[string]struct {
+		attestationObject, clientDataJSON string
+		format                            string
+		credID                            string
+	}{
+		"none ES256": {
+			attestationObject: testSpecNoneAttestationObject,
+			clientDataJSON:    testSpecNoneClientDataJSON,
+			format:            AttestationFormatNone,
+			credID:            "f91f391db4c9b2fde0ea70189cba3fb63f579ba6122b33ad94ff3ec330084be4",
+		},
+		"packed self ES256": {
+			attestationObject: "a363666d74667061636b65646761747453746d74a263616c672663736967584630440220067a20754ab925005dbf3780" +
+				"97c92120031581c73228d1fb4f5b881bcd7da98302207fc7b147558c7c0eba3af18bd9d121fa3d3a26d17fe3f2202721" +
+				"78f473b6006d68617574684461746158a4bfabc37432958b063360d3ad6461c9c4735ae7f8edd46592a5e0f01452b2e4" +
+				"b55d00000000df850e09db6afbdfab51697791506cfc0020455ef34e2043a87db3d4afeb39bbcb6cc32df9347c789a86" +
+				"5ecdca129cbef58ca5010203262001215820eb151c8176b225cc651559fecf07af450fd85802046656b34c18f6cf1938" +
+				"43c5225820927b8aa427a2be1b8834d233a2d34f61f13bfd44119c325d5896e183fee484f2",
+			clientDataJSON: "7b2274797065223a22776562617574686e2e637265617465222c226368616c6c656e6765223a2265476e4374334c5574" +
+				"5936366b336a506a796e6962506b31716e666644616966715a774c33417032392d55222c226f726967696e223a226874" +
+				"7470733a2f2f6578616d706c652e6f7267222c2263726f73734f726967696e223a66616c73652c226578747261446174" +
+				"61223a22636c69656e74446174614a534f4e206d617920626520657874656e6465642077697468206164646974696f6e" +
+				"616c206669656c647320696e20746865206675747572652c207375636820617320746869733a205539685458764b4532" +
+				"55526b4d6e625f307859485667227d",
+			format: AttestationFormatPacked,
+			credID: "455ef34e2043a87db3d4afeb39bbcb6cc32df9347c789a865ecdca129cbef58c",
+		},
+		"packed ES256": {
+			attestationObject: "a363666d74667061636b65646761747453746d74a363616c6726637369675847304502203f19ec4b229f46ab8c45eff2" +
+				"9b904ff10c0390dc40bf1216f04a78f4ceba3425022100fe7041a32759aff05a0f9f26c70a999c7a284451ba89234a1d" +
+				"3483c25e21925b637835638159022530820221308201c8a00302010202110088c220f83c8ef1feafe94deae45faad030" +
+				"0a06082a8648ce3d0403023062311e301c06035504030c15576562417574686e207465737420766563746f7273310c30" +
+				"0a060355040a0c0357334331253023060355040b0c1c41757468656e74696361746f72204174746573746174696f6e20" +
+				"4341310b30090603550406130241413020170d3234303130313030303030305a180f3330323430313031303030303030" +
+				"5a305f311e301c06035504030c15576562417574686e207465737420766563746f7273310c300a060355040a0c035733" +
+				"4331223020060355040b0c1941757468656e74696361746f72204174746573746174696f6e310b300906035504061302" +
+				"41413059301306072a8648ce3d020106082a8648ce3d03010703420004a91ba4389409dd38a428141940ca8feb1ac0d7" +
+				"b4350558104a3777a49322f3798440f378b3398ab2d3bb7bf91322c92eb23556f59ad0a836fec4c7663b0e4dc3a36030" +
+				"5e300c0603551d130101ff04023000300e0603551d0f0101ff040403020780301d0603551d0e04160414a589ba72d060" +
+				"842ab11f74fb246bdedab16f9b9b301f0603551d2304183016801445aff715b0dd786741fee996ebc16547a3931b1e30" +
+				"0a06082a8648ce3d040302034700304402201726b9d85ecd8a5ed51163722ca3a20886fd9b242a0aa0453d442116075d" +
+				"efd502207ef471e530ac87961a88a7f0d0c17b091ffc6b9238d30f79f635b417be5910e768617574684461746158a4bf" +
+				"abc37432958b063360d3ad6461c9c4735ae7f8edd46592a5e0f01452b2e4b54d00000000876ca4f52071c3e9b25509ef" +
+				"2cdf7ed60020c9a6f5b3462d02873fea0c56862234f99f081728084e511bb7760201a89054a5a5010203262001215820" +
+				"1cf27f25da591208a4239c2e324f104f585525479a29edeedd830f48e77aeae522582059e4b7da6c0106e206ce390c93" +
+				"ab98a15a5ec3887e57f0cc2bece803b920c423",
+			clientDataJSON: "7b2274797065223a22776562617574686e2e637265617465222c226368616c6c656e6765223a227752684b5839333442" +
+				"4634543345663153324831706c61325a725751475046746877365356756d56494249222c226f726967696e223a226874" +
+				"7470733a2f2f6578616d706c652e6f7267222c2263726f73734f726967696e223a66616c73652c226578747261446174" +
+				"61223a22636c69656e74446174614a534f4e206d617920626520657874656e6465642077697468206164646974696f6e" +
+				"616c206669656c647320696e20746865206675747572652c207375636820617320746869733a20396138624e596a4b43" +
+				"6757724258552d66436c316167227d",
+			format: AttestationFormatPacked,
+			credID: "c9a6f5b3462d02873fea0c56862234f99f081728084e511bb7760201a89054a5",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			rp, err := New("example.org", NewMemoryCredentialStore())
+			require.NoError(t, err)
+			resp := &AttestationResponse{
+				ClientDataJSON:    testDecodeHex(t, c.clientDataJSON),
+				AttestationObject: testDecodeHex(t, c.attestationObject),
+			}
+			challenge := testClientDataChallenge(t, resp.ClientDataJSON)
+
+			cred, err := rp.Register(ctx, userHandle, challenge, resp)
+			require.NoError(t, err)
+			require.Equal(t, c.format, cred.AttestationFormat)
+			require.Equal(t, testDecodeHex(t, c.credID), cred.ID)
+
+			// tampered client data
+			resp.ClientDataJSON = append(bytes.Clone(resp.ClientDataJSON[:len(resp.ClientDataJSON)-1]), ' ', '}')
+			_, err = rp.Register(ctx, []byte("user-2"), challenge, resp)
+			if c.format == AttestationFormatNone {
+				require.ErrorContains(t, err, "already registered")
+			} else {
+				require.ErrorContains(t, err, "verify packed attestation")
+			}
+		})
+	}
+
+	t.Run("assertion none ES256", func(t *testing.T) {
+		t.Parallel()
+
+		rp, err := New("example.org", NewMemoryCredentialStore())
+		require.NoError(t, err)
+		regResp := &AttestationResponse{
+			ClientDataJSON:    testDecodeHex(t, testSpecNoneClientDataJSON),
+			AttestationObject: testDecodeHex(t, testSpecNoneAttestationObject),
+		}
+		_, err = rp.Register(ctx, userHandle, testClientDataChallenge(t, regResp.ClientDataJSON), regResp)
+		require.NoError(t, err)
+
+		challenge := testDecodeHex(t, "39c0e7521417ba54d43e8dc95174f423dee9bf3cd804ff6d65c857c9abf4d408")
+		resp := &AssertionResponse{
+			CredentialID:      testDecodeHex(t, "f91f391db4c9b2fde0ea70189cba3fb63f579ba6122b33ad94ff3ec330084be4"),
+			AuthenticatorData: testDecodeHex(t, "bfabc37432958b063360d3ad6461c9c4735ae7f8edd46592a5e0f01452b2e4b51900000000"),
+			ClientDataJSON: testDecodeHex(t, "7b2274797065223a22776562617574686e2e676574222c226368616c6c656e6765223a224f63446e55685158756c5455"+
+				"506f334a5558543049393770767a7a59425039745a63685879617630314167222c226f726967696e223a226874747073"+
+				"3a2f2f6578616d706c652e6f7267222c2263726f73734f726967696e223a66616c73657d"),
+			Signature: testDecodeHex(t, "3046022100f50a4e2e4409249c4a853ba361282f09841df4dd4547a13a87780218deffcd380221008480ac0f0b935381"+
+				"74f575bf11a1dd5d78c6e486013f937295ea13653e331e87"),
+		}
+		cred, err := rp.VerifyAssertion(ctx, challenge, resp)
+		require.NoError(t, err)
+		require.Equal(t, userHandle, cred.UserHandle)
+
+		resp.Signature[len(resp.Signature)-1] ^= 1
+		_, err = rp.VerifyAssertion(ctx, challenge, resp)
+		require.ErrorContains(t, err, "verify assertion signature")
+	})
+}
+
+// TestRelyingParty_recorded responses recorded from real authenticators,
+// taken from the test suite of github.com/go-webauthn/webauthn
+func TestRelyingParty_recorded(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	userHandle := []byte("user-1")
+
+	for name, c := range map[string]struct {
+		rpID, origin                      string
+		attestationObject, clientDataJSON string
+		format                            string
+	}{
+		"Titan none ES256": {
+			rpID:   "webauthn.io",
+			origin: "https://webauthn.io",
+			attestationObject: "o2NmbXRkbm9uZWdhdHRTdG10oGhhdXRoRGF0YVjEdKbqkhPJnC90siSSsyDPQCYqlMGpUKA5fyklC2CEHvBBAAAAAAAAAAAA" +
+				"AAAAAAAAAAAAAAAAQOia8u9zP1lVg6Fy7BsUbAVVR6T1g6TctRExl1BLyS3UwJ-RMOpwxlOlvIjt2ZHCxKq_ggcL8dKdlgMc" +
+				"7fEYsEGlAQIDJiABIVgg--n_QvZithDycYmnifk6vMHiwBP6kugn2PlsnvkrcSgiWCBAlBYm2B-rMtQlp5MxGTLoGDHoktxb" +
+				"0p364Hy2BH9U2Q",
+			clientDataJSON: "eyJjaGFsbGVuZ2UiOiJzVnQ0U2NjZU16cUZTbmZBcThoZ0x6Ymx2bzNmYTRfYUZWRWNJRVNISUowIiwib3JpZ2luIjoiaHR0" +
+				"cHM6Ly93ZWJhdXRobi5pbyIsInR5cGUiOiJ3ZWJhdXRobi5jcmVhdGUifQ",
+			format: AttestationFormatNone,
+		},
+		"macOS packed self ES256": {
+			rpID:   "localhost",
+			origin: "http://localhost:9005",
+			attestationObject: "o2NmbXRmcGFja2VkZ2F0dFN0bXSiY2FsZyZjc2lnWEcwRQIhAJgdgw5x8JzE4JfR6x1RBO8eCHNE8eW_L1VTV03zpyL5AiBv" +
+				"8eUzua3XSS3bPYC7m8eXzJhcaRyeGe7UcuqIrDSvC2hhdXRoRGF0YVi3SZYN5YgOjGh0NBcPZHZgW4_krrmihjLHmVzzuoMd" +
+				"l2NFXJE5zK3OAAI1vMYKZIsLJfHwVQMAMwDserxRhiE7ZcI4ahRbwJCZgc0s38BNXQWtX1Ufy7auS9-RSUTXYJF3vOL9_tEx" +
+				"FTQkqaUBAgMmIAEhWCCm9OYidwiIoH9SwVQqUAnH8Gj5ZJ2_qr8gjbg41q4M1SJYIA07XKpHSgS1mE7R1MjotVIQqyHi9WAx" +
+				"GwHQsCteVK2V",
+			clientDataJSON: "eyJjaGFsbGVuZ2UiOiJyV2lleDh4RE9QZmlDZ3lGdTRCTFc2dlZPbVhLZ1B3SHJsTUNnRXM5U0JBIiwib3JpZ2luIjoiaHR0" +
+				"cDovL2xvY2FsaG9zdDo5MDA1IiwidHlwZSI6IndlYmF1dGhuLmNyZWF0ZSJ9",
+			format: AttestationFormatPacked,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			rp, err := New(c.rpID, NewMemoryCredentialStore(), WithOrigins(c.origin))
+			require.NoError(t, err)
+			resp := &AttestationResponse{
+				ClientDataJSON:    testDecodeB64(t, c.clientDataJSON),
+				AttestationObject: testDecodeB64(t, c.attestationObject),
+			}
+			challenge := testClientDataChallenge(t, resp.ClientDataJSON)
+
+			cred, err := rp.Register(ctx, userHandle, challenge, resp)
+			require.NoError(t, err)
+			require.Equal(t, c.format, cred.AttestationFormat)
+
+			other, err := New("example.com", NewMemoryCredentialStore(), WithOrigins(c.origin))
+			require.NoError(t, err)
+			_, err = other.Register(ctx, userHandle, challenge, resp)
+			require.ErrorContains(t, err, "rp id hash mismatch")
+		})
+	}
+
+	t.Run("assertion ES256", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewMemoryCredentialStore()
+		rp, err := New("webauthn.io", store)
+		require.NoError(t, err)
+		credID := testDecodeB64(t, "AI7D5q2P0LS-Fal9ZT7CHM2N5BLbUunF92T8b6iYC199bO2kagSuU05-5dZGqb1SP0A0lyTWng")
+		require.NoError(t, store.Save(ctx, &Credential{
+			ID: credID,
+			PublicKey: testDecodeB64(t, "pQMmIAEhWCAoCF-x0dwEhzQo-ABxHIAgr_5WL6cJceREc81oIwFn7iJYIHEHx8ZhBIE42L26-rSC_3l0ZaWEmsHAKyP9rgsl"+
+				"ApUdAQI"),
+			UserHandle: testDecodeB64(t, "0ToAAAAAAAAAAA"),
+		}))
+
+		resp := &AssertionResponse{
+			CredentialID: credID,
+			ClientDataJSON: testDecodeB64(t, "eyJjaGFsbGVuZ2UiOiJFNFBUY0lIX0hmWDFwQzZTaWdrMVNDOU5BbGdlenROMDQzOXZpOHpfYzlrIiwibmV3X2tleXNfbWF5"+
+				"X2JlX2FkZGVkX2hlcmUiOiJkbyBub3QgY29tcGFyZSBjbGllbnREYXRhSlNPTiBhZ2FpbnN0IGEgdGVtcGxhdGUuIFNlZSBo"+
+				"dHRwczovL2dvby5nbC95YWJQZXgiLCJvcmlnaW4iOiJodHRwczovL3dlYmF1dGhuLmlvIiwidHlwZSI6IndlYmF1dGhuLmdl"+
+				"dCJ9"),
+			AuthenticatorData: testDecodeB64(t, "dKbqkhPJnC90siSSsyDPQCYqlMGpUKA5fyklC2CEHvBFXJJiGa3OAAI1vMYKZIsLJfHwVQMANwCOw-atj9C0vhWpfWU-whzN"+
+				"jeQS21Lpxfdk_G-omAtffWztpGoErlNOfuXWRqm9Uj9ANJck1p6lAQIDJiABIVggKAhfsdHcBIc0KPgAcRyAIK_-Vi-nCXHk"+
+				"RHPNaCMBZ-4iWCBxB8fGYQSBONi9uvq0gv95dGWlhJrBwCsj_a4LJQKVHQ"),
+			Signature:  testDecodeB64(t, "MEUCIBtIVOQxzFYdyWQyxaLR0tik1TnuPhGVhXVSNgFwLmN5AiEAnxXdCq0UeAVGWxOaFcjBZ_mEZoXqNboY5IkQDdlWZYc"),
+			UserHandle: testDecodeB64(t, "0ToAAAAAAAAAAA"),
+		}
+		challenge := testClientDataChallenge(t, resp.ClientDataJSON)
+		cred, err := rp.VerifyAssertion(ctx, challenge, resp)
+		require.NoError(t, err)
+		require.NotZero(t, cred.SignCount)
+
+		// replay is rejected by sign count
+		_, err = rp.VerifyAssertion(ctx, challenge, resp)
+		require.ErrorIs(t, err, ErrSignCountInvalid)
+	})
+}
@@ -1109,7 +1109,9 @@ func (o *x509V3CertOption) applyOpts(opts ...X509CertOption) (
 		// generate serial number by internal generator if not set
 		o.serialNumber = big.NewInt(o.serialNumGenerator.SerialNum())
 	}
-	if o.subject.CommonName == "" {
+	// subject can be empty if SANs are set, refer to RFC-5280 4.2.1.6
+	if o.subject.CommonName == "" &&
+		len(o.dnsNames)+len(o.emailAddresses)+len(o.ipAddresses)+len(o.uris) == 0 {
 		return nil, errors.Errorf("common name must be set")
 	}
 
@@ -1240,13 +1242,17 @@ func WithX509CRLNextUpdate(nextUpdate time.Time) X509CRLOption {
 	}
 }
 
+// oidExtensionReasonCode CRL entry reason code, refer to RFC-5280 5.3.1
+var oidExtensionReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
 // NewX509CRL create and sign CRL
 //
 // # Args
 //
 //   - ca: CA to sign CRL.
 //   - prikey: prikey for CA.
-//   - revokeCerts: certifacates that will be revoked.
+//   - revokeCerts: certifacates that will be revoked,
+//     reason code extension (2.5.29.21) in Extensions is supported.
 //   - WithX509CertSeriaNumber() is required for NewX509CRL.
 //
 // according to [RFC5280 5.2.3], X.509 v3 CRL could have a
@@ -1275,14 +1281,27 @@ func NewX509CRL(ca *x509.Certificate,
 	tpl.ExtraExtensions = ca.ExtraExtensions
 	// tpl.RevokedCertificates = revokeCerts
 	for i := range revokeCerts {
-		tpl.RevokedCertificateEntries = append(
-			tpl.RevokedCertificateEntries,
-			x509.RevocationListEntry{
-				SerialNumber:   revokeCerts[i].SerialNumber,
-				RevocationTime: revokeCerts[i].RevocationTime,
-				Extensions:     revokeCerts[i].Extensions,
-			},
-		)
+		entry := x509.RevocationListEntry{
+			SerialNumber:   revokeCerts[i].SerialNumber,
+			RevocationTime: revokeCerts[i].RevocationTime,
+		}
+
+		// Extensions is ignored when marshaling, and reason code
+		// should be set by ReasonCode field instead of extension
+		for _, ext := range revokeCerts[i].Extensions {
+			if !ext.Id.Equal(oidExtensionReasonCode) {
+				entry.ExtraExtensions = append(entry.ExtraExtensions, ext)
+				continue
+			}
+
+			var reason asn1.Enumerated
+			if _, err = asn1.Unmarshal(ext.Value, &reason); err != nil {
+				return nil, errors.Wrap(err, "parse reason code")
+			}
+			entry.ReasonCode = int(reason)
+		}
+
+		tpl.RevokedCertificateEntries = append(tpl.RevokedCertificateEntries, entry)
 	}
 
 	return x509.CreateRevocationList(rand.Reader, tpl, ca, Privkey2Signer(prikey))
@@ -2,6 +2,7 @@ package crypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
@@ -138,6 +139,27 @@ func TestNewX509CSR(t *testing.T) {
 	csrPrikeyPem, err := Prikey2Pem(csrPrikey)
 	require.NoError(t, err)
 
+	t.Run("sign csr without common name", func(t *testing.T) {
+		t.Parallel()
+		csrder, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			DNSNames: []string{"laisky.com"},
+		}, csrPrikey)
+		require.NoError(t, err)
+
+		newCertDer, err := NewX509CertByCSR(ca, prikey, csrder)
+		require.NoError(t, err)
+		newCert, err := Der2Cert(newCertDer)
+		require.NoError(t, err)
+		require.Empty(t, newCert.Subject.CommonName)
+		require.Equal(t, []string{"laisky.com"}, newCert.DNSNames)
+
+		// neither common name nor SANs
+		csrder, err = x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, csrPrikey)
+		require.NoError(t, err)
+		_, err = NewX509CertByCSR(ca, prikey, csrder)
+		require.ErrorContains(t, err, "common name must be set")
+	})
+
 	t.Run("sign ca-csr with no options", func(t *testing.T) {
 		t.Parallel()
 		csrder, err := NewX509CSR(csrPrikey,
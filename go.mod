@@ -26,11 +26,13 @@ require (
 	github.com/klauspost/pgzip v1.2.6
 	github.com/monnand/dhkx v0.0.0-20180522003156-9e5b033f1ac4
 	github.com/niclabs/tcrsa v0.0.5
+	github.com/pavlo-v-chernykh/keystore-go/v4 v4.5.0
 	github.com/rivo/duplo v0.0.0-20220703183130-751e882e6b83
 	github.com/spf13/cobra v1.8.1
 	github.com/stretchr/testify v1.9.0
 	github.com/tailscale/hujson v0.0.0-20241010212012-29efb4a0184b
 	github.com/xlzd/gotp v0.1.0
+	github.com/zeebo/blake3 v0.2.4
 	go.dedis.ch/kyber/v3 v3.1.0
 	go.uber.org/automaxprocs v1.6.0
 	golang.org/x/crypto v0.28.0
@@ -38,6 +40,7 @@ require (
 	golang.org/x/term v0.25.0
 	golang.org/x/time v0.3.0
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
+	software.sslmate.com/src/go-pkcs12 v0.7.3
 )
 
 require (
@@ -45,6 +48,7 @@ require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/klauspost/compress v1.17.11 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.12 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646 // indirect
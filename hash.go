@@ -10,9 +10,15 @@ import (
 	"hash"
 	"io"
 	"os"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/Laisky/errors/v2"
 	"github.com/cespare/xxhash"
+	"github.com/zeebo/blake3"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
 
 	"github.com/Laisky/go-utils/v4/log"
 )
@@ -48,6 +54,10 @@ type HashTypeInterface interface {
 }
 
 // HashType hashs
+//
+// the hasher of HashType is looked up from the registry,
+// builtin types are registered by default,
+// more types can be registered by RegisterHashType.
 type HashType string
 
 // String name of hash
@@ -57,21 +67,27 @@ func (h HashType) String() string {
 
 // Hasher new hasher by hash type
 func (h HashType) Hasher() (hash.Hash, error) {
-	switch h {
-	case HashTypeMD5:
+	newHasher, name, ok := lookupHashType(string(h))
+	if !ok {
+		return nil, errors.Errorf("unknon hasher %q", h.String())
+	}
+
+	if name == HashTypeMD5 {
 		log.Shared.Warn("md5 is not safe or fast, use sha256 instead")
-		return md5.New(), nil
-	case HashTypeSha1:
-		return sha1.New(), nil
-	case HashTypeSha256:
-		return sha256.New(), nil
-	case HashTypeSha512:
-		return sha512.New(), nil
-	case HashTypeXxhash:
-		return xxhash.New(), nil
 	}
 
-	return nil, errors.Errorf("unknon hasher %q", h.String())
+	return newHasher(), nil
+}
+
+// UnmarshalText parse hash type from text, like `sha3-256`
+func (h *HashType) UnmarshalText(text []byte) error {
+	t, err := ParseHashType(string(text))
+	if err != nil {
+		return errors.Wrap(err, "parse hash type")
+	}
+
+	*h = t
+	return nil
 }
 
 const (
@@ -85,8 +101,168 @@ const (
 	HashTypeSha512 HashType = "sha512"
 	// HashTypeXxhash Xxhash
 	HashTypeXxhash HashType = "xxhash"
+	// HashTypeSha3_224 SHA3-224
+	HashTypeSha3_224 HashType = "sha3-224"
+	// HashTypeSha3_256 SHA3-256
+	HashTypeSha3_256 HashType = "sha3-256"
+	// HashTypeSha3_384 SHA3-384
+	HashTypeSha3_384 HashType = "sha3-384"
+	// HashTypeSha3_512 SHA3-512
+	HashTypeSha3_512 HashType = "sha3-512"
+	// HashTypeBlake2b_256 BLAKE2b-256
+	HashTypeBlake2b_256 HashType = "blake2b-256"
+	// HashTypeBlake2b_512 BLAKE2b-512
+	HashTypeBlake2b_512 HashType = "blake2b-512"
+	// HashTypeBlake3 BLAKE3 with 256 bits output
+	HashTypeBlake3 HashType = "blake3"
+	// HashTypeSM3 SM3
+	//
+	// registered by package `github.com/Laisky/go-utils/v4/crypto`,
+	// should import it before use.
+	HashTypeSM3 HashType = "sm3"
 )
 
+var hashRegistry = struct {
+	sync.RWMutex
+	hashers map[HashType]func() hash.Hash
+	aliases map[string]HashType
+}{
+	hashers: map[HashType]func() hash.Hash{},
+	aliases: map[string]HashType{},
+}
+
+func init() {
+	for _, t := range []struct {
+		name      HashType
+		newHasher func() hash.Hash
+		aliases   []string
+	}{
+		{HashTypeMD5, md5.New, nil},
+		{HashTypeSha1, sha1.New, []string{"sha-1"}},
+		{HashTypeSha256, sha256.New, []string{"sha-256"}},
+		{HashTypeSha512, sha512.New, []string{"sha-512"}},
+		{HashTypeXxhash, func() hash.Hash { return xxhash.New() }, []string{"xxhash64", "xxh64"}},
+		{HashTypeSha3_224, sha3.New224, nil},
+		{HashTypeSha3_256, sha3.New256, nil},
+		{HashTypeSha3_384, sha3.New384, nil},
+		{HashTypeSha3_512, sha3.New512, nil},
+		{HashTypeBlake2b_256, newBlake2bHasher(blake2b.New256), nil},
+		{HashTypeBlake2b_512, newBlake2bHasher(blake2b.New512), []string{"blake2b"}},
+		{HashTypeBlake3, func() hash.Hash { return blake3.New() }, nil},
+	} {
+		if err := RegisterHashType(t.name, t.newHasher, t.aliases...); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// newBlake2bHasher wrap unkeyed blake2b constructor,
+// which never return error without key.
+func newBlake2bHasher(newFunc func(key []byte) (hash.Hash, error)) func() hash.Hash {
+	return func() hash.Hash {
+		h, err := newFunc(nil)
+		if err != nil {
+			panic(errors.Wrap(err, "new blake2b hasher"))
+		}
+
+		return h
+	}
+}
+
+// normalizeHashTypeName lower case and replace `_` by `-`,
+// so `SHA3_256` and `sha3-256` are the same.
+func normalizeHashTypeName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "_", "-")
+}
+
+// RegisterHashType register hasher constructor for hash type
+//
+// return error if hashType or any alias is already registered
+// as hash type or alias, registered hash types can not be replaced.
+//
+// # Args
+//   - hashType: name of hash, will be normalized to lower case
+//   - newHasher: constructor of hasher
+//   - aliases: other names that can be parsed to hashType by ParseHashType
+func RegisterHashType(hashType HashType, newHasher func() hash.Hash, aliases ...string) error {
+	name := HashType(normalizeHashTypeName(hashType.String()))
+	if name == "" {
+		return errors.Errorf("hash type name should not be empty")
+	}
+	if newHasher == nil {
+		return errors.Errorf("hasher constructor of %q should not be nil", name)
+	}
+
+	hashRegistry.Lock()
+	defer hashRegistry.Unlock()
+
+	names := []string{string(name)}
+	for _, alias := range aliases {
+		if alias = normalizeHashTypeName(alias); alias != "" && !slices.Contains(names, alias) {
+			names = append(names, alias)
+		}
+	}
+	for _, n := range names {
+		if _, ok := hashRegistry.hashers[HashType(n)]; ok {
+			return errors.Errorf("hash type %q is already registered", n)
+		}
+		if _, ok := hashRegistry.aliases[n]; ok {
+			return errors.Errorf("hash type alias %q is already registered", n)
+		}
+	}
+
+	hashRegistry.hashers[name] = newHasher
+	for _, alias := range names[1:] {
+		hashRegistry.aliases[alias] = name
+	}
+
+	return nil
+}
+
+// ParseHashType parse registered hash type from string
+//
+// name is case-insensitive, `_` and `-` are interchangeable,
+// aliases are resolved, like `SHA3_256`, `xxhash64`.
+func ParseHashType(name string) (HashType, error) {
+	_, t, ok := lookupHashType(name)
+	if !ok {
+		return "", errors.Errorf("unknown hash type %q", name)
+	}
+
+	return t, nil
+}
+
+// HashTypes list all registered hash types in order
+func HashTypes() []HashType {
+	hashRegistry.RLock()
+	defer hashRegistry.RUnlock()
+
+	types := make([]HashType, 0, len(hashRegistry.hashers))
+	for t := range hashRegistry.hashers {
+		types = append(types, t)
+	}
+
+	slices.Sort(types)
+	return types
+}
+
+func lookupHashType(name string) (newHasher func() hash.Hash, t HashType, ok bool) {
+	hashRegistry.RLock()
+	defer hashRegistry.RUnlock()
+
+	// canonical names take precedence over aliases
+	t = HashType(normalizeHashTypeName(name))
+	if newHasher, ok = hashRegistry.hashers[t]; ok {
+		return newHasher, t, true
+	}
+	if alias, ok := hashRegistry.aliases[string(t)]; ok {
+		t = alias
+	}
+
+	newHasher, ok = hashRegistry.hashers[t]
+	return newHasher, t, ok
+}
+
 // Hash generate signature by hash
 func Hash(hashType HashTypeInterface, content io.Reader) (signature []byte, err error) {
 	hasher, err := hashType.Hasher()
@@ -1,12 +1,18 @@
 package utils
 
 import (
+	"bytes"
+	"crypto/md5"
 	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"strings"
 	"testing"
 
 	"github.com/Laisky/zap"
 	"github.com/stretchr/testify/require"
 
+	"github.com/Laisky/go-utils/v4/json"
 	"github.com/Laisky/go-utils/v4/log"
 )
 
@@ -69,3 +75,96 @@ func ExampleHashXxhashString() {
 	got := HashXxhashString(val)
 	log.Shared.Info("hash", zap.String("got", got))
 }
+
+func TestHashType(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name   string
+		expect string
+	}{
+		{"sha256", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"SHA-256", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"sha3-256", "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532"},
+		{"SHA3_256", "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532"},
+		{"blake2b-256", "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319"},
+		{"blake3", "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+		{"xxhash64", "44bc2cf5ad770999"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			hashType, err := ParseHashType(tc.name)
+			require.NoError(t, err)
+
+			sig, err := Hash(hashType, strings.NewReader("abc"))
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, hex.EncodeToString(sig))
+
+			// HashType can be used without parsing
+			sig, err = Hash(HashType(tc.name), strings.NewReader("abc"))
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, hex.EncodeToString(sig))
+
+			require.NoError(t, HashVerify(hashType, strings.NewReader("abc"), sig))
+			require.Error(t, HashVerify(hashType, strings.NewReader("abd"), sig))
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ParseHashType("sha254")
+		require.ErrorContains(t, err, "unknown hash type")
+
+		_, err = HashType("sha254").Hasher()
+		require.ErrorContains(t, err, "unknon hasher")
+	})
+
+	t.Run("unmarshal", func(t *testing.T) {
+		t.Parallel()
+
+		var cfg struct {
+			Hasher HashType `json:"hasher"`
+		}
+		err := json.NewDecoder(bytes.NewReader([]byte(`{"hasher": "SHA3-512"}`))).Decode(&cfg)
+		require.NoError(t, err)
+		require.Equal(t, HashTypeSha3_512, cfg.Hasher)
+
+		err = json.NewDecoder(bytes.NewReader([]byte(`{"hasher": "sha254"}`))).Decode(&cfg)
+		require.ErrorContains(t, err, "unknown hash type")
+	})
+
+	t.Run("register", func(t *testing.T) {
+		t.Parallel()
+
+		err := RegisterHashType("Test-Sha224", func() hash.Hash { return sha256.New224() }, "test_sha-224")
+		require.NoError(t, err)
+
+		hashType, err := ParseHashType("TEST_SHA-224")
+		require.NoError(t, err)
+		require.Equal(t, HashType("test-sha224"), hashType)
+		require.Contains(t, HashTypes(), hashType)
+
+		sig, err := Hash(hashType, strings.NewReader("abc"))
+		require.NoError(t, err)
+		require.Len(t, sig, sha256.Size224)
+
+		require.Error(t, RegisterHashType("", sha256.New))
+		require.Error(t, RegisterHashType("test-nil", nil))
+
+		// registered names and aliases can not be replaced
+		require.ErrorContains(t, RegisterHashType("SHA256", md5.New), "already registered")
+		require.ErrorContains(t, RegisterHashType("test-md5", md5.New, "sha256"), "already registered")
+		require.ErrorContains(t, RegisterHashType("test-md5", md5.New, "sha-256"), "already registered")
+		require.ErrorContains(t, RegisterHashType("sha-256", md5.New), "already registered")
+		_, err = ParseHashType("test-md5")
+		require.Error(t, err, "failed registration should not take effect")
+
+		sig, err = Hash(HashTypeSha256, strings.NewReader("abc"))
+		require.NoError(t, err)
+		expect := sha256.Sum256([]byte("abc"))
+		require.Equal(t, expect[:], sig)
+	})
+}
@@ -0,0 +1,169 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// checkAsymmetricMethod check whether method is supported asymmetric method
+func checkAsymmetricMethod(method jwt.SigningMethod) error {
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS,
+		*jwt.SigningMethodECDSA, *jwt.SigningMethodEd25519:
+		return nil
+	default:
+		return errors.Errorf("unsupported sign method `%s`", method.Alg())
+	}
+}
+
+// checkKeyMethod check whether pubkey can be used by method,
+// to avoid signing or verifying by unexpected algorithm.
+func checkKeyMethod(method jwt.SigningMethod, pubkey crypto.PublicKey) error {
+	switch method := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if _, ok := pubkey.(*rsa.PublicKey); ok {
+			return nil
+		}
+	case *jwt.SigningMethodECDSA:
+		if pubkey, ok := pubkey.(*ecdsa.PublicKey); ok {
+			if pubkey.Curve.Params().BitSize != method.CurveBits {
+				return errors.Errorf("%s requires %d bits curve, but got %s",
+					method.Alg(), method.CurveBits, pubkey.Curve.Params().Name)
+			}
+
+			return nil
+		}
+	case *jwt.SigningMethodEd25519:
+		if _, ok := pubkey.(ed25519.PublicKey); ok {
+			return nil
+		}
+	}
+
+	return errors.Errorf("key %T cannot be used by %s", pubkey, method.Alg())
+}
+
+// parsePrikeyPem parse private key in pkcs8/pkcs1/sec1 pem
+func parsePrikeyPem(prikeyPem []byte) (crypto.Signer, error) {
+	blk, _ := pem.Decode(prikeyPem)
+	if blk == nil {
+		return nil, errors.Errorf("invalid pem")
+	}
+
+	var (
+		prikey any
+		err    error
+	)
+	if prikey, err = x509.ParsePKCS8PrivateKey(blk.Bytes); err != nil {
+		if prikey, err = x509.ParsePKCS1PrivateKey(blk.Bytes); err != nil {
+			if prikey, err = x509.ParseECPrivateKey(blk.Bytes); err != nil {
+				return nil, errors.Errorf("cannot parse by pkcs8, pkcs1 nor sec1")
+			}
+		}
+	}
+
+	switch prikey := prikey.(type) {
+	case *rsa.PrivateKey:
+		return prikey, nil
+	case *ecdsa.PrivateKey:
+		return prikey, nil
+	case ed25519.PrivateKey:
+		return prikey, nil
+	default:
+		return nil, errors.Errorf("unsupported private key type %T", prikey)
+	}
+}
+
+// parsePubkeyPem parse public key in pkix/pkcs1 pem, or from certificate
+func parsePubkeyPem(pubkeyPem []byte) (crypto.PublicKey, error) {
+	blk, _ := pem.Decode(pubkeyPem)
+	if blk == nil {
+		return nil, errors.Errorf("invalid pem")
+	}
+
+	if cert, err := x509.ParseCertificate(blk.Bytes); err == nil {
+		return cert.PublicKey, nil
+	}
+	if pubkey, err := x509.ParsePKIXPublicKey(blk.Bytes); err == nil {
+		return pubkey, nil
+	}
+	if pubkey, err := x509.ParsePKCS1PublicKey(blk.Bytes); err == nil {
+		return pubkey, nil
+	}
+
+	return nil, errors.Errorf("cannot parse by certificate, pkix nor pkcs1")
+}
+
+// signByKey signing claims by asymmetric method,
+// private key should match method.
+func (e *Type) signByKey(method jwt.SigningMethod,
+	claims jwt.Claims, opts ...DivideOption) (string, error) {
+	if err := checkAsymmetricMethod(method); err != nil {
+		return "", err
+	}
+
+	opt := &divideOpt{
+		pubKey: e.pubKey,
+		priKey: e.priKey,
+	}
+	for _, optf := range opts {
+		if err := optf(opt); err != nil {
+			return "", errors.Wrap(err, "apply optf")
+		}
+	}
+
+	prikey, err := parsePrikeyPem(opt.priKey)
+	if err != nil {
+		return "", errors.Wrap(err, "parse private key")
+	}
+	if err = checkKeyMethod(method, prikey.Public()); err != nil {
+		return "", err
+	}
+
+	return jwt.NewWithClaims(method, claims).SignedString(prikey)
+}
+
+// parseByKey parse token to claims by asymmetric method,
+// token is only accepted if its alg is exactly method.
+func (e *Type) parseByKey(method jwt.SigningMethod,
+	token string, claimsPtr jwt.Claims, opts ...DivideOption) error {
+	if err := checkAsymmetricMethod(method); err != nil {
+		return err
+	}
+
+	opt := &divideOpt{
+		pubKey: e.pubKey,
+		priKey: e.priKey,
+	}
+	for _, optf := range opts {
+		if err := optf(opt); err != nil {
+			return errors.Wrap(err, "apply optf")
+		}
+	}
+
+	pubkey, err := parsePubkeyPem(opt.pubKey)
+	if err != nil {
+		return errors.Wrapf(err, "parse %s public key", method.Alg())
+	}
+	if err = checkKeyMethod(method, pubkey); err != nil {
+		return err
+	}
+
+	if _, err = jwt.ParseWithClaims(token, claimsPtr, func(token *jwt.Token) (any, error) {
+		if token.Method.Alg() != method.Alg() {
+			return nil, errors.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return pubkey, nil
+	}); err != nil {
+		return errors.Wrapf(err, "parse token by %s", method.Alg())
+	}
+
+	return nil
+}
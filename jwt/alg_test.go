@@ -0,0 +1,177 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+)
+
+func testKeyPairPem(t *testing.T, prikey crypto.Signer) (prikeyPem, pubkeyPem []byte) {
+	t.Helper()
+
+	prikeyPem, err := gcrypto.Prikey2Pem(prikey)
+	require.NoError(t, err)
+	pubkeyPem, err = gcrypto.Pubkey2Pem(prikey.Public())
+	require.NoError(t, err)
+	return prikeyPem, pubkeyPem
+}
+
+func TestType_AsymmetricMethods(t *testing.T) {
+	t.Parallel()
+
+	rsaPrikey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p256Prikey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p384Prikey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	p521Prikey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	require.NoError(t, err)
+	_, edPrikey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		method jwt.SigningMethod
+		prikey crypto.Signer
+	}{
+		{SignMethodES256, p256Prikey},
+		{SignMethodES384, p384Prikey},
+		{SignMethodES512, p521Prikey},
+		{SignMethodRS256, rsaPrikey},
+		{SignMethodPS256, rsaPrikey},
+		{SignMethodEdDSA, edPrikey},
+	} {
+		t.Run(tc.method.Alg(), func(t *testing.T) {
+			t.Parallel()
+
+			prikeyPem, pubkeyPem := testKeyPairPem(t, tc.prikey)
+			j, err := New(
+				WithSignMethod(tc.method),
+				WithPriKeyByte(prikeyPem),
+				WithPubKeyByte(pubkeyPem),
+			)
+			require.NoError(t, err)
+
+			token, err := j.Sign(&testJWTClaims{
+				RegisteredClaims: jwt.RegisteredClaims{Subject: "laisky"},
+			})
+			require.NoError(t, err)
+
+			claims := new(testJWTClaims)
+			require.NoError(t, j.ParseClaims(token, claims))
+			require.Equal(t, "laisky", claims.Subject)
+
+			// divide key
+			otherPrikeyPem, otherPubkeyPem := testKeyPairPem(t, p256Prikey)
+			if tc.method != SignMethodES256 {
+				_, err = j.Sign(claims, WithDividePriKey(otherPrikeyPem))
+				require.Error(t, err, "key mismatch method")
+				err = j.ParseClaims(token, claims, WithDividePubKey(otherPubkeyPem))
+				require.Error(t, err, "key mismatch method")
+			}
+		})
+	}
+
+	t.Run("by method", func(t *testing.T) {
+		t.Parallel()
+
+		prikeyPem, pubkeyPem := testKeyPairPem(t, edPrikey)
+		j, err := New(WithPriKeyByte(prikeyPem), WithPubKeyByte(pubkeyPem))
+		require.NoError(t, err)
+
+		token, err := j.SignByEdDSA(&testJWTClaims{})
+		require.NoError(t, err)
+		require.NoError(t, j.ParseClaimsByEdDSA(token, new(testJWTClaims)))
+
+		_, err = j.SignByES256(&testJWTClaims{})
+		require.ErrorContains(t, err, "cannot be used by ES256")
+	})
+}
+
+func TestType_AlgPinning(t *testing.T) {
+	t.Parallel()
+
+	rsaPrikey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	prikeyPem, pubkeyPem := testKeyPairPem(t, rsaPrikey)
+	j, err := New(
+		WithSignMethod(SignMethodRS256),
+		WithPriKeyByte(prikeyPem),
+		WithPubKeyByte(pubkeyPem),
+	)
+	require.NoError(t, err)
+
+	t.Run("hmac by public key", func(t *testing.T) {
+		t.Parallel()
+
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &testJWTClaims{}).
+			SignedString(pubkeyPem)
+		require.NoError(t, err)
+		require.ErrorContains(t, j.ParseClaims(token, new(testJWTClaims)),
+			"unexpected signing method")
+	})
+
+	t.Run("same key different alg", func(t *testing.T) {
+		t.Parallel()
+
+		token, err := j.SignByPS256(&testJWTClaims{})
+		require.NoError(t, err)
+		require.NoError(t, j.ParseClaimsByPS256(token, new(testJWTClaims)))
+		require.ErrorContains(t, j.ParseClaimsByRS256(token, new(testJWTClaims)),
+			"unexpected signing method")
+
+		token, err = jwt.NewWithClaims(jwt.SigningMethodRS512, &testJWTClaims{}).
+			SignedString(rsaPrikey)
+		require.NoError(t, err)
+		require.ErrorContains(t, j.ParseClaims(token, new(testJWTClaims)),
+			"unexpected signing method")
+	})
+
+	t.Run("hmac family", func(t *testing.T) {
+		t.Parallel()
+
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, &testJWTClaims{}).
+			SignedString(secret)
+		require.NoError(t, err)
+
+		j, err := New(WithSecretByte(secret))
+		require.NoError(t, err)
+		require.NoError(t, j.ParseClaimsByHS256(token, new(testJWTClaims)))
+
+		j, err = New(WithSecretByte(secret), WithStrictHS256())
+		require.NoError(t, err)
+		require.ErrorContains(t, j.ParseClaimsByHS256(token, new(testJWTClaims)),
+			"unexpected signing method")
+
+		token, err = j.SignByHS256(&testJWTClaims{})
+		require.NoError(t, err)
+		require.NoError(t, j.ParseClaimsByHS256(token, new(testJWTClaims)))
+	})
+
+	t.Run("none", func(t *testing.T) {
+		t.Parallel()
+
+		token, err := jwt.NewWithClaims(jwt.SigningMethodNone, &testJWTClaims{}).
+			SignedString(jwt.UnsafeAllowNoneSignatureType)
+		require.NoError(t, err)
+		require.Error(t, j.ParseClaims(token, new(testJWTClaims)))
+	})
+
+	t.Run("unsupported method", func(t *testing.T) {
+		t.Parallel()
+
+		j, err := New(WithSignMethod(jwt.SigningMethodHS512), WithSecretByte(secret))
+		require.NoError(t, err)
+		_, err = j.Sign(&testJWTClaims{})
+		require.ErrorContains(t, err, "unsupported sign method")
+	})
+}
@@ -0,0 +1,302 @@
+package jwt
+
+import (
+	"context"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/golang-jwt/jwt/v4"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+const (
+	defaultIssuerAccessTokenTTL  = 15 * time.Minute
+	defaultIssuerRefreshTokenTTL = 7 * 24 * time.Hour
+
+	revocationKeyPrefixJTI    = "jti:"
+	revocationKeyPrefixFamily = "family:"
+)
+
+// TokenType type of session token
+type TokenType string
+
+const (
+	// TokenTypeAccess access token
+	TokenTypeAccess TokenType = "access"
+	// TokenTypeRefresh refresh token
+	TokenTypeRefresh TokenType = "refresh"
+)
+
+var (
+	// ErrTokenRevoked token or its family has been revoked
+	ErrTokenRevoked = errors.New("token has been revoked")
+	// ErrRefreshTokenReused refresh token has been used before,
+	// the whole token family is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// SessionClaims claims of tokens minted by Issuer
+type SessionClaims struct {
+	jwt.RegisteredClaims
+	// FamilyID shared by all tokens rotated from the same login
+	FamilyID  string    `json:"fid"`
+	TokenType TokenType `json:"token_type"`
+}
+
+// TokenPair access token and refresh token
+type TokenPair struct {
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+}
+
+type issuerOption struct {
+	accessTokenTTL,
+	refreshTokenTTL time.Duration
+	issuer string
+	store  RevocationStore
+}
+
+func (o *issuerOption) fillDefault() *issuerOption {
+	o.accessTokenTTL = defaultIssuerAccessTokenTTL
+	o.refreshTokenTTL = defaultIssuerRefreshTokenTTL
+	return o
+}
+
+func (o *issuerOption) applyOpts(opts ...IssuerOption) (*issuerOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.accessTokenTTL > o.refreshTokenTTL {
+		return nil, errors.Errorf("access token ttl should not be longer than refresh token ttl")
+	}
+
+	return o, nil
+}
+
+// IssuerOption optional arguments for NewIssuer
+type IssuerOption func(*issuerOption) error
+
+// WithIssuerAccessTokenTTL set lifetime of access token, default to 15 minutes
+func WithIssuerAccessTokenTTL(ttl time.Duration) IssuerOption {
+	return func(o *issuerOption) error {
+		if ttl <= 0 {
+			return errors.Errorf("ttl should be positive")
+		}
+
+		o.accessTokenTTL = ttl
+		return nil
+	}
+}
+
+// WithIssuerRefreshTokenTTL set lifetime of refresh token, default to 7 days
+func WithIssuerRefreshTokenTTL(ttl time.Duration) IssuerOption {
+	return func(o *issuerOption) error {
+		if ttl <= 0 {
+			return errors.Errorf("ttl should be positive")
+		}
+
+		o.refreshTokenTTL = ttl
+		return nil
+	}
+}
+
+// WithIssuerName set `iss` of tokens, tokens with other `iss` will be rejected
+func WithIssuerName(name string) IssuerOption {
+	return func(o *issuerOption) error {
+		o.issuer = name
+		return nil
+	}
+}
+
+// WithIssuerRevocationStore set store of revoked ids,
+// default to MemoryRevocationStore.
+func WithIssuerRevocationStore(store RevocationStore) IssuerOption {
+	return func(o *issuerOption) error {
+		if store == nil {
+			return errors.Errorf("store should not be nil")
+		}
+
+		o.store = store
+		return nil
+	}
+}
+
+// Issuer mint access/refresh token pairs and rotate refresh tokens
+//
+// every refresh token can only be used once,
+// the whole token family will be revoked if a used refresh token is presented again.
+type Issuer struct {
+	opt *issuerOption
+	jwt JWT
+}
+
+// NewIssuer new issuer
+//
+// # Args
+//   - ctx: lifetime of default in-memory revocation store
+//   - j: to sign and parse tokens
+func NewIssuer(ctx context.Context, j JWT, opts ...IssuerOption) (*Issuer, error) {
+	if j == nil {
+		return nil, errors.Errorf("jwt should not be nil")
+	}
+
+	opt, err := new(issuerOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	if opt.store == nil {
+		if opt.store, err = NewMemoryRevocationStore(ctx, opt.refreshTokenTTL); err != nil {
+			return nil, errors.Wrap(err, "new memory revocation store")
+		}
+	}
+
+	return &Issuer{
+		opt: opt,
+		jwt: j,
+	}, nil
+}
+
+// Issue mint new token pair for subject, as a new token family
+func (i *Issuer) Issue(_ context.Context, subject string) (*TokenPair, error) {
+	if subject == "" {
+		return nil, errors.Errorf("subject should not be empty")
+	}
+
+	return i.issue(subject, gutils.UUID7())
+}
+
+func (i *Issuer) issue(subject, familyID string) (*TokenPair, error) {
+	now := gutils.Clock.GetUTCNow()
+	pair := &TokenPair{
+		AccessTokenExpiresAt:  now.Add(i.opt.accessTokenTTL).Truncate(time.Second),
+		RefreshTokenExpiresAt: now.Add(i.opt.refreshTokenTTL).Truncate(time.Second),
+	}
+
+	var err error
+	if pair.AccessToken, err = i.sign(subject, familyID,
+		TokenTypeAccess, now, pair.AccessTokenExpiresAt); err != nil {
+		return nil, errors.Wrap(err, "sign access token")
+	}
+	if pair.RefreshToken, err = i.sign(subject, familyID,
+		TokenTypeRefresh, now, pair.RefreshTokenExpiresAt); err != nil {
+		return nil, errors.Wrap(err, "sign refresh token")
+	}
+
+	return pair, nil
+}
+
+func (i *Issuer) sign(subject, familyID string, typ TokenType, now, expiresAt time.Time) (string, error) {
+	return i.jwt.Sign(&SessionClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        gutils.UUID7(),
+			Issuer:    i.opt.issuer,
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		FamilyID:  familyID,
+		TokenType: typ,
+	})
+}
+
+// parse verify token's signature, type and revocation
+func (i *Issuer) parse(ctx context.Context, token string, typ TokenType) (*SessionClaims, error) {
+	claims := new(SessionClaims)
+	if err := i.jwt.ParseClaims(token, claims); err != nil {
+		return nil, errors.Wrap(err, "parse token")
+	}
+
+	switch {
+	case claims.TokenType != typ:
+		return nil, errors.Errorf("expect %s token, got %q", typ, claims.TokenType)
+	case claims.ID == "" || claims.FamilyID == "":
+		return nil, errors.Errorf("token should contain jti and fid")
+	case claims.Issuer != i.opt.issuer:
+		return nil, errors.Errorf("unexpected issuer %q", claims.Issuer)
+	case claims.ExpiresAt == nil:
+		return nil, errors.Errorf("token should contain exp")
+	}
+
+	revoked, err := i.opt.store.IsRevoked(ctx, revocationKeyPrefixFamily+claims.FamilyID)
+	if err != nil {
+		return nil, errors.Wrap(err, "check family revocation")
+	}
+	if revoked {
+		return nil, errors.WithStack(ErrTokenRevoked)
+	}
+
+	return claims, nil
+}
+
+// Verify verify access token, return its claims
+func (i *Issuer) Verify(ctx context.Context, accessToken string) (*SessionClaims, error) {
+	return i.parse(ctx, accessToken, TokenTypeAccess)
+}
+
+// Refresh consume refresh token and mint new token pair in the same family
+//
+// return ErrRefreshTokenReused if refresh token has been used before,
+// and the whole family will be revoked.
+func (i *Issuer) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	claims, err := i.parse(ctx, refreshToken, TokenTypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	used, err := i.opt.store.Revoke(ctx, revocationKeyPrefixJTI+claims.ID, remainingTTL(claims))
+	if err != nil {
+		return nil, errors.Wrap(err, "revoke refresh token")
+	}
+	if used {
+		if err = i.RevokeFamily(ctx, claims.FamilyID); err != nil {
+			return nil, errors.Wrap(err, "revoke family of reused token")
+		}
+
+		return nil, errors.WithStack(ErrRefreshTokenReused)
+	}
+
+	return i.issue(claims.Subject, claims.FamilyID)
+}
+
+// Revoke revoke the family of token, like logout.
+// token can be access or refresh token.
+func (i *Issuer) Revoke(ctx context.Context, token string) error {
+	claims := new(SessionClaims)
+	if err := i.jwt.ParseClaims(token, claims); err != nil {
+		return errors.Wrap(err, "parse token")
+	}
+	if claims.FamilyID == "" {
+		return errors.Errorf("token should contain fid")
+	}
+
+	return i.RevokeFamily(ctx, claims.FamilyID)
+}
+
+// RevokeFamily revoke all tokens in family
+func (i *Issuer) RevokeFamily(ctx context.Context, familyID string) error {
+	// tokens in family will expire in refreshTokenTTL at most
+	if _, err := i.opt.store.Revoke(ctx,
+		revocationKeyPrefixFamily+familyID, i.opt.refreshTokenTTL); err != nil {
+		return errors.Wrapf(err, "revoke family %q", familyID)
+	}
+
+	return nil
+}
+
+// remainingTTL time until token expires
+func remainingTTL(claims *SessionClaims) time.Duration {
+	ttl := claims.ExpiresAt.Sub(gutils.Clock.GetUTCNow())
+	if ttl <= 0 {
+		// token just expired, keep it for a while
+		ttl = time.Second
+	}
+
+	return ttl
+}
@@ -0,0 +1,114 @@
+package jwt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func testNewIssuer(t *testing.T, ctx context.Context, opts ...IssuerOption) *Issuer {
+	t.Helper()
+
+	j, err := New(WithSignMethod(SignMethodHS256), WithSecretByte(secret))
+	require.NoError(t, err)
+	issuer, err := NewIssuer(ctx, j, opts...)
+	require.NoError(t, err)
+	return issuer
+}
+
+func TestIssuer(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	issuer := testNewIssuer(t, ctx, WithIssuerName("laisky"))
+
+	_, err := issuer.Issue(ctx, "")
+	require.Error(t, err)
+
+	pair, err := issuer.Issue(ctx, "user")
+	require.NoError(t, err)
+	require.True(t, pair.AccessTokenExpiresAt.Before(pair.RefreshTokenExpiresAt))
+
+	claims, err := issuer.Verify(ctx, pair.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, "user", claims.Subject)
+	require.Equal(t, "laisky", claims.Issuer)
+	require.Equal(t, TokenTypeAccess, claims.TokenType)
+	familyID := claims.FamilyID
+
+	// token type mismatch
+	_, err = issuer.Verify(ctx, pair.RefreshToken)
+	require.ErrorContains(t, err, "expect access token")
+	_, err = issuer.Refresh(ctx, pair.AccessToken)
+	require.ErrorContains(t, err, "expect refresh token")
+
+	// rotate
+	pair2, err := issuer.Refresh(ctx, pair.RefreshToken)
+	require.NoError(t, err)
+	require.NotEqual(t, pair.RefreshToken, pair2.RefreshToken)
+	claims, err = issuer.Verify(ctx, pair2.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, "user", claims.Subject)
+	require.Equal(t, familyID, claims.FamilyID)
+
+	// other family is not affected by reuse
+	otherPair, err := issuer.Issue(ctx, "user")
+	require.NoError(t, err)
+
+	// reuse old refresh token revokes the whole family
+	_, err = issuer.Refresh(ctx, pair.RefreshToken)
+	require.True(t, errors.Is(err, ErrRefreshTokenReused), "%+v", err)
+	_, err = issuer.Verify(ctx, pair2.AccessToken)
+	require.True(t, errors.Is(err, ErrTokenRevoked), "%+v", err)
+	_, err = issuer.Refresh(ctx, pair2.RefreshToken)
+	require.True(t, errors.Is(err, ErrTokenRevoked), "%+v", err)
+
+	_, err = issuer.Verify(ctx, otherPair.AccessToken)
+	require.NoError(t, err)
+
+	// logout
+	require.NoError(t, issuer.Revoke(ctx, otherPair.AccessToken))
+	_, err = issuer.Refresh(ctx, otherPair.RefreshToken)
+	require.True(t, errors.Is(err, ErrTokenRevoked), "%+v", err)
+
+	t.Run("other issuer", func(t *testing.T) {
+		other := testNewIssuer(t, ctx, WithIssuerName("other"))
+		pair, err := other.Issue(ctx, "user")
+		require.NoError(t, err)
+
+		_, err = issuer.Verify(ctx, pair.AccessToken)
+		require.ErrorContains(t, err, "unexpected issuer")
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		issuer := testNewIssuer(t, ctx,
+			WithIssuerAccessTokenTTL(time.Second),
+			WithIssuerRefreshTokenTTL(time.Second),
+		)
+		pair, err := issuer.Issue(ctx, "user")
+		require.NoError(t, err)
+
+		time.Sleep(1100 * time.Millisecond)
+		_, err = issuer.Verify(ctx, pair.AccessToken)
+		require.ErrorContains(t, err, "expired")
+		_, err = issuer.Refresh(ctx, pair.RefreshToken)
+		require.ErrorContains(t, err, "expired")
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		j, err := New(WithSecretByte(secret))
+		require.NoError(t, err)
+
+		_, err = NewIssuer(ctx, nil)
+		require.Error(t, err)
+		_, err = NewIssuer(ctx, j, WithIssuerAccessTokenTTL(time.Hour),
+			WithIssuerRefreshTokenTTL(time.Minute))
+		require.Error(t, err)
+		_, err = NewIssuer(ctx, j, WithIssuerRevocationStore(nil))
+		require.Error(t, err)
+	})
+}
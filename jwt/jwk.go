@@ -0,0 +1,466 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+
+	"github.com/Laisky/errors/v2"
+
+	gjson "github.com/Laisky/go-utils/v4/json"
+)
+
+// JWK key types
+const (
+	// JWKKeyTypeRSA RSA key
+	JWKKeyTypeRSA = "RSA"
+	// JWKKeyTypeEC elliptic curve key
+	JWKKeyTypeEC = "EC"
+	// JWKKeyTypeOKP octet key pair, used by Ed25519
+	JWKKeyTypeOKP = "OKP"
+)
+
+// JWK JSON Web Key, refer to RFC 7517
+//
+// support RSA, ECDSA(P-256/P-384/P-521) and Ed25519 keys,
+// private fields are empty for public key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// Crv curve of EC/OKP key
+	Crv string `json:"crv,omitempty"`
+	// X x coordinate of EC key, or public key of OKP key
+	X string `json:"x,omitempty"`
+	// Y y coordinate of EC key
+	Y string `json:"y,omitempty"`
+
+	// N modulus of RSA key
+	N string `json:"n,omitempty"`
+	// E exponent of RSA key
+	E string `json:"e,omitempty"`
+
+	// D private exponent of RSA key, or private key of EC/OKP key
+	D  string `json:"d,omitempty"`
+	P  string `json:"p,omitempty"`
+	Q  string `json:"q,omitempty"`
+	DP string `json:"dp,omitempty"`
+	DQ string `json:"dq,omitempty"`
+	QI string `json:"qi,omitempty"`
+}
+
+type jwkOption struct {
+	kid, use, alg string
+}
+
+// JWKOption optional arguments for NewJWK
+type JWKOption func(*jwkOption) error
+
+// WithJWKKeyID set kid, default to RFC 7638 thumbprint of key
+func WithJWKKeyID(kid string) JWKOption {
+	return func(o *jwkOption) error {
+		if kid == "" {
+			return errors.Errorf("kid should not be empty")
+		}
+
+		o.kid = kid
+		return nil
+	}
+}
+
+// WithJWKUse set use, like `sig`
+func WithJWKUse(use string) JWKOption {
+	return func(o *jwkOption) error {
+		o.use = use
+		return nil
+	}
+}
+
+// WithJWKAlg set alg that key is intended to be used with, like `ES256`
+func WithJWKAlg(alg string) JWKOption {
+	return func(o *jwkOption) error {
+		o.alg = alg
+		return nil
+	}
+}
+
+// NewJWK new JWK from public key or private key
+//
+// key should be *rsa.PublicKey, *rsa.PrivateKey,
+// *ecdsa.PublicKey, *ecdsa.PrivateKey, ed25519.PublicKey or ed25519.PrivateKey.
+func NewJWK(key any, opts ...JWKOption) (*JWK, error) {
+	opt := new(jwkOption)
+	for _, f := range opts {
+		if err := f(opt); err != nil {
+			return nil, errors.Wrap(err, "apply option")
+		}
+	}
+
+	jwk := &JWK{
+		Use: opt.use,
+		Alg: opt.alg,
+	}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		jwk.setRSAPublicKey(key)
+	case *rsa.PrivateKey:
+		if len(key.Primes) != 2 {
+			return nil, errors.Errorf("only support rsa private key with 2 primes")
+		}
+
+		// calculate CRT values rather than key.Precompute,
+		// caller's key should not be modified
+		p, q := key.Primes[0], key.Primes[1]
+		one := big.NewInt(1)
+		dp := new(big.Int).Mod(key.D, new(big.Int).Sub(p, one))
+		dq := new(big.Int).Mod(key.D, new(big.Int).Sub(q, one))
+		qinv := new(big.Int).ModInverse(q, p)
+		if qinv == nil {
+			return nil, errors.Errorf("invalid rsa private key")
+		}
+
+		jwk.setRSAPublicKey(&key.PublicKey)
+		jwk.D = b64Encode(key.D.Bytes())
+		jwk.P = b64Encode(p.Bytes())
+		jwk.Q = b64Encode(q.Bytes())
+		jwk.DP = b64Encode(dp.Bytes())
+		jwk.DQ = b64Encode(dq.Bytes())
+		jwk.QI = b64Encode(qinv.Bytes())
+	case *ecdsa.PublicKey:
+		if err := jwk.setECDSAPublicKey(key); err != nil {
+			return nil, err
+		}
+	case *ecdsa.PrivateKey:
+		if err := jwk.setECDSAPublicKey(&key.PublicKey); err != nil {
+			return nil, err
+		}
+
+		jwk.D = b64Encode(key.D.FillBytes(make([]byte, (key.Curve.Params().BitSize+7)/8)))
+	case ed25519.PublicKey:
+		jwk.Kty = JWKKeyTypeOKP
+		jwk.Crv = "Ed25519"
+		jwk.X = b64Encode(key)
+	case ed25519.PrivateKey:
+		jwk.Kty = JWKKeyTypeOKP
+		jwk.Crv = "Ed25519"
+		jwk.X = b64Encode(key.Public().(ed25519.PublicKey)) //nolint:forcetypeassert
+		jwk.D = b64Encode(key.Seed())
+	default:
+		return nil, errors.Errorf("unsupported key type %T", key)
+	}
+
+	jwk.Kid = opt.kid
+	if jwk.Kid == "" {
+		thumbprint, err := jwk.Thumbprint()
+		if err != nil {
+			return nil, errors.Wrap(err, "calculate thumbprint")
+		}
+
+		jwk.Kid = thumbprint
+	}
+
+	return jwk, nil
+}
+
+func (k *JWK) setRSAPublicKey(key *rsa.PublicKey) {
+	k.Kty = JWKKeyTypeRSA
+	k.N = b64Encode(key.N.Bytes())
+	k.E = b64Encode(big.NewInt(int64(key.E)).Bytes())
+}
+
+func (k *JWK) setECDSAPublicKey(key *ecdsa.PublicKey) error {
+	crv, err := curveName(key.Curve)
+	if err != nil {
+		return err
+	}
+
+	size := (key.Curve.Params().BitSize + 7) / 8
+	k.Kty = JWKKeyTypeEC
+	k.Crv = crv
+	k.X = b64Encode(key.X.FillBytes(make([]byte, size)))
+	k.Y = b64Encode(key.Y.FillBytes(make([]byte, size)))
+	return nil
+}
+
+func curveName(curve elliptic.Curve) (string, error) {
+	switch curve {
+	case elliptic.P256():
+		return "P-256", nil
+	case elliptic.P384():
+		return "P-384", nil
+	case elliptic.P521():
+		return "P-521", nil
+	default:
+		return "", errors.Errorf("unsupported curve %s", curve.Params().Name)
+	}
+}
+
+func curveByName(crv string) (elliptic.Curve, ecdh.Curve, error) {
+	switch crv {
+	case "P-256":
+		return elliptic.P256(), ecdh.P256(), nil
+	case "P-384":
+		return elliptic.P384(), ecdh.P384(), nil
+	case "P-521":
+		return elliptic.P521(), ecdh.P521(), nil
+	default:
+		return nil, nil, errors.Errorf("unsupported curve %q", crv)
+	}
+}
+
+// IsPrivate whether JWK contains private key
+func (k *JWK) IsPrivate() bool {
+	return k.D != ""
+}
+
+// Public copy of JWK without private fields
+func (k *JWK) Public() *JWK {
+	return &JWK{
+		Kty: k.Kty,
+		Kid: k.Kid,
+		Use: k.Use,
+		Alg: k.Alg,
+		Crv: k.Crv,
+		X:   k.X,
+		Y:   k.Y,
+		N:   k.N,
+		E:   k.E,
+	}
+}
+
+// PublicKey parse public key,
+// return *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case JWKKeyTypeRSA:
+		n, err := b64DecodeInt(k.N)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode n")
+		}
+		e, err := b64DecodeInt(k.E)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode e")
+		}
+		if n.BitLen() < 2048 {
+			return nil, errors.Errorf("rsa key should be at least 2048 bits")
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 || e.Bit(0) == 0 {
+			return nil, errors.Errorf("invalid rsa exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case JWKKeyTypeEC:
+		curve, ecdhCurve, err := curveByName(k.Crv)
+		if err != nil {
+			return nil, err
+		}
+
+		size := (curve.Params().BitSize + 7) / 8
+		x, err := b64Decode(k.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode x")
+		}
+		y, err := b64Decode(k.Y)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode y")
+		}
+		if len(x) != size || len(y) != size {
+			return nil, errors.Errorf("invalid length of coordinates")
+		}
+
+		// validate point is on curve
+		if _, err = ecdhCurve.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, errors.Wrap(err, "invalid ec point")
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case JWKKeyTypeOKP:
+		if k.Crv != "Ed25519" {
+			return nil, errors.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := b64Decode(k.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode x")
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.Errorf("invalid length of ed25519 public key")
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, errors.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// PrivateKey parse private key,
+// return *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey
+func (k *JWK) PrivateKey() (crypto.PrivateKey, error) {
+	if !k.IsPrivate() {
+		return nil, errors.Errorf("jwk does not contain private key")
+	}
+
+	pubkey, err := k.PublicKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "parse public key")
+	}
+
+	switch pubkey := pubkey.(type) {
+	case *rsa.PublicKey:
+		d, err := b64DecodeInt(k.D)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode d")
+		}
+		p, err := b64DecodeInt(k.P)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode p")
+		}
+		q, err := b64DecodeInt(k.Q)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode q")
+		}
+
+		prikey := &rsa.PrivateKey{
+			PublicKey: *pubkey,
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		if err = prikey.Validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid rsa private key")
+		}
+
+		prikey.Precompute()
+		return prikey, nil
+	case *ecdsa.PublicKey:
+		_, ecdhCurve, err := curveByName(k.Crv)
+		if err != nil {
+			return nil, err
+		}
+
+		d, err := b64Decode(k.D)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode d")
+		}
+
+		ecdhPrikey, err := ecdhCurve.NewPrivateKey(d)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid ec private key")
+		}
+
+		size := (pubkey.Curve.Params().BitSize + 7) / 8
+		expectPub := append(append([]byte{4},
+			pubkey.X.FillBytes(make([]byte, size))...),
+			pubkey.Y.FillBytes(make([]byte, size))...)
+		if !bytes.Equal(ecdhPrikey.PublicKey().Bytes(), expectPub) {
+			return nil, errors.Errorf("ec private key does not match public key")
+		}
+
+		return &ecdsa.PrivateKey{
+			PublicKey: *pubkey,
+			D:         new(big.Int).SetBytes(d),
+		}, nil
+	case ed25519.PublicKey:
+		seed, err := b64Decode(k.D)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode d")
+		}
+		if len(seed) != ed25519.SeedSize {
+			return nil, errors.Errorf("invalid length of ed25519 private key")
+		}
+
+		prikey := ed25519.NewKeyFromSeed(seed)
+		if !pubkey.Equal(prikey.Public()) {
+			return nil, errors.Errorf("ed25519 private key does not match public key")
+		}
+
+		return prikey, nil
+	default:
+		return nil, errors.Errorf("unsupported key type %T", pubkey)
+	}
+}
+
+// Thumbprint RFC 7638 thumbprint by SHA-256, encoded in base64url
+func (k *JWK) Thumbprint() (string, error) {
+	// required members in lexicographic order
+	var members any
+	switch k.Kty {
+	case JWKKeyTypeRSA:
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	case JWKKeyTypeEC:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	case JWKKeyTypeOKP:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Crv, k.Kty, k.X}
+	default:
+		return "", errors.Errorf("unsupported key type %q", k.Kty)
+	}
+
+	data, err := gjson.Marshal(members)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal members")
+	}
+
+	digest := sha256.Sum256(data)
+	return b64Encode(digest[:]), nil
+}
+
+// JWKS JSON Web Key Set
+type JWKS struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// Key find key by kid, return nil if not found
+func (s *JWKS) Key(kid string) *JWK {
+	for _, k := range s.Keys {
+		if k.Kid == kid {
+			return k
+		}
+	}
+
+	return nil
+}
+
+func b64Encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func b64Decode(data string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(data)
+}
+
+func b64DecodeInt(data string) (*big.Int, error) {
+	raw, err := b64Decode(data)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(raw) == 0 {
+		return nil, errors.Errorf("empty integer")
+	}
+
+	return new(big.Int).SetBytes(raw), nil
+}
@@ -0,0 +1,135 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	gjson "github.com/Laisky/go-utils/v4/json"
+)
+
+func TestJWK(t *testing.T) {
+	t.Parallel()
+
+	rsaPrikey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edPrikey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	prikeys := []crypto.Signer{rsaPrikey, edPrikey}
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		prikey, err := ecdsa.GenerateKey(curve, rand.Reader)
+		require.NoError(t, err)
+		prikeys = append(prikeys, prikey)
+	}
+
+	for _, prikey := range prikeys {
+		jwk, err := NewJWK(prikey, WithJWKUse("sig"))
+		require.NoError(t, err)
+		require.True(t, jwk.IsPrivate())
+		require.Equal(t, "sig", jwk.Use)
+
+		// kid default to thumbprint, same for public and private key
+		thumbprint, err := jwk.Thumbprint()
+		require.NoError(t, err)
+		require.Equal(t, thumbprint, jwk.Kid)
+		pubJWK, err := NewJWK(prikey.Public(), WithJWKUse("sig"))
+		require.NoError(t, err)
+		require.False(t, pubJWK.IsPrivate())
+		require.Equal(t, jwk.Kid, pubJWK.Kid)
+		require.Equal(t, pubJWK, jwk.Public())
+
+		// json round trip
+		data, err := gjson.Marshal(jwk)
+		require.NoError(t, err)
+		got := new(JWK)
+		require.NoError(t, gjson.Unmarshal(data, got))
+
+		gotPrikey, err := got.PrivateKey()
+		require.NoError(t, err)
+		require.True(t, prikey.(interface{ Equal(crypto.PrivateKey) bool }).Equal(gotPrikey))
+
+		gotPubkey, err := got.Public().PublicKey()
+		require.NoError(t, err)
+		require.True(t, gotPubkey.(interface{ Equal(crypto.PublicKey) bool }).Equal(prikey.Public()))
+
+		_, err = got.Public().PrivateKey()
+		require.Error(t, err)
+	}
+
+	t.Run("thumbprint", func(t *testing.T) {
+		t.Parallel()
+
+		// example of RFC-7638 3.1
+		jwk := &JWK{
+			Kty: JWKKeyTypeRSA,
+			N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECP" +
+				"ebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2Q" +
+				"vzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6" +
+				"WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+			E:   "AQAB",
+			Alg: "RS256",
+			Kid: "2011-04-29",
+		}
+		thumbprint, err := jwk.Thumbprint()
+		require.NoError(t, err)
+		require.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+	})
+
+	t.Run("rsa key not modified", func(t *testing.T) {
+		t.Parallel()
+
+		prikey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		prikey.Precomputed = rsa.PrecomputedValues{}
+
+		jwk, err := NewJWK(prikey)
+		require.NoError(t, err)
+		require.Nil(t, prikey.Precomputed.Dp)
+
+		expect := &rsa.PrivateKey{PublicKey: prikey.PublicKey, D: prikey.D, Primes: prikey.Primes}
+		expect.Precompute()
+		require.Equal(t, b64Encode(expect.Precomputed.Dp.Bytes()), jwk.DP)
+		require.Equal(t, b64Encode(expect.Precomputed.Dq.Bytes()), jwk.DQ)
+		require.Equal(t, b64Encode(expect.Precomputed.Qinv.Bytes()), jwk.QI)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewJWK([]byte("secret"))
+		require.Error(t, err)
+		_, err = NewJWK(edPrikey, WithJWKKeyID(""))
+		require.Error(t, err)
+
+		ecJWK, err := NewJWK(prikeys[2])
+		require.NoError(t, err)
+
+		// point not on curve
+		invalid := *ecJWK
+		invalid.X = invalid.Y
+		_, err = invalid.PublicKey()
+		require.Error(t, err)
+
+		// private key mismatch public key
+		otherJWK, err := NewJWK(prikeys[3])
+		require.NoError(t, err)
+		invalid = *ecJWK
+		invalid.D = otherJWK.D
+		_, err = invalid.PrivateKey()
+		require.Error(t, err)
+
+		invalid = *ecJWK
+		invalid.Crv = "P-224"
+		_, err = invalid.PublicKey()
+		require.Error(t, err)
+
+		_, err = (&JWK{Kty: "oct"}).PublicKey()
+		require.Error(t, err)
+	})
+}
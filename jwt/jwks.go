@@ -0,0 +1,328 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/golang-jwt/jwt/v4"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	gjson "github.com/Laisky/go-utils/v4/json"
+)
+
+const (
+	defaultJWKSCacheTTL           = time.Hour
+	defaultJWKSMinRefreshInterval = time.Minute
+	defaultJWKSFetchTimeout       = 10 * time.Second
+	// maxJWKSBodySize avoid reading huge response from JWKS endpoint
+	maxJWKSBodySize = 1 << 20
+)
+
+// JWKSHandler http handler serving JWKS,
+// only public fields of keys are served.
+type JWKSHandler struct {
+	mu   sync.RWMutex
+	body []byte
+}
+
+// NewJWKSHandler new http handler serving keys
+func NewJWKSHandler(keys ...*JWK) (*JWKSHandler, error) {
+	h := new(JWKSHandler)
+	if err := h.SetKeys(keys...); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// SetKeys replace served keys, for key rotation
+func (h *JWKSHandler) SetKeys(keys ...*JWK) error {
+	jwks := &JWKS{Keys: []*JWK{}}
+	for _, k := range keys {
+		if k.Kid == "" {
+			return errors.Errorf("kid should not be empty")
+		}
+		if jwks.Key(k.Kid) != nil {
+			return errors.Errorf("duplicate kid %q", k.Kid)
+		}
+
+		jwks.Keys = append(jwks.Keys, k.Public())
+	}
+
+	body, err := gjson.Marshal(jwks)
+	if err != nil {
+		return errors.Wrap(err, "marshal jwks")
+	}
+
+	h.mu.Lock()
+	h.body = body
+	h.mu.Unlock()
+	return nil
+}
+
+// ServeHTTP serve JWKS
+func (h *JWKSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.mu.RLock()
+	body := h.body
+	h.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+}
+
+type jwksVerifierOption struct {
+	httpClient         *http.Client
+	cacheTTL           time.Duration
+	minRefreshInterval time.Duration
+}
+
+func (o *jwksVerifierOption) fillDefault() *jwksVerifierOption {
+	o.httpClient = &http.Client{Timeout: defaultJWKSFetchTimeout}
+	o.cacheTTL = defaultJWKSCacheTTL
+	o.minRefreshInterval = defaultJWKSMinRefreshInterval
+	return o
+}
+
+func (o *jwksVerifierOption) applyOpts(opts ...JWKSVerifierOption) (*jwksVerifierOption, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// JWKSVerifierOption optional arguments for NewJWKSVerifier
+type JWKSVerifierOption func(*jwksVerifierOption) error
+
+// WithJWKSHTTPClient set http client to fetch JWKS
+func WithJWKSHTTPClient(client *http.Client) JWKSVerifierOption {
+	return func(o *jwksVerifierOption) error {
+		if client == nil {
+			return errors.Errorf("client should not be nil")
+		}
+
+		o.httpClient = client
+		return nil
+	}
+}
+
+// WithJWKSCacheTTL set how long fetched keys are cached, default to 1 hour
+func WithJWKSCacheTTL(ttl time.Duration) JWKSVerifierOption {
+	return func(o *jwksVerifierOption) error {
+		if ttl <= 0 {
+			return errors.Errorf("ttl should be positive")
+		}
+
+		o.cacheTTL = ttl
+		return nil
+	}
+}
+
+// WithJWKSMinRefreshInterval set minimal interval between two refreshes
+// triggered by unknown kid, default to 1 minute
+func WithJWKSMinRefreshInterval(interval time.Duration) JWKSVerifierOption {
+	return func(o *jwksVerifierOption) error {
+		if interval < 0 {
+			return errors.Errorf("interval should not be negative")
+		}
+
+		o.minRefreshInterval = interval
+		return nil
+	}
+}
+
+// JWKSVerifier verify token by keys from remote JWKS endpoint
+//
+// key is chosen by `kid` in token header, keys are cached in ExpCache,
+// and JWKS will be refetched when an unknown kid is seen.
+type JWKSVerifier struct {
+	opt   *jwksVerifierOption
+	url   string
+	cache *gutils.ExpCache[*JWK]
+
+	// refreshMu serialize refreshes
+	refreshMu   sync.Mutex
+	lastRefresh time.Time
+	// kids keys fetched in last refresh
+	kids []string
+}
+
+// NewJWKSVerifier new verifier, fetch JWKS immediately
+//
+// # Args
+//   - ctx: lifetime of key cache
+//   - jwksURL: url of JWKS endpoint
+func NewJWKSVerifier(ctx context.Context, jwksURL string,
+	opts ...JWKSVerifierOption) (*JWKSVerifier, error) {
+	opt, err := new(jwksVerifierOption).fillDefault().applyOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	v := &JWKSVerifier{
+		opt:   opt,
+		url:   jwksURL,
+		cache: gutils.NewExpCache[*JWK](ctx, opt.cacheTTL),
+	}
+	if err = v.Refresh(ctx); err != nil {
+		return nil, errors.Wrap(err, "fetch jwks")
+	}
+
+	return v, nil
+}
+
+// Refresh fetch JWKS and replace cached keys
+func (v *JWKSVerifier) Refresh(ctx context.Context) error {
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+
+	return v.refresh(ctx)
+}
+
+func (v *JWKSVerifier) refresh(ctx context.Context) error {
+	jwks, err := v.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	var kids []string
+	for _, k := range jwks.Keys {
+		if k.Kid == "" || k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		// ignore unsupported keys
+		if _, err = k.PublicKey(); err != nil {
+			continue
+		}
+
+		v.cache.Store(k.Kid, k.Public())
+		kids = append(kids, k.Kid)
+	}
+
+	// remove keys that are no longer published
+	for _, kid := range v.kids {
+		if jwks.Key(kid) == nil {
+			v.cache.Delete(kid)
+		}
+	}
+
+	v.kids = kids
+	v.lastRefresh = gutils.Clock.GetUTCNow()
+	return nil
+}
+
+func (v *JWKSVerifier) fetch(ctx context.Context) (*JWKS, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "new request")
+	}
+	req.Header.Set("Accept", "application/jwk-set+json, application/json")
+
+	resp, err := v.opt.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "request %q", v.url)
+	}
+	defer gutils.CloseWithLog(resp.Body, nil)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("request %q got status %d", v.url, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSBodySize))
+	if err != nil {
+		return nil, errors.Wrap(err, "read body")
+	}
+
+	jwks := new(JWKS)
+	if err = gjson.Unmarshal(body, jwks); err != nil {
+		return nil, errors.Wrap(err, "decode jwks")
+	}
+
+	return jwks, nil
+}
+
+// Key get key by kid, refetch JWKS if kid is unknown
+func (v *JWKSVerifier) Key(ctx context.Context, kid string) (*JWK, error) {
+	if k, ok := v.cache.Load(kid); ok {
+		return k, nil
+	}
+
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+
+	// maybe refreshed by others
+	if k, ok := v.cache.Load(kid); ok {
+		return k, nil
+	}
+
+	if gutils.Clock.GetUTCNow().Sub(v.lastRefresh) < v.opt.minRefreshInterval {
+		return nil, errors.Errorf("unknown kid %q", kid)
+	}
+
+	if err := v.refresh(ctx); err != nil {
+		return nil, errors.Wrap(err, "refresh jwks")
+	}
+
+	if k, ok := v.cache.Load(kid); ok {
+		return k, nil
+	}
+
+	return nil, errors.Errorf("unknown kid %q", kid)
+}
+
+// Keyfunc choose key by kid, can be used by jwt.Parse
+func (v *JWKSVerifier) Keyfunc(token *jwt.Token) (any, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, errors.Errorf("kid should not be empty")
+	}
+
+	jwk, err := v.Key(context.Background(), kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if jwk.Alg != "" && jwk.Alg != token.Method.Alg() {
+		return nil, errors.Errorf("key %q is for %s, but token is signed by %s",
+			kid, jwk.Alg, token.Method.Alg())
+	}
+
+	pubkey, err := jwk.PublicKey()
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse key %q", kid)
+	}
+
+	if err = checkKeyMethod(token.Method, pubkey); err != nil {
+		return nil, errors.Wrapf(err, "check key %q", kid)
+	}
+
+	return pubkey, nil
+}
+
+// ParseClaims verify token and parse to claims
+func (v *JWKSVerifier) ParseClaims(token string, claimsPtr jwt.Claims) error {
+	if !gutils.IsPtr(claimsPtr) {
+		return errors.New("claimsPtr must be a pointer")
+	}
+
+	if _, err := jwt.ParseWithClaims(token, claimsPtr, v.Keyfunc); err != nil {
+		return errors.Wrap(err, "parse token")
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+
+	gjson "github.com/Laisky/go-utils/v4/json"
+)
+
+func testSignByKid(t *testing.T, method jwt.SigningMethod, kid string, prikey any) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, &testJWTClaims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "laisky"},
+	})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(prikey)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestJWKSHandler(t *testing.T) {
+	t.Parallel()
+
+	prikey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	jwk, err := NewJWK(prikey, WithJWKKeyID("k1"))
+	require.NoError(t, err)
+
+	h, err := NewJWKSHandler(jwk)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jwks", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/jwk-set+json", w.Header().Get("Content-Type"))
+
+	jwks := new(JWKS)
+	require.NoError(t, gjson.Unmarshal(w.Body.Bytes(), jwks))
+	require.Len(t, jwks.Keys, 1)
+	require.Equal(t, "k1", jwks.Keys[0].Kid)
+	require.False(t, jwks.Keys[0].IsPrivate(), "private key should not be served")
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jwks", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	require.Error(t, h.SetKeys(jwk, jwk))
+	require.Error(t, h.SetKeys(&JWK{Kty: JWKKeyTypeEC}))
+}
+
+func TestJWKSVerifier(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ecPrikey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecJWK, err := NewJWK(ecPrikey, WithJWKKeyID("ec"), WithJWKAlg("ES256"))
+	require.NoError(t, err)
+	_, edPrikey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edJWK, err := NewJWK(edPrikey, WithJWKKeyID("ed"))
+	require.NoError(t, err)
+
+	h, err := NewJWKSHandler(ecJWK)
+	require.NoError(t, err)
+	var fetched atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched.Add(1)
+		h.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	verifier, err := NewJWKSVerifier(ctx, ts.URL, WithJWKSMinRefreshInterval(0))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, fetched.Load())
+
+	claims := new(testJWTClaims)
+	err = verifier.ParseClaims(testSignByKid(t, jwt.SigningMethodES256, "ec", ecPrikey), claims)
+	require.NoError(t, err)
+	require.Equal(t, "laisky", claims.Subject)
+	require.EqualValues(t, 1, fetched.Load(), "known kid should be cached")
+
+	// alg pinned by jwk
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = "ec"
+	token.Header["alg"] = jwt.SigningMethodES384.Alg()
+	signed, err := token.SignedString(ecPrikey)
+	require.NoError(t, err)
+	err = verifier.ParseClaims(signed, claims)
+	require.ErrorContains(t, err, "is for ES256")
+	// key type mismatch
+	err = verifier.ParseClaims(testSignByKid(t, jwt.SigningMethodHS256, "ec", []byte("secret")), claims)
+	require.Error(t, err)
+	// no kid
+	err = verifier.ParseClaims(testSignByKid(t, jwt.SigningMethodES256, "", ecPrikey), claims)
+	require.Error(t, err)
+
+	// unknown kid triggers refresh
+	err = verifier.ParseClaims(testSignByKid(t, jwt.SigningMethodEdDSA, "ed", edPrikey), claims)
+	require.ErrorContains(t, err, "unknown kid")
+	require.EqualValues(t, 2, fetched.Load())
+
+	// rotate keys
+	require.NoError(t, h.SetKeys(edJWK))
+	err = verifier.ParseClaims(testSignByKid(t, jwt.SigningMethodEdDSA, "ed", edPrikey), claims)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, fetched.Load())
+
+	// removed key is dropped after refresh
+	err = verifier.ParseClaims(testSignByKid(t, jwt.SigningMethodES256, "ec", ecPrikey), claims)
+	require.Error(t, err)
+
+	t.Run("min refresh interval", func(t *testing.T) {
+		verifier, err := NewJWKSVerifier(ctx, ts.URL)
+		require.NoError(t, err)
+		before := fetched.Load()
+
+		for i := 0; i < 3; i++ {
+			_, err = verifier.Key(ctx, "not-exists")
+			require.Error(t, err)
+		}
+		require.Equal(t, before, fetched.Load())
+	})
+
+	t.Run("invalid endpoint", func(t *testing.T) {
+		notFound := httptest.NewServer(http.NotFoundHandler())
+		defer notFound.Close()
+
+		_, err := NewJWKSVerifier(ctx, notFound.URL)
+		require.Error(t, err)
+	})
+}
@@ -13,13 +13,23 @@ var (
 	SignMethodHS256 = jwt.SigningMethodHS256
 	// SignMethodES256 use ES256 for jwt
 	SignMethodES256 = jwt.SigningMethodES256
+	// SignMethodES384 use ES384 for jwt
+	SignMethodES384 = jwt.SigningMethodES384
+	// SignMethodES512 use ES512 for jwt
+	SignMethodES512 = jwt.SigningMethodES512
 	// SignMethodRS256 use RSA-256 for jwt
 	SignMethodRS256 = jwt.SigningMethodRS256
+	// SignMethodPS256 use RSA-PSS-256 for jwt
+	SignMethodPS256 = jwt.SigningMethodPS256
+	// SignMethodEdDSA use Ed25519 for jwt
+	SignMethodEdDSA = jwt.SigningMethodEdDSA
 
 	defaultSignMethod = SignMethodHS256
 )
 
 // JWT jwt tool to sign & parse(with/without verify) token
+//
+// methods of ES384/ES512/PS256/EdDSA are only provided by *Type.
 type JWT interface {
 	Sign(claims jwt.Claims, opts ...DivideOption) (string, error)
 	SignByHS256(claims jwt.Claims, opts ...DivideOption) (string, error)
@@ -36,11 +46,16 @@ func ParseTokenWithoutValidate(token string, payload jwt.Claims) (err error) {
 	return err
 }
 
-// Type is token utils that support HS256/ES256
+// Type is token utils that support HS256/ES256/ES384/ES512/RS256/PS256/EdDSA
+//
+// asymmetric methods require key matching the method,
+// and token is only accepted if its alg is exactly the method.
+// HS256 accepts any HMAC alg unless WithStrictHS256 is set.
 type Type struct {
 	secret,
 	priKey, pubKey []byte
 	signingMethod jwt.SigningMethod
+	strictHS256   bool
 }
 
 // Option options to setup JWT
@@ -54,6 +69,17 @@ func WithSignMethod(method jwt.SigningMethod) Option {
 	}
 }
 
+// WithStrictHS256 only accept HS256 token in ParseClaimsByHS256
+//
+// by default, ParseClaimsByHS256 accepts HS256/HS384/HS512 tokens
+// to be compatible with previous versions.
+func WithStrictHS256() Option {
+	return func(e *Type) error {
+		e.strictHS256 = true
+		return nil
+	}
+}
+
 // WithSecretByte set jwt symmetric signning key
 func WithSecretByte(secret []byte) Option {
 	return func(e *Type) error {
@@ -127,14 +153,11 @@ func New(opts ...Option) (*Type, error) {
 
 // Sign sign claims to token
 func (e *Type) Sign(claims jwt.Claims, opts ...DivideOption) (string, error) {
-	switch e.signingMethod {
-	case SignMethodHS256:
+	if e.signingMethod == SignMethodHS256 {
 		return e.SignByHS256(claims, opts...)
-	case SignMethodES256:
-		return e.SignByES256(claims, opts...)
 	}
 
-	return "", errors.Errorf("unknown signmethod `%s`", e.signingMethod)
+	return e.signByKey(e.signingMethod, claims, opts...)
 }
 
 // SignByHS256 signing claims by HS256
@@ -154,23 +177,32 @@ func (e *Type) SignByHS256(claims jwt.Claims, opts ...DivideOption) (string, err
 
 // SignByES256 signing claims by ES256
 func (e *Type) SignByES256(claims jwt.Claims, opts ...DivideOption) (string, error) {
-	opt := &divideOpt{
-		pubKey: e.pubKey,
-		priKey: e.priKey,
-	}
-	for _, optf := range opts {
-		if err := optf(opt); err != nil {
-			return "", errors.Wrap(err, "apply optf")
-		}
-	}
+	return e.signByKey(SignMethodES256, claims, opts...)
+}
 
-	token := jwt.NewWithClaims(SignMethodES256, claims)
-	priKey, err := jwt.ParseECPrivateKeyFromPEM(opt.priKey)
-	if err != nil {
-		return "", errors.Wrap(err, "parse private key")
-	}
+// SignByES384 signing claims by ES384
+func (e *Type) SignByES384(claims jwt.Claims, opts ...DivideOption) (string, error) {
+	return e.signByKey(SignMethodES384, claims, opts...)
+}
 
-	return token.SignedString(priKey)
+// SignByES512 signing claims by ES512
+func (e *Type) SignByES512(claims jwt.Claims, opts ...DivideOption) (string, error) {
+	return e.signByKey(SignMethodES512, claims, opts...)
+}
+
+// SignByRS256 signing claims by RS256
+func (e *Type) SignByRS256(claims jwt.Claims, opts ...DivideOption) (string, error) {
+	return e.signByKey(SignMethodRS256, claims, opts...)
+}
+
+// SignByPS256 signing claims by PS256
+func (e *Type) SignByPS256(claims jwt.Claims, opts ...DivideOption) (string, error) {
+	return e.signByKey(SignMethodPS256, claims, opts...)
+}
+
+// SignByEdDSA signing claims by EdDSA(Ed25519)
+func (e *Type) SignByEdDSA(claims jwt.Claims, opts ...DivideOption) (string, error) {
+	return e.signByKey(SignMethodEdDSA, claims, opts...)
 }
 
 // ParseClaims parse token to claims
@@ -179,17 +211,16 @@ func (e *Type) ParseClaims(token string, claimsPtr jwt.Claims, opts ...DivideOpt
 		return errors.New("claimsPtr must be a pointer")
 	}
 
-	switch e.signingMethod {
-	case SignMethodHS256:
+	if e.signingMethod == SignMethodHS256 {
 		return e.ParseClaimsByHS256(token, claimsPtr, opts...)
-	case SignMethodES256:
-		return e.ParseClaimsByES256(token, claimsPtr, opts...)
-	default:
-		return errors.Errorf("unknown sign method `%s`", e.signingMethod)
 	}
+
+	return e.parseByKey(e.signingMethod, token, claimsPtr, opts...)
 }
 
 // ParseClaimsByHS256 parse token to claims by HS256
+//
+// HS384/HS512 tokens are accepted as well, unless WithStrictHS256 is set.
 func (e *Type) ParseClaimsByHS256(token string, claimsPtr jwt.Claims, opts ...DivideOption) error {
 	opt := &divideOpt{
 		secret: e.secret,
@@ -204,6 +235,9 @@ func (e *Type) ParseClaimsByHS256(token string, claimsPtr jwt.Claims, opts ...Di
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
+		if e.strictHS256 && token.Method.Alg() != SignMethodHS256.Alg() {
+			return nil, errors.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
 		return opt.secret, nil
 	}); err != nil {
 		return errors.Wrap(err, "parse token by hs256")
@@ -214,60 +248,30 @@ func (e *Type) ParseClaimsByHS256(token string, claimsPtr jwt.Claims, opts ...Di
 
 // ParseClaimsByES256 parse token to claims by ES256
 func (e *Type) ParseClaimsByES256(token string, claimsPtr jwt.Claims, opts ...DivideOption) error {
-	opt := &divideOpt{
-		pubKey: e.pubKey,
-		priKey: e.priKey,
-	}
-	for _, optf := range opts {
-		if err := optf(opt); err != nil {
-			return errors.Wrap(err, "apply optf")
-		}
-	}
-
-	pubKey, err := jwt.ParseECPublicKeyFromPEM(opt.pubKey)
-	if err != nil {
-		return errors.Wrap(err, "parse es256 public key")
-	}
-
-	if _, err = jwt.ParseWithClaims(token, claimsPtr, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
-			return nil, errors.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
+	return e.parseByKey(SignMethodES256, token, claimsPtr, opts...)
+}
 
-		return pubKey, nil
-	}); err != nil {
-		return errors.Wrap(err, "parse token by es256")
-	}
+// ParseClaimsByES384 parse token to claims by ES384
+func (e *Type) ParseClaimsByES384(token string, claimsPtr jwt.Claims, opts ...DivideOption) error {
+	return e.parseByKey(SignMethodES384, token, claimsPtr, opts...)
+}
 
-	return nil
+// ParseClaimsByES512 parse token to claims by ES512
+func (e *Type) ParseClaimsByES512(token string, claimsPtr jwt.Claims, opts ...DivideOption) error {
+	return e.parseByKey(SignMethodES512, token, claimsPtr, opts...)
 }
 
 // ParseClaimsByRS256 parse token to claims by rs256
 func (e *Type) ParseClaimsByRS256(token string, claimsPtr jwt.Claims, opts ...DivideOption) error {
-	opt := &divideOpt{
-		pubKey: e.pubKey,
-		priKey: e.priKey,
-	}
-	for _, optf := range opts {
-		if err := optf(opt); err != nil {
-			return errors.Wrap(err, "apply optf")
-		}
-	}
-
-	pubKey, err := jwt.ParseRSAPublicKeyFromPEM(opt.pubKey)
-	if err != nil {
-		return errors.Wrap(err, "parse rs256 public key")
-	}
-
-	if _, err = jwt.ParseWithClaims(token, claimsPtr, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, errors.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
+	return e.parseByKey(SignMethodRS256, token, claimsPtr, opts...)
+}
 
-		return pubKey, nil
-	}); err != nil {
-		return errors.Wrap(err, "parse token by rs256")
-	}
+// ParseClaimsByPS256 parse token to claims by PS256
+func (e *Type) ParseClaimsByPS256(token string, claimsPtr jwt.Claims, opts ...DivideOption) error {
+	return e.parseByKey(SignMethodPS256, token, claimsPtr, opts...)
+}
 
-	return nil
+// ParseClaimsByEdDSA parse token to claims by EdDSA(Ed25519)
+func (e *Type) ParseClaimsByEdDSA(token string, claimsPtr jwt.Claims, opts ...DivideOption) error {
+	return e.parseByKey(SignMethodEdDSA, token, claimsPtr, opts...)
 }
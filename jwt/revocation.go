@@ -0,0 +1,72 @@
+package jwt
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+var (
+	_ RevocationStore = new(MemoryRevocationStore)
+)
+
+// RevocationStore pluggable store of revoked ids
+type RevocationStore interface {
+	// Revoke mark id as revoked, id should be kept at least for ttl.
+	//
+	// check and revoke should be atomic,
+	// return revoked=true if id is already revoked.
+	Revoke(ctx context.Context, id string, ttl time.Duration) (revoked bool, err error)
+	// IsRevoked check whether id is revoked
+	IsRevoked(ctx context.Context, id string) (bool, error)
+}
+
+// MemoryRevocationStore in-memory store built on ExpCache
+type MemoryRevocationStore struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	cache *gutils.ExpCache[struct{}]
+}
+
+// NewMemoryRevocationStore new in-memory store
+//
+// # Args
+//   - ctx: lifetime of store
+//   - ttl: how long revoked ids are kept, should not be shorter than any token's lifetime
+func NewMemoryRevocationStore(ctx context.Context, ttl time.Duration) (*MemoryRevocationStore, error) {
+	if ttl <= 0 {
+		return nil, errors.Errorf("ttl should be positive")
+	}
+
+	return &MemoryRevocationStore{
+		ttl:   ttl,
+		cache: gutils.NewExpCache[struct{}](ctx, ttl),
+	}, nil
+}
+
+// Revoke mark id as revoked
+func (s *MemoryRevocationStore) Revoke(_ context.Context, id string, ttl time.Duration) (bool, error) {
+	if ttl > s.ttl {
+		return false, errors.Errorf("ttl %s is longer than store's ttl %s", ttl, s.ttl)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.cache.Load(id); ok {
+		return true, nil
+	}
+
+	s.cache.Store(id, struct{}{})
+	return false, nil
+}
+
+// IsRevoked check whether id is revoked
+func (s *MemoryRevocationStore) IsRevoked(_ context.Context, id string) (bool, error) {
+	_, ok := s.cache.Load(id)
+	return ok, nil
+}
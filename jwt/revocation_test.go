@@ -0,0 +1,65 @@
+package jwt
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRevocationStore(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := NewMemoryRevocationStore(ctx, 0)
+	require.Error(t, err)
+
+	store, err := NewMemoryRevocationStore(ctx, 100*time.Millisecond)
+	require.NoError(t, err)
+
+	revoked, err := store.IsRevoked(ctx, "a")
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	revoked, err = store.Revoke(ctx, "a", 100*time.Millisecond)
+	require.NoError(t, err)
+	require.False(t, revoked)
+	revoked, err = store.Revoke(ctx, "a", 100*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, revoked)
+	revoked, err = store.IsRevoked(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	_, err = store.Revoke(ctx, "b", time.Second)
+	require.ErrorContains(t, err, "longer than store's ttl")
+
+	time.Sleep(200 * time.Millisecond)
+	revoked, err = store.IsRevoked(ctx, "a")
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	t.Run("concurrent revoke", func(t *testing.T) {
+		var (
+			wg       sync.WaitGroup
+			nRevoked atomic.Int32
+		)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				revoked, err := store.Revoke(ctx, "c", 100*time.Millisecond)
+				require.NoError(t, err)
+				if !revoked {
+					nRevoked.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		require.EqualValues(t, 1, nRevoked.Load())
+	})
+}
@@ -0,0 +1,53 @@
+package paseto
+
+import (
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/golang-jwt/jwt/v4"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+var (
+	_ jwt.Claims = new(RegisteredClaims)
+)
+
+// RegisteredClaims registered claims of PASETO,
+// times are encoded in RFC 3339.
+//
+// can be embedded in custom claims.
+type RegisteredClaims struct {
+	Issuer    string     `json:"iss,omitempty"`
+	Subject   string     `json:"sub,omitempty"`
+	Audience  string     `json:"aud,omitempty"`
+	ExpiresAt *time.Time `json:"exp,omitempty"`
+	NotBefore *time.Time `json:"nbf,omitempty"`
+	IssuedAt  *time.Time `json:"iat,omitempty"`
+	ID        string     `json:"jti,omitempty"`
+}
+
+// Valid validate time based claims
+func (c RegisteredClaims) Valid() error {
+	now := gutils.Clock.GetUTCNow()
+	switch {
+	case c.ExpiresAt != nil && !now.Before(*c.ExpiresAt):
+		return errors.Errorf("token is expired")
+	case c.NotBefore != nil && now.Before(*c.NotBefore):
+		return errors.Errorf("token is not valid yet")
+	case c.IssuedAt != nil && now.Before(*c.IssuedAt):
+		return errors.Errorf("token used before issued")
+	}
+
+	return nil
+}
+
+// VerifyAudience check whether aud equals to cmp
+func (c RegisteredClaims) VerifyAudience(cmp string) bool {
+	return c.Audience == cmp
+}
+
+// VerifyIssuer check whether iss equals to cmp
+func (c RegisteredClaims) VerifyIssuer(cmp string) bool {
+	return c.Issuer == cmp
+}
@@ -0,0 +1,37 @@
+package paseto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	gjson "github.com/Laisky/go-utils/v4/json"
+)
+
+func TestRegisteredClaims(t *testing.T) {
+	t.Parallel()
+
+	now := gutils.Clock.GetUTCNow()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	require.NoError(t, new(RegisteredClaims).Valid())
+	require.NoError(t, (&RegisteredClaims{ExpiresAt: &future, NotBefore: &past, IssuedAt: &past}).Valid())
+	require.ErrorContains(t, (&RegisteredClaims{ExpiresAt: &past}).Valid(), "expired")
+	require.ErrorContains(t, (&RegisteredClaims{NotBefore: &future}).Valid(), "not valid yet")
+	require.ErrorContains(t, (&RegisteredClaims{IssuedAt: &future}).Valid(), "before issued")
+
+	claims := &RegisteredClaims{Issuer: "laisky", Audience: "dune"}
+	require.True(t, claims.VerifyIssuer("laisky"))
+	require.False(t, claims.VerifyIssuer("dune"))
+	require.True(t, claims.VerifyAudience("dune"))
+	require.False(t, claims.VerifyAudience(""))
+
+	t.Run("rfc3339", func(t *testing.T) {
+		claims := new(RegisteredClaims)
+		err := gjson.Unmarshal([]byte(`{"exp":"2022-01-01T00:00:00+00:00"}`), claims)
+		require.NoError(t, err)
+		require.True(t, claims.ExpiresAt.Equal(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)))
+	})
+}
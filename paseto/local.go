@@ -0,0 +1,153 @@
+package paseto
+
+import (
+	"crypto/subtle"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	gjson "github.com/Laisky/go-utils/v4/json"
+)
+
+const (
+	// V4LocalKeySize size of v4.local key
+	V4LocalKeySize = 32
+
+	v4LocalNonceSize = 32
+	v4LocalTagSize   = 32
+)
+
+// NewV4LocalKey generate random key for v4.local
+func NewV4LocalKey() ([]byte, error) {
+	return gutils.SecRandomBytesWithLength(V4LocalKeySize)
+}
+
+// EncryptV4Local encrypt claims to v4.local token
+func EncryptV4Local(key []byte, claims any, opts ...Option) (string, error) {
+	opt, err := new(option).applyOpts(opts...)
+	if err != nil {
+		return "", errors.Wrap(err, "apply options")
+	}
+
+	payload, err := gjson.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal claims")
+	}
+
+	nonce, err := gutils.SecRandomBytesWithLength(v4LocalNonceSize)
+	if err != nil {
+		return "", errors.Wrap(err, "generate nonce")
+	}
+
+	return v4LocalEncrypt(key, nonce, payload, opt.footer, opt.implicit)
+}
+
+// DecryptV4Local decrypt v4.local token, then validate claims
+func DecryptV4Local(key []byte, token string, claimsPtr jwt.Claims, opts ...Option) error {
+	opt, err := new(option).applyOpts(opts...)
+	if err != nil {
+		return errors.Wrap(err, "apply options")
+	}
+
+	payload, err := v4LocalDecrypt(key, token, opt.footer, opt.implicit)
+	if err != nil {
+		return err
+	}
+
+	return unmarshalClaims(payload, claimsPtr)
+}
+
+// v4LocalKeys split key to encryption key, counter nonce and authentication key
+func v4LocalKeys(key, nonce []byte) (ek, n2, ak []byte, err error) {
+	if len(key) != V4LocalKeySize {
+		return nil, nil, nil, errors.Errorf("key should be %d bytes", V4LocalKeySize)
+	}
+
+	h, err := blake2b.New(chacha20.KeySize+chacha20.NonceSizeX, key)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "new blake2b")
+	}
+	h.Write([]byte("paseto-encryption-key"))
+	h.Write(nonce)
+	tmp := h.Sum(nil)
+
+	if h, err = blake2b.New256(key); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "new blake2b")
+	}
+	h.Write([]byte("paseto-auth-key-for-aead"))
+	h.Write(nonce)
+
+	return tmp[:chacha20.KeySize], tmp[chacha20.KeySize:], h.Sum(nil), nil
+}
+
+func v4LocalTag(ak []byte, pieces ...[]byte) ([]byte, error) {
+	h, err := blake2b.New256(ak)
+	if err != nil {
+		return nil, errors.Wrap(err, "new blake2b")
+	}
+	h.Write(pae(pieces...))
+	return h.Sum(nil), nil
+}
+
+func v4LocalEncrypt(key, nonce, payload, footer, implicit []byte) (string, error) {
+	ek, n2, ak, err := v4LocalKeys(key, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(ek, n2)
+	if err != nil {
+		return "", errors.Wrap(err, "new xchacha20")
+	}
+	ciphertext := make([]byte, len(payload))
+	cipher.XORKeyStream(ciphertext, payload)
+
+	tag, err := v4LocalTag(ak, []byte(headerV4Local), nonce, ciphertext, footer, implicit)
+	if err != nil {
+		return "", err
+	}
+
+	body := make([]byte, 0, len(nonce)+len(ciphertext)+len(tag))
+	body = append(body, nonce...)
+	body = append(body, ciphertext...)
+	body = append(body, tag...)
+	return encodeToken(headerV4Local, body, footer), nil
+}
+
+func v4LocalDecrypt(key []byte, token string, footer, implicit []byte) ([]byte, error) {
+	body, err := decodeToken(headerV4Local, token, footer)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < v4LocalNonceSize+v4LocalTagSize {
+		return nil, errors.Errorf("token is too short")
+	}
+
+	nonce := body[:v4LocalNonceSize]
+	ciphertext := body[v4LocalNonceSize : len(body)-v4LocalTagSize]
+	tag := body[len(body)-v4LocalTagSize:]
+
+	ek, n2, ak, err := v4LocalKeys(key, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	expect, err := v4LocalTag(ak, []byte(headerV4Local), nonce, ciphertext, footer, implicit)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(tag, expect) != 1 {
+		return nil, errors.Errorf("invalid token")
+	}
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(ek, n2)
+	if err != nil {
+		return nil, errors.Wrap(err, "new xchacha20")
+	}
+	payload := make([]byte, len(ciphertext))
+	cipher.XORKeyStream(payload, ciphertext)
+	return payload, nil
+}
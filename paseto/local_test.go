@@ -0,0 +1,86 @@
+package paseto
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	gutils "github.com/Laisky/go-utils/v4"
+)
+
+type testClaims struct {
+	RegisteredClaims
+	Data string `json:"data"`
+}
+
+// test vector 4-E-1 from paseto-spec
+func TestV4LocalVector(t *testing.T) {
+	t.Parallel()
+
+	key, err := hex.DecodeString("707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f")
+	require.NoError(t, err)
+	payload := `{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`
+	expect := "v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQg"
+
+	token, err := v4LocalEncrypt(key, make([]byte, v4LocalNonceSize), []byte(payload), nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, expect, token)
+
+	got, err := v4LocalDecrypt(key, token, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, payload, string(got))
+
+	// expired in 2022
+	err = DecryptV4Local(key, token, new(testClaims))
+	require.ErrorContains(t, err, "expired")
+}
+
+func TestV4Local(t *testing.T) {
+	t.Parallel()
+
+	key, err := NewV4LocalKey()
+	require.NoError(t, err)
+	exp := gutils.Clock.GetUTCNow().Add(time.Hour)
+	opts := []Option{
+		WithFooter([]byte(`{"kid":"1"}`)),
+		WithImplicitAssertion([]byte("laisky")),
+	}
+
+	token, err := EncryptV4Local(key, &testClaims{
+		RegisteredClaims: RegisteredClaims{Subject: "user", ExpiresAt: &exp},
+		Data:             "secret",
+	}, opts...)
+	require.NoError(t, err)
+	require.NotContains(t, token, "secret")
+
+	footer, err := Footer(token)
+	require.NoError(t, err)
+	require.Equal(t, `{"kid":"1"}`, string(footer))
+
+	claims := new(testClaims)
+	require.NoError(t, DecryptV4Local(key, token, claims, opts...))
+	require.Equal(t, "user", claims.Subject)
+	require.Equal(t, "secret", claims.Data)
+
+	t.Run("invalid", func(t *testing.T) {
+		otherKey, err := NewV4LocalKey()
+		require.NoError(t, err)
+		require.Error(t, DecryptV4Local(otherKey, token, new(testClaims), opts...))
+
+		require.Error(t, DecryptV4Local(key, token, new(testClaims)), "footer mismatch")
+		require.Error(t, DecryptV4Local(key, token, new(testClaims),
+			WithFooter([]byte(`{"kid":"1"}`)),
+			WithImplicitAssertion([]byte("other")),
+		))
+
+		tampered := []byte(token)
+		tampered[len(headerV4Local)+50] ^= 1
+		require.Error(t, DecryptV4Local(key, string(tampered), new(testClaims), opts...))
+
+		require.Error(t, DecryptV4Local(key[:16], token, new(testClaims), opts...))
+		require.Error(t, DecryptV4Local(key, "v4.local.YWJj", new(testClaims)))
+		require.Error(t, DecryptV4Local(key, token, testClaims{}, opts...))
+	})
+}
@@ -0,0 +1,155 @@
+// Package paseto PASETO v4 tokens
+//
+// support v4.local (symmetric encryption) and v4.public (Ed25519 signature),
+// see https://github.com/paseto-standard/paseto-spec.
+//
+// each key can only be used by one purpose,
+// so tokens can not be used for algorithm confusion attacks.
+package paseto
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/golang-jwt/jwt/v4"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	gjson "github.com/Laisky/go-utils/v4/json"
+)
+
+const (
+	headerV4Local  = "v4.local."
+	headerV4Public = "v4.public."
+)
+
+var b64 = base64.RawURLEncoding
+
+type option struct {
+	footer,
+	implicit []byte
+}
+
+func (o *option) applyOpts(opts ...Option) (*option, error) {
+	for _, f := range opts {
+		if err := f(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// Option optional arguments for tokens
+type Option func(*option) error
+
+// WithFooter set footer of token
+//
+// footer is authenticated but not encrypted,
+// when parsing, footer of token should equal to it.
+func WithFooter(footer []byte) Option {
+	return func(o *option) error {
+		o.footer = footer
+		return nil
+	}
+}
+
+// WithImplicitAssertion set implicit assertion,
+// which is authenticated but not stored in token.
+func WithImplicitAssertion(implicit []byte) Option {
+	return func(o *option) error {
+		o.implicit = implicit
+		return nil
+	}
+}
+
+// pae pre-authentication encoding
+func pae(pieces ...[]byte) []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(len(pieces)))
+	for _, p := range pieces {
+		// MSB of length should be cleared
+		_ = binary.Write(&buf, binary.LittleEndian, uint64(len(p))&(1<<63-1))
+		buf.Write(p)
+	}
+
+	return buf.Bytes()
+}
+
+// encodeToken header || base64(body) [|| "." || base64(footer)]
+func encodeToken(header string, body, footer []byte) string {
+	token := header + b64.EncodeToString(body)
+	if len(footer) != 0 {
+		token += "." + b64.EncodeToString(footer)
+	}
+
+	return token
+}
+
+// decodeToken check header and footer, return decoded body
+func decodeToken(header, token string, footer []byte) (body []byte, err error) {
+	if !strings.HasPrefix(token, header) {
+		return nil, errors.Errorf("token should start with %q", header)
+	}
+
+	parts := strings.Split(token[len(header):], ".")
+	var gotFooter []byte
+	switch len(parts) {
+	case 1:
+	case 2:
+		if gotFooter, err = b64.DecodeString(parts[1]); err != nil {
+			return nil, errors.Wrap(err, "decode footer")
+		}
+	default:
+		return nil, errors.Errorf("invalid token format")
+	}
+
+	if subtle.ConstantTimeCompare(gotFooter, footer) != 1 {
+		return nil, errors.Errorf("footer mismatch")
+	}
+
+	if body, err = b64.DecodeString(parts[0]); err != nil {
+		return nil, errors.Wrap(err, "decode body")
+	}
+
+	return body, nil
+}
+
+// Footer get footer of token without verification,
+// can be used to find key id before parsing.
+func Footer(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	switch len(parts) {
+	case 3:
+		return nil, nil
+	case 4:
+		footer, err := b64.DecodeString(parts[3])
+		if err != nil {
+			return nil, errors.Wrap(err, "decode footer")
+		}
+
+		return footer, nil
+	default:
+		return nil, errors.Errorf("invalid token format")
+	}
+}
+
+// unmarshalClaims decode payload to claims, then validate claims
+func unmarshalClaims(payload []byte, claimsPtr jwt.Claims) error {
+	if !gutils.IsPtr(claimsPtr) {
+		return errors.New("claimsPtr must be a pointer")
+	}
+
+	if err := gjson.Unmarshal(payload, claimsPtr); err != nil {
+		return errors.Wrap(err, "unmarshal claims")
+	}
+
+	if err := claimsPtr.Valid(); err != nil {
+		return errors.Wrap(err, "invalid claims")
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package paseto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPAE(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, []byte("\x00\x00\x00\x00\x00\x00\x00\x00"), pae())
+	require.Equal(t, []byte("\x01\x00\x00\x00\x00\x00\x00\x00"+
+		"\x00\x00\x00\x00\x00\x00\x00\x00"), pae([]byte{}))
+	require.Equal(t, []byte("\x01\x00\x00\x00\x00\x00\x00\x00"+
+		"\x04\x00\x00\x00\x00\x00\x00\x00test"), pae([]byte("test")))
+}
+
+func TestFooter(t *testing.T) {
+	t.Parallel()
+
+	footer, err := Footer("v4.public.YWJj")
+	require.NoError(t, err)
+	require.Empty(t, footer)
+
+	footer, err = Footer("v4.public.YWJj.eyJraWQiOiIxIn0")
+	require.NoError(t, err)
+	require.Equal(t, `{"kid":"1"}`, string(footer))
+
+	_, err = Footer("v4.public")
+	require.Error(t, err)
+	_, err = Footer("v4.public.YWJj.!!")
+	require.Error(t, err)
+}
+
+func TestDecodeToken(t *testing.T) {
+	t.Parallel()
+
+	body, err := decodeToken(headerV4Public, "v4.public.YWJj", nil)
+	require.NoError(t, err)
+	require.Equal(t, "abc", string(body))
+
+	body, err = decodeToken(headerV4Public, "v4.public.YWJj.Zm9v", []byte("foo"))
+	require.NoError(t, err)
+	require.Equal(t, "abc", string(body))
+
+	_, err = decodeToken(headerV4Local, "v4.public.YWJj", nil)
+	require.ErrorContains(t, err, "should start with")
+	_, err = decodeToken(headerV4Public, "v4.public.YWJj.Zm9v", nil)
+	require.ErrorContains(t, err, "footer mismatch")
+	_, err = decodeToken(headerV4Public, "v4.public.YWJj", []byte("foo"))
+	require.ErrorContains(t, err, "footer mismatch")
+	_, err = decodeToken(headerV4Public, "v4.public.YWJj.Zm9v.Zm9v", []byte("foo"))
+	require.Error(t, err)
+	_, err = decodeToken(headerV4Public, "v4.public.YWJj=", nil)
+	require.Error(t, err)
+}
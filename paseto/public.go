@@ -0,0 +1,77 @@
+package paseto
+
+import (
+	"crypto/ed25519"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/golang-jwt/jwt/v4"
+
+	gjson "github.com/Laisky/go-utils/v4/json"
+)
+
+// SignV4Public sign claims to v4.public token
+//
+// prikey can be generated by crypto.NewEd25519Prikey
+func SignV4Public(prikey ed25519.PrivateKey, claims any, opts ...Option) (string, error) {
+	if len(prikey) != ed25519.PrivateKeySize {
+		return "", errors.Errorf("private key should be %d bytes", ed25519.PrivateKeySize)
+	}
+
+	opt, err := new(option).applyOpts(opts...)
+	if err != nil {
+		return "", errors.Wrap(err, "apply options")
+	}
+
+	payload, err := gjson.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal claims")
+	}
+
+	return v4PublicSign(prikey, payload, opt.footer, opt.implicit), nil
+}
+
+// VerifyV4Public verify v4.public token, then validate claims
+func VerifyV4Public(pubkey ed25519.PublicKey, token string, claimsPtr jwt.Claims, opts ...Option) error {
+	opt, err := new(option).applyOpts(opts...)
+	if err != nil {
+		return errors.Wrap(err, "apply options")
+	}
+
+	payload, err := v4PublicVerify(pubkey, token, opt.footer, opt.implicit)
+	if err != nil {
+		return err
+	}
+
+	return unmarshalClaims(payload, claimsPtr)
+}
+
+func v4PublicSign(prikey ed25519.PrivateKey, payload, footer, implicit []byte) string {
+	sig := ed25519.Sign(prikey, pae([]byte(headerV4Public), payload, footer, implicit))
+
+	body := make([]byte, 0, len(payload)+len(sig))
+	body = append(body, payload...)
+	body = append(body, sig...)
+	return encodeToken(headerV4Public, body, footer)
+}
+
+func v4PublicVerify(pubkey ed25519.PublicKey, token string, footer, implicit []byte) ([]byte, error) {
+	if len(pubkey) != ed25519.PublicKeySize {
+		return nil, errors.Errorf("public key should be %d bytes", ed25519.PublicKeySize)
+	}
+
+	body, err := decodeToken(headerV4Public, token, footer)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < ed25519.SignatureSize {
+		return nil, errors.Errorf("token is too short")
+	}
+
+	payload := body[:len(body)-ed25519.SignatureSize]
+	sig := body[len(body)-ed25519.SignatureSize:]
+	if !ed25519.Verify(pubkey, pae([]byte(headerV4Public), payload, footer, implicit), sig) {
+		return nil, errors.Errorf("invalid signature")
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,91 @@
+package paseto
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	gutils "github.com/Laisky/go-utils/v4"
+	gcrypto "github.com/Laisky/go-utils/v4/crypto"
+)
+
+// test vector 4-S-1 from paseto-spec
+func TestV4PublicVector(t *testing.T) {
+	t.Parallel()
+
+	prikey, err := hex.DecodeString("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a3774" +
+		"1eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2")
+	require.NoError(t, err)
+	pubkey := ed25519.PrivateKey(prikey).Public().(ed25519.PublicKey)
+	payload := `{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`
+	expect := "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA"
+
+	token := v4PublicSign(prikey, []byte(payload), nil, nil)
+	require.Equal(t, expect, token)
+
+	got, err := v4PublicVerify(pubkey, token, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, payload, string(got))
+
+	// expired in 2022
+	err = VerifyV4Public(pubkey, token, new(testClaims))
+	require.ErrorContains(t, err, "expired")
+}
+
+func TestV4Public(t *testing.T) {
+	t.Parallel()
+
+	prikey, err := gcrypto.NewEd25519Prikey()
+	require.NoError(t, err)
+	pubkey := prikey.Public().(ed25519.PublicKey)
+	exp := gutils.Clock.GetUTCNow().Add(time.Hour)
+	opts := []Option{
+		WithFooter([]byte(`{"kid":"1"}`)),
+		WithImplicitAssertion([]byte("laisky")),
+	}
+
+	token, err := SignV4Public(prikey, &testClaims{
+		RegisteredClaims: RegisteredClaims{Subject: "user", ExpiresAt: &exp},
+		Data:             "hello",
+	}, opts...)
+	require.NoError(t, err)
+
+	claims := new(testClaims)
+	require.NoError(t, VerifyV4Public(pubkey, token, claims, opts...))
+	require.Equal(t, "user", claims.Subject)
+	require.Equal(t, "hello", claims.Data)
+
+	t.Run("invalid", func(t *testing.T) {
+		otherPrikey, err := gcrypto.NewEd25519Prikey()
+		require.NoError(t, err)
+		require.Error(t, VerifyV4Public(otherPrikey.Public().(ed25519.PublicKey),
+			token, new(testClaims), opts...))
+
+		require.Error(t, VerifyV4Public(pubkey, token, new(testClaims)), "footer mismatch")
+		require.Error(t, VerifyV4Public(pubkey, token, new(testClaims),
+			WithFooter([]byte(`{"kid":"1"}`)),
+			WithImplicitAssertion([]byte("other")),
+		))
+
+		tampered := []byte(token)
+		tampered[len(headerV4Public)+5] ^= 1
+		require.Error(t, VerifyV4Public(pubkey, string(tampered), new(testClaims), opts...))
+
+		_, err = SignV4Public(prikey[:32], &testClaims{})
+		require.Error(t, err)
+		require.Error(t, VerifyV4Public(pubkey[:16], token, new(testClaims), opts...))
+	})
+
+	t.Run("no algorithm confusion", func(t *testing.T) {
+		// public key used as local key
+		require.Error(t, DecryptV4Local(pubkey, token, new(testClaims), opts...))
+
+		localToken, err := EncryptV4Local([]byte(pubkey), &testClaims{}, opts...)
+		require.NoError(t, err)
+		require.ErrorContains(t, VerifyV4Public(pubkey, localToken, new(testClaims), opts...),
+			"should start with")
+	})
+}
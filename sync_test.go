@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"sync"
 	"testing"
@@ -277,6 +278,55 @@ func TestNewFlock(t *testing.T) {
 		require.NoError(t, flock1.Unlock())
 		require.NoError(t, flock2.Unlock())
 	})
+
+	t.Run("multi process", func(t *testing.T) {
+		// fcntl lock is held by process, so run helpers in subprocesses
+		owner := filepath.Join(dir, "owner")
+		var pool errgroup.Group
+		for i := 0; i < 8; i++ {
+			pool.Go(func() error {
+				cmd := exec.Command(os.Args[0], "-test.run=^TestFlockHelperProcess$")
+				cmd.Env = append(os.Environ(),
+					"FLOCK_HELPER_LOCKFILE="+lockfile,
+					"FLOCK_HELPER_OWNER="+owner,
+				)
+				if out, err := cmd.CombinedOutput(); err != nil {
+					return errors.Wrapf(err, "helper failed: %s", out)
+				}
+
+				return nil
+			})
+		}
+
+		require.NoError(t, pool.Wait())
+	})
+}
+
+// TestFlockHelperProcess lock -> unlock -> relock in loop,
+// only one process should be in critical section at any time.
+func TestFlockHelperProcess(t *testing.T) {
+	lockfile := os.Getenv("FLOCK_HELPER_LOCKFILE")
+	owner := os.Getenv("FLOCK_HELPER_OWNER")
+	if lockfile == "" || owner == "" {
+		t.Skip("only run as helper of TestNewFlock")
+	}
+
+	f := NewFlock(lockfile)
+	for acquired := 0; acquired < 100; {
+		if err := f.Lock(); err != nil {
+			time.Sleep(10 * time.Microsecond)
+			continue
+		}
+
+		fp, err := os.OpenFile(owner, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		require.NoError(t, err, "another process holds the lock")
+		require.NoError(t, fp.Close())
+		time.Sleep(time.Millisecond)
+		require.NoError(t, os.Remove(owner))
+
+		require.NoError(t, f.Unlock())
+		acquired++
+	}
 }
 
 func TestRaceErrWithCtx(t *testing.T) {
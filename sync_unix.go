@@ -29,11 +29,15 @@ func NewFlock(lockFilePath string) FLock {
 }
 
 func (f *flock) Unlock() error {
+	// unlink before close while lock is still held,
+	// otherwise another process may lock the old inode after close,
+	// and a third process creates and locks a new file in path.
+	_ = syscall.Unlink(f.fpath)
 	if err := syscall.Close(f.fd); err != nil {
 		return errors.Wrap(err, "close file")
 	}
 
-	_ = syscall.Unlink(f.fpath)
+	f.fd = -1
 	return nil
 }
 
@@ -50,8 +54,27 @@ func (f *flock) Lock() (err error) {
 		Len:    0,
 	}
 	if err := syscall.FcntlFlock(uintptr(f.fd), syscall.F_SETLK, &flock); err != nil {
+		f.closeFd()
 		return errors.Wrap(err, "FcntlFlock(F_SETLK)")
 	}
 
+	// lock file may be unlinked by previous holder during locking,
+	// make sure the locked file is still the one in path.
+	var fdStat, pathStat syscall.Stat_t
+	if err = syscall.Fstat(f.fd, &fdStat); err != nil {
+		f.closeFd()
+		return errors.Wrapf(err, "stat fd of `%s`", f.fpath)
+	}
+	if err = syscall.Stat(f.fpath, &pathStat); err != nil ||
+		fdStat.Ino != pathStat.Ino || fdStat.Dev != pathStat.Dev {
+		f.closeFd()
+		return errors.Errorf("lock file `%s` has been replaced", f.fpath)
+	}
+
 	return nil
 }
+
+func (f *flock) closeFd() {
+	_ = syscall.Close(f.fd)
+	f.fd = -1
+}
@@ -322,22 +322,19 @@ func GetStructFieldByName(st any, fieldName string) any {
 //
 // Args:
 //   - filepath: file path to check
-//   - hashed: hashed string, like `sha256: xxxx`
+//   - hashed: hashed string, like `sha256: xxxx`,
+//     hasher can be any type registered in HashType, like `sha3-256:xxxx`
 func ValidateFileHash(filepath string, hashed string) error {
 	hs := strings.Split(hashed, ":")
 	if len(hs) != 2 {
 		return errors.Errorf("unknown hashed format, expect is `sha256:xxxx`, but got `%s`", hashed)
 	}
 
-	var hasher HashType
-	switch hs[0] {
-	case "sha256":
-		hasher = HashTypeSha256
-	case "md5":
-		hasher = HashTypeMD5
-	default:
-		return errors.Errorf("unknown hasher `%s`", hs[0])
+	hasher, err := ParseHashType(hs[0])
+	if err != nil {
+		return errors.Wrapf(err, "unknown hasher `%s`", hs[0])
 	}
+	hs[1] = strings.TrimSpace(hs[1])
 
 	fp, err := os.Open(filepath)
 	if err != nil {
@@ -150,6 +150,12 @@ func TestValidateFileHash(t *testing.T) {
 		"md5:794e37eea6b3df6e6eba69eb02f9b8c7",
 	)
 	require.NoError(t, err)
+
+	err = ValidateFileHash(
+		fp.Name(),
+		"sha3-256: 2b9aaec24517ec797c0095881a5b043314a2d766898886fbd7137096ab420803",
+	)
+	require.NoError(t, err)
 }
 
 func TestJSON(t *testing.T) {